@@ -0,0 +1,3 @@
+// Package api contains the requests and responses of the gobin API. The server and the client share them, so Go
+// programs can talk to gobin without depending on the server.
+package api
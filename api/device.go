@@ -0,0 +1,44 @@
+package api
+
+import "errors"
+
+// The device authorization errors use the error codes of RFC 8628, so clients can tell them apart.
+var (
+	ErrDeviceAuthorizationPending  = errors.New("authorization_pending")
+	ErrDeviceAuthorizationSlowDown = errors.New("slow_down")
+	ErrDeviceAuthorizationDenied   = errors.New("access_denied")
+	ErrDeviceAuthorizationExpired  = errors.New("expired_token")
+)
+
+type (
+	DeviceCodeRequest struct {
+		Permissions []string `json:"permissions"`
+		// Account requests an account token of the account which approves the login.
+		Account bool `json:"account"`
+	}
+
+	DeviceCodeResponse struct {
+		DeviceCode              string `json:"device_code"`
+		UserCode                string `json:"user_code"`
+		VerificationURI         string `json:"verification_uri"`
+		VerificationURIComplete string `json:"verification_uri_complete"`
+		ExpiresIn               int    `json:"expires_in"`
+		Interval                int    `json:"interval"`
+	}
+
+	DeviceTokenRequest struct {
+		DeviceCode string `json:"device_code"`
+	}
+
+	DeviceTokenResponse struct {
+		Tokens []DeviceToken `json:"tokens"`
+		// AccountToken is only set if the device requested an account token.
+		AccountToken string `json:"account_token,omitempty"`
+	}
+
+	DeviceToken struct {
+		Key         string   `json:"key"`
+		Token       string   `json:"token"`
+		Permissions []string `json:"permissions"`
+	}
+)
@@ -0,0 +1,44 @@
+package api
+
+import "github.com/topi314/gobin/v3/internal/diff"
+
+type (
+	DiffResponse struct {
+		Key string `json:"key"`
+		// From is 0 if To is the first version of the document.
+		From  int64      `json:"from"`
+		To    int64      `json:"to"`
+		Files []DiffFile `json:"files"`
+	}
+
+	// DiffFile is the unified diff of a file. OldName or NewName is empty if the file was added or removed.
+	DiffFile struct {
+		OldName string `json:"old_name"`
+		NewName string `json:"new_name"`
+		Added   int    `json:"added"`
+		Removed int    `json:"removed"`
+		Diff    string `json:"diff"`
+	}
+)
+
+// CompareFile is the diff of a file pair. AName or BName is empty if the file only exists in one document.
+type CompareFile struct {
+	AName    string     `json:"a_name"`
+	BName    string     `json:"b_name"`
+	Language string     `json:"language"`
+	Added    int        `json:"added"`
+	Removed  int        `json:"removed"`
+	Rows     []diff.Row `json:"rows"`
+}
+
+type RevisionResponse struct {
+	Key      string `json:"key"`
+	Revision int64  `json:"revision"`
+	// BaseVersion is the latest version of the document when the revision was submitted.
+	BaseVersion int64 `json:"base_version"`
+	// Outdated is true if the document was updated after the revision was submitted.
+	Outdated bool           `json:"outdated"`
+	Files    []ResponseFile `json:"files"`
+	// Changes is the diff from the latest version of the document to the revision.
+	Changes []CompareFile `json:"changes,omitempty"`
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"fmt"
+	"time"
+)
+
+// The limits of documents, they are named like their config.
+const (
+	LimitMaxDocumentSize = "max_document_size"
+	LimitMaxFileSize     = "max_file_size"
+	LimitMaxFiles        = "max_files"
+)
+
+// LimitError is returned with 413 Content Too Large when a document exceeds one of the limits. It's added to the error
+// response, so clients know which limit and file caused it.
+type LimitError struct {
+	Limit string `json:"limit"`
+	Max   int64  `json:"max"`
+	// File is the file which exceeded the limit, empty if the limit isn't about a single file.
+	File string `json:"file,omitempty"`
+}
+
+func (e *LimitError) Error() string {
+	switch e.Limit {
+	case LimitMaxFiles:
+		return fmt.Sprintf("too many files, documents can have at most %d files", e.Max)
+	case LimitMaxFileSize:
+		return fmt.Sprintf("file %q too large, files can be at most %d bytes", e.File, e.Max)
+	default:
+		if e.File == "" {
+			return fmt.Sprintf("document too large, all files together can be at most %d bytes", e.Max)
+		}
+		return fmt.Sprintf("document too large at file %q, all files together can be at most %d bytes", e.File, e.Max)
+	}
+}
+
+type (
+	DocumentResponse struct {
+		Key          string `json:"key"`
+		Version      int64  `json:"version"`
+		VersionLabel string `json:"version_label,omitempty"`
+		VersionTime  string `json:"version_time,omitempty"`
+		// VersionMessage describes the changes of the version like a commit message.
+		VersionMessage string         `json:"version_message,omitempty"`
+		Files          []ResponseFile `json:"files"`
+		Token          string         `json:"token,omitempty"`
+		// DefaultStyle is the style the creator suggested for viewers of the document.
+		DefaultStyle string `json:"default_style,omitempty"`
+	}
+
+	ResponseFile struct {
+		Name      string     `json:"name"`
+		Content   string     `json:"content,omitempty"`
+		Formatted string     `json:"formatted,omitempty"`
+		Language  string     `json:"language"`
+		Encrypted bool       `json:"encrypted,omitempty"`
+		ExpiresAt *time.Time `json:"expires_at"`
+		// SHA256 is the checksum of the stored content, MD5 and SHA1 are only returned for single files.
+		SHA256 string `json:"sha256,omitempty"`
+		SHA1   string `json:"sha1,omitempty"`
+		MD5    string `json:"md5,omitempty"`
+		// Signature is only returned for documents and files of a single version.
+		Signature *FileSignatureResponse `json:"signature,omitempty"`
+	}
+
+	RequestFile struct {
+		Name     string
+		Content  string
+		Language string
+		// Encrypted files are encrypted by the client, the server stores them without highlighting or previews.
+		Encrypted bool
+		ExpiresAt *time.Time
+	}
+
+	DeleteResponse struct {
+		Versions int `json:"versions"`
+	}
+
+	ShareRequest struct {
+		Permissions []string `json:"permissions"`
+		// ExpiresIn is a duration like 1h after which the token stops working, empty for tokens which don't expire.
+		ExpiresIn string `json:"expires_in,omitempty"`
+		// MaxUses is the number of requests the token can be used for, 0 for tokens which can be used any number of
+		// times.
+		MaxUses int64 `json:"max_uses,omitempty"`
+	}
+
+	ShareResponse struct {
+		// ID is the id to revoke the token with.
+		ID        string     `json:"id"`
+		Token     string     `json:"token"`
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
+		MaxUses   int64      `json:"max_uses,omitempty"`
+	}
+)
+
+// The rotations of appends to a file which would grow larger than its max size.
+const (
+	AppendRotateVersion = "version"
+	AppendRotateFile    = "file"
+)
+
+// AppendResponse describes the version created by an append. Rotated is the new name of the file which was full, it is
+// only set if the rotation is file.
+type AppendResponse struct {
+	Key     string `json:"key"`
+	Version int64  `json:"version"`
+	File    string `json:"file"`
+	Size    int    `json:"size"`
+	Rotated string `json:"rotated,omitempty"`
+}
+
+type FromURLRequest struct {
+	FromURL string `json:"from_url"`
+}
+
+// GistImportRequest is the body of a gist import, Gist is the id or url of the gist.
+type GistImportRequest struct {
+	Gist string `json:"gist"`
+}
+
+// PartsResponse lists the documents content was split into because it was too large for a single document. Index is
+// the first part, Parts are the keys of all parts in order starting with the index.
+type PartsResponse struct {
+	Index string   `json:"index"`
+	Parts []string `json:"parts"`
+}
+
+type DocumentStyleRequest struct {
+	Style string `json:"style"`
+}
+
+// LiveEvent is sent to the live streams of a document.
+type LiveEvent struct {
+	Event       string `json:"event"`
+	DocumentKey string `json:"document_key"`
+	Version     int64  `json:"version"`
+}
+
+type (
+	// LockRequest acquires, renews or steals the lock of a document. Requests with the id of the current lock in the
+	// Document-Lock header renew it.
+	LockRequest struct {
+		// TTL is a duration like 5m after which the lock expires unless it's renewed, it defaults to 5m.
+		TTL string `json:"ttl,omitempty"`
+		// Holder describes who holds the lock, like the name of a CI job.
+		Holder string `json:"holder,omitempty"`
+		// Steal takes over the lock of another holder which didn't release it, like a job which crashed.
+		Steal bool `json:"steal,omitempty"`
+	}
+
+	// LockResponse is the lock of a document, ID is only returned to the holder.
+	LockResponse struct {
+		ID        string    `json:"id,omitempty"`
+		Holder    string    `json:"holder"`
+		CreatedAt time.Time `json:"created_at"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+)
+
+// LockedError is returned when a document is locked by another holder.
+type LockedError struct {
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (e *LockedError) Error() string {
+	if e.Holder == "" {
+		return fmt.Sprintf("document is locked until %s", e.ExpiresAt.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("document is locked by %s until %s", e.Holder, e.ExpiresAt.Format(time.RFC3339))
+}
+
+// FileSignatureResponse is a detached signature of a file version, it was verified with the public key when it
+// was attached.
+type FileSignatureResponse struct {
+	Format    string    `json:"format"`
+	KeyID     string    `json:"key_id"`
+	Comment   string    `json:"comment,omitempty"`
+	PublicKey string    `json:"public_key"`
+	Signature string    `json:"signature"`
+	Verified  bool      `json:"verified"`
+	CreatedAt time.Time `json:"created_at"`
+}
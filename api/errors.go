@@ -0,0 +1,28 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+)
+
+// ErrorResponse is the error response of the server, Limit is only set when a limit of documents was exceeded,
+// Conflict when the document was changed since the version of the If-Match header and Lock when the document is locked
+// by another holder.
+type ErrorResponse struct {
+	ezhttp.ErrorResponse
+	Limit    *LimitError    `json:"limit,omitempty"`
+	Conflict *ConflictError `json:"conflict,omitempty"`
+	Lock     *LockedError   `json:"lock,omitempty"`
+}
+
+// ConflictError is returned when the latest version of a document isn't the version of the If-Match header anymore,
+// Version is the version the update is based on and CurrentVersion the latest version.
+type ConflictError struct {
+	Version        int64 `json:"version"`
+	CurrentVersion int64 `json:"current_version"`
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("document was changed since version %d, the latest version is %d", e.Version, e.CurrentVersion)
+}
@@ -0,0 +1,44 @@
+package api
+
+import "time"
+
+type (
+	InviteCreateRequest struct {
+		Permissions []string `json:"permissions"`
+		// MaxUses is 0 for invites which can be used any number of times.
+		MaxUses   int64      `json:"max_uses"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	InviteResponse struct {
+		ID          string     `json:"id"`
+		DocumentKey string     `json:"document_key"`
+		URL         string     `json:"url"`
+		Permissions []string   `json:"permissions"`
+		MaxUses     int64      `json:"max_uses"`
+		Uses        int64      `json:"uses"`
+		ExpiresAt   *time.Time `json:"expires_at"`
+		CreatedAt   time.Time  `json:"created_at"`
+	}
+
+	InvitesResponse struct {
+		Invites []InviteResponse `json:"invites"`
+	}
+
+	InviteAcceptResponse struct {
+		DocumentKey string   `json:"document_key"`
+		Token       string   `json:"token"`
+		Permissions []string `json:"permissions"`
+	}
+
+	MemberResponse struct {
+		ID          string    `json:"id"`
+		Permissions []string  `json:"permissions"`
+		InviteID    string    `json:"invite_id"`
+		JoinedAt    time.Time `json:"joined_at"`
+	}
+
+	MembersResponse struct {
+		Members []MemberResponse `json:"members"`
+	}
+)
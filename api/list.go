@@ -0,0 +1,25 @@
+package api
+
+import "time"
+
+type (
+	DocumentListResponse struct {
+		Documents []ListedDocument `json:"documents"`
+		// Next is the cursor of the next page, it is empty on the last page.
+		Next string `json:"next"`
+	}
+
+	ListedDocument struct {
+		Key       string       `json:"key"`
+		Version   int64        `json:"version"`
+		UpdatedAt time.Time    `json:"updated_at"`
+		Files     []ListedFile `json:"files"`
+	}
+
+	ListedFile struct {
+		Name      string     `json:"name"`
+		Language  string     `json:"language"`
+		Encrypted bool       `json:"encrypted,omitempty"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+)
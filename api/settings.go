@@ -0,0 +1,24 @@
+package api
+
+import "time"
+
+type (
+	UserSettingsRequest struct {
+		DefaultStyle    string `json:"default_style"`
+		DefaultExpiry   string `json:"default_expiry"`
+		EditorKeymap    string `json:"editor_keymap"`
+		DefaultLanguage string `json:"default_language"`
+	}
+
+	UserSettingsResponse struct {
+		DefaultStyle    string     `json:"default_style"`
+		DefaultExpiry   string     `json:"default_expiry"`
+		EditorKeymap    string     `json:"editor_keymap"`
+		DefaultLanguage string     `json:"default_language"`
+		UpdatedAt       *time.Time `json:"updated_at,omitempty"`
+	}
+
+	UserTokenResponse struct {
+		Token string `json:"token"`
+	}
+)
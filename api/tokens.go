@@ -0,0 +1,35 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// AllStringPermissions are the names of all permissions of tokens.
+var AllStringPermissions = []string{"write", "delete", "share", "webhook", "review"}
+
+// TokenID returns the id tokens are revoked with, which is the jti claim of the token or the hex encoded SHA-256 of
+// tokens without one like the token of the creator.
+func TokenID(token string, jti string) string {
+	if jti != "" {
+		return jti
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type (
+	ReadTokenRequest struct {
+		Documents []ReadTokenDocument `json:"documents"`
+	}
+
+	ReadTokenDocument struct {
+		Key   string `json:"key"`
+		Token string `json:"token"`
+	}
+
+	ReadTokenResponse struct {
+		Token     string   `json:"token"`
+		Documents []string `json:"documents"`
+	}
+)
@@ -0,0 +1,114 @@
+package api
+
+import "time"
+
+// WebhookSchemaVersion is the version of the payload of webhook events, payloads without a version are version 1.
+const WebhookSchemaVersion = 1
+
+type (
+	WebhookCreateRequest struct {
+		URL    string   `json:"url"`
+		Secret string   `json:"secret"`
+		Events []string `json:"events"`
+		// ClientCertificate and ClientKey are PEM encoded, they are used for mutual TLS with the url.
+		ClientCertificate string `json:"client_certificate,omitempty"`
+		ClientKey         string `json:"client_key,omitempty"`
+		// Enabled defaults to true, disabled webhooks don't receive events.
+		Enabled *bool `json:"enabled,omitempty"`
+	}
+
+	WebhookUpdateRequest struct {
+		URL                     string   `json:"url"`
+		Secret                  string   `json:"secret"`
+		Events                  []string `json:"events"`
+		ClientCertificate       string   `json:"client_certificate,omitempty"`
+		ClientKey               string   `json:"client_key,omitempty"`
+		RemoveClientCertificate bool     `json:"remove_client_certificate,omitempty"`
+		Enabled                 *bool    `json:"enabled,omitempty"`
+	}
+
+	WebhookResponse struct {
+		ID string `json:"id"`
+		// DocumentKey is only set for document webhooks and AccountID only for account webhooks.
+		DocumentKey string `json:"document_key,omitempty"`
+		AccountID   string `json:"account_id,omitempty"`
+		URL         string `json:"url"`
+		// Secret is only returned when the webhook is created, it's stored encrypted afterward.
+		Secret            string                            `json:"secret,omitempty"`
+		Events            []string                          `json:"events"`
+		ClientCertificate *WebhookClientCertificateResponse `json:"client_certificate,omitempty"`
+		Enabled           bool                              `json:"enabled"`
+		// DisabledReason is set when the webhook was disabled because the receiver responded with 410 Gone.
+		DisabledReason string `json:"disabled_reason,omitempty"`
+	}
+
+	WebhookDeliveriesResponse struct {
+		Deliveries []WebhookDeliveryResponse `json:"deliveries"`
+	}
+
+	WebhookDeliveryResponse struct {
+		ID        string                           `json:"id"`
+		Event     string                           `json:"event"`
+		Status    string                           `json:"status"`
+		CreatedAt time.Time                        `json:"created_at"`
+		Attempts  []WebhookDeliveryAttemptResponse `json:"attempts"`
+	}
+
+	WebhookDeliveryAttemptResponse struct {
+		StatusCode int       `json:"status_code,omitempty"`
+		Error      string    `json:"error,omitempty"`
+		CreatedAt  time.Time `json:"created_at"`
+	}
+
+	WebhookEventRequest struct {
+		// SchemaVersion is WebhookSchemaVersion, it changes when the payload changes in a way receivers have to handle.
+		SchemaVersion int       `json:"schema_version"`
+		WebhookID     string    `json:"webhook_id"`
+		Event         string    `json:"event"`
+		CreatedAt     time.Time `json:"created_at"`
+		// Document is empty for events of the account like login.
+		Document WebhookDocument `json:"document,omitzero"`
+		// Session is only set for login events of account webhooks.
+		Session *WebhookSession `json:"session,omitempty"`
+	}
+
+	WebhookSession struct {
+		ID        string `json:"id"`
+		AccountID string `json:"account_id"`
+		// Kind is browser for logins in the web UI and token for tokens of the CLI and API clients.
+		Kind      string    `json:"kind"`
+		UserAgent string    `json:"user_agent"`
+		Address   string    `json:"address"`
+		CreatedAt time.Time `json:"created_at"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	WebhookDocument struct {
+		Key     string `json:"key"`
+		Version int64  `json:"version"`
+		// Revision is only set for pending revisions, Version is the version the revision is based on then.
+		Revision int64                 `json:"revision,omitempty"`
+		Files    []WebhookDocumentFile `json:"files"`
+		// ContentOmitted is set when the document is larger than the max payload size, the files have no content then.
+		ContentOmitted bool `json:"content_omitted,omitempty"`
+	}
+
+	WebhookDocumentFile struct {
+		Name      string     `json:"name"`
+		Content   string     `json:"content"`
+		Language  string     `json:"language"`
+		Encrypted bool       `json:"encrypted,omitempty"`
+		ExpiresAt *time.Time `json:"expires_at"`
+		// Size and ContentURL are only set when the content is omitted, the content url is signed and expires.
+		Size       int    `json:"size,omitempty"`
+		ContentURL string `json:"content_url,omitempty"`
+	}
+)
+
+// WebhookClientCertificateResponse describes the client certificate of a webhook, the key is never returned.
+type WebhookClientCertificateResponse struct {
+	Subject  string    `json:"subject"`
+	Issuer   string    `json:"issuer"`
+	NotAfter time.Time `json:"not_after"`
+	SHA256   string    `json:"sha256"`
+}
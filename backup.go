@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/topi314/gobin/v3/server"
+)
+
+const (
+	backupActionExport            = "export"
+	backupActionRestore           = "restore"
+	backupActionCompactTombstones = "compact-tombstones"
+)
+
+func isBackupCommand(name string) bool {
+	return name == backupActionExport || name == backupActionRestore || name == backupActionCompactTombstones
+}
+
+// backupCommand exports, restores or compacts the tombstones of the database instead of starting the server.
+type backupCommand struct {
+	action    string
+	file      string
+	retention time.Duration
+}
+
+func parseBackupCommand(action string, args []string) (*backupCommand, error) {
+	cmd := &backupCommand{action: action}
+	flags := flag.NewFlagSet(action, flag.ContinueOnError)
+	switch action {
+	case backupActionExport:
+		flags.StringVar(&cmd.file, "output", "backup.jsonl", "the file to write the backup to, files ending in .tar.zst are written as compressed archive")
+		flags.StringVar(&cmd.file, "out", "backup.jsonl", "alias for --output")
+		flags.Usage = func() {
+			_, _ = fmt.Fprintln(flags.Output(), "Usage: gobin [--config gobin.toml] export [flags]")
+			flags.PrintDefaults()
+		}
+	case backupActionRestore:
+		flags.Usage = func() {
+			_, _ = fmt.Fprintln(flags.Output(), "Usage: gobin [--config gobin.toml] restore <file>")
+			flags.PrintDefaults()
+		}
+	case backupActionCompactTombstones:
+		flags.DurationVar(&cmd.retention, "retention", 0, "delete tombstones older than this, defaults to tombstones.retention")
+		flags.Usage = func() {
+			_, _ = fmt.Fprintln(flags.Output(), "Usage: gobin [--config gobin.toml] compact-tombstones [flags]")
+			flags.PrintDefaults()
+		}
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if action == backupActionRestore {
+		if flags.NArg() == 0 {
+			return nil, errors.New("backup file is required")
+		}
+		cmd.file = flags.Arg(0)
+		if err := flags.Parse(flags.Args()[1:]); err != nil {
+			return nil, err
+		}
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %v", flags.Args())
+	}
+	if cmd.retention < 0 {
+		return nil, errors.New("retention must not be negative")
+	}
+	return cmd, nil
+}
+
+// run executes the command, the retention of the config is used if no retention was given.
+func (c *backupCommand) run(ctx context.Context, s *server.Server, cfg server.TombstonesConfig) error {
+	switch c.action {
+	case backupActionExport:
+		f, err := os.Create(c.file)
+		if err != nil {
+			return fmt.Errorf("failed to create backup file: %w", err)
+		}
+		defer f.Close()
+		if strings.HasSuffix(c.file, ".tar.zst") {
+			err = s.ExportArchive(ctx, f)
+		} else {
+			err = s.Export(ctx, f)
+		}
+		if err != nil {
+			_ = os.Remove(c.file)
+			return err
+		}
+		slog.Info("Exported backup", slog.String("file", c.file))
+	case backupActionRestore:
+		f, err := os.Open(c.file)
+		if err != nil {
+			return fmt.Errorf("failed to open backup file: %w", err)
+		}
+		defer f.Close()
+		result, err := s.Restore(ctx, f)
+		slog.Info("Restored backup", slog.Int("versions", result.Versions), slog.Int("tombstones", result.Tombstones), slog.Int("documents", result.Documents), slog.Int("skipped", result.Skipped))
+		return err
+	case backupActionCompactTombstones:
+		retention := c.retention
+		if retention == 0 {
+			retention = time.Duration(cfg.Retention)
+		}
+		if retention == 0 {
+			return errors.New("retention is required, set it with --retention or tombstones.retention")
+		}
+		if err := s.CompactTombstones(ctx, time.Now().Add(-retention)); err != nil {
+			return fmt.Errorf("failed to compact tombstones: %w", err)
+		}
+		slog.Info("Compacted tombstones", slog.Duration("retention", retention))
+	}
+	return nil
+}
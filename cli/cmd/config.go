@@ -0,0 +1,314 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/topi314/chroma/v2/styles"
+
+	"github.com/topi314/gobin/v3/client"
+	"github.com/topi314/gobin/v3/internal/cfg"
+)
+
+// configKey is a gobin variable the CLI reads. Keys with Prefix are followed by a document key like TOKENS_{key}.
+type configKey struct {
+	Name        string
+	Description string
+	Prefix      bool
+	// Secret values are hidden by gobin config list.
+	Secret   bool
+	Validate func(value string) error
+}
+
+var configKeys = []configKey{
+	{Name: "SERVER", Description: "Gobin server address", Validate: validateConfigURL},
+	{Name: "FORMATTER", Description: "Formatter of gobin get", Validate: validateConfigFormatter},
+	{Name: "STYLE", Description: "Style of gobin get and gobin diff", Validate: validateConfigStyle},
+	{Name: "USER_TOKEN", Description: "User or account token", Secret: true},
+	{Name: "GITHUB_TOKEN", Description: "GitHub token of gobin export-gist", Secret: true},
+	{Name: "GITHUB_API_URL", Description: "GitHub API of gobin export-gist", Validate: validateConfigURL},
+	{Name: "WEBHOOK_SECRET", Description: "Secret of gobin webhook verify", Secret: true},
+	{Name: "VERBOSE", Description: "Log the requests to the gobin server", Validate: validateConfigBool},
+	{Name: "DEBUG", Description: "Log the requests with their headers and bodies", Validate: validateConfigBool},
+	{Name: "TOKENS_", Description: "Token of a document", Prefix: true, Secret: true},
+	{Name: "KEYS_", Description: "Encryption key of a document", Prefix: true, Secret: true, Validate: validateConfigEncryptionKey},
+}
+
+func NewConfigCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:     "config",
+		GroupID: "actions",
+		Short:   "Gets, sets or lists the settings of the CLI in the gobin env",
+		Long: `Gets, sets or lists the settings of the CLI in the gobin env (defaults to ~/.gobin).
+
+Settings are read from flags, GOBIN_ environment variables and the gobin env in this order, gobin config list shows
+where each value comes from.`,
+	}
+
+	parent.AddCommand(cmd)
+
+	newConfigListCmd(cmd)
+	newConfigGetCmd(cmd)
+	newConfigSetCmd(cmd)
+	newConfigUnsetCmd(cmd)
+}
+
+func newConfigListCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lists the settings and where they come from",
+		Example: `gobin config list
+
+Will print every setting with its value and whether it comes from a flag, the environment, the gobin env or the defaults.`,
+		Args:              cobra.NoArgs,
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			showSecrets, _ := cmd.Flags().GetBool("show-secrets")
+			entries, err := cfg.Get()
+			if err != nil {
+				return fmt.Errorf("failed to get config: %w", err)
+			}
+
+			var names []string
+			for _, key := range configKeys {
+				if !key.Prefix {
+					names = append(names, key.Name)
+				}
+			}
+			var fileNames []string
+			for name := range entries {
+				if !slices.Contains(names, strings.ToUpper(name)) {
+					fileNames = append(fileNames, strings.ToUpper(name))
+				}
+			}
+			slices.Sort(fileNames)
+			names = append(names, fileNames...)
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			_, _ = fmt.Fprintln(w, "NAME\tVALUE\tSOURCE")
+			for _, name := range names {
+				value, source := configValue(cmd, name, entries)
+				if key, ok := findConfigKey(name); ok && key.Secret && value != "" && !showSecrets {
+					value = "***"
+				}
+				_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", name, value, source)
+			}
+			return w.Flush()
+		},
+	}
+
+	parent.AddCommand(cmd)
+
+	cmd.Flags().Bool("show-secrets", false, "Print tokens and keys instead of hiding them")
+}
+
+func newConfigGetCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "get",
+		Short: "Prints the value of a setting",
+		Example: `gobin config get server
+
+Will print the gobin server the CLI uses.
+
+gobin config get server --source
+
+Will also print whether the server comes from a flag, the environment, the gobin env or the defaults.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: configKeyCompletion,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			showSource, _ := cmd.Flags().GetBool("source")
+			entries, err := cfg.Get()
+			if err != nil {
+				return fmt.Errorf("failed to get config: %w", err)
+			}
+
+			// the value is printed to stdout for scripts like $(gobin config get server)
+			value, source := configValue(cmd, strings.ToUpper(args[0]), entries)
+			_, _ = fmt.Fprintln(cmd.OutOrStdout(), value)
+			if showSource {
+				cmd.Println("Source:", source)
+			}
+			return nil
+		},
+	}
+
+	parent.AddCommand(cmd)
+
+	cmd.Flags().Bool("source", false, "Also print where the value comes from")
+}
+
+func newConfigSetCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "set",
+		Short: "Sets a setting in the gobin env",
+		Example: `gobin config set server https://xgob.in
+
+Will let the CLI use the gobin server at https://xgob.in.`,
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: configKeyCompletion,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name, value := strings.ToUpper(args[0]), args[1]
+			force, _ := cmd.Flags().GetBool("force")
+
+			key, ok := findConfigKey(name)
+			if !ok && !force {
+				return fmt.Errorf("unknown config key %s, use --force to set it anyway", name)
+			}
+			if ok && key.Validate != nil && !force {
+				if err := key.Validate(value); err != nil {
+					return fmt.Errorf("invalid value for %s: %w", name, err)
+				}
+			}
+
+			path, err := cfg.Update(func(m map[string]string) {
+				deleteConfigEntry(m, name)
+				m[name] = value
+			})
+			if err != nil {
+				return fmt.Errorf("failed to update config: %w", err)
+			}
+			cmd.Printf("Saved %s to: %s\n", name, path)
+			if _, ok = os.LookupEnv("GOBIN_" + name); ok {
+				cmd.Printf("GOBIN_%s is set in the environment and takes precedence\n", name)
+			}
+			return nil
+		},
+	}
+
+	parent.AddCommand(cmd)
+
+	cmd.Flags().Bool("force", false, "Set unknown settings and skip the validation of the value")
+}
+
+func newConfigUnsetCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "unset",
+		Short: "Removes settings from the gobin env",
+		Example: `gobin config unset style formatter
+
+Will let gobin get use the default style and formatter again.`,
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: configKeyCompletion,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var removed []string
+			path, err := cfg.Update(func(m map[string]string) {
+				for _, arg := range args {
+					if deleteConfigEntry(m, strings.ToUpper(arg)) {
+						removed = append(removed, strings.ToUpper(arg))
+					}
+				}
+			})
+			if err != nil {
+				return fmt.Errorf("failed to update config: %w", err)
+			}
+			if len(removed) == 0 {
+				return fmt.Errorf("none of the settings are set in: %s", path)
+			}
+			cmd.Printf("Removed %s from: %s\n", strings.Join(removed, ", "), path)
+			return nil
+		},
+	}
+
+	parent.AddCommand(cmd)
+}
+
+// configValue returns the value of the setting and where it comes from, viper prefers flags over the environment over
+// the gobin env over the defaults.
+func configValue(cmd *cobra.Command, name string, entries map[string]string) (string, string) {
+	viperKey := strings.ToLower(name)
+	if flag := cmd.Flag(viperKey); flag != nil && flag.Changed {
+		return flag.Value.String(), "flag --" + viperKey
+	}
+	if value, ok := os.LookupEnv("GOBIN_" + name); ok {
+		return value, "env GOBIN_" + name
+	}
+	for entryName, value := range entries {
+		if strings.EqualFold(entryName, name) {
+			return value, "file " + cfg.Path()
+		}
+	}
+	if value := viper.GetString(viperKey); value != "" {
+		return value, "default"
+	}
+	return "", "unset"
+}
+
+// deleteConfigEntry deletes the entry regardless of its case and reports whether it existed.
+func deleteConfigEntry(m map[string]string, name string) bool {
+	deleted := false
+	for entryName := range m {
+		if strings.EqualFold(entryName, name) {
+			delete(m, entryName)
+			deleted = true
+		}
+	}
+	return deleted
+}
+
+func findConfigKey(name string) (configKey, bool) {
+	for _, key := range configKeys {
+		if key.Name == name || key.Prefix && strings.HasPrefix(name, key.Name) && len(name) > len(key.Name) {
+			return key, true
+		}
+	}
+	return configKey{}, false
+}
+
+func configKeyCompletion(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for _, key := range configKeys {
+		if key.Prefix {
+			continue
+		}
+		names = append(names, strings.ToLower(key.Name)+"\t"+key.Description)
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+func validateConfigURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return errors.New("must be an http or https url like https://xgob.in")
+	}
+	return nil
+}
+
+func validateConfigFormatter(value string) error {
+	if !slices.Contains(formatterNames, value) {
+		return fmt.Errorf("must be one of %s", strings.Join(formatterNames, ", "))
+	}
+	return nil
+}
+
+func validateConfigStyle(value string) error {
+	if _, ok := styles.Registry[value]; !ok {
+		return errors.New("unknown style, see https://xyproto.github.io/splash/docs/ for the available styles")
+	}
+	return nil
+}
+
+func validateConfigBool(value string) error {
+	if _, err := strconv.ParseBool(value); err != nil {
+		return errors.New("must be true or false")
+	}
+	return nil
+}
+
+func validateConfigEncryptionKey(value string) error {
+	_, err := client.ParseEncryptionKey(value)
+	return err
+}
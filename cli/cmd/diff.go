@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/topi314/chroma/v2/formatters"
+	"github.com/topi314/chroma/v2/styles"
+
+	"github.com/topi314/gobin/v3/internal/render"
+)
+
+func NewDiffCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:     "diff",
+		GroupID: "actions",
+		Short:   "Shows the changes between two versions of a document",
+		Example: `gobin diff jis74978
+
+Will show the changes of the latest version of jis74978.
+
+gobin diff jis74978 1712345678901 1712345698765
+
+Will show the changes between the two versions, see gobin versions for the versions of a document.`,
+		Args:              cobra.RangeArgs(1, 3),
+		ValidArgsFunction: documentCompletion,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := viper.BindPFlag("server", cmd.Flags().Lookup("server")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("formatter", cmd.Flags().Lookup("formatter")); err != nil {
+				return err
+			}
+			return viper.BindPFlag("style", cmd.Flags().Lookup("style"))
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			documentID := args[0]
+			formatter := viper.GetString("formatter")
+			style := viper.GetString("style")
+
+			var versions [2]int64
+			for i, version := range args[1:] {
+				var err error
+				if versions[i], err = strconv.ParseInt(version, 10, 64); err != nil {
+					return fmt.Errorf("invalid document version: %s", version)
+				}
+			}
+			// a single version is shown with the changes it made
+			from, to := versions[0], versions[1]
+			if len(args) == 2 {
+				from, to = 0, versions[0]
+			}
+
+			diffRs, err := newClient().GetDocumentDiff(cmd.Context(), documentID, from, to)
+			if err != nil {
+				return fmt.Errorf("failed to get document diff: %w", err)
+			}
+			if len(diffRs.Files) == 0 {
+				cmd.Println("No changes")
+				return nil
+			}
+
+			for _, file := range diffRs.Files {
+				content := file.Diff
+				if formatter != "" && formatter != "none" {
+					if content, err = render.Highlight(formatters.Get(formatter), styles.Get(style), "diff", file.Diff, 0); err != nil {
+						return fmt.Errorf("failed to highlight diff of %s: %w", file.NewName, err)
+					}
+				}
+				cmd.Print(content)
+			}
+			return nil
+		},
+	}
+
+	parent.AddCommand(cmd)
+
+	cmd.Flags().StringP("server", "s", "", "Gobin server address")
+	cmd.Flags().StringP("formatter", "r", "terminal16m", "Format the diff with syntax highlighting (terminal8, terminal16, terminal256, terminal16m or none)")
+	cmd.Flags().StringP("style", "", "", "The style to render the diff with")
+
+	if err := cmd.RegisterFlagCompletionFunc("formatter", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"terminal8", "terminal16", "terminal256", "terminal16m", "none"}, cobra.ShellCompDirectiveNoFileComp
+	}); err != nil {
+		log.Printf("failed to register formatter flag completion func: %s", err)
+	}
+}
@@ -3,20 +3,29 @@ package cmd
 import (
 	"fmt"
 	"log"
-	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/topi314/chroma/v2/formatters"
 	"github.com/topi314/chroma/v2/lexers"
+	"github.com/topi314/chroma/v2/styles"
 
-	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/client"
+	"github.com/topi314/gobin/v3/internal/render"
 	"github.com/topi314/gobin/v3/server"
 )
 
+// formatterNames are the formatters documents can be highlighted with.
+var formatterNames = []string{"terminal8", "terminal16", "terminal256", "terminal16m", "html", "html-standalone", "svg", "none"}
+
 func NewGetCmd(parent *cobra.Command) {
 	cmd := &cobra.Command{
 		Use:     "get",
@@ -24,7 +33,23 @@ func NewGetCmd(parent *cobra.Command) {
 		Short:   "Gets a document from the gobin server",
 		Example: `gobin get jis74978
 
-Will return the document with the id of jis74978.`,
+Will return the document with the id of jis74978.
+
+gobin get jis74978 -o ./out/ -v 1700000000000
+
+Will save every file of version 1700000000000 of the document to the out folder.
+
+gobin get jis74978 -f build.log --tail 100 --follow
+
+Will print the last 100 lines of build.log and then the lines appended to it until you stop it.
+
+gobin get jis74978 --archive tar.gz
+
+Will save all files of the document as jis74978.tar.gz to the output folder, the current folder by default.
+
+gobin get jis74978 -k "https://xgob.in/jis74978#key=..."
+
+Will return the decrypted files of the end-to-end encrypted document.`,
 		Args:              cobra.ExactArgs(1),
 		ValidArgsFunction: documentCompletion,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
@@ -49,7 +74,19 @@ Will return the document with the id of jis74978.`,
 			if err := viper.BindPFlag("style", cmd.Flags().Lookup("style")); err != nil {
 				return err
 			}
-			return viper.BindPFlag("output", cmd.Flags().Lookup("output"))
+			if err := viper.BindPFlag("output", cmd.Flags().Lookup("output")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("tail", cmd.Flags().Lookup("tail")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("follow", cmd.Flags().Lookup("follow")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("archive", cmd.Flags().Lookup("archive")); err != nil {
+				return err
+			}
+			return viper.BindPFlag("key", cmd.Flags().Lookup("key"))
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) == 0 {
@@ -63,20 +100,25 @@ Will return the document with the id of jis74978.`,
 			language := viper.GetString("language")
 			style := viper.GetString("style")
 			output := viper.GetString("output")
+			encodedKey := viper.GetString("key")
+			tail := viper.GetInt("tail")
+			follow := viper.GetBool("follow")
+			archive := viper.GetString("archive")
 
+			var versionNumber int64
+			if version != "" {
+				var err error
+				if versionNumber, err = strconv.ParseInt(version, 10, 64); err != nil {
+					return fmt.Errorf("invalid document version: %s", version)
+				}
+			}
+
+			c := newClient()
 			if versions {
-				rs, err := ezhttp.Get("/documents/" + documentID + "/versions")
+				documentVersionsRs, err := c.GetDocumentVersions(cmd.Context(), documentID, false, nil)
 				if err != nil {
 					return fmt.Errorf("failed to get document versions: %w", err)
 				}
-				defer func() {
-					_ = rs.Body.Close()
-				}()
-
-				var documentVersionsRs []server.DocumentResponse
-				if err = ezhttp.ProcessBody("get document versions", rs, &documentVersionsRs); err != nil {
-					return err
-				}
 
 				var documentVersions string
 				for _, documentVersion := range documentVersionsRs {
@@ -87,40 +129,67 @@ Will return the document with the id of jis74978.`,
 				return nil
 			}
 
-			uri := "/documents/" + documentID
-			if version != "" {
-				uri += "/versions/" + version
-			}
-			query := make(url.Values)
-			if formatter != "" {
-				query.Add("formatter", formatter)
-			}
-			if style != "" {
-				query.Add("style", style)
-			}
-			if file != "" {
-				query.Add("file", file)
-				if style != "" {
-					query.Add("language", language)
+			if cmd.Flags().Changed("tail") || follow {
+				if tail < 0 {
+					return fmt.Errorf("invalid number of lines: %d", tail)
 				}
-			}
-			if len(query) > 0 {
-				uri += "?" + query.Encode()
+				if file == "" {
+					documentRs, err := c.GetDocument(cmd.Context(), documentID, 0, nil)
+					if err != nil {
+						return fmt.Errorf("failed to get document: %w", err)
+					}
+					file = documentRs.Files[0].Name
+				}
+
+				if err := c.TailDocumentFile(cmd.Context(), documentID, file, tail, follow, cmd.OutOrStdout()); err != nil {
+					return fmt.Errorf("failed to tail document file: %w", err)
+				}
+				return nil
 			}
 
-			rs, err := ezhttp.Get(uri)
-			if err != nil {
-				return fmt.Errorf("failed to get document: %w", err)
+			if archive != "" {
+				if archive != server.ArchiveFormatZip && archive != server.ArchiveFormatTarGz {
+					return fmt.Errorf("invalid archive format: %s", archive)
+				}
+				if output == "" {
+					output = "."
+				}
+				filePath := filepath.Join(output, documentID+"."+archive)
+				archiveFile, err := os.Create(filePath)
+				if err != nil {
+					return fmt.Errorf("failed to create file to write archive: %w", err)
+				}
+				defer func() {
+					_ = archiveFile.Close()
+				}()
+
+				if err = c.DownloadDocumentArchive(cmd.Context(), documentID, versionNumber, archive, archiveFile); err != nil {
+					_ = os.Remove(filePath)
+					return fmt.Errorf("failed to download document archive: %w", err)
+				}
+				cmd.Println("Document archive saved to:", filePath)
+				return nil
 			}
-			defer func() {
-				_ = rs.Body.Close()
-			}()
 
+			// saved files are not highlighted unless a formatter is set explicitly
+			if output != "" && !cmd.Flags().Changed("formatter") {
+				formatter = ""
+			}
+			opts := &client.RenderOptions{
+				Formatter: formatter,
+				Style:     style,
+			}
 			if file != "" {
-				var fileRs server.ResponseFile
-				if err = ezhttp.ProcessBody("get document file", rs, &fileRs); err != nil {
+				opts.Language = language
+				fileRs, err := c.GetDocumentFile(cmd.Context(), documentID, versionNumber, file, opts)
+				if err != nil {
+					return fmt.Errorf("failed to get document file: %w", err)
+				}
+				decryptedFiles := []api.ResponseFile{*fileRs}
+				if err = decryptFiles(documentID, encodedKey, decryptedFiles, formatter, style); err != nil {
 					return err
 				}
+				fileRs = &decryptedFiles[0]
 				content := fileRs.Content
 				if formatter != "" {
 					content = fileRs.Formatted
@@ -131,24 +200,19 @@ Will return the document with the id of jis74978.`,
 					return nil
 				}
 
-				filePath := filepath.Join(output, fileRs.Name)
-				documentFile, err := os.Create(filePath)
+				filePath, err := saveDocumentFile(output, fileRs.Name, content)
 				if err != nil {
-					return fmt.Errorf("failed to create file to write document: %w", err)
-				}
-				defer func() {
-					_ = documentFile.Close()
-				}()
-
-				if _, err = documentFile.WriteString(content); err != nil {
-					return fmt.Errorf("failed to write document to file: %w", err)
+					return err
 				}
 				cmd.Println("Document file saved to:", filePath)
 				return nil
 			}
 
-			var documentRs server.DocumentResponse
-			if err = ezhttp.ProcessBody("get document", rs, &documentRs); err != nil {
+			documentRs, err := c.GetDocument(cmd.Context(), documentID, versionNumber, opts)
+			if err != nil {
+				return fmt.Errorf("failed to get document: %w", err)
+			}
+			if err = decryptFiles(documentID, encodedKey, documentRs.Files, formatter, style); err != nil {
 				return err
 			}
 
@@ -159,32 +223,19 @@ Will return the document with the id of jis74978.`,
 				}
 
 				if output == "" {
-					if len(documentRs.Files) > 0 {
-						cmd.Printf("File: %s", dFile.Name)
+					// keep the boundaries of the files visible when printing multiple files
+					if len(documentRs.Files) > 1 {
+						cmd.Printf("File: %s\n", dFile.Name)
 					}
 					cmd.Println(content)
-					return nil
+					continue
 				}
 
-				if err = func() error {
-					filePath := filepath.Join(output, dFile.Name)
-					documentFile, err := os.Create(filePath)
-					if err != nil {
-						return fmt.Errorf("failed to create file to write document: %w", err)
-					}
-					defer func() {
-						_ = documentFile.Close()
-					}()
-
-					_, err = documentFile.WriteString(content)
-					if err != nil {
-						return fmt.Errorf("failed to write document to file: %w", err)
-					}
-					cmd.Println("Document file saved to:", filePath)
-					return nil
-				}(); err != nil {
+				filePath, err := saveDocumentFile(output, dFile.Name, content)
+				if err != nil {
 					return err
 				}
+				cmd.Println("Document file saved to:", filePath)
 			}
 
 			return nil
@@ -200,17 +251,84 @@ Will return the document with the id of jis74978.`,
 	cmd.Flags().StringP("formatter", "r", "terminal16m", "Format the document with syntax highlighting (terminal8, terminal16, terminal256, terminal16m, html, html-standalone, svg, or none)")
 	cmd.Flags().StringP("language", "l", "", "The language to render the document with (only works in combination with file)")
 	cmd.Flags().StringP("style", "", "", "The style to render the document with")
-	cmd.Flags().StringP("output", "o", ".", "The folder to save the document to")
+	cmd.Flags().StringP("output", "o", "", "The folder to save the files of the document to instead of printing them, created if it doesn't exist")
+	cmd.Flags().IntP("tail", "t", 10, "Print the last lines of the file instead of the whole document")
+	cmd.Flags().BoolP("follow", "F", false, "Keep printing the content appended to the file (implies --tail)")
+	cmd.Flags().StringP("archive", "a", "", "Save all files of the document as an archive (zip or tar.gz) to the output folder")
+	cmd.Flags().StringP("key", "k", "", "The key or URL with the key to decrypt an encrypted document with, defaults to the saved key of the document")
 
 	if err := cmd.RegisterFlagCompletionFunc("formatter", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return []string{"terminal8", "terminal16", "terminal256", "terminal16m", "html", "html-standalone", "svg", "none"}, cobra.ShellCompDirectiveNoFileComp
+		return formatterNames, cobra.ShellCompDirectiveNoFileComp
 	}); err != nil {
 		log.Printf("failed to register formatter flag completion func: %s", err)
 	}
 
+	if err := cmd.RegisterFlagCompletionFunc("archive", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{server.ArchiveFormatZip, server.ArchiveFormatTarGz}, cobra.ShellCompDirectiveNoFileComp
+	}); err != nil {
+		log.Printf("failed to register archive flag completion func: %s", err)
+	}
+
 	if err := cmd.RegisterFlagCompletionFunc("language", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		return lexers.Names(true), cobra.ShellCompDirectiveNoFileComp
 	}); err != nil {
 		log.Printf("failed to register language flag completion func: %s", err)
 	}
 }
+
+// saveDocumentFile writes the file to the output folder and returns its path. Folders in the file name are created,
+// the file name can't escape the output folder.
+func saveDocumentFile(output string, name string, content string) (string, error) {
+	name = path.Clean("/" + name)[1:]
+	if name == "" {
+		name = "untitled"
+	}
+	filePath := filepath.Join(output, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create folder to write document: %w", err)
+	}
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		return "", fmt.Errorf("failed to write document to file: %w", err)
+	}
+	return filePath, nil
+}
+
+// decryptFiles decrypts the encrypted files with the key or the saved key of the document. The server doesn't highlight
+// encrypted files, so they are highlighted here.
+func decryptFiles(documentID string, encodedKey string, files []api.ResponseFile, formatter string, style string) error {
+	if !slices.ContainsFunc(files, func(file api.ResponseFile) bool { return file.Encrypted }) {
+		return nil
+	}
+	if encodedKey == "" {
+		encodedKey = viper.GetString("keys_" + documentID)
+	}
+	if encodedKey == "" {
+		return fmt.Errorf("document %s is encrypted, provide the key with --key", documentID)
+	}
+	key, err := client.ParseEncryptionKey(encodedKey)
+	if err != nil {
+		return err
+	}
+
+	chromaFormatter := formatters.Get(formatter)
+	for i := range files {
+		if !files[i].Encrypted {
+			continue
+		}
+		if err = client.DecryptFile(key, &files[i]); err != nil {
+			return err
+		}
+		if formatter == "" {
+			continue
+		}
+		// the server detects the language of encrypted files without their content
+		language := files[i].Language
+		if language == "plaintext" {
+			language = render.Language("", "", files[i].Name, files[i].Content)
+		}
+		if files[i].Formatted, err = render.Highlight(chromaFormatter, styles.Get(style), language, files[i].Content, 0); err != nil {
+			return fmt.Errorf("failed to highlight file %s: %w", files[i].Name, err)
+		}
+	}
+	return nil
+}
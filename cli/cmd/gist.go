@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/topi314/gobin/v3/internal/cfg"
+	"github.com/topi314/gobin/v3/internal/gist"
+)
+
+func NewImportGistCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:     "import-gist",
+		GroupID: "actions",
+		Short:   "Imports a GitHub gist as a new document",
+		Example: `gobin import-gist https://gist.github.com/topi314/aa0b2b5d1ff4d5c6b3a6a3c5bc0d6a0e
+
+Will create a document with all files of the gist, keeping their names and languages`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: cobra.NoFileCompletions,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := viper.BindPFlag("server", cmd.Flags().Lookup("server")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("expires", cmd.Flags().Lookup("expires")); err != nil {
+				return err
+			}
+			return viper.BindPFlag("custom-key", cmd.Flags().Lookup("custom-key"))
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts, err := newDocumentOptions(viper.GetString("expires"))
+			if err != nil {
+				return err
+			}
+			opts.UserToken = viper.GetString("user_token")
+			opts.Key = viper.GetString("custom-key")
+
+			documentRs, err := newClient().ImportGist(cmd.Context(), args[0], opts)
+			if err != nil {
+				return fmt.Errorf("failed to import gist: %w", err)
+			}
+			cmd.Printf("Created document with ID: %s, Version: %d, URL: %s/%s\n", documentRs.Key, documentRs.Version, viper.GetString("server"), documentRs.Key)
+
+			path, err := cfg.Update(func(m map[string]string) {
+				m["TOKENS_"+documentRs.Key] = documentRs.Token
+			})
+			if err != nil {
+				return fmt.Errorf("failed to update config: %w", err)
+			}
+			cmd.Println("Saved token to:", path)
+			return nil
+		},
+	}
+
+	parent.AddCommand(cmd)
+
+	cmd.Flags().StringP("server", "s", "", "Gobin server address")
+	cmd.Flags().StringP("expires", "e", "", "When the document expires as duration like 24h or RFC 3339 timestamp")
+	cmd.Flags().StringP("custom-key", "", "", "The key of the new document instead of a random one, if the server allows custom keys")
+}
+
+func NewExportGistCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:     "export-gist",
+		GroupID: "actions",
+		Short:   "Exports a document to a new GitHub gist",
+		Example: `gobin env -w GITHUB_TOKEN=ghp_...
+gobin export-gist jis74978
+
+Will create a secret gist with all files of the document jis74978 using the saved GitHub token
+
+gobin export-gist jis74978 --public --description "build script"
+
+Will create a public gist with the description "build script"`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: documentCompletion,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := viper.BindPFlag("server", cmd.Flags().Lookup("server")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("version", cmd.Flags().Lookup("version")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("description", cmd.Flags().Lookup("description")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("public", cmd.Flags().Lookup("public")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("github_token", cmd.Flags().Lookup("github-token")); err != nil {
+				return err
+			}
+			return viper.BindPFlag("key", cmd.Flags().Lookup("key"))
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			documentID := args[0]
+			version := viper.GetString("version")
+			description := viper.GetString("description")
+			githubToken := viper.GetString("github_token")
+			if githubToken == "" {
+				return fmt.Errorf("no GitHub token found, provide one with --github-token or save it with gobin env -w GITHUB_TOKEN={token}")
+			}
+
+			var versionNumber int64
+			if version != "" {
+				var err error
+				if versionNumber, err = strconv.ParseInt(version, 10, 64); err != nil {
+					return fmt.Errorf("invalid document version: %s", version)
+				}
+			}
+
+			documentRs, err := newClient().GetDocument(cmd.Context(), documentID, versionNumber, nil)
+			if err != nil {
+				return fmt.Errorf("failed to get document: %w", err)
+			}
+			if err = decryptFiles(documentID, viper.GetString("key"), documentRs.Files, "", ""); err != nil {
+				return err
+			}
+
+			files := make(map[string]gist.CreateFile, len(documentRs.Files))
+			for _, file := range documentRs.Files {
+				files[file.Name] = gist.CreateFile{Content: file.Content}
+			}
+			if description == "" {
+				description = fmt.Sprintf("%s/%s", viper.GetString("server"), documentID)
+			}
+
+			gistClient := &gist.Client{
+				APIURL: viper.GetString("github_api_url"),
+				Token:  githubToken,
+				HTTPClient: &http.Client{
+					Timeout:   30 * time.Second,
+					Transport: httpTransport(),
+				},
+			}
+			g, err := gistClient.Create(cmd.Context(), gist.CreateRequest{
+				Description: description,
+				Public:      viper.GetBool("public"),
+				Files:       files,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create gist: %w", err)
+			}
+			cmd.Printf("Exported document with ID: %s, Version: %d to gist: %s\n", documentRs.Key, documentRs.Version, g.HTMLURL)
+			return nil
+		},
+	}
+
+	parent.AddCommand(cmd)
+
+	cmd.Flags().StringP("server", "s", "", "Gobin server address")
+	cmd.Flags().StringP("version", "v", "", "The version of the document to export")
+	cmd.Flags().StringP("description", "", "", "The description of the gist, defaults to the document URL")
+	cmd.Flags().BoolP("public", "", false, "Create a public gist instead of a secret one")
+	cmd.Flags().StringP("github-token", "", "", "The GitHub token with the gist scope, defaults to the saved GITHUB_TOKEN")
+	cmd.Flags().StringP("key", "k", "", "The key or URL with the key to decrypt an encrypted document with, defaults to the saved key of the document")
+}
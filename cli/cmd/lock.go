@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/topi314/gobin/v3/api"
+)
+
+func NewLockCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:     "lock",
+		GroupID: "actions",
+		Short:   "Locks a document, so only you can save new versions until the lock expires",
+		Example: `LOCK=$(gobin lock --ttl 10m --holder "deploy #42" jis74978)
+./deploy.sh 2>&1 | gobin push -d jis74978 --follow --lock $LOCK
+gobin unlock --lock $LOCK jis74978
+
+Will lock jis74978 for 10 minutes, append the output of deploy.sh to it and release the lock again. Other writers
+get an error while it's locked.
+
+gobin lock --renew $LOCK --ttl 10m jis74978
+
+Will renew the lock for another 10 minutes
+
+gobin lock --steal jis74978
+
+Will take over the lock of another holder which disappeared without releasing it`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: documentCompletion,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := viper.BindPFlag("server", cmd.Flags().Lookup("server")); err != nil {
+				return err
+			}
+			return viper.BindPFlag("token", cmd.Flags().Lookup("token"))
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			documentID := args[0]
+			token, err := documentToken(documentID)
+			if err != nil {
+				return err
+			}
+
+			ttl, _ := cmd.Flags().GetDuration("ttl")
+			holder, _ := cmd.Flags().GetString("holder")
+			steal, _ := cmd.Flags().GetBool("steal")
+			renew, _ := cmd.Flags().GetString("renew")
+
+			lockRq := api.LockRequest{
+				Holder: holder,
+				Steal:  steal,
+			}
+			if ttl > 0 {
+				lockRq.TTL = ttl.String()
+			}
+
+			rs, err := newClient().LockDocument(cmd.Context(), documentID, token, renew, lockRq)
+			if err != nil {
+				return fmt.Errorf("failed to lock document: %w", err)
+			}
+
+			// only the id goes to stdout, so scripts can keep it
+			_, _ = fmt.Fprintln(cmd.OutOrStdout(), rs.ID)
+			cmd.Printf("Locked document: %s until %s\n", documentID, rs.ExpiresAt.Format(time.RFC3339))
+			return nil
+		},
+	}
+
+	parent.AddCommand(cmd)
+
+	cmd.Flags().StringP("server", "s", "", "Gobin server address")
+	cmd.Flags().StringP("token", "t", "", "The token for the document to lock")
+	cmd.Flags().DurationP("ttl", "", 0, "How long the lock lasts unless it's renewed, defaults to 5m")
+	cmd.Flags().StringP("holder", "", "", "Who holds the lock, shown to other writers")
+	cmd.Flags().BoolP("steal", "", false, "Take over the lock of another holder")
+	cmd.Flags().StringP("renew", "", "", "The id of your lock to renew")
+}
+
+func NewUnlockCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:     "unlock",
+		GroupID: "actions",
+		Short:   "Releases the lock of a document",
+		Example: `gobin unlock --lock $LOCK jis74978
+
+Will release the lock of jis74978, so others can save new versions again`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: documentCompletion,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := viper.BindPFlag("server", cmd.Flags().Lookup("server")); err != nil {
+				return err
+			}
+			return viper.BindPFlag("token", cmd.Flags().Lookup("token"))
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			documentID := args[0]
+			lockID, _ := cmd.Flags().GetString("lock")
+			if lockID == "" {
+				return fmt.Errorf("--lock is required")
+			}
+			token, err := documentToken(documentID)
+			if err != nil {
+				return err
+			}
+
+			if err = newClient().UnlockDocument(cmd.Context(), documentID, token, lockID); err != nil {
+				return fmt.Errorf("failed to unlock document: %w", err)
+			}
+			cmd.Printf("Unlocked document: %s\n", documentID)
+			return nil
+		},
+	}
+
+	parent.AddCommand(cmd)
+
+	cmd.Flags().StringP("server", "s", "", "Gobin server address")
+	cmd.Flags().StringP("token", "t", "", "The token for the document to unlock")
+	cmd.Flags().StringP("lock", "", "", "The id of the lock to release")
+}
+
+// documentToken returns the token of the --token flag, the saved token of the document or the account token.
+func documentToken(documentID string) (string, error) {
+	token := viper.GetString("token")
+	if token == "" {
+		token = viper.GetString("tokens_" + documentID)
+	}
+	// account tokens grant access to all documents of the account
+	if token == "" {
+		token = viper.GetString("user_token")
+	}
+	if token == "" {
+		return "", fmt.Errorf("no token found or provided for document: %s", documentID)
+	}
+	return token, nil
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/cfg"
+)
+
+func NewLoginCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:     "login",
+		GroupID: "actions",
+		Short:   "Gets document tokens by approving this device in a browser",
+		Example: `gobin login -p write -p delete
+
+Will print a code and url to approve the login in a browser which has the document tokens. The approved documents can then be updated and deleted with this device.
+
+gobin login --account
+
+Will log in to the account of the browser which approves the login. Documents you push are added to the account and show up in the web UI, gobin ls --remote lists the documents of the account.`,
+		Args:              cobra.NoArgs,
+		ValidArgsFunction: cobra.NoFileCompletions,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := viper.BindPFlag("server", cmd.Flags().Lookup("server")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("account", cmd.Flags().Lookup("account")); err != nil {
+				return err
+			}
+			return viper.BindPFlag("permissions", cmd.Flags().Lookup("permissions"))
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			permissions := viper.GetStringSlice("permissions")
+			for _, perm := range permissions {
+				if !slices.Contains(api.AllStringPermissions, perm) {
+					return fmt.Errorf("invalid permission: %s", perm)
+				}
+			}
+
+			c := newClient()
+			codeRs, err := c.RequestDeviceCode(cmd.Context(), permissions, viper.GetBool("account"))
+			if err != nil {
+				return fmt.Errorf("failed to request device code: %w", err)
+			}
+
+			cmd.Printf("Open %s and enter the code: %s\n", codeRs.VerificationURI, codeRs.UserCode)
+			cmd.Printf("Or open: %s\n", codeRs.VerificationURIComplete)
+
+			tokenRs, err := c.PollDeviceToken(cmd.Context(), *codeRs)
+			if err != nil {
+				return fmt.Errorf("failed to login: %w", err)
+			}
+
+			path, err := cfg.Update(func(m map[string]string) {
+				for _, token := range tokenRs.Tokens {
+					m["TOKENS_"+token.Key] = token.Token
+				}
+				// the account token replaces the user token, so pushed documents are added to the account
+				if tokenRs.AccountToken != "" {
+					m["USER_TOKEN"] = tokenRs.AccountToken
+				}
+			})
+			if err != nil {
+				return fmt.Errorf("failed to update config: %w", err)
+			}
+			if tokenRs.AccountToken != "" {
+				cmd.Println("Logged in to your account, documents you push are added to it")
+			}
+			for _, token := range tokenRs.Tokens {
+				cmd.Printf("Logged in to document: %s with permissions: %v\n", token.Key, token.Permissions)
+			}
+			cmd.Println("Saved tokens to:", path)
+			return nil
+		},
+	}
+
+	parent.AddCommand(cmd)
+
+	cmd.Flags().StringP("server", "s", "", "Gobin server address")
+	cmd.Flags().StringSliceP("permissions", "p", nil, "The permissions to request, defaults to write and delete")
+	cmd.Flags().BoolP("account", "a", false, "Also log in to your account, so pushed documents are added to it")
+
+	if err := cmd.RegisterFlagCompletionFunc("permissions", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return api.AllStringPermissions, cobra.ShellCompDirectiveNoFileComp
+	}); err != nil {
+		log.Printf("failed to register permissions flag completion func: %s", err)
+	}
+}
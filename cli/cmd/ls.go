@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/cfg"
+)
+
+const lsPageSize = 100
+
+func NewLsCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:     "ls",
+		GroupID: "actions",
+		Short:   "Lists your documents",
+		Example: `gobin ls
+
+Will list the documents you have a token for in the gobin env.
+
+gobin ls --remote
+
+Will list the documents you created with your user token or were invited to from newest to oldest.`,
+		Args: cobra.NoArgs,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := viper.BindPFlag("server", cmd.Flags().Lookup("server")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("remote", cmd.Flags().Lookup("remote")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("limit", cmd.Flags().Lookup("limit")); err != nil {
+				return err
+			}
+			return viper.BindPFlag("json", cmd.Flags().Lookup("json"))
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !viper.GetBool("remote") {
+				entries, err := cfg.Get()
+				if err != nil {
+					return fmt.Errorf("failed to get config: %w", err)
+				}
+
+				var documents []string
+				for name := range entries {
+					if documentID, ok := strings.CutPrefix(name, "TOKENS_"); ok {
+						documents = append(documents, documentID)
+					}
+				}
+				slices.Sort(documents)
+				for _, documentID := range documents {
+					_, _ = fmt.Fprintln(cmd.OutOrStdout(), documentID)
+				}
+				return nil
+			}
+
+			userToken := viper.GetString("user_token")
+			if userToken == "" {
+				return errors.New("no user token found, run gobin login --account or gobin settings to create one")
+			}
+			limit := viper.GetInt("limit")
+
+			c := newClient()
+			documents := make([]api.ListedDocument, 0)
+			var cursor string
+			for {
+				pageSize := lsPageSize
+				if limit > 0 {
+					pageSize = min(pageSize, limit-len(documents))
+				}
+				listRs, err := c.ListDocuments(cmd.Context(), userToken, cursor, pageSize)
+				if err != nil {
+					return fmt.Errorf("failed to list documents: %w", err)
+				}
+				documents = append(documents, listRs.Documents...)
+				if listRs.Next == "" || (limit > 0 && len(documents) >= limit) {
+					break
+				}
+				cursor = listRs.Next
+			}
+
+			if viper.GetBool("json") {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(documents)
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			_, _ = fmt.Fprintln(w, "KEY\tUPDATED\tFILES")
+			for _, document := range documents {
+				fileNames := make([]string, len(document.Files))
+				for i, file := range document.Files {
+					fileNames[i] = file.Name
+				}
+				_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", document.Key, document.UpdatedAt.Format(time.DateTime), strings.Join(fileNames, ", "))
+			}
+			return w.Flush()
+		},
+	}
+
+	parent.AddCommand(cmd)
+
+	cmd.Flags().StringP("server", "s", "", "Gobin server address")
+	cmd.Flags().BoolP("remote", "r", false, "List the documents of your user token from the server")
+	cmd.Flags().IntP("limit", "l", 0, "The max number of documents to list with --remote, 0 lists all")
+	cmd.Flags().BoolP("json", "", false, "Print the documents as JSON")
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/topi314/gobin/v3/api"
+)
+
+// defaultRedactReplacement replaces the matches of redaction rules without a replacement.
+const defaultRedactReplacement = "[redacted]"
+
+// bundleManifest is a .gobin.yaml file which describes the files gobin post --manifest collects into a document, so
+// projects can ship a command to collect a debug bundle which looks the same for all their users.
+type bundleManifest struct {
+	// Title is saved as the message of the version.
+	Title string `yaml:"title"`
+	// Expires is a duration like 24h or RFC 3339 timestamp.
+	Expires string               `yaml:"expires"`
+	Files   []bundleManifestFile `yaml:"files"`
+	Redact  []bundleRedactRule   `yaml:"redact"`
+	// Env and Sysinfo add the environment.txt file of gobin post --with-env and --with-sysinfo.
+	Env     bool `yaml:"env"`
+	Sysinfo bool `yaml:"sysinfo"`
+
+	// dir is the directory of the manifest, paths are relative to it.
+	dir string
+}
+
+type bundleManifestFile struct {
+	// Path is a file or glob pattern like logs/*.log relative to the manifest.
+	Path string `yaml:"path"`
+	// Name is the name of the file in the document, it defaults to the file name. Globs matching several files ignore
+	// it.
+	Name     string `yaml:"name"`
+	Language string `yaml:"language"`
+	// Optional files are skipped if they don't exist instead of failing.
+	Optional bool `yaml:"optional"`
+}
+
+type bundleRedactRule struct {
+	// Pattern is a regular expression, Replace can use its groups like $1.
+	Pattern string `yaml:"pattern"`
+	Replace string `yaml:"replace"`
+
+	regex *regexp.Regexp
+}
+
+// loadBundleManifest reads and validates the manifest.
+func loadBundleManifest(path string) (*bundleManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var manifest bundleManifest
+	if err = yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	manifest.dir = filepath.Dir(path)
+
+	if len(manifest.Files) == 0 && !manifest.Env && !manifest.Sysinfo {
+		return nil, errors.New("manifest contains no files")
+	}
+	for i, file := range manifest.Files {
+		if file.Path == "" {
+			return nil, fmt.Errorf("file %d of the manifest has no path", i)
+		}
+	}
+	for i, rule := range manifest.Redact {
+		if rule.regex, err = regexp.Compile(rule.Pattern); err != nil {
+			return nil, fmt.Errorf("invalid pattern of redaction rule %d: %w", i, err)
+		}
+		if rule.Replace == "" {
+			rule.Replace = defaultRedactReplacement
+		}
+		manifest.Redact[i] = rule
+	}
+	return &manifest, nil
+}
+
+// documentFiles reads the files of the manifest and applies the redaction rules to them.
+func (m *bundleManifest) documentFiles() ([]api.RequestFile, error) {
+	var documentFiles []api.RequestFile
+	for _, file := range m.Files {
+		paths, err := filepath.Glob(filepath.Join(m.dir, file.Path))
+		if err != nil {
+			return nil, fmt.Errorf("invalid path %s: %w", file.Path, err)
+		}
+		if len(paths) == 0 {
+			if file.Optional {
+				continue
+			}
+			return nil, fmt.Errorf("no file found for path: %s", file.Path)
+		}
+		slices.Sort(paths)
+
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read file: %w", err)
+			}
+			name := file.Name
+			if name == "" || len(paths) > 1 {
+				name = filepath.Base(path)
+			}
+			documentFiles = append(documentFiles, api.RequestFile{
+				Name:     name,
+				Language: file.Language,
+				Content:  m.redact(string(data)),
+			})
+		}
+	}
+	return documentFiles, nil
+}
+
+func (m *bundleManifest) redact(content string) string {
+	for _, rule := range m.Redact {
+		content = rule.regex.ReplaceAllString(content, rule.Replace)
+	}
+	return content
+}
@@ -2,33 +2,69 @@ package cmd
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"mime"
-	"mime/multipart"
-	"net/http"
-	"net/textproto"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/topi314/chroma/v2/lexers"
 
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/client"
 	"github.com/topi314/gobin/v3/internal/cfg"
-	"github.com/topi314/gobin/v3/internal/ezhttp"
-	"github.com/topi314/gobin/v3/server"
 )
 
+// followInterval is how often gobin post --follow appends the content read from stdin.
+const followInterval = time.Second
+
 func NewPostCmd(parent *cobra.Command) {
 	cmd := &cobra.Command{
 		Use:     "post",
+		Aliases: []string{"push"},
 		GroupID: "actions",
 		Short:   "Posts a document to the gobin server",
 		Example: `gobin post "hello world!"
 		
-Will post "hello world!" to the server`,
+Will post "hello world!" to the server
+
+gobin post --expires 24h "hello world!"
+
+Will post "hello world!" to the server which deletes it after 24 hours
+
+gobin post --encrypt "hello world!"
+
+Will encrypt "hello world!" before posting it, the key is only part of the printed URL
+
+gobin push --custom-key my-snippet "hello world!"
+
+Will post "hello world!" as the document my-snippet if the server allows custom keys
+
+./build.sh 2>&1 | gobin push --follow
+
+Will post the output of build.sh and keep appending new output to the document until build.sh exits
+
+./build.sh 2>&1 | gobin push --with-env --with-sysinfo
+
+Will post the output of build.sh with an environment.txt file containing the OS, arch, versions of common tools and
+environment variables which are safe to share
+
+gobin push --manifest .gobin.yaml
+
+Will post the files listed in .gobin.yaml with their languages, title and expiry after applying its redaction rules
+
+gobin push -d jis74978 --if-match 1712345678901 -f notes.md
+
+Will only update jis74978 if its latest version is still 1712345678901, so nobody else's changes are overwritten
+
+./build.sh 2>&1 | gobin push -d jis74978 --follow --lock $(gobin lock jis74978)
+
+Will lock jis74978 while appending the output of build.sh to it, see gobin lock`,
 		Args:              cobra.ArbitraryArgs,
 		ValidArgsFunction: cobra.NoFileCompletions,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
@@ -44,118 +80,218 @@ Will post "hello world!" to the server`,
 			if err := viper.BindPFlag("token", cmd.Flags().Lookup("token")); err != nil {
 				return err
 			}
-			return viper.BindPFlag("languages", cmd.Flags().Lookup("languages"))
+			if err := viper.BindPFlag("languages", cmd.Flags().Lookup("languages")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("from-url", cmd.Flags().Lookup("from-url")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("expires", cmd.Flags().Lookup("expires")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("default-style", cmd.Flags().Lookup("default-style")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("encrypt", cmd.Flags().Lookup("encrypt")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("custom-key", cmd.Flags().Lookup("custom-key")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("message", cmd.Flags().Lookup("message")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("follow", cmd.Flags().Lookup("follow")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("public", cmd.Flags().Lookup("public")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("with-env", cmd.Flags().Lookup("with-env")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("with-sysinfo", cmd.Flags().Lookup("with-sysinfo")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("manifest", cmd.Flags().Lookup("manifest")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("if-match", cmd.Flags().Lookup("if-match")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("lock", cmd.Flags().Lookup("lock")); err != nil {
+				return err
+			}
+			return viper.BindPFlag("key", cmd.Flags().Lookup("key"))
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			files := viper.GetStringSlice("files")
 			documentID := viper.GetString("document")
 			token := viper.GetString("token")
 			languages := viper.GetStringSlice("languages")
+			fromURL := viper.GetString("from-url")
+			expires := viper.GetString("expires")
+			defaultStyle := viper.GetString("default-style")
+			encrypt := viper.GetBool("encrypt")
+			encodedKey := viper.GetString("key")
+			follow := viper.GetBool("follow")
+			withEnv := viper.GetBool("with-env")
+			withSysinfo := viper.GetBool("with-sysinfo")
+			manifestPath := viper.GetString("manifest")
 
-			var (
-				readers []io.Reader
-			)
-			if len(files) > 0 {
-				for _, file := range files {
-					fr, err := os.Open(strings.TrimSpace(file))
-					if err != nil {
-						return fmt.Errorf("failed to open document file: %w", err)
-					}
-					readers = append(readers, fr)
+			var manifest *bundleManifest
+			if manifestPath != "" {
+				if follow || fromURL != "" || len(files) > 0 || len(args) > 0 {
+					return fmt.Errorf("--manifest can't be used with --follow, --from-url, --files or arguments")
 				}
-			} else {
-				info, err := os.Stdin.Stat()
-				if err != nil {
-					return fmt.Errorf("failed to get stdin info: %w", err)
+				var err error
+				if manifest, err = loadBundleManifest(manifestPath); err != nil {
+					return err
 				}
-
-				if info.Mode()&os.ModeNamedPipe != 0 {
-					readers = append(readers, os.Stdin)
+				if expires == "" {
+					expires = manifest.Expires
 				}
+				withEnv = withEnv || manifest.Env
+				withSysinfo = withSysinfo || manifest.Sysinfo
+			}
+
+			opts, err := newDocumentOptions(expires)
+			if err != nil {
+				return err
+			}
+			opts.DefaultStyle = defaultStyle
+			opts.UserToken = viper.GetString("user_token")
+			opts.Key = viper.GetString("custom-key")
+			opts.Message = viper.GetString("message")
+			if opts.Message == "" && manifest != nil {
+				opts.Message = manifest.Title
+			}
+			opts.Public = viper.GetBool("public")
+			if opts.Key != "" && documentID != "" {
+				return fmt.Errorf("custom keys can only be used when creating a document")
+			}
+			if opts.Public && documentID != "" {
+				return fmt.Errorf("--public can only be used when creating a document")
+			}
+			opts.IfMatch = viper.GetInt64("if-match")
+			if opts.IfMatch != 0 && (documentID == "" || follow) {
+				return fmt.Errorf("--if-match can only be used when updating a document without --follow")
+			}
+			opts.Lock = viper.GetString("lock")
+			if opts.Lock != "" && documentID == "" {
+				return fmt.Errorf("--lock can only be used when updating a document")
+			}
+
+			var (
+				documentFiles []api.RequestFile
+				stdin         <-chan []byte
+				// stream is stdin when it's streamed to the server instead of reading it into memory first
+				stream   *streamRecorder
+				language string
+			)
+			if len(languages) > 0 {
+				language = languages[0]
+			}
+			if (withEnv || withSysinfo) && (follow || fromURL != "") {
+				return fmt.Errorf("--with-env and --with-sysinfo can't be used with --follow or --from-url")
 			}
-			defer func() {
-				for _, r := range readers {
-					if rc, ok := r.(io.Closer); ok {
-						_ = rc.Close()
+			if follow {
+				if fromURL != "" || encrypt || len(files) > 0 || len(args) > 0 {
+					return fmt.Errorf("--follow only works with content piped to stdin")
+				}
+				stdin = readStdin()
+				// updated documents only get the content appended
+				if documentID == "" {
+					data, ok := <-stdin
+					if !ok {
+						return fmt.Errorf("no document provided")
 					}
+					documentFiles = []api.RequestFile{{
+						Name:    os.Stdin.Name(),
+						Content: string(data),
+					}}
+					documentFiles[0].Language = language
 				}
-			}()
-
-			if len(readers) == 0 {
-				if len(args) == 0 {
-					return fmt.Errorf("no document provided")
+			} else if manifest != nil {
+				if documentFiles, err = manifest.documentFiles(); err != nil {
+					return err
 				}
-				if len(args) == 1 {
-					readers = append(readers, bytes.NewReader([]byte(args[0])))
-				} else {
-					for _, arg := range args {
-						readers = append(readers, bytes.NewReader([]byte(arg)))
+				if withEnv || withSysinfo {
+					environmentFile := newEnvironmentFile(cmd.Context(), withEnv, withSysinfo)
+					environmentFile.Content = manifest.redact(environmentFile.Content)
+					documentFiles = append(documentFiles, environmentFile)
+				}
+			} else if fromURL == "" && !encrypt && !withEnv && !withSysinfo && len(files) == 0 && stdinPiped() {
+				stream = newStreamRecorder(os.Stdin)
+				opts.WithoutContent = true
+			} else if fromURL == "" {
+				// the environment file can be posted on its own
+				if !withEnv && !withSysinfo || len(files) > 0 || len(args) > 0 || stdinPiped() {
+					if documentFiles, err = newDocumentFiles(files, args, languages); err != nil {
+						return err
 					}
 				}
+				if withEnv || withSysinfo {
+					documentFiles = append(documentFiles, newEnvironmentFile(cmd.Context(), withEnv, withSysinfo))
+				}
 			}
 
-			var r io.Reader
-			if len(readers) == 0 {
-				contentType := ezhttp.DefaultContentTyp
-				if len(languages) > 0 {
-					contentType = languages[0]
+			var key []byte
+			if encrypt {
+				if fromURL != "" {
+					return fmt.Errorf("documents fetched from an url can't be encrypted")
 				}
-				fileName := "untitiled"
-				if file, ok := r.(*os.File); ok {
-					fileName = file.Name()
+				if encodedKey == "" && documentID != "" {
+					encodedKey = viper.GetString("keys_" + documentID)
 				}
-				r = ezhttp.NewHeaderReader(readers[0], http.Header{
-					ezhttp.HeaderContentType: []string{
-						mime.FormatMediaType(contentType, map[string]string{
-							"filename": fileName,
-						}),
-					},
-				})
-
-			} else {
-				buff := new(bytes.Buffer)
-				mpw := multipart.NewWriter(buff)
-
-				for i, rr := range readers {
-					contentType := ezhttp.DefaultContentTyp
-					if len(languages) > i {
-						contentType = languages[i]
-					}
-					fileName := fmt.Sprintf("untitiled%d", i)
-					if file, ok := rr.(*os.File); ok {
-						fileName = file.Name()
-					}
-					part, err := mpw.CreatePart(textproto.MIMEHeader{
-						ezhttp.HeaderContentDisposition: []string{
-							mime.FormatMediaType("form-data", map[string]string{
-								"name":     fmt.Sprintf("file-%d", i),
-								"filename": fileName,
-							}),
-						},
-						ezhttp.HeaderContentType: []string{contentType},
-					})
-					if err != nil {
-						return fmt.Errorf("failed to create multipart part")
-					}
-					if _, err = io.Copy(part, rr); err != nil {
-						return fmt.Errorf("failed to write multipart part")
-					}
+				if encodedKey != "" {
+					key, err = client.ParseEncryptionKey(encodedKey)
+				} else {
+					key, err = client.NewEncryptionKey()
 				}
-
-				if err := mpw.Close(); err != nil {
-					return fmt.Errorf("failed to close multipart writer")
+				if err != nil {
+					return err
+				}
+				if err = client.EncryptFiles(key, documentFiles); err != nil {
+					return err
 				}
-				r = ezhttp.NewHeaderReader(buff, http.Header{
-					ezhttp.HeaderContentType: []string{mpw.FormDataContentType()},
-				})
 			}
 
+			c := newClient()
 			var (
-				rs  *http.Response
-				err error
+				documentRs *api.DocumentResponse
+				// partsRs are the other parts if the content was too large for a single document
+				partsRs []*api.DocumentResponse
 			)
 			if documentID == "" {
-				rs, err = ezhttp.Post("/documents", r)
+				if fromURL != "" {
+					documentRs, err = c.CreateDocumentFromURL(cmd.Context(), fromURL, opts)
+				} else if stream != nil {
+					documentRs, err = c.CreateDocumentStream(cmd.Context(), os.Stdin.Name(), language, stream, opts)
+				} else {
+					documentRs, err = c.CreateDocument(cmd.Context(), documentFiles, opts)
+				}
+				// single files which are too large are split into parts, encrypted files can only be decrypted as a whole
+				if maxSize := splitLimit(err); maxSize > 0 && fromURL == "" && key == nil && !follow && (stream != nil || len(documentFiles) == 1) {
+					var file api.RequestFile
+					ok := true
+					if stream != nil {
+						file = api.RequestFile{Name: os.Stdin.Name(), Language: language}
+						if file.Content, ok, err = stream.readAll(); err != nil {
+							return err
+						}
+					} else {
+						file = documentFiles[0]
+					}
+					if ok {
+						cmd.Printf("Content is larger than the server allows, splitting it into parts of at most %d bytes\n", maxSize)
+						opts.WithoutContent = true
+						var documentsRs []*api.DocumentResponse
+						if documentsRs, err = createSplitDocument(cmd.Context(), c, file, maxSize, opts); err == nil {
+							documentRs, partsRs = documentsRs[0], documentsRs[1:]
+						}
+					}
+				}
 				if err != nil {
 					return fmt.Errorf("failed to create document: %w", err)
 				}
@@ -163,28 +299,60 @@ Will post "hello world!" to the server`,
 				if token == "" {
 					token = viper.GetString("tokens_" + documentID)
 				}
+				// account tokens grant access to all documents of the account
+				if token == "" {
+					token = viper.GetString("user_token")
+				}
 				if token == "" {
 					return fmt.Errorf("no token found or provided for document: %s", documentID)
 				}
-				rs, err = ezhttp.Patch("/documents/"+documentID, token, r)
+				if follow {
+					cmd.Println("Appending to document with ID:", documentID)
+					return appendStdin(cmd.Context(), c, documentID, token, stdin, &client.AppendOptions{
+						Message: opts.Message,
+						Rotate:  api.AppendRotateVersion,
+						Lock:    opts.Lock,
+					})
+				}
+				if fromURL != "" {
+					documentRs, err = c.UpdateDocumentFromURL(cmd.Context(), documentID, token, fromURL, opts)
+				} else if stream != nil {
+					documentRs, err = c.UpdateDocumentStream(cmd.Context(), documentID, token, os.Stdin.Name(), language, stream, opts)
+				} else {
+					documentRs, err = c.UpdateDocument(cmd.Context(), documentID, token, documentFiles, opts)
+				}
+				var revisionErr *client.RevisionPendingError
+				if errors.As(err, &revisionErr) {
+					cmd.Printf("Submitted changes to document: %s for review as revision: %d\n", documentID, revisionErr.Revision.Revision)
+					return nil
+				}
+				var clientErr *client.Error
+				if errors.As(err, &clientErr) && clientErr.Conflict != nil {
+					return fmt.Errorf("document %s was changed since version %d, the latest version is %d and your changes weren't saved, see what changed with: gobin diff %s %d %d",
+						documentID, clientErr.Conflict.Version, clientErr.Conflict.CurrentVersion, documentID, clientErr.Conflict.Version, clientErr.Conflict.CurrentVersion)
+				}
 				if err != nil {
 					return fmt.Errorf("failed to update document: %w", err)
 				}
-			}
-			defer func() {
-				_ = rs.Body.Close()
-			}()
-
-			var documentRs server.DocumentResponse
-			if err = ezhttp.ProcessBody("post document", rs, &documentRs); err != nil {
-				return fmt.Errorf("failed to process response: %w", err)
+				if defaultStyle != "" {
+					if err = c.SetDocumentStyle(cmd.Context(), documentID, token, defaultStyle); err != nil {
+						return fmt.Errorf("failed to set document style: %w", err)
+					}
+				}
 			}
 
 			method := "Updated"
 			if documentID == "" {
 				method = "Created"
 			}
-			cmd.Printf("%s document with ID: %s, Version: %d, URL: %s/%s\n", method, documentRs.Key, documentRs.Version, viper.GetString("server"), documentRs.Key)
+			documentURL := fmt.Sprintf("%s/%s", viper.GetString("server"), documentRs.Key)
+			if key != nil {
+				documentURL += "#key=" + client.EncodeEncryptionKey(key)
+			}
+			cmd.Printf("%s document with ID: %s, Version: %d, URL: %s\n", method, documentRs.Key, documentRs.Version, documentURL)
+			if len(partsRs) > 0 {
+				cmd.Printf("Split the content into %d parts, the URL shows the navigation between them\n", len(partsRs)+1)
+			}
 
 			if documentID != "" {
 				return nil
@@ -192,11 +360,24 @@ Will post "hello world!" to the server`,
 
 			path, err := cfg.Update(func(m map[string]string) {
 				m["TOKENS_"+documentRs.Key] = documentRs.Token
+				for _, partRs := range partsRs {
+					m["TOKENS_"+partRs.Key] = partRs.Token
+				}
+				if key != nil {
+					m["KEYS_"+documentRs.Key] = client.EncodeEncryptionKey(key)
+				}
 			})
 			if err != nil {
 				return fmt.Errorf("failed to update config: %w", err)
 			}
 			cmd.Println("Saved token to:", path)
+
+			if follow {
+				return appendStdin(cmd.Context(), c, documentRs.Key, documentRs.Token, stdin, &client.AppendOptions{
+					File:   documentRs.Files[0].Name,
+					Rotate: api.AppendRotateVersion,
+				})
+			}
 			return nil
 		},
 	}
@@ -208,6 +389,20 @@ Will post "hello world!" to the server`,
 	cmd.Flags().StringP("document", "d", "", "The document to update")
 	cmd.Flags().StringP("token", "t", "", "The token for the document to update")
 	cmd.Flags().StringP("languages", "l", "", "The language of the documents")
+	cmd.Flags().StringP("from-url", "u", "", "Let the server fetch the document content from this url")
+	cmd.Flags().StringP("expires", "e", "", "When the document expires as duration like 24h or RFC 3339 timestamp")
+	cmd.Flags().StringP("default-style", "", "", "The style suggested to viewers of the document who didn't pick a style")
+	cmd.Flags().BoolP("encrypt", "", false, "Encrypt the files before posting them, the key is added to the URL and never sent to the server")
+	cmd.Flags().StringP("key", "k", "", "The key to encrypt the files of the document to update with, defaults to the saved key of the document")
+	cmd.Flags().StringP("custom-key", "", "", "The key of the new document instead of a random one, if the server allows custom keys")
+	cmd.Flags().StringP("message", "m", "", "Describe the changes of the new version like a commit message")
+	cmd.Flags().BoolP("follow", "F", false, "Keep appending the content piped to stdin to the document until stdin is closed")
+	cmd.Flags().BoolP("public", "", false, "Announce the new document to the fediverse followers of the server, if the server has ActivityPub enabled")
+	cmd.Flags().BoolP("with-env", "", false, "Add the environment variables which are safe to share like SHELL, LANG and PATH as environment.txt")
+	cmd.Flags().BoolP("with-sysinfo", "", false, "Add the OS, arch and versions of common tools like go, git and node as environment.txt")
+	cmd.Flags().StringP("manifest", "", "", "Post the files of a .gobin.yaml manifest with its languages, title, expiry and redaction rules")
+	cmd.Flags().Int64P("if-match", "", 0, "Only update the document if its latest version is still this version")
+	cmd.Flags().StringP("lock", "", "", "The id of the lock of the document to update, see gobin lock")
 
 	if err := cmd.RegisterFlagCompletionFunc("files", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		return nil, cobra.ShellCompDirectiveDefault
@@ -215,6 +410,12 @@ Will post "hello world!" to the server`,
 		log.Printf("failed to register files flag completion func: %s", err)
 	}
 
+	if err := cmd.RegisterFlagCompletionFunc("manifest", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"yaml", "yml"}, cobra.ShellCompDirectiveFilterFileExt
+	}); err != nil {
+		log.Printf("failed to register manifest flag completion func: %s", err)
+	}
+
 	if err := cmd.RegisterFlagCompletionFunc("document", documentCompletion); err != nil {
 		log.Printf("failed to register document flag completion func: %s", err)
 	}
@@ -225,3 +426,123 @@ Will post "hello world!" to the server`,
 		log.Printf("failed to register languages flag completion func: %s", err)
 	}
 }
+
+// readStdin reads stdin in the background, the channel is closed once stdin is closed.
+func readStdin() <-chan []byte {
+	chunks := make(chan []byte)
+	go func() {
+		defer close(chunks)
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if n > 0 {
+				chunks <- bytes.Clone(buf[:n])
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return chunks
+}
+
+// appendStdin appends the content read from stdin to the document until stdin is closed. The content is collected for
+// the follow interval, so not every line creates a new version. Full files start over in a new version.
+func appendStdin(ctx context.Context, c *client.Client, documentID string, token string, stdin <-chan []byte, opts *client.AppendOptions) error {
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+
+	var pending []byte
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		if _, err := c.AppendDocument(ctx, documentID, token, pending, opts); err != nil {
+			return fmt.Errorf("failed to append to document: %w", err)
+		}
+		pending = pending[:0]
+		return nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case data, ok := <-stdin:
+			if !ok {
+				return flush()
+			}
+			pending = append(pending, data...)
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// newDocumentOptions returns the options to set the expiration of the document from a duration or RFC 3339 timestamp.
+func newDocumentOptions(expires string) (*client.DocumentOptions, error) {
+	if expires == "" {
+		return &client.DocumentOptions{}, nil
+	}
+	if ttl, err := time.ParseDuration(expires); err == nil {
+		return &client.DocumentOptions{TTL: ttl}, nil
+	}
+	expiresAt, err := time.Parse(time.RFC3339, expires)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expires: %s, must be a duration like 24h or RFC 3339 timestamp", expires)
+	}
+	return &client.DocumentOptions{ExpiresAt: &expiresAt}, nil
+}
+
+// stdinPiped returns whether content is piped to stdin.
+func stdinPiped() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeNamedPipe != 0
+}
+
+func newDocumentFiles(files []string, args []string, languages []string) ([]api.RequestFile, error) {
+	var documentFiles []api.RequestFile
+	if len(files) > 0 {
+		for _, file := range files {
+			fileName := strings.TrimSpace(file)
+			data, err := os.ReadFile(fileName)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read document file: %w", err)
+			}
+			documentFiles = append(documentFiles, api.RequestFile{
+				Name:    fileName,
+				Content: string(data),
+			})
+		}
+	} else if stdinPiped() {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stdin: %w", err)
+		}
+		documentFiles = append(documentFiles, api.RequestFile{
+			Name:    os.Stdin.Name(),
+			Content: string(data),
+		})
+	}
+
+	if len(documentFiles) == 0 {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("no document provided")
+		}
+		for i, arg := range args {
+			documentFiles = append(documentFiles, api.RequestFile{
+				Name:    fmt.Sprintf("untitled%d", i),
+				Content: arg,
+			})
+		}
+	}
+
+	for i := range documentFiles {
+		if len(languages) > i {
+			documentFiles[i].Language = languages[i]
+		}
+	}
+	return documentFiles, nil
+}
@@ -2,13 +2,12 @@ package cmd
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
 	"github.com/topi314/gobin/v3/internal/cfg"
-	"github.com/topi314/gobin/v3/internal/ezhttp"
-	"github.com/topi314/gobin/v3/server"
 )
 
 func NewRmCmd(parent *cobra.Command) {
@@ -38,29 +37,28 @@ Will delete the jis74978 from the server.`,
 			version := viper.GetString("version")
 			token := viper.GetString("token")
 
-			path := "/documents/" + documentID
+			var versionNumber int64
 			if version != "" {
-				path += "/versions/" + version
+				var err error
+				if versionNumber, err = strconv.ParseInt(version, 10, 64); err != nil {
+					return fmt.Errorf("invalid document version: %s", version)
+				}
 			}
 
 			if token == "" {
 				token = viper.GetString("tokens_" + documentID)
 			}
+			// account tokens grant access to all documents of the account
+			if token == "" {
+				token = viper.GetString("user_token")
+			}
 			if token == "" {
 				return fmt.Errorf("no token found or provided for document: %s", documentID)
 			}
 
-			rs, err := ezhttp.Delete(path, token)
+			deleteRs, err := newClient().DeleteDocumentVersion(cmd.Context(), documentID, versionNumber, token)
 			if err != nil {
-				return fmt.Errorf("failed to create document: %w", err)
-			}
-			defer func() {
-				_ = rs.Body.Close()
-			}()
-
-			var deleteRs server.DeleteResponse
-			if err = ezhttp.ProcessBody("delete document", rs, &deleteRs); err != nil {
-				return fmt.Errorf("failed to process response: %w", err)
+				return fmt.Errorf("failed to delete document: %w", err)
 			}
 
 			if version != "" {
@@ -73,7 +71,7 @@ Will delete the jis74978 from the server.`,
 				return nil
 			}
 
-			path, err = cfg.Update(func(m map[string]string) {
+			path, err := cfg.Update(func(m map[string]string) {
 				delete(m, "TOKENS_"+documentID)
 			})
 			if err != nil {
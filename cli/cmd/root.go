@@ -1,15 +1,23 @@
 package cmd
 
 import (
+	"log/slog"
+	"net/http"
 	"os"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/topi314/gobin/v3/client"
 	"github.com/topi314/gobin/v3/internal/cfg"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/ver"
 )
 
+// transport logs the requests of the CLI with --verbose or --debug and records them with --har, it is nil otherwise.
+var transport *ezhttp.Transport
+
 func NewRootCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:          "gobin",
@@ -25,8 +33,14 @@ func NewRootCmd() *cobra.Command {
 	var cfgFile string
 	cmd.PersistentFlags().StringVar(&cfgFile, "config", os.Getenv("GOBIN_CONFIG"), "config file (default is $HOME/.gobin)")
 	cmd.PersistentFlags().BoolP("help", "h", false, "help for gobin")
+	cmd.PersistentFlags().Bool("verbose", false, "Log the requests to the gobin server")
+	cmd.PersistentFlags().Bool("debug", false, "Log the requests to the gobin server with their headers and bodies, tokens are redacted")
+	cmd.PersistentFlags().String("har", "", "Write the requests of a failed command to this HAR file for bug reports, tokens are redacted")
+	for _, flag := range []string{"verbose", "debug", "har"} {
+		cobra.CheckErr(viper.BindPFlag(flag, cmd.PersistentFlags().Lookup(flag)))
+	}
 	cmd.CompletionOptions.DisableDescriptions = true
-	cobra.OnInitialize(initConfig(cfgFile))
+	cobra.OnInitialize(initConfig(cfgFile), initLogging)
 
 	return cmd
 }
@@ -34,6 +48,13 @@ func NewRootCmd() *cobra.Command {
 func Execute(command *cobra.Command) {
 	err := command.Execute()
 	if err != nil {
+		if harPath := viper.GetString("har"); harPath != "" && transport != nil && transport.HAR.Len() > 0 {
+			if err = transport.HAR.WriteFile(harPath); err != nil {
+				command.PrintErrln("Error:", err)
+			} else {
+				command.PrintErrln("Saved the requests of the failed command to:", harPath)
+			}
+		}
 		os.Exit(1)
 	}
 }
@@ -59,6 +80,39 @@ func initConfig(cfgFile string) func() {
 	}
 }
 
+// initLogging logs warnings to stderr, --verbose also logs every request and --debug their headers and bodies.
+func initLogging() {
+	level := slog.LevelWarn
+	if viper.GetBool("verbose") {
+		level = slog.LevelInfo
+	}
+	if viper.GetBool("debug") {
+		level = slog.LevelDebug
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: level,
+	})))
+
+	harPath := viper.GetString("har")
+	if level == slog.LevelWarn && harPath == "" {
+		return
+	}
+	transport = &ezhttp.Transport{
+		Dump: level == slog.LevelDebug,
+	}
+	if harPath != "" {
+		transport.HAR = ezhttp.NewHAR("gobin", ver.Load().Version)
+	}
+}
+
+// httpTransport returns the transport for HTTP clients of the CLI, nil uses the default transport.
+func httpTransport() http.RoundTripper {
+	if transport == nil {
+		return nil
+	}
+	return transport
+}
+
 func documentCompletion(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
 	entries, err := cfg.Get()
 	if err != nil {
@@ -74,3 +128,9 @@ func documentCompletion(cmd *cobra.Command, _ []string, _ string) ([]string, cob
 	}
 	return documents, cobra.ShellCompDirectiveNoFileComp
 }
+
+func newClient() *client.Client {
+	c := client.New(viper.GetString("server"))
+	c.HTTPClient.Transport = httpTransport()
+	return c
+}
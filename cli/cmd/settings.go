@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/client"
+	"github.com/topi314/gobin/v3/internal/cfg"
+)
+
+func NewSettingsCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:     "settings",
+		GroupID: "actions",
+		Short:   "Prints or changes your settings on the gobin server",
+		Example: `gobin settings
+
+Will print your settings.
+
+gobin settings --default-expiry 24h --default-language go
+
+Will let your new documents expire after 24 hours and use go for files whose language can't be detected.`,
+		Args:              cobra.NoArgs,
+		ValidArgsFunction: cobra.NoFileCompletions,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := viper.BindPFlag("server", cmd.Flags().Lookup("server")); err != nil {
+				return err
+			}
+			return viper.BindPFlag("reset", cmd.Flags().Lookup("reset"))
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c := newClient()
+			userToken, err := getUserToken(cmd, c)
+			if err != nil {
+				return err
+			}
+
+			if viper.GetBool("reset") {
+				if err = c.DeleteUserSettings(cmd.Context(), userToken); err != nil {
+					return fmt.Errorf("failed to reset settings: %w", err)
+				}
+				cmd.Println("Settings reset to the defaults")
+				return nil
+			}
+
+			settings, err := c.GetUserSettings(cmd.Context(), userToken)
+			if err != nil {
+				return fmt.Errorf("failed to get settings: %w", err)
+			}
+
+			flags := cmd.Flags()
+			if flags.Changed("default-style") || flags.Changed("default-expiry") || flags.Changed("editor-keymap") || flags.Changed("default-language") {
+				settingsRq := api.UserSettingsRequest{
+					DefaultStyle:    settings.DefaultStyle,
+					DefaultExpiry:   settings.DefaultExpiry,
+					EditorKeymap:    settings.EditorKeymap,
+					DefaultLanguage: settings.DefaultLanguage,
+				}
+				if flags.Changed("default-style") {
+					settingsRq.DefaultStyle, _ = flags.GetString("default-style")
+				}
+				if flags.Changed("default-expiry") {
+					settingsRq.DefaultExpiry, _ = flags.GetString("default-expiry")
+				}
+				if flags.Changed("editor-keymap") {
+					settingsRq.EditorKeymap, _ = flags.GetString("editor-keymap")
+				}
+				if flags.Changed("default-language") {
+					settingsRq.DefaultLanguage, _ = flags.GetString("default-language")
+				}
+
+				if settings, err = c.SetUserSettings(cmd.Context(), userToken, settingsRq); err != nil {
+					return fmt.Errorf("failed to update settings: %w", err)
+				}
+			}
+
+			cmd.Printf("Default style: %s\n", valueOrDefault(settings.DefaultStyle, "auto"))
+			cmd.Printf("Default expiry: %s\n", valueOrDefault(settings.DefaultExpiry, "never"))
+			cmd.Printf("Editor keymap: %s\n", settings.EditorKeymap)
+			cmd.Printf("Default language: %s\n", valueOrDefault(settings.DefaultLanguage, "auto"))
+			return nil
+		},
+	}
+
+	parent.AddCommand(cmd)
+
+	cmd.Flags().StringP("server", "s", "", "Gobin server address")
+	cmd.Flags().String("default-style", "", "The style of documents you view, empty for the style of the document or your color scheme")
+	cmd.Flags().String("default-expiry", "", "When your new documents expire like 24h, empty to never expire")
+	cmd.Flags().String("editor-keymap", "", "The keymap of the editor in the browser (default, emacs or browser)")
+	cmd.Flags().String("default-language", "", "The language of files whose language can't be detected, empty for plaintext")
+	cmd.Flags().Bool("reset", false, "Reset your settings to the defaults")
+}
+
+// getUserToken returns the saved user token or creates a new user and saves its token, so documents posted with the
+// CLI use the settings.
+func getUserToken(cmd *cobra.Command, c *client.Client) (string, error) {
+	if userToken := viper.GetString("user_token"); userToken != "" {
+		return userToken, nil
+	}
+
+	userToken, err := c.CreateUserToken(cmd.Context())
+	if err != nil {
+		return "", fmt.Errorf("failed to create user: %w", err)
+	}
+	path, err := cfg.Update(func(m map[string]string) {
+		m["USER_TOKEN"] = userToken
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to update config: %w", err)
+	}
+	cmd.Println("Saved user token to:", path)
+	return userToken, nil
+}
+
+func valueOrDefault(value string, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
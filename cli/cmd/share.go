@@ -1,17 +1,17 @@
 package cmd
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
 	"log"
 	"slices"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
-	"github.com/topi314/gobin/v3/internal/ezhttp"
-	"github.com/topi314/gobin/v3/server"
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/client"
 )
 
 func NewShareCmd(parent *cobra.Command) {
@@ -21,7 +21,16 @@ func NewShareCmd(parent *cobra.Command) {
 		Short:   "Shares a document",
 		Example: `gobin share -p write -p delete -p share jis74978
 
-Will create a new share the document jis74978 with the permissions write, delete and share`,
+Will create a new share the document jis74978 with the permissions write, delete and share
+
+gobin share -p write --expires-in 1h --max-uses 1 jis74978
+
+Will create a new share of the document jis74978 with the permission write, which stops working after one hour or after
+it was used once
+
+gobin share --revoke eyJhbGciOiJIUzI1NiIs... jis74978
+
+Will revoke the share token of the document jis74978, so it can't be used anymore. The id of the share token works too.`,
 		Args:              cobra.ExactArgs(1),
 		ValidArgsFunction: documentCompletion,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
@@ -38,8 +47,9 @@ Will create a new share the document jis74978 with the permissions write, delete
 			gobinServer := viper.GetString("server")
 			token := viper.GetString("token")
 			permissions := viper.GetStringSlice("permissions")
+			revoke, _ := cmd.Flags().GetString("revoke")
 
-			if len(permissions) == 0 {
+			if len(permissions) == 0 && revoke == "" {
 				cmd.Printf("Link: %s/%s\n", gobinServer, documentID)
 				return nil
 			}
@@ -47,38 +57,58 @@ Will create a new share the document jis74978 with the permissions write, delete
 			if token == "" {
 				token = viper.GetString("tokens_" + documentID)
 			}
+			// account tokens grant access to all documents of the account
+			if token == "" {
+				token = viper.GetString("user_token")
+			}
 			if token == "" {
 				return fmt.Errorf("no token found or provided for document: %s", documentID)
 			}
 
+			if revoke != "" {
+				tokenID := revoke
+				// tokens are JWTs with three parts, ids of share tokens have none
+				if strings.Count(revoke, ".") == 2 {
+					tokenID = client.TokenID(revoke)
+				}
+				if err := newClient().RevokeToken(cmd.Context(), documentID, token, tokenID); err != nil {
+					return fmt.Errorf("failed to revoke token: %w", err)
+				}
+				cmd.Printf("Revoked token: %s\n", tokenID)
+				return nil
+			}
+
 			perms := make([]string, len(permissions))
 			for i, perm := range permissions {
-				if !slices.Contains(server.AllStringPermissions, perm) {
+				if !slices.Contains(api.AllStringPermissions, perm) {
 					return fmt.Errorf("invalid permission: %s", perm)
 				}
 				perms[i] = perm
 			}
 
-			shareRq := server.ShareRequest{
+			expiresIn, _ := cmd.Flags().GetDuration("expires-in")
+			maxUses, _ := cmd.Flags().GetInt64("max-uses")
+			shareRq := api.ShareRequest{
 				Permissions: perms,
+				MaxUses:     maxUses,
 			}
-
-			buff := new(bytes.Buffer)
-			if err := json.NewEncoder(buff).Encode(shareRq); err != nil {
-				return fmt.Errorf("failed to encode share request: %w", err)
+			if expiresIn > 0 {
+				shareRq.ExpiresIn = expiresIn.String()
 			}
 
-			rs, err := ezhttp.PostToken("/documents/"+documentID+"/share", token, buff)
+			rs, err := newClient().CreateShareToken(cmd.Context(), documentID, token, shareRq)
 			if err != nil {
 				return fmt.Errorf("failed to create share token: %w", err)
 			}
 
-			var shareRs server.ShareResponse
-			if err = ezhttp.ProcessBody("create share token", rs, &shareRs); err != nil {
-				return err
+			cmd.Printf("Link: %s/%s?token=%s\n", gobinServer, documentID, rs.Token)
+			cmd.Printf("ID: %s\n", rs.ID)
+			if rs.ExpiresAt != nil {
+				cmd.Printf("Expires at: %s\n", rs.ExpiresAt.Format(time.RFC3339))
+			}
+			if rs.MaxUses > 0 {
+				cmd.Printf("Max uses: %d\n", rs.MaxUses)
 			}
-
-			cmd.Printf("Link: %s/%s?token=%s\n", gobinServer, documentID, shareRs.Token)
 			return nil
 		},
 	}
@@ -88,9 +118,12 @@ Will create a new share the document jis74978 with the permissions write, delete
 	cmd.Flags().StringP("server", "s", "", "Gobin server address")
 	cmd.Flags().StringP("token", "t", "", "The token for the document")
 	cmd.Flags().StringSliceP("permissions", "p", nil, "The permissions for the document")
+	cmd.Flags().Duration("expires-in", 0, "How long the share token works like 1h, 0 for tokens which don't expire")
+	cmd.Flags().Int64("max-uses", 0, "How many requests the share token can be used for, 0 for no limit")
+	cmd.Flags().String("revoke", "", "Revokes a token or the id of a share token of the document instead of sharing it")
 
 	if err := cmd.RegisterFlagCompletionFunc("permissions", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return server.AllStringPermissions, cobra.ShellCompDirectiveNoFileComp
+		return api.AllStringPermissions, cobra.ShellCompDirectiveNoFileComp
 	}); err != nil {
 		log.Printf("failed to register permissions flag completion func: %s", err)
 	}
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/client"
+)
+
+// maxRecordedStreamSize is how much of the streamed stdin gobin post keeps to split it into parts if the server rejects
+// it as too large, larger streams can't be split.
+const maxRecordedStreamSize = 64 << 20
+
+// streamRecorder records what is streamed from stdin, so content the server rejected as too large can be read again and
+// split into parts.
+type streamRecorder struct {
+	mu       sync.Mutex
+	r        io.Reader
+	buf      bytes.Buffer
+	overflow bool
+	stopped  bool
+}
+
+func newStreamRecorder(r io.Reader) *streamRecorder {
+	return &streamRecorder{r: r}
+}
+
+func (s *streamRecorder) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return 0, io.EOF
+	}
+	n, err := s.r.Read(p)
+	if !s.overflow {
+		if s.buf.Len()+n > maxRecordedStreamSize {
+			s.overflow = true
+			s.buf = bytes.Buffer{}
+		} else {
+			s.buf.Write(p[:n])
+		}
+	}
+	return n, err
+}
+
+// readAll stops the stream and returns everything streamed so far together with the rest of stdin. ok is false if the
+// stream was too large to be recorded.
+func (s *streamRecorder) readAll() (string, bool, error) {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	if s.overflow {
+		return "", false, nil
+	}
+
+	rest, err := io.ReadAll(s.r)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read stdin: %w", err)
+	}
+	return s.buf.String() + string(rest), true, nil
+}
+
+// splitLimit returns the max size of a part if the server rejected the document for exceeding the max document or file
+// size, or 0 for all other errors.
+func splitLimit(err error) int64 {
+	var clientErr *client.Error
+	if !errors.As(err, &clientErr) || clientErr.StatusCode != http.StatusRequestEntityTooLarge || clientErr.Limit == nil {
+		return 0
+	}
+	switch clientErr.Limit.Limit {
+	case api.LimitMaxDocumentSize, api.LimitMaxFileSize:
+		return clientErr.Limit.Max
+	}
+	return 0
+}
+
+// splitContent splits the content into parts of at most maxSize bytes. Parts end after a line break if there is one and
+// never in the middle of a character.
+func splitContent(content string, maxSize int) []string {
+	var parts []string
+	for len(content) > maxSize {
+		end := maxSize
+		if i := strings.LastIndexByte(content[:end], '\n'); i > 0 {
+			end = i + 1
+		} else {
+			for end > 0 && !utf8.RuneStart(content[end]) {
+				end--
+			}
+			if end == 0 {
+				end = maxSize
+			}
+		}
+		parts = append(parts, content[:end])
+		content = content[end:]
+	}
+	return append(parts, content)
+}
+
+// createSplitDocument splits the content of the file into parts of at most maxSize bytes and creates a document for
+// each part. The first document is the index of the others, the server shows the navigation between them.
+func createSplitDocument(ctx context.Context, c *client.Client, file api.RequestFile, maxSize int64, opts *client.DocumentOptions) ([]*api.DocumentResponse, error) {
+	contents := splitContent(file.Content, int(maxSize))
+
+	// parts get a random key and aren't announced on their own
+	partOpts := *opts
+	partOpts.Key = ""
+	partOpts.Public = false
+
+	documentsRs := make([]*api.DocumentResponse, 0, len(contents))
+	for i, content := range contents {
+		partFile := file
+		partFile.Content = content
+
+		var (
+			documentRs *api.DocumentResponse
+			err        error
+		)
+		if i == 0 {
+			documentRs, err = c.CreateDocument(ctx, []api.RequestFile{partFile}, opts)
+		} else {
+			documentRs, err = c.CreateDocumentPart(ctx, documentsRs[0].Key, documentsRs[0].Token, []api.RequestFile{partFile}, &partOpts)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create part %d of %d: %w", i+1, len(contents), err)
+		}
+		documentsRs = append(documentsRs, documentRs)
+	}
+	return documentsRs, nil
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/ver"
+)
+
+// environmentFileName is the name of the file gobin post --with-env and --with-sysinfo add to the document.
+const environmentFileName = "environment.txt"
+
+// toolVersionTimeout is how long gobin post --with-sysinfo waits for the version of a tool.
+const toolVersionTimeout = 2 * time.Second
+
+var (
+	// safeEnvVars are the environment variables gobin post --with-env adds, everything else can contain tokens or
+	// passwords and is left out.
+	safeEnvVars = []string{
+		"SHELL", "TERM", "TERM_PROGRAM", "TERM_PROGRAM_VERSION", "COLORTERM", "LANG", "TZ", "PATH", "CI",
+		"GOOS", "GOARCH", "GOFLAGS", "GO111MODULE", "GOTOOLCHAIN", "CGO_ENABLED",
+		"NODE_ENV", "VIRTUAL_ENV", "JAVA_HOME", "WSL_DISTRO_NAME", "XDG_SESSION_TYPE",
+	}
+	safeEnvVarPrefixes = []string{"LC_"}
+
+	// versionTools are the tools gobin post --with-sysinfo prints the version of, tools which aren't installed are left
+	// out.
+	versionTools = [][]string{
+		{"go", "version"},
+		{"git", "--version"},
+		{"node", "--version"},
+		{"npm", "--version"},
+		{"python3", "--version"},
+		{"java", "--version"},
+		{"rustc", "--version"},
+		{"cargo", "--version"},
+		{"dotnet", "--version"},
+		{"docker", "--version"},
+		{"kubectl", "version", "--client"},
+	}
+)
+
+// newEnvironmentFile returns a file with the system info and the safe environment variables of this machine. The home
+// directory is replaced with ~ in all values, so the username doesn't end up in the document.
+func newEnvironmentFile(ctx context.Context, withEnv bool, withSysinfo bool) api.RequestFile {
+	var sb strings.Builder
+	if withSysinfo {
+		sb.WriteString("# System\n")
+		writeSysinfo(ctx, &sb)
+	}
+	if withEnv {
+		if withSysinfo {
+			sb.WriteString("\n")
+		}
+		sb.WriteString("# Environment\n")
+		writeEnv(&sb)
+	}
+
+	return api.RequestFile{
+		Name:    environmentFileName,
+		Content: sanitizeEnvironment(sb.String()),
+	}
+}
+
+func writeSysinfo(ctx context.Context, sb *strings.Builder) {
+	writeEnvironmentLine(sb, "os", runtime.GOOS)
+	writeEnvironmentLine(sb, "arch", runtime.GOARCH)
+	if distro := osRelease(); distro != "" {
+		writeEnvironmentLine(sb, "distro", distro)
+	}
+	if kernel := commandVersion(ctx, "uname", "-sr"); kernel != "" {
+		writeEnvironmentLine(sb, "kernel", kernel)
+	}
+	writeEnvironmentLine(sb, "cpus", strconv.Itoa(runtime.NumCPU()))
+	writeEnvironmentLine(sb, "gobin", ver.Load().Version)
+
+	for _, tool := range versionTools {
+		if version := commandVersion(ctx, tool[0], tool[1:]...); version != "" {
+			writeEnvironmentLine(sb, tool[0], version)
+		}
+	}
+}
+
+func writeEnv(sb *strings.Builder) {
+	env := os.Environ()
+	slices.Sort(env)
+	for _, entry := range env {
+		name, value, _ := strings.Cut(entry, "=")
+		if !safeEnvVar(name) {
+			continue
+		}
+		writeEnvironmentLine(sb, name, value)
+	}
+}
+
+func writeEnvironmentLine(sb *strings.Builder, name string, value string) {
+	sb.WriteString(name)
+	sb.WriteString(": ")
+	sb.WriteString(value)
+	sb.WriteString("\n")
+}
+
+func safeEnvVar(name string) bool {
+	if slices.Contains(safeEnvVars, name) {
+		return true
+	}
+	for _, prefix := range safeEnvVarPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// commandVersion returns the first line the command prints or an empty string if it isn't installed or fails.
+func commandVersion(ctx context.Context, name string, args ...string) string {
+	if _, err := exec.LookPath(name); err != nil {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(ctx, toolVersionTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return ""
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	return strings.TrimSpace(line)
+}
+
+// osRelease returns the pretty name of the linux distribution from /etc/os-release.
+func osRelease() string {
+	f, err := os.Open("/etc/os-release")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "PRETTY_NAME="); ok {
+			return strings.Trim(value, `"`)
+		}
+	}
+	return ""
+}
+
+// sanitizeEnvironment replaces the home directory with ~.
+func sanitizeEnvironment(s string) string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" || home == "/" {
+		return s
+	}
+	return strings.ReplaceAll(s, home, "~")
+}
@@ -2,13 +2,10 @@ package cmd
 
 import (
 	"fmt"
-	"io"
-	"net/http"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
-	"github.com/topi314/gobin/v3/internal/ezhttp"
 	"github.com/topi314/gobin/v3/internal/ver"
 )
 
@@ -41,23 +38,11 @@ OS/Arch: windows/amd64`,
 			if gobinServer == "" {
 				return nil
 			}
-			rs, err := ezhttp.Get("/version")
+			serverVersion, err := newClient().GetVersion(cmd.Context())
 			if err != nil {
 				return fmt.Errorf("failed to get server version: %w", err)
 			}
-			defer func() {
-				_ = rs.Body.Close()
-			}()
-
-			if rs.StatusCode != http.StatusOK {
-				return fmt.Errorf("failed to get server version: %s", rs.Status)
-			}
-
-			data, err := io.ReadAll(rs.Body)
-			if err != nil {
-				return fmt.Errorf("failed to read server version: %w", err)
-			}
-			cmd.Printf("Server: %s\n%s\n", gobinServer, data)
+			cmd.Printf("Server: %s\n%s\n", gobinServer, serverVersion)
 			return nil
 		},
 	}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func NewVersionsCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:     "versions",
+		GroupID: "actions",
+		Short:   "Lists the versions of a document",
+		Example: `gobin versions jis74978
+
+Will list the versions of jis74978 from newest to oldest.
+
+gobin versions jis74978 --json
+
+Will print the versions of jis74978 as JSON.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: documentCompletion,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := viper.BindPFlag("server", cmd.Flags().Lookup("server")); err != nil {
+				return err
+			}
+			return viper.BindPFlag("json", cmd.Flags().Lookup("json"))
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			documentID := args[0]
+			asJSON := viper.GetBool("json")
+
+			versionsRs, err := newClient().GetDocumentVersions(cmd.Context(), documentID, false, nil)
+			if err != nil {
+				return fmt.Errorf("failed to get document versions: %w", err)
+			}
+
+			if asJSON {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(versionsRs)
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			_, _ = fmt.Fprintln(w, "VERSION\tTIME\tLABEL\tFILES\tMESSAGE")
+			for _, version := range versionsRs {
+				fileNames := make([]string, len(version.Files))
+				for i, file := range version.Files {
+					fileNames[i] = file.Name
+				}
+				_, _ = fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", version.Version, version.VersionTime, version.VersionLabel, strings.Join(fileNames, ", "), version.VersionMessage)
+			}
+			return w.Flush()
+		},
+	}
+
+	parent.AddCommand(cmd)
+
+	cmd.Flags().StringP("server", "s", "", "Gobin server address")
+	cmd.Flags().BoolP("json", "", false, "Print the versions as JSON")
+}
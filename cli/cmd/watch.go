@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/client"
+	"github.com/topi314/gobin/v3/server"
+)
+
+const maxWatchBackoff = 30 * time.Second
+
+func NewWatchCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:     "watch",
+		GroupID: "actions",
+		Short:   "Watches a document on the gobin server for new versions",
+		Example: `gobin watch jis74978
+
+Will print every new version of the document with the id of jis74978 until it is deleted.
+
+gobin watch jis74978 -o logs
+
+Will save the files of every new version to the logs folder.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: documentCompletion,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := viper.BindPFlag("server", cmd.Flags().Lookup("server")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("file", cmd.Flags().Lookup("file")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("formatter", cmd.Flags().Lookup("formatter")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("style", cmd.Flags().Lookup("style")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("output", cmd.Flags().Lookup("output")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("quiet", cmd.Flags().Lookup("quiet")); err != nil {
+				return err
+			}
+			return viper.BindPFlag("key", cmd.Flags().Lookup("key"))
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("document id is required")
+			}
+			w := &watcher{
+				cmd:        cmd,
+				client:     newClient(),
+				documentID: args[0],
+				file:       viper.GetString("file"),
+				formatter:  viper.GetString("formatter"),
+				style:      viper.GetString("style"),
+				output:     viper.GetString("output"),
+				quiet:      viper.GetBool("quiet"),
+				key:        viper.GetString("key"),
+			}
+			return w.watch(cmd.Context())
+		},
+	}
+
+	parent.AddCommand(cmd)
+
+	cmd.Flags().StringP("server", "s", "", "Gobin server address")
+	cmd.Flags().StringP("file", "f", "", "Only print or save this file of the new versions")
+	cmd.Flags().StringP("formatter", "r", "terminal16m", "Format the printed versions with syntax highlighting (terminal8, terminal16, terminal256, terminal16m, html, html-standalone, svg, or none)")
+	cmd.Flags().StringP("style", "", "", "The style to render the printed versions with")
+	cmd.Flags().StringP("output", "o", "", "Save the files of the new versions to this folder instead of printing them")
+	cmd.Flags().BoolP("quiet", "q", false, "Only print the new version numbers instead of their content")
+	cmd.Flags().StringP("key", "k", "", "The key or URL with the key to decrypt an encrypted document with, defaults to the saved key of the document")
+}
+
+type watcher struct {
+	cmd        *cobra.Command
+	client     *client.Client
+	documentID string
+	file       string
+	formatter  string
+	style      string
+	output     string
+	quiet      bool
+	key        string
+
+	lastVersion int64
+}
+
+// watch follows the live stream of the document. When the stream breaks it reconnects and shows the latest version if
+// it changed in the meantime.
+func (w *watcher) watch(ctx context.Context) error {
+	if _, err := w.latestVersion(ctx); err != nil {
+		return fmt.Errorf("failed to get document: %w", err)
+	}
+	w.cmd.Printf("Watching document: %s\n", w.documentID)
+
+	backoff := time.Second
+	for {
+		var handleErr error
+		err := w.client.WatchDocument(ctx, w.documentID, func(event api.LiveEvent) error {
+			backoff = time.Second
+			handleErr = w.handleEvent(ctx, event)
+			return handleErr
+		})
+		if handleErr != nil {
+			return handleErr
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		// the server ends the stream once the document is deleted
+		latest, latestErr := w.latestVersion(ctx)
+		var clientErr *client.Error
+		if errors.As(latestErr, &clientErr) && clientErr.StatusCode == http.StatusNotFound {
+			w.cmd.Printf("Document %s was deleted\n", w.documentID)
+			return nil
+		}
+		if latestErr == nil && latest > w.lastVersion {
+			if err = w.showVersion(ctx, latest); err != nil {
+				return err
+			}
+		}
+
+		if err == nil {
+			err = latestErr
+		}
+		if err != nil {
+			w.cmd.Printf("Lost connection: %s, reconnecting in %s\n", err, backoff)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxWatchBackoff)
+	}
+}
+
+func (w *watcher) latestVersion(ctx context.Context) (int64, error) {
+	versions, err := w.client.GetDocumentVersions(ctx, w.documentID, false, nil)
+	if err != nil {
+		return 0, err
+	}
+	if len(versions) == 0 {
+		return 0, nil
+	}
+	if w.lastVersion == 0 {
+		w.lastVersion = versions[0].Version
+	}
+	return versions[0].Version, nil
+}
+
+func (w *watcher) handleEvent(ctx context.Context, event api.LiveEvent) error {
+	switch event.Event {
+	case server.EventUpdate:
+		return w.showVersion(ctx, event.Version)
+	case server.EventDelete, server.EventExpire, server.EventPrune:
+		w.cmd.Printf("Version %d of document %s was removed\n", event.Version, w.documentID)
+	}
+	return nil
+}
+
+// showVersion prints the version or saves its files to the output folder.
+func (w *watcher) showVersion(ctx context.Context, version int64) error {
+	if version <= w.lastVersion {
+		return nil
+	}
+	w.lastVersion = version
+
+	w.cmd.Printf("New version: %d (%s)\n", version, humanize.Time(time.UnixMilli(version)))
+	if w.quiet {
+		return nil
+	}
+
+	opts := &client.RenderOptions{
+		Style: w.style,
+	}
+	if w.output == "" {
+		opts.Formatter = w.formatter
+	}
+	documentRs, err := w.client.GetDocument(ctx, w.documentID, version, opts)
+	if err != nil {
+		return fmt.Errorf("failed to get document: %w", err)
+	}
+	if err = decryptFiles(w.documentID, w.key, documentRs.Files, opts.Formatter, w.style); err != nil {
+		return err
+	}
+
+	for _, dFile := range documentRs.Files {
+		if w.file != "" && !strings.EqualFold(dFile.Name, w.file) {
+			continue
+		}
+
+		if w.output != "" {
+			filePath, err := saveDocumentFile(w.output, dFile.Name, dFile.Content)
+			if err != nil {
+				return err
+			}
+			w.cmd.Println("Document file saved to:", filePath)
+			continue
+		}
+
+		content := dFile.Content
+		if w.formatter != "" {
+			content = dFile.Formatted
+		}
+		w.cmd.Printf("File: %s\n", dFile.Name)
+		w.cmd.Println(content)
+	}
+	return nil
+}
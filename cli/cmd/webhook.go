@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/topi314/gobin/v3/webhook"
+)
+
+func NewWebhookCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:     "webhook",
+		GroupID: "actions",
+		Short:   "Helps building receivers of gobin webhooks",
+	}
+
+	parent.AddCommand(cmd)
+
+	newWebhookVerifyCmd(cmd)
+}
+
+func newWebhookVerifyCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verifies the signature, secret and schema version of a webhook delivery",
+		Example: `gobin webhook verify --secret mysecret < delivery.http
+
+Will verify the delivery in delivery.http, which has the headers, an empty line and the body like a raw HTTP request.
+
+gobin webhook verify --secret mysecret --headers headers.txt --body body.json
+
+Will verify the delivery with the headers of headers.txt and the body of body.json.
+
+gobin webhook verify --secret mysecret -H "Webhook-Id: ..." -H "Webhook-Timestamp: ..." -H "Webhook-Signature: ..." --tolerance 0 < body.json
+
+Will verify the body read from stdin with the given headers and without checking the age of the delivery.`,
+		Args:              cobra.NoArgs,
+		ValidArgsFunction: cobra.NoFileCompletions,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlag("webhook_secret", cmd.Flags().Lookup("secret"))
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			secret := viper.GetString("webhook_secret")
+			if secret == "" {
+				return errors.New("no webhook secret provided")
+			}
+			headersFile, _ := cmd.Flags().GetString("headers")
+			bodyFile, _ := cmd.Flags().GetString("body")
+			headerFlags, _ := cmd.Flags().GetStringArray("header")
+			tolerance, _ := cmd.Flags().GetDuration("tolerance")
+
+			header, body, err := readWebhookDelivery(cmd.InOrStdin(), headersFile, bodyFile, len(headerFlags) > 0)
+			if err != nil {
+				return err
+			}
+			for _, headerFlag := range headerFlags {
+				name, value, ok := strings.Cut(headerFlag, ":")
+				if !ok {
+					return fmt.Errorf("invalid header: %s", headerFlag)
+				}
+				header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+			}
+
+			// 0 disables the check, captured deliveries are usually older than the default tolerance
+			if tolerance == 0 {
+				tolerance = -1
+			}
+			verifier := webhook.Verifier{
+				Secret:    secret,
+				Tolerance: tolerance,
+			}
+
+			failed := false
+			for _, check := range verifier.Check(header, body) {
+				status := "ok"
+				if check.Skipped {
+					status = "skipped"
+				} else if check.Err != nil {
+					status = "failed"
+					failed = true
+				}
+				if check.Detail != "" {
+					cmd.Printf("%s: %s (%s)\n", check.Name, status, check.Detail)
+					continue
+				}
+				cmd.Printf("%s: %s\n", check.Name, status)
+			}
+			if failed {
+				return errors.New("webhook delivery failed to verify")
+			}
+			cmd.Println("Webhook delivery is valid")
+			return nil
+		},
+	}
+
+	parent.AddCommand(cmd)
+
+	cmd.Flags().String("secret", "", "The secret of the webhook")
+	cmd.Flags().String("headers", "", "File with the headers of the delivery, one per line")
+	cmd.Flags().String("body", "", "File with the body of the delivery")
+	cmd.Flags().StringArrayP("header", "H", nil, "Header of the delivery like \"Webhook-Id: ...\", can be used multiple times")
+	cmd.Flags().Duration("tolerance", webhook.DefaultTolerance, "How old the delivery may be, 0 to not check the age")
+}
+
+// readWebhookDelivery reads the headers and body of a delivery from the files or stdin. Without files stdin has the
+// headers, an empty line and the body, an optional request line like "POST /webhook HTTP/1.1" is skipped. If the headers
+// are only given as flags, stdin is the body.
+func readWebhookDelivery(stdin io.Reader, headersFile string, bodyFile string, headerFlags bool) (http.Header, []byte, error) {
+	header := make(http.Header)
+	var body []byte
+
+	if headersFile != "" {
+		f, err := os.Open(headersFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open headers file: %w", err)
+		}
+		defer f.Close()
+		if header, err = readWebhookHeaders(bufio.NewReader(f)); err != nil {
+			return nil, nil, err
+		}
+	}
+	if bodyFile != "" {
+		var err error
+		if body, err = os.ReadFile(bodyFile); err != nil {
+			return nil, nil, fmt.Errorf("failed to read body file: %w", err)
+		}
+	}
+	if headersFile != "" && bodyFile != "" {
+		return header, body, nil
+	}
+
+	r := bufio.NewReader(stdin)
+	if headersFile == "" && !headerFlags {
+		var err error
+		if header, err = readWebhookHeaders(r); err != nil {
+			return nil, nil, err
+		}
+	}
+	if bodyFile == "" {
+		var err error
+		if body, err = io.ReadAll(r); err != nil {
+			return nil, nil, fmt.Errorf("failed to read body: %w", err)
+		}
+	}
+	return header, body, nil
+}
+
+// readWebhookHeaders reads header lines until an empty line and skips a leading request line.
+func readWebhookHeaders(r *bufio.Reader) (http.Header, error) {
+	// Peek returns fewer bytes and an error if the input is shorter
+	line, _ := r.Peek(4096)
+	firstLine, _, _ := bytes.Cut(line, []byte("\n"))
+	if fields := strings.Fields(string(firstLine)); len(fields) == 3 && strings.HasPrefix(fields[2], "HTTP/") {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, fmt.Errorf("failed to read request line: %w", err)
+		}
+	}
+
+	mimeHeader, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read headers: %w", err)
+	}
+	if mimeHeader == nil {
+		return make(http.Header), nil
+	}
+	return http.Header(mimeHeader), nil
+}
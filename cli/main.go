@@ -10,12 +10,24 @@ func main() {
 
 	rootCmd := cmd.NewRootCmd()
 	cmd.NewGetCmd(rootCmd)
+	cmd.NewDiffCmd(rootCmd)
+	cmd.NewVersionsCmd(rootCmd)
+	cmd.NewLsCmd(rootCmd)
 	cmd.NewPostCmd(rootCmd)
 	cmd.NewRmCmd(rootCmd)
+	cmd.NewLockCmd(rootCmd)
+	cmd.NewUnlockCmd(rootCmd)
 	cmd.NewImportCmd(rootCmd)
+	cmd.NewImportGistCmd(rootCmd)
+	cmd.NewExportGistCmd(rootCmd)
 	cmd.NewShareCmd(rootCmd)
+	cmd.NewWatchCmd(rootCmd)
+	cmd.NewLoginCmd(rootCmd)
+	cmd.NewSettingsCmd(rootCmd)
+	cmd.NewWebhookCmd(rootCmd)
 	cmd.NewVersionCmd(rootCmd, version)
 	cmd.NewEnvCmd(rootCmd)
+	cmd.NewConfigCmd(rootCmd)
 	cmd.NewCompletionCmd(rootCmd)
 	cmd.Execute(rootCmd)
 }
@@ -0,0 +1,247 @@
+// Package client is a Go client for the gobin API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+)
+
+const (
+	DefaultMaxRetries = 3
+	DefaultBackoff    = time.Second
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// Error is returned for every response of the server which is not successful.
+type Error struct {
+	StatusCode int
+	Message    string
+	Path       string
+	RequestID  string
+	// Limit is the exceeded limit of 413 Content Too Large errors like the max file size.
+	Limit *api.LimitError
+	// Conflict is the version an update was based on and the latest version of 409 Conflict errors.
+	Conflict *api.ConflictError
+	// Lock is the lock of 423 Locked errors of documents which are locked by another holder.
+	Lock *api.LockedError
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("gobin: %d %s", e.StatusCode, e.Message)
+}
+
+// New returns a client for the gobin server at the given address like https://xgob.in.
+func New(server string) *Client {
+	return &Client{
+		Server: strings.TrimSuffix(server, "/"),
+		HTTPClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		MaxRetries: DefaultMaxRetries,
+		Backoff:    DefaultBackoff,
+		MaxBackoff: DefaultMaxBackoff,
+	}
+}
+
+type Client struct {
+	Server     string
+	HTTPClient *http.Client
+	// MaxRetries is how often a request is retried when it was rate limited. Requests which don't change anything are
+	// also retried on network and gateway errors.
+	MaxRetries int
+	// Backoff is the wait before the first retry, it doubles with every retry up to MaxBackoff. The Retry-After header
+	// of the server takes precedence.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	// auth is the full Authorization header like Bearer {token} or Secret {secret}.
+	auth        string
+	contentType string
+	// header is added to the headers of the request.
+	header http.Header
+	body   []byte
+	// stream is sent instead of the body with chunked transfer encoding, it can only be sent once, so the request is
+	// never retried.
+	stream io.Reader
+}
+
+func bearer(token string) string {
+	if token == "" {
+		return ""
+	}
+	return "Bearer " + token
+}
+
+// do sends the request and decodes the JSON response into v if v is not nil.
+func (c *Client) do(ctx context.Context, rq request, v any) (int, error) {
+	status, data, err := c.doRaw(ctx, rq)
+	if err != nil {
+		return status, err
+	}
+	if v == nil || len(data) == 0 {
+		return status, nil
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return status, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return status, nil
+}
+
+// doRaw sends the request with retries and returns the status and body of the response.
+func (c *Client) doRaw(ctx context.Context, rq request) (int, []byte, error) {
+	uri := c.Server + rq.path
+	if len(rq.query) > 0 {
+		uri += "?" + rq.query.Encode()
+	}
+
+	for try := 0; ; try++ {
+		status, header, data, err := c.send(ctx, rq, uri)
+		if err == nil && status >= http.StatusOK && status < http.StatusMultipleChoices {
+			return status, data, nil
+		}
+
+		if try < c.MaxRetries && ctx.Err() == nil && rq.stream == nil && retryable(rq.method, status, err) {
+			if err = sleep(ctx, c.backoff(try, header)); err != nil {
+				return 0, nil, err
+			}
+			continue
+		}
+
+		if err != nil {
+			return 0, nil, err
+		}
+		return status, nil, newError(status, rq.path, data)
+	}
+}
+
+func (c *Client) send(ctx context.Context, rq request, uri string) (int, http.Header, []byte, error) {
+	httpClient := c.HTTPClient
+	var body io.Reader
+	if rq.stream != nil {
+		body = rq.stream
+		// reading the stream may take longer than the timeout, the context cancels it instead
+		if httpClient.Timeout > 0 {
+			streamClient := *httpClient
+			streamClient.Timeout = 0
+			httpClient = &streamClient
+		}
+	} else if rq.body != nil {
+		body = bytes.NewReader(rq.body)
+	}
+	httpRq, err := http.NewRequestWithContext(ctx, rq.method, uri, body)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for key, values := range rq.header {
+		httpRq.Header[key] = values
+	}
+	if rq.contentType != "" {
+		httpRq.Header.Set(ezhttp.HeaderContentType, rq.contentType)
+	}
+	if rq.auth != "" {
+		httpRq.Header.Set(ezhttp.HeaderAuthorization, rq.auth)
+	}
+
+	rs, err := httpClient.Do(httpRq)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer func() {
+		_ = rs.Body.Close()
+	}()
+
+	data, err := io.ReadAll(rs.Body)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return rs.StatusCode, rs.Header, data, nil
+}
+
+// retryable reports whether the request can be sent again without changing something twice.
+func retryable(method string, status int, err error) bool {
+	if status == http.StatusTooManyRequests {
+		return true
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+func (c *Client) backoff(try int, header http.Header) time.Duration {
+	if header != nil {
+		if seconds, err := strconv.Atoi(header.Get(ezhttp.HeaderRetryAfter)); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	backoff := c.Backoff << try
+	if c.MaxBackoff > 0 && (backoff > c.MaxBackoff || backoff <= 0) {
+		backoff = c.MaxBackoff
+	}
+	return backoff
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func newError(status int, path string, data []byte) error {
+	var errRs api.ErrorResponse
+	if err := json.Unmarshal(data, &errRs); err != nil || errRs.Message == "" {
+		return &Error{
+			StatusCode: status,
+			Message:    http.StatusText(status),
+			Path:       path,
+		}
+	}
+	return &Error{
+		StatusCode: status,
+		Message:    errRs.Message,
+		Path:       errRs.Path,
+		RequestID:  errRs.RequestID,
+		Limit:      errRs.Limit,
+		Conflict:   errRs.Conflict,
+		Lock:       errRs.Lock,
+	}
+}
+
+// GetVersion returns the version information of the server.
+func (c *Client) GetVersion(ctx context.Context) (string, error) {
+	_, data, err := c.doRaw(ctx, request{
+		method: http.MethodGet,
+		path:   "/version",
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
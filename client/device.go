@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+)
+
+var (
+	ErrLoginDenied  = errors.New("login was denied")
+	ErrLoginExpired = errors.New("login code expired")
+)
+
+// RequestDeviceCode starts a device login for document tokens with the permissions and an account token if account is
+// set. The user has to enter the user code at the verification uri, afterward PollDeviceToken returns the tokens.
+func (c *Client) RequestDeviceCode(ctx context.Context, permissions []string, account bool) (*api.DeviceCodeResponse, error) {
+	body, err := json.Marshal(api.DeviceCodeRequest{Permissions: permissions, Account: account})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode device code request: %w", err)
+	}
+
+	var rs api.DeviceCodeResponse
+	if _, err = c.do(ctx, request{
+		method:      http.MethodPost,
+		path:        "/device/code",
+		contentType: ezhttp.ContentTypeJSON,
+		body:        body,
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// PollDeviceToken waits until the device login is approved like described in RFC 8628 and returns the document tokens
+// and the account token.
+func (c *Client) PollDeviceToken(ctx context.Context, code api.DeviceCodeResponse) (*api.DeviceTokenResponse, error) {
+	interval := time.Duration(code.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(code.ExpiresIn)*time.Second)
+	defer cancel()
+
+	body, err := json.Marshal(api.DeviceTokenRequest{DeviceCode: code.DeviceCode})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode device token request: %w", err)
+	}
+
+	for {
+		if err = sleep(ctx, interval); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return nil, ErrLoginExpired
+			}
+			return nil, err
+		}
+
+		var rs api.DeviceTokenResponse
+		_, err = c.do(ctx, request{
+			method:      http.MethodPost,
+			path:        "/device/token",
+			contentType: ezhttp.ContentTypeJSON,
+			body:        body,
+		}, &rs)
+		if err == nil {
+			return &rs, nil
+		}
+
+		var errRs *Error
+		if !errors.As(err, &errRs) {
+			return nil, err
+		}
+		switch errRs.Message {
+		case api.ErrDeviceAuthorizationPending.Error():
+		case api.ErrDeviceAuthorizationSlowDown.Error():
+			interval += 5 * time.Second
+		case api.ErrDeviceAuthorizationDenied.Error():
+			return nil, ErrLoginDenied
+		case api.ErrDeviceAuthorizationExpired.Error():
+			return nil, ErrLoginExpired
+		default:
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,700 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/klauspost/compress/gzip"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+)
+
+// RevisionPendingError is returned when an update of a protected document has to be approved first.
+type RevisionPendingError struct {
+	Revision api.RevisionResponse
+}
+
+func (e *RevisionPendingError) Error() string {
+	return fmt.Sprintf("gobin: revision %d of document %s is pending review", e.Revision.Revision, e.Revision.Key)
+}
+
+type (
+	// DocumentOptions are used when creating or updating a document.
+	DocumentOptions struct {
+		// Formatter renders the formatted content of the files in the response.
+		Formatter string
+		Style     string
+		// ExpiresAt is when the files expire, it takes precedence over TTL and is overwritten by api.RequestFile.ExpiresAt.
+		ExpiresAt *time.Time
+		TTL       time.Duration
+		// ForkedFrom is the document the new document is a fork of, only used when creating a document.
+		ForkedFrom        string
+		ForkedFromVersion int64
+		// DefaultStyle is suggested to viewers of the document who didn't pick a style, only used when creating a document.
+		DefaultStyle string
+		// UserToken applies the default expiry and language of the user settings, only used when creating a document.
+		UserToken string
+		// Key is the custom key of the new document, only used when creating a document on servers which allow it.
+		Key string
+		// Message describes the changes of the new version like a commit message.
+		Message string
+		// Public announces the new document to the ActivityPub followers of the server, only used when creating a document.
+		Public bool
+		// WithoutContent leaves the content of the files out of the response, so large files aren't sent back.
+		WithoutContent bool
+		// IfMatch is the version an update is based on, the update fails with an Error with Conflict set if the document
+		// was changed since. Only used when updating a document.
+		IfMatch int64
+		// Lock is the id of the lock of the document, see Client.LockDocument. Only used when updating a document.
+		Lock string
+	}
+
+	// AppendOptions are used when appending to a file of a document.
+	AppendOptions struct {
+		// File is the file to append to, it is created if the document has no such file. Empty uses the first file.
+		File string
+		// Language is only used for new files, empty detects it.
+		Language string
+		// MaxSize rotates the file when it would get larger than this, see api.AppendRotateVersion and
+		// api.AppendRotateFile.
+		MaxSize int64
+		Rotate  string
+		// Message describes the appended content like a commit message.
+		Message string
+		// Lock is the id of the lock of the document, see Client.LockDocument.
+		Lock string
+	}
+
+	// RenderOptions are used when getting documents.
+	RenderOptions struct {
+		Formatter string
+		Style     string
+		// Language overwrites the language of the file, only used when getting a single file.
+		Language string
+	}
+)
+
+func (o *DocumentOptions) query() url.Values {
+	query := make(url.Values)
+	if o == nil {
+		return query
+	}
+	if o.Formatter != "" {
+		query.Set("formatter", o.Formatter)
+	}
+	if o.Style != "" {
+		query.Set("style", o.Style)
+	}
+	if o.ExpiresAt != nil {
+		query.Set("expires", o.ExpiresAt.Format(time.RFC3339))
+	}
+	if o.TTL > 0 {
+		query.Set("ttl", o.TTL.String())
+	}
+	if o.ForkedFrom != "" {
+		query.Set("forked_from", o.ForkedFrom)
+		if o.ForkedFromVersion != 0 {
+			query.Set("forked_from_version", strconv.FormatInt(o.ForkedFromVersion, 10))
+		}
+	}
+	if o.DefaultStyle != "" {
+		query.Set("default_style", o.DefaultStyle)
+	}
+	if o.Key != "" {
+		query.Set("key", o.Key)
+	}
+	if o.Message != "" {
+		query.Set("message", o.Message)
+	}
+	if o.Public {
+		query.Set("public", "true")
+	}
+	if o.WithoutContent {
+		query.Set("withContent", "false")
+	}
+	return query
+}
+
+func (o *AppendOptions) query() url.Values {
+	query := make(url.Values)
+	if o == nil {
+		return query
+	}
+	if o.File != "" {
+		query.Set("file", o.File)
+	}
+	if o.Language != "" {
+		query.Set("language", o.Language)
+	}
+	if o.MaxSize > 0 {
+		query.Set("max_size", strconv.FormatInt(o.MaxSize, 10))
+	}
+	if o.Rotate != "" {
+		query.Set("rotate", o.Rotate)
+	}
+	if o.Message != "" {
+		query.Set("message", o.Message)
+	}
+	return query
+}
+
+func (o *RenderOptions) query() url.Values {
+	query := make(url.Values)
+	if o == nil {
+		return query
+	}
+	if o.Formatter != "" {
+		query.Set("formatter", o.Formatter)
+	}
+	if o.Style != "" {
+		query.Set("style", o.Style)
+	}
+	if o.Language != "" {
+		query.Set("language", o.Language)
+	}
+	return query
+}
+
+func documentPath(documentID string, version int64) string {
+	path := "/documents/" + url.PathEscape(documentID)
+	if version != 0 {
+		path += "/versions/" + strconv.FormatInt(version, 10)
+	}
+	return path
+}
+
+// CreateDocument creates a new document with the files. The token of the document is in the response.
+func (c *Client) CreateDocument(ctx context.Context, files []api.RequestFile, opts *DocumentOptions) (*api.DocumentResponse, error) {
+	contentType, body, err := newMultipartBody(files)
+	if err != nil {
+		return nil, err
+	}
+	return c.createDocument(ctx, request{contentType: contentType, body: body}, opts)
+}
+
+// CreateDocumentFromURL creates a new document with the content the server fetches from the url.
+func (c *Client) CreateDocumentFromURL(ctx context.Context, fromURL string, opts *DocumentOptions) (*api.DocumentResponse, error) {
+	body, err := json.Marshal(api.FromURLRequest{FromURL: fromURL})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode from url request: %w", err)
+	}
+	return c.createDocument(ctx, request{contentType: ezhttp.ContentTypeJSON, body: body}, opts)
+}
+
+// ImportGist creates a new document with the files of a GitHub gist, gist is its id or url.
+func (c *Client) ImportGist(ctx context.Context, gist string, opts *DocumentOptions) (*api.DocumentResponse, error) {
+	body, err := json.Marshal(api.GistImportRequest{Gist: gist})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode gist import request: %w", err)
+	}
+	return c.createDocument(ctx, request{path: "/documents/gist", contentType: ezhttp.ContentTypeJSON, body: body}, opts)
+}
+
+// CreateDocumentStream creates a new document with a single file whose content is compressed and streamed to the
+// server while it's read, so it's never held in memory. The request can't be retried and the timeout of the HTTP client
+// doesn't apply to it, cancel the context instead.
+func (c *Client) CreateDocumentStream(ctx context.Context, name string, language string, content io.Reader, opts *DocumentOptions) (*api.DocumentResponse, error) {
+	return c.createDocument(ctx, newStreamRequest(name, language, content), opts)
+}
+
+// CreateDocumentPart creates a new document with the files as the next part of the index document, content which is
+// larger than the max document size of the server is split into parts this way. The token needs the write permission
+// of the index, the token of the part is in the response.
+func (c *Client) CreateDocumentPart(ctx context.Context, indexID string, token string, files []api.RequestFile, opts *DocumentOptions) (*api.DocumentResponse, error) {
+	contentType, body, err := newMultipartBody(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var rs api.DocumentResponse
+	if _, err = c.do(ctx, request{
+		method:      http.MethodPost,
+		path:        documentPath(indexID, 0) + "/parts",
+		query:       opts.query(),
+		auth:        bearer(token),
+		contentType: contentType,
+		body:        body,
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// GetDocumentParts returns the parts of the split content the document belongs to, an Error with status 404 is returned
+// if the document wasn't split.
+func (c *Client) GetDocumentParts(ctx context.Context, documentID string) (*api.PartsResponse, error) {
+	var rs api.PartsResponse
+	if _, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   documentPath(documentID, 0) + "/parts",
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+func (c *Client) createDocument(ctx context.Context, rq request, opts *DocumentOptions) (*api.DocumentResponse, error) {
+	rq.method = http.MethodPost
+	if rq.path == "" {
+		rq.path = "/documents"
+	}
+	rq.query = opts.query()
+	if opts != nil {
+		rq.auth = bearer(opts.UserToken)
+	}
+
+	var rs api.DocumentResponse
+	if _, err := c.do(ctx, rq, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// UpdateDocument saves the files as a new version of the document. A *RevisionPendingError is returned if the document
+// is protected and the token lacks the review permission.
+func (c *Client) UpdateDocument(ctx context.Context, documentID string, token string, files []api.RequestFile, opts *DocumentOptions) (*api.DocumentResponse, error) {
+	contentType, body, err := newMultipartBody(files)
+	if err != nil {
+		return nil, err
+	}
+	return c.updateDocument(ctx, documentID, token, request{contentType: contentType, body: body}, opts)
+}
+
+// UpdateDocumentFromURL saves the content the server fetches from the url as a new version of the document.
+func (c *Client) UpdateDocumentFromURL(ctx context.Context, documentID string, token string, fromURL string, opts *DocumentOptions) (*api.DocumentResponse, error) {
+	body, err := json.Marshal(api.FromURLRequest{FromURL: fromURL})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode from url request: %w", err)
+	}
+	return c.updateDocument(ctx, documentID, token, request{contentType: ezhttp.ContentTypeJSON, body: body}, opts)
+}
+
+// UpdateDocumentStream saves a single file whose content is compressed and streamed to the server while it's read as a
+// new version of the document, see CreateDocumentStream.
+func (c *Client) UpdateDocumentStream(ctx context.Context, documentID string, token string, name string, language string, content io.Reader, opts *DocumentOptions) (*api.DocumentResponse, error) {
+	return c.updateDocument(ctx, documentID, token, newStreamRequest(name, language, content), opts)
+}
+
+func (c *Client) updateDocument(ctx context.Context, documentID string, token string, rq request, opts *DocumentOptions) (*api.DocumentResponse, error) {
+	rq.method = http.MethodPatch
+	rq.path = documentPath(documentID, 0)
+	rq.query = opts.query()
+	rq.auth = bearer(token)
+	if opts != nil && opts.IfMatch > 0 {
+		if rq.header == nil {
+			rq.header = http.Header{}
+		}
+		rq.header.Set(ezhttp.HeaderIfMatch, strconv.FormatInt(opts.IfMatch, 10))
+	}
+	if opts != nil && opts.Lock != "" {
+		if rq.header == nil {
+			rq.header = http.Header{}
+		}
+		rq.header.Set(ezhttp.HeaderDocumentLock, opts.Lock)
+	}
+
+	var data json.RawMessage
+	status, err := c.do(ctx, rq, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	if status == http.StatusAccepted {
+		var revision api.RevisionResponse
+		if err = json.Unmarshal(data, &revision); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+		return nil, &RevisionPendingError{Revision: revision}
+	}
+
+	var rs api.DocumentResponse
+	if err = json.Unmarshal(data, &rs); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &rs, nil
+}
+
+// AppendDocument appends the content to a file of the document and saves it as a new version.
+func (c *Client) AppendDocument(ctx context.Context, documentID string, token string, content []byte, opts *AppendOptions) (*api.AppendResponse, error) {
+	var header http.Header
+	if opts != nil && opts.Lock != "" {
+		header = http.Header{ezhttp.HeaderDocumentLock: {opts.Lock}}
+	}
+
+	var rs api.AppendResponse
+	if _, err := c.do(ctx, request{
+		method:      http.MethodPost,
+		path:        documentPath(documentID, 0) + "/append",
+		query:       opts.query(),
+		header:      header,
+		auth:        bearer(token),
+		contentType: ezhttp.ContentTypeText,
+		body:        content,
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// LockDocument locks the document, so only updates with the id of the lock in DocumentOptions.Lock or
+// AppendOptions.Lock can create new versions until the lock expires. Passing the id of the current lock renews it,
+// lockRq.Steal takes over the lock of another holder. Documents locked by another holder return an Error with Lock set.
+func (c *Client) LockDocument(ctx context.Context, documentID string, token string, lockID string, lockRq api.LockRequest) (*api.LockResponse, error) {
+	body, err := json.Marshal(lockRq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode lock request: %w", err)
+	}
+	var header http.Header
+	if lockID != "" {
+		header = http.Header{ezhttp.HeaderDocumentLock: {lockID}}
+	}
+
+	var rs api.LockResponse
+	if _, err = c.do(ctx, request{
+		method:      http.MethodPost,
+		path:        documentPath(documentID, 0) + "/lock",
+		header:      header,
+		auth:        bearer(token),
+		contentType: ezhttp.ContentTypeJSON,
+		body:        body,
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// GetDocumentLock returns the lock of the document, documents which aren't locked return an Error with status 404.
+func (c *Client) GetDocumentLock(ctx context.Context, documentID string) (*api.LockResponse, error) {
+	var rs api.LockResponse
+	if _, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   documentPath(documentID, 0) + "/lock",
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// UnlockDocument releases the lock of the document with the id.
+func (c *Client) UnlockDocument(ctx context.Context, documentID string, token string, lockID string) error {
+	_, err := c.do(ctx, request{
+		method: http.MethodDelete,
+		path:   documentPath(documentID, 0) + "/lock",
+		header: http.Header{ezhttp.HeaderDocumentLock: {lockID}},
+		auth:   bearer(token),
+	}, nil)
+	return err
+}
+
+// ListDocuments returns a page of the documents of the token from the most recently updated to the oldest. A user
+// token lists the created documents and the documents the user was invited to. Pass the Next cursor of the response
+// to get the next page, an empty cursor returns the first page and a limit of 0 the default page size.
+func (c *Client) ListDocuments(ctx context.Context, token string, cursor string, limit int) (*api.DocumentListResponse, error) {
+	query := url.Values{}
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var rs api.DocumentListResponse
+	if _, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/documents",
+		query:  query,
+		auth:   bearer(token),
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// GetDocument returns a version of the document, 0 returns the latest version.
+func (c *Client) GetDocument(ctx context.Context, documentID string, version int64, opts *RenderOptions) (*api.DocumentResponse, error) {
+	var rs api.DocumentResponse
+	if _, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   documentPath(documentID, version),
+		query:  opts.query(),
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// GetDocumentFile returns a single file of a version of the document, 0 returns the latest version.
+func (c *Client) GetDocumentFile(ctx context.Context, documentID string, version int64, fileName string, opts *RenderOptions) (*api.ResponseFile, error) {
+	query := opts.query()
+	query.Set("file", fileName)
+
+	var rs api.ResponseFile
+	if _, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   documentPath(documentID, version),
+		query:  query,
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// GetDocumentVersions returns all versions of the document from newest to oldest, the files only have content if
+// withContent is true.
+func (c *Client) GetDocumentVersions(ctx context.Context, documentID string, withContent bool, opts *RenderOptions) ([]api.DocumentResponse, error) {
+	query := opts.query()
+	if withContent {
+		query.Set("withContent", "true")
+	}
+
+	var rs []api.DocumentResponse
+	if _, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   documentPath(documentID, 0) + "/versions",
+		query:  query,
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// GetDocumentDiff returns the unified diff of each changed file between two versions of the document. A to of 0 is the
+// latest version and a from of 0 the version before to.
+func (c *Client) GetDocumentDiff(ctx context.Context, documentID string, from int64, to int64) (*api.DiffResponse, error) {
+	query := url.Values{}
+	if from != 0 {
+		query.Set("from", strconv.FormatInt(from, 10))
+	}
+	if to != 0 {
+		query.Set("to", strconv.FormatInt(to, 10))
+	}
+
+	var rs api.DiffResponse
+	if _, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   documentPath(documentID, 0) + "/diff",
+		query:  query,
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// DownloadDocumentArchive writes all files of a version of the document as a zip or tar.gz archive to w, 0 downloads
+// the latest version.
+func (c *Client) DownloadDocumentArchive(ctx context.Context, documentID string, version int64, format string, w io.Writer) error {
+	path := documentPath(documentID, version) + "/archive"
+	rq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Server+path+"?"+url.Values{"format": {format}}.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// large archives may take longer to download than the timeout of a request
+	httpClient := *c.HTTPClient
+	httpClient.Timeout = 0
+	rs, err := httpClient.Do(rq)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rs.Body.Close()
+	}()
+
+	if rs.StatusCode != http.StatusOK {
+		data, err := io.ReadAll(rs.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+		return newError(rs.StatusCode, path, data)
+	}
+
+	if _, err = io.Copy(w, rs.Body); err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	return nil
+}
+
+// DeleteDocument deletes the document with all its versions.
+func (c *Client) DeleteDocument(ctx context.Context, documentID string, token string) error {
+	_, err := c.DeleteDocumentVersion(ctx, documentID, 0, token)
+	return err
+}
+
+// DeleteDocumentVersion deletes a version of the document and returns how many versions are left.
+func (c *Client) DeleteDocumentVersion(ctx context.Context, documentID string, version int64, token string) (*api.DeleteResponse, error) {
+	var rs api.DeleteResponse
+	if _, err := c.do(ctx, request{
+		method: http.MethodDelete,
+		path:   documentPath(documentID, version),
+		auth:   bearer(token),
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// ShareDocument creates a new token for the document with the permissions, see api.AllStringPermissions.
+func (c *Client) ShareDocument(ctx context.Context, documentID string, token string, permissions []string) (string, error) {
+	rs, err := c.CreateShareToken(ctx, documentID, token, api.ShareRequest{Permissions: permissions})
+	if err != nil {
+		return "", err
+	}
+	return rs.Token, nil
+}
+
+// CreateShareToken creates a new token for the document like ShareDocument, which can also expire or be limited to a
+// number of uses.
+func (c *Client) CreateShareToken(ctx context.Context, documentID string, token string, shareRq api.ShareRequest) (*api.ShareResponse, error) {
+	body, err := json.Marshal(shareRq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode share request: %w", err)
+	}
+
+	var rs api.ShareResponse
+	if _, err = c.do(ctx, request{
+		method:      http.MethodPost,
+		path:        documentPath(documentID, 0) + "/share",
+		auth:        bearer(token),
+		contentType: ezhttp.ContentTypeJSON,
+		body:        body,
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// RevokeToken revokes a token of the document, so it can't be used anymore. The tokenID is the id of the ShareResponse
+// or the TokenID of the token.
+func (c *Client) RevokeToken(ctx context.Context, documentID string, token string, tokenID string) error {
+	_, err := c.do(ctx, request{
+		method: http.MethodDelete,
+		path:   documentPath(documentID, 0) + "/share/" + url.PathEscape(tokenID),
+		auth:   bearer(token),
+	}, nil)
+	return err
+}
+
+// TokenID returns the id a token is revoked with, it returns the jti of share tokens and the SHA-256 of other tokens.
+// The token isn't verified.
+func TokenID(token string) string {
+	var claims jwt.Claims
+	if parsed, err := jwt.ParseSigned(token); err == nil {
+		_ = parsed.UnsafeClaimsWithoutVerification(&claims)
+	}
+	return api.TokenID(token, claims.ID)
+}
+
+// SetDocumentStyle sets the style which is suggested to viewers of the document, an empty style removes it.
+func (c *Client) SetDocumentStyle(ctx context.Context, documentID string, token string, style string) error {
+	body, err := json.Marshal(api.DocumentStyleRequest{Style: style})
+	if err != nil {
+		return fmt.Errorf("failed to encode document style request: %w", err)
+	}
+
+	_, err = c.do(ctx, request{
+		method:      http.MethodPut,
+		path:        documentPath(documentID, 0) + "/style",
+		auth:        bearer(token),
+		contentType: ezhttp.ContentTypeJSON,
+		body:        body,
+	}, nil)
+	return err
+}
+
+// CreateReadToken creates a read only token for the documents, every document needs one of its tokens.
+func (c *Client) CreateReadToken(ctx context.Context, documents []api.ReadTokenDocument) (*api.ReadTokenResponse, error) {
+	body, err := json.Marshal(api.ReadTokenRequest{Documents: documents})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode read token request: %w", err)
+	}
+
+	var rs api.ReadTokenResponse
+	if _, err = c.do(ctx, request{
+		method:      http.MethodPost,
+		path:        "/tokens",
+		contentType: ezhttp.ContentTypeJSON,
+		body:        body,
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// newStreamRequest returns a request which sends the content as gzip compressed body with the file name in the
+// Content-Disposition header. The content is compressed in the background while the request is sent.
+func newStreamRequest(name string, language string, content io.Reader) request {
+	pr, pw := io.Pipe()
+	go func() {
+		gw, _ := gzip.NewWriterLevel(pw, gzip.BestSpeed)
+		_, err := io.Copy(gw, content)
+		if err == nil {
+			err = gw.Close()
+		}
+		_ = pw.CloseWithError(err)
+	}()
+
+	header := http.Header{}
+	header.Set(ezhttp.HeaderContentEncoding, "gzip")
+	header.Set(ezhttp.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{
+		"filename": name,
+	}))
+	if language != "" {
+		header.Set(ezhttp.HeaderLanguage, language)
+	}
+	return request{
+		contentType: ezhttp.DefaultContentTyp,
+		header:      header,
+		stream:      pr,
+	}
+}
+
+func newMultipartBody(files []api.RequestFile) (string, []byte, error) {
+	buff := new(bytes.Buffer)
+	mpw := multipart.NewWriter(buff)
+
+	for i, file := range files {
+		header := textproto.MIMEHeader{
+			ezhttp.HeaderContentDisposition: []string{
+				mime.FormatMediaType("form-data", map[string]string{
+					"name":     fmt.Sprintf("file-%d", i),
+					"filename": file.Name,
+				}),
+			},
+			ezhttp.HeaderContentType: []string{ezhttp.DefaultContentTyp},
+		}
+		if file.Language != "" {
+			header.Set(ezhttp.HeaderLanguage, file.Language)
+		}
+		if file.Encrypted {
+			header.Set(ezhttp.HeaderEncrypted, "true")
+		}
+		if file.ExpiresAt != nil {
+			header.Set("Expires", file.ExpiresAt.Format(time.RFC3339))
+		}
+
+		part, err := mpw.CreatePart(header)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to create multipart part: %w", err)
+		}
+		if _, err = io.WriteString(part, file.Content); err != nil {
+			return "", nil, fmt.Errorf("failed to write multipart part: %w", err)
+		}
+	}
+
+	if err := mpw.Close(); err != nil {
+		return "", nil, fmt.Errorf("failed to close multipart writer: %w", err)
+	}
+	return mpw.FormDataContentType(), buff.Bytes(), nil
+}
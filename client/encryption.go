@@ -0,0 +1,123 @@
+package client
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/topi314/gobin/v3/api"
+)
+
+// EncryptionKeySize is the size of the AES-256 keys which encrypt the files of end-to-end encrypted documents.
+const EncryptionKeySize = 32
+
+var ErrInvalidEncryptionKey = errors.New("invalid encryption key")
+
+// NewEncryptionKey returns a random key to encrypt the files of a document with.
+func NewEncryptionKey() ([]byte, error) {
+	key := make([]byte, EncryptionKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate encryption key: %w", err)
+	}
+	return key, nil
+}
+
+// EncodeEncryptionKey encodes the key for the fragment of the document URL like https://xgob.in/{key}#key={encoded key}.
+// The browser never sends the fragment to the server, so only people with the link can decrypt the document.
+func EncodeEncryptionKey(key []byte) string {
+	return base64.RawURLEncoding.EncodeToString(key)
+}
+
+// ParseEncryptionKey decodes a key from EncodeEncryptionKey, the key can also be given as document URL.
+func ParseEncryptionKey(encodedKey string) ([]byte, error) {
+	if _, fragment, ok := strings.Cut(encodedKey, "#"); ok {
+		encodedKey = fragment
+	}
+	encodedKey = strings.TrimPrefix(encodedKey, "key=")
+
+	key, err := base64.RawURLEncoding.DecodeString(encodedKey)
+	if err != nil || len(key) != EncryptionKeySize {
+		return nil, ErrInvalidEncryptionKey
+	}
+	return key, nil
+}
+
+// EncryptContent encrypts the content with AES-GCM and returns the nonce and ciphertext as base64.
+func EncryptContent(key []byte, content string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(content), nil)), nil
+}
+
+// DecryptContent decrypts content from EncryptContent.
+func DecryptContent(key []byte, content string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode encrypted content: %w", err)
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("encrypted content is too short")
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt content: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// EncryptFiles encrypts the content of the files and marks them as encrypted, so the server skips highlighting and
+// previews for them.
+func EncryptFiles(key []byte, files []api.RequestFile) error {
+	for i, file := range files {
+		content, err := EncryptContent(key, file.Content)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt file %s: %w", file.Name, err)
+		}
+		files[i].Content = content
+		files[i].Encrypted = true
+	}
+	return nil
+}
+
+// DecryptFile decrypts the content of the file if it is encrypted. The formatted content is not decrypted since the
+// server can't highlight encrypted files.
+func DecryptFile(key []byte, file *api.ResponseFile) error {
+	if !file.Encrypted {
+		return nil
+	}
+	content, err := DecryptContent(key, file.Content)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt file %s: %w", file.Name, err)
+	}
+	file.Content = content
+	file.Formatted = ""
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != EncryptionKeySize {
+		return nil, ErrInvalidEncryptionKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
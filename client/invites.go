@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+)
+
+// CreateInvite creates an invite link for the document, the token needs the share permission and every permission of
+// the invite.
+func (c *Client) CreateInvite(ctx context.Context, documentID string, token string, invite api.InviteCreateRequest) (*api.InviteResponse, error) {
+	body, err := json.Marshal(invite)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode invite create request: %w", err)
+	}
+
+	var rs api.InviteResponse
+	if _, err = c.do(ctx, request{
+		method:      http.MethodPost,
+		path:        documentPath(documentID, 0) + "/invites",
+		auth:        bearer(token),
+		contentType: ezhttp.ContentTypeJSON,
+		body:        body,
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// GetInvites returns the invites of the document, the token needs the share permission.
+func (c *Client) GetInvites(ctx context.Context, documentID string, token string) ([]api.InviteResponse, error) {
+	var rs api.InvitesResponse
+	if _, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   documentPath(documentID, 0) + "/invites",
+		auth:   bearer(token),
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return rs.Invites, nil
+}
+
+// DeleteInvite deletes an invite of the document, the token needs the share permission.
+func (c *Client) DeleteInvite(ctx context.Context, documentID string, token string, inviteID string) error {
+	_, err := c.do(ctx, request{
+		method: http.MethodDelete,
+		path:   documentPath(documentID, 0) + "/invites/" + url.PathEscape(inviteID),
+		auth:   bearer(token),
+	}, nil)
+	return err
+}
+
+// AcceptInvite joins the access list of the document of the invite and returns a token for it. The user token from
+// CreateUserToken is optional, without it the member only exists for the returned token.
+func (c *Client) AcceptInvite(ctx context.Context, inviteID string, userToken string) (*api.InviteAcceptResponse, error) {
+	var rs api.InviteAcceptResponse
+	if _, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/invites/" + url.PathEscape(inviteID) + "/accept",
+		auth:   bearer(userToken),
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// GetMembers returns the access list of the document, the token needs the share permission.
+func (c *Client) GetMembers(ctx context.Context, documentID string, token string) ([]api.MemberResponse, error) {
+	var rs api.MembersResponse
+	if _, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   documentPath(documentID, 0) + "/members",
+		auth:   bearer(token),
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return rs.Members, nil
+}
+
+// DeleteMember removes a member from the access list of the document, the tokens of the member stop working. The token
+// needs the share permission.
+func (c *Client) DeleteMember(ctx context.Context, documentID string, token string, memberID string) error {
+	_, err := c.do(ctx, request{
+		method: http.MethodDelete,
+		path:   documentPath(documentID, 0) + "/members/" + url.PathEscape(memberID),
+		auth:   bearer(token),
+	}, nil)
+	return err
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/topi314/gobin/v3/api"
+)
+
+// WatchDocument calls fn for every event of the live stream of the document. It returns nil when the server ends the
+// stream, which it does once the document is deleted, and the error of fn if it returns one. The stream is not limited
+// by the timeout of the HTTPClient.
+func (c *Client) WatchDocument(ctx context.Context, documentID string, fn func(event api.LiveEvent) error) error {
+	path := documentPath(documentID, 0) + "/events"
+	rq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Server+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpClient := *c.HTTPClient
+	httpClient.Timeout = 0
+	rs, err := httpClient.Do(rq)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rs.Body.Close()
+	}()
+
+	if rs.StatusCode != http.StatusOK {
+		data, err := io.ReadAll(rs.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+		return newError(rs.StatusCode, path, data)
+	}
+
+	var data string
+	scanner := bufio.NewScanner(rs.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			// the event name is also in the data, comments are heartbeats
+			if value, ok := strings.CutPrefix(line, "data:"); ok {
+				data += strings.TrimPrefix(value, " ")
+			}
+			continue
+		}
+		if data == "" {
+			continue
+		}
+
+		var event api.LiveEvent
+		if err = json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("failed to decode event: %w", err)
+		}
+		data = ""
+		if err = fn(event); err != nil {
+			return err
+		}
+	}
+	if err = scanner.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to read events: %w", err)
+	}
+	return ctx.Err()
+}
+
+// TailDocumentFile writes the last lines of the latest version of a file to w. With follow it keeps writing the content
+// appended by new versions until the document is deleted or ctx is done, the stream is not limited by the timeout of
+// the HTTPClient.
+func (c *Client) TailDocumentFile(ctx context.Context, documentID string, fileName string, lines int, follow bool, w io.Writer) error {
+	path := documentPath(documentID, 0) + "/files/" + url.PathEscape(fileName) + "/tail"
+	query := url.Values{}
+	query.Set("lines", strconv.Itoa(lines))
+	if follow {
+		query.Set("follow", "true")
+	}
+	rq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Server+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpClient := *c.HTTPClient
+	if follow {
+		httpClient.Timeout = 0
+	}
+	rs, err := httpClient.Do(rq)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rs.Body.Close()
+	}()
+
+	if rs.StatusCode != http.StatusOK {
+		data, err := io.ReadAll(rs.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+		return newError(rs.StatusCode, path, data)
+	}
+
+	if _, err = io.Copy(w, rs.Body); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to read tail: %w", err)
+	}
+	return ctx.Err()
+}
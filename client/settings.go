@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+)
+
+// CreateUserToken creates a new anonymous user and returns its token. The settings of the user apply to documents
+// created with DocumentOptions.UserToken.
+func (c *Client) CreateUserToken(ctx context.Context) (string, error) {
+	var rs api.UserTokenResponse
+	if _, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/user/token",
+	}, &rs); err != nil {
+		return "", err
+	}
+	return rs.Token, nil
+}
+
+// GetUserSettings returns the settings of the user, users without settings get the defaults.
+func (c *Client) GetUserSettings(ctx context.Context, userToken string) (*api.UserSettingsResponse, error) {
+	var rs api.UserSettingsResponse
+	if _, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/user/settings",
+		auth:   bearer(userToken),
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// SetUserSettings replaces the settings of the user.
+func (c *Client) SetUserSettings(ctx context.Context, userToken string, settings api.UserSettingsRequest) (*api.UserSettingsResponse, error) {
+	body, err := json.Marshal(settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode user settings request: %w", err)
+	}
+
+	var rs api.UserSettingsResponse
+	if _, err = c.do(ctx, request{
+		method:      http.MethodPut,
+		path:        "/user/settings",
+		auth:        bearer(userToken),
+		contentType: ezhttp.ContentTypeJSON,
+		body:        body,
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// DeleteUserSettings resets the settings of the user to the defaults.
+func (c *Client) DeleteUserSettings(ctx context.Context, userToken string) error {
+	_, err := c.do(ctx, request{
+		method: http.MethodDelete,
+		path:   "/user/settings",
+		auth:   bearer(userToken),
+	}, nil)
+	return err
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+)
+
+func webhookPath(documentID string, webhookID string) string {
+	return documentPath(documentID, 0) + "/webhooks/" + url.PathEscape(webhookID)
+}
+
+// CreateWebhook registers a webhook for the document, the token needs the webhook permission.
+func (c *Client) CreateWebhook(ctx context.Context, documentID string, token string, webhook api.WebhookCreateRequest) (*api.WebhookResponse, error) {
+	body, err := json.Marshal(webhook)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode webhook create request: %w", err)
+	}
+
+	var rs api.WebhookResponse
+	if _, err = c.do(ctx, request{
+		method:      http.MethodPost,
+		path:        documentPath(documentID, 0) + "/webhooks",
+		auth:        bearer(token),
+		contentType: ezhttp.ContentTypeJSON,
+		body:        body,
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// GetWebhook returns a webhook of the document, it is authorized with the secret of the webhook.
+func (c *Client) GetWebhook(ctx context.Context, documentID string, webhookID string, secret string) (*api.WebhookResponse, error) {
+	var rs api.WebhookResponse
+	if _, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   webhookPath(documentID, webhookID),
+		auth:   "Secret " + secret,
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// UpdateWebhook changes the non-empty fields of the webhook, it is authorized with the secret of the webhook.
+func (c *Client) UpdateWebhook(ctx context.Context, documentID string, webhookID string, secret string, webhook api.WebhookUpdateRequest) (*api.WebhookResponse, error) {
+	body, err := json.Marshal(webhook)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode webhook update request: %w", err)
+	}
+
+	var rs api.WebhookResponse
+	if _, err = c.do(ctx, request{
+		method:      http.MethodPatch,
+		path:        webhookPath(documentID, webhookID),
+		auth:        "Secret " + secret,
+		contentType: ezhttp.ContentTypeJSON,
+		body:        body,
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// DeleteWebhook removes the webhook, it is authorized with the secret of the webhook.
+func (c *Client) DeleteWebhook(ctx context.Context, documentID string, webhookID string, secret string) error {
+	_, err := c.do(ctx, request{
+		method: http.MethodDelete,
+		path:   webhookPath(documentID, webhookID),
+		auth:   "Secret " + secret,
+	}, nil)
+	return err
+}
+
+// GetWebhookDeliveries returns the newest deliveries of the webhook first, a limit of 0 uses the server default.
+func (c *Client) GetWebhookDeliveries(ctx context.Context, documentID string, webhookID string, secret string, limit int) ([]api.WebhookDeliveryResponse, error) {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var rs api.WebhookDeliveriesResponse
+	if _, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   webhookPath(documentID, webhookID) + "/deliveries",
+		query:  query,
+		auth:   "Secret " + secret,
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return rs.Deliveries, nil
+}
+
+// RedeliverWebhookDelivery sends a finished delivery again to the current url of the webhook.
+func (c *Client) RedeliverWebhookDelivery(ctx context.Context, documentID string, webhookID string, secret string, deliveryID string) (*api.WebhookDeliveryResponse, error) {
+	var rs api.WebhookDeliveryResponse
+	if _, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   webhookPath(documentID, webhookID) + "/deliveries/" + url.PathEscape(deliveryID) + "/redeliver",
+		auth:   "Secret " + secret,
+	}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+// compressCommand compresses or decompresses the contents of all files stored in the database instead of starting the
+// server.
+type compressCommand struct {
+	decompress bool
+}
+
+func parseCompressCommand(args []string) (*compressCommand, error) {
+	cmd := &compressCommand{}
+	flags := flag.NewFlagSet("compress", flag.ContinueOnError)
+	flags.BoolVar(&cmd.decompress, "decompress", false, "decompress all compressed contents, run it before turning database.compression off to store them uncompressed again")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(), "Usage: gobin [--config gobin.toml] compress [flags]")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %v", flags.Args())
+	}
+	return cmd, nil
+}
+
+func (c *compressCommand) run(ctx context.Context, db *database.CompressedDB) error {
+	result, err := db.MigrateContents(ctx, !c.decompress)
+	action := "Compressed"
+	if c.decompress {
+		action = "Decompressed"
+	}
+	slog.Info(action+" file contents",
+		slog.Int("documents", result.Documents),
+		slog.Int("files", result.Files),
+		slog.String("size", humanize.IBytes(uint64(result.Size))),
+		slog.String("stored_size", humanize.IBytes(uint64(result.StoredSize))),
+	)
+	return err
+}
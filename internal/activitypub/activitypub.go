@@ -0,0 +1,256 @@
+// Package activitypub has the ActivityStreams types and HTTP signatures gobin needs to federate with the fediverse.
+package activitypub
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	ContentType = "application/activity+json"
+	// LDContentType is also accepted for ActivityPub objects, some servers only send this one.
+	LDContentType = `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`
+
+	ContextActivityStreams = "https://www.w3.org/ns/activitystreams"
+	ContextSecurity        = "https://w3id.org/security/v1"
+	// Public is the collection of everyone, objects addressed to it can be seen and boosted by everyone.
+	Public = "https://www.w3.org/ns/activitystreams#Public"
+
+	TypeService           = "Service"
+	TypeNote              = "Note"
+	TypeTombstone         = "Tombstone"
+	TypeCreate            = "Create"
+	TypeDelete            = "Delete"
+	TypeFollow            = "Follow"
+	TypeAccept            = "Accept"
+	TypeUndo              = "Undo"
+	TypeOrderedCollection = "OrderedCollection"
+
+	WebFingerContentType    = "application/jrd+json"
+	WebFingerSelfRel        = "self"
+	WebFingerProfilePageRel = "http://webfinger.net/rel/profile-page"
+)
+
+const (
+	privateKeySize       = 2048
+	privateKeyPEMType    = "PRIVATE KEY"
+	publicKeyPEMType     = "PUBLIC KEY"
+	rsaPrivateKeyPEMType = "RSA PRIVATE KEY"
+	rsaPublicKeyPEMType  = "RSA PUBLIC KEY"
+)
+
+var (
+	ErrInvalidPublicKey  = errors.New("invalid public key")
+	ErrInvalidPrivateKey = errors.New("invalid private key")
+)
+
+var Context = []string{ContextActivityStreams, ContextSecurity}
+
+type (
+	Actor struct {
+		Context                   any        `json:"@context,omitempty"`
+		ID                        string     `json:"id"`
+		Type                      string     `json:"type"`
+		PreferredUsername         string     `json:"preferredUsername"`
+		Name                      string     `json:"name,omitempty"`
+		Summary                   string     `json:"summary,omitempty"`
+		URL                       string     `json:"url,omitempty"`
+		Icon                      *Image     `json:"icon,omitempty"`
+		Inbox                     string     `json:"inbox"`
+		Outbox                    string     `json:"outbox,omitempty"`
+		Followers                 string     `json:"followers,omitempty"`
+		ManuallyApprovesFollowers bool       `json:"manuallyApprovesFollowers"`
+		Discoverable              bool       `json:"discoverable"`
+		PublicKey                 PublicKey  `json:"publicKey"`
+		Endpoints                 *Endpoints `json:"endpoints,omitempty"`
+	}
+
+	PublicKey struct {
+		ID           string `json:"id"`
+		Owner        string `json:"owner"`
+		PublicKeyPEM string `json:"publicKeyPem"`
+	}
+
+	// Endpoints has the shared inbox of a server, activities for several actors of the server are delivered once to it.
+	Endpoints struct {
+		SharedInbox string `json:"sharedInbox,omitempty"`
+	}
+
+	Image struct {
+		Type      string `json:"type"`
+		MediaType string `json:"mediaType"`
+		URL       string `json:"url"`
+	}
+
+	// Note is a post, Summary is shown as content warning before the content.
+	Note struct {
+		Context      any       `json:"@context,omitempty"`
+		ID           string    `json:"id"`
+		Type         string    `json:"type"`
+		AttributedTo string    `json:"attributedTo,omitempty"`
+		Summary      string    `json:"summary,omitempty"`
+		Sensitive    bool      `json:"sensitive"`
+		Content      string    `json:"content,omitempty"`
+		URL          string    `json:"url,omitempty"`
+		Published    time.Time `json:"published,omitzero"`
+		To           []string  `json:"to,omitempty"`
+		CC           []string  `json:"cc,omitempty"`
+	}
+
+	// Tombstone replaces deleted objects.
+	Tombstone struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	}
+
+	// Activity is any activity, the object is either the id of an object or the object itself.
+	Activity struct {
+		Context   any             `json:"@context,omitempty"`
+		ID        string          `json:"id"`
+		Type      string          `json:"type"`
+		Actor     string          `json:"actor"`
+		Object    json.RawMessage `json:"object"`
+		Published time.Time       `json:"published,omitzero"`
+		To        []string        `json:"to,omitempty"`
+		CC        []string        `json:"cc,omitempty"`
+	}
+
+	OrderedCollection struct {
+		Context      any        `json:"@context,omitempty"`
+		ID           string     `json:"id"`
+		Type         string     `json:"type"`
+		TotalItems   int        `json:"totalItems"`
+		OrderedItems []Activity `json:"orderedItems,omitempty"`
+	}
+
+	// WebFinger resolves accounts like @gobin@xgob.in to their actor.
+	WebFinger struct {
+		Subject string          `json:"subject"`
+		Aliases []string        `json:"aliases,omitempty"`
+		Links   []WebFingerLink `json:"links"`
+	}
+
+	WebFingerLink struct {
+		Rel  string `json:"rel"`
+		Type string `json:"type,omitempty"`
+		Href string `json:"href"`
+	}
+)
+
+// NewActivity returns an activity of the actor with the object, which is marshalled to json.
+func NewActivity(id string, activityType string, actor string, object any) (Activity, error) {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return Activity{}, fmt.Errorf("failed to marshal activity object: %w", err)
+	}
+	return Activity{
+		Context: ContextActivityStreams,
+		ID:      id,
+		Type:    activityType,
+		Actor:   actor,
+		Object:  data,
+	}, nil
+}
+
+// ObjectID returns the id of the object of the activity, which is either the object itself or its id field.
+func (a Activity) ObjectID() string {
+	var id string
+	if err := json.Unmarshal(a.Object, &id); err == nil {
+		return id
+	}
+	var object struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal(a.Object, &object)
+	return object.ID
+}
+
+// InnerActivity returns the object of the activity as activity, like the Follow of an Undo.
+func (a Activity) InnerActivity() (Activity, error) {
+	var activity Activity
+	if err := json.Unmarshal(a.Object, &activity); err != nil {
+		return Activity{}, fmt.Errorf("failed to decode inner activity: %w", err)
+	}
+	return activity, nil
+}
+
+// LoadOrCreatePrivateKey reads the PEM encoded RSA private key from the file or creates the file with a new key.
+func LoadOrCreatePrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err := rsa.GenerateKey(rand.Reader, privateKeySize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate private key: %w", err)
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal private key: %w", err)
+		}
+		if err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: privateKeyPEMType, Bytes: der}), 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write private key: %w", err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidPrivateKey
+	}
+	switch block.Type {
+	case rsaPrivateKeyPEMType:
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case privateKeyPEMType:
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, ErrInvalidPrivateKey
+		}
+		return rsaKey, nil
+	}
+	return nil, ErrInvalidPrivateKey
+}
+
+// PublicKeyPEM returns the PEM encoded public key of the private key.
+func PublicKeyPEM(key *rsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: publicKeyPEMType, Bytes: der})), nil
+}
+
+// ParsePublicKeyPEM parses the PEM encoded RSA public key of an actor.
+func ParsePublicKeyPEM(data string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, ErrInvalidPublicKey
+	}
+	switch block.Type {
+	case rsaPublicKeyPEMType:
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case publicKeyPEMType:
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, ErrInvalidPublicKey
+		}
+		return rsaKey, nil
+	}
+	return nil, ErrInvalidPublicKey
+}
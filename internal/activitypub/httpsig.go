@@ -0,0 +1,166 @@
+package activitypub
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderSignature = "Signature"
+	HeaderDigest    = "Digest"
+
+	signatureAlgorithm = "rsa-sha256"
+	// signatureMaxSkew is how far the Date header of signed requests may be off.
+	signatureMaxSkew = time.Hour
+)
+
+var (
+	ErrMissingSignature  = errors.New("missing http signature")
+	ErrInvalidSignature  = errors.New("invalid http signature")
+	ErrSignatureExpired  = errors.New("http signature date is too far off")
+	ErrDigestMismatch    = errors.New("body does not match digest")
+	ErrUnsignedHeaders   = errors.New("http signature does not cover the required headers")
+	ErrUnsupportedDigest = errors.New("unsupported digest algorithm")
+)
+
+// Sign signs the request with an HTTP signature (draft-cavage-http-signatures-12) like Mastodon expects. Requests with a
+// body also get a Digest header, which is covered by the signature.
+func Sign(rq *http.Request, body []byte, keyID string, key *rsa.PrivateKey) error {
+	rq.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	if rq.Host == "" {
+		rq.Host = rq.URL.Host
+	}
+
+	headers := []string{"(request-target)", "host", "date"}
+	if body != nil {
+		sum := sha256.Sum256(body)
+		rq.Header.Set(HeaderDigest, "SHA-256="+base64.StdEncoding.EncodeToString(sum[:]))
+		headers = append(headers, "digest")
+	}
+
+	sum := sha256.Sum256([]byte(signingString(rq, headers)))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	rq.Header.Set(HeaderSignature, fmt.Sprintf(`keyId="%s",algorithm="%s",headers="%s",signature="%s"`,
+		keyID,
+		signatureAlgorithm,
+		strings.Join(headers, " "),
+		base64.StdEncoding.EncodeToString(signature),
+	))
+	return nil
+}
+
+// Verify verifies the HTTP signature of the request and the digest of its body and returns the key id it was signed
+// with. The public key of the key id is looked up with publicKey.
+func Verify(ctx context.Context, rq *http.Request, body []byte, publicKey func(ctx context.Context, keyID string) (*rsa.PublicKey, error)) (string, error) {
+	params := parseSignature(rq.Header.Get(HeaderSignature))
+	keyID, signatureStr := params["keyId"], params["signature"]
+	if keyID == "" || signatureStr == "" {
+		return "", ErrMissingSignature
+	}
+	if algorithm := params["algorithm"]; algorithm != "" && algorithm != signatureAlgorithm && algorithm != "hs2019" {
+		return "", ErrInvalidSignature
+	}
+
+	headers := []string{"date"}
+	if headersStr := params["headers"]; headersStr != "" {
+		headers = strings.Fields(strings.ToLower(headersStr))
+	}
+	required := []string{"(request-target)", "host", "date"}
+	if len(body) > 0 {
+		required = append(required, "digest")
+	}
+	for _, header := range required {
+		if !slices.Contains(headers, header) {
+			return "", ErrUnsignedHeaders
+		}
+	}
+
+	date, err := http.ParseTime(rq.Header.Get("Date"))
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+	if since := time.Since(date); since > signatureMaxSkew || since < -signatureMaxSkew {
+		return "", ErrSignatureExpired
+	}
+
+	if len(body) > 0 {
+		algorithm, digest, _ := strings.Cut(rq.Header.Get(HeaderDigest), "=")
+		if !strings.EqualFold(algorithm, "SHA-256") {
+			return "", ErrUnsupportedDigest
+		}
+		sum := sha256.Sum256(body)
+		if digest != base64.StdEncoding.EncodeToString(sum[:]) {
+			return "", ErrDigestMismatch
+		}
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(signatureStr)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+	key, err := publicKey(ctx, keyID)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(signingString(rq, headers)))
+	if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], signature); err != nil {
+		return "", ErrInvalidSignature
+	}
+	return keyID, nil
+}
+
+func signingString(rq *http.Request, headers []string) string {
+	lines := make([]string, len(headers))
+	for i, header := range headers {
+		var value string
+		switch header {
+		case "(request-target)":
+			value = strings.ToLower(rq.Method) + " " + rq.URL.RequestURI()
+		case "host":
+			value = rq.Host
+		default:
+			value = strings.Join(rq.Header.Values(header), ", ")
+		}
+		lines[i] = header + ": " + value
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseSignature parses the parameters of the Signature header like keyId="...",signature="...".
+func parseSignature(header string) map[string]string {
+	params := make(map[string]string)
+	for header != "" {
+		var param string
+		key, rest, ok := strings.Cut(header, "=")
+		if !ok {
+			break
+		}
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end == -1 {
+				break
+			}
+			param, rest = rest[1:end+1], rest[end+2:]
+		} else {
+			param, rest, _ = strings.Cut(rest, ",")
+		}
+		params[strings.TrimSpace(key)] = param
+		header = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+	return params
+}
@@ -10,13 +10,17 @@ import (
 	"github.com/topi314/gobin/v3/internal/env"
 )
 
-func Update(f func(map[string]string)) (string, error) {
-	configPath := viper.ConfigFileUsed()
-	if configPath == "" {
-		home, _ := os.UserHomeDir()
-		configPath = filepath.Join(home, ".gobin")
+// Path returns the path of the gobin env, which is the --config file or ~/.gobin.
+func Path() string {
+	if configPath := viper.ConfigFileUsed(); configPath != "" {
+		return configPath
 	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".gobin")
+}
 
+func Update(f func(map[string]string)) (string, error) {
+	configPath := Path()
 	cfgFile, err := os.OpenFile(configPath, os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
 		return "", err
@@ -42,12 +46,7 @@ func Update(f func(map[string]string)) (string, error) {
 }
 
 func Get() (map[string]string, error) {
-	configPath := viper.ConfigFileUsed()
-	if configPath == "" {
-		home, _ := os.UserHomeDir()
-		configPath = filepath.Join(home, ".gobin")
-	}
-
+	configPath := Path()
 	cfgFile, err := os.OpenFile(configPath, os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,219 @@
+// Package crypt encrypts secrets and file contents which are stored in the database with envelope encryption. Every secret is encrypted
+// with its own random data key using AES-256-GCM and the data key is encrypted with the key encryption key, which is
+// either derived from a configured secret or kept in a KMS.
+package crypt
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Prefix marks encrypted values, values without it are plaintext stored before they were encrypted.
+const Prefix = "enc:v1:"
+
+// maxCachedKeys limits the decrypted data keys which are cached, so values which are read often like file contents
+// don't need a KMS request every time.
+const maxCachedKeys = 1024
+
+var (
+	ErrDecrypt    = errors.New("failed to decrypt, the key encryption key may have changed")
+	ErrUnknownKey = errors.New("secret was encrypted with another key encryption key")
+	ErrNoKey      = errors.New("no key encryption key configured")
+)
+
+// KeyEncrypter encrypts the data keys of secrets with the key encryption key.
+type KeyEncrypter interface {
+	// ID identifies the key encryption key, it's stored with every secret.
+	ID() string
+	WrapKey(ctx context.Context, key []byte) ([]byte, error)
+	UnwrapKey(ctx context.Context, wrappedKey []byte) ([]byte, error)
+}
+
+// New returns an Envelope which encrypts the data keys with the KeyEncrypter.
+func New(kek KeyEncrypter) *Envelope {
+	return &Envelope{
+		kek:  kek,
+		keys: make(map[string][]byte),
+	}
+}
+
+type Envelope struct {
+	kek KeyEncrypter
+
+	mu sync.Mutex
+	// keys are the decrypted data keys by their encrypted data key.
+	keys map[string][]byte
+}
+
+// IsEncrypted reports whether the value was encrypted by an Envelope.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// Encrypt encrypts the plaintext with a new data key. The result has the format
+// enc:v1:{key id}:{base64 encrypted data key}:{base64 nonce and ciphertext}.
+func (e *Envelope) Encrypt(ctx context.Context, plaintext string) (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(key, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	wrappedKey, err := e.kek.WrapKey(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt data key: %w", err)
+	}
+
+	return Prefix + e.kek.ID() + ":" + base64.StdEncoding.EncodeToString(wrappedKey) + ":" + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt decrypts a value of Encrypt. Plaintext values are returned as they are.
+func (e *Envelope) Decrypt(ctx context.Context, value string) (string, error) {
+	encrypted, ok := strings.CutPrefix(value, Prefix)
+	if !ok {
+		return value, nil
+	}
+
+	parts := strings.Split(encrypted, ":")
+	if len(parts) != 3 {
+		return "", ErrDecrypt
+	}
+	if parts[0] != e.kek.ID() {
+		return "", ErrUnknownKey
+	}
+	wrappedKey, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrDecrypt
+	}
+
+	key, err := e.unwrapKey(ctx, parts[1], wrappedKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(key, ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func (e *Envelope) unwrapKey(ctx context.Context, cacheKey string, wrappedKey []byte) ([]byte, error) {
+	e.mu.Lock()
+	key, ok := e.keys[cacheKey]
+	e.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	key, err := e.kek.UnwrapKey(ctx, wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.keys) >= maxCachedKeys {
+		clear(e.keys)
+	}
+	e.keys[cacheKey] = key
+	return key, nil
+}
+
+// NewLocalKey returns a KeyEncrypter which derives the key encryption key from the secret.
+func NewLocalKey(secret string) KeyEncrypter {
+	key := sha256.Sum256([]byte(secret))
+	id := sha256.Sum256(key[:])
+	return &localKey{
+		key: key[:],
+		id:  "local-" + hex.EncodeToString(id[:4]),
+	}
+}
+
+// NewNoKey returns a KeyEncrypter for servers without a key encryption key, it fails to encrypt and decrypt secrets
+// instead of deriving a key everyone knows from an empty secret.
+func NewNoKey() KeyEncrypter {
+	return noKey{}
+}
+
+type noKey struct{}
+
+func (noKey) ID() string {
+	return "none"
+}
+
+func (noKey) WrapKey(_ context.Context, _ []byte) ([]byte, error) {
+	return nil, ErrNoKey
+}
+
+func (noKey) UnwrapKey(_ context.Context, _ []byte) ([]byte, error) {
+	return nil, ErrNoKey
+}
+
+type localKey struct {
+	key []byte
+	id  string
+}
+
+func (k *localKey) ID() string {
+	return k.id
+}
+
+func (k *localKey) WrapKey(_ context.Context, key []byte) ([]byte, error) {
+	return seal(k.key, key)
+}
+
+func (k *localKey) UnwrapKey(_ context.Context, wrappedKey []byte) ([]byte, error) {
+	return open(k.key, wrappedKey)
+}
+
+// seal encrypts the plaintext with AES-256-GCM, the random nonce is prepended to the ciphertext.
+func seal(key []byte, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key []byte, ciphertext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
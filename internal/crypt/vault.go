@@ -0,0 +1,104 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+)
+
+// VaultConfig is a key of the transit secrets engine of HashiCorp Vault or OpenBao, see
+// https://developer.hashicorp.com/vault/docs/secrets/transit.
+type VaultConfig struct {
+	Address string
+	Token   string
+	// TokenFunc returns the token instead of Token if it is set, it is used for tokens which change while running.
+	TokenFunc func() string
+	Namespace string
+	// Mount is the path of the transit secrets engine.
+	Mount   string
+	KeyName string
+}
+
+// NewVaultKey returns a KeyEncrypter which encrypts the data keys with the transit secrets engine of Vault, so the key
+// encryption key never leaves Vault.
+func NewVaultKey(cfg VaultConfig, client *http.Client) KeyEncrypter {
+	return &vaultKey{
+		cfg:    cfg,
+		client: client,
+	}
+}
+
+type vaultKey struct {
+	cfg    VaultConfig
+	client *http.Client
+}
+
+func (k *vaultKey) ID() string {
+	return "vault-" + k.cfg.KeyName
+}
+
+func (k *vaultKey) WrapKey(ctx context.Context, key []byte) ([]byte, error) {
+	var rs struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	if err := k.do(ctx, "encrypt", map[string]string{"plaintext": base64.StdEncoding.EncodeToString(key)}, &rs); err != nil {
+		return nil, err
+	}
+	return []byte(rs.Data.Ciphertext), nil
+}
+
+func (k *vaultKey) UnwrapKey(ctx context.Context, wrappedKey []byte) ([]byte, error) {
+	var rs struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	if err := k.do(ctx, "decrypt", map[string]string{"ciphertext": string(wrappedKey)}, &rs); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(rs.Data.Plaintext)
+}
+
+func (k *vaultKey) do(ctx context.Context, operation string, body any, v any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	endpoint := strings.TrimSuffix(k.cfg.Address, "/") + "/v1/" + strings.Trim(k.cfg.Mount, "/") + "/" + operation + "/" + url.PathEscape(k.cfg.KeyName)
+	rq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	rq.Header.Set(ezhttp.HeaderContentType, ezhttp.ContentTypeJSON)
+	token := k.cfg.Token
+	if k.cfg.TokenFunc != nil {
+		token = k.cfg.TokenFunc()
+	}
+	rq.Header.Set("X-Vault-Token", token)
+	if k.cfg.Namespace != "" {
+		rq.Header.Set("X-Vault-Namespace", k.cfg.Namespace)
+	}
+
+	rs, err := k.client.Do(rq)
+	if err != nil {
+		return fmt.Errorf("failed to %s with vault: %w", operation, err)
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(rs.Body, 1024))
+		return fmt.Errorf("failed to %s with vault: %s: %s", operation, rs.Status, bytes.TrimSpace(msg))
+	}
+	return json.NewDecoder(rs.Body).Decode(v)
+}
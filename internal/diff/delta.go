@@ -0,0 +1,157 @@
+package diff
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// maxDeltaLines limits the changed lines which are diffed line by line, larger changes replace all changed lines so
+// creating a delta stays fast.
+const maxDeltaLines = 10000
+
+var ErrInvalidDelta = errors.New("invalid delta")
+
+// Delta returns the changes from base to target which Patch applies to base again. Unlike Lines it keeps the line
+// endings, so the target is restored byte for byte. The delta consists of the operations "=n" to copy n lines of base,
+// "-n" to skip n lines of base and "+n" followed by n bytes to insert, each followed by a newline.
+func Delta(base string, target string) string {
+	a := splitLines(base)
+	b := splitLines(target)
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-suffix-1] == b[len(b)-suffix-1] {
+		suffix++
+	}
+
+	var d deltaWriter
+	d.op('=', prefix)
+	aMid := a[prefix : len(a)-suffix]
+	bMid := b[prefix : len(b)-suffix]
+	if len(aMid) > maxDeltaLines || len(bMid) > maxDeltaLines {
+		d.op('-', len(aMid))
+		d.insert(strings.Join(bMid, ""))
+	} else {
+		for _, edit := range Lines(aMid, bMid) {
+			switch edit.Op {
+			case OpEqual:
+				d.op('=', 1)
+			case OpDelete:
+				d.op('-', 1)
+			case OpInsert:
+				d.insert(edit.Text)
+			}
+		}
+	}
+	d.op('=', suffix)
+	return d.String()
+}
+
+// Patch applies a delta created by Delta to base.
+func Patch(base string, delta string) (string, error) {
+	a := splitLines(base)
+	var sb strings.Builder
+	line := 0
+	for delta != "" {
+		header, rest, ok := strings.Cut(delta, "\n")
+		if !ok || len(header) < 2 {
+			return "", ErrInvalidDelta
+		}
+		n, err := strconv.Atoi(header[1:])
+		if err != nil || n < 0 {
+			return "", ErrInvalidDelta
+		}
+		delta = rest
+
+		switch header[0] {
+		case '=':
+			if line+n > len(a) {
+				return "", ErrInvalidDelta
+			}
+			for _, l := range a[line : line+n] {
+				sb.WriteString(l)
+			}
+			line += n
+		case '-':
+			if line+n > len(a) {
+				return "", ErrInvalidDelta
+			}
+			line += n
+		case '+':
+			if n > len(delta) {
+				return "", ErrInvalidDelta
+			}
+			sb.WriteString(delta[:n])
+			delta = delta[n:]
+		default:
+			return "", ErrInvalidDelta
+		}
+	}
+	if line != len(a) {
+		return "", ErrInvalidDelta
+	}
+	return sb.String(), nil
+}
+
+// splitLines splits content into lines which keep their line endings.
+func splitLines(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// deltaWriter merges consecutive operations of the same kind.
+type deltaWriter struct {
+	sb   strings.Builder
+	kind byte
+	n    int
+	text strings.Builder
+}
+
+func (d *deltaWriter) op(op byte, n int) {
+	if n == 0 {
+		return
+	}
+	if d.kind != op {
+		d.flush()
+		d.kind = op
+	}
+	d.n += n
+}
+
+func (d *deltaWriter) insert(text string) {
+	if text == "" {
+		return
+	}
+	if d.kind != '+' {
+		d.flush()
+		d.kind = '+'
+	}
+	d.text.WriteString(text)
+}
+
+func (d *deltaWriter) flush() {
+	switch d.kind {
+	case '=', '-':
+		d.sb.WriteByte(d.kind)
+		d.sb.WriteString(strconv.Itoa(d.n))
+		d.sb.WriteByte('\n')
+	case '+':
+		d.sb.WriteString("+" + strconv.Itoa(d.text.Len()) + "\n")
+		d.sb.WriteString(d.text.String())
+		d.text.Reset()
+	}
+	d.kind = 0
+	d.n = 0
+}
+
+func (d *deltaWriter) String() string {
+	d.flush()
+	return d.sb.String()
+}
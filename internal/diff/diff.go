@@ -0,0 +1,239 @@
+package diff
+
+import (
+	"strings"
+)
+
+type Op int8
+
+const (
+	OpEqual Op = iota
+	OpInsert
+	OpDelete
+)
+
+func (o Op) String() string {
+	switch o {
+	case OpEqual:
+		return "equal"
+	case OpInsert:
+		return "insert"
+	case OpDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+func (o Op) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// Edit is a single line of a diff. OldLine and NewLine are 1-based, OldLine is 0 for inserts and NewLine is 0 for deletes.
+type Edit struct {
+	Op      Op     `json:"op"`
+	OldLine int    `json:"old_line,omitempty"`
+	NewLine int    `json:"new_line,omitempty"`
+	Text    string `json:"text"`
+}
+
+// Split splits content into lines. A trailing newline does not start a new line.
+func Split(content string) []string {
+	if content == "" {
+		return nil
+	}
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Lines computes the shortest line diff between a and b using Myers' linear space algorithm.
+func Lines(a []string, b []string) []Edit {
+	// compare integers instead of strings
+	ids := make(map[string]int)
+	d := &differ{
+		a:     toIDs(ids, a),
+		b:     toIDs(ids, b),
+		aText: a,
+		bText: b,
+		edits: make([]Edit, 0, max(len(a), len(b))),
+	}
+	d.compare(0, len(a), 0, len(b))
+	return d.edits
+}
+
+func toIDs(ids map[string]int, lines []string) []int {
+	result := make([]int, len(lines))
+	for i, line := range lines {
+		id, ok := ids[line]
+		if !ok {
+			id = len(ids)
+			ids[line] = id
+		}
+		result[i] = id
+	}
+	return result
+}
+
+type differ struct {
+	a, b         []int
+	aText, bText []string
+	edits        []Edit
+}
+
+func (d *differ) equal(aLo int, bLo int, n int) {
+	for i := range n {
+		d.edits = append(d.edits, Edit{Op: OpEqual, OldLine: aLo + i + 1, NewLine: bLo + i + 1, Text: d.bText[bLo+i]})
+	}
+}
+
+func (d *differ) compare(aLo int, aHi int, bLo int, bHi int) {
+	// common prefix
+	prefix := 0
+	for aLo+prefix < aHi && bLo+prefix < bHi && d.a[aLo+prefix] == d.b[bLo+prefix] {
+		prefix++
+	}
+	d.equal(aLo, bLo, prefix)
+	aLo += prefix
+	bLo += prefix
+
+	// common suffix, added after the middle part
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && d.a[aHi-suffix-1] == d.b[bHi-suffix-1] {
+		suffix++
+	}
+	aHi -= suffix
+	bHi -= suffix
+
+	switch {
+	case aLo == aHi:
+		for i := bLo; i < bHi; i++ {
+			d.edits = append(d.edits, Edit{Op: OpInsert, NewLine: i + 1, Text: d.bText[i]})
+		}
+	case bLo == bHi:
+		for i := aLo; i < aHi; i++ {
+			d.edits = append(d.edits, Edit{Op: OpDelete, OldLine: i + 1, Text: d.aText[i]})
+		}
+	default:
+		x, y, u, v := d.middleSnake(aLo, aHi, bLo, bHi)
+		d.compare(aLo, x, bLo, y)
+		d.equal(x, y, u-x)
+		d.compare(u, aHi, v, bHi)
+	}
+
+	d.equal(aHi, bHi, suffix)
+}
+
+// middleSnake finds the middle snake of the shortest edit script between a[aLo:aHi] and b[bLo:bHi] by searching
+// forward from the start and backward from the end at the same time. It returns the absolute start and end of the snake.
+func (d *differ) middleSnake(aLo int, aHi int, bLo int, bHi int) (int, int, int, int) {
+	n := aHi - aLo
+	m := bHi - bLo
+	delta := n - m
+	odd := delta%2 != 0
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+
+	// furthest reaching x on each diagonal, backward values are measured from the end
+	vf := make([]int, 2*maxD+3)
+	vb := make([]int, 2*maxD+3)
+
+	for step := 0; step <= maxD; step++ {
+		for k := -step; k <= step; k += 2 {
+			var x int
+			if k == -step || (k != step && vf[offset+k-1] < vf[offset+k+1]) {
+				x = vf[offset+k+1]
+			} else {
+				x = vf[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			vf[offset+k] = x
+
+			// the backward diagonal which corresponds to k
+			c := delta - k
+			if odd && c >= -(step-1) && c <= step-1 && x+vb[offset+c] >= n {
+				return aLo + startX, bLo + startY, aLo + x, bLo + y
+			}
+		}
+
+		for c := -step; c <= step; c += 2 {
+			var x int
+			if c == -step || (c != step && vb[offset+c-1] < vb[offset+c+1]) {
+				x = vb[offset+c+1]
+			} else {
+				x = vb[offset+c-1] + 1
+			}
+			y := x - c
+			startX, startY := x, y
+			for x < n && y < m && d.a[aHi-x-1] == d.b[bHi-y-1] {
+				x++
+				y++
+			}
+			vb[offset+c] = x
+
+			k := delta - c
+			if !odd && k >= -step && k <= step && x+vf[offset+k] >= n {
+				return aHi - x, bHi - y, aHi - startX, bHi - startY
+			}
+		}
+	}
+
+	// unreachable, the paths always overlap after at most maxD steps
+	return aLo, bLo, aLo, bLo
+}
+
+// Line is one side of a Row, Number is 1-based.
+type Line struct {
+	Number int    `json:"number"`
+	Text   string `json:"text"`
+	Op     Op     `json:"op"`
+}
+
+// Row is a single row of a side-by-side diff. Left or Right is nil if the line only exists on the other side.
+type Row struct {
+	Left  *Line `json:"left"`
+	Right *Line `json:"right"`
+}
+
+// SideBySide aligns the deleted and inserted lines of each change next to each other.
+func SideBySide(edits []Edit) []Row {
+	rows := make([]Row, 0, len(edits))
+	var deleted, inserted []*Line
+	flush := func() {
+		for i := range max(len(deleted), len(inserted)) {
+			var row Row
+			if i < len(deleted) {
+				row.Left = deleted[i]
+			}
+			if i < len(inserted) {
+				row.Right = inserted[i]
+			}
+			rows = append(rows, row)
+		}
+		deleted, inserted = deleted[:0], inserted[:0]
+	}
+
+	for _, edit := range edits {
+		switch edit.Op {
+		case OpDelete:
+			deleted = append(deleted, &Line{Number: edit.OldLine, Text: edit.Text, Op: OpDelete})
+		case OpInsert:
+			inserted = append(inserted, &Line{Number: edit.NewLine, Text: edit.Text, Op: OpInsert})
+		default:
+			flush()
+			rows = append(rows, Row{
+				Left:  &Line{Number: edit.OldLine, Text: edit.Text, Op: OpEqual},
+				Right: &Line{Number: edit.NewLine, Text: edit.Text, Op: OpEqual},
+			})
+		}
+	}
+	flush()
+	return rows
+}
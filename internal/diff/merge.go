@@ -0,0 +1,90 @@
+package diff
+
+import (
+	"slices"
+)
+
+// Chunk is a part of a three-way merge. Resolved chunks only contain Lines, conflicting chunks contain the lines of
+// the base and both sides instead.
+type Chunk struct {
+	Conflict bool
+	Lines    []string
+	Base     []string
+	Ours     []string
+	Theirs   []string
+}
+
+// Merge3 applies the changes from base to ours and from base to theirs. Changes which only happened on one side or
+// are identical on both sides are taken, overlapping changes are returned as conflicts.
+func Merge3(base []string, ours []string, theirs []string) []Chunk {
+	matchOurs := matches(base, ours)
+	matchTheirs := matches(base, theirs)
+
+	var chunks []Chunk
+	add := func(lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		if len(chunks) > 0 && !chunks[len(chunks)-1].Conflict {
+			chunks[len(chunks)-1].Lines = append(chunks[len(chunks)-1].Lines, lines...)
+			return
+		}
+		chunks = append(chunks, Chunk{Lines: slices.Clone(lines)})
+	}
+
+	var b, o, t int
+	for b < len(base) || o < len(ours) || t < len(theirs) {
+		// lines which are unchanged on both sides
+		start := b
+		for b < len(base) && matchOurs[b] == o && matchTheirs[b] == t {
+			b++
+			o++
+			t++
+		}
+		if b > start {
+			add(base[start:b])
+			continue
+		}
+
+		// the changed region ends at the next base line which still exists on both sides
+		end := b
+		for end < len(base) && (matchOurs[end] == -1 || matchTheirs[end] == -1) {
+			end++
+		}
+		oursEnd, theirsEnd := len(ours), len(theirs)
+		if end < len(base) {
+			oursEnd, theirsEnd = matchOurs[end], matchTheirs[end]
+		}
+
+		baseLines, oursLines, theirsLines := base[b:end], ours[o:oursEnd], theirs[t:theirsEnd]
+		switch {
+		case slices.Equal(oursLines, baseLines):
+			add(theirsLines)
+		case slices.Equal(theirsLines, baseLines), slices.Equal(oursLines, theirsLines):
+			add(oursLines)
+		default:
+			chunks = append(chunks, Chunk{
+				Conflict: true,
+				Base:     slices.Clone(baseLines),
+				Ours:     slices.Clone(oursLines),
+				Theirs:   slices.Clone(theirsLines),
+			})
+		}
+		b, o, t = end, oursEnd, theirsEnd
+	}
+	return chunks
+}
+
+// matches returns the 0-based line in b for each line in a, or -1 if the line was removed.
+func matches(a []string, b []string) []int {
+	result := make([]int, len(a))
+	for i := range result {
+		result[i] = -1
+	}
+	for _, edit := range Lines(a, b) {
+		if edit.Op == OpEqual {
+			result[edit.OldLine-1] = edit.NewLine - 1
+		}
+	}
+	return result
+}
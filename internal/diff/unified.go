@@ -0,0 +1,103 @@
+package diff
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Hunk is a group of changed lines with the unchanged lines around them. OldStart and NewStart are the 1-based first
+// line of the hunk on each side.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Edits    []Edit
+}
+
+// Hunks groups the changes of edits with up to context unchanged lines before and after them. Changes which share
+// their context are merged into one hunk.
+func Hunks(edits []Edit, context int) []Hunk {
+	include := make([]bool, len(edits))
+	for i, edit := range edits {
+		if edit.Op == OpEqual {
+			continue
+		}
+		for j := max(i-context, 0); j <= min(i+context, len(edits)-1); j++ {
+			include[j] = true
+		}
+	}
+
+	var (
+		hunks   []Hunk
+		hunk    *Hunk
+		oldLine = 1
+		newLine = 1
+	)
+	for i, edit := range edits {
+		if !include[i] {
+			hunk = nil
+		} else {
+			if hunk == nil {
+				hunks = append(hunks, Hunk{OldStart: oldLine, NewStart: newLine})
+				hunk = &hunks[len(hunks)-1]
+			}
+			hunk.Edits = append(hunk.Edits, edit)
+			if edit.Op != OpInsert {
+				hunk.OldLines++
+			}
+			if edit.Op != OpDelete {
+				hunk.NewLines++
+			}
+		}
+
+		if edit.Op != OpInsert {
+			oldLine++
+		}
+		if edit.Op != OpDelete {
+			newLine++
+		}
+	}
+	return hunks
+}
+
+// Unified formats the edits from oldName to newName as a unified diff with context unchanged lines around each change.
+// It returns an empty string if nothing changed.
+func Unified(oldName string, newName string, edits []Edit, context int) string {
+	hunks := Hunks(edits, context)
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	for _, hunk := range hunks {
+		_, _ = fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(hunk.OldStart, hunk.OldLines), hunkRange(hunk.NewStart, hunk.NewLines))
+		for _, edit := range hunk.Edits {
+			switch edit.Op {
+			case OpInsert:
+				b.WriteByte('+')
+			case OpDelete:
+				b.WriteByte('-')
+			default:
+				b.WriteByte(' ')
+			}
+			b.WriteString(edit.Text)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// hunkRange formats the lines of one side of a hunk header. Empty sides refer to the line before the hunk.
+func hunkRange(start int, lines int) string {
+	switch lines {
+	case 0:
+		return strconv.Itoa(start-1) + ",0"
+	case 1:
+		return strconv.Itoa(start)
+	default:
+		return strconv.Itoa(start) + "," + strconv.Itoa(lines)
+	}
+}
@@ -0,0 +1,202 @@
+package ezhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// HAR records requests and responses in the HTTP Archive format (http://www.softwareishard.com/blog/har-12-spec/),
+// which browsers and HTTP debugging tools can open.
+type HAR struct {
+	creator harCreator
+	mu      sync.Mutex
+	entries []harEntry
+}
+
+type (
+	harFile struct {
+		Log harLog `json:"log"`
+	}
+
+	harLog struct {
+		Version string     `json:"version"`
+		Creator harCreator `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	}
+
+	harCreator struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+
+	harEntry struct {
+		StartedDateTime time.Time   `json:"startedDateTime"`
+		Time            float64     `json:"time"`
+		Request         harRequest  `json:"request"`
+		Response        harResponse `json:"response"`
+		Cache           struct{}    `json:"cache"`
+		Timings         harTimings  `json:"timings"`
+		Comment         string      `json:"comment,omitempty"`
+	}
+
+	harRequest struct {
+		Method      string         `json:"method"`
+		URL         string         `json:"url"`
+		HTTPVersion string         `json:"httpVersion"`
+		Cookies     []harNameValue `json:"cookies"`
+		Headers     []harNameValue `json:"headers"`
+		QueryString []harNameValue `json:"queryString"`
+		PostData    *harPostData   `json:"postData,omitempty"`
+		HeadersSize int            `json:"headersSize"`
+		BodySize    int            `json:"bodySize"`
+	}
+
+	harResponse struct {
+		Status      int            `json:"status"`
+		StatusText  string         `json:"statusText"`
+		HTTPVersion string         `json:"httpVersion"`
+		Cookies     []harNameValue `json:"cookies"`
+		Headers     []harNameValue `json:"headers"`
+		Content     harContent     `json:"content"`
+		RedirectURL string         `json:"redirectURL"`
+		HeadersSize int            `json:"headersSize"`
+		BodySize    int            `json:"bodySize"`
+	}
+
+	harNameValue struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+
+	harPostData struct {
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+	}
+
+	harContent struct {
+		Size     int    `json:"size"`
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text,omitempty"`
+	}
+
+	harTimings struct {
+		Send    float64 `json:"send"`
+		Wait    float64 `json:"wait"`
+		Receive float64 `json:"receive"`
+	}
+)
+
+// NewHAR returns an empty HAR of the program with the name and version.
+func NewHAR(name string, version string) *HAR {
+	return &HAR{
+		creator: harCreator{
+			Name:    name,
+			Version: version,
+		},
+	}
+}
+
+// Len returns the number of recorded requests.
+func (h *HAR) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.entries)
+}
+
+// WriteFile writes the recorded requests to the file.
+func (h *HAR) WriteFile(path string) error {
+	h.mu.Lock()
+	data, err := json.MarshalIndent(harFile{
+		Log: harLog{
+			Version: "1.2",
+			Creator: h.creator,
+			Entries: h.entries,
+		},
+	}, "", "  ")
+	h.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode har: %w", err)
+	}
+	if err = os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write har: %w", err)
+	}
+	return nil
+}
+
+// add records a request and its response, failed requests have no response but the error as comment.
+func (h *HAR) add(start time.Time, duration time.Duration, rq *http.Request, rqBody string, rs *http.Response, rsBody string, err error) {
+	if h == nil {
+		return
+	}
+
+	query := rq.URL.Query()
+	redactQuery(query)
+	entry := harEntry{
+		StartedDateTime: start,
+		Time:            float64(duration.Microseconds()) / 1000,
+		Request: harRequest{
+			Method:      rq.Method,
+			URL:         RedactURL(rq.URL),
+			HTTPVersion: rq.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(RedactHeader(rq.Header)),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Response: harResponse{
+			Cookies:     []harNameValue{},
+			Headers:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Timings: harTimings{
+			Wait: float64(duration.Microseconds()) / 1000,
+		},
+	}
+	for name, values := range query {
+		for _, value := range values {
+			entry.Request.QueryString = append(entry.Request.QueryString, harNameValue{Name: name, Value: value})
+		}
+	}
+	if rqBody != "" {
+		entry.Request.PostData = &harPostData{
+			MimeType: rq.Header.Get(HeaderContentType),
+			Text:     rqBody,
+		}
+	}
+
+	if err != nil {
+		entry.Comment = err.Error()
+	}
+	if rs != nil {
+		entry.Response.Status = rs.StatusCode
+		entry.Response.StatusText = http.StatusText(rs.StatusCode)
+		entry.Response.HTTPVersion = rs.Proto
+		entry.Response.Headers = harHeaders(RedactHeader(rs.Header))
+		entry.Response.RedirectURL = rs.Header.Get("Location")
+		entry.Response.Content = harContent{
+			Size:     len(rsBody),
+			MimeType: rs.Header.Get(HeaderContentType),
+			Text:     rsBody,
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append(h.entries, entry)
+}
+
+func harHeaders(header http.Header) []harNameValue {
+	headers := make([]harNameValue, 0, len(header))
+	for name, values := range header {
+		for _, value := range values {
+			headers = append(headers, harNameValue{Name: name, Value: value})
+		}
+	}
+	return headers
+}
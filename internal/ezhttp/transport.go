@@ -0,0 +1,231 @@
+package ezhttp
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultMaxDumpBodySize is how much of a body Transport logs and records by default.
+const DefaultMaxDumpBodySize = 64 * 1024
+
+const redacted = "[redacted]"
+
+var (
+	redactedHeaders     = []string{HeaderAuthorization, "Cookie", "Set-Cookie", HeaderWebhookSignature, HeaderSignature256}
+	redactedQueryParams = []string{"token", "signature", "secret", "code"}
+	// redactedJSONFields matches the values of JSON fields with tokens and secrets like "token": "...".
+	redactedJSONFields = regexp.MustCompile(`("(?:token|secret|access_token|refresh_token|client_secret|device_code|user_code)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+)
+
+// Transport is a http.RoundTripper which logs every request with slog. With Dump the headers and bodies of requests
+// and responses are logged at debug level too. HAR records the requests and responses. Tokens and secrets are redacted
+// in both, so the output can be attached to bug reports.
+type Transport struct {
+	// Base sends the requests, it defaults to http.DefaultTransport.
+	Base   http.RoundTripper
+	Logger *slog.Logger
+	Dump   bool
+	HAR    *HAR
+	// MaxBodySize is how much of a body is logged and recorded, it defaults to DefaultMaxDumpBodySize.
+	MaxBodySize int
+}
+
+func (t *Transport) RoundTrip(rq *http.Request) (*http.Response, error) {
+	ctx := rq.Context()
+	logger := t.logger()
+	start := time.Now()
+	rqURL := RedactURL(rq.URL)
+
+	var rqBody string
+	if t.Dump || t.HAR != nil {
+		rqBody = t.requestBody(rq)
+	}
+	if t.Dump {
+		logger.DebugContext(ctx, "http request",
+			slog.String("method", rq.Method),
+			slog.String("url", rqURL),
+			slog.Any("headers", RedactHeader(rq.Header)),
+			slog.String("body", rqBody),
+		)
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	rs, err := base.RoundTrip(rq)
+	if err != nil {
+		logger.InfoContext(ctx, "http request failed",
+			slog.String("method", rq.Method),
+			slog.String("url", rqURL),
+			slog.Duration("duration", time.Since(start)),
+			slog.Any("err", err),
+		)
+		t.HAR.add(start, time.Since(start), rq, rqBody, nil, "", err)
+		return nil, err
+	}
+
+	logger.InfoContext(ctx, "http request",
+		slog.String("method", rq.Method),
+		slog.String("url", rqURL),
+		slog.Int("status", rs.StatusCode),
+		slog.Duration("duration", time.Since(start)),
+	)
+	if !t.Dump && t.HAR == nil {
+		return rs, nil
+	}
+
+	// the body is logged once it was read, so streamed responses like server-sent events are not blocked
+	rs.Body = &recordingBody{
+		ReadCloser: rs.Body,
+		maxSize:    t.maxBodySize(),
+		onClose: func(body string) {
+			if t.Dump {
+				logger.DebugContext(ctx, "http response",
+					slog.String("method", rq.Method),
+					slog.String("url", rqURL),
+					slog.Int("status", rs.StatusCode),
+					slog.Any("headers", RedactHeader(rs.Header)),
+					slog.String("body", body),
+				)
+			}
+			t.HAR.add(start, time.Since(start), rq, rqBody, rs, body, nil)
+		},
+	}
+	return rs, nil
+}
+
+func (t *Transport) logger() *slog.Logger {
+	if t.Logger == nil {
+		return slog.Default()
+	}
+	return t.Logger
+}
+
+func (t *Transport) maxBodySize() int {
+	if t.MaxBodySize <= 0 {
+		return DefaultMaxDumpBodySize
+	}
+	return t.MaxBodySize
+}
+
+// requestBody returns a copy of the request body, streamed bodies can only be read once and are not copied.
+func (t *Transport) requestBody(rq *http.Request) string {
+	if rq.Body == nil || rq.Body == http.NoBody {
+		return ""
+	}
+	if rq.GetBody == nil {
+		return "[streamed body]"
+	}
+	body, err := rq.GetBody()
+	if err != nil {
+		return "[streamed body]"
+	}
+	defer body.Close()
+
+	maxSize := t.maxBodySize()
+	data, _ := io.ReadAll(io.LimitReader(body, int64(maxSize)+1))
+	return formatBody(data, maxSize)
+}
+
+type recordingBody struct {
+	io.ReadCloser
+	maxSize int
+	buf     bytes.Buffer
+	once    sync.Once
+	onClose func(body string)
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if remaining := b.maxSize + 1 - b.buf.Len(); remaining > 0 {
+		b.buf.Write(p[:min(n, remaining)])
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.onClose(formatBody(b.buf.Bytes(), b.maxSize))
+	})
+	return err
+}
+
+// formatBody redacts the body and cuts it at maxSize bytes, binary bodies are replaced with their size.
+func formatBody(data []byte, maxSize int) string {
+	size := len(data)
+	truncated := size > maxSize
+	if truncated {
+		data = data[:maxSize]
+		// the cut can split the last rune
+		for i := 0; i < utf8.UTFMax-1 && !utf8.Valid(data); i++ {
+			data = data[:len(data)-1]
+		}
+	}
+	if !utf8.Valid(data) {
+		if truncated {
+			return "[binary data]"
+		}
+		return "[" + strconv.Itoa(size) + " bytes of binary data]"
+	}
+	body := RedactBody(string(data))
+	if truncated {
+		body += "... [truncated]"
+	}
+	return body
+}
+
+// RedactHeader returns a copy of the header without the values of headers with tokens and secrets. The scheme of the
+// Authorization header is kept.
+func RedactHeader(header http.Header) http.Header {
+	header = header.Clone()
+	for _, name := range redactedHeaders {
+		values := header.Values(name)
+		for i, value := range values {
+			if scheme, _, ok := strings.Cut(value, " "); ok && name == HeaderAuthorization {
+				values[i] = scheme + " " + redacted
+				continue
+			}
+			values[i] = redacted
+		}
+	}
+	return header
+}
+
+// RedactURL returns the url without the values of query parameters with tokens and secrets.
+func RedactURL(u *url.URL) string {
+	query := u.Query()
+	if !redactQuery(query) {
+		return u.String()
+	}
+	redactedURL := *u
+	redactedURL.RawQuery = query.Encode()
+	return redactedURL.String()
+}
+
+// redactQuery replaces the values of query parameters with tokens and secrets and reports whether it replaced any.
+func redactQuery(query url.Values) bool {
+	changed := false
+	for _, param := range redactedQueryParams {
+		if query.Has(param) {
+			query.Set(param, redacted)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// RedactBody replaces the values of JSON fields with tokens and secrets.
+func RedactBody(body string) string {
+	return redactedJSONFields.ReplaceAllString(body, `${1}"`+redacted+`"`)
+}
@@ -0,0 +1,199 @@
+// Package gist is a minimal client for the gists of the GitHub REST API.
+package gist
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultAPIURL is the API of github.com, GitHub Enterprise Server uses https://{host}/api/v3.
+const DefaultAPIURL = "https://api.github.com"
+
+var (
+	ErrInvalidID       = errors.New("invalid gist id or url")
+	ErrNotFound        = errors.New("gist not found")
+	ErrContentTooLarge = errors.New("gist file content too large")
+)
+
+// StatusError is returned for every unsuccessful response of the API except 404 Not Found.
+type StatusError struct {
+	Status  int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("github returned status %d", e.Status)
+	}
+	return fmt.Sprintf("github returned status %d: %s", e.Status, e.Message)
+}
+
+type (
+	Gist struct {
+		ID          string `json:"id"`
+		HTMLURL     string `json:"html_url"`
+		Description string `json:"description"`
+		Public      bool   `json:"public"`
+		// Files are keyed by their file name.
+		Files map[string]File `json:"files"`
+	}
+
+	File struct {
+		Filename string `json:"filename"`
+		Language string `json:"language"`
+		RawURL   string `json:"raw_url"`
+		Size     int64  `json:"size"`
+		// Truncated is true if the content was cut off, the full content has to be downloaded from RawURL.
+		Truncated bool   `json:"truncated"`
+		Content   string `json:"content"`
+	}
+)
+
+type (
+	// CreateRequest creates a new gist, it needs a token with the gist scope.
+	CreateRequest struct {
+		Description string `json:"description"`
+		Public      bool   `json:"public"`
+		// Files are keyed by their file name, their content can't be empty.
+		Files map[string]CreateFile `json:"files"`
+	}
+
+	CreateFile struct {
+		Content string `json:"content"`
+	}
+)
+
+// Client sends requests to the GitHub API, the token is optional for reading public and secret gists.
+type Client struct {
+	APIURL     string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// ParseID returns the id of a gist from its id, its gist.github.com url or its API url.
+func ParseID(gist string) (string, error) {
+	id := strings.TrimSpace(gist)
+	if uri, err := url.Parse(id); err == nil && uri.Host != "" {
+		segments := strings.Split(strings.Trim(uri.Path, "/"), "/")
+		// https://gist.github.com/{id}, https://gist.github.com/{user}/{id}/{revision} or https://api.github.com/gists/{id}
+		id = segments[0]
+		if len(segments) >= 2 {
+			id = segments[1]
+		}
+	}
+	id = strings.TrimSuffix(id, ".git")
+	if id == "" || strings.IndexFunc(id, func(r rune) bool {
+		return !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+	}) != -1 {
+		return "", ErrInvalidID
+	}
+	return id, nil
+}
+
+// Get returns the gist with the id.
+func (c *Client) Get(ctx context.Context, id string) (*Gist, error) {
+	var gist Gist
+	if err := c.do(ctx, http.MethodGet, "/gists/"+url.PathEscape(id), nil, &gist); err != nil {
+		return nil, err
+	}
+	return &gist, nil
+}
+
+// Create creates a new gist owned by the user of the token.
+func (c *Client) Create(ctx context.Context, createRq CreateRequest) (*Gist, error) {
+	body, err := json.Marshal(createRq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode gist: %w", err)
+	}
+
+	var gist Gist
+	if err = c.do(ctx, http.MethodPost, "/gists", bytes.NewReader(body), &gist); err != nil {
+		return nil, err
+	}
+	return &gist, nil
+}
+
+// GetContent downloads the full content of a truncated file. Content larger than maxSize returns ErrContentTooLarge,
+// a maxSize of 0 is unlimited.
+func (c *Client) GetContent(ctx context.Context, file File, maxSize int64) (string, error) {
+	rq, err := http.NewRequestWithContext(ctx, http.MethodGet, file.RawURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	rs, err := c.HTTPClient.Do(rq)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = rs.Body.Close()
+	}()
+
+	if rs.StatusCode != http.StatusOK {
+		return "", &StatusError{Status: rs.StatusCode}
+	}
+
+	reader := io.Reader(rs.Body)
+	if maxSize > 0 {
+		// reading one byte more tells whether the content is larger than the limit
+		reader = io.LimitReader(rs.Body, maxSize+1)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to read gist file %s: %w", file.Filename, err)
+	}
+	if maxSize > 0 && int64(len(data)) > maxSize {
+		return "", ErrContentTooLarge
+	}
+	return string(data), nil
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, body io.Reader, v any) error {
+	apiURL := c.APIURL
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	rq, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(apiURL, "/")+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	rq.Header.Set("Accept", "application/vnd.github+json")
+	rq.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if body != nil {
+		rq.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		rq.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	rs, err := c.HTTPClient.Do(rq)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rs.Body.Close()
+	}()
+
+	if rs.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if rs.StatusCode < 200 || rs.StatusCode >= 300 {
+		var errRs struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(io.LimitReader(rs.Body, 64*1024)).Decode(&errRs)
+		return &StatusError{Status: rs.StatusCode, Message: errRs.Message}
+	}
+
+	if err = json.NewDecoder(rs.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
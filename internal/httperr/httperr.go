@@ -62,6 +62,14 @@ func Forbidden(err error) error {
 	return New(err, http.StatusForbidden)
 }
 
+func Conflict(err error) error {
+	return New(err, http.StatusConflict)
+}
+
+func UnprocessableEntity(err error) error {
+	return New(err, http.StatusUnprocessableEntity)
+}
+
 func TooManyRequests(err error) error {
 	return New(err, http.StatusTooManyRequests)
 }
@@ -69,3 +77,7 @@ func TooManyRequests(err error) error {
 func InternalServerError(err error) error {
 	return New(err, http.StatusInternalServerError)
 }
+
+func BadGateway(err error) error {
+	return New(err, http.StatusBadGateway)
+}
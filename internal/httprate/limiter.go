@@ -1,67 +1,71 @@
 package httprate
 
 import (
+	"log/slog"
 	"math"
 	"net"
 	"net/http"
 	"strconv"
-	"sync"
 	"time"
 
 	"github.com/topi314/gobin/v3/internal/ezhttp"
 )
 
-func NewRateLimiter(requestLimit int, windowLength time.Duration, onRequestLimit http.HandlerFunc) *RateLimiter {
-	c := &counter{
-		counters:     make(map[uint64]*count),
-		windowLength: windowLength,
-		requestLimit: requestLimit,
-	}
-
-	go c.Cleanup()
+// KeyFunc returns the key of the bucket for the request.
+type KeyFunc func(r *http.Request) string
 
+// NewRateLimiter returns a rate limiter which allows requestLimit requests per windowLength for each key. The name
+// separates the buckets of rate limiters sharing a store.
+func NewRateLimiter(store Store, name string, requestLimit int, windowLength time.Duration, keyFunc KeyFunc, onRequestLimit http.HandlerFunc) *RateLimiter {
 	return &RateLimiter{
+		store:          store,
+		name:           name,
 		requestLimit:   requestLimit,
-		limitCounter:   c,
+		windowLength:   windowLength,
+		keyFunc:        keyFunc,
 		onRequestLimit: onRequestLimit,
 	}
 }
 
 type RateLimiter struct {
+	store          Store
+	name           string
 	requestLimit   int
-	limitCounter   *counter
+	windowLength   time.Duration
+	keyFunc        KeyFunc
 	onRequestLimit http.HandlerFunc
-	mu             sync.Mutex
 }
 
 func (l *RateLimiter) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		key := getKey(r)
+		result, err := l.store.Take(r.Context(), l.name+":"+l.keyFunc(r), l.requestLimit, l.windowLength)
+		if err != nil {
+			// requests are allowed while the store is unavailable, so it can't take down the server
+			slog.ErrorContext(r.Context(), "failed to take rate limit token", slog.String("rate_limit", l.name), slog.Any("err", err))
+			next.ServeHTTP(w, r)
+			return
+		}
 
-		l.mu.Lock()
-		ok, remaining, reset := l.limitCounter.Try(key)
 		w.Header().Set(ezhttp.HeaderRateLimitLimit, strconv.Itoa(l.requestLimit))
-		w.Header().Set(ezhttp.HeaderRateLimitRemaining, strconv.Itoa(remaining))
-		w.Header().Set(ezhttp.HeaderRateLimitReset, strconv.FormatInt(reset.Unix(), 10))
-
-		if !ok {
-			w.Header().Set(ezhttp.HeaderRetryAfter, strconv.FormatInt(int64(math.Ceil(time.Until(reset).Seconds())), 10))
+		w.Header().Set(ezhttp.HeaderRateLimitRemaining, strconv.Itoa(result.Remaining))
+		w.Header().Set(ezhttp.HeaderRateLimitReset, strconv.FormatInt(result.Reset.Unix(), 10))
+		if !result.Allowed {
+			w.Header().Set(ezhttp.HeaderRetryAfter, strconv.FormatInt(int64(math.Ceil(result.RetryAfter.Seconds())), 10))
 			l.onRequestLimit(w, r)
-			l.mu.Unlock()
 			return
 		}
-		l.mu.Unlock()
 
 		next.ServeHTTP(w, r)
 	})
 }
 
-func getKey(r *http.Request) string {
+// KeyByIP returns the IP of the request, IPv6 addresses share the bucket of their /64 prefix.
+func KeyByIP(r *http.Request) string {
 	ip, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
 		ip = r.RemoteAddr
 	}
-	return canonicalizeIP(ip) + ":" + r.URL.Path
+	return canonicalizeIP(ip)
 }
 
 // canonicalizeIP returns a form of ip suitable for comparison to other IPs.
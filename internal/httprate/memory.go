@@ -0,0 +1,72 @@
+package httprate
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// NewMemoryStore returns a Store which keeps the buckets in memory, so each replica has its own buckets.
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{
+		buckets: make(map[uint64]*memoryBucket),
+	}
+	go s.cleanup()
+	return s
+}
+
+type MemoryStore struct {
+	buckets map[uint64]*memoryBucket
+	mu      sync.Mutex
+}
+
+type memoryBucket struct {
+	bucket
+	fullAt time.Time
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	hkey := xxhash.Sum64String(key)
+	b, ok := s.buckets[hkey]
+	if !ok {
+		b = &memoryBucket{
+			bucket: bucket{
+				tokens:    float64(limit),
+				updatedAt: now,
+			},
+		}
+		s.buckets[hkey] = b
+	}
+
+	result := b.take(now, limit, window)
+	b.fullAt = result.Reset
+	return result, nil
+}
+
+// cleanup removes full buckets since they are the same as new buckets.
+func (s *MemoryStore) cleanup() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.doCleanup()
+	}
+}
+
+func (s *MemoryStore) doCleanup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, b := range s.buckets {
+		if now.After(b.fullAt) {
+			delete(s.buckets, k)
+		}
+	}
+}
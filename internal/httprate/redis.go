@@ -0,0 +1,256 @@
+package httprate
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	redisTimeout  = 5 * time.Second
+	redisMaxConns = 16
+)
+
+// takeScript is the token bucket of Store.Take, it uses the clock of Redis so replicas with skewed clocks share the same
+// buckets. The tokens are kept as string since Lua numbers are truncated to integers in replies.
+const takeScript = `
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updated_at')
+local tokens = tonumber(bucket[1]) or limit
+local updated_at = tonumber(bucket[2]) or now
+tokens = math.min(limit, tokens + math.max(0, now - updated_at) * limit / window)
+local allowed = 0
+local retry_after = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry_after = math.ceil((1 - tokens) * window / limit)
+end
+local reset = math.ceil((limit - tokens) * window / limit)
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated_at', now)
+redis.call('PEXPIRE', KEYS[1], math.max(reset, 1))
+return {allowed, math.floor(tokens), reset, retry_after}
+`
+
+var takeScriptSHA = func() string {
+	sum := sha1.Sum([]byte(takeScript))
+	return hex.EncodeToString(sum[:])
+}()
+
+// RedisConfig is the Redis server of a RedisStore.
+type RedisConfig struct {
+	Address  string
+	Username string
+	Password string
+	DB       int
+	// Prefix is added to the keys of the buckets.
+	Prefix string
+}
+
+// NewRedisStore returns a Store which keeps the buckets in Redis, so replicas of the server share them. Connections are
+// opened when they are needed and kept for later requests.
+func NewRedisStore(cfg RedisConfig) *RedisStore {
+	return &RedisStore{
+		cfg:   cfg,
+		conns: make(chan *redisConn, redisMaxConns),
+	}
+}
+
+type RedisStore struct {
+	cfg   RedisConfig
+	conns chan *redisConn
+}
+
+// redisError is an error reply of Redis.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	args := []string{s.cfg.Prefix + key, strconv.Itoa(limit), strconv.FormatInt(max(window.Milliseconds(), 1), 10)}
+
+	reply, err := s.do(ctx, append([]string{"EVALSHA", takeScriptSHA, "1"}, args...)...)
+	var rErr redisError
+	if errors.As(err, &rErr) && strings.HasPrefix(string(rErr), "NOSCRIPT") {
+		reply, err = s.do(ctx, append([]string{"EVAL", takeScript, "1"}, args...)...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	values, ok := reply.([]any)
+	if !ok || len(values) != 4 {
+		return nil, fmt.Errorf("unexpected reply from rate limit script: %v", reply)
+	}
+	ints := make([]int64, len(values))
+	for i, value := range values {
+		if ints[i], ok = value.(int64); !ok {
+			return nil, fmt.Errorf("unexpected reply from rate limit script: %v", reply)
+		}
+	}
+
+	return &Result{
+		Allowed:    ints[0] == 1,
+		Remaining:  int(ints[1]),
+		Reset:      time.Now().Add(time.Duration(ints[2]) * time.Millisecond),
+		RetryAfter: time.Duration(ints[3]) * time.Millisecond,
+	}, nil
+}
+
+// do sends the command on a connection of the pool. Connections are closed after errors other than error replies.
+func (s *RedisStore) do(ctx context.Context, args ...string) (any, error) {
+	conn, err := s.getConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.do(ctx, args...)
+	var rErr redisError
+	if err != nil && !errors.As(err, &rErr) {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	select {
+	case s.conns <- conn:
+	default:
+		_ = conn.Close()
+	}
+	return reply, err
+}
+
+func (s *RedisStore) getConn(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-s.conns:
+		return conn, nil
+	default:
+	}
+
+	dialer := net.Dialer{Timeout: redisTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", s.cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	conn := &redisConn{
+		Conn:   netConn,
+		reader: bufio.NewReader(netConn),
+	}
+
+	if s.cfg.Password != "" {
+		args := []string{"AUTH", s.cfg.Password}
+		if s.cfg.Username != "" {
+			args = []string{"AUTH", s.cfg.Username, s.cfg.Password}
+		}
+		if _, err = conn.do(ctx, args...); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("failed to authenticate to redis: %w", err)
+		}
+	}
+	if s.cfg.DB != 0 {
+		if _, err = conn.do(ctx, "SELECT", strconv.Itoa(s.cfg.DB)); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("failed to select redis database: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// Close closes the connections of the pool.
+func (s *RedisStore) Close() {
+	for {
+		select {
+		case conn := <-s.conns:
+			_ = conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// redisConn speaks the RESP2 protocol, see https://redis.io/docs/latest/develop/reference/protocol-spec/.
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *redisConn) do(ctx context.Context, args ...string) (any, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(redisTimeout)
+	}
+	if err := c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		sb.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+	if _, err := io.WriteString(c, sb.String()); err != nil {
+		return nil, fmt.Errorf("failed to send redis command: %w", err)
+	}
+	return c.readReply()
+}
+
+func (c *redisConn) readReply() (any, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read redis reply: %w", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err = io.ReadFull(c.reader, data); err != nil {
+			return nil, fmt.Errorf("failed to read redis reply: %w", err)
+		}
+		return string(data[:size]), nil
+	case '*':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		values := make([]any, size)
+		for i := range values {
+			// error replies inside arrays are returned as values
+			values[i], err = c.readReply()
+			var rErr redisError
+			if errors.As(err, &rErr) {
+				values[i] = rErr
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("unknown redis reply: %q", line)
+}
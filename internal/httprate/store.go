@@ -0,0 +1,49 @@
+package httprate
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Store keeps the token buckets of the rate limiters. Buckets hold limit tokens and are refilled evenly, so a full
+// bucket is refilled within the window.
+type Store interface {
+	// Take takes a token from the bucket of the key.
+	Take(ctx context.Context, key string, limit int, window time.Duration) (*Result, error)
+}
+
+// Result is the state of a bucket after a token was taken from it.
+type Result struct {
+	// Allowed is false if the bucket had no token left.
+	Allowed   bool
+	Remaining int
+	// Reset is when the bucket is full again.
+	Reset time.Time
+	// RetryAfter is how long it takes until the next token is added to an empty bucket.
+	RetryAfter time.Duration
+}
+
+// bucket is a token bucket, the tokens are refilled when a token is taken.
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// take refills the bucket for the time since it was updated and takes a token if one is left.
+func (b *bucket) take(now time.Time, limit int, window time.Duration) *Result {
+	rate := float64(limit) / float64(window)
+	b.tokens = math.Min(float64(limit), b.tokens+float64(now.Sub(b.updatedAt))*rate)
+	b.updatedAt = now
+
+	result := &Result{}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration(math.Ceil((1 - b.tokens) / rate))
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = now.Add(time.Duration(math.Ceil((float64(limit) - b.tokens) / rate)))
+	return result
+}
@@ -0,0 +1,475 @@
+package logparse
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatText   Format = "text"
+	FormatJSON   Format = "json"
+	FormatLogfmt Format = "logfmt"
+	FormatGo     Format = "go"
+	FormatJava   Format = "java"
+	FormatPython Format = "python"
+)
+
+type Level string
+
+const (
+	LevelNone  Level = ""
+	LevelTrace Level = "trace"
+	LevelDebug Level = "debug"
+	LevelInfo  Level = "info"
+	LevelWarn  Level = "warn"
+	LevelError Level = "error"
+	LevelFatal Level = "fatal"
+)
+
+var levelOrder = map[Level]int{
+	LevelNone:  0,
+	LevelTrace: 1,
+	LevelDebug: 2,
+	LevelInfo:  3,
+	LevelWarn:  4,
+	LevelError: 5,
+	LevelFatal: 6,
+}
+
+// AtLeast reports whether l is at least as severe as min. Entries without a level never match a min level.
+func (l Level) AtLeast(min Level) bool {
+	if min == LevelNone {
+		return true
+	}
+	return l != LevelNone && levelOrder[l] >= levelOrder[min]
+}
+
+// ParseLevel normalizes common level names like WARNING, err or CRITICAL.
+func ParseLevel(s string) Level {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "trace", "trc":
+		return LevelTrace
+	case "debug", "dbg", "fine", "finer", "finest":
+		return LevelDebug
+	case "info", "inf", "information", "notice":
+		return LevelInfo
+	case "warn", "warning", "wrn":
+		return LevelWarn
+	case "error", "err", "severe", "exception":
+		return LevelError
+	case "fatal", "crit", "critical", "panic", "emerg", "alert":
+		return LevelFatal
+	default:
+		return LevelNone
+	}
+}
+
+type Document struct {
+	Format  Format  `json:"format"`
+	Entries []Entry `json:"entries"`
+}
+
+// Entry is a single log line or stack trace. Line and EndLine are 1-based and inclusive.
+type Entry struct {
+	Line    int               `json:"line"`
+	EndLine int               `json:"end_line"`
+	Format  Format            `json:"format"`
+	Level   Level             `json:"level,omitempty"`
+	Time    *time.Time        `json:"time,omitempty"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	Frames  []Frame           `json:"frames,omitempty"`
+}
+
+// Frame is a single stack frame. Line is the 1-based line of the frame in the document, SourceLine the line in the referenced source file.
+type Frame struct {
+	Line       int    `json:"line"`
+	Function   string `json:"function"`
+	File       string `json:"file,omitempty"`
+	SourceLine int    `json:"source_line,omitempty"`
+}
+
+var (
+	timeRegex   = regexp.MustCompile(`^\[?(\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?)\]?`)
+	levelRegex  = regexp.MustCompile(`(?i)(?:^|[\s\[(|:])(TRACE|DEBUG|INFO|NOTICE|WARN|WARNING|ERROR|ERR|SEVERE|FATAL|CRITICAL|PANIC)(?:$|[\s\])|:])`)
+	logfmtRegex = regexp.MustCompile(`([\w.\-]+)=("(?:[^"\\]|\\.)*"|\S*)`)
+
+	goRoutineRegex   = regexp.MustCompile(`^goroutine \d+ \[.+]:$`)
+	goFileRegex      = regexp.MustCompile(`^\t(.+\.go):(\d+)(?: \+0x[0-9a-f]+)?$`)
+	javaStartRegex   = regexp.MustCompile(`^(?:Exception in thread "[^"]*" |Caused by: )?([\w$]+\.)+[\w$]*(?:Exception|Error|Throwable)(?::.*)?$`)
+	javaFrameRegex   = regexp.MustCompile(`^\s+at ([^(]+)\((?:([^:)]+)(?::(\d+))?|[^)]*)\)$`)
+	javaMoreRegex    = regexp.MustCompile(`^\s+\.\.\. \d+ (?:more|common frames omitted)$`)
+	pythonFrameRegex = regexp.MustCompile(`^\s+File "([^"]+)", line (\d+)(?:, in (.+))?$`)
+)
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05,999999999",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// ParseTime parses the common timestamp layouts found in logs. Timestamps without a zone are interpreted as UTC.
+func ParseTime(s string) (*time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return &t, nil
+		}
+	}
+	if unix, err := strconv.ParseFloat(s, 64); err == nil {
+		sec := int64(unix)
+		t := time.Unix(sec, int64((unix-float64(sec))*1e9)).UTC()
+		return &t, nil
+	}
+	return nil, fmt.Errorf("unknown time format: %s", s)
+}
+
+// Parse splits content into log entries and stack traces.
+func Parse(content string) Document {
+	return parse(splitLines(content))
+}
+
+func splitLines(content string) []string {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func parse(lines []string) Document {
+	p := &parser{lines: lines}
+	for p.i < len(p.lines) {
+		p.next()
+	}
+
+	counts := make(map[Format]int)
+	for _, entry := range p.entries {
+		counts[entry.Format]++
+	}
+	// the most common structured format wins, plain text is only used if nothing else was found
+	format := FormatText
+	for _, f := range []Format{FormatGo, FormatJava, FormatPython, FormatJSON, FormatLogfmt} {
+		if counts[f] > counts[format] || (format == FormatText && counts[f] > 0) {
+			format = f
+		}
+	}
+
+	return Document{
+		Format:  format,
+		Entries: p.entries,
+	}
+}
+
+// Filter selects entries by their minimum level and time range. Zero values match everything.
+type Filter struct {
+	Level Level
+	From  *time.Time
+	To    *time.Time
+}
+
+func (f Filter) IsZero() bool {
+	return f.Level == LevelNone && f.From == nil && f.To == nil
+}
+
+// Apply returns all entries matching the filter. Entries without a timestamp use the timestamp of the previous entry.
+func (f Filter) Apply(entries []Entry) []Entry {
+	var (
+		filtered []Entry
+		lastTime *time.Time
+	)
+	for _, entry := range entries {
+		t := entry.Time
+		if t == nil {
+			t = lastTime
+		} else {
+			lastTime = t
+		}
+
+		if !entry.Level.AtLeast(f.Level) {
+			continue
+		}
+		if f.From != nil && (t == nil || t.Before(*f.From)) {
+			continue
+		}
+		if f.To != nil && (t == nil || t.After(*f.To)) {
+			continue
+		}
+		filtered = append(filtered, entry)
+	}
+	return filtered
+}
+
+// FilterContent only keeps the lines of entries matching the filter.
+func FilterContent(content string, filter Filter) string {
+	lines := splitLines(content)
+	document := parse(lines)
+
+	var sb strings.Builder
+	for _, entry := range filter.Apply(document.Entries) {
+		for _, line := range lines[entry.Line-1 : entry.EndLine] {
+			sb.WriteString(line)
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
+
+type parser struct {
+	lines   []string
+	i       int
+	entries []Entry
+}
+
+func (p *parser) next() {
+	line := p.lines[p.i]
+	lineNumber := p.i + 1
+
+	switch {
+	case strings.HasPrefix(line, "panic: ") || strings.HasPrefix(line, "fatal error: ") || goRoutineRegex.MatchString(line):
+		p.parseGo()
+	case line == "Traceback (most recent call last):":
+		p.parsePython()
+	case javaStartRegex.MatchString(line) && p.i+1 < len(p.lines) && javaFrameRegex.MatchString(p.lines[p.i+1]):
+		p.parseJava()
+	case strings.HasPrefix(strings.TrimSpace(line), "{"):
+		if entry, ok := parseJSON(line); ok {
+			entry.Line, entry.EndLine = lineNumber, lineNumber
+			p.entries = append(p.entries, entry)
+			p.i++
+			return
+		}
+		p.parseText()
+	default:
+		if entry, ok := parseLogfmt(line); ok {
+			entry.Line, entry.EndLine = lineNumber, lineNumber
+			p.entries = append(p.entries, entry)
+			p.i++
+			return
+		}
+		p.parseText()
+	}
+}
+
+func (p *parser) parseText() {
+	line := p.lines[p.i]
+	entry := Entry{
+		Line:    p.i + 1,
+		EndLine: p.i + 1,
+		Format:  FormatText,
+		Message: line,
+	}
+	if match := timeRegex.FindStringSubmatch(line); match != nil {
+		entry.Time, _ = ParseTime(strings.Replace(match[1], ",", ".", 1))
+	}
+	if match := levelRegex.FindStringSubmatch(line); match != nil {
+		entry.Level = ParseLevel(match[1])
+	}
+	p.i++
+
+	// indented lines directly after a log line belong to it
+	for p.i < len(p.lines) && p.lines[p.i] != "" && (p.lines[p.i][0] == ' ' || p.lines[p.i][0] == '\t') {
+		entry.EndLine = p.i + 1
+		p.i++
+	}
+
+	if entry.Level == LevelNone && strings.TrimSpace(line) == "" && len(p.entries) > 0 {
+		// merge empty lines into the previous entry to keep the entry count low
+		p.entries[len(p.entries)-1].EndLine = entry.EndLine
+		return
+	}
+	p.entries = append(p.entries, entry)
+}
+
+func (p *parser) parseGo() {
+	entry := Entry{
+		Line:    p.i + 1,
+		Format:  FormatGo,
+		Level:   LevelFatal,
+		Message: p.lines[p.i],
+	}
+	p.i++
+
+	for p.i < len(p.lines) {
+		line := p.lines[p.i]
+		switch {
+		case line == "" || goRoutineRegex.MatchString(line) || strings.HasPrefix(line, "[signal ") || strings.HasPrefix(line, "exit status "):
+		case strings.HasPrefix(line, "\t"):
+			// file line without function, should not happen
+		case p.i+1 < len(p.lines) && goFileRegex.MatchString(p.lines[p.i+1]):
+			match := goFileRegex.FindStringSubmatch(p.lines[p.i+1])
+			sourceLine, _ := strconv.Atoi(match[2])
+			entry.Frames = append(entry.Frames, Frame{
+				Line:       p.i + 1,
+				Function:   line,
+				File:       match[1],
+				SourceLine: sourceLine,
+			})
+			p.i++
+		case strings.HasPrefix(line, "created by "):
+		default:
+			entry.EndLine = p.i
+			p.entries = append(p.entries, entry)
+			return
+		}
+		p.i++
+	}
+	entry.EndLine = p.i
+	p.entries = append(p.entries, entry)
+}
+
+func (p *parser) parseJava() {
+	entry := Entry{
+		Line:    p.i + 1,
+		Format:  FormatJava,
+		Level:   LevelError,
+		Message: p.lines[p.i],
+	}
+	p.i++
+
+	for p.i < len(p.lines) {
+		line := p.lines[p.i]
+		if match := javaFrameRegex.FindStringSubmatch(line); match != nil {
+			sourceLine, _ := strconv.Atoi(match[3])
+			entry.Frames = append(entry.Frames, Frame{
+				Line:       p.i + 1,
+				Function:   match[1],
+				File:       match[2],
+				SourceLine: sourceLine,
+			})
+			p.i++
+			continue
+		}
+		if javaMoreRegex.MatchString(line) || (strings.HasPrefix(line, "Caused by: ") && p.i+1 < len(p.lines)) {
+			if strings.HasPrefix(line, "Caused by: ") {
+				entry.Message += "\n" + line
+			}
+			p.i++
+			continue
+		}
+		break
+	}
+	entry.EndLine = p.i
+	p.entries = append(p.entries, entry)
+}
+
+func (p *parser) parsePython() {
+	entry := Entry{
+		Line:    p.i + 1,
+		Format:  FormatPython,
+		Level:   LevelError,
+		Message: p.lines[p.i],
+	}
+	p.i++
+
+	for p.i < len(p.lines) {
+		line := p.lines[p.i]
+		if match := pythonFrameRegex.FindStringSubmatch(line); match != nil {
+			sourceLine, _ := strconv.Atoi(match[2])
+			entry.Frames = append(entry.Frames, Frame{
+				Line:       p.i + 1,
+				Function:   match[3],
+				File:       match[1],
+				SourceLine: sourceLine,
+			})
+			p.i++
+			continue
+		}
+		if line != "" && (line[0] == ' ' || line[0] == '\t') {
+			// source code of the previous frame
+			p.i++
+			continue
+		}
+		if line != "" {
+			// the exception itself ends the traceback
+			entry.Message = line
+			p.i++
+		}
+		break
+	}
+	entry.EndLine = p.i
+	p.entries = append(p.entries, entry)
+}
+
+func parseJSON(line string) (Entry, bool) {
+	var data map[string]any
+	if err := json.Unmarshal([]byte(line), &data); err != nil {
+		return Entry{}, false
+	}
+
+	entry := Entry{
+		Format: FormatJSON,
+		Fields: make(map[string]string, len(data)),
+	}
+	for key, value := range data {
+		var str string
+		switch v := value.(type) {
+		case string:
+			str = v
+		default:
+			raw, _ := json.Marshal(v)
+			str = string(raw)
+		}
+		entry.Fields[key] = str
+	}
+	entry.applyFields()
+	return entry, true
+}
+
+func parseLogfmt(line string) (Entry, bool) {
+	matches := logfmtRegex.FindAllStringSubmatch(line, -1)
+	if len(matches) < 2 {
+		return Entry{}, false
+	}
+
+	entry := Entry{
+		Format: FormatLogfmt,
+		Fields: make(map[string]string, len(matches)),
+	}
+	for _, match := range matches {
+		value := match[2]
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		entry.Fields[match[1]] = value
+	}
+	if _, ok := entry.firstField("level", "lvl", "severity"); !ok {
+		if _, ok = entry.firstField("msg", "message"); !ok {
+			return Entry{}, false
+		}
+	}
+	entry.applyFields()
+	return entry, true
+}
+
+func (e *Entry) firstField(keys ...string) (string, bool) {
+	for _, key := range keys {
+		if value, ok := e.Fields[key]; ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func (e *Entry) applyFields() {
+	if level, ok := e.firstField("level", "lvl", "severity", "log.level"); ok {
+		e.Level = ParseLevel(level)
+	}
+	if t, ok := e.firstField("time", "ts", "timestamp", "@timestamp", "t"); ok {
+		e.Time, _ = ParseTime(t)
+	}
+	if msg, ok := e.firstField("msg", "message", "error"); ok {
+		e.Message = msg
+	}
+}
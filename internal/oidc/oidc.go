@@ -0,0 +1,258 @@
+// Package oidc implements the authorization code flow of OpenID Connect with PKCE for a confidential client.
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+)
+
+const (
+	// discoveryTTL is how long the discovery document and the keys of the issuer are cached.
+	discoveryTTL = time.Hour
+	// clockSkew is the leeway for the times of the ID token.
+	clockSkew = time.Minute
+	// maxResponseSize limits the responses of the issuer.
+	maxResponseSize = 1 << 20
+)
+
+var (
+	ErrInvalidIDToken = errors.New("invalid id token")
+	ErrUnknownKey     = errors.New("id token signed with an unknown key")
+)
+
+// Provider is an OpenID Connect issuer with the client registered at it.
+type Provider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	HTTPClient   *http.Client
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      jose.JSONWebKeySet
+	fetchedAt time.Time
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the claims of an ID token which identify the user.
+type Claims struct {
+	jwt.Claims
+	Nonce             string `json:"nonce"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Email             string `json:"email"`
+}
+
+// DisplayName returns the name, the preferred username or the email of the user.
+func (c Claims) DisplayName() string {
+	for _, name := range []string{c.Name, c.PreferredUsername, c.Email} {
+		if name != "" {
+			return name
+		}
+	}
+	return c.Subject
+}
+
+// CodeChallenge returns the S256 PKCE challenge of the verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the URL of the issuer the user has to be redirected to for logging in.
+func (p *Provider) AuthCodeURL(ctx context.Context, redirectURL string, state string, nonce string, verifier string) (string, error) {
+	d, err := p.getDiscovery(ctx, false)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.ClientID)
+	query.Set("redirect_uri", redirectURL)
+	query.Set("scope", strings.Join(p.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", CodeChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return d.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems the authorization code for the ID token of the user and returns its verified claims.
+func (p *Provider) Exchange(ctx context.Context, redirectURL string, code string, verifier string, nonce string) (*Claims, error) {
+	d, err := p.getDiscovery(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURL)
+	form.Set("code_verifier", verifier)
+
+	rq, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	rq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rq.Header.Set("Accept", "application/json")
+	rq.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+
+	var tokenRs struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err = p.do(rq, &tokenRs); err != nil {
+		if tokenRs.Error != "" {
+			return nil, fmt.Errorf("failed to exchange code: %s %s", tokenRs.Error, tokenRs.ErrorDescription)
+		}
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+	if tokenRs.IDToken == "" {
+		return nil, fmt.Errorf("%w: missing in token response", ErrInvalidIDToken)
+	}
+
+	return p.verify(ctx, tokenRs.IDToken, nonce)
+}
+
+// verify checks the signature of the ID token with the keys of the issuer and its issuer, audience, times and nonce.
+func (p *Provider) verify(ctx context.Context, idToken string, nonce string) (*Claims, error) {
+	token, err := jwt.ParseSigned(idToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+	if len(token.Headers) != 1 {
+		return nil, ErrInvalidIDToken
+	}
+
+	key, err := p.getKey(ctx, token.Headers[0].KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err = token.Claims(key, &claims); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+	if err = claims.ValidateWithLeeway(jwt.Expected{
+		Issuer:   p.Issuer,
+		Audience: jwt.Audience{p.ClientID},
+		Time:     time.Now(),
+	}, clockSkew); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+	if claims.Expiry == nil || claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing exp or sub", ErrInvalidIDToken)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	return &claims, nil
+}
+
+// getKey returns the key of the issuer with the key id. The keys are loaded again once if the key is unknown, so
+// rotated keys are found.
+func (p *Provider) getKey(ctx context.Context, keyID string) (*jose.JSONWebKey, error) {
+	for _, reload := range []bool{false, true} {
+		if _, err := p.getDiscovery(ctx, reload); err != nil {
+			return nil, err
+		}
+
+		p.mu.Lock()
+		keys := p.keys.Keys
+		p.mu.Unlock()
+		for _, key := range keys {
+			if (keyID == "" || key.KeyID == keyID) && key.Use != "enc" {
+				return &key, nil
+			}
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// getDiscovery returns the cached discovery document of the issuer and loads it with the keys if it is missing, too old
+// or reload is set.
+func (p *Provider) getDiscovery(ctx context.Context, reload bool) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil && !reload && time.Since(p.fetchedAt) < discoveryTTL {
+		return p.discovery, nil
+	}
+
+	rq, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery request: %w", err)
+	}
+	var d discovery
+	if err = p.do(rq, &d); err != nil {
+		return nil, fmt.Errorf("failed to get discovery document: %w", err)
+	}
+	if d.Issuer != p.Issuer {
+		return nil, fmt.Errorf("issuer of discovery document %q doesn't match %q", d.Issuer, p.Issuer)
+	}
+
+	rq, err = http.NewRequestWithContext(ctx, http.MethodGet, d.JWKSURI, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create keys request: %w", err)
+	}
+	var keys jose.JSONWebKeySet
+	if err = p.do(rq, &keys); err != nil {
+		return nil, fmt.Errorf("failed to get keys: %w", err)
+	}
+
+	p.discovery = &d
+	p.keys = keys
+	p.fetchedAt = time.Now()
+	return &d, nil
+}
+
+// do sends the request and decodes the JSON response into v, error responses are decoded too.
+func (p *Provider) do(rq *http.Request, v any) error {
+	rs, err := p.HTTPClient.Do(rq)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rs.Body.Close()
+	}()
+
+	data, err := io.ReadAll(io.LimitReader(rs.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if err = json.Unmarshal(data, v); err != nil && rs.StatusCode == http.StatusOK {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if rs.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", rs.StatusCode)
+	}
+	return nil
+}
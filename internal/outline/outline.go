@@ -0,0 +1,247 @@
+package outline
+
+import (
+	"regexp"
+	"strings"
+)
+
+type Kind string
+
+const (
+	KindFunction  Kind = "function"
+	KindMethod    Kind = "method"
+	KindClass     Kind = "class"
+	KindStruct    Kind = "struct"
+	KindInterface Kind = "interface"
+	KindEnum      Kind = "enum"
+	KindType      Kind = "type"
+	KindModule    Kind = "module"
+	KindHeading   Kind = "heading"
+	KindSection   Kind = "section"
+)
+
+// Symbol is a single entry of the outline. Line is 1-based, Level is the nesting depth starting at 0.
+type Symbol struct {
+	Name  string `json:"name"`
+	Kind  Kind   `json:"kind"`
+	Line  int    `json:"line"`
+	Level int    `json:"level"`
+}
+
+// rule matches a symbol definition on a single line. The regex must contain a "name" group, the kind is either fixed
+// or taken from the "kind" group.
+type rule struct {
+	regex *regexp.Regexp
+	kind  Kind
+}
+
+func newRule(expr string, kind Kind) rule {
+	return rule{
+		regex: regexp.MustCompile(expr),
+		kind:  kind,
+	}
+}
+
+const modifiers = `(?:(?:public|private|protected|internal|static|final|abstract|sealed|open|data|partial|export|default|override|virtual|async|synchronized|inline|suspend)\s+)*`
+
+// keywords which look like function calls or declarations in c-like languages
+var keywords = map[string]struct{}{
+	"if": {}, "for": {}, "while": {}, "switch": {}, "catch": {}, "return": {}, "new": {}, "else": {}, "do": {},
+	"sizeof": {}, "typeof": {}, "function": {}, "foreach": {}, "using": {}, "lock": {}, "when": {}, "match": {},
+}
+
+var (
+	goRules = []rule{
+		newRule(`^func\s+\([^)]*\)\s*(?P<name>\w+)`, KindMethod),
+		newRule(`^func\s+(?P<name>\w+)`, KindFunction),
+		newRule(`^type\s+(?P<name>\w+)(?:\[[^\]]*\])?\s+(?P<kind>struct|interface)\b`, ""),
+		newRule(`^type\s+(?P<name>\w+)`, KindType),
+	}
+	pythonRules = []rule{
+		newRule(`^\s*class\s+(?P<name>\w+)`, KindClass),
+		newRule(`^\s*(?:async\s+)?def\s+(?P<name>\w+)`, KindFunction),
+	}
+	javaScriptRules = []rule{
+		newRule(`^\s*`+modifiers+`(?P<kind>class|interface|enum)\s+(?P<name>\w+)`, ""),
+		newRule(`^\s*(?:export\s+)?type\s+(?P<name>\w+)(?:<[^>]*>)?\s*=`, KindType),
+		newRule(`^\s*`+modifiers+`function\s*\*?\s*(?P<name>\w+)`, KindFunction),
+		newRule(`^\s*(?:export\s+)?(?:const|let|var)\s+(?P<name>\w+)\s*=\s*(?:async\s+)?(?:function\b|\([^)]*\)\s*=>|\w+\s*=>)`, KindFunction),
+		newRule(`^\s+(?:(?:static|async|get|set|public|private|protected|readonly)\s+)*(?P<name>#?\w+)\s*\([^)]*\)\s*(?::\s*[^{]+)?\{\s*$`, KindMethod),
+	}
+	classRules = []rule{
+		newRule(`^\s*`+modifiers+`(?P<kind>class|interface|enum|struct|record|object|trait|protocol|extension)\s+(?P<name>\w+)`, ""),
+		newRule(`^\s*`+modifiers+`(?:fun|def|func)\s+(?:<[^>]*>\s*)?(?:[\w.]+\.)?(?P<name>\w+)`, KindFunction),
+		newRule(`^\s+`+modifiers+`[\w<>\[\],.?]+\s+(?P<name>\w+)\s*\([^;]*$`, KindMethod),
+	}
+	rustRules = []rule{
+		newRule(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?:const\s+)?(?:async\s+)?(?:unsafe\s+)?(?:extern\s+"[^"]*"\s+)?fn\s+(?P<name>\w+)`, KindFunction),
+		newRule(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?P<kind>struct|enum)\s+(?P<name>\w+)`, ""),
+		newRule(`^\s*(?:pub(?:\([^)]*\))?\s+)?trait\s+(?P<name>\w+)`, KindInterface),
+		newRule(`^\s*(?:pub(?:\([^)]*\))?\s+)?mod\s+(?P<name>\w+)`, KindModule),
+		newRule(`^\s*impl(?:<[^>]*>)?\s+(?P<name>[\w:<>, ]+?)\s*(?:where\b.*)?\{?\s*$`, KindType),
+	}
+	cRules = []rule{
+		newRule(`^\s*(?:typedef\s+)?(?P<kind>struct|class|enum|union)\s+(?P<name>\w+)\s*(?::[^{;]*)?\{?\s*$`, ""),
+		newRule(`^(?:[\w*&:<>,]+\s+)+\**(?P<name>[\w~]+(?:::[\w~]+)*)\s*\([^;]*$`, KindFunction),
+	}
+	rubyRules = []rule{
+		newRule(`^\s*(?P<kind>class|module)\s+(?P<name>[\w:]+)`, ""),
+		newRule(`^\s*def\s+(?:self\.)?(?P<name>\w+[?!=]?)`, KindMethod),
+	}
+	phpRules = []rule{
+		newRule(`^\s*`+modifiers+`(?P<kind>class|interface|enum)\s+(?P<name>\w+)`, ""),
+		newRule(`^\s*trait\s+(?P<name>\w+)`, KindInterface),
+		newRule(`^\s*`+modifiers+`function\s+&?(?P<name>\w+)`, KindFunction),
+	}
+	luaRules = []rule{
+		newRule(`^\s*(?:local\s+)?function\s+(?P<name>[\w.:]+)`, KindFunction),
+	}
+	bashRules = []rule{
+		newRule(`^\s*function\s+(?P<name>[\w-]+)`, KindFunction),
+		newRule(`^\s*(?P<name>[\w-]+)\s*\(\)`, KindFunction),
+	}
+	elixirRules = []rule{
+		newRule(`^\s*defmodule\s+(?P<name>[\w.]+)`, KindModule),
+		newRule(`^\s*defp?\s+(?P<name>\w+[?!]?)`, KindFunction),
+	}
+	tomlRules = []rule{
+		newRule(`^\s*\[\[?(?P<name>[^\]]+)\]\]?`, KindSection),
+	}
+)
+
+var languageRules = map[string][]rule{
+	"Go":          goRules,
+	"Python":      pythonRules,
+	"Python 2":    pythonRules,
+	"JavaScript":  javaScriptRules,
+	"TypeScript":  javaScriptRules,
+	"Java":        classRules,
+	"Kotlin":      classRules,
+	"C#":          classRules,
+	"Scala":       classRules,
+	"Swift":       classRules,
+	"Dart":        classRules,
+	"Groovy":      classRules,
+	"Rust":        rustRules,
+	"C":           cRules,
+	"C++":         cRules,
+	"Objective-C": cRules,
+	"Ruby":        rubyRules,
+	"PHP":         phpRules,
+	"Lua":         luaRules,
+	"Bash":        bashRules,
+	"Elixir":      elixirRules,
+	"TOML":        tomlRules,
+}
+
+// Supported reports whether an outline can be generated for the language.
+func Supported(language string) bool {
+	if strings.EqualFold(language, "markdown") {
+		return true
+	}
+	_, ok := languageRules[language]
+	return ok
+}
+
+// Parse generates the outline of the content for the chroma language name. Unsupported languages return no symbols.
+func Parse(language string, content string) []Symbol {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	if strings.EqualFold(language, "markdown") {
+		return parseMarkdown(lines)
+	}
+
+	symbols := make([]Symbol, 0)
+	rules, ok := languageRules[language]
+	if !ok {
+		return symbols
+	}
+
+	// indentation of the enclosing symbols to calculate the level
+	var indents []int
+	for i, line := range lines {
+		for _, r := range rules {
+			match := r.regex.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+
+			name := match[r.regex.SubexpIndex("name")]
+			if _, ok = keywords[name]; ok {
+				continue
+			}
+			kind := r.kind
+			if kind == "" {
+				kind = Kind(match[r.regex.SubexpIndex("kind")])
+			}
+			switch kind {
+			case "record", "object", "extension":
+				kind = KindClass
+			case "trait", "protocol":
+				kind = KindInterface
+			case "union":
+				kind = KindStruct
+			}
+
+			indent := indentation(line)
+			for len(indents) > 0 && indents[len(indents)-1] >= indent {
+				indents = indents[:len(indents)-1]
+			}
+			symbols = append(symbols, Symbol{
+				Name:  strings.TrimSpace(name),
+				Kind:  kind,
+				Line:  i + 1,
+				Level: len(indents),
+			})
+			indents = append(indents, indent)
+			break
+		}
+	}
+	return symbols
+}
+
+var markdownHeadingRegex = regexp.MustCompile(`^(#{1,6})\s+(.+?)(?:\s+#+)?\s*$`)
+
+func parseMarkdown(lines []string) []Symbol {
+	symbols := make([]Symbol, 0)
+	var fence string
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+
+		match := markdownHeadingRegex.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		symbols = append(symbols, Symbol{
+			Name:  match[2],
+			Kind:  KindHeading,
+			Line:  i + 1,
+			Level: len(match[1]) - 1,
+		})
+	}
+	return symbols
+}
+
+func indentation(line string) int {
+	indent := 0
+	for _, c := range line {
+		switch c {
+		case ' ':
+			indent++
+		case '\t':
+			indent += 4
+		default:
+			return indent
+		}
+	}
+	return indent
+}
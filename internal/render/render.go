@@ -0,0 +1,93 @@
+// Package render highlights document files. It is used by the server and compiled to WASM for the editor, so both
+// render the same markup.
+package render
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/topi314/chroma/v2"
+	"github.com/topi314/chroma/v2/formatters/html"
+	"github.com/topi314/chroma/v2/lexers"
+)
+
+// NewHTMLFormatter returns the formatter of the html output. It only writes css classes, the colors of the style come
+// from the theme css.
+func NewHTMLFormatter() *html.Formatter {
+	return html.New(
+		html.WithClasses(true),
+		html.ClassPrefix("ch-"),
+		html.Standalone(false),
+		html.InlineCode(false),
+		html.WithNopPreWrapper(),
+		html.WithLineNumbers(true),
+		html.WithLinkableLineNumbers(true, "L"),
+		html.TabWidth(4),
+	)
+}
+
+// Highlight formats the content with the lexer of the language. Contents longer than maxHighlightSize runes are
+// formatted as plaintext, 0 means no limit.
+func Highlight(formatter chroma.Formatter, style *chroma.Style, language string, content string, maxHighlightSize int) (string, error) {
+	lexer := lexers.Get(language)
+	if maxHighlightSize > 0 && len([]rune(content)) > maxHighlightSize {
+		lexer = lexers.Get("plaintext")
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+
+	iterator, err := lexer.Tokenise(nil, content)
+	if err != nil {
+		return "", fmt.Errorf("tokenise: %w", err)
+	}
+
+	buff := new(bytes.Buffer)
+	if err = formatter.Format(buff, style, iterator); err != nil {
+		return "", fmt.Errorf("format: %w", err)
+	}
+
+	return buff.String(), nil
+}
+
+// Language returns the name of the lexer for the file. The language wins over the content type, the file name and
+// the content, plaintext is used if nothing matches.
+func Language(language string, contentType string, fileName string, content string) string {
+	var lexer chroma.Lexer
+	if language != "" {
+		lexer = lexers.Get(language)
+	}
+	if lexer != nil {
+		return lexer.Config().Name
+	}
+
+	if contentType != "" && contentType != "application/octet-stream" {
+		lexer = lexers.MatchMimeType(contentType)
+	}
+	if lexer != nil {
+		return lexer.Config().Name
+	}
+
+	if contentType != "" {
+		lexer = lexers.Get(contentType)
+	}
+	if lexer != nil {
+		return lexer.Config().Name
+	}
+
+	if fileName != "" {
+		lexer = lexers.Match(fileName)
+	}
+	if lexer != nil {
+		return lexer.Config().Name
+	}
+
+	if len(content) > 0 {
+		lexer = lexers.Analyse(content)
+	}
+	if lexer != nil {
+		return lexer.Config().Name
+	}
+
+	return "plaintext"
+}
@@ -0,0 +1,173 @@
+// Package signature verifies detached minisign and PGP signatures against the public key of the signer.
+package signature
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/openpgp"
+	pgperrors "golang.org/x/crypto/openpgp/errors"
+)
+
+const (
+	FormatMinisign = "minisign"
+	FormatPGP      = "pgp"
+)
+
+// Formats are the names of all signature formats.
+var Formats = []string{FormatMinisign, FormatPGP}
+
+var (
+	ErrUnknownFormat      = errors.New("unknown signature format, must be minisign or pgp")
+	ErrInvalidPublicKey   = errors.New("invalid public key")
+	ErrInvalidSignature   = errors.New("invalid signature")
+	ErrKeyMismatch        = errors.New("signature was made with another key")
+	ErrVerificationFailed = errors.New("signature doesn't match the content")
+)
+
+// Signer is the key which made a verified signature.
+type Signer struct {
+	Format string
+	// KeyID is the key id of minisign keys or the fingerprint of PGP keys.
+	KeyID string
+	// Comment is the trusted comment of minisign signatures or the primary identity of PGP keys.
+	Comment string
+}
+
+// DetectFormat returns the format of the signature or an empty string if it is unknown.
+func DetectFormat(signature string) string {
+	switch {
+	case strings.Contains(signature, "-----BEGIN PGP SIGNATURE-----"):
+		return FormatPGP
+	case strings.Contains(signature, "trusted comment:"):
+		return FormatMinisign
+	}
+	return ""
+}
+
+// Verify checks the detached signature of the content with the public key. The format is detected from the signature
+// if it is empty. PGP keys and signatures have to be ASCII armored.
+func Verify(format string, publicKey string, signature string, content []byte) (*Signer, error) {
+	if format == "" {
+		format = DetectFormat(signature)
+	}
+	switch format {
+	case FormatMinisign:
+		return verifyMinisign(publicKey, signature, content)
+	case FormatPGP:
+		return verifyPGP(publicKey, signature, content)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// verifyMinisign checks legacy and prehashed minisign signatures and the global signature of their trusted comment,
+// see https://jedisct1.github.io/minisign/#signature-format.
+func verifyMinisign(publicKey string, signature string, content []byte) (*Signer, error) {
+	keyLines := minisignLines(publicKey)
+	if len(keyLines) != 1 {
+		return nil, ErrInvalidPublicKey
+	}
+	key, err := base64.StdEncoding.DecodeString(keyLines[0])
+	if err != nil || len(key) != 2+8+ed25519.PublicKeySize || string(key[:2]) != "Ed" {
+		return nil, ErrInvalidPublicKey
+	}
+	keyID, pub := key[2:10], ed25519.PublicKey(key[10:])
+
+	sigLines := minisignLines(signature)
+	if len(sigLines) != 3 {
+		return nil, ErrInvalidSignature
+	}
+	trustedComment, ok := strings.CutPrefix(sigLines[1], "trusted comment: ")
+	if !ok {
+		return nil, fmt.Errorf("%w: missing trusted comment", ErrInvalidSignature)
+	}
+	sig, err := base64.StdEncoding.DecodeString(sigLines[0])
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return nil, ErrInvalidSignature
+	}
+	globalSig, err := base64.StdEncoding.DecodeString(sigLines[2])
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("%w: invalid global signature", ErrInvalidSignature)
+	}
+	if !bytes.Equal(sig[2:10], keyID) {
+		return nil, ErrKeyMismatch
+	}
+
+	message := content
+	switch string(sig[:2]) {
+	case "Ed":
+	case "ED":
+		sum := blake2b.Sum512(content)
+		message = sum[:]
+	default:
+		return nil, fmt.Errorf("%w: unknown algorithm", ErrInvalidSignature)
+	}
+	if !ed25519.Verify(pub, message, sig[10:]) {
+		return nil, ErrVerificationFailed
+	}
+	if !ed25519.Verify(pub, append(slices.Clone(sig[10:]), trustedComment...), globalSig) {
+		return nil, fmt.Errorf("%w: trusted comment was modified", ErrVerificationFailed)
+	}
+
+	return &Signer{
+		Format:  FormatMinisign,
+		KeyID:   fmt.Sprintf("%016X", binary.LittleEndian.Uint64(keyID)),
+		Comment: trustedComment,
+	}, nil
+}
+
+// minisignLines returns the lines of a minisign key or signature without the untrusted comment.
+func minisignLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "untrusted comment:") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func verifyPGP(publicKey string, signature string, content []byte) (*Signer, error) {
+	keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(publicKey))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+	}
+
+	entity, err := openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(content), strings.NewReader(signature))
+	if err != nil {
+		if errors.Is(err, pgperrors.ErrUnknownIssuer) {
+			return nil, ErrKeyMismatch
+		}
+		return nil, fmt.Errorf("%w: %w", ErrVerificationFailed, err)
+	}
+
+	var identities []string
+	for name, identity := range entity.Identities {
+		if identity.SelfSignature != nil && identity.SelfSignature.IsPrimaryId != nil && *identity.SelfSignature.IsPrimaryId {
+			identities = []string{name}
+			break
+		}
+		identities = append(identities, name)
+	}
+	slices.Sort(identities)
+
+	var comment string
+	if len(identities) > 0 {
+		comment = identities[0]
+	}
+	return &Signer{
+		Format:  FormatPGP,
+		KeyID:   strings.ToUpper(hex.EncodeToString(entity.PrimaryKey.Fingerprint[:])),
+		Comment: comment,
+	}, nil
+}
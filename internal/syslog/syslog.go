@@ -0,0 +1,187 @@
+package syslog
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"time"
+)
+
+var ErrInvalidMessage = errors.New("invalid syslog message")
+
+// severityNames are the severities as levels which the log view of gobin understands.
+var severityNames = [...]string{"FATAL", "FATAL", "CRITICAL", "ERROR", "WARN", "NOTICE", "INFO", "DEBUG"}
+
+// Message is a RFC 5424 syslog message. Nil values ("-") are empty.
+type Message struct {
+	Facility       int
+	Severity       int
+	Timestamp      time.Time
+	Hostname       string
+	AppName        string
+	ProcID         string
+	MsgID          string
+	StructuredData string
+	Message        string
+}
+
+// SeverityName returns the level of the severity like ERROR or INFO.
+func (m Message) SeverityName() string {
+	return severityNames[m.Severity]
+}
+
+// Parse parses a RFC 5424 message, trailing line breaks are removed from the message.
+func Parse(data []byte) (*Message, error) {
+	p := parser{data: bytes.TrimRight(data, "\r\n")}
+
+	if !p.consume('<') {
+		return nil, ErrInvalidMessage
+	}
+	pri, ok := p.number(3)
+	if !ok || pri > 191 || !p.consume('>') {
+		return nil, ErrInvalidMessage
+	}
+	if version, ok := p.number(2); !ok || version == 0 || !p.consume(' ') {
+		return nil, ErrInvalidMessage
+	}
+
+	m := Message{
+		Facility: pri / 8,
+		Severity: pri % 8,
+	}
+	timestamp, ok := p.field()
+	if !ok {
+		return nil, ErrInvalidMessage
+	}
+	if timestamp != "" {
+		var err error
+		if m.Timestamp, err = time.Parse(time.RFC3339Nano, timestamp); err != nil {
+			return nil, ErrInvalidMessage
+		}
+	}
+	for _, field := range []*string{&m.Hostname, &m.AppName, &m.ProcID, &m.MsgID} {
+		if *field, ok = p.field(); !ok {
+			return nil, ErrInvalidMessage
+		}
+	}
+	if m.StructuredData, ok = p.structuredData(); !ok {
+		return nil, ErrInvalidMessage
+	}
+
+	if p.consume(' ') {
+		m.Message = string(bytes.TrimPrefix(p.data[p.i:], []byte("\ufeff")))
+	} else if p.i != len(p.data) {
+		return nil, ErrInvalidMessage
+	}
+	return &m, nil
+}
+
+type parser struct {
+	data []byte
+	i    int
+}
+
+func (p *parser) consume(c byte) bool {
+	if p.i < len(p.data) && p.data[p.i] == c {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) number(maxDigits int) (int, bool) {
+	start := p.i
+	for p.i < len(p.data) && p.i-start < maxDigits && p.data[p.i] >= '0' && p.data[p.i] <= '9' {
+		p.i++
+	}
+	if p.i == start {
+		return 0, false
+	}
+	n, err := strconv.Atoi(string(p.data[start:p.i]))
+	return n, err == nil
+}
+
+// field returns the next space terminated header field, "-" is returned as empty.
+func (p *parser) field() (string, bool) {
+	end := bytes.IndexByte(p.data[p.i:], ' ')
+	if end <= 0 {
+		return "", false
+	}
+	value := string(p.data[p.i : p.i+end])
+	p.i += end + 1
+	if value == "-" {
+		return "", true
+	}
+	return value, true
+}
+
+// structuredData returns the structured data elements as they are, "-" is returned as empty. Inside of param values
+// "]" can be escaped with a backslash.
+func (p *parser) structuredData() (string, bool) {
+	if p.consume('-') {
+		return "", true
+	}
+	start := p.i
+	for p.i < len(p.data) && p.data[p.i] == '[' {
+		inValue := false
+		for p.i++; ; p.i++ {
+			if p.i >= len(p.data) {
+				return "", false
+			}
+			c := p.data[p.i]
+			if inValue && c == '\\' {
+				p.i++
+				continue
+			}
+			if c == '"' {
+				inValue = !inValue
+				continue
+			}
+			if c == ']' && !inValue {
+				p.i++
+				break
+			}
+		}
+	}
+	if p.i == start {
+		return "", false
+	}
+	return string(p.data[start:p.i]), true
+}
+
+// Split is a bufio.SplitFunc for syslog over TCP. It supports octet counting framing, where every message starts with
+// its length, and messages terminated by a line break like described in RFC 6587.
+func Split(data []byte, atEOF bool) (int, []byte, error) {
+	if len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if data[0] >= '1' && data[0] <= '9' {
+		space := bytes.IndexByte(data, ' ')
+		if space == -1 {
+			if atEOF || len(data) > 10 {
+				return 0, nil, ErrInvalidMessage
+			}
+			return 0, nil, nil
+		}
+		length, err := strconv.Atoi(string(data[:space]))
+		if err != nil || length <= 0 {
+			return 0, nil, ErrInvalidMessage
+		}
+		if len(data) < space+1+length {
+			if atEOF {
+				return 0, nil, ErrInvalidMessage
+			}
+			return 0, nil, nil
+		}
+		return space + 1 + length, data[space+1 : space+1+length], nil
+	}
+
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
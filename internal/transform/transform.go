@@ -0,0 +1,176 @@
+// Package transform decodes encoded payloads like base64 or JWTs for viewing them. Decoded binary data is shown as hex
+// dump, so the result is always printable text.
+package transform
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	Base64Decode = "base64-decode"
+	HexDecode    = "hex-decode"
+	JWTDecode    = "jwt-decode"
+	URLDecode    = "url-decode"
+)
+
+// Names are the names of all transforms.
+var Names = []string{Base64Decode, HexDecode, JWTDecode, URLDecode}
+
+var (
+	ErrUnknown  = errors.New("unknown transform")
+	ErrTooLarge = errors.New("content is too large to transform")
+)
+
+// Result is the decoded content with the language to highlight it with.
+type Result struct {
+	Content  string
+	Language string
+}
+
+// Apply decodes the content with the transform. Content larger than maxSize bytes is rejected, 0 disables the limit.
+func Apply(name string, content string, maxSize int) (*Result, error) {
+	if maxSize > 0 && len(content) > maxSize {
+		return nil, ErrTooLarge
+	}
+
+	var (
+		result *Result
+		err    error
+	)
+	switch name {
+	case Base64Decode:
+		result, err = base64Decode(content)
+	case HexDecode:
+		result, err = hexDecode(content)
+	case JWTDecode:
+		result, err = jwtDecode(content)
+	case URLDecode:
+		result, err = urlDecode(content)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknown, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to %s: %w", strings.ReplaceAll(name, "-", " "), err)
+	}
+	return result, nil
+}
+
+func base64Decode(content string) (*Result, error) {
+	content = removeSpace(content)
+	// standard and url alphabets are accepted with and without padding
+	content = strings.NewReplacer("-", "+", "_", "/").Replace(strings.TrimRight(content, "="))
+	data, err := base64.RawStdEncoding.DecodeString(content)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(data), nil
+}
+
+func hexDecode(content string) (*Result, error) {
+	content = removeSpace(content)
+	content = strings.TrimPrefix(strings.TrimPrefix(content, "0x"), "0X")
+	data, err := hex.DecodeString(content)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(data), nil
+}
+
+// jwtDecode decodes the header and the payload of a JWT. The signature is not verified.
+func jwtDecode(content string) (*Result, error) {
+	parts := strings.Split(removeSpace(content), ".")
+	if len(parts) != 3 {
+		return nil, errors.New("a JWT has three parts separated by dots")
+	}
+
+	decoded := make(map[string]json.RawMessage, 2)
+	for i, name := range []string{"header", "payload"} {
+		data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[i], "="))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		if !json.Valid(data) {
+			return nil, fmt.Errorf("invalid %s: not JSON", name)
+		}
+		decoded[name] = data
+	}
+
+	data, err := json.MarshalIndent(struct {
+		Header    json.RawMessage `json:"header"`
+		Payload   json.RawMessage `json:"payload"`
+		Signature string          `json:"signature"`
+	}{
+		Header:    decoded["header"],
+		Payload:   decoded["payload"],
+		Signature: parts[2],
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return &Result{
+		Content:  string(data),
+		Language: "JSON",
+	}, nil
+}
+
+func urlDecode(content string) (*Result, error) {
+	decoded, err := url.QueryUnescape(content)
+	if err != nil {
+		return nil, err
+	}
+	return newResult([]byte(decoded)), nil
+}
+
+// newResult returns the decoded data as text if it is printable and as hex dump otherwise. Decoded JSON is indented.
+func newResult(data []byte) *Result {
+	if !isText(data) {
+		return &Result{
+			Content:  hex.Dump(data),
+			Language: "plaintext",
+		}
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed) {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, trimmed, "", "  "); err == nil {
+			return &Result{
+				Content:  buf.String(),
+				Language: "JSON",
+			}
+		}
+	}
+	return &Result{
+		Content:  string(data),
+		Language: "plaintext",
+	}
+}
+
+func isText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func removeSpace(content string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, content)
+}
@@ -0,0 +1,371 @@
+// Package vault is a minimal client of HashiCorp Vault and OpenBao. It reads secrets of the KV v2 secrets engine and
+// dynamic credentials of the database secrets engine and keeps its token and the credentials renewed.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+)
+
+// minRenewInterval prevents renewing in a loop when Vault returns very short TTLs.
+const minRenewInterval = 5 * time.Second
+
+var ErrNoCredentials = errors.New("vault returned no database credentials")
+
+type Config struct {
+	Address   string
+	Namespace string
+	// Token is used if it is set, otherwise the client logs in with the AppRole.
+	Token    string
+	RoleID   string
+	SecretID string
+	Timeout  time.Duration
+}
+
+// New logs in to Vault. Call Run to keep the token and the database credentials renewed.
+func New(ctx context.Context, cfg Config) (*Client, error) {
+	c := &Client{
+		cfg: cfg,
+		client: &http.Client{
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+			Timeout:   cfg.Timeout,
+		},
+	}
+	if err := c.login(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+type Client struct {
+	cfg    Config
+	client *http.Client
+
+	mu    sync.Mutex
+	token lease
+	// databasePath is the path of the credentials of the database role, credentials are only renewed if it is set.
+	databasePath string
+	credentials  DatabaseCredentials
+	database     lease
+}
+
+// DatabaseCredentials are the dynamic credentials of a role of the database secrets engine.
+type DatabaseCredentials struct {
+	Username string
+	Password string
+	// Lease is how long the credentials are valid if they are not renewed.
+	Lease time.Duration
+}
+
+type lease struct {
+	id        string
+	duration  time.Duration
+	renewable bool
+	renewAt   time.Time
+}
+
+func newLease(id string, seconds int, renewable bool) lease {
+	duration := time.Duration(seconds) * time.Second
+	return lease{
+		id:        id,
+		duration:  duration,
+		renewable: renewable,
+		// renew after two thirds of the lease like the Vault agent does
+		renewAt: time.Now().Add(max(duration*2/3, minRenewInterval)),
+	}
+}
+
+type response struct {
+	LeaseID       string          `json:"lease_id"`
+	LeaseDuration int             `json:"lease_duration"`
+	Renewable     bool            `json:"renewable"`
+	Data          json.RawMessage `json:"data"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+}
+
+// Token returns the current token, it changes when the client logs in again.
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token.id
+}
+
+func (c *Client) login(ctx context.Context) error {
+	if c.cfg.Token != "" {
+		var data struct {
+			TTL       int  `json:"ttl"`
+			Renewable bool `json:"renewable"`
+		}
+		rs, err := c.do(ctx, c.cfg.Token, http.MethodGet, "auth/token/lookup-self", nil)
+		if err != nil {
+			return fmt.Errorf("failed to look up vault token: %w", err)
+		}
+		if err = json.Unmarshal(rs.Data, &data); err != nil {
+			return fmt.Errorf("failed to decode vault token: %w", err)
+		}
+		c.setToken(newLease(c.cfg.Token, data.TTL, data.Renewable))
+		return nil
+	}
+
+	rs, err := c.do(ctx, "", http.MethodPost, "auth/approle/login", map[string]string{
+		"role_id":   c.cfg.RoleID,
+		"secret_id": c.cfg.SecretID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to log in to vault: %w", err)
+	}
+	if rs.Auth == nil {
+		return errors.New("failed to log in to vault: no token returned")
+	}
+	c.setToken(newLease(rs.Auth.ClientToken, rs.Auth.LeaseDuration, rs.Auth.Renewable))
+	return nil
+}
+
+func (c *Client) setToken(token lease) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+// ReadSecret reads the latest version of a secret of the KV v2 secrets engine.
+func (c *Client) ReadSecret(ctx context.Context, mount string, path string) (map[string]string, error) {
+	rs, err := c.do(ctx, c.Token(), http.MethodGet, strings.Trim(mount, "/")+"/data/"+strings.Trim(path, "/"), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault secret: %w", err)
+	}
+	var data struct {
+		Data map[string]any `json:"data"`
+	}
+	if err = json.Unmarshal(rs.Data, &data); err != nil {
+		return nil, fmt.Errorf("failed to decode vault secret: %w", err)
+	}
+
+	secret := make(map[string]string, len(data.Data))
+	for key, value := range data.Data {
+		secret[key] = fmt.Sprint(value)
+	}
+	return secret, nil
+}
+
+// DatabaseCredentials creates credentials of a role of the database secrets engine. Run renews them and creates new
+// ones once they can't be renewed anymore.
+func (c *Client) DatabaseCredentials(ctx context.Context, mount string, role string) (DatabaseCredentials, error) {
+	c.mu.Lock()
+	c.databasePath = strings.Trim(mount, "/") + "/creds/" + strings.Trim(role, "/")
+	c.mu.Unlock()
+	if err := c.createDatabaseCredentials(ctx); err != nil {
+		return DatabaseCredentials{}, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.credentials, nil
+}
+
+// Credentials returns the current username and password of the database role.
+func (c *Client) Credentials() (string, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.credentials.Username, c.credentials.Password
+}
+
+func (c *Client) createDatabaseCredentials(ctx context.Context) error {
+	c.mu.Lock()
+	path := c.databasePath
+	c.mu.Unlock()
+
+	rs, err := c.do(ctx, c.Token(), http.MethodGet, path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create database credentials: %w", err)
+	}
+	var data struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err = json.Unmarshal(rs.Data, &data); err != nil {
+		return fmt.Errorf("failed to decode database credentials: %w", err)
+	}
+	if data.Username == "" {
+		return ErrNoCredentials
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.database = newLease(rs.LeaseID, rs.LeaseDuration, rs.Renewable)
+	c.credentials = DatabaseCredentials{
+		Username: data.Username,
+		Password: data.Password,
+		Lease:    c.database.duration,
+	}
+	return nil
+}
+
+// Run renews the token and the database credentials until the context is done. Tokens which can't be renewed anymore
+// are replaced by logging in again and credentials by new ones, existing database connections keep working until
+// their lease expires.
+func (c *Client) Run(ctx context.Context) {
+	for {
+		c.mu.Lock()
+		next := c.token.renewAt
+		if !c.token.renewable && c.cfg.Token != "" {
+			// static tokens which can't be renewed are used until they expire
+			next = time.Time{}
+		}
+		if c.databasePath != "" && (next.IsZero() || c.database.renewAt.Before(next)) {
+			next = c.database.renewAt
+		}
+		c.mu.Unlock()
+		if next.IsZero() {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+
+		if err := c.renewToken(ctx); err != nil {
+			slog.ErrorContext(ctx, "failed to renew vault token", slog.Any("err", err))
+		}
+		if err := c.renewDatabaseCredentials(ctx); err != nil {
+			slog.ErrorContext(ctx, "failed to renew database credentials", slog.Any("err", err))
+		}
+	}
+}
+
+func (c *Client) renewToken(ctx context.Context) error {
+	c.mu.Lock()
+	token := c.token
+	c.mu.Unlock()
+	if time.Now().Before(token.renewAt) {
+		return nil
+	}
+
+	if token.renewable {
+		rs, err := c.do(ctx, token.id, http.MethodPost, "auth/token/renew-self", nil)
+		// the token can't be renewed for the whole duration anymore once it reaches its max TTL
+		if err == nil && rs.Auth != nil && time.Duration(rs.Auth.LeaseDuration)*time.Second >= token.duration/2 {
+			c.setToken(newLease(token.id, rs.Auth.LeaseDuration, rs.Auth.Renewable))
+			return nil
+		}
+		if c.cfg.Token != "" {
+			if err != nil {
+				return err
+			}
+			if rs.Auth != nil {
+				c.setToken(newLease(token.id, rs.Auth.LeaseDuration, rs.Auth.Renewable))
+			}
+			return nil
+		}
+	}
+	if c.cfg.Token != "" {
+		return nil
+	}
+	return c.login(ctx)
+}
+
+func (c *Client) renewDatabaseCredentials(ctx context.Context) error {
+	c.mu.Lock()
+	path, database := c.databasePath, c.database
+	c.mu.Unlock()
+	if path == "" || time.Now().Before(database.renewAt) {
+		return nil
+	}
+
+	if database.renewable {
+		rs, err := c.do(ctx, c.Token(), http.MethodPut, "sys/leases/renew", map[string]any{
+			"lease_id":  database.id,
+			"increment": int(database.duration.Seconds()),
+		})
+		if err == nil && time.Duration(rs.LeaseDuration)*time.Second >= database.duration/2 {
+			c.mu.Lock()
+			c.database = newLease(database.id, rs.LeaseDuration, rs.Renewable)
+			c.mu.Unlock()
+			return nil
+		}
+		if err != nil {
+			slog.WarnContext(ctx, "failed to renew database credentials, creating new ones", slog.Any("err", err))
+		}
+	}
+	return c.createDatabaseCredentials(ctx)
+}
+
+// Close revokes the database credentials and the token if it was created by logging in.
+func (c *Client) Close(ctx context.Context) {
+	c.mu.Lock()
+	token, database := c.token.id, c.database.id
+	c.mu.Unlock()
+
+	if database != "" {
+		if _, err := c.do(ctx, token, http.MethodPut, "sys/leases/revoke", map[string]string{"lease_id": database}); err != nil {
+			slog.ErrorContext(ctx, "failed to revoke database credentials", slog.Any("err", err))
+		}
+	}
+	if c.cfg.Token == "" {
+		if _, err := c.do(ctx, token, http.MethodPost, "auth/token/revoke-self", nil); err != nil {
+			slog.ErrorContext(ctx, "failed to revoke vault token", slog.Any("err", err))
+		}
+	}
+}
+
+func (c *Client) do(ctx context.Context, token string, method string, path string, body any) (*response, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		bodyReader = bytes.NewReader(data)
+	}
+
+	rq, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.cfg.Address, "/")+"/v1/"+path, bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		rq.Header.Set(ezhttp.HeaderContentType, ezhttp.ContentTypeJSON)
+	}
+	if token != "" {
+		rq.Header.Set("X-Vault-Token", token)
+	}
+	if c.cfg.Namespace != "" {
+		rq.Header.Set("X-Vault-Namespace", c.cfg.Namespace)
+	}
+
+	rs, err := c.client.Do(rq)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode == http.StatusNoContent {
+		return &response{}, nil
+	}
+	if rs.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(rs.Body, 1024))
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, rs.Status, bytes.TrimSpace(msg))
+	}
+
+	var vaultResponse response
+	if err = json.NewDecoder(rs.Body).Decode(&vaultResponse); err != nil {
+		return nil, err
+	}
+	return &vaultResponse, nil
+}
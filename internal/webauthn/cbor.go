@@ -0,0 +1,120 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// maxCBORDepth limits the nesting of arrays and maps, authenticator data never nests deeply.
+const maxCBORDepth = 16
+
+var ErrInvalidCBOR = errors.New("invalid cbor")
+
+// decodeCBOR decodes the first CBOR item of data and returns it with the remaining bytes. It only supports what
+// authenticators send: integers as int64, byte and text strings, arrays, maps, tags and the simple values false, true
+// and null. Indefinite lengths and floats are rejected.
+func decodeCBOR(data []byte) (any, []byte, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (any, []byte, error) {
+	if depth > maxCBORDepth {
+		return nil, nil, fmt.Errorf("%w: nested too deep", ErrInvalidCBOR)
+	}
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("%w: unexpected end", ErrInvalidCBOR)
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+	data = data[1:]
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22:
+			return nil, data, nil
+		default:
+			return nil, nil, fmt.Errorf("%w: unsupported simple value %d", ErrInvalidCBOR, info)
+		}
+	}
+
+	var value uint64
+	switch {
+	case info < 24:
+		value = uint64(info)
+	case info == 24 && len(data) >= 1:
+		value, data = uint64(data[0]), data[1:]
+	case info == 25 && len(data) >= 2:
+		value, data = uint64(binary.BigEndian.Uint16(data)), data[2:]
+	case info == 26 && len(data) >= 4:
+		value, data = uint64(binary.BigEndian.Uint32(data)), data[4:]
+	case info == 27 && len(data) >= 8:
+		value, data = binary.BigEndian.Uint64(data), data[8:]
+	default:
+		return nil, nil, fmt.Errorf("%w: unsupported length %d", ErrInvalidCBOR, info)
+	}
+
+	switch major {
+	case 0:
+		if value > 1<<63-1 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", ErrInvalidCBOR)
+		}
+		return int64(value), data, nil
+	case 1:
+		if value > 1<<63-1 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", ErrInvalidCBOR)
+		}
+		return -1 - int64(value), data, nil
+	case 2, 3:
+		if value > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("%w: unexpected end", ErrInvalidCBOR)
+		}
+		if major == 2 {
+			return data[:value], data[value:], nil
+		}
+		return string(data[:value]), data[value:], nil
+	case 4:
+		// every item needs at least one byte
+		if value > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("%w: unexpected end", ErrInvalidCBOR)
+		}
+		items := make([]any, value)
+		for i := range items {
+			var err error
+			if items[i], data, err = decodeCBORItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+		}
+		return items, data, nil
+	case 5:
+		if value > uint64(len(data))/2 {
+			return nil, nil, fmt.Errorf("%w: unexpected end", ErrInvalidCBOR)
+		}
+		items := make(map[any]any, value)
+		for range value {
+			key, rest, err := decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("%w: unsupported map key %T", ErrInvalidCBOR, key)
+			}
+			if items[key], data, err = decodeCBORItem(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+		}
+		return items, data, nil
+	case 6:
+		// tags only annotate the item which follows
+		return decodeCBORItem(data, depth+1)
+	default:
+		return nil, nil, fmt.Errorf("%w: unsupported major type %d", ErrInvalidCBOR, major)
+	}
+}
@@ -0,0 +1,268 @@
+// Package webauthn verifies the passkey registrations and assertions of the Web Authentication API. Attestation
+// statements are not verified, passkeys are a second factor of an account and not used to prove the authenticator
+// model, so registrations are requested with the attestation none.
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+)
+
+// The flags of the authenticator data.
+const (
+	flagUserPresent  = 0x01
+	flagAttestedData = 0x40
+)
+
+// The COSE algorithms of the supported public keys.
+const (
+	AlgorithmES256 = -7
+	AlgorithmEdDSA = -8
+	AlgorithmRS256 = -257
+)
+
+// Algorithms are the COSE algorithms passkeys can be registered with, in order of preference.
+var Algorithms = []int{AlgorithmES256, AlgorithmEdDSA, AlgorithmRS256}
+
+var (
+	ErrInvalidClientData        = errors.New("invalid client data")
+	ErrInvalidAuthenticatorData = errors.New("invalid authenticator data")
+	ErrInvalidPublicKey         = errors.New("invalid or unsupported public key")
+	ErrInvalidSignature         = errors.New("invalid signature")
+	ErrSignCount                = errors.New("sign count didn't increase, the passkey may be cloned")
+)
+
+// Relying is the relying party passkeys are registered for. ID is the domain of the site and Host the host of the
+// origin the browser reports, like xgob.in for both.
+type Relying struct {
+	ID   string
+	Host string
+}
+
+// Credential is a registered passkey.
+type Credential struct {
+	ID []byte
+	// PublicKey is the COSE encoded public key.
+	PublicKey []byte
+	SignCount uint32
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type authenticatorData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+	// credentialID and publicKey are only set during the registration.
+	credentialID []byte
+	publicKey    []byte
+}
+
+// Register verifies the response of navigator.credentials.create and returns the new passkey.
+func (rp Relying) Register(challenge []byte, clientDataJSON []byte, attestationObject []byte) (*Credential, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	object, rest, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, err
+	}
+	attestation, ok := object.(map[any]any)
+	if !ok || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: invalid attestation object", ErrInvalidAuthenticatorData)
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing authData", ErrInvalidAuthenticatorData)
+	}
+
+	authData, err := rp.verifyAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.credentialID == nil {
+		return nil, fmt.Errorf("%w: missing attested credential", ErrInvalidAuthenticatorData)
+	}
+	if _, err = parsePublicKey(authData.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:        authData.credentialID,
+		PublicKey: authData.publicKey,
+		SignCount: authData.signCount,
+	}, nil
+}
+
+// Verify verifies the response of navigator.credentials.get with the passkey and returns its new sign count.
+func (rp Relying) Verify(credential Credential, challenge []byte, clientDataJSON []byte, rawAuthData []byte, signature []byte) (uint32, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+	authData, err := rp.verifyAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+
+	publicKey, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(bytes.Clone(rawAuthData), clientDataHash[:]...)
+	if !verifySignature(publicKey, signed, signature) {
+		return 0, ErrInvalidSignature
+	}
+
+	// authenticators without a counter always send 0
+	if (authData.signCount != 0 || credential.SignCount != 0) && authData.signCount <= credential.SignCount {
+		return 0, ErrSignCount
+	}
+	return authData.signCount, nil
+}
+
+func (rp Relying) verifyClientData(clientDataJSON []byte, typ string, challenge []byte) error {
+	var data clientData
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidClientData, err)
+	}
+	if data.Type != typ {
+		return fmt.Errorf("%w: unexpected type %s", ErrInvalidClientData, data.Type)
+	}
+	received, err := base64.RawURLEncoding.DecodeString(data.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(received, challenge) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrInvalidClientData)
+	}
+	origin, err := url.Parse(data.Origin)
+	if err != nil || origin.Host != rp.Host {
+		return fmt.Errorf("%w: unexpected origin %s", ErrInvalidClientData, data.Origin)
+	}
+	return nil
+}
+
+// verifyAuthenticatorData parses the authenticator data and checks that it belongs to the relying party and the user
+// was present.
+func (rp Relying) verifyAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, fmt.Errorf("%w: too short", ErrInvalidAuthenticatorData)
+	}
+	authData := authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(authData.rpIDHash, rpIDHash[:]) != 1 {
+		return nil, fmt.Errorf("%w: registered for another site", ErrInvalidAuthenticatorData)
+	}
+	if authData.flags&flagUserPresent == 0 {
+		return nil, fmt.Errorf("%w: user not present", ErrInvalidAuthenticatorData)
+	}
+
+	if authData.flags&flagAttestedData != 0 {
+		// aaguid (16), credential id length (2), credential id, public key
+		rest := data[37:]
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("%w: attested credential too short", ErrInvalidAuthenticatorData)
+		}
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < idLength {
+			return nil, fmt.Errorf("%w: attested credential too short", ErrInvalidAuthenticatorData)
+		}
+		authData.credentialID = rest[:idLength]
+		rest = rest[idLength:]
+		_, extensions, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, err
+		}
+		authData.publicKey = rest[:len(rest)-len(extensions)]
+	}
+	return &authData, nil
+}
+
+// parsePublicKey returns the public key of the COSE key.
+func parsePublicKey(data []byte) (crypto.PublicKey, error) {
+	value, _, err := decodeCBOR(data)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := value.(map[any]any)
+	if !ok {
+		return nil, ErrInvalidPublicKey
+	}
+
+	alg, _ := key[int64(3)].(int64)
+	switch alg {
+	case AlgorithmES256:
+		x, xOK := key[int64(-2)].([]byte)
+		y, yOK := key[int64(-3)].([]byte)
+		if crv, _ := key[int64(-1)].(int64); crv != 1 || !xOK || !yOK {
+			return nil, ErrInvalidPublicKey
+		}
+		publicKey := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if _, err = publicKey.ECDH(); err != nil {
+			return nil, ErrInvalidPublicKey
+		}
+		return publicKey, nil
+	case AlgorithmEdDSA:
+		x, xOK := key[int64(-2)].([]byte)
+		if crv, _ := key[int64(-1)].(int64); crv != 6 || !xOK || len(x) != ed25519.PublicKeySize {
+			return nil, ErrInvalidPublicKey
+		}
+		return ed25519.PublicKey(x), nil
+	case AlgorithmRS256:
+		n, nOK := key[int64(-1)].([]byte)
+		e, eOK := key[int64(-2)].([]byte)
+		if !nOK || !eOK || len(e) > 4 {
+			return nil, ErrInvalidPublicKey
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 {
+			return nil, ErrInvalidPublicKey
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(exponent.Int64()),
+		}, nil
+	default:
+		return nil, ErrInvalidPublicKey
+	}
+}
+
+func verifySignature(publicKey crypto.PublicKey, data []byte, signature []byte) bool {
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		hash := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, hash[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		hash := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature) == nil
+	default:
+		return false
+	}
+}
@@ -3,28 +3,36 @@ package main
 import (
 	"context"
 	"embed"
+	"errors"
 	"flag"
+	"fmt"
 	"io/fs"
 	"log/slog"
-	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/charmbracelet/log"
-	"github.com/go-jose/go-jose/v3"
 	"github.com/topi314/chroma/v2/formatters"
 	"github.com/topi314/chroma/v2/formatters/html"
 	"github.com/topi314/chroma/v2/lexers"
 	"github.com/topi314/chroma/v2/styles"
 
+	"github.com/topi314/gobin/v3/internal/crypt"
+	"github.com/topi314/gobin/v3/internal/render"
+	"github.com/topi314/gobin/v3/internal/vault"
 	"github.com/topi314/gobin/v3/internal/ver"
 	"github.com/topi314/gobin/v3/server"
 	"github.com/topi314/gobin/v3/server/database"
+	"github.com/topi314/gobin/v3/server/featureflags"
+	"github.com/topi314/gobin/v3/server/storage"
+	"github.com/topi314/gobin/v3/server/summary"
 )
 
 //go:generate go run github.com/a-h/templ/cmd/templ@latest generate
+//go:generate sh -c "GOOS=js GOARCH=wasm go build -o server/assets/render.wasm ./wasm"
+//go:generate sh -c "cp \"$(go env GOROOT)/lib/wasm/wasm_exec.js\" server/assets/wasm_exec.js"
 
 var (
 	//go:embed server/assets
@@ -41,6 +49,48 @@ func main() {
 	cfgPath := flag.String("config", "gobin.toml", "path to gobin.toml")
 	flag.Parse()
 
+	// sandboxed hooks are executed through gobin, the error is read from stderr by the hook runner
+	if flag.Arg(0) == server.HookSandboxCommand {
+		if err := server.RunHookSandbox(flag.Args()[1:]); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var publish *publishCommand
+	if flag.Arg(0) == "publish" {
+		var err error
+		if publish, err = parsePublishCommand(flag.Args()[1:]); err != nil {
+			if !errors.Is(err, flag.ErrHelp) {
+				slog.Error("Error while parsing publish command", slog.Any("err", err))
+			}
+			return
+		}
+	}
+
+	var backup *backupCommand
+	if isBackupCommand(flag.Arg(0)) {
+		var err error
+		if backup, err = parseBackupCommand(flag.Arg(0), flag.Args()[1:]); err != nil {
+			if !errors.Is(err, flag.ErrHelp) {
+				slog.Error("Error while parsing backup command", slog.Any("err", err))
+			}
+			return
+		}
+	}
+
+	var compress *compressCommand
+	if flag.Arg(0) == "compress" {
+		var err error
+		if compress, err = parseCompressCommand(flag.Args()[1:]); err != nil {
+			if !errors.Is(err, flag.ErrHelp) {
+				slog.Error("Error while parsing compress command", slog.Any("err", err))
+			}
+			return
+		}
+	}
+
 	cfg, err := server.LoadConfig(*cfgPath)
 	if err != nil {
 		slog.Error("Error while loading config", slog.Any("err", err))
@@ -59,6 +109,23 @@ func main() {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
+
+	var vaultClient *vault.Client
+	if cfg.Vault.Enabled {
+		if vaultClient, err = server.NewVault(ctx, &cfg); err != nil {
+			slog.Error("Error while connecting to vault", slog.Any("err", err))
+			return
+		}
+		vaultCtx, vaultCancel := context.WithCancel(context.Background())
+		go vaultClient.Run(vaultCtx)
+		defer func() {
+			vaultCancel()
+			closeCtx, closeCancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer closeCancel()
+			vaultClient.Close(closeCtx)
+		}()
+	}
+
 	db, err := database.New(ctx, cfg.Database, Migrations)
 	if err != nil {
 		slog.Error("Error while connecting to database", slog.Any("err", err))
@@ -70,26 +137,92 @@ func main() {
 		}
 	}()
 
-	signer, err := jose.NewSigner(jose.SigningKey{
-		Algorithm: jose.HS512,
-		Key:       []byte(cfg.JWTSecret),
-	}, nil)
+	if cfg.Database.Deduplicate && cfg.Search.Enabled {
+		slog.Warn("Full-text search doesn't find deduplicated file contents")
+	}
+
+	secrets, err := server.NewSecrets(cfg, vaultClient)
+	if err != nil {
+		slog.Error("Error while creating encryption", slog.Any("err", err))
+		return
+	}
+	if cfg.Encryption.Content {
+		if cfg.Search.Enabled {
+			slog.Warn("Full-text search only finds encrypted file contents by their file name")
+		}
+		db = database.NewEncryptedDB(db, secrets)
+	}
+	// contents are compressed before they are encrypted, compressed contents are decompressed even with compression off
+	compressedDB, err := database.NewCompressedDB(db, cfg.Database.Compression)
+	if err != nil {
+		slog.Error("Error while creating compression", slog.Any("err", err))
+		return
+	}
+	db = compressedDB
+	if cfg.Database.Compression && cfg.Search.Enabled {
+		slog.Warn("Full-text search only finds compressed file contents by their file name")
+	}
+	if compress != nil {
+		if err = compress.run(context.Background(), compressedDB); err != nil {
+			slog.Error("Error while running compress command", slog.Any("err", err))
+		}
+		return
+	}
+	if cfg.Database.DeltaVersions {
+		if cfg.Search.Enabled {
+			slog.Warn("Full-text search doesn't find file contents stored as delta")
+		}
+		db = database.NewDeltaDB(db, cfg.Database.DeltaSnapshotInterval)
+	}
+
+	store, err := storage.New(cfg.Storage)
 	if err != nil {
-		slog.Error("Error while creating signer", slog.Any("err", err))
+		slog.Error("Error while creating storage", slog.Any("err", err))
+		return
+	}
+	if store != nil {
+		if cfg.Search.Enabled {
+			slog.Warn("Full-text search only finds file contents which are stored in the database")
+		}
+		db = database.NewStorageDB(db, store)
+	}
+
+	if cfg.Shadow.Enabled {
+		shadowDB, err := newShadowDB(ctx, cfg, secrets)
+		if err != nil {
+			slog.Error("Error while connecting to shadow database", slog.Any("err", err))
+			return
+		}
+		if db, err = database.NewShadowDB(db, shadowDB, cfg.Shadow.CompareRate); err != nil {
+			slog.Error("Error while creating shadow database", slog.Any("err", err))
+			return
+		}
+	}
+
+	jwtKeys, err := server.NewJWTKeys(cfg)
+	if err != nil {
+		slog.Error("Error while loading jwt keys", slog.Any("err", err))
 		return
 	}
 
-	var assets http.FileSystem
 	if cfg.DevMode {
 		slog.Info("Development mode enabled")
-		assets = http.Dir("server")
+		if cfg.Assets.Dir == "" {
+			cfg.Assets.Dir = "server/assets"
+		}
+	}
+
+	var assets fs.FS
+	if cfg.Assets.Dir != "" {
+		slog.Info("Serving assets from disk", slog.String("dir", cfg.Assets.Dir))
+		assets = os.DirFS(cfg.Assets.Dir)
 	} else {
-		sub, err := fs.Sub(Assets, "server")
+		sub, err := fs.Sub(Assets, "server/assets")
 		if err != nil {
 			slog.Error("Failed to get sub fs for embedded assets", slog.Any("err", err))
 			return
 		}
-		assets = http.FS(sub)
+		assets = sub
 	}
 
 	loadEmbeddedStyles()
@@ -97,16 +230,7 @@ func main() {
 
 	styles.Fallback = styles.Get(cfg.DefaultStyle)
 	lexers.Fallback = lexers.Get("plaintext")
-	htmlFormatter := html.New(
-		html.WithClasses(true),
-		html.ClassPrefix("ch-"),
-		html.Standalone(false),
-		html.InlineCode(false),
-		html.WithNopPreWrapper(),
-		html.WithLineNumbers(true),
-		html.WithLinkableLineNumbers(true, "L"),
-		html.TabWidth(4),
-	)
+	htmlFormatter := render.NewHTMLFormatter()
 	standaloneHTMLFormatter := html.New(
 		html.Standalone(true),
 		html.WithLineNumbers(true),
@@ -116,7 +240,50 @@ func main() {
 	formatters.Register("html", htmlFormatter)
 	formatters.Register("html-standalone", standaloneHTMLFormatter)
 
-	s := server.NewServer(version, cfg.DevMode, cfg, db, signer, assets, htmlFormatter, standaloneHTMLFormatter)
+	plugins, err := server.LoadPlugins(context.Background(), cfg.Plugins)
+	if err != nil {
+		slog.Error("Error while loading plugins", slog.Any("err", err))
+		return
+	}
+
+	var summaryProvider summary.Provider
+	if cfg.Summary.Enabled {
+		summaryProvider, err = summary.New(cfg.Summary)
+		if err != nil {
+			slog.Error("Error while creating summary provider", slog.Any("err", err))
+			return
+		}
+	}
+
+	featureFlags, err := featureflags.New(cfg.FeatureFlags)
+	if err != nil {
+		slog.Error("Error while creating feature flags", slog.Any("err", err))
+		return
+	}
+
+	var ingestSource storage.Source
+	if cfg.Ingest.Enabled {
+		ingestSource, err = storage.NewS3Source(cfg.Ingest.S3)
+		if err != nil {
+			slog.Error("Error while creating ingest source", slog.Any("err", err))
+			return
+		}
+	}
+
+	s := server.NewServer(version, cfg.DevMode, cfg, db, jwtKeys, assets, htmlFormatter, standaloneHTMLFormatter, plugins, summaryProvider, ingestSource, secrets, featureFlags)
+	if publish != nil {
+		if err = publish.run(context.Background(), s, cfg.Storage.S3); err != nil {
+			slog.Error("Error while publishing document", slog.Any("err", err))
+		}
+		return
+	}
+	if backup != nil {
+		if err = backup.run(context.Background(), s, cfg.Tombstones); err != nil {
+			slog.Error("Error while running backup command", slog.Any("err", err))
+		}
+		return
+	}
+
 	slog.Info("Gobin started...", slog.String("address", cfg.ListenAddr))
 	go s.Start()
 	defer s.Close()
@@ -126,6 +293,36 @@ func main() {
 	<-si
 }
 
+// newShadowDB connects to the shadow database and storage, file contents are encrypted like in the primary database.
+func newShadowDB(ctx context.Context, cfg server.Config, secrets *crypt.Envelope) (database.DB, error) {
+	db, err := database.New(ctx, cfg.Shadow.Database, Migrations)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Encryption.Content {
+		db = database.NewEncryptedDB(db, secrets)
+	}
+	compressedDB, err := database.NewCompressedDB(db, cfg.Shadow.Database.Compression)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	db = compressedDB
+	if cfg.Shadow.Database.DeltaVersions {
+		db = database.NewDeltaDB(db, cfg.Shadow.Database.DeltaSnapshotInterval)
+	}
+
+	store, err := storage.New(cfg.Shadow.Storage)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if store != nil {
+		db = database.NewStorageDB(db, store)
+	}
+	return db, nil
+}
+
 func setupLogger(cfg server.LogConfig) {
 	var handler slog.Handler
 	switch cfg.Format {
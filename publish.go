@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/topi314/gobin/v3/server"
+	"github.com/topi314/gobin/v3/server/storage"
+)
+
+const (
+	publishTargetDir = "dir"
+	publishTargetS3  = "s3"
+)
+
+// publishCommand renders a document into static pages instead of starting the server.
+type publishCommand struct {
+	documentID  string
+	target      string
+	output      string
+	bucket      string
+	prefix      string
+	allVersions bool
+	style       string
+}
+
+func parsePublishCommand(args []string) (*publishCommand, error) {
+	cmd := &publishCommand{}
+	flags := flag.NewFlagSet("publish", flag.ContinueOnError)
+	flags.StringVar(&cmd.target, "target", publishTargetDir, "where to publish the document to (dir or s3)")
+	flags.StringVar(&cmd.output, "output", "public", "the directory to write the pages to, only used with the dir target")
+	flags.StringVar(&cmd.bucket, "bucket", "", "the bucket to upload the pages to, defaults to storage.s3.bucket, only used with the s3 target")
+	flags.StringVar(&cmd.prefix, "prefix", "", "put in front of the uploaded pages, only used with the s3 target")
+	flags.BoolVar(&cmd.allVersions, "all-versions", false, "publish every version instead of only the latest one")
+	flags.StringVar(&cmd.style, "style", "", "the style to highlight the document with, defaults to the style of the document")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(), "Usage: gobin [--config gobin.toml] publish <key> [flags]")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	// the key can come before or after the flags
+	if flags.NArg() > 0 {
+		cmd.documentID = flags.Arg(0)
+		if err := flags.Parse(flags.Args()[1:]); err != nil {
+			return nil, err
+		}
+	}
+	if cmd.documentID == "" {
+		return nil, errors.New("document key is required")
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %v", flags.Args())
+	}
+	if cmd.target != publishTargetDir && cmd.target != publishTargetS3 {
+		return nil, errors.New("invalid publish target, must be one of: dir, s3")
+	}
+	return cmd, nil
+}
+
+// run publishes the document with the S3 settings of the storage config.
+func (c *publishCommand) run(ctx context.Context, s *server.Server, cfg storage.S3Config) error {
+	var publisher storage.Publisher
+	switch c.target {
+	case publishTargetDir:
+		publisher = storage.NewDirPublisher(c.output)
+	case publishTargetS3:
+		if c.bucket != "" {
+			cfg.Bucket = c.bucket
+		}
+		cfg.Prefix = c.prefix
+		var err error
+		if publisher, err = storage.NewS3Publisher(cfg); err != nil {
+			return err
+		}
+	}
+
+	return s.Publish(ctx, c.documentID, server.PublishOptions{
+		AllVersions: c.allVersions,
+		Style:       c.style,
+	}, publisher)
+}
@@ -0,0 +1,449 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-jose/go-jose/v3/jwt"
+
+	"github.com/topi314/gobin/v3/internal/flags"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+const (
+	ScopeAccount = "account"
+
+	accountCookieName = "account"
+	loginCookieName   = "login"
+	loginCookieMaxAge = 10 * time.Minute
+
+	AccountSessionKindBrowser = "browser"
+	AccountSessionKindToken   = "token"
+
+	// accountSessionTouchInterval is how often the last use of a session is updated at most, so not every request
+	// writes to the database.
+	accountSessionTouchInterval = time.Minute
+)
+
+var (
+	ErrAccountsDisabled = errors.New("accounts are disabled")
+	ErrNotLoggedIn      = errors.New("not logged in")
+	ErrInvalidLogin     = errors.New("login expired or was started in another browser, please try again")
+)
+
+type (
+	AccountResponse struct {
+		ID        string    `json:"id"`
+		Name      string    `json:"name"`
+		Email     string    `json:"email"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	// loginClaims are stored in the login cookie between the redirect to the provider and the callback.
+	loginClaims struct {
+		jwt.Claims
+		Scope    string `json:"scp"`
+		State    string `json:"state"`
+		Nonce    string `json:"nonce"`
+		Verifier string `json:"verifier"`
+		Redirect string `json:"redirect"`
+	}
+)
+
+// getAccountID returns the account id from an account token or the account cookie of the browser or an empty string.
+func (s *Server) getAccountID(r *http.Request) string {
+	session := s.getAccountSession(r)
+	if session == nil {
+		return ""
+	}
+	return session.AccountID
+}
+
+// getAccountSession returns the session of the account token or the account cookie of the browser or nil if there is
+// none, it was revoked or the instance requires a second factor the session wasn't confirmed with.
+func (s *Server) getAccountSession(r *http.Request) *database.AccountSession {
+	session := s.lookupAccountSession(r)
+	if session == nil || (s.cfg.Accounts.RequireTwoFactor && !session.TwoFactor) {
+		return nil
+	}
+	return session
+}
+
+// lookupAccountSession returns the session of the account token or the account cookie of the browser or nil if there
+// is none or it was revoked. Only logging out and setting up a second factor use sessions without checking the policy.
+func (s *Server) lookupAccountSession(r *http.Request) *database.AccountSession {
+	if !s.cfg.Accounts.Enabled {
+		return nil
+	}
+
+	if claims := GetClaims(r); claims.Scope == ScopeAccount {
+		return s.useAccountSession(r, claims)
+	}
+
+	cookie, err := r.Cookie(accountCookieName)
+	if err != nil {
+		return nil
+	}
+	var claims Claims
+	if err = s.jwtKeys.Verify(cookie.Value, &claims); err != nil || claims.Scope != ScopeAccount {
+		return nil
+	}
+	return s.useAccountSession(r, claims)
+}
+
+// useAccountSession returns the session of the claims and updates when it was last used. Account tokens without a
+// session id were issued before sessions existed and are not accepted anymore, they couldn't be revoked.
+func (s *Server) useAccountSession(r *http.Request, claims Claims) *database.AccountSession {
+	if claims.ValidateWithLeeway(jwt.Expected{Time: time.Now()}, 0) != nil || claims.ID == "" {
+		return nil
+	}
+
+	session, err := s.db.GetAccountSession(r.Context(), claims.ID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(r.Context(), "failed to get account session", slog.Any("err", err))
+		}
+		return nil
+	}
+	if session.AccountID != claims.Subject {
+		return nil
+	}
+
+	if now := time.Now(); now.Sub(session.LastUsedAt) > accountSessionTouchInterval {
+		if err = s.db.TouchAccountSession(r.Context(), session.ID, now); err != nil {
+			slog.ErrorContext(r.Context(), "failed to touch account session", slog.Any("err", err))
+		}
+		session.LastUsedAt = now
+	}
+	return session
+}
+
+// newAccountToken creates a session for the account and returns its token which expires after the session ttl. It is
+// used as account cookie and as user token for the CLI and API clients. twoFactor is set if the login was confirmed
+// with a second factor or the token was issued by such a session. The webhooks of the account get a login event for
+// every new session.
+func (s *Server) newAccountToken(r *http.Request, accountID string, kind string, twoFactor bool) (string, time.Time, error) {
+	now := time.Now()
+	session := database.AccountSession{
+		ID:         rand.Text(),
+		AccountID:  accountID,
+		Kind:       kind,
+		UserAgent:  r.UserAgent(),
+		Address:    r.RemoteAddr,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(time.Duration(s.cfg.Accounts.SessionTTL)),
+		TwoFactor:  twoFactor,
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		session.Address = host
+	}
+
+	claims := newClaims(accountID, 0)
+	claims.ID = session.ID
+	claims.Scope = ScopeAccount
+	claims.Expiry = jwt.NewNumericDate(session.ExpiresAt)
+	token, err := jwt.Signed(s.signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create account token: %w", err)
+	}
+
+	if err = s.db.CreateAccountSession(r.Context(), session); err != nil {
+		return "", time.Time{}, err
+	}
+
+	s.ExecuteAccountWebhooks(r.Context(), accountID, WebhookEventLogin, newWebhookSession(session))
+	return token, session.ExpiresAt, nil
+}
+
+// getAccountClaims returns the claims the account has for the document, all permissions if it created the document or
+// the permissions of its membership. It returns nil if the account has no access to the document.
+func (s *Server) getAccountClaims(r *http.Request, accountID string, documentID string) (*Claims, error) {
+	owned, err := s.db.IsAccountDocument(r.Context(), accountID, documentID)
+	if err != nil {
+		return nil, err
+	}
+	if owned {
+		claims := newClaims(documentID, AllPermissions)
+		return &claims, nil
+	}
+
+	member, err := s.db.GetDocumentMember(r.Context(), documentID, accountID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get document member: %w", err)
+	}
+	claims := newClaims(documentID, Permissions(member.Permissions))
+	claims.Member = accountID
+	return &claims, nil
+}
+
+// DocumentClaimsMiddleware only keeps document tokens for the document of the route and gives logged-in accounts the
+// permissions they have for the document, so they don't need a token for it.
+func (s *Server) DocumentClaimsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		documentID := chi.URLParam(r, "documentID")
+		claims := GetClaims(r)
+		if claims.Scope == "" && claims.Subject != documentID {
+			claims = EmptyClaims(documentID)
+			r = SetClaims(r, claims)
+		}
+
+		if accountID := s.getAccountID(r); accountID != "" && documentID != "" {
+			accountClaims, err := s.getAccountClaims(r, accountID, documentID)
+			if err != nil {
+				s.error(w, r, err)
+				return
+			}
+			// a document token with more permissions than the account is kept
+			if accountClaims != nil && flags.Has(accountClaims.Permissions, claims.Permissions) {
+				r = SetClaims(r, *accountClaims)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// addAccountDocument makes the logged-in account the owner of the document.
+func (s *Server) addAccountDocument(r *http.Request, documentID string) {
+	accountID := s.getAccountID(r)
+	if accountID == "" {
+		return
+	}
+	if err := s.db.AddAccountDocument(r.Context(), accountID, documentID); err != nil {
+		slog.ErrorContext(r.Context(), "failed to add account document", slog.Any("err", err))
+	}
+}
+
+func (s *Server) accountRedirectURL(r *http.Request) string {
+	if s.cfg.Accounts.RedirectURL != "" {
+		return s.cfg.Accounts.RedirectURL
+	}
+	return "https://" + r.Host + "/login/callback"
+}
+
+// GetLogin redirects the browser to the provider to log in. The redirect query parameter is the local path the browser
+// returns to afterward.
+func (s *Server) GetLogin(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.Accounts.Enabled {
+		s.prettyError(w, r, httperr.NotFound(ErrAccountsDisabled))
+		return
+	}
+
+	redirect := r.URL.Query().Get("redirect")
+	// only local paths are allowed, so the login can't be used to redirect to other sites
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.HasPrefix(redirect, "/\\") {
+		redirect = "/"
+	}
+
+	claims := loginClaims{
+		Claims: jwt.Claims{
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+			Expiry:   jwt.NewNumericDate(time.Now().Add(loginCookieMaxAge)),
+		},
+		Scope:    loginCookieName,
+		State:    rand.Text(),
+		Nonce:    rand.Text(),
+		Verifier: rand.Text() + rand.Text(),
+		Redirect: redirect,
+	}
+	authURL, err := s.oidc.AuthCodeURL(r.Context(), s.accountRedirectURL(r), claims.State, claims.Nonce, claims.Verifier)
+	if err != nil {
+		s.prettyError(w, r, fmt.Errorf("failed to start login: %w", err))
+		return
+	}
+
+	token, err := jwt.Signed(s.signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		s.prettyError(w, r, fmt.Errorf("failed to create login cookie: %w", err))
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginCookieName,
+		Value:    token,
+		Path:     "/login",
+		MaxAge:   int(loginCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		// the callback is a navigation from the provider, so the cookie can't be strict
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// GetLoginCallback exchanges the code from the provider for the user, creates its account on the first login and sets
+// the account cookie. Accounts with a second factor confirm the login with it first, accounts without one are sent to
+// the settings to set one up if the instance requires it.
+func (s *Server) GetLoginCallback(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.Accounts.Enabled {
+		s.prettyError(w, r, httperr.NotFound(ErrAccountsDisabled))
+		return
+	}
+
+	login, err := s.getLoginClaims(r)
+	http.SetCookie(w, &http.Cookie{
+		Name:   loginCookieName,
+		Path:   "/login",
+		MaxAge: -1,
+	})
+	if err != nil {
+		s.prettyError(w, r, httperr.BadRequest(err))
+		return
+	}
+
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		s.prettyError(w, r, httperr.BadRequest(fmt.Errorf("login failed: %s %s", errCode, query.Get("error_description"))))
+		return
+	}
+	if query.Get("state") != login.State {
+		s.prettyError(w, r, httperr.BadRequest(ErrInvalidLogin))
+		return
+	}
+
+	user, err := s.oidc.Exchange(r.Context(), s.accountRedirectURL(r), query.Get("code"), login.Verifier, login.Nonce)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to log in", slog.Any("err", err))
+		s.prettyError(w, r, httperr.Unauthorized(errors.New("login failed")))
+		return
+	}
+
+	account, err := s.db.UpsertAccount(r.Context(), database.Account{
+		ID:        rand.Text(),
+		Issuer:    s.cfg.Accounts.Issuer,
+		Subject:   user.Subject,
+		Name:      user.DisplayName(),
+		Email:     user.Email,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		s.prettyError(w, r, err)
+		return
+	}
+
+	none, err := s.hasNoTwoFactor(r, account.ID)
+	if err != nil {
+		s.prettyError(w, r, err)
+		return
+	}
+	if !none {
+		s.startTwoFactorLogin(w, r, account.ID, login.Redirect)
+		return
+	}
+
+	token, expiresAt, err := s.newAccountToken(r, account.ID, AccountSessionKindBrowser, false)
+	if err != nil {
+		s.prettyError(w, r, err)
+		return
+	}
+	setAccountCookie(w, r, token, expiresAt)
+	if s.cfg.Accounts.RequireTwoFactor {
+		http.Redirect(w, r, "/settings#two-factor", http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, login.Redirect, http.StatusFound)
+}
+
+func setAccountCookie(w http.ResponseWriter, r *http.Request, token string, expiresAt time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     accountCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		// strict cookies aren't sent with the redirect after the login, lax still keeps them from cross-site requests
+		// which change documents
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (s *Server) getLoginClaims(r *http.Request) (*loginClaims, error) {
+	cookie, err := r.Cookie(loginCookieName)
+	if err != nil {
+		return nil, ErrInvalidLogin
+	}
+	var claims loginClaims
+	if err = s.jwtKeys.Verify(cookie.Value, &claims); err != nil || claims.Scope != loginCookieName {
+		return nil, ErrInvalidLogin
+	}
+	if err = claims.ValidateWithLeeway(jwt.Expected{Time: time.Now()}, 0); err != nil {
+		return nil, ErrInvalidLogin
+	}
+	return &claims, nil
+}
+
+// PostLogout deletes the session and the account cookie of the browser.
+func (s *Server) PostLogout(w http.ResponseWriter, r *http.Request) {
+	if session := s.lookupAccountSession(r); session != nil {
+		if err := s.db.DeleteAccountSession(r.Context(), session.AccountID, session.ID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, err)
+			return
+		}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     accountCookieName,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+	s.ok(w, r, nil)
+}
+
+// GetAccount returns the logged-in account.
+func (s *Server) GetAccount(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.Accounts.Enabled {
+		s.error(w, r, httperr.NotFound(ErrAccountsDisabled))
+		return
+	}
+
+	account, err := s.getAccount(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, AccountResponse{
+		ID:        account.ID,
+		Name:      account.Name,
+		Email:     account.Email,
+		CreatedAt: account.CreatedAt,
+	})
+}
+
+// requireAccountID returns the id of the logged-in account or an error if accounts are disabled, nobody is logged in or
+// the login lacks the second factor the instance requires.
+func (s *Server) requireAccountID(r *http.Request) (string, error) {
+	session, err := s.requireAccountSession(r)
+	if err != nil {
+		return "", err
+	}
+	return session.AccountID, nil
+}
+
+func (s *Server) getAccount(r *http.Request) (*database.Account, error) {
+	accountID := s.getAccountID(r)
+	if accountID == "" {
+		return nil, httperr.Unauthorized(ErrNotLoggedIn)
+	}
+	account, err := s.db.GetAccount(r.Context(), accountID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, httperr.Unauthorized(ErrNotLoggedIn)
+		}
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
+	return account, nil
+}
@@ -0,0 +1,597 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/topi314/gobin/v3/internal/activitypub"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/gio"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+const (
+	// activityPubOutboxLimit is how many posts the outbox shows.
+	activityPubOutboxLimit = 20
+	// activityPubMaxActivitySize limits the size of activities posted to the inbox and of fetched actors.
+	activityPubMaxActivitySize = 1024 * 1024
+)
+
+var (
+	ErrActivityPubDisabled        = errors.New("activitypub disabled")
+	ErrActivityPubUnknownResource = errors.New("unknown webfinger resource")
+	ErrActivityPubEncrypted       = errors.New("encrypted documents can't be public")
+	ErrActivityPubActorMismatch   = errors.New("activity actor does not match the signature")
+	ErrActivityPubNoteNotFound    = errors.New("activitypub note not found")
+)
+
+// activityPub is the single actor of the server which announces public documents to its followers.
+type activityPub struct {
+	client       *http.Client
+	key          *rsa.PrivateKey
+	publicKeyPEM string
+}
+
+func newActivityPub(cfg ActivityPubConfig) (*activityPub, error) {
+	key, err := activitypub.LoadOrCreatePrivateKey(cfg.PrivateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	publicKeyPEM, err := activitypub.PublicKeyPEM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &activityPub{
+		client: &http.Client{
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+			Timeout:   time.Duration(cfg.Timeout),
+		},
+		key:          key,
+		publicKeyPEM: publicKeyPEM,
+	}, nil
+}
+
+// activityPubURL returns the url of the path below /activitypub of the public url of the server.
+func (s *Server) activityPubURL(segments ...string) string {
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.TrimSuffix(s.cfg.ActivityPub.BaseURL, "/") + "/activitypub/" + strings.Join(segments, "/")
+}
+
+func (s *Server) activityPubActorID() string {
+	return s.activityPubURL("actor")
+}
+
+func (s *Server) activityJSON(w http.ResponseWriter, r *http.Request, v any, contentType string) {
+	w.Header().Set(ezhttp.HeaderContentType, contentType)
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(v); err != nil && !errors.Is(err, http.ErrHandlerTimeout) {
+		slog.ErrorContext(r.Context(), "failed to encode activitypub json", slog.Any("err", err))
+	}
+}
+
+// GetWebFinger resolves the account of the actor like acct:gobin@xgob.in, so fediverse users can search for it.
+func (s *Server) GetWebFinger(w http.ResponseWriter, r *http.Request) {
+	if s.activityPub == nil {
+		s.error(w, r, httperr.NotFound(ErrActivityPubDisabled))
+		return
+	}
+
+	baseURL, err := url.Parse(s.cfg.ActivityPub.BaseURL)
+	if err != nil {
+		s.error(w, r, fmt.Errorf("failed to parse activitypub base url: %w", err))
+		return
+	}
+	subject := "acct:" + s.cfg.ActivityPub.Username + "@" + baseURL.Host
+	actorID := s.activityPubActorID()
+	if resource := r.URL.Query().Get("resource"); !strings.EqualFold(resource, subject) && resource != actorID {
+		s.error(w, r, httperr.NotFound(ErrActivityPubUnknownResource))
+		return
+	}
+
+	s.activityJSON(w, r, activitypub.WebFinger{
+		Subject: subject,
+		Aliases: []string{actorID},
+		Links: []activitypub.WebFingerLink{
+			{
+				Rel:  activitypub.WebFingerSelfRel,
+				Type: activitypub.ContentType,
+				Href: actorID,
+			},
+			{
+				Rel:  activitypub.WebFingerProfilePageRel,
+				Type: "text/html",
+				Href: strings.TrimSuffix(s.cfg.ActivityPub.BaseURL, "/"),
+			},
+		},
+	}, activitypub.WebFingerContentType)
+}
+
+func (s *Server) GetActivityPubActor(w http.ResponseWriter, r *http.Request) {
+	if s.activityPub == nil {
+		s.error(w, r, httperr.NotFound(ErrActivityPubDisabled))
+		return
+	}
+
+	actorID := s.activityPubActorID()
+	baseURL := strings.TrimSuffix(s.cfg.ActivityPub.BaseURL, "/")
+	s.activityJSON(w, r, activitypub.Actor{
+		Context:           activitypub.Context,
+		ID:                actorID,
+		Type:              activitypub.TypeService,
+		PreferredUsername: s.cfg.ActivityPub.Username,
+		Name:              s.cfg.ActivityPub.Name,
+		Summary:           html.EscapeString(s.cfg.ActivityPub.Summary),
+		URL:               baseURL,
+		Icon: &activitypub.Image{
+			Type:      "Image",
+			MediaType: "image/png",
+			URL:       baseURL + "/favicon.png",
+		},
+		Inbox:        s.activityPubURL("inbox"),
+		Outbox:       s.activityPubURL("outbox"),
+		Followers:    s.activityPubURL("followers"),
+		Discoverable: true,
+		PublicKey: activitypub.PublicKey{
+			ID:           actorID + "#main-key",
+			Owner:        actorID,
+			PublicKeyPEM: s.activityPub.publicKeyPEM,
+		},
+		Endpoints: &activitypub.Endpoints{
+			SharedInbox: s.activityPubURL("inbox"),
+		},
+	}, activitypub.ContentType)
+}
+
+// GetActivityPubOutbox returns the newest posts of the actor.
+func (s *Server) GetActivityPubOutbox(w http.ResponseWriter, r *http.Request) {
+	if s.activityPub == nil {
+		s.error(w, r, httperr.NotFound(ErrActivityPubDisabled))
+		return
+	}
+
+	count, err := s.db.GetActivityPubNoteCount(r.Context())
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	notes, err := s.db.GetActivityPubNotes(r.Context(), activityPubOutboxLimit)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	activities := make([]activitypub.Activity, 0, len(notes))
+	for _, note := range notes {
+		activity, err := s.newActivityPubCreate(note)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+		activity.Context = nil
+		activities = append(activities, activity)
+	}
+
+	s.activityJSON(w, r, activitypub.OrderedCollection{
+		Context:      activitypub.ContextActivityStreams,
+		ID:           s.activityPubURL("outbox"),
+		Type:         activitypub.TypeOrderedCollection,
+		TotalItems:   count,
+		OrderedItems: activities,
+	}, activitypub.ContentType)
+}
+
+// GetActivityPubFollowers only returns the number of followers, the followers themselves are not shown.
+func (s *Server) GetActivityPubFollowers(w http.ResponseWriter, r *http.Request) {
+	if s.activityPub == nil {
+		s.error(w, r, httperr.NotFound(ErrActivityPubDisabled))
+		return
+	}
+
+	count, err := s.db.GetActivityPubFollowerCount(r.Context())
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	s.activityJSON(w, r, activitypub.OrderedCollection{
+		Context:    activitypub.ContextActivityStreams,
+		ID:         s.activityPubURL("followers"),
+		Type:       activitypub.TypeOrderedCollection,
+		TotalItems: count,
+	}, activitypub.ContentType)
+}
+
+func (s *Server) GetActivityPubNote(w http.ResponseWriter, r *http.Request) {
+	if s.activityPub == nil {
+		s.error(w, r, httperr.NotFound(ErrActivityPubDisabled))
+		return
+	}
+
+	note, err := s.db.GetActivityPubNote(r.Context(), chi.URLParam(r, "documentID"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrActivityPubNoteNotFound))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+
+	activityNote := s.newActivityPubNote(*note)
+	activityNote.Context = activitypub.ContextActivityStreams
+	s.activityJSON(w, r, activityNote, activitypub.ContentType)
+}
+
+// PostActivityPubInbox handles follows and unfollows of the actor, other activities are ignored. Activities need a
+// valid HTTP signature of their actor.
+func (s *Server) PostActivityPubInbox(w http.ResponseWriter, r *http.Request) {
+	if s.activityPub == nil {
+		s.error(w, r, httperr.NotFound(ErrActivityPubDisabled))
+		return
+	}
+
+	body, err := io.ReadAll(gio.LimitReader(r.Body, activityPubMaxActivitySize))
+	if err != nil {
+		if errors.Is(err, gio.ErrLimitReached) {
+			s.error(w, r, httperr.New(err, http.StatusRequestEntityTooLarge))
+			return
+		}
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+
+	var activity activitypub.Activity
+	if err = json.Unmarshal(body, &activity); err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+	if activity.Type != activitypub.TypeFollow && activity.Type != activitypub.TypeUndo {
+		// deletes of accounts are sent to every known server, their keys can't be fetched anymore
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	var actor *activitypub.Actor
+	if _, err = activitypub.Verify(r.Context(), r, body, func(ctx context.Context, keyID string) (*rsa.PublicKey, error) {
+		fetched, err := s.fetchActivityPubActor(ctx, keyID)
+		if err != nil {
+			return nil, err
+		}
+		actor = fetched
+		if actor.PublicKey.ID != keyID {
+			return nil, activitypub.ErrInvalidSignature
+		}
+		return activitypub.ParsePublicKeyPEM(actor.PublicKey.PublicKeyPEM)
+	}); err != nil {
+		slog.DebugContext(r.Context(), "failed to verify activitypub signature", slog.Any("err", err))
+		s.error(w, r, httperr.Unauthorized(err))
+		return
+	}
+	if activity.Actor != actor.ID {
+		s.error(w, r, httperr.Unauthorized(ErrActivityPubActorMismatch))
+		return
+	}
+
+	switch activity.Type {
+	case activitypub.TypeFollow:
+		if activity.ObjectID() != s.activityPubActorID() {
+			break
+		}
+		inbox := actor.Inbox
+		if actor.Endpoints != nil && actor.Endpoints.SharedInbox != "" {
+			inbox = actor.Endpoints.SharedInbox
+		}
+		if err = s.db.AddActivityPubFollower(r.Context(), database.ActivityPubFollower{
+			ActorID:   actor.ID,
+			Inbox:     inbox,
+			CreatedAt: time.Now(),
+		}); err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		accept, err := activitypub.NewActivity(s.activityPubActorID()+"#accepts/"+rand.Text(), activitypub.TypeAccept, s.activityPubActorID(), activity)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+		s.deliverActivityPub(r.Context(), []string{actor.Inbox}, accept)
+
+	case activitypub.TypeUndo:
+		follow, err := activity.InnerActivity()
+		if err != nil {
+			s.error(w, r, httperr.BadRequest(err))
+			return
+		}
+		if follow.Type != activitypub.TypeFollow || follow.Actor != actor.ID {
+			break
+		}
+		if err = s.db.DeleteActivityPubFollower(r.Context(), actor.ID); err != nil {
+			s.error(w, r, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// fetchActivityPubActor fetches the actor of the key id, the key id is the actor url with a fragment for the key.
+func (s *Server) fetchActivityPubActor(ctx context.Context, keyID string) (*activitypub.Actor, error) {
+	actorURL, _, _ := strings.Cut(keyID, "#")
+	if uri, err := url.Parse(actorURL); err != nil || uri.Scheme != "https" && uri.Scheme != "http" {
+		return nil, activitypub.ErrInvalidSignature
+	}
+
+	rq, err := http.NewRequestWithContext(ctx, http.MethodGet, actorURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create activitypub actor request: %w", err)
+	}
+	rq.Header.Set(ezhttp.HeaderAccept, activitypub.ContentType)
+	rq.Header.Set(ezhttp.HeaderUserAgent, fmt.Sprintf("gobin/%s", s.version.Version))
+	// servers with authorized fetch only return actors to signed requests
+	if err = activitypub.Sign(rq, nil, s.activityPubActorID()+"#main-key", s.activityPub.key); err != nil {
+		return nil, err
+	}
+
+	rs, err := s.activityPub.client.Do(rq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch activitypub actor: %w", err)
+	}
+	defer func() {
+		_ = rs.Body.Close()
+	}()
+	if rs.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch activitypub actor: status %d", rs.StatusCode)
+	}
+
+	var actor activitypub.Actor
+	if err = json.NewDecoder(gio.LimitReader(rs.Body, activityPubMaxActivitySize)).Decode(&actor); err != nil {
+		return nil, fmt.Errorf("failed to decode activitypub actor: %w", err)
+	}
+	return &actor, nil
+}
+
+// publicDocument returns whether the document should be announced with ActivityPub, it's requested with the public
+// query parameter.
+func (s *Server) publicDocument(r *http.Request, files []database.File) (bool, error) {
+	publicStr := r.URL.Query().Get("public")
+	if publicStr == "" {
+		return false, nil
+	}
+	public, err := strconv.ParseBool(publicStr)
+	if err != nil {
+		return false, httperr.BadRequest(fmt.Errorf("invalid public: %w", err))
+	}
+	if !public {
+		return false, nil
+	}
+	if s.activityPub == nil {
+		return false, httperr.BadRequest(ErrActivityPubDisabled)
+	}
+	if slices.ContainsFunc(files, func(file database.File) bool {
+		return file.Encrypted
+	}) {
+		return false, httperr.BadRequest(ErrActivityPubEncrypted)
+	}
+	return true, nil
+}
+
+// publishActivityPubNote creates the post of a new public document and sends it to all followers.
+func (s *Server) publishActivityPubNote(ctx context.Context, documentID string, version int64, files []database.File) {
+	note := database.ActivityPubNote{
+		DocumentID: documentID,
+		Version:    version,
+		CreatedAt:  time.Now(),
+	}
+	note.Summary, note.Content = s.activityPubNoteContent(documentID, files)
+	if err := s.db.CreateActivityPubNote(ctx, note); err != nil {
+		slog.ErrorContext(ctx, "failed to create activitypub note", slog.Any("err", err))
+		return
+	}
+
+	activity, err := s.newActivityPubCreate(note)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to create activitypub create activity", slog.Any("err", err))
+		return
+	}
+	s.deliverActivityPubToFollowers(ctx, activity)
+}
+
+// activityPubDocumentDeleted deletes the post of the document once all versions of the document are gone and tells the
+// followers about it.
+func (s *Server) activityPubDocumentDeleted(ctx context.Context, documentID string) {
+	if s.activityPub == nil {
+		return
+	}
+
+	if _, err := s.db.GetActivityPubNote(ctx, documentID); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "failed to get activitypub note", slog.Any("err", err))
+		}
+		return
+	}
+	if versions, err := s.db.GetDocumentVersions(ctx, documentID); err != nil {
+		slog.ErrorContext(ctx, "failed to get document versions", slog.Any("err", err))
+		return
+	} else if len(versions) > 0 {
+		return
+	}
+
+	if err := s.db.DeleteActivityPubNote(ctx, documentID); err != nil {
+		slog.ErrorContext(ctx, "failed to delete activitypub note", slog.Any("err", err))
+		return
+	}
+
+	noteID := s.activityPubURL("notes", documentID)
+	activity, err := activitypub.NewActivity(noteID+"#delete", activitypub.TypeDelete, s.activityPubActorID(), activitypub.Tombstone{
+		ID:   noteID,
+		Type: activitypub.TypeTombstone,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to create activitypub delete activity", slog.Any("err", err))
+		return
+	}
+	activity.To = []string{activitypub.Public}
+	s.deliverActivityPubToFollowers(ctx, activity)
+}
+
+// activityPubNoteContent returns the content warning and the html content of the post of a document. The post links
+// the document and shows the first lines of its first file.
+func (s *Server) activityPubNoteContent(documentID string, files []database.File) (string, string) {
+	documentURL := strings.TrimSuffix(s.cfg.ActivityPub.BaseURL, "/") + "/" + url.PathEscape(documentID)
+
+	var (
+		lines     int
+		languages []string
+	)
+	for _, file := range files {
+		lines += strings.Count(strings.TrimSuffix(file.Content, "\n"), "\n") + 1
+		if file.Language != "plaintext" && !slices.Contains(languages, file.Language) {
+			languages = append(languages, file.Language)
+		}
+	}
+
+	var warnings []string
+	if s.cfg.ActivityPub.ContentWarningCode && len(languages) > 0 {
+		warnings = append(warnings, "Code: "+strings.Join(languages, ", "))
+	}
+	if s.cfg.ActivityPub.ContentWarningLines > 0 && lines > s.cfg.ActivityPub.ContentWarningLines {
+		warnings = append(warnings, strconv.Itoa(lines)+" lines")
+	}
+
+	content := new(strings.Builder)
+	_, _ = fmt.Fprintf(content, `<p><a href="%[1]s">%[1]s</a></p>`, html.EscapeString(documentURL))
+	if len(files) > 0 {
+		file := files[0]
+		_, _ = fmt.Fprintf(content, "<p><strong>%s</strong> (%s)</p>", html.EscapeString(file.Name), html.EscapeString(file.Language))
+		if s.cfg.ActivityPub.PreviewLines > 0 {
+			preview := strings.Split(strings.TrimSuffix(file.Content, "\n"), "\n")
+			if len(preview) > s.cfg.ActivityPub.PreviewLines {
+				preview = append(preview[:s.cfg.ActivityPub.PreviewLines], "…")
+			}
+			_, _ = fmt.Fprintf(content, "<pre><code>%s</code></pre>", html.EscapeString(strings.Join(preview, "\n")))
+		}
+		if len(files) > 1 {
+			_, _ = fmt.Fprintf(content, "<p>and %d more files</p>", len(files)-1)
+		}
+	}
+
+	return strings.Join(warnings, ", "), content.String()
+}
+
+func (s *Server) newActivityPubNote(note database.ActivityPubNote) activitypub.Note {
+	return activitypub.Note{
+		ID:           s.activityPubURL("notes", note.DocumentID),
+		Type:         activitypub.TypeNote,
+		AttributedTo: s.activityPubActorID(),
+		Summary:      note.Summary,
+		Sensitive:    note.Summary != "",
+		Content:      note.Content,
+		URL:          strings.TrimSuffix(s.cfg.ActivityPub.BaseURL, "/") + "/" + url.PathEscape(note.DocumentID),
+		Published:    note.CreatedAt.UTC(),
+		To:           []string{activitypub.Public},
+		CC:           []string{s.activityPubURL("followers")},
+	}
+}
+
+func (s *Server) newActivityPubCreate(note database.ActivityPubNote) (activitypub.Activity, error) {
+	activityNote := s.newActivityPubNote(note)
+	activity, err := activitypub.NewActivity(activityNote.ID+"/activity", activitypub.TypeCreate, s.activityPubActorID(), activityNote)
+	if err != nil {
+		return activitypub.Activity{}, err
+	}
+	activity.Published = activityNote.Published
+	activity.To = activityNote.To
+	activity.CC = activityNote.CC
+	return activity, nil
+}
+
+func (s *Server) deliverActivityPubToFollowers(ctx context.Context, activity activitypub.Activity) {
+	inboxes, err := s.db.GetActivityPubFollowerInboxes(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to get activitypub follower inboxes", slog.Any("err", err))
+		return
+	}
+	s.deliverActivityPub(ctx, inboxes, activity)
+}
+
+// deliverActivityPub sends the signed activity to the inboxes in the background, failed deliveries are only logged.
+// Deliveries share the wait group of the webhooks, so they finish before the server is closed.
+func (s *Server) deliverActivityPub(ctx context.Context, inboxes []string, activity activitypub.Activity) {
+	if len(inboxes) == 0 {
+		return
+	}
+	body, err := json.Marshal(activity)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to marshal activitypub activity", slog.Any("err", err))
+		return
+	}
+
+	s.webhookWaitGroup.Add(1)
+	ctx, span := s.tracer.Start(context.WithoutCancel(ctx), "deliverActivityPub", trace.WithAttributes(
+		attribute.String("type", activity.Type),
+		attribute.Int("inboxes", len(inboxes)),
+	))
+	go func() {
+		defer s.webhookWaitGroup.Done()
+		defer span.End()
+		for _, inbox := range inboxes {
+			if err := s.deliverActivityPubTo(ctx, inbox, body); err != nil {
+				slog.ErrorContext(ctx, "failed to deliver activitypub activity", slog.String("inbox", inbox), slog.String("type", activity.Type), slog.Any("err", err))
+			}
+		}
+	}()
+}
+
+func (s *Server) deliverActivityPubTo(ctx context.Context, inbox string, body []byte) error {
+	rq, err := http.NewRequestWithContext(ctx, http.MethodPost, inbox, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	rq.Header.Set(ezhttp.HeaderContentType, activitypub.ContentType)
+	rq.Header.Set(ezhttp.HeaderAccept, activitypub.ContentType)
+	rq.Header.Set(ezhttp.HeaderUserAgent, fmt.Sprintf("gobin/%s", s.version.Version))
+	if err = activitypub.Sign(rq, body, s.activityPubActorID()+"#main-key", s.activityPub.key); err != nil {
+		return err
+	}
+
+	rs, err := s.activityPub.client.Do(rq)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func() {
+		_ = rs.Body.Close()
+	}()
+	if rs.StatusCode < 200 || rs.StatusCode >= 300 {
+		return fmt.Errorf("inbox returned status %d", rs.StatusCode)
+	}
+	return nil
+}
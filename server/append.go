@@ -0,0 +1,266 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/flags"
+	"github.com/topi314/gobin/v3/internal/gio"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/internal/render"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+var (
+	ErrInvalidAppendMaxSize  = errors.New("invalid max_size, must be a positive number")
+	ErrInvalidAppendRotate   = errors.New("invalid rotate, must be version or file")
+	ErrEmptyAppendContent    = errors.New("nothing to append")
+	ErrAppendRequiresReview  = errors.New("document is protected, appending requires the review permission")
+	ErrAppendContentTooLarge = errors.New("appended content is larger than max_size")
+	ErrAppendFileTooLarge    = func(maxSize int64) error {
+		return fmt.Errorf("file would be larger than %d bytes, set max_size to rotate it", maxSize)
+	}
+)
+
+// documentLocks serializes the appends and conditional updates of each document, so no content is lost to a concurrent
+// append and no update is saved on top of a version it didn't check.
+type documentLocks struct {
+	mu    sync.Mutex
+	locks map[string]*documentLock
+}
+
+type documentLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func (l *documentLocks) lock(documentID string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*documentLock)
+	}
+	lock, ok := l.locks[documentID]
+	if !ok {
+		lock = &documentLock{}
+		l.locks[documentID] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if lock.refs--; lock.refs == 0 {
+			delete(l.locks, documentID)
+		}
+	}
+}
+
+// PostDocumentAppend appends the request body to a file of the latest version and saves the result as a new version.
+// The file is created if it doesn't exist yet. If the file would grow larger than max_size it is rotated: either the
+// new version only keeps the appended content in the file or the full file is renamed and the appended content starts
+// a new file with the old name. The file is taken from the route if it is appended to with
+// PATCH /documents/{documentID}/files/{fileName}/append.
+func (s *Server) PostDocumentAppend(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+	query := r.URL.Query()
+
+	claims := GetClaims(r)
+	if flags.Misses(claims.Permissions, PermissionWrite) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+		return
+	}
+
+	maxSize := s.maxFileSize()
+	if maxSizeStr := query.Get("max_size"); maxSizeStr != "" {
+		size, err := strconv.ParseInt(maxSizeStr, 10, 64)
+		if err != nil || size <= 0 {
+			s.error(w, r, httperr.BadRequest(ErrInvalidAppendMaxSize))
+			return
+		}
+		if maxSize <= 0 || size < maxSize {
+			maxSize = size
+		}
+	}
+	rotate := query.Get("rotate")
+	if rotate != "" && rotate != api.AppendRotateVersion && rotate != api.AppendRotateFile {
+		s.error(w, r, httperr.BadRequest(ErrInvalidAppendRotate))
+		return
+	}
+	if rotate == "" && query.Get("max_size") != "" {
+		rotate = api.AppendRotateVersion
+	}
+
+	ctx, span := s.tracer.Start(r.Context(), "appendDocument", trace.WithAttributes(
+		attribute.String("document_id", documentID),
+		attribute.String("rotate", rotate),
+	))
+	defer span.End()
+
+	reader := io.Reader(r.Body)
+	if maxSize > 0 {
+		reader = gio.LimitReader(r.Body, maxSize)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		if errors.Is(err, gio.ErrLimitReached) {
+			s.error(w, r, httperr.BadRequest(ErrAppendContentTooLarge))
+			return
+		}
+		s.error(w, r, fmt.Errorf("failed to read request body: %w", err))
+		return
+	}
+	if len(data) == 0 {
+		s.error(w, r, httperr.BadRequest(ErrEmptyAppendContent))
+		return
+	}
+
+	message, err := getVersionMessage(query, r.Header)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	fileName := chi.URLParam(r, "fileName")
+	if fileName == "" {
+		fileName = query.Get("file")
+	}
+	if contentDisposition := r.Header.Get(ezhttp.HeaderContentDisposition); fileName == "" && contentDisposition != "" {
+		if _, params, err := mime.ParseMediaType(contentDisposition); err == nil {
+			fileName = params["filename"]
+		}
+	}
+
+	unlock := s.updateLocks.lock(documentID)
+	defer unlock()
+
+	files, err := s.db.GetDocument(ctx, documentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrDocumentNotFound))
+			return
+		}
+		s.error(w, r, fmt.Errorf("failed to get document: %w", err))
+		return
+	}
+
+	review, err := s.requiresReview(r, documentID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if review {
+		s.error(w, r, httperr.Forbidden(ErrAppendRequiresReview))
+		return
+	}
+
+	if fileName == "" {
+		fileName = files[0].Name
+	}
+	index := -1
+	for i, file := range files {
+		files[i].OrderIndex = i
+		if strings.EqualFold(file.Name, fileName) {
+			index = i
+		}
+	}
+	if index == -1 {
+		contentType, _, _ := mime.ParseMediaType(r.Header.Get(ezhttp.HeaderContentType))
+		files = append(files, database.File{
+			Name:       fileName,
+			Language:   render.Language(query.Get("language"), contentType, fileName, string(data)),
+			OrderIndex: len(files),
+		})
+		index = len(files) - 1
+	}
+	file := &files[index]
+	if file.Encrypted {
+		s.error(w, r, httperr.BadRequest(ErrFileEncrypted))
+		return
+	}
+
+	var rotated string
+	if maxSize > 0 && int64(len(file.Content)+len(data)) > maxSize {
+		switch rotate {
+		case api.AppendRotateVersion:
+			file.Content = ""
+		case api.AppendRotateFile:
+			newFile := database.File{
+				Name:       file.Name,
+				Language:   file.Language,
+				ExpiresAt:  file.ExpiresAt,
+				OrderIndex: len(files),
+			}
+			rotated = rotatedFileName(files, file.Name)
+			file.Name = rotated
+			files = append(files, newFile)
+			file = &files[len(files)-1]
+		default:
+			s.error(w, r, httperr.BadRequest(ErrAppendFileTooLarge(maxSize)))
+			return
+		}
+	}
+	file.Content += string(data)
+
+	if s.cfg.MaxFiles > 0 && len(files) > s.cfg.MaxFiles {
+		s.error(w, r, ErrTooManyFiles(s.cfg.MaxFiles))
+		return
+	}
+	if s.cfg.MaxDocumentSize > 0 && documentSize(files) > s.cfg.MaxDocumentSize {
+		s.error(w, r, newLimitError(api.LimitMaxDocumentSize, s.cfg.MaxDocumentSize, file.Name))
+		return
+	}
+
+	version, err := s.saveDocumentVersion(ctx, documentID, r.Header.Get(ezhttp.HeaderDocumentLock), files, message)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, api.AppendResponse{
+		Key:     documentID,
+		Version: version,
+		File:    file.Name,
+		Size:    len(file.Content),
+		Rotated: rotated,
+	})
+}
+
+// documentSize returns the size of all files together.
+func documentSize(files []database.File) int64 {
+	var size int64
+	for _, file := range files {
+		size += int64(len(file.Content))
+	}
+	return size
+}
+
+// rotatedFileName returns the name for a full file like logrotate, "build.log" becomes "build.log.1" or the next free
+// number.
+func rotatedFileName(files []database.File, name string) string {
+	for i := 1; ; i++ {
+		rotated := name + "." + strconv.Itoa(i)
+		if !slices.ContainsFunc(files, func(file database.File) bool {
+			return strings.EqualFold(file.Name, rotated)
+		}) {
+			return rotated
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+const (
+	ArchiveFormatZip   = "zip"
+	ArchiveFormatTarGz = "tar.gz"
+)
+
+var ErrInvalidArchiveFormat = errors.New("invalid archive format, must be one of: zip, tar.gz")
+
+// GetDocumentArchive streams all files of a document version as a zip or tar.gz archive. The files are in a directory
+// named like the document, end-to-end encrypted files contain their ciphertext.
+func (s *Server) GetDocumentArchive(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = ArchiveFormatZip
+	}
+	var contentType string
+	switch format {
+	case ArchiveFormatZip:
+		contentType = ezhttp.ContentTypeZip
+	case ArchiveFormatTarGz:
+		contentType = ezhttp.ContentTypeGzip
+	default:
+		s.error(w, r, httperr.BadRequest(ErrInvalidArchiveFormat))
+		return
+	}
+
+	document, err := s.getDocument(r, nil)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	modTime := documentModTime(document.Files)
+	if checkNotModified(w, r, s.documentETag(r, document.Files), modTime) {
+		return
+	}
+
+	fileName := document.ID + "." + format
+	w.Header().Set(ezhttp.HeaderContentType, contentType)
+	w.Header().Set(ezhttp.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{
+		"filename": fileName,
+	}))
+
+	// the response is already started, errors can only be logged
+	if format == ArchiveFormatZip {
+		err = writeZipArchive(w, document.ID, document.Files, modTime)
+	} else {
+		err = writeTarGzArchive(w, document.ID, document.Files, modTime)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to write document archive", slog.String("document_id", document.ID), slog.Any("err", err))
+	}
+}
+
+// archiveFileName returns the path of the file in the archive, file names can't escape the directory of the document.
+func archiveFileName(documentID string, file database.File) string {
+	name := path.Clean("/" + file.Name)[1:]
+	if name == "" {
+		name = "untitled"
+	}
+	return documentID + "/" + name
+}
+
+func writeZipArchive(w io.Writer, documentID string, files []database.File, modTime time.Time) error {
+	zw := zip.NewWriter(w)
+	for _, file := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     archiveFileName(documentID, file),
+			Method:   zip.Deflate,
+			Modified: modTime,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create zip file %s: %w", file.Name, err)
+		}
+		if _, err = io.WriteString(fw, file.Content); err != nil {
+			return fmt.Errorf("failed to write zip file %s: %w", file.Name, err)
+		}
+	}
+	return zw.Close()
+}
+
+func writeTarGzArchive(w io.Writer, documentID string, files []database.File, modTime time.Time) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, file := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     archiveFileName(documentID, file),
+			Size:     int64(len(file.Content)),
+			Mode:     0o644,
+			ModTime:  modTime,
+			Format:   tar.FormatPAX,
+		}); err != nil {
+			return fmt.Errorf("failed to write tar header of %s: %w", file.Name, err)
+		}
+		if _, err := io.WriteString(tw, file.Content); err != nil {
+			return fmt.Errorf("failed to write tar file %s: %w", file.Name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
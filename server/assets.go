@@ -0,0 +1,103 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/server/templates"
+)
+
+const assetsPath = "/assets/"
+
+// cssURLRegex matches the asset urls in css files, they are replaced with the fingerprinted urls.
+var cssURLRegex = regexp.MustCompile(`url\("?(/assets/[^")]+)"?\)`)
+
+// fingerprintedAsset is an asset which is served under a name containing the hash of its content.
+type fingerprintedAsset struct {
+	name string
+	// content is set for css files which point to other fingerprinted assets.
+	content []byte
+}
+
+// newAssetManifest fingerprints all assets. Css files are fingerprinted last since their urls to other assets are
+// replaced with the fingerprinted ones.
+func newAssetManifest(assets fs.FS) (templates.Assets, map[string]fingerprintedAsset, error) {
+	var names []string
+	if err := fs.WalkDir(assets, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			names = append(names, name)
+		}
+		return nil
+	}); err != nil {
+		return nil, nil, fmt.Errorf("failed to walk assets: %w", err)
+	}
+	cssLast := func(name string) int {
+		if path.Ext(name) == ".css" {
+			return 1
+		}
+		return 0
+	}
+	slices.SortStableFunc(names, func(a, b string) int {
+		return cssLast(a) - cssLast(b)
+	})
+
+	manifest := make(templates.Assets, len(names))
+	fingerprinted := make(map[string]fingerprintedAsset, len(names))
+	for _, name := range names {
+		data, err := fs.ReadFile(assets, name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read asset %s: %w", name, err)
+		}
+
+		asset := fingerprintedAsset{name: name}
+		if path.Ext(name) == ".css" {
+			data = cssURLRegex.ReplaceAllFunc(data, func(match []byte) []byte {
+				url := string(cssURLRegex.FindSubmatch(match)[1])
+				return []byte(`url("` + manifest.URL(url) + `")`)
+			})
+			asset.content = data
+		}
+
+		hash := sha256.Sum256(data)
+		ext := path.Ext(name)
+		fingerprintedName := strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(hash[:8]) + ext
+
+		manifest[assetsPath+name] = assetsPath + fingerprintedName
+		fingerprinted[fingerprintedName] = asset
+	}
+
+	return manifest, fingerprinted, nil
+}
+
+// GetAsset serves the assets. Fingerprinted assets never change, so they are cached forever. Assets from disk are
+// always revalidated, so changes show up on the next reload.
+func (s *Server) GetAsset(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, assetsPath)
+	if asset, ok := s.fingerprintedAssets[name]; ok {
+		w.Header().Set(ezhttp.HeaderCacheControl, "public, max-age=31536000, immutable")
+		if asset.content != nil {
+			http.ServeContent(w, r, asset.name, time.Time{}, bytes.NewReader(asset.content))
+			return
+		}
+		http.ServeFileFS(w, r, s.assets, asset.name)
+		return
+	}
+
+	if s.cfg.Assets.Dir != "" {
+		w.Header().Set(ezhttp.HeaderCacheControl, "no-cache")
+	}
+	http.ServeFileFS(w, r, s.assets, name)
+}
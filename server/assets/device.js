@@ -0,0 +1,73 @@
+const userCode = document.querySelector("main.device").dataset.userCode;
+// account logins are approved with the account of the browser, documents are optional then
+const account = "account" in document.querySelector("main.device").dataset;
+const loggedIn = "loggedIn" in document.querySelector("main.device").dataset;
+
+const documents = JSON.parse(localStorage.getItem("documents") || "{}");
+const documentItems = Object.keys(documents).map(key => {
+    const item = document.createElement("li");
+    const input = document.createElement("input");
+    input.id = `device-document-${key}`;
+    input.type = "checkbox";
+    input.value = key;
+    const label = document.createElement("label");
+    label.htmlFor = input.id;
+    label.innerText = key;
+    item.replaceChildren(input, label);
+    return item;
+});
+if (documentItems.length === 0) {
+    const item = document.createElement("li");
+    item.innerText = "This browser has no document tokens, open a document with its token first.";
+    documentItems.push(item);
+    document.getElementById("device-approve").disabled = !account;
+}
+if (account && !loggedIn) {
+    document.getElementById("device-approve").disabled = true;
+}
+document.getElementById("device-documents").replaceChildren(...documentItems);
+
+document.getElementById("device-approve").addEventListener("click", async () => {
+    const selected = [...document.querySelectorAll("#device-documents input:checked")].map(input => ({
+        key: input.value,
+        token: documents[input.value]
+    }));
+    if (selected.length === 0 && !account) {
+        setStatus("Select at least one document.");
+        return;
+    }
+    if (await sendDeviceRequest("approve", {user_code: userCode, documents: selected})) {
+        setStatus("Approved, you can close this page and return to your device.");
+    }
+});
+
+document.getElementById("device-deny").addEventListener("click", async () => {
+    if (await sendDeviceRequest("deny", {user_code: userCode})) {
+        setStatus("Denied, the device did not get access to any documents.");
+    }
+});
+
+async function sendDeviceRequest(action, body) {
+    const response = await fetch(`/device/${action}`, {
+        method: "POST",
+        body: JSON.stringify(body),
+        headers: {
+            "Content-Type": "application/json"
+        }
+    });
+
+    if (!response.ok) {
+        const body = await response.json();
+        setStatus(body.message || response.statusText);
+        console.error(`error trying to ${action} device:`, response);
+        return false;
+    }
+
+    document.getElementById("device-approve").disabled = true;
+    document.getElementById("device-deny").disabled = true;
+    return true;
+}
+
+function setStatus(message) {
+    document.getElementById("device-status").innerText = message;
+}
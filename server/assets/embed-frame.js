@@ -0,0 +1,15 @@
+// Runs in the iframes of embed.js and sends the height of the document to the embedding page, so it can resize the
+// iframe to fit it. The height isn't secret, so it's sent to any origin.
+const embedID = new URLSearchParams(window.location.search).get("embed");
+
+function postHeight() {
+    window.parent.postMessage({
+        type: "gobin:resize",
+        id: embedID,
+        height: document.documentElement.scrollHeight
+    }, "*");
+}
+
+if (embedID !== null && window.parent !== window) {
+    new ResizeObserver(postHeight).observe(document.body);
+}
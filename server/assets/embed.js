@@ -0,0 +1,110 @@
+// Embeds gobin documents into other sites. Every element with a data-gobin attribute is replaced with an iframe of the
+// document, the document is rendered by the gobin server, so the site doesn't need CORS or its own highlighting.
+//
+// <div data-gobin="https://gobin.dev/jis74978" data-gobin-file="main.go" data-gobin-theme="auto"></div>
+// <script src="https://gobin.dev/assets/embed.js" async></script>
+//
+// data-gobin is the url or the key of the document with an optional version, keys are resolved against the server of
+// the script. data-gobin-theme is light, dark or auto for the color scheme of the site, data-gobin-style overrides it
+// with a style of the server. The iframes resize to their content up to data-gobin-max-height pixels.
+(() => {
+    const scriptOrigin = document.currentScript ? new URL(document.currentScript.src).origin : window.location.origin;
+    const colorScheme = window.matchMedia("(prefers-color-scheme: light)");
+    const frames = new Map();
+    let nextID = 0;
+
+    function theme(element) {
+        const value = element.dataset.gobinTheme || "auto";
+        if (value !== "auto") {
+            return value;
+        }
+        return colorScheme.matches ? "light" : "dark";
+    }
+
+    function frameURL(frame) {
+        const url = new URL(frame.path, frame.origin);
+        const element = frame.element;
+        if (element.dataset.gobinFile) {
+            url.searchParams.set("file", element.dataset.gobinFile);
+        }
+        if (element.dataset.gobinStyle) {
+            url.searchParams.set("style", element.dataset.gobinStyle);
+        } else {
+            url.searchParams.set("theme", theme(element));
+        }
+        url.searchParams.set("embed", frame.id);
+        return url.toString();
+    }
+
+    function embed(element) {
+        if (element.dataset.gobinEmbedded) {
+            return;
+        }
+
+        const documentURL = new URL(element.dataset.gobin, scriptOrigin);
+        const [key, version] = documentURL.pathname.split("/").filter(segment => segment !== "");
+        if (!key) {
+            console.error("gobin: invalid document", element.dataset.gobin);
+            return;
+        }
+        element.dataset.gobinEmbedded = "true";
+
+        const iframe = document.createElement("iframe");
+        iframe.title = `gobin document ${key}`;
+        iframe.loading = "lazy";
+        iframe.style.display = "block";
+        iframe.style.width = "100%";
+        iframe.style.height = "150px";
+        iframe.style.border = "0";
+
+        const frame = {
+            id: String(nextID++),
+            origin: documentURL.origin,
+            path: version ? `/${key}/${version}/embed` : `/${key}/embed`,
+            element: element,
+            iframe: iframe
+        };
+        frames.set(frame.id, frame);
+        iframe.src = frameURL(frame);
+        element.replaceChildren(iframe);
+    }
+
+    function embedAll(root) {
+        (root || document).querySelectorAll("[data-gobin]").forEach(embed);
+    }
+
+    window.addEventListener("message", event => {
+        const data = event.data;
+        if (!data || data.type !== "gobin:resize") {
+            return;
+        }
+        const frame = frames.get(data.id);
+        if (!frame || event.origin !== frame.origin || event.source !== frame.iframe.contentWindow) {
+            return;
+        }
+        let height = Number(data.height);
+        const maxHeight = Number(frame.element.dataset.gobinMaxHeight);
+        if (maxHeight > 0) {
+            height = Math.min(height, maxHeight);
+        }
+        frame.iframe.style.height = `${height}px`;
+    });
+
+    // frames which follow the color scheme of the site are reloaded when it changes
+    colorScheme.addEventListener("change", () => {
+        for (const frame of frames.values()) {
+            if (!frame.element.dataset.gobinStyle && (frame.element.dataset.gobinTheme || "auto") === "auto") {
+                frame.iframe.src = frameURL(frame);
+            }
+        }
+    });
+
+    // elements added later can be embedded with gobinEmbed(element)
+    window.gobinEmbed = root => root && root.dataset && root.dataset.gobin !== undefined ? embed(root) : embedAll(root);
+
+    if (document.readyState === "loading") {
+        document.addEventListener("DOMContentLoaded", () => embedAll());
+    } else {
+        embedAll();
+    }
+})();
@@ -0,0 +1,35 @@
+const main = document.querySelector("main.device");
+const inviteID = main.dataset.inviteId;
+const documentKey = main.dataset.documentKey;
+
+document.getElementById("invite-accept").addEventListener("click", async () => {
+    const response = await fetch(`/invites/${inviteID}/accept`, {
+        method: "POST"
+    });
+    const body = await response.json();
+    if (!response.ok) {
+        setStatus(body.message || response.statusText);
+        console.error("error trying to accept invite:", response);
+        return;
+    }
+
+    // keep a token this browser already has if it has at least the permissions of the invite
+    const documents = JSON.parse(localStorage.getItem("documents") || "{}");
+    const permissions = getTokenPermissions(body.token);
+    if ((getTokenPermissions(documents[documentKey]) & permissions) !== permissions) {
+        documents[documentKey] = body.token;
+        localStorage.setItem("documents", JSON.stringify(documents));
+    }
+    window.location.href = `/${documentKey}${window.location.hash}`;
+});
+
+function getTokenPermissions(token) {
+    if (!token) return 0;
+    const tokenSplit = token.split(".");
+    if (tokenSplit.length !== 3) return 0;
+    return JSON.parse(atob(tokenSplit[1])).pms;
+}
+
+function setStatus(message) {
+    document.getElementById("invite-status").innerText = message;
+}
@@ -0,0 +1,58 @@
+// Pastes saved while offline wait in IndexedDB until the service worker uploads them. This file is loaded by the page
+// and by the service worker.
+const outboxDBName = "gobin";
+const outboxStoreName = "outbox";
+const uploadedStoreName = "uploaded";
+
+function openOutbox() {
+    return new Promise((resolve, reject) => {
+        const request = indexedDB.open(outboxDBName, 1);
+        request.onupgradeneeded = () => {
+            request.result.createObjectStore(outboxStoreName, {keyPath: "id", autoIncrement: true});
+            request.result.createObjectStore(uploadedStoreName, {keyPath: "id", autoIncrement: true});
+        };
+        request.onsuccess = () => resolve(request.result);
+        request.onerror = () => reject(request.error);
+    });
+}
+
+async function outboxRequest(storeName, mode, fn) {
+    const db = await openOutbox();
+    return new Promise((resolve, reject) => {
+        const transaction = db.transaction(storeName, mode);
+        const request = fn(transaction.objectStore(storeName));
+        transaction.oncomplete = () => {
+            db.close();
+            resolve(request.result);
+        };
+        transaction.onerror = () => {
+            db.close();
+            reject(transaction.error);
+        };
+    });
+}
+
+function addOfflinePaste(paste) {
+    return outboxRequest(outboxStoreName, "readwrite", store => store.add(paste));
+}
+
+function getOfflinePastes() {
+    return outboxRequest(outboxStoreName, "readonly", store => store.getAll());
+}
+
+function deleteOfflinePaste(id) {
+    return outboxRequest(outboxStoreName, "readwrite", store => store.delete(id));
+}
+
+// uploaded pastes contain the key and token of the new document or the error of the server
+function addUploadedPaste(uploaded) {
+    return outboxRequest(uploadedStoreName, "readwrite", store => store.add(uploaded));
+}
+
+function getUploadedPastes() {
+    return outboxRequest(uploadedStoreName, "readonly", store => store.getAll());
+}
+
+function deleteUploadedPaste(id) {
+    return outboxRequest(uploadedStoreName, "readwrite", store => store.delete(id));
+}
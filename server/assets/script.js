@@ -1,6 +1,7 @@
 document.addEventListener("DOMContentLoaded", async () => {
     const matches = window.matchMedia("(prefers-color-scheme: dark)").matches;
     updateFaviconStyle(matches);
+    updateColorScheme(matches);
 
     const state = JSON.parse(document.getElementById("state").textContent);
 
@@ -8,16 +9,51 @@ document.addEventListener("DOMContentLoaded", async () => {
     if (params.has("token")) {
         setToken(state.key, params.get("token"));
     }
+    // the logged-in account has permissions for this document
+    if (state.token) {
+        setToken(state.key, state.token);
+        delete state.token;
+    }
+    const fragment = new URLSearchParams(window.location.hash.substring(1));
+    if (fragment.has("key")) {
+        setEncryptionKey(state.key, fragment.get("key"));
+    }
+    if (state.files[state.current_file].encrypted) {
+        await decryptFile(state.key, state.files[state.current_file]);
+        updateCode(state);
+    }
 
     updateButtons(state);
     setState(state);
+    watchDocument(state.key);
+
+    // keep the remaining lifetime of the file up to date
+    setInterval(() => updateExpiresIn(getState()), 60 * 1000);
+
+    if ("serviceWorker" in navigator) {
+        navigator.serviceWorker.register("/sw.js").catch(e => console.error("error registering service worker:", e));
+        navigator.serviceWorker.addEventListener("message", (event) => {
+            if (event.data === "pastes-uploaded") {
+                showUploadedPastes();
+            }
+        });
+        await showUploadedPastes();
+    }
+});
+
+window.addEventListener("online", async () => {
+    if (!("serviceWorker" in navigator)) return;
+    const registration = await navigator.serviceWorker.ready;
+    registration.active.postMessage("upload-pastes");
 });
 
 window.matchMedia("(prefers-color-scheme: dark)").addEventListener("change", (event) => {
     updateFaviconStyle(event.matches);
+    updateColorScheme(event.matches);
 });
 
-window.addEventListener("popstate", (event) => {
+window.addEventListener("popstate", async (event) => {
+    await loadFile(event.state, event.state.current_file);
     updateFiles(event.state);
     updateCode(event.state);
     updateButtons(event.state);
@@ -26,9 +62,10 @@ window.addEventListener("popstate", (event) => {
 
 /* File Events */
 
-document.getElementById("files").addEventListener("change", (e) => {
+document.getElementById("files").addEventListener("change", async (e) => {
     const state = getState();
     state.current_file = parseInt(e.target.value);
+    await loadFile(state, state.current_file);
 
     updateCode(state);
     setState(state);
@@ -103,7 +140,7 @@ document.getElementById("files").addEventListener("click", (e) => {
             name: "untitled",
             content: "",
             formatted: "",
-            language: "auto"
+            language: getDefaultLanguage()
         })
     }
 
@@ -120,7 +157,7 @@ document.getElementById("file-add").addEventListener("click", (e) => {
         name: `untitled${index}`,
         content: "",
         formatted: "",
-        language: "auto"
+        language: getDefaultLanguage()
     }
 
     updateFiles(state)
@@ -132,7 +169,15 @@ document.getElementById("file-add").addEventListener("click", (e) => {
 /* Code Edit Events */
 
 document.getElementById("code-edit").addEventListener("keydown", (e) => {
-    if (e.key !== "Tab" || e.shiftKey) {
+    const keymap = e.target.dataset.keymap;
+    if (keymap === "emacs" && e.ctrlKey && !e.altKey && !e.metaKey && handleEmacsKey(e.target, e.key)) {
+        // emacs keys take precedence over the keyboard shortcuts of the page
+        e.preventDefault();
+        e.stopPropagation();
+        return;
+    }
+    // the browser keymap keeps tab for moving the focus
+    if (e.key !== "Tab" || e.shiftKey || keymap === "browser") {
         return;
     }
     e.preventDefault();
@@ -143,9 +188,73 @@ document.getElementById("code-edit").addEventListener("keydown", (e) => {
     e.target.selectionStart = e.target.selectionEnd = start + 1;
 });
 
+// handleEmacsKey moves the cursor or deletes text like emacs and returns false for keys it doesn't handle.
+function handleEmacsKey(element, key) {
+    const value = element.value;
+    const position = element.selectionEnd;
+    const lineStart = position > 0 ? value.lastIndexOf("\n", position - 1) + 1 : 0;
+    let lineEnd = value.indexOf("\n", position);
+    if (lineEnd === -1) {
+        lineEnd = value.length;
+    }
+
+    let cursor;
+    switch (key) {
+        case "a":
+            cursor = lineStart;
+            break;
+        case "e":
+            cursor = lineEnd;
+            break;
+        case "f":
+            cursor = Math.min(position + 1, value.length);
+            break;
+        case "b":
+            cursor = Math.max(position - 1, 0);
+            break;
+        case "n": {
+            if (lineEnd === value.length) {
+                cursor = value.length;
+                break;
+            }
+            let nextLineEnd = value.indexOf("\n", lineEnd + 1);
+            if (nextLineEnd === -1) {
+                nextLineEnd = value.length;
+            }
+            cursor = Math.min(lineEnd + 1 + position - lineStart, nextLineEnd);
+            break;
+        }
+        case "p": {
+            if (lineStart === 0) {
+                cursor = 0;
+                break;
+            }
+            const previousLineStart = lineStart >= 2 ? value.lastIndexOf("\n", lineStart - 2) + 1 : 0;
+            cursor = Math.min(previousLineStart + position - lineStart, lineStart - 1);
+            break;
+        }
+        case "d":
+        case "k": {
+            // kill deletes the rest of the line or the line break at the end of the line
+            let end = Math.min(position + 1, value.length);
+            if (key === "k" && lineEnd !== position) {
+                end = lineEnd;
+            }
+            element.setRangeText("", position, end, "start");
+            element.dispatchEvent(new Event("input"));
+            return true;
+        }
+        default:
+            return false;
+    }
+    element.selectionStart = element.selectionEnd = cursor;
+    return true;
+}
+
 document.getElementById("code-edit").addEventListener("input", (e) => {
     const state = getState();
     state.files[state.current_file].content = e.target.value;
+    scheduleEditHighlight();
 
     const count = state.files.reduce((total, file) => total + file.content.length, 0);
     document.getElementById("code-edit-count").innerHTML = `${count}`
@@ -154,6 +263,12 @@ document.getElementById("code-edit").addEventListener("input", (e) => {
     document.querySelector(`label[for="code-edit"]`).classList.toggle("invalid", count > maxElement.innerHTML.substring(1));
 });
 
+document.getElementById("code-edit").addEventListener("scroll", (event) => {
+    const highlightElement = document.getElementById("code-edit-highlight");
+    highlightElement.scrollTop = event.target.scrollTop;
+    highlightElement.scrollLeft = event.target.scrollLeft;
+});
+
 document.getElementById("code-edit").addEventListener("paste", (event) => {
     const state = getState();
     state.files[state.current_file].content = event.target.value;
@@ -209,8 +324,22 @@ document.getElementById("version").addEventListener("change", async (e) => {
 
 document.getElementById("style").addEventListener("change", (e) => {
     const style = e.target.value;
-    const theme = e.target.options.item(e.target.selectedIndex).dataset.theme;
+    if (style === "") {
+        setCookie("style", "", {"max-age": -1});
+        applyStyle(getAutoStyle(window.matchMedia("(prefers-color-scheme: dark)").matches));
+        return;
+    }
     setCookie("style", style);
+    applyStyle(style);
+});
+
+function applyStyle(style) {
+    const styleElement = document.getElementById("style");
+    const option = [...styleElement.options].find(option => option.value === style);
+    if (!option) {
+        return;
+    }
+    const theme = option.dataset.theme;
     document.documentElement.setAttribute("data-theme", theme);
     document.documentElement.classList.replace(theme === "dark" ? "light" : "dark", theme);
     const themeCssElement = document.getElementById("theme-css");
@@ -218,7 +347,30 @@ document.getElementById("style").addEventListener("change", (e) => {
     const href = new URL(themeCssElement.href);
     href.searchParams.set("style", style);
     themeCssElement.href = href.toString();
-});
+}
+
+// getAutoStyle returns the default style of the user settings, the style the creator suggested or the default style
+// for the color scheme of the user.
+function getAutoStyle(dark) {
+    const styleElement = document.getElementById("style");
+    if (styleElement.dataset.settingsStyle) {
+        return styleElement.dataset.settingsStyle;
+    }
+    if (styleElement.dataset.documentStyle) {
+        return styleElement.dataset.documentStyle;
+    }
+    return dark ? styleElement.dataset.defaultStyle : styleElement.dataset.defaultLightStyle;
+}
+
+// updateColorScheme tells the server the color scheme of the user for browsers without client hints and switches the
+// style if the user didn't pick one.
+function updateColorScheme(dark) {
+    setCookie("color_scheme", dark ? "dark" : "light", {"max-age": 60 * 60 * 24 * 365});
+    const styleElement = document.getElementById("style");
+    if (styleElement && styleElement.value === "") {
+        applyStyle(getAutoStyle(dark));
+    }
+}
 
 document.getElementById("expire").addEventListener("input", (e) => {
     const expireIn = parseInt(e.target.value);
@@ -241,6 +393,8 @@ document.getElementById("language").addEventListener("change", async (e) => {
     if (state.mode === "view") {
         state.files[state.current_file] = await fetchDocumentFile(state.key, state.version, file.name, file.language);
         updateCode(state);
+    } else {
+        updateEditHighlight(state);
     }
     setState(state);
 });
@@ -265,11 +419,20 @@ document.getElementById("edit").addEventListener("click", async () => {
     if (document.getElementById("edit").disabled) return;
 
     const state = getState();
+    // all files are saved, so the files which were not opened yet are needed too
+    if (!await loadFiles(state)) return;
     if (!hasPermission(getToken(state.key), PermissionWrite)) {
+        // saving creates a fork which can be merged back later
+        if (state.key) {
+            state.fork = {key: state.key, version: state.version};
+        }
         state.key = "";
     }
     state.mode = "edit";
     state.version = 0;
+    // the update fails if someone else saved a new version in the meantime
+    state.base_version = state.key ? latestVersion() : 0;
+    delete state.conflict;
 
     updateCode(state);
     updateButtons(state);
@@ -287,12 +450,44 @@ document.getElementById("save").addEventListener("click", async () => {
 
     const saveButton = document.getElementById("save");
     saveButton.classList.add("loading");
-    const doc = await saveDocument(state.key, state.expire_in, state.files);
+    const doc = await saveDocument(state.key, state.expire_in, state.files, state.fork, state.merge, state.base_version);
     saveButton.classList.remove("loading");
 
     if (!doc) {
         return;
     }
+    if (doc.conflict) {
+        // the changes since the edit started are shown next to the editor, saving again overwrites them
+        state.conflict = doc.conflict;
+        state.base_version = doc.conflict.current_version;
+        showErrorPopup("This document was changed since you started editing, review the changes and save again to overwrite them");
+
+        updateCode(state);
+        setState(state);
+        return;
+    }
+    delete state.conflict;
+    delete state.base_version;
+    if (doc.revision) {
+        // protected documents only change once the revision is approved
+        const current = await fetchDocument(state.key, 0);
+        if (!current) return;
+        delete state.merge;
+        state.version = 0;
+        state.files = current.files;
+        state.mode = "view";
+        state.expire_in = 0;
+        document.getElementById("expire").value = "";
+        showErrorPopup("Your changes were submitted for review");
+
+        updateCode(state);
+        updateButtons(state);
+        addState(state);
+        return;
+    }
+    state.parent = state.fork ? state.fork.key : state.key ? state.parent : undefined;
+    delete state.fork;
+    delete state.merge;
     state.key = doc.key;
     state.version = 0;
     state.files = doc.files;
@@ -303,15 +498,8 @@ document.getElementById("save").addEventListener("click", async () => {
         setToken(doc.key, doc.token);
     }
 
-    const optionElement = document.createElement("option");
-    optionElement.title = `${doc.version_time}`;
-    optionElement.value = doc.version;
-    optionElement.innerText = `${doc.version_label}`;
-
-    updateVersionSelect(-1);
-    const versionElement = document.getElementById("version");
-    versionElement.insertBefore(optionElement, versionElement.firstChild);
-    versionElement.value = doc.version;
+    addVersionOption(doc);
+    watchDocument(doc.key);
 
     document.getElementById("expire").value = "";
 
@@ -346,11 +534,12 @@ document.getElementById("delete").addEventListener("click", async () => {
     state.key = "";
     state.vesion = 0;
     state.mode = "edit"
+    delete state.parent;
     state.files = [{
         name: "untitled",
         content: "",
         formatted: "",
-        language: "auto"
+        language: getDefaultLanguage()
     }];
     state.file_selected = 0;
 
@@ -368,6 +557,13 @@ document.getElementById("copy").addEventListener("click", async () => {
     await navigator.clipboard.writeText(state.files[state.current_file].content);
 })
 
+document.getElementById("checksum").addEventListener("click", async () => {
+    const state = getState();
+    const file = state.files[state.current_file];
+    if (!file || !file.sha256) return;
+    await navigator.clipboard.writeText(file.sha256);
+})
+
 document.getElementById("raw").addEventListener("click", () => {
     if (document.getElementById("raw").disabled) {
         return;
@@ -378,6 +574,38 @@ document.getElementById("raw").addEventListener("click", () => {
     window.open(`/raw/${key}${version !== 0 ? `/versions/${version}` : ""}`, "_blank").focus();
 })
 
+document.getElementById("merge").addEventListener("click", async () => {
+    if (document.getElementById("merge").disabled) return;
+
+    const state = getState();
+    if (!state.parent) return;
+
+    const merge = await fetchDocumentMerge(state.parent, state.key, state.version);
+    if (!merge) return;
+
+    state.merge = {key: merge.source.key, version: merge.source.version};
+    state.key = merge.key;
+    state.version = 0;
+    state.mode = "edit";
+    state.files = merge.files.map(file => ({
+        name: file.name,
+        content: file.content,
+        formatted: "",
+        language: file.language
+    }));
+    state.current_file = Math.max(0, merge.files.findIndex(file => file.conflicts > 0));
+    delete state.parent;
+
+    updateFiles(state);
+    updateCode(state);
+    updateButtons(state);
+    addState(state);
+
+    if (merge.conflicts > 0) {
+        showErrorPopup(`${merge.conflicts} conflicts, resolve the conflict markers before saving`);
+    }
+});
+
 document.getElementById("share").addEventListener("click", async () => {
     if (document.getElementById("share").disabled) return;
 
@@ -391,6 +619,9 @@ document.getElementById("share").addEventListener("click", async () => {
     document.getElementById("share-permissions-write").checked = false;
     document.getElementById("share-permissions-delete").checked = false;
     document.getElementById("share-permissions-share").checked = false;
+    document.getElementById("share-permissions-review").checked = false;
+    document.getElementById("share-invite-max-uses").value = "";
+    document.getElementById("share-invite-expires").value = "";
 
     document.getElementById("share-dialog").showModal();
 });
@@ -400,20 +631,7 @@ document.getElementById("share-dialog-close").addEventListener("click", () => {
 });
 
 document.getElementById("share-copy").addEventListener("click", async () => {
-    const permissions = [];
-    if (document.getElementById("share-permissions-write").checked) {
-        permissions.push("write");
-    }
-    if (document.getElementById("share-permissions-delete").checked) {
-        permissions.push("delete");
-    }
-    if (document.getElementById("share-permissions-share").checked) {
-        permissions.push("share");
-    }
-    if (document.getElementById("share-permissions-webhook").checked) {
-        permissions.push("webhook");
-    }
-
+    const permissions = getSharePermissions();
     if (permissions.length === 0) {
         await navigator.clipboard.writeText(window.location.href);
         document.getElementById("share-dialog").close();
@@ -445,156 +663,1397 @@ document.getElementById("share-copy").addEventListener("click", async () => {
     document.getElementById("share-dialog").close();
 });
 
-async function saveDocument(key, expire, files) {
-    const data = new FormData();
-    for (const [i, file] of files.entries()) {
-        const blob = new Blob([file.content], {
-            type: file.language,
-        })
-        data.append(`file-${i}`, blob, file.name);
+document.getElementById("share-invite-copy").addEventListener("click", async () => {
+    const permissions = getSharePermissions();
+    if (permissions.length === 0) {
+        showErrorPopup("Select at least one permission for the invite");
+        return;
     }
 
-    const headers = {};
+    const request = {
+        permissions: permissions,
+        max_uses: parseInt(document.getElementById("share-invite-max-uses").value) || 0
+    };
+    const expires = parseInt(document.getElementById("share-invite-expires").value);
+    if (expires > 0) {
+        request.expires_at = new Date(Date.now() + expires * 60 * 60 * 1000).toISOString();
+    }
+
+    const {key} = getState();
     const token = getToken(key);
-    if (token) {
-        headers["Authorization"] = `Bearer ${token}`
+
+    const response = await fetch(`/documents/${key}/invites`, {
+        method: "POST",
+        body: JSON.stringify(request),
+        headers: {
+            "Content-Type": "application/json",
+            Authorization: `Bearer ${token}`
+        }
+    });
+
+    if (!response.ok) {
+        const body = await response.json();
+        showErrorPopup(body.message || response.statusText)
+        console.error("error creating invite:", response);
+        return;
     }
 
-    if (expire) {
-        try {
-            headers["Expires"] = new Date(Date.now() + expire * 60 * 60 * 1000).toISOString();
-        } catch (e) {
-            showErrorPopup("Invalid expiration date");
-            return
+    const body = await response.json()
+    // the fragment holds the key of encrypted documents, the invite page passes it on to the document
+    await navigator.clipboard.writeText(`${window.location.origin}/invite/${body.id}${window.location.hash}`);
+    document.getElementById("share-dialog").close();
+});
+
+function getSharePermissions() {
+    const permissions = [];
+    for (const permission of ["write", "delete", "share", "webhook", "review"]) {
+        if (document.getElementById(`share-permissions-${permission}`).checked) {
+            permissions.push(permission);
         }
     }
+    return permissions;
+}
 
-    const response = await fetch(`/documents/${key}?formatter=html`, {
-        body: data,
-        method: key !== "" ? "PATCH" : "POST",
-        headers: headers
-    });
+document.getElementById("activity").addEventListener("click", async () => {
+    if (document.getElementById("activity").disabled) return;
 
-    let body = await response.text();
-    try {
-        body = JSON.parse(body);
-    } catch (e) {
-        body = {message: body};
+    const {key} = getState();
+    const token = getToken(key);
+    if (!token) return;
+
+    const events = await fetchDocumentEvents(key, token);
+    if (!events) return;
+
+    const nodes = [];
+    for (const event of events.reverse()) {
+        const item = document.createElement("li");
+        const text = document.createElement("span");
+        text.innerText = formatDocumentEvent(event);
+        const time = document.createElement("time");
+        time.dateTime = event.created_at;
+        time.innerText = new Date(event.created_at).toLocaleString();
+        item.replaceChildren(text, time);
+        nodes.push(item);
+    }
+    if (nodes.length === 0) {
+        const item = document.createElement("li");
+        item.innerText = "No activity yet";
+        nodes.push(item);
     }
+    document.getElementById("activity-list").replaceChildren(...nodes);
+    document.getElementById("activity-dialog").showModal();
+});
 
-    if (!response.ok) {
-        showErrorPopup(body.message || response.statusText);
-        console.error("error saving document:", response);
-        return;
+document.getElementById("activity-dialog-close").addEventListener("click", () => {
+    document.getElementById("activity-dialog").close();
+});
+
+document.getElementById("review").addEventListener("click", async () => {
+    if (document.getElementById("review").disabled) return;
+
+    const {key} = getState();
+    const token = getToken(key);
+    if (!hasPermission(token, PermissionReview)) return;
+
+    const revisions = await fetchDocumentRevisions(key, token);
+    if (!revisions) return;
+
+    document.getElementById("review-protected").checked = revisions.protected;
+    const nodes = revisions.revisions.map(revision => createReviewItem(key, token, revision));
+    if (nodes.length === 0) {
+        const item = document.createElement("li");
+        item.innerText = "No pending changes";
+        nodes.push(item);
     }
+    document.getElementById("review-list").replaceChildren(...nodes);
+    document.getElementById("review-dialog").showModal();
+});
 
-    return body
-}
+document.getElementById("review-dialog-close").addEventListener("click", () => {
+    document.getElementById("review-dialog").close();
+});
 
-async function fetchDocument(key, version) {
-    const response = await fetch(`/documents/${key}${version !== 0 ? `/versions/${version}` : ""}?formatter=html`, {
-        method: "GET"
-    });
+document.getElementById("settings").addEventListener("click", () => {
+    window.open("/settings", "_blank");
+});
 
-    let body = await response.text();
-    try {
-        body = JSON.parse(body);
-    } catch (e) {
-        body = {message: body};
+document.getElementById("account").addEventListener("click", async () => {
+    const account = document.getElementById("account");
+    if (!account.dataset.loggedIn) {
+        window.location.href = `/login?redirect=${encodeURIComponent(window.location.pathname)}`;
+        return;
     }
+
+    const response = await fetch("/logout", {
+        method: "POST"
+    });
     if (!response.ok) {
-        showErrorPopup(body.message || response.statusText);
-        console.error("error fetching document version:", response);
+        showErrorPopup(response.statusText);
+        console.error("error logging out:", response);
         return;
     }
+    window.location.reload();
+});
 
-    return body
-}
-
-async function fetchDocumentFile(key, version, file, language) {
-    const response = await fetch(`/documents/${key}${version !== 0 ? `/versions/${version}` : ""}/files/${file}?formatter=html&language=${language}`, {
+document.getElementById("recent").addEventListener("click", async () => {
+    const response = await fetch("/recent", {
         method: "GET"
     });
 
-    let body = await response.text();
-    try {
-        body = JSON.parse(body);
-    } catch (e) {
-        body = {message: body};
-    }
     if (!response.ok) {
-        showErrorPopup(body.message || response.statusText);
-        console.error("error fetching document version:", response);
+        const body = await response.json();
+        showErrorPopup(body.message || response.statusText)
+        console.error("error fetching recent documents:", response);
         return;
     }
 
-    return body
+    const body = await response.json();
+    const nodes = body.documents.map(createRecentItem);
+    if (nodes.length === 0) {
+        const item = document.createElement("li");
+        item.innerText = "No documents created yet";
+        nodes.push(item);
+    }
+    document.getElementById("recent-list").replaceChildren(...nodes);
+    document.getElementById("recent-dialog").showModal();
+});
+
+document.getElementById("recent-dialog-close").addEventListener("click", () => {
+    document.getElementById("recent-dialog").close();
+});
+
+function createRecentItem(recentDocument) {
+    const item = document.createElement("li");
+    const link = document.createElement("a");
+    link.href = `/${recentDocument.key}`;
+    link.innerText = `${recentDocument.key} (${recentDocument.files.join(", ")})`;
+    const time = document.createElement("time");
+    time.dateTime = recentDocument.created_at;
+    time.innerText = new Date(recentDocument.created_at).toLocaleString();
+    const deleteButton = document.createElement("button");
+    deleteButton.title = "Delete document";
+    deleteButton.innerText = "delete";
+    deleteButton.addEventListener("click", async () => {
+        const response = await fetch(`/recent/${recentDocument.key}`, {
+            method: "DELETE"
+        });
+
+        if (!response.ok) {
+            const body = await response.json();
+            showErrorPopup(body.message || response.statusText)
+            console.error("error deleting recent document:", response);
+            return;
+        }
+
+        deleteToken(recentDocument.key);
+        if (getState().key === recentDocument.key) {
+            window.location.href = "/";
+            return;
+        }
+        item.remove();
+    });
+    item.replaceChildren(link, time, deleteButton);
+    return item;
 }
 
-async function deleteDocument(key, token) {
-    const response = await fetch(`/documents/${key}`, {
-        method: "DELETE",
+document.getElementById("review-protected").addEventListener("change", async (event) => {
+    const {key} = getState();
+    const response = await fetch(`/documents/${key}/protection`, {
+        method: "PUT",
+        body: JSON.stringify({protected: event.target.checked}),
         headers: {
-            Authorization: `Bearer ${token}`
+            "Content-Type": "application/json",
+            Authorization: `Bearer ${getToken(key)}`
         }
     });
 
-    if (response.status === 204) {
-        return;
+    if (!response.ok) {
+        const body = await response.json();
+        showErrorPopup(body.message || response.statusText)
+        console.error("error updating document protection:", response);
+        event.target.checked = !event.target.checked;
     }
+});
+
+document.getElementById("summary-panel").addEventListener("toggle", async (e) => {
+    if (!e.target.open) return;
+
+    const {key, version} = getState();
+    const summaryText = document.getElementById("summary-text");
+    if (summaryText.dataset.version === `${key}/${version}`) return;
+
+    summaryText.innerText = "Loading...";
+    const response = await fetch(`/documents/${key}${version !== 0 ? `/versions/${version}` : ""}/summary/ai`, {
+        method: "GET"
+    });
 
-    let body = await response.text();
-    try {
-        body = JSON.parse(body);
-    } catch (e) {
-        body = {message: body};
-    }
     if (!response.ok) {
-        showErrorPopup(body.message || response.statusText);
-        console.error("error fetching document version:", response);
+        const body = await response.json();
+        summaryText.innerText = "";
+        showErrorPopup(body.message || response.statusText)
+        console.error("error fetching document summary:", response);
+        return;
     }
-}
 
-function showErrorPopup(message) {
-    const popup = document.getElementById("error-popup");
-    popup.style.display = "block";
-    popup.innerText = message || "Something went wrong.";
-    setTimeout(() => popup.style.display = "none", 5000);
-}
+    const body = await response.json();
+    summaryText.innerText = body.summary;
+    summaryText.dataset.version = `${key}/${version}`;
+});
 
-function getState() {
-    return window.history.state;
-}
+document.getElementById("smart-view-toggle").addEventListener("change", (e) => {
+    const state = getState();
+    state.smart_view = e.target.checked;
+    state.diff = false;
+    state.transform = "";
+    updateCode(state);
+    setState(state);
+});
 
-function getURL(state) {
-    const url = new URL(window.location.href);
-    if (state.files.length > 1) {
-        url.searchParams.set("file", state.files[state.current_file].name);
-    } else {
-        url.searchParams.delete("file");
+async function renderSmartView(state) {
+    const file = state.files[state.current_file];
+    const smartViewElement = document.getElementById("smart-view");
+    const smartViewKey = `${state.key}/${state.version}/${file.name}`;
+    if (smartViewElement.dataset.file === smartViewKey) return;
+    smartViewElement.dataset.file = smartViewKey;
+    delete smartViewElement.dataset.logs;
+    document.getElementById("log-filter").style.display = "none";
+
+    smartViewElement.innerText = "Loading...";
+    const logs = await fetchDocumentFileLogs(state.key, state.version, file.name);
+    // another file might have been selected in the meantime
+    if (smartViewElement.dataset.file !== smartViewKey) return;
+    if (!logs) {
+        smartViewElement.innerText = "";
+        delete smartViewElement.dataset.file;
+        return;
     }
-    url.pathname = `/${state.key}${state.version !== 0 ? `/${state.version}` : ""}`;
-    return url.toString();
-}
 
-function setState(state) {
-    window.history.replaceState(state, "", getURL(state))
+    const lines = file.content.split("\n");
+    let lastTime = null;
+    smartViewElement.replaceChildren(...logs.entries.map(entry => {
+        // entries without a timestamp belong to the previous one
+        lastTime = entry.time || lastTime;
+        const element = createLogEntry(state, lines, entry);
+        if (lastTime) {
+            element.dataset.time = lastTime;
+        }
+        return element;
+    }));
+
+    // only offer filters for files which look like logs
+    const isLog = logs.format !== "text" || logs.entries.some(entry => entry.level || entry.time);
+    smartViewElement.dataset.logs = `${isLog}`;
+    document.getElementById("log-filter").style.display = isLog ? "flex" : "none";
+    applyLogFilter();
 }
 
-function addState(state) {
-    window.history.pushState(state, "", getURL(state))
-}
+const LogLevels = ["trace", "debug", "info", "warn", "error", "fatal"];
 
-function getToken(key) {
-    const documents = localStorage.getItem("documents")
-    if (!documents) return ""
-    const token = JSON.parse(documents)[key]
-    if (!token) return ""
+document.getElementById("log-filter-level").addEventListener("change", () => applyLogFilter());
+document.getElementById("log-filter-from").addEventListener("change", () => applyLogFilter());
+document.getElementById("log-filter-to").addEventListener("change", () => applyLogFilter());
 
-    return token
-}
+document.getElementById("log-filter-raw").addEventListener("click", () => {
+    const {key, version, files, current_file} = getState();
+    if (!key) return;
 
-function setToken(key, token) {
+    const params = new URLSearchParams();
+    const {level, from, to} = getLogFilter();
+    if (level) params.set("level", level);
+    if (from) params.set("from", from.toISOString());
+    if (to) params.set("to", to.toISOString());
+    window.open(`/raw/${key}${version !== 0 ? `/versions/${version}` : ""}/files/${encodeURIComponent(files[current_file].name)}?${params}`, "_blank").focus();
+});
+
+function getLogFilter() {
+    const level = document.getElementById("log-filter-level").value;
+    const from = document.getElementById("log-filter-from").value;
+    const to = document.getElementById("log-filter-to").value;
+    return {
+        level: level,
+        from: from ? new Date(from) : null,
+        to: to ? new Date(to) : null
+    };
+}
+
+function applyLogFilter() {
+    const {level, from, to} = getLogFilter();
+    const minLevel = LogLevels.indexOf(level);
+    const entries = document.querySelectorAll("#smart-view > .log-entry");
+
+    let visible = 0;
+    for (const entry of entries) {
+        const time = entry.dataset.time ? new Date(entry.dataset.time) : null;
+        const hidden = (minLevel !== -1 && LogLevels.indexOf(entry.dataset.level) < minLevel)
+            || (from && (!time || time < from))
+            || (to && (!time || time > to));
+        entry.style.display = hidden ? "none" : "";
+        if (!hidden) visible++;
+    }
+    document.getElementById("log-filter-count").innerText = `${visible}/${entries.length} entries`;
+}
+
+function createLogEntry(state, lines, entry) {
+    const hasFrames = entry.frames && entry.frames.length > 0;
+    const element = document.createElement(hasFrames ? "details" : "div");
+    element.classList.add("log-entry", `log-${entry.level || "none"}`);
+    element.dataset.line = entry.line;
+    element.dataset.level = entry.level || "";
+
+    const header = document.createElement(hasFrames ? "summary" : "div");
+    header.classList.add("log-header");
+    header.appendChild(createLineLink(state.current_file, entry.line));
+    if (entry.level) {
+        const level = document.createElement("span");
+        level.classList.add("log-level");
+        level.innerText = entry.level;
+        header.appendChild(level);
+    }
+    const message = document.createElement("span");
+    message.classList.add("log-message");
+    // structured entries only show the message, plain text and traces show all of their lines
+    message.innerText = entry.format === "json" || entry.format === "logfmt" || hasFrames
+        ? entry.message
+        : lines.slice(entry.line - 1, entry.end_line).join("\n");
+    header.appendChild(message);
+    element.appendChild(header);
+
+    if (entry.fields) {
+        const fields = document.createElement("div");
+        fields.classList.add("log-fields");
+        fields.innerText = Object.entries(entry.fields).map(([key, value]) => `${key}=${value}`).join(" ");
+        element.appendChild(fields);
+    }
+
+    if (!hasFrames) return element;
+
+    const frames = document.createElement("ol");
+    frames.classList.add("log-frames");
+    for (const frame of entry.frames) {
+        const item = document.createElement("li");
+        item.appendChild(createLineLink(state.current_file, frame.line));
+        const func = document.createElement("span");
+        func.classList.add("log-frame-function");
+        func.innerText = frame.function || "";
+        item.appendChild(func);
+        if (frame.file) {
+            const location = `${frame.file}${frame.source_line ? `:${frame.source_line}` : ""}`;
+            const fileIndex = state.files.findIndex(file => file.name === frame.file || frame.file.endsWith(`/${file.name}`));
+            if (fileIndex !== -1) {
+                const link = createLineLink(fileIndex, frame.source_line || 1);
+                link.innerText = location;
+                link.classList.replace("log-line", "log-frame-file");
+                item.appendChild(link);
+            } else {
+                const source = document.createElement("span");
+                source.classList.add("log-frame-file");
+                source.innerText = location;
+                item.appendChild(source);
+            }
+        }
+        frames.appendChild(item);
+    }
+    element.appendChild(frames);
+    return element;
+}
+
+function createLineLink(fileIndex, line) {
+    const link = document.createElement("a");
+    link.classList.add("log-line");
+    link.href = `#L${line}`;
+    link.innerText = `${line}`;
+    link.addEventListener("click", (e) => {
+        e.preventDefault();
+        showLine(fileIndex, line);
+    });
+    return link;
+}
+
+async function showLine(fileIndex, line) {
+    const state = getState();
+    state.smart_view = false;
+    state.diff = false;
+    state.current_file = fileIndex;
+    await loadFile(state, fileIndex);
+    updateFiles(state);
+    updateCode(state);
+    addState(state);
+    window.location.hash = `L${line}`;
+    // changing the hash to the same line again does not scroll
+    document.getElementById(`L${line}`)?.scrollIntoView({block: "center"});
+}
+
+async function fetchDocumentFileLogs(key, version, file) {
+    const response = await fetch(`/documents/${key}${version !== 0 ? `/versions/${version}` : ""}/files/${encodeURIComponent(file)}/logs`, {
+        method: "GET"
+    });
+
+    if (!response.ok) {
+        const body = await response.json();
+        showErrorPopup(body.message || response.statusText)
+        console.error("error fetching document logs:", response);
+        return null;
+    }
+
+    return await response.json();
+}
+
+/* Blame */
+
+document.getElementById("blame-toggle").addEventListener("change", (e) => {
+    const state = getState();
+    state.blame = e.target.checked;
+    updateCode(state);
+    setState(state);
+});
+
+async function renderBlame(state) {
+    const file = state.files[state.current_file];
+    const blame = await fetchDocumentFileBlame(state.key, state.version, file.name);
+    if (!blame) return;
+
+    // the code might have been re-rendered or already annotated in the meantime
+    const currentState = getState();
+    if (!currentState.blame || currentState.key !== state.key || currentState.version !== state.version || currentState.current_file !== state.current_file) return;
+    if (document.querySelector("#code-view .blame")) return;
+
+    const versions = [...new Set(blame.ranges.map(range => range.version))].sort();
+    for (const range of blame.ranges) {
+        const version = new Date(range.version).toLocaleString();
+        for (let line = range.start; line <= range.end; line++) {
+            const element = document.getElementById(`L${line}`);
+            if (!element) continue;
+
+            const annotation = document.createElement("span");
+            annotation.classList.add("blame", `blame-${versions.indexOf(range.version) % 2 === 0 ? "even" : "odd"}`);
+            annotation.title = `Introduced in version ${version}`;
+            if (line === range.start) {
+                annotation.innerText = version;
+            }
+            element.insertBefore(annotation, element.firstChild);
+        }
+    }
+}
+
+async function fetchDocumentFileBlame(key, version, file) {
+    const response = await fetch(`/documents/${key}${version !== 0 ? `/versions/${version}` : ""}/files/${encodeURIComponent(file)}/blame`, {
+        method: "GET"
+    });
+
+    const body = await response.json();
+    if (!response.ok) {
+        showErrorPopup(body.message || response.statusText);
+        console.error("error fetching document blame:", response);
+        return null;
+    }
+    return body;
+}
+
+/* Transform */
+
+document.getElementById("transform").addEventListener("change", (e) => {
+    const state = getState();
+    state.transform = e.target.value;
+    state.smart_view = false;
+    state.diff = false;
+    updateCode(state);
+    setState(state);
+});
+
+async function renderTransform(state) {
+    const file = state.files[state.current_file];
+    const transformElement = document.getElementById("transform-view");
+    const transformKey = `${state.key}/${state.version}/${file.name}/${state.transform}`;
+    if (transformElement.dataset.file === transformKey) return;
+    transformElement.dataset.file = transformKey;
+
+    transformElement.innerText = "Loading...";
+    const response = await fetch(`/documents/${state.key}${state.version !== 0 ? `/versions/${state.version}` : ""}/files/${encodeURIComponent(file.name)}?formatter=html&transform=${encodeURIComponent(state.transform)}`, {
+        method: "GET"
+    });
+    const body = await response.json();
+    // another file or transform might have been selected in the meantime
+    if (transformElement.dataset.file !== transformKey) return;
+    if (!response.ok) {
+        // decoding errors are shown in place, they are expected for files which aren't encoded
+        transformElement.innerText = body.message || response.statusText;
+        console.error("error fetching transformed document file:", response);
+        return;
+    }
+
+    const code = document.createElement("code");
+    code.classList.add("ch-chroma");
+    code.innerHTML = body.formatted;
+    const pre = document.createElement("pre");
+    pre.appendChild(code);
+    transformElement.replaceChildren(pre);
+}
+
+/* Diff */
+
+document.getElementById("diff-toggle").addEventListener("change", (e) => {
+    const state = getState();
+    state.diff = e.target.checked;
+    state.smart_view = false;
+    state.transform = "";
+    updateCode(state);
+    setState(state);
+});
+
+async function renderDiff(state) {
+    const file = state.files[state.current_file];
+    const diffElement = document.getElementById("diff-view");
+    // conflicts show the changes someone else saved since the edit started
+    const conflict = state.mode === "edit" ? state.conflict : undefined;
+    const from = conflict ? conflict.version : 0;
+    const to = conflict ? conflict.current_version : state.version;
+    const diffKey = `${state.key}/${from}/${to}/${file.name}`;
+    if (diffElement.dataset.file === diffKey) return;
+    diffElement.dataset.file = diffKey;
+
+    diffElement.innerText = "Loading...";
+    const diff = await fetchDocumentDiff(state.key, to, from);
+    // another file or version might have been selected in the meantime
+    if (diffElement.dataset.file !== diffKey) return;
+    if (!diff) {
+        diffElement.innerText = "";
+        delete diffElement.dataset.file;
+        return;
+    }
+
+    const title = document.createElement("div");
+    title.classList.add("diff-title");
+    if (conflict) {
+        title.innerText = `Changed by someone else since version ${new Date(conflict.version).toLocaleString()}, saving again overwrites these changes`;
+    } else {
+        title.innerText = diff.from ? `Changes since version ${new Date(diff.from).toLocaleString()}` : "First version of the document";
+    }
+
+    const diffFile = diff.files.find(diffFile => diffFile.new_name === file.name);
+    if (!diffFile) {
+        const empty = document.createElement("div");
+        empty.innerText = "No changes in this file";
+        diffElement.replaceChildren(title, empty);
+        return;
+    }
+
+    const lines = diffFile.diff.split("\n");
+    lines.pop();
+    diffElement.replaceChildren(title, ...lines.map(line => {
+        const element = document.createElement("div");
+        element.classList.add("diff-line");
+        if (line.startsWith("+++") || line.startsWith("---")) {
+            element.classList.add("diff-header");
+        } else if (line.startsWith("@@")) {
+            element.classList.add("diff-hunk");
+        } else if (line.startsWith("+")) {
+            element.classList.add("diff-insert");
+        } else if (line.startsWith("-")) {
+            element.classList.add("diff-delete");
+        }
+        element.innerText = line;
+        return element;
+    }));
+}
+
+async function fetchDocumentDiff(key, version, from = 0) {
+    const params = new URLSearchParams();
+    if (version !== 0) {
+        params.set("to", version);
+    }
+    if (from !== 0) {
+        params.set("from", from);
+    }
+    const response = await fetch(`/documents/${key}/diff${params.size > 0 ? `?${params}` : ""}`, {
+        method: "GET"
+    });
+
+    const body = await response.json();
+    if (!response.ok) {
+        showErrorPopup(body.message || response.statusText);
+        console.error("error fetching document diff:", response);
+        return null;
+    }
+    return body;
+}
+
+/* Outline */
+
+document.getElementById("outline-toggle").addEventListener("change", (e) => {
+    const state = getState();
+    state.outline = e.target.checked;
+    updateCode(state);
+    setState(state);
+});
+
+async function renderOutline(state) {
+    const file = state.files[state.current_file];
+    const outlineElement = document.getElementById("outline");
+    const outlineKey = `${state.key}/${state.version}/${file.name}/${file.language}`;
+    if (outlineElement.dataset.file === outlineKey) return;
+    outlineElement.dataset.file = outlineKey;
+
+    const listElement = document.getElementById("outline-list");
+    listElement.innerText = "Loading...";
+    const outline = await fetchDocumentFileOutline(state.key, state.version, file.name, file.language);
+    // another file might have been selected in the meantime
+    if (outlineElement.dataset.file !== outlineKey) return;
+    if (!outline) {
+        listElement.innerText = "";
+        delete outlineElement.dataset.file;
+        return;
+    }
+
+    const nodes = outline.symbols.map(symbol => {
+        const item = document.createElement("li");
+        item.classList.add(`outline-${symbol.kind}`);
+        item.style.paddingLeft = `${symbol.level}rem`;
+        const link = document.createElement("a");
+        link.href = `#L${symbol.line}`;
+        link.title = `${symbol.kind} ${symbol.name} (line ${symbol.line})`;
+        link.innerText = symbol.name;
+        link.addEventListener("click", (e) => {
+            e.preventDefault();
+            showLine(getState().current_file, symbol.line);
+        });
+        item.appendChild(link);
+        return item;
+    });
+    if (nodes.length === 0) {
+        const item = document.createElement("li");
+        item.innerText = outline.supported ? "No symbols found" : `No outline available for ${outline.language}`;
+        nodes.push(item);
+    }
+    listElement.replaceChildren(...nodes);
+}
+
+async function fetchDocumentFileOutline(key, version, file, language) {
+    const response = await fetch(`/documents/${key}${version !== 0 ? `/versions/${version}` : ""}/files/${encodeURIComponent(file)}/outline?language=${encodeURIComponent(language)}`, {
+        method: "GET"
+    });
+
+    const body = await response.json();
+    if (!response.ok) {
+        showErrorPopup(body.message || response.statusText);
+        console.error("error fetching document outline:", response);
+        return null;
+    }
+    return body;
+}
+
+/* Search */
+
+// files bigger than this are searched on the server
+const ClientSearchLimit = 1024 * 1024;
+const MaxSearchMatches = 10000;
+
+let searchResult = {key: "", lines: [], truncated: false, index: -1};
+
+document.getElementById("search").addEventListener("keydown", async (e) => {
+    if (e.key !== "Enter") return;
+    e.preventDefault();
+    await search(e.shiftKey ? -1 : 1);
+});
+
+document.getElementById("search").addEventListener("input", (e) => {
+    if (e.target.value === "") clearSearch();
+});
+
+document.getElementById("search-regex").addEventListener("change", () => clearSearch());
+document.getElementById("search-case").addEventListener("change", () => clearSearch());
+document.getElementById("search-prev").addEventListener("click", async () => await search(-1));
+document.getElementById("search-next").addEventListener("click", async () => await search(1));
+
+async function search(direction) {
+    const query = document.getElementById("search").value;
+    if (!query) return;
+
+    let state = getState();
+    if (state.smart_view || state.diff) {
+        state.smart_view = false;
+        state.diff = false;
+        updateCode(state);
+        setState(state);
+    }
+
+    const regex = document.getElementById("search-regex").checked;
+    const matchCase = document.getElementById("search-case").checked;
+    const searchKey = `${state.key}/${state.version}/${state.current_file}/${regex}/${matchCase}/${query}`;
+    if (searchResult.key !== searchKey) {
+        clearSearch();
+        const file = state.files[state.current_file];
+        const result = file.content.length > ClientSearchLimit
+            ? await fetchDocumentFileSearch(state.key, state.version, file.name, query, regex, matchCase)
+            : searchContent(file.content, query, regex, matchCase);
+        if (!result) return;
+
+        searchResult = {key: searchKey, lines: result.lines, truncated: result.truncated, index: -1};
+        for (const line of searchResult.lines) {
+            document.getElementById(`L${line}`)?.classList.add("search-match");
+        }
+    }
+    moveSearch(direction);
+}
+
+function searchContent(content, query, regex, matchCase) {
+    let expr;
+    try {
+        expr = new RegExp(regex ? query : query.replace(/[.*+?^${}()|[\]\\]/g, "\\$&"), matchCase ? "" : "i");
+    } catch (e) {
+        showErrorPopup(`Invalid search regex: ${e.message}`);
+        return null;
+    }
+
+    const lines = [];
+    for (const [i, line] of content.split("\n").entries()) {
+        if (!expr.test(line)) continue;
+        if (lines.length >= MaxSearchMatches) {
+            return {lines: lines, truncated: true};
+        }
+        lines.push(i + 1);
+    }
+    return {lines: lines, truncated: false};
+}
+
+async function fetchDocumentFileSearch(key, version, file, query, regex, matchCase) {
+    const params = new URLSearchParams({q: query, regex: `${regex}`, case: `${matchCase}`, limit: `${MaxSearchMatches}`});
+    const response = await fetch(`/documents/${key}${version !== 0 ? `/versions/${version}` : ""}/files/${encodeURIComponent(file)}/search?${params}`, {
+        method: "GET"
+    });
+
+    const body = await response.json();
+    if (!response.ok) {
+        showErrorPopup(body.message || response.statusText);
+        console.error("error searching document file:", response);
+        return null;
+    }
+
+    // the server returns every match, we only need the lines
+    const lines = [...new Set(body.matches.map(match => match.line))];
+    return {lines: lines, truncated: body.truncated};
+}
+
+function moveSearch(direction) {
+    const {lines, truncated} = searchResult;
+    const countElement = document.getElementById("search-count");
+    if (lines.length === 0) {
+        countElement.innerText = "no matches";
+        return;
+    }
+
+    document.getElementById(`L${lines[searchResult.index]}`)?.classList.remove("search-current");
+    searchResult.index = (searchResult.index + direction + lines.length) % lines.length;
+    const element = document.getElementById(`L${lines[searchResult.index]}`);
+    if (element) {
+        element.classList.add("search-current");
+        element.scrollIntoView({block: "center"});
+    }
+    countElement.innerText = `${searchResult.index + 1}/${lines.length}${truncated ? "+" : ""}`;
+}
+
+function clearSearch() {
+    document.querySelectorAll("#code-view .search-match").forEach(element => element.classList.remove("search-match", "search-current"));
+    document.getElementById("search-count").innerText = "";
+    searchResult = {key: "", lines: [], truncated: false, index: -1};
+}
+
+async function fetchDocumentEvents(key, token) {
+    const events = [];
+    let since = "0";
+    for (; ;) {
+        const response = await fetch(`/events?document=${key}&since=${since}&limit=1000`, {
+            method: "GET",
+            headers: {
+                Authorization: `Bearer ${token}`
+            }
+        });
+
+        if (!response.ok) {
+            const body = await response.json();
+            showErrorPopup(body.message || response.statusText)
+            console.error("error fetching document events:", response);
+            return null;
+        }
+
+        const body = await response.json();
+        events.push(...body.events);
+        if (body.events.length < 1000) {
+            return events;
+        }
+        since = body.next;
+    }
+}
+
+function formatDocumentEvent(event) {
+    const version = new Date(event.version).toLocaleString();
+    const expires = (event.data.files || []).filter(file => file.expires_at).map(file => new Date(file.expires_at).toLocaleString());
+    const expiresText = expires.length > 0 ? `, expires ${expires[0]}` : "";
+    switch (event.event) {
+        case "create":
+            return `Created version ${version}${expiresText}`;
+        case "update":
+            return `Updated to version ${version}${expiresText}`;
+        case "delete":
+            return `Deleted version ${version}`;
+        case "expire":
+            return `Version ${version} expired`;
+        case "prune":
+            return `Version ${version} pruned (${event.data.reason})`;
+        case "share":
+            return `Shared with ${event.data.permissions.join(", ")} permissions`;
+        case "webhook":
+            return `Webhook ${event.data.webhook_id} ${event.data.success ? "delivered" : "failed"} (${event.data.event}, ${event.data.tries} tries)`;
+        case "revision_pending":
+            return `Changes submitted for review (revision ${new Date(event.data.revision).toLocaleString()})`;
+        case "revision_approved":
+            return `Approved revision ${new Date(event.data.revision).toLocaleString()} as version ${version}`;
+        case "revision_rejected":
+            return `Rejected revision ${new Date(event.data.revision).toLocaleString()}`;
+        case "merge":
+            return `Merged version ${new Date(event.data.source_version).toLocaleString()} of ${event.data.source}`;
+        case "ingest":
+            return `Ingested from ${event.data.bucket}/${event.data.object_key}`;
+        case "hook":
+            return `Hook ${event.data.hook}: ${Object.entries(event.data.annotations).map(([key, value]) => `${key}=${value}`).join(", ")}`;
+        default:
+            return event.event;
+    }
+}
+
+async function saveDocument(key, expire, files, fork, merge, baseVersion) {
+    // all files of encrypted documents are encrypted again with the key of the document
+    let encryptionKey = "";
+    if (files.some(file => file.encrypted)) {
+        encryptionKey = getEncryptionKey(key || (fork ? fork.key : ""));
+        if (!encryptionKey) {
+            showErrorPopup("The key of this encrypted document is missing");
+            return;
+        }
+    }
+
+    const data = new FormData();
+    for (const [i, file] of files.entries()) {
+        const content = encryptionKey ? await encryptContent(encryptionKey, file.content) : file.content;
+        const blob = new Blob([content], {
+            type: file.language,
+        })
+        data.append(`file-${i}`, blob, file.name);
+    }
+
+    const headers = {};
+    const token = getToken(key);
+    if (token) {
+        headers["Authorization"] = `Bearer ${token}`
+    }
+
+    if (expire) {
+        try {
+            headers["Expires"] = new Date(Date.now() + expire * 60 * 60 * 1000).toISOString();
+        } catch (e) {
+            showErrorPopup("Invalid expiration date");
+            return
+        }
+    }
+
+    let url = `/documents/${key}?formatter=html`;
+    let method = key !== "" ? "PATCH" : "POST";
+    if (merge) {
+        url = `/documents/${key}/merge?formatter=html&source=${merge.key}&source_version=${merge.version}`;
+        method = "POST";
+    } else if (key === "" && fork) {
+        url += `&forked_from=${fork.key}&forked_from_version=${fork.version}`;
+    }
+    if (encryptionKey) {
+        url += "&encrypted=true";
+    }
+    if (method === "PATCH" && baseVersion) {
+        headers["If-Match"] = `${baseVersion}`;
+    }
+
+    let response;
+    try {
+        response = await fetch(url, {
+            body: data,
+            method: method,
+            headers: headers
+        });
+    } catch (e) {
+        // new pastes are uploaded by the service worker once the browser is online again
+        if (method === "POST" && key === "" && !fork && "serviceWorker" in navigator) {
+            await queueOfflinePaste(files, headers["Expires"]);
+            showErrorPopup("You are offline, your paste will be uploaded once you are back online");
+            return;
+        }
+        showErrorPopup("You are offline");
+        console.error("error saving document:", e);
+        return;
+    }
+
+    let body = await response.text();
+    try {
+        body = JSON.parse(body);
+    } catch (e) {
+        body = {message: body};
+    }
+
+    if (response.status === 409 && body.conflict) {
+        return {conflict: body.conflict};
+    }
+    if (!response.ok) {
+        showErrorPopup(body.message || response.statusText);
+        console.error("error saving document:", response);
+        return;
+    }
+
+    if (encryptionKey && body.key) {
+        setEncryptionKey(body.key, encryptionKey);
+        body.files = await Promise.all(body.files.map(file => decryptFile(body.key, file)));
+    }
+    return body
+}
+
+async function queueOfflinePaste(files, expires) {
+    await addOfflinePaste({
+        files: files.map(file => ({name: file.name, content: file.content, language: file.language})),
+        expires: expires
+    });
+
+    const registration = await navigator.serviceWorker.ready;
+    if ("sync" in registration) {
+        await registration.sync.register("upload-pastes");
+    }
+}
+
+async function showUploadedPastes() {
+    const uploaded = await getUploadedPastes();
+    if (uploaded.length === 0) return;
+
+    const messages = [];
+    for (const paste of uploaded) {
+        if (paste.key) {
+            setToken(paste.key, paste.token);
+            messages.push(`Your offline paste was uploaded to ${window.location.origin}/${paste.key}`);
+        } else {
+            messages.push(`Your offline paste could not be uploaded: ${paste.error}`);
+        }
+        await deleteUploadedPaste(paste.id);
+    }
+    showErrorPopup(messages.join("\n"));
+}
+
+async function fetchDocumentMerge(key, source, sourceVersion) {
+    const response = await fetch(`/documents/${key}/merge?source=${source}&source_version=${sourceVersion}`, {
+        method: "GET"
+    });
+
+    let body = await response.text();
+    try {
+        body = JSON.parse(body);
+    } catch (e) {
+        body = {message: body};
+    }
+    if (!response.ok) {
+        showErrorPopup(body.message || response.statusText);
+        console.error("error merging document:", response);
+        return;
+    }
+
+    return body
+}
+
+async function fetchDocumentRevisions(key, token) {
+    const response = await fetch(`/documents/${key}/revisions`, {
+        method: "GET",
+        headers: {
+            Authorization: `Bearer ${token}`
+        }
+    });
+
+    const body = await response.json();
+    if (!response.ok) {
+        showErrorPopup(body.message || response.statusText);
+        console.error("error fetching document revisions:", response);
+        return;
+    }
+
+    return body
+}
+
+async function reviewDocumentRevision(key, token, revision, action) {
+    const response = await fetch(`/documents/${key}/revisions/${revision}/${action}?formatter=html`, {
+        method: "POST",
+        headers: {
+            Authorization: `Bearer ${token}`
+        }
+    });
+
+    let body = await response.text();
+    try {
+        body = JSON.parse(body);
+    } catch (e) {
+        body = {message: body};
+    }
+    if (!response.ok) {
+        showErrorPopup(body.message || response.statusText);
+        console.error(`error trying to ${action} document revision:`, response);
+        return;
+    }
+
+    return body
+}
+
+function createReviewItem(key, token, revision) {
+    const item = document.createElement("li");
+
+    const header = document.createElement("div");
+    header.classList.add("review-header");
+    const time = document.createElement("time");
+    time.dateTime = new Date(revision.revision).toISOString();
+    time.innerText = new Date(revision.revision).toLocaleString();
+    header.appendChild(time);
+    if (revision.outdated) {
+        const outdated = document.createElement("span");
+        outdated.classList.add("review-outdated");
+        outdated.innerText = `based on version ${new Date(revision.base_version).toLocaleString()}`;
+        header.appendChild(outdated);
+    }
+    const spacer = document.createElement("div");
+    spacer.classList.add("spacer");
+    const approveButton = document.createElement("button");
+    approveButton.innerText = "approve";
+    approveButton.addEventListener("click", async () => {
+        const doc = await reviewDocumentRevision(key, token, revision.revision, "approve");
+        if (!doc) return;
+
+        const state = getState();
+        state.version = 0;
+        state.files = doc.files;
+        state.current_file = Math.min(state.current_file, doc.files.length - 1);
+        addVersionOption(doc);
+        item.remove();
+
+        updateCode(state);
+        updateButtons(state);
+        addState(state);
+    });
+    const rejectButton = document.createElement("button");
+    rejectButton.innerText = "reject";
+    rejectButton.addEventListener("click", async () => {
+        if (!await reviewDocumentRevision(key, token, revision.revision, "reject")) return;
+        item.remove();
+    });
+    header.append(spacer, approveButton, rejectButton);
+    item.appendChild(header);
+
+    for (const file of revision.changes) {
+        if (file.added === 0 && file.removed === 0) continue;
+
+        const name = document.createElement("div");
+        name.classList.add("review-file");
+        name.innerText = `${file.a_name && file.b_name && file.a_name !== file.b_name ? `${file.a_name} → ${file.b_name}` : file.b_name || file.a_name} +${file.added} -${file.removed}`;
+
+        const table = document.createElement("table");
+        table.classList.add("compare-table");
+        // only show changed rows with a few rows of context
+        const changed = file.rows.map(row => !row.left || !row.right || row.left.op !== "equal" || row.right.op !== "equal");
+        for (const [i, row] of file.rows.entries()) {
+            if (!changed.slice(Math.max(0, i - 2), i + 3).includes(true)) continue;
+
+            const tr = document.createElement("tr");
+            for (const line of [row.left, row.right]) {
+                const number = document.createElement("td");
+                number.classList.add("compare-ln");
+                const code = document.createElement("td");
+                code.classList.add("compare-code");
+                if (line) {
+                    number.innerText = line.number;
+                    code.innerText = line.text;
+                    code.classList.add(`compare-${line.op}`);
+                } else {
+                    code.classList.add("compare-empty");
+                }
+                tr.append(number, code);
+            }
+            table.appendChild(tr);
+        }
+        item.append(name, table);
+    }
+    return item;
+}
+
+// versionMessagePreview is the number of characters of a version message shown in the version select
+const versionMessagePreview = 40;
+
+function addVersionOption(doc, select = true) {
+    const optionElement = document.createElement("option");
+    optionElement.title = `${doc.version_time}`;
+    optionElement.value = doc.version;
+    optionElement.innerText = `${doc.version_label}`;
+    if (doc.version_message) {
+        const message = [...doc.version_message];
+        const preview = message.length > versionMessagePreview ? message.slice(0, versionMessagePreview - 1).join("") + "…" : doc.version_message;
+        optionElement.title += `\n${doc.version_message}`;
+        optionElement.innerText = `${preview} · ${doc.version_label}`;
+    }
+
+    const versionElement = document.getElementById("version");
+    if (!select) {
+        versionElement.insertBefore(optionElement, versionElement.firstChild);
+        return;
+    }
+    updateVersionSelect(-1);
+    versionElement.insertBefore(optionElement, versionElement.firstChild);
+    versionElement.value = doc.version;
+}
+
+/* Live Updates */
+
+let liveSource;
+
+// watchDocument shows new versions which are saved somewhere else without reloading the page
+function watchDocument(key) {
+    if (!key || !("EventSource" in window)) return;
+    if (liveSource) {
+        if (liveSource.key === key) return;
+        liveSource.close();
+    }
+
+    liveSource = new EventSource(`/documents/${key}/events`);
+    liveSource.key = key;
+    liveSource.addEventListener("update", async (event) => {
+        const {version} = JSON.parse(event.data);
+
+        // versions saved in this tab are already in the select
+        const versionElement = document.getElementById("version");
+        if ([...versionElement.options].some(option => option.value === `${version}`)) return;
+
+        const doc = await fetchDocument(key, version);
+        if (!doc) return;
+
+        const state = getState();
+        if (state.key !== key) return;
+
+        // viewers of older versions and editors only get the new version in the select
+        if (state.version !== 0 || state.mode !== "view") {
+            addVersionOption(doc, false);
+            return;
+        }
+
+        state.files = doc.files;
+        state.current_file = Math.min(state.current_file, doc.files.length - 1);
+        addVersionOption(doc);
+
+        updateFiles(state);
+        updateCode(state);
+        updateButtons(state);
+        setState(state);
+    });
+}
+
+/* Editor Highlighting */
+
+// the renderer is the server renderer compiled to WASM, it is only loaded once the editor is used
+let renderer;
+
+function loadRenderer() {
+    if (!renderer) {
+        renderer = doLoadRenderer().catch(e => {
+            console.warn("live highlighting is not available:", e);
+            return false;
+        });
+    }
+    return renderer;
+}
+
+async function doLoadRenderer() {
+    if (!("WebAssembly" in window)) return false;
+
+    const {wasmExec, renderer: rendererURL} = document.getElementById("code-edit-highlight").dataset;
+    await new Promise((resolve, reject) => {
+        const script = document.createElement("script");
+        script.src = wasmExec;
+        script.onload = resolve;
+        script.onerror = () => reject(new Error("failed to load wasm_exec.js"));
+        document.head.appendChild(script);
+    });
+
+    const ready = new Promise(resolve => window.addEventListener("gobin-render-ready", resolve, {once: true}));
+    const go = new Go();
+    const result = await WebAssembly.instantiateStreaming(fetch(rendererURL), go.importObject);
+    go.run(result.instance);
+    await ready;
+    return true;
+}
+
+let editHighlightFrame = 0;
+
+function scheduleEditHighlight() {
+    if (editHighlightFrame) return;
+    editHighlightFrame = requestAnimationFrame(() => {
+        editHighlightFrame = 0;
+        updateEditHighlight(getState());
+    });
+}
+
+async function updateEditHighlight(state) {
+    const codeEditElement = document.getElementById("code-edit");
+    const highlightElement = document.getElementById("code-edit-highlight");
+    const enabled = state.mode === "edit" && await loadRenderer();
+
+    codeEditElement.classList.toggle("highlighted", enabled);
+    highlightElement.style.display = enabled ? "block" : "none";
+    if (!enabled) return;
+
+    // the editor is always up to date, the state is only saved on keyup
+    const file = state.files[state.current_file];
+    const result = gobinRender(codeEditElement.value, file.language, file.name, parseInt(highlightElement.dataset.maxHighlightSize));
+    if (result.error) {
+        console.error("error highlighting file:", result.error);
+        return;
+    }
+    highlightElement.firstElementChild.innerHTML = result.formatted;
+    highlightElement.scrollTop = codeEditElement.scrollTop;
+    highlightElement.scrollLeft = codeEditElement.scrollLeft;
+}
+
+async function fetchDocument(key, version) {
+    const response = await fetch(`/documents/${key}${version !== 0 ? `/versions/${version}` : ""}?formatter=html`, {
+        method: "GET"
+    });
+
+    let body = await response.text();
+    try {
+        body = JSON.parse(body);
+    } catch (e) {
+        body = {message: body};
+    }
+    if (!response.ok) {
+        showErrorPopup(body.message || response.statusText);
+        console.error("error fetching document version:", response);
+        return;
+    }
+
+    body.files = await Promise.all(body.files.map(file => decryptFile(key, file)));
+    return body
+}
+
+// loadFile fetches the content of a file which was not sent with the page, it returns false if this failed.
+async function loadFile(state, index) {
+    const file = state.files[index];
+    if (!file || !file.lazy) return true;
+
+    const loaded = await fetchDocumentFile(state.key, state.version, file.name, file.language);
+    if (!loaded) return false;
+    state.files[index] = loaded;
+    return true;
+}
+
+async function loadFiles(state) {
+    for (const i of state.files.keys()) {
+        if (!await loadFile(state, i)) return false;
+    }
+    return true;
+}
+
+async function fetchDocumentFile(key, version, file, language) {
+    const response = await fetch(`/documents/${key}${version !== 0 ? `/versions/${version}` : ""}/files/${encodeURIComponent(file)}?formatter=html&language=${encodeURIComponent(language)}`, {
+        method: "GET"
+    });
+
+    let body = await response.text();
+    try {
+        body = JSON.parse(body);
+    } catch (e) {
+        body = {message: body};
+    }
+    if (!response.ok) {
+        showErrorPopup(body.message || response.statusText);
+        console.error("error fetching document version:", response);
+        return;
+    }
+
+    return await decryptFile(key, body);
+}
+
+async function deleteDocument(key, token) {
+    const response = await fetch(`/documents/${key}`, {
+        method: "DELETE",
+        headers: {
+            Authorization: `Bearer ${token}`
+        }
+    });
+
+    if (response.status === 204) {
+        return;
+    }
+
+    let body = await response.text();
+    try {
+        body = JSON.parse(body);
+    } catch (e) {
+        body = {message: body};
+    }
+    if (!response.ok) {
+        showErrorPopup(body.message || response.statusText);
+        console.error("error fetching document version:", response);
+    }
+}
+
+// latestVersion returns the newest version of the version select.
+function latestVersion() {
+    const option = document.getElementById("version").options.item(0);
+    return option ? parseInt(option.value) : 0;
+}
+
+function showErrorPopup(message) {
+    const popup = document.getElementById("error-popup");
+    popup.style.display = "block";
+    popup.innerText = message || "Something went wrong.";
+    setTimeout(() => popup.style.display = "none", 5000);
+}
+
+function getState() {
+    return window.history.state;
+}
+
+function getURL(state) {
+    const url = new URL(window.location.href);
+    if (state.files.length > 1) {
+        url.searchParams.set("file", state.files[state.current_file].name);
+    } else {
+        url.searchParams.delete("file");
+    }
+    url.pathname = `/${state.key}${state.version !== 0 ? `/${state.version}` : ""}`;
+    const encryptionKey = getEncryptionKey(state.key);
+    if (encryptionKey && state.files.some(file => file.encrypted)) {
+        url.hash = `key=${encryptionKey}`;
+    }
+    return url.toString();
+}
+
+function setState(state) {
+    window.history.replaceState(state, "", getURL(state))
+}
+
+function addState(state) {
+    window.history.pushState(state, "", getURL(state))
+}
+
+// getDefaultLanguage returns the language for new files from the user settings.
+function getDefaultLanguage() {
+    return document.getElementById("code-edit").dataset.defaultLanguage || "auto";
+}
+
+function getToken(key) {
+    const documents = localStorage.getItem("documents")
+    if (!documents) return ""
+    const token = JSON.parse(documents)[key]
+    if (!token) return ""
+
+    return token
+}
+
+function setToken(key, token) {
     let documents = localStorage.getItem("documents")
     if (!documents) {
         documents = "{}"
@@ -612,10 +2071,93 @@ function deleteToken(key) {
     localStorage.setItem("documents", JSON.stringify(parsedDocuments));
 }
 
+/* Encryption */
+
+// the key of encrypted documents is in the fragment of the url like #key={key}, browsers never send it to the server
+function getEncryptionKey(key) {
+    const keys = localStorage.getItem("keys");
+    if (!keys || !key) return "";
+    return JSON.parse(keys)[key] || "";
+}
+
+function setEncryptionKey(key, encryptionKey) {
+    const keys = JSON.parse(localStorage.getItem("keys") || "{}");
+    keys[key] = encryptionKey;
+    localStorage.setItem("keys", JSON.stringify(keys));
+}
+
+async function importEncryptionKey(encryptionKey) {
+    const raw = base64ToBytes(encryptionKey.replaceAll("-", "+").replaceAll("_", "/"));
+    return await crypto.subtle.importKey("raw", raw, "AES-GCM", false, ["encrypt", "decrypt"]);
+}
+
+// encryptContent returns the nonce and AES-GCM ciphertext as base64 like the CLI
+async function encryptContent(encryptionKey, content) {
+    const cryptoKey = await importEncryptionKey(encryptionKey);
+    const nonce = crypto.getRandomValues(new Uint8Array(12));
+    const ciphertext = await crypto.subtle.encrypt({name: "AES-GCM", iv: nonce}, cryptoKey, new TextEncoder().encode(content));
+
+    const data = new Uint8Array(nonce.length + ciphertext.byteLength);
+    data.set(nonce);
+    data.set(new Uint8Array(ciphertext), nonce.length);
+    return bytesToBase64(data);
+}
+
+// decryptFile replaces the content of an encrypted file with the decrypted content, the server can't highlight it, so
+// it is highlighted by the renderer.
+async function decryptFile(key, file) {
+    if (!file || !file.encrypted || file.lazy || file.decrypted) return file;
+
+    const encryptionKey = getEncryptionKey(key);
+    if (!encryptionKey) {
+        file.formatted = "This file is end-to-end encrypted, open the link with the key to read it.";
+        return file;
+    }
+
+    try {
+        const cryptoKey = await importEncryptionKey(encryptionKey);
+        const data = base64ToBytes(file.content);
+        const plaintext = await crypto.subtle.decrypt({name: "AES-GCM", iv: data.slice(0, 12)}, cryptoKey, data.slice(12));
+        file.content = new TextDecoder().decode(plaintext);
+    } catch (e) {
+        console.error("error decrypting file:", e);
+        file.formatted = "This file is end-to-end encrypted and the key of the link is wrong.";
+        return file;
+    }
+    file.decrypted = true;
+
+    file.formatted = file.content.replaceAll("&", "&amp;").replaceAll("<", "&lt;").replaceAll(">", "&gt;");
+    if (await loadRenderer()) {
+        const maxHighlightSize = parseInt(document.getElementById("code-edit-highlight").dataset.maxHighlightSize);
+        // the server only knows the language if it was set when saving
+        const result = gobinRender(file.content, file.language === "plaintext" ? "auto" : file.language, file.name, maxHighlightSize);
+        if (result.error) {
+            console.error("error highlighting file:", result.error);
+        } else {
+            file.formatted = result.formatted;
+            file.language = result.language;
+        }
+    }
+    return file;
+}
+
+function base64ToBytes(base64) {
+    return Uint8Array.from(atob(base64), c => c.charCodeAt(0));
+}
+
+function bytesToBase64(bytes) {
+    let binary = "";
+    for (const b of bytes) {
+        binary += String.fromCharCode(b);
+    }
+    return btoa(binary);
+}
+
 const PermissionWrite = 1
 const PermissionDelete = 2
 const PermissionShare = 4
 const PermissionWebhook = 8
+const PermissionReview = 16
 
 function hasPermission(token, permission) {
     if (!token) return false;
@@ -669,18 +2211,123 @@ function updateCode(state) {
     const codeElement = document.getElementById("code");
     const codeEditElement = document.getElementById("code-edit");
 
+    const smartView = state.mode === "view" && !!state.smart_view;
+    const diff = state.mode === "view" && !!state.diff || state.mode === "edit" && !!state.conflict;
+    const transform = state.mode === "view" && !smartView && !diff && state.transform ? state.transform : "";
     if (state.mode === "view") {
         codeEditElement.style.display = "none";
-        codeElement.style.display = "block";
+        codeElement.style.display = smartView || diff || transform ? "none" : "block";
     } else {
         codeEditElement.style.display = "block";
         codeElement.style.display = "none";
     }
+    const smartViewElement = document.getElementById("smart-view");
+    smartViewElement.style.display = smartView ? "block" : "none";
+    document.getElementById("log-filter").style.display = smartView && smartViewElement.dataset.logs === "true" ? "flex" : "none";
+    document.getElementById("smart-view-toggle").checked = smartView;
+    document.getElementById("diff-view").style.display = diff ? "block" : "none";
+    document.getElementById("diff-toggle").checked = state.mode === "view" && !!state.diff;
+    document.getElementById("transform-view").style.display = transform ? "block" : "none";
+    document.getElementById("transform").value = transform;
 
     const file = state.files[state.current_file];
     document.getElementById("code-edit").value = file.content;
     document.getElementById("code-view").innerHTML = file.formatted;
+    updateEditHighlight(state);
+    // the highlighted lines are gone after re-rendering
+    searchResult.key = "";
+    document.getElementById("search-count").innerText = "";
     document.getElementById("language").value = file.language;
+
+    const summaryText = document.getElementById("summary-text");
+    if (summaryText.dataset.version !== `${state.key}/${state.version}`) {
+        document.getElementById("summary-panel").open = false;
+        summaryText.innerText = "";
+        delete summaryText.dataset.version;
+    }
+
+    if (smartView) {
+        renderSmartView(state);
+    }
+
+    if (diff) {
+        renderDiff(state);
+    }
+
+    if (transform) {
+        renderTransform(state);
+    }
+
+    const blame = state.mode === "view" && !!state.blame;
+    document.getElementById("blame-toggle").checked = blame;
+    if (blame) {
+        renderBlame(state);
+    }
+
+    const outline = state.mode === "view" && !!state.outline;
+    document.getElementById("outline").style.display = outline ? "block" : "none";
+    document.getElementById("outline-toggle").checked = outline;
+    if (outline) {
+        renderOutline(state);
+    }
+
+    updateExpiresIn(state);
+    updateChecksum(state);
+    updateSignature(state);
+}
+
+function updateChecksum(state) {
+    const checksumElement = document.getElementById("checksum");
+    const file = state.files[state.current_file];
+    if (state.mode !== "view" || !file || !file.sha256) {
+        checksumElement.style.display = "none";
+        return;
+    }
+    checksumElement.innerText = `sha256 ${file.sha256.substring(0, 12)}`;
+    checksumElement.title = `SHA-256 checksum of the file, click to copy it\n${file.sha256}`;
+    checksumElement.style.display = "block";
+}
+
+function updateExpiresIn(state) {
+    if (!state) return;
+
+    const expiresInElement = document.getElementById("expires-in");
+    const file = state.files[state.current_file];
+    if (state.mode !== "view" || !file || !file.expires_at) {
+        expiresInElement.style.display = "none";
+        return;
+    }
+    expiresInElement.innerText = formatExpiresIn(new Date(file.expires_at).getTime() - Date.now());
+    expiresInElement.title = `Expires ${new Date(file.expires_at).toLocaleString()}`;
+    expiresInElement.style.display = "block";
+}
+
+function updateSignature(state) {
+    const signatureElement = document.getElementById("signature");
+    const file = state.files[state.current_file];
+    if (state.mode !== "view" || !file || !file.signature) {
+        signatureElement.style.display = "none";
+        return;
+    }
+    const comment = file.signature.comment ? `\n${file.signature.comment}` : "";
+    signatureElement.title = `The ${file.signature.format} signature of this file was verified with the key ${file.signature.key_id}${comment}`;
+    signatureElement.style.display = "block";
+}
+
+function formatExpiresIn(ms) {
+    const minutes = Math.floor(ms / (60 * 1000));
+    if (minutes < 1) {
+        return "expires in <1m";
+    }
+    const days = Math.floor(minutes / (24 * 60));
+    const hours = Math.floor(minutes / 60) % 24;
+    if (days > 0) {
+        return `expires in ${days}d ${hours}h`;
+    }
+    if (hours > 0) {
+        return `expires in ${hours}h ${minutes % 60}m`;
+    }
+    return `expires in ${minutes}m`;
 }
 
 function updateButtons(state) {
@@ -701,9 +2348,24 @@ function updateButtons(state) {
     const copyButton = document.getElementById("copy");
     const rawButton = document.getElementById("raw");
     const shareButton = document.getElementById("share");
+    const activityButton = document.getElementById("activity");
     const expireLabel = document.querySelector(`label[for="expire"]`);
+    const summaryPanel = document.getElementById("summary-panel");
+    const smartViewLabel = document.querySelector(`label[for="smart-view-toggle"]`);
+    const searchBar = document.getElementById("search-bar");
+    const outlineLabel = document.querySelector(`label[for="outline-toggle"]`);
+    const blameLabel = document.querySelector(`label[for="blame-toggle"]`);
+    const diffLabel = document.querySelector(`label[for="diff-toggle"]`);
+    const transformSelect = document.getElementById("transform");
+    const mergeButton = document.getElementById("merge");
+    const reviewButton = document.getElementById("review");
     const versionSelect = document.getElementById("version");
     versionSelect.disabled = versionSelect.options.length <= 1;
+    // the navigation between the parts of split content only belongs to the document the page was loaded with
+    const partsNav = document.getElementById("parts");
+    if (partsNav) {
+        partsNav.style.display = state.key === partsNav.dataset.key ? "flex" : "none";
+    }
     if (state.mode === "view") {
         fileAddButton.style.display = "none";
         saveButton.style.display = "none";
@@ -712,7 +2374,18 @@ function updateButtons(state) {
         copyButton.disabled = false;
         rawButton.disabled = false;
         shareButton.disabled = false;
+        activityButton.disabled = !token;
         expireLabel.style.display = "none";
+        summaryPanel.style.display = summaryPanel.dataset.enabled !== undefined && state.key ? "block" : "none";
+        smartViewLabel.style.display = state.key ? "flex" : "none";
+        searchBar.style.display = "flex";
+        outlineLabel.style.display = state.key ? "flex" : "none";
+        blameLabel.style.display = state.key ? "flex" : "none";
+        diffLabel.style.display = state.key ? "flex" : "none";
+        transformSelect.style.display = state.key ? "block" : "none";
+        mergeButton.style.display = state.key && state.parent ? "block" : "none";
+        mergeButton.disabled = !hasPermission(getToken(state.parent), PermissionWrite);
+        reviewButton.style.display = state.key && hasPermission(token, PermissionReview) ? "block" : "none";
         return;
     }
     fileAddButton.style.display = "block";
@@ -723,7 +2396,17 @@ function updateButtons(state) {
     copyButton.disabled = true;
     rawButton.disabled = true;
     shareButton.disabled = true;
+    activityButton.disabled = true;
     expireLabel.style.display = "block";
+    summaryPanel.style.display = "none";
+    smartViewLabel.style.display = "none";
+    searchBar.style.display = "none";
+    outlineLabel.style.display = "none";
+    blameLabel.style.display = "none";
+    diffLabel.style.display = "none";
+    transformSelect.style.display = "none";
+    mergeButton.style.display = "none";
+    reviewButton.style.display = "none";
 }
 
 function updateFaviconStyle(matches) {
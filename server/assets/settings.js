@@ -0,0 +1,226 @@
+document.getElementById("settings").addEventListener("submit", async (e) => {
+    e.preventDefault();
+    const form = new FormData(e.target);
+    const response = await sendSettingsRequest("PUT", {
+        default_style: form.get("default_style"),
+        default_expiry: form.get("default_expiry").trim(),
+        editor_keymap: form.get("editor_keymap"),
+        default_language: form.get("default_language")
+    });
+    if (response) {
+        setStatus("Saved, the settings apply to the next page you open.");
+    }
+});
+
+document.getElementById("settings-reset").addEventListener("click", async () => {
+    if (!await sendSettingsRequest("DELETE")) {
+        return;
+    }
+    document.getElementById("settings-default-style").value = "";
+    document.getElementById("settings-default-expiry").value = "";
+    document.getElementById("settings-editor-keymap").value = "default";
+    document.getElementById("settings-default-language").value = "";
+    setStatus("Reset to the defaults.");
+});
+
+document.getElementById("settings-token-create").addEventListener("click", async () => {
+    const response = await fetch("/user/token", {
+        method: "POST"
+    });
+    const body = await response.json();
+    if (!response.ok) {
+        setStatus(body.message || response.statusText);
+        console.error("error trying to create user token:", response);
+        return;
+    }
+
+    const tokenElement = document.getElementById("settings-token");
+    tokenElement.innerText = `gobin env -w USER_TOKEN=${body.token}`;
+    tokenElement.style.display = "block";
+    setStatus("Run this command to use these settings with the gobin CLI:");
+});
+
+async function sendSettingsRequest(method, body) {
+    const response = await fetch("/user/settings", {
+        method: method,
+        body: body ? JSON.stringify(body) : undefined,
+        headers: {
+            "Content-Type": "application/json"
+        }
+    });
+
+    if (!response.ok) {
+        const body = await response.json();
+        setStatus(body.message || response.statusText);
+        console.error(`error trying to ${method.toLowerCase()} settings:`, response);
+        return false;
+    }
+
+    // the style picked on a document would take precedence over the default style of the settings
+    document.cookie = "style=; path=/; max-age=-1";
+    return true;
+}
+
+function setStatus(message) {
+    document.getElementById("settings-status").innerText = message;
+}
+
+for (const button of document.querySelectorAll(".settings-session-revoke")) {
+    button.addEventListener("click", async () => {
+        const session = button.closest("li");
+        if (await sendSessionsRequest(`/account/sessions/${encodeURIComponent(session.dataset.sessionId)}`)) {
+            session.remove();
+            setStatus("Revoked the session.");
+        }
+    });
+}
+
+document.getElementById("settings-sessions-revoke")?.addEventListener("click", async () => {
+    if (!await sendSessionsRequest("/account/sessions")) {
+        return;
+    }
+    for (const button of document.querySelectorAll(".settings-session-revoke")) {
+        button.closest("li").remove();
+    }
+    setStatus("Revoked all other sessions.");
+});
+
+async function sendSessionsRequest(url) {
+    const response = await fetch(url, {
+        method: "DELETE"
+    });
+    if (!response.ok) {
+        const body = await response.json();
+        setStatus(body.message || response.statusText);
+        console.error("error trying to revoke session:", response);
+        return false;
+    }
+    return true;
+}
+
+document.getElementById("settings-totp-start")?.addEventListener("click", async (e) => {
+    const body = await sendTwoFactorRequest("POST", "/account/two-factor/totp");
+    if (!body) {
+        return;
+    }
+    document.getElementById("settings-totp-secret").innerText = body.secret;
+    document.getElementById("settings-totp-uri").href = body.uri;
+    document.getElementById("settings-totp-setup").style.display = "block";
+    e.target.style.display = "none";
+    document.getElementById("settings-totp-code").focus();
+});
+
+document.getElementById("settings-totp-confirm")?.addEventListener("submit", async (e) => {
+    e.preventDefault();
+    const body = await sendTwoFactorRequest("POST", "/account/two-factor/totp/confirm", {
+        code: document.getElementById("settings-totp-code").value.trim()
+    });
+    if (body) {
+        twoFactorAdded(body, "Set up the authenticator app.");
+    }
+});
+
+document.getElementById("settings-totp-remove")?.addEventListener("click", async () => {
+    if (await sendTwoFactorRequest("DELETE", "/account/two-factor/totp")) {
+        location.reload();
+    }
+});
+
+document.getElementById("settings-passkey-add")?.addEventListener("submit", async (e) => {
+    e.preventDefault();
+    const options = await sendTwoFactorRequest("POST", "/account/two-factor/passkeys/options");
+    if (!options) {
+        return;
+    }
+
+    let credential;
+    try {
+        credential = await navigator.credentials.create({
+            publicKey: {
+                challenge: decodeBase64URL(options.challenge),
+                rp: {id: options.rp_id, name: "gobin"},
+                user: {id: decodeBase64URL(options.user_id), name: options.user_name, displayName: options.user_name},
+                pubKeyCredParams: options.algorithms.map(alg => ({type: "public-key", alg: alg})),
+                excludeCredentials: options.credentials.map(id => ({type: "public-key", id: decodeBase64URL(id)})),
+                authenticatorSelection: {userVerification: "preferred"},
+                attestation: "none",
+                timeout: 300000
+            }
+        });
+    } catch (err) {
+        setStatus("The passkey wasn't created.");
+        console.error("error trying to create passkey:", err);
+        return;
+    }
+
+    const body = await sendTwoFactorRequest("POST", "/account/two-factor/passkeys", {
+        name: document.getElementById("settings-passkey-name").value,
+        state: options.state,
+        client_data_json: encodeBase64URL(credential.response.clientDataJSON),
+        attestation_object: encodeBase64URL(credential.response.attestationObject)
+    });
+    if (body) {
+        twoFactorAdded(body, "Added the passkey.");
+    }
+});
+
+for (const button of document.querySelectorAll(".settings-passkey-remove")) {
+    button.addEventListener("click", async () => {
+        const passkey = button.closest("li");
+        if (await sendTwoFactorRequest("DELETE", `/account/two-factor/passkeys/${encodeURIComponent(passkey.dataset.passkeyId)}`)) {
+            location.reload();
+        }
+    });
+}
+
+document.getElementById("settings-recovery-codes-create")?.addEventListener("click", async () => {
+    const body = await sendTwoFactorRequest("POST", "/account/two-factor/recovery-codes");
+    if (body) {
+        showRecoveryCodes(body.recovery_codes, "Replaced your recovery codes.");
+    }
+});
+
+// twoFactorAdded shows the recovery codes the first factor of an account gets, the page is reloaded otherwise
+function twoFactorAdded(body, message) {
+    if (!body.recovery_codes) {
+        location.reload();
+        return;
+    }
+    showRecoveryCodes(body.recovery_codes, `${message} Your other sessions were logged out.`);
+}
+
+function showRecoveryCodes(codes, message) {
+    const codesElement = document.getElementById("settings-recovery-codes");
+    codesElement.innerText = codes.join("\n");
+    codesElement.style.display = "block";
+    codesElement.scrollIntoView();
+    setStatus(`${message} Save these recovery codes, each confirms one login if you lose your authenticator app and passkeys. They aren't shown again.`);
+}
+
+async function sendTwoFactorRequest(method, url, body) {
+    const response = await fetch(url, {
+        method: method,
+        body: body ? JSON.stringify(body) : undefined,
+        headers: {
+            "Content-Type": "application/json"
+        }
+    });
+    if (!response.ok) {
+        const body = await response.json();
+        setStatus(body.message || response.statusText);
+        console.error(`error trying to ${method.toLowerCase()} ${url}:`, response);
+        return null;
+    }
+    if (response.status === 204) {
+        return {};
+    }
+    return await response.json();
+}
+
+function decodeBase64URL(value) {
+    return Uint8Array.from(atob(value.replace(/-/g, "+").replace(/_/g, "/")), c => c.charCodeAt(0));
+}
+
+function encodeBase64URL(buffer) {
+    return btoa(String.fromCharCode(...new Uint8Array(buffer))).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
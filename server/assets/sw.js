@@ -0,0 +1,168 @@
+importScripts("/assets/outbox.js");
+
+const shellCacheName = "gobin-shell-v1";
+const documentsCacheName = "gobin-documents";
+// how many recently viewed pages and documents are kept for offline reading
+const maxCachedDocuments = 50;
+
+const shellURLs = [
+    "/",
+    "/manifest.json",
+    "/assets/style.css",
+    "/assets/script.js",
+    "/assets/outbox.js",
+    "/assets/favicon.png",
+    "/assets/favicon-light.png",
+    "/assets/icon-192.png",
+    "/assets/icon-512.png",
+];
+
+// the document and file api responses which are cached next to the pages, search and compare results are never cached
+const documentPattern = /^\/documents\/(?!search$|compare$)[^/]+(\/versions(\/\d+)?)?(\/files\/[^/]+)?$/;
+
+self.addEventListener("install", (event) => {
+    event.waitUntil((async () => {
+        const cache = await caches.open(shellCacheName);
+        await cache.addAll(shellURLs);
+        await self.skipWaiting();
+    })());
+});
+
+self.addEventListener("activate", (event) => {
+    event.waitUntil((async () => {
+        for (const name of await caches.keys()) {
+            if (name !== shellCacheName && name !== documentsCacheName) {
+                await caches.delete(name);
+            }
+        }
+        await self.clients.claim();
+    })());
+});
+
+self.addEventListener("fetch", (event) => {
+    const request = event.request;
+    const url = new URL(request.url);
+    if (request.method !== "GET" || url.origin !== self.location.origin || request.headers.has("Authorization")) {
+        return;
+    }
+
+    if (url.pathname.startsWith("/assets/")) {
+        event.respondWith(staleWhileRevalidate(event, request));
+        return;
+    }
+    if (request.mode === "navigate" || documentPattern.test(url.pathname)) {
+        event.respondWith(networkFirst(request, request.mode === "navigate"));
+    }
+});
+
+async function staleWhileRevalidate(event, request) {
+    const cache = await caches.open(shellCacheName);
+    const cached = await cache.match(request);
+    const update = fetch(request).then(async response => {
+        if (response.ok) {
+            await cache.put(request, response.clone());
+        }
+        return response;
+    });
+    if (cached) {
+        event.waitUntil(update.catch(() => undefined));
+        return cached;
+    }
+    return update;
+}
+
+async function networkFirst(request, navigate) {
+    const cache = await caches.open(documentsCacheName);
+    try {
+        const response = await fetch(request);
+        if (response.ok) {
+            // delete first so the entry moves to the end and the least recently viewed documents are removed first
+            await cache.delete(request);
+            await cache.put(request, response.clone());
+            await trimCache(cache);
+        }
+        return response;
+    } catch (e) {
+        const cached = await caches.match(request);
+        if (cached) {
+            return cached;
+        }
+        if (!navigate) {
+            throw e;
+        }
+        return new Response("You are offline and this document was not viewed before.", {
+            status: 503,
+            headers: {"Content-Type": "text/plain; charset=utf-8"}
+        });
+    }
+}
+
+async function trimCache(cache) {
+    const keys = await cache.keys();
+    for (const key of keys.slice(0, Math.max(0, keys.length - maxCachedDocuments))) {
+        await cache.delete(key);
+    }
+}
+
+self.addEventListener("sync", (event) => {
+    if (event.tag === "upload-pastes") {
+        event.waitUntil(uploadOfflinePastes());
+    }
+});
+
+// browsers without background sync ask for the upload once they are online again
+self.addEventListener("message", (event) => {
+    if (event.data === "upload-pastes") {
+        event.waitUntil(uploadOfflinePastes());
+    }
+});
+
+let uploading;
+
+function uploadOfflinePastes() {
+    if (!uploading) {
+        uploading = doUploadOfflinePastes().finally(() => uploading = undefined);
+    }
+    return uploading;
+}
+
+async function doUploadOfflinePastes() {
+    const pastes = await getOfflinePastes();
+    if (pastes.length === 0) return;
+
+    for (const paste of pastes) {
+        const data = new FormData();
+        for (const [i, file] of paste.files.entries()) {
+            data.append(`file-${i}`, new Blob([file.content], {type: file.language}), file.name);
+        }
+        const headers = {};
+        if (paste.expires) {
+            headers["Expires"] = paste.expires;
+        }
+
+        // a network error rejects and the browser retries the sync later
+        const response = await fetch("/documents", {
+            method: "POST",
+            body: data,
+            headers: headers
+        });
+
+        let body = await response.text();
+        try {
+            body = JSON.parse(body);
+        } catch (e) {
+            body = {message: body};
+        }
+
+        if (response.ok) {
+            await addUploadedPaste({key: body.key, token: body.token});
+        } else {
+            await addUploadedPaste({error: body.message || response.statusText});
+        }
+        await deleteOfflinePaste(paste.id);
+    }
+
+    for (const client of await self.clients.matchAll()) {
+        client.postMessage("pastes-uploaded");
+    }
+}
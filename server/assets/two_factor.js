@@ -0,0 +1,74 @@
+document.getElementById("two-factor").addEventListener("submit", async (e) => {
+    e.preventDefault();
+    const value = document.getElementById("two-factor-code").value.replace(/\s/g, "");
+    // codes of authenticator apps are digits only, recovery codes have letters
+    await confirmLogin(/^\d{6}$/.test(value) ? {code: value} : {recovery_code: value});
+});
+
+document.getElementById("two-factor-passkey")?.addEventListener("click", async () => {
+    const response = await fetch("/login/two-factor/options", {
+        method: "POST"
+    });
+    const options = await response.json();
+    if (!response.ok) {
+        setStatus(options.message || response.statusText);
+        console.error("error trying to get passkey options:", response);
+        return;
+    }
+
+    let credential;
+    try {
+        credential = await navigator.credentials.get({
+            publicKey: {
+                challenge: decodeBase64URL(options.challenge),
+                rpId: options.rp_id,
+                allowCredentials: options.credentials.map(id => ({type: "public-key", id: decodeBase64URL(id)})),
+                userVerification: "preferred",
+                timeout: 300000
+            }
+        });
+    } catch (err) {
+        setStatus("The passkey wasn't used.");
+        console.error("error trying to get passkey:", err);
+        return;
+    }
+
+    await confirmLogin({
+        passkey: {
+            state: options.state,
+            id: credential.id,
+            client_data_json: encodeBase64URL(credential.response.clientDataJSON),
+            authenticator_data: encodeBase64URL(credential.response.authenticatorData),
+            signature: encodeBase64URL(credential.response.signature)
+        }
+    });
+});
+
+async function confirmLogin(body) {
+    const response = await fetch("/login/two-factor", {
+        method: "POST",
+        body: JSON.stringify(body),
+        headers: {
+            "Content-Type": "application/json"
+        }
+    });
+    const responseBody = await response.json();
+    if (!response.ok) {
+        setStatus(responseBody.message || response.statusText);
+        console.error("error trying to confirm login:", response);
+        return;
+    }
+    location.href = responseBody.redirect;
+}
+
+function setStatus(message) {
+    document.getElementById("two-factor-status").innerText = message;
+}
+
+function decodeBase64URL(value) {
+    return Uint8Array.from(atob(value.replace(/-/g, "+").replace(/_/g, "/")), c => c.charCodeAt(0));
+}
+
+function encodeBase64URL(buffer) {
+    return btoa(String.fromCharCode(...new Uint8Array(buffer))).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
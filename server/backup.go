@@ -0,0 +1,636 @@
+package server
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+const (
+	BackupRecordVersion   = "version"
+	BackupRecordTombstone = "tombstone"
+	BackupRecordDocument  = "document"
+)
+
+// The files of a backup archive, the manifest describes the backup and the records are the same JSON lines as a plain
+// backup.
+const (
+	BackupArchiveManifest = "manifest.json"
+	BackupArchiveRecords  = "backup.jsonl"
+	// BackupArchiveFormat is increased when the archive changes in a way older versions can't restore.
+	BackupArchiveFormat = 1
+)
+
+// zstdMagic are the first bytes of every zstd frame, restore uses them to tell archives and plain backups apart.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// backupPageSize is the number of documents read at once while exporting.
+const backupPageSize = 100
+
+// maxBackupLineSize limits a single line of a backup, a line contains all files of a document version.
+const maxBackupLineSize = 1 << 30
+
+// BackupRecord is a single line of a backup, either a document version with its files, the settings of a document or a
+// tombstone of a deletion.
+type BackupRecord struct {
+	Type            string       `json:"type"`
+	DocumentID      string       `json:"document_id"`
+	DocumentVersion int64        `json:"document_version"`
+	Files           []BackupFile `json:"files,omitempty"`
+	// Message is the message of the version.
+	Message   string          `json:"message,omitempty"`
+	Document  *BackupDocument `json:"document,omitempty"`
+	DeletedAt *time.Time      `json:"deleted_at,omitempty"`
+	Reason    string          `json:"reason,omitempty"`
+}
+
+type BackupFile struct {
+	Name      string     `json:"name"`
+	Content   string     `json:"content"`
+	Language  string     `json:"language"`
+	Encrypted bool       `json:"encrypted,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// BackupDocument is everything of a document besides its versions. It's written after the versions, since it's only
+// restored for documents which have versions.
+type BackupDocument struct {
+	Style     string          `json:"style,omitempty"`
+	Protected bool            `json:"protected,omitempty"`
+	Tags      []string        `json:"tags,omitempty"`
+	Fork      *BackupFork     `json:"fork,omitempty"`
+	Part      *BackupPart     `json:"part,omitempty"`
+	Webhooks  []BackupWebhook `json:"webhooks,omitempty"`
+	Invites   []BackupInvite  `json:"invites,omitempty"`
+	Members   []BackupMember  `json:"members,omitempty"`
+}
+
+type BackupFork struct {
+	ParentID      string `json:"parent_id"`
+	ParentVersion int64  `json:"parent_version"`
+	MergedVersion int64  `json:"merged_version"`
+}
+
+type BackupPart struct {
+	IndexID   string `json:"index_id"`
+	PartIndex int    `json:"part_index"`
+}
+
+// BackupWebhook is a webhook with its secret and client certificate in plaintext, they are encrypted again with the
+// key of the restoring instance.
+type BackupWebhook struct {
+	ID                string `json:"id"`
+	URL               string `json:"url"`
+	Secret            string `json:"secret"`
+	Events            string `json:"events"`
+	ClientCertificate string `json:"client_certificate,omitempty"`
+	Enabled           bool   `json:"enabled"`
+	DisabledReason    string `json:"disabled_reason,omitempty"`
+}
+
+type BackupInvite struct {
+	ID          string     `json:"id"`
+	Permissions int64      `json:"permissions"`
+	MaxUses     int64      `json:"max_uses"`
+	Uses        int64      `json:"uses"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type BackupMember struct {
+	CreatorID   string    `json:"creator_id"`
+	Permissions int64     `json:"permissions"`
+	InviteID    string    `json:"invite_id"`
+	JoinedAt    time.Time `json:"joined_at"`
+}
+
+// BackupManifest describes a backup archive.
+type BackupManifest struct {
+	Format       int       `json:"format"`
+	GobinVersion string    `json:"gobin_version"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// RestoreResult counts the records of a restored backup.
+type RestoreResult struct {
+	Versions   int
+	Tombstones int
+	Documents  int
+	// Skipped are the versions which were not restored because they were deleted.
+	Skipped int
+}
+
+// Export writes all document versions and tombstones as JSON lines. Tombstones are written first and tombstones of
+// documents deleted during the export are written last, so restoring the backup never brings back a deleted document.
+func (s *Server) Export(ctx context.Context, w io.Writer) error {
+	startedAt := time.Now()
+	enc := json.NewEncoder(w)
+
+	if err := s.exportTombstones(ctx, enc, time.Time{}); err != nil {
+		return err
+	}
+
+	var afterID string
+	for {
+		documentIDs, err := s.db.GetDocumentIDs(ctx, afterID, backupPageSize)
+		if err != nil {
+			return fmt.Errorf("failed to get documents: %w", err)
+		}
+		for _, documentID := range documentIDs {
+			if err = s.exportDocument(ctx, enc, documentID); err != nil {
+				return err
+			}
+		}
+		if len(documentIDs) < backupPageSize {
+			break
+		}
+		afterID = documentIDs[len(documentIDs)-1]
+	}
+
+	return s.exportTombstones(ctx, enc, startedAt)
+}
+
+func (s *Server) exportTombstones(ctx context.Context, enc *json.Encoder, since time.Time) error {
+	tombstones, err := s.db.GetTombstones(ctx, since)
+	if err != nil {
+		return fmt.Errorf("failed to get tombstones: %w", err)
+	}
+	for _, tombstone := range tombstones {
+		if err = enc.Encode(BackupRecord{
+			Type:            BackupRecordTombstone,
+			DocumentID:      tombstone.DocumentID,
+			DocumentVersion: tombstone.DocumentVersion,
+			DeletedAt:       &tombstone.DeletedAt,
+			Reason:          tombstone.Reason,
+		}); err != nil {
+			return fmt.Errorf("failed to write tombstone: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *Server) exportDocument(ctx context.Context, enc *json.Encoder, documentID string) error {
+	versions, err := s.db.GetDocumentVersionsWithFiles(ctx, documentID, true)
+	if err != nil {
+		return fmt.Errorf("failed to get versions of document %s: %w", documentID, err)
+	}
+	messages, err := s.db.GetVersionMessages(ctx, documentID)
+	if err != nil {
+		return fmt.Errorf("failed to get version messages of document %s: %w", documentID, err)
+	}
+
+	// oldest versions first, so a partially restored backup keeps the order of the versions
+	for _, version := range slices.Sorted(maps.Keys(versions)) {
+		files := versions[version]
+		record := BackupRecord{
+			Type:            BackupRecordVersion,
+			DocumentID:      documentID,
+			DocumentVersion: version,
+			Files:           make([]BackupFile, 0, len(files)),
+			Message:         messages[version],
+		}
+		for _, file := range files {
+			record.Files = append(record.Files, BackupFile{
+				Name:      file.Name,
+				Content:   file.Content,
+				Language:  file.Language,
+				Encrypted: file.Encrypted,
+				ExpiresAt: file.ExpiresAt,
+			})
+		}
+		if err = enc.Encode(record); err != nil {
+			return fmt.Errorf("failed to write version %d of document %s: %w", version, documentID, err)
+		}
+	}
+	if len(versions) == 0 {
+		return nil
+	}
+
+	document, err := s.exportDocumentSettings(ctx, documentID)
+	if err != nil {
+		return fmt.Errorf("failed to get settings of document %s: %w", documentID, err)
+	}
+	if document == nil {
+		return nil
+	}
+	if err = enc.Encode(BackupRecord{
+		Type:       BackupRecordDocument,
+		DocumentID: documentID,
+		Document:   document,
+	}); err != nil {
+		return fmt.Errorf("failed to write settings of document %s: %w", documentID, err)
+	}
+	return nil
+}
+
+// exportDocumentSettings returns the settings, webhooks and access list of the document or nil if it has none.
+func (s *Server) exportDocumentSettings(ctx context.Context, documentID string) (*BackupDocument, error) {
+	var document BackupDocument
+	var err error
+	if document.Style, err = s.db.GetDocumentStyle(ctx, documentID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if document.Protected, err = s.db.IsDocumentProtected(ctx, documentID); err != nil {
+		return nil, err
+	}
+	if document.Tags, err = s.db.GetDocumentTags(ctx, documentID); err != nil {
+		return nil, err
+	}
+
+	fork, err := s.db.GetFork(ctx, documentID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if fork != nil {
+		document.Fork = &BackupFork{
+			ParentID:      fork.ParentID,
+			ParentVersion: fork.ParentVersion,
+			MergedVersion: fork.MergedVersion,
+		}
+	}
+
+	part, err := s.db.GetDocumentPart(ctx, documentID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if part != nil {
+		document.Part = &BackupPart{
+			IndexID:   part.IndexID,
+			PartIndex: part.PartIndex,
+		}
+	}
+
+	webhooks, err := s.db.GetWebhooksByDocumentID(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	for _, webhook := range webhooks {
+		secret, err := s.secrets.Decrypt(ctx, webhook.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt secret of webhook %s: %w", webhook.ID, err)
+		}
+		clientCertificate, err := s.secrets.Decrypt(ctx, webhook.ClientCertificate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt client certificate of webhook %s: %w", webhook.ID, err)
+		}
+		document.Webhooks = append(document.Webhooks, BackupWebhook{
+			ID:                webhook.ID,
+			URL:               webhook.URL,
+			Secret:            secret,
+			Events:            webhook.Events,
+			ClientCertificate: clientCertificate,
+			Enabled:           webhook.Enabled,
+			DisabledReason:    webhook.DisabledReason,
+		})
+	}
+
+	invites, err := s.db.GetDocumentInvites(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	for _, invite := range invites {
+		document.Invites = append(document.Invites, BackupInvite{
+			ID:          invite.ID,
+			Permissions: invite.Permissions,
+			MaxUses:     invite.MaxUses,
+			Uses:        invite.Uses,
+			ExpiresAt:   invite.ExpiresAt,
+			CreatedAt:   invite.CreatedAt,
+		})
+	}
+
+	members, err := s.db.GetDocumentMembers(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		document.Members = append(document.Members, BackupMember{
+			CreatorID:   member.CreatorID,
+			Permissions: member.Permissions,
+			InviteID:    member.InviteID,
+			JoinedAt:    member.JoinedAt,
+		})
+	}
+
+	if document.Style == "" && !document.Protected && len(document.Tags) == 0 && document.Fork == nil && document.Part == nil && len(document.Webhooks) == 0 && len(document.Invites) == 0 && len(document.Members) == 0 {
+		return nil, nil
+	}
+	return &document, nil
+}
+
+// ExportArchive writes the backup of Export as zstd compressed tar archive with a manifest. The records are written to
+// a temporary file first, since tar needs the size of a file before its content.
+func (s *Server) ExportArchive(ctx context.Context, w io.Writer) error {
+	tmp, err := os.CreateTemp("", "gobin-backup-*.jsonl")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary backup file: %w", err)
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	startedAt := time.Now()
+	if err = s.Export(ctx, tmp); err != nil {
+		return err
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat temporary backup file: %w", err)
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek temporary backup file: %w", err)
+	}
+
+	manifest, err := json.MarshalIndent(BackupManifest{
+		Format:       BackupArchiveFormat,
+		GobinVersion: s.version.Version,
+		CreatedAt:    startedAt,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode backup manifest: %w", err)
+	}
+
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return fmt.Errorf("failed to create zstd writer: %w", err)
+	}
+	tw := tar.NewWriter(zw)
+	if err = tw.WriteHeader(&tar.Header{
+		Name:    BackupArchiveManifest,
+		Mode:    0644,
+		Size:    int64(len(manifest)),
+		ModTime: startedAt,
+	}); err != nil {
+		return fmt.Errorf("failed to write backup manifest: %w", err)
+	}
+	if _, err = tw.Write(manifest); err != nil {
+		return fmt.Errorf("failed to write backup manifest: %w", err)
+	}
+	if err = tw.WriteHeader(&tar.Header{
+		Name:    BackupArchiveRecords,
+		Mode:    0644,
+		Size:    info.Size(),
+		ModTime: startedAt,
+	}); err != nil {
+		return fmt.Errorf("failed to write backup records: %w", err)
+	}
+	if _, err = io.Copy(tw, tmp); err != nil {
+		return fmt.Errorf("failed to write backup records: %w", err)
+	}
+	if err = tw.Close(); err != nil {
+		return fmt.Errorf("failed to close backup archive: %w", err)
+	}
+	return zw.Close()
+}
+
+// Restore imports a backup written by Export or ExportArchive. Tombstones delete the versions they cover and versions
+// covered by a tombstone are skipped, so restoring an old backup doesn't bring back documents deleted after it was
+// written.
+func (s *Server) Restore(ctx context.Context, r io.Reader) (RestoreResult, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(zstdMagic)); bytes.Equal(magic, zstdMagic) {
+		records, closeArchive, err := openBackupArchive(br)
+		if err != nil {
+			return RestoreResult{}, err
+		}
+		defer closeArchive()
+		return s.restoreRecords(ctx, records)
+	}
+	return s.restoreRecords(ctx, br)
+}
+
+// openBackupArchive returns the records of a backup archive. Archives of a newer format are rejected.
+func openBackupArchive(r io.Reader) (io.Reader, func(), error) {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create zstd reader: %w", err)
+	}
+	tr := tar.NewReader(zr)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			zr.Close()
+			if errors.Is(err, io.EOF) {
+				return nil, nil, fmt.Errorf("backup archive has no %s", BackupArchiveRecords)
+			}
+			return nil, nil, fmt.Errorf("failed to read backup archive: %w", err)
+		}
+		switch header.Name {
+		case BackupArchiveManifest:
+			var manifest BackupManifest
+			if err = json.NewDecoder(tr).Decode(&manifest); err != nil {
+				zr.Close()
+				return nil, nil, fmt.Errorf("failed to decode backup manifest: %w", err)
+			}
+			if manifest.Format > BackupArchiveFormat {
+				zr.Close()
+				return nil, nil, fmt.Errorf("backup archive format %d of gobin %s is not supported", manifest.Format, manifest.GobinVersion)
+			}
+		case BackupArchiveRecords:
+			return tr, zr.Close, nil
+		}
+	}
+}
+
+func (s *Server) restoreRecords(ctx context.Context, r io.Reader) (RestoreResult, error) {
+	var result RestoreResult
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxBackupLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record BackupRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return result, fmt.Errorf("failed to decode line %d: %w", line, err)
+		}
+
+		switch record.Type {
+		case BackupRecordTombstone:
+			if record.DeletedAt == nil {
+				return result, fmt.Errorf("tombstone on line %d has no deletion time", line)
+			}
+			if err := s.db.ApplyTombstone(ctx, database.Tombstone{
+				DocumentID:      record.DocumentID,
+				DocumentVersion: record.DocumentVersion,
+				DeletedAt:       *record.DeletedAt,
+				Reason:          record.Reason,
+			}); err != nil {
+				return result, fmt.Errorf("failed to apply tombstone on line %d: %w", line, err)
+			}
+			result.Tombstones++
+		case BackupRecordVersion:
+			files := make([]database.File, 0, len(record.Files))
+			for i, file := range record.Files {
+				files = append(files, database.File{
+					DocumentID:      record.DocumentID,
+					DocumentVersion: record.DocumentVersion,
+					Name:            file.Name,
+					Content:         file.Content,
+					Language:        file.Language,
+					Encrypted:       file.Encrypted,
+					ExpiresAt:       file.ExpiresAt,
+					OrderIndex:      i,
+				})
+			}
+			err := s.db.ImportDocumentVersion(ctx, record.DocumentID, record.DocumentVersion, files)
+			if errors.Is(err, database.ErrDocumentVersionDeleted) {
+				result.Skipped++
+				continue
+			}
+			if err != nil {
+				return result, fmt.Errorf("failed to restore version %d of document %s: %w", record.DocumentVersion, record.DocumentID, err)
+			}
+			if record.Message != "" {
+				if err = s.db.SetVersionMessage(ctx, record.DocumentID, record.DocumentVersion, record.Message); err != nil {
+					return result, fmt.Errorf("failed to restore message of version %d of document %s: %w", record.DocumentVersion, record.DocumentID, err)
+				}
+			}
+			result.Versions++
+		case BackupRecordDocument:
+			if record.Document == nil {
+				return result, fmt.Errorf("document on line %d has no settings", line)
+			}
+			restored, err := s.restoreDocumentSettings(ctx, record.DocumentID, *record.Document)
+			if err != nil {
+				return result, fmt.Errorf("failed to restore settings of document %s: %w", record.DocumentID, err)
+			}
+			if restored {
+				result.Documents++
+			}
+		default:
+			return result, fmt.Errorf("invalid record type %q on line %d", record.Type, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return result, fmt.Errorf("failed to read backup: %w", err)
+	}
+	return result, nil
+}
+
+// restoreDocumentSettings restores the settings of a document which has versions, documents without versions were
+// deleted and their settings would be deleted as orphaned anyway. Existing webhooks, invites, forks and parts are kept.
+func (s *Server) restoreDocumentSettings(ctx context.Context, documentID string, document BackupDocument) (bool, error) {
+	versions, err := s.db.GetVersionCount(ctx, documentID)
+	if err != nil {
+		return false, err
+	}
+	if versions == 0 {
+		return false, nil
+	}
+
+	if document.Style != "" {
+		if err = s.db.SetDocumentStyle(ctx, documentID, document.Style); err != nil {
+			return false, err
+		}
+	}
+	if document.Protected {
+		if err = s.db.SetDocumentProtected(ctx, documentID, true); err != nil {
+			return false, err
+		}
+	}
+	if len(document.Tags) > 0 {
+		if err = s.db.SetDocumentTags(ctx, documentID, document.Tags); err != nil {
+			return false, err
+		}
+	}
+	if document.Fork != nil {
+		if _, err = s.db.GetFork(ctx, documentID); errors.Is(err, sql.ErrNoRows) {
+			err = s.db.CreateFork(ctx, database.Fork{
+				DocumentID:    documentID,
+				ParentID:      document.Fork.ParentID,
+				ParentVersion: document.Fork.ParentVersion,
+				MergedVersion: document.Fork.MergedVersion,
+			})
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	if document.Part != nil {
+		if _, err = s.db.GetDocumentPart(ctx, documentID); errors.Is(err, sql.ErrNoRows) {
+			err = s.db.CreateDocumentPart(ctx, database.DocumentPart{
+				DocumentID: documentID,
+				IndexID:    document.Part.IndexID,
+				PartIndex:  document.Part.PartIndex,
+			})
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+
+	for _, webhook := range document.Webhooks {
+		secret, err := s.secrets.Encrypt(ctx, webhook.Secret)
+		if err != nil {
+			return false, fmt.Errorf("failed to encrypt secret of webhook %s: %w", webhook.ID, err)
+		}
+		var clientCertificate string
+		if webhook.ClientCertificate != "" {
+			if clientCertificate, err = s.secrets.Encrypt(ctx, webhook.ClientCertificate); err != nil {
+				return false, fmt.Errorf("failed to encrypt client certificate of webhook %s: %w", webhook.ID, err)
+			}
+		}
+		if err = s.db.ImportWebhook(ctx, database.Webhook{
+			ID:                webhook.ID,
+			DocumentID:        documentID,
+			URL:               webhook.URL,
+			Secret:            secret,
+			SecretHash:        database.SecretHash(webhook.Secret),
+			Events:            webhook.Events,
+			ClientCertificate: clientCertificate,
+			Enabled:           webhook.Enabled,
+			DisabledReason:    webhook.DisabledReason,
+		}); err != nil {
+			return false, err
+		}
+	}
+
+	for _, invite := range document.Invites {
+		if err = s.db.ImportDocumentInvite(ctx, database.DocumentInvite{
+			ID:          invite.ID,
+			DocumentID:  documentID,
+			Permissions: invite.Permissions,
+			MaxUses:     invite.MaxUses,
+			Uses:        invite.Uses,
+			ExpiresAt:   invite.ExpiresAt,
+			CreatedAt:   invite.CreatedAt,
+		}); err != nil {
+			return false, err
+		}
+	}
+	for _, member := range document.Members {
+		if err = s.db.SetDocumentMember(ctx, database.DocumentMember{
+			DocumentID:  documentID,
+			CreatorID:   member.CreatorID,
+			Permissions: member.Permissions,
+			InviteID:    member.InviteID,
+			JoinedAt:    member.JoinedAt,
+		}); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// CompactTombstones deletes the tombstones of deletions before the given time.
+func (s *Server) CompactTombstones(ctx context.Context, before time.Time) error {
+	return s.db.DeleteTombstonesBefore(ctx, before)
+}
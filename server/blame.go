@@ -0,0 +1,142 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/topi314/gobin/v3/internal/diff"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+type (
+	ResponseBlame struct {
+		Name    string       `json:"name"`
+		Version int64        `json:"version"`
+		Ranges  []BlameRange `json:"ranges"`
+	}
+
+	// BlameRange attributes the 1-based lines Start to End (inclusive) to the version which introduced them.
+	BlameRange struct {
+		Start   int   `json:"start"`
+		End     int   `json:"end"`
+		Version int64 `json:"version"`
+	}
+)
+
+// GetDocumentFileBlame walks through all versions of a file up to the requested one and returns which version
+// introduced each line.
+func (s *Server) GetDocumentFileBlame(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+	if i := strings.Index(documentID, "."); i > 0 {
+		documentID = documentID[:i]
+	}
+	fileName := chi.URLParam(r, "fileName")
+
+	var version int64
+	if versionStr := chi.URLParam(r, "version"); versionStr != "" {
+		var err error
+		version, err = strconv.ParseInt(versionStr, 10, 64)
+		if err != nil {
+			s.error(w, r, httperr.BadRequest(ErrInvalidDocumentVersion))
+			return
+		}
+	}
+
+	ctx, span := s.tracer.Start(r.Context(), "blameDocumentFile", trace.WithAttributes(
+		attribute.String("document_id", documentID),
+		attribute.String("file_name", fileName),
+		attribute.Int64("version", version),
+	))
+	defer span.End()
+
+	versions, err := s.db.GetDocumentVersionsWithFiles(ctx, documentID, true)
+	if err != nil {
+		s.error(w, r, fmt.Errorf("failed to get document versions: %w", err))
+		return
+	}
+	if len(versions) == 0 {
+		s.error(w, r, httperr.NotFound(ErrDocumentNotFound))
+		return
+	}
+
+	versionNumbers := make([]int64, 0, len(versions))
+	for v := range versions {
+		if version == 0 || v <= version {
+			versionNumbers = append(versionNumbers, v)
+		}
+	}
+	slices.Sort(versionNumbers)
+	if len(versionNumbers) == 0 || (version != 0 && versionNumbers[len(versionNumbers)-1] != version) {
+		s.error(w, r, httperr.NotFound(ErrDocumentNotFound))
+		return
+	}
+
+	var (
+		lines       []string
+		attribution []int64
+		found       bool
+	)
+	for _, v := range versionNumbers {
+		index := slices.IndexFunc(versions[v], func(file database.File) bool {
+			return file.Name == fileName
+		})
+		if index == -1 {
+			// the file was removed in this version, if it comes back all lines are new
+			lines, attribution, found = nil, nil, false
+			continue
+		}
+		if versions[v][index].Encrypted {
+			s.error(w, r, httperr.BadRequest(ErrFileEncrypted))
+			return
+		}
+
+		newLines := diff.Split(versions[v][index].Content)
+		newAttribution := make([]int64, len(newLines))
+		if !found {
+			for i := range newAttribution {
+				newAttribution[i] = v
+			}
+		} else {
+			for _, edit := range diff.Lines(lines, newLines) {
+				switch edit.Op {
+				case diff.OpEqual:
+					newAttribution[edit.NewLine-1] = attribution[edit.OldLine-1]
+				case diff.OpInsert:
+					newAttribution[edit.NewLine-1] = v
+				}
+			}
+		}
+		lines, attribution, found = newLines, newAttribution, true
+	}
+	if !found {
+		s.error(w, r, httperr.NotFound(ErrDocumentFileNotFound))
+		return
+	}
+
+	ranges := make([]BlameRange, 0)
+	for i, v := range attribution {
+		if len(ranges) > 0 && ranges[len(ranges)-1].Version == v {
+			ranges[len(ranges)-1].End = i + 1
+			continue
+		}
+		ranges = append(ranges, BlameRange{
+			Start:   i + 1,
+			End:     i + 1,
+			Version: v,
+		})
+	}
+
+	s.ok(w, r, ResponseBlame{
+		Name:    fileName,
+		Version: versionNumbers[len(versionNumbers)-1],
+		Ranges:  ranges,
+	})
+}
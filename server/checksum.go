@@ -0,0 +1,64 @@
+package server
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+var (
+	ErrInvalidChecksum  = errors.New("invalid verify, must be sha256:<hex>, sha1:<hex> or md5:<hex>")
+	ErrChecksumMismatch = errors.New("checksum doesn't match the content")
+	ErrVerifyMultiple   = errors.New("verify needs a single file, request the file instead")
+)
+
+// fileChecksum returns the SHA-256 checksum of the file. Files created before checksums were stored get it from their
+// content if it is loaded.
+func fileChecksum(file database.File) string {
+	if file.SHA256 != "" || file.Content == "" {
+		return file.SHA256
+	}
+	return database.Checksum(file.Content)
+}
+
+// checksum returns the hex encoded checksum of the file with the algorithm or an empty string if it is unknown.
+func checksum(algorithm string, file database.File) string {
+	switch algorithm {
+	case "sha256":
+		return fileChecksum(file)
+	case "sha1":
+		sum := sha1.Sum([]byte(file.Content))
+		return hex.EncodeToString(sum[:])
+	case "md5":
+		sum := md5.Sum([]byte(file.Content))
+		return hex.EncodeToString(sum[:])
+	}
+	return ""
+}
+
+// verifyChecksum compares the checksum of the stored content of the file with the verify query parameter, so clients
+// only get content matching a published checksum. Files are not checked without the parameter.
+func verifyChecksum(r *http.Request, file database.File) error {
+	verify := r.URL.Query().Get("verify")
+	if verify == "" {
+		return nil
+	}
+
+	algorithm, expected, ok := strings.Cut(verify, ":")
+	algorithm = strings.ToLower(algorithm)
+	actual := checksum(algorithm, file)
+	if !ok || actual == "" || len(expected) != len(actual) {
+		return httperr.BadRequest(ErrInvalidChecksum)
+	}
+	if !strings.EqualFold(expected, actual) {
+		return httperr.New(fmt.Errorf("%w: %s is %s", ErrChecksumMismatch, algorithm, actual), http.StatusPreconditionFailed)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/topi314/chroma/v2/lexers"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/diff"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+	"github.com/topi314/gobin/v3/server/templates"
+)
+
+var ErrMissingCompareDocuments = errors.New("missing documents to compare, a and b are required")
+
+type (
+	ResponseCompare struct {
+		A     CompareDocument   `json:"a"`
+		B     CompareDocument   `json:"b"`
+		Files []api.CompareFile `json:"files"`
+	}
+
+	CompareDocument struct {
+		Key     string `json:"key"`
+		Version int64  `json:"version"`
+	}
+)
+
+// GetDocumentsCompare returns a side-by-side diff of two documents.
+func (s *Server) GetDocumentsCompare(w http.ResponseWriter, r *http.Request) {
+	rs, err := s.compareDocuments(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, rs)
+}
+
+// GetPrettyCompare renders the side-by-side diff of two documents.
+func (s *Server) GetPrettyCompare(w http.ResponseWriter, r *http.Request) {
+	rs, err := s.compareDocuments(r)
+	if err != nil {
+		s.prettyError(w, r, err)
+		return
+	}
+
+	files := make([]templates.CompareFile, len(rs.Files))
+	for i, file := range rs.Files {
+		files[i] = templates.CompareFile{
+			AName:   file.AName,
+			BName:   file.BName,
+			Added:   file.Added,
+			Removed: file.Removed,
+			Rows:    file.Rows,
+		}
+	}
+
+	setColorSchemeHints(w)
+	style := s.getStyle(r)
+	if err = templates.Compare(templates.CompareVars{
+		A:      compareLabel(rs.A),
+		AURL:   compareURL(rs.A),
+		B:      compareLabel(rs.B),
+		BURL:   compareURL(rs.B),
+		Files:  files,
+		Style:  style.Name,
+		Theme:  style.Theme,
+		Assets: s.assetManifest,
+	}).Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "failed to execute template", slog.Any("err", err))
+	}
+}
+
+func (s *Server) compareDocuments(r *http.Request) (*ResponseCompare, error) {
+	query := r.URL.Query()
+	a := CompareDocument{Key: query.Get("a")}
+	b := CompareDocument{Key: query.Get("b")}
+	if a.Key == "" || b.Key == "" {
+		return nil, httperr.BadRequest(ErrMissingCompareDocuments)
+	}
+	for _, document := range []struct {
+		param   string
+		version *int64
+	}{{"a_version", &a.Version}, {"b_version", &b.Version}} {
+		versionStr := query.Get(document.param)
+		if versionStr == "" {
+			continue
+		}
+		version, err := strconv.ParseInt(versionStr, 10, 64)
+		if err != nil {
+			return nil, httperr.BadRequest(ErrInvalidDocumentVersion)
+		}
+		*document.version = version
+	}
+
+	ctx, span := s.tracer.Start(r.Context(), "compareDocuments", trace.WithAttributes(
+		attribute.String("a", a.Key),
+		attribute.Int64("a_version", a.Version),
+		attribute.String("b", b.Key),
+		attribute.Int64("b_version", b.Version),
+	))
+	defer span.End()
+
+	aFiles, err := s.getCompareDocumentFiles(ctx, a.Key, a.Version)
+	if err != nil {
+		return nil, err
+	}
+	bFiles, err := s.getCompareDocumentFiles(ctx, b.Key, b.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []api.CompareFile
+	for _, pair := range pairFiles(aFiles, bFiles) {
+		files = append(files, compareFiles(pair[0], pair[1]))
+	}
+
+	return &ResponseCompare{
+		A:     a,
+		B:     b,
+		Files: files,
+	}, nil
+}
+
+func (s *Server) getCompareDocumentFiles(ctx context.Context, documentID string, version int64) ([]database.File, error) {
+	files, err := s.getDocumentFiles(ctx, documentID, version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, httperr.NotFound(ErrDocumentNotFound)
+		}
+		return nil, fmt.Errorf("failed to get document: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, httperr.NotFound(ErrDocumentNotFound)
+	}
+	if slices.ContainsFunc(files, isEncrypted) {
+		return nil, httperr.BadRequest(ErrFileEncrypted)
+	}
+	return files, nil
+}
+
+// pairFiles matches the files of both documents by name. Single file documents are always compared with each other.
+// Files which only exist in one document are paired with nil.
+func pairFiles(aFiles []database.File, bFiles []database.File) [][2]*database.File {
+	if len(aFiles) == 1 && len(bFiles) == 1 {
+		return [][2]*database.File{{&aFiles[0], &bFiles[0]}}
+	}
+
+	var pairs [][2]*database.File
+	matched := make([]bool, len(bFiles))
+	for i := range aFiles {
+		index := slices.IndexFunc(bFiles, func(file database.File) bool {
+			return file.Name == aFiles[i].Name
+		})
+		if index == -1 {
+			pairs = append(pairs, [2]*database.File{&aFiles[i], nil})
+			continue
+		}
+		matched[index] = true
+		pairs = append(pairs, [2]*database.File{&aFiles[i], &bFiles[index]})
+	}
+	for i := range bFiles {
+		if !matched[i] {
+			pairs = append(pairs, [2]*database.File{nil, &bFiles[i]})
+		}
+	}
+	return pairs
+}
+
+func compareFiles(a *database.File, b *database.File) api.CompareFile {
+	var (
+		file     api.CompareFile
+		aContent string
+		bContent string
+		language string
+	)
+	if a != nil {
+		file.AName = a.Name
+		aContent = a.Content
+		language = a.Language
+	}
+	if b != nil {
+		file.BName = b.Name
+		bContent = b.Content
+		language = b.Language
+	}
+	if lexer := lexers.Get(language); lexer != nil {
+		file.Language = lexer.Config().Name
+	}
+
+	edits := diff.Lines(diff.Split(aContent), diff.Split(bContent))
+	for _, edit := range edits {
+		switch edit.Op {
+		case diff.OpInsert:
+			file.Added++
+		case diff.OpDelete:
+			file.Removed++
+		}
+	}
+	file.Rows = diff.SideBySide(edits)
+	return file
+}
+
+func compareLabel(document CompareDocument) string {
+	if document.Version == 0 {
+		return document.Key
+	}
+	return fmt.Sprintf("%s (%s)", document.Key, time.UnixMilli(document.Version).Format(VersionTimeFormat))
+}
+
+func compareURL(document CompareDocument) string {
+	if document.Version == 0 {
+		return "/" + document.Key
+	}
+	return fmt.Sprintf("/%s/%d", document.Key, document.Version)
+}
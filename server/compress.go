@@ -0,0 +1,273 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/httperr"
+)
+
+const (
+	EncodingZstd   = "zstd"
+	EncodingBrotli = "br"
+	EncodingGzip   = "gzip"
+)
+
+var ErrUnsupportedContentEncoding = errors.New("unsupported content encoding, must be one of: zstd, gzip")
+
+// encoder is a pooled compressor of a content encoding.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+var encoderPools = map[string]*sync.Pool{
+	EncodingZstd: {New: func() any {
+		// the default window of 8 MB needs as much memory per response, the content of large log pastes is repetitive
+		// enough for a smaller window
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithWindowSize(1<<20), zstd.WithEncoderConcurrency(1))
+		return w
+	}},
+	EncodingBrotli: {New: func() any {
+		return brotli.NewWriterLevel(nil, 4)
+	}},
+	EncodingGzip: {New: func() any {
+		w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return w
+	}},
+}
+
+// compressibleContentTypes are the content types which are compressed, images and archives are compressed already.
+var compressibleContentTypes = []string{
+	ezhttp.ContentTypeJSON,
+	ezhttp.ContentTypeSVG,
+	"application/javascript",
+	"application/xml",
+}
+
+// Compress compresses responses with the preferred encoding of the client which is configured. Responses are only
+// compressed once they are larger than the min size, event streams and responses which are flushed before reaching it
+// are sent uncompressed, so streaming them still works.
+func (s *Server) Compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := negotiateEncoding(r.Header.Get(ezhttp.HeaderAcceptEncoding), s.cfg.Compression.Encodings)
+		w.Header().Add(ezhttp.HeaderVary, ezhttp.HeaderAcceptEncoding)
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+			minSize:        s.cfg.Compression.MinSize,
+		}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// DecodeRequest decodes request bodies compressed with zstd or gzip while they are read, so large documents can be
+// uploaded compressed and streamed without buffering them. Size limits apply to the decoded content.
+func (s *Server) DecodeRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.ReadCloser
+		switch encoding := r.Header.Get(ezhttp.HeaderContentEncoding); encoding {
+		case "", "identity":
+			next.ServeHTTP(w, r)
+			return
+		case EncodingZstd:
+			zr, err := zstd.NewReader(r.Body, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
+			if err != nil {
+				s.error(w, r, httperr.BadRequest(fmt.Errorf("failed to decode request body: %w", err)))
+				return
+			}
+			body = zr.IOReadCloser()
+		case EncodingGzip:
+			gr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				s.error(w, r, httperr.BadRequest(fmt.Errorf("failed to decode request body: %w", err)))
+				return
+			}
+			body = gr
+		default:
+			s.error(w, r, httperr.New(ErrUnsupportedContentEncoding, http.StatusUnsupportedMediaType))
+			return
+		}
+		defer body.Close()
+
+		r.Body = body
+		r.ContentLength = -1
+		r.Header.Del(ezhttp.HeaderContentEncoding)
+		r.Header.Del(ezhttp.HeaderContentLength)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// negotiateEncoding returns the first of the encodings the Accept-Encoding header accepts with the highest quality.
+func negotiateEncoding(acceptEncoding string, encodings []string) string {
+	var (
+		best        string
+		bestQuality float64
+	)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality <= 0 {
+			continue
+		}
+
+		for i, encoding := range encodings {
+			if _, ok := encoderPools[encoding]; !ok || (name != encoding && name != "*") {
+				continue
+			}
+			// prefer the order of the config if the client accepts encodings with the same quality
+			if quality > bestQuality || (quality == bestQuality && i < slices.Index(encodings, best)) {
+				best, bestQuality = encoding, quality
+			}
+			if name != "*" {
+				break
+			}
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the response until it's larger than the min size and decides then whether it's compressed.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status      int
+	wroteHeader bool
+	decided     bool
+	buf         bytes.Buffer
+	encoder     encoder
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.status = status
+	w.wroteHeader = true
+	// informational and bodyless responses are sent as they are
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		w.decide(false)
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		if w.buf.Len()+len(p) < w.minSize {
+			return w.buf.Write(p)
+		}
+		w.decide(w.compressible())
+		if err := w.flushBuffer(); err != nil {
+			return 0, err
+		}
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *compressWriter) compressible() bool {
+	header := w.Header()
+	if header.Get(ezhttp.HeaderContentEncoding) != "" || header.Get(ezhttp.HeaderContentRange) != "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(header.Get(ezhttp.HeaderContentType))
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") && mediaType != ezhttp.ContentTypeEventStream || slices.Contains(compressibleContentTypes, mediaType)
+}
+
+// decide writes the header of the response and starts compressing it.
+func (w *compressWriter) decide(compress bool) {
+	w.decided = true
+	if compress {
+		header := w.Header()
+		header.Set(ezhttp.HeaderContentEncoding, w.encoding)
+		header.Del(ezhttp.HeaderContentLength)
+		// the compressed response is a different representation, weak ETags still match for conditional requests
+		if etag := header.Get(ezhttp.HeaderETag); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set(ezhttp.HeaderETag, "W/"+etag)
+		}
+		w.encoder = encoderPools[w.encoding].Get().(encoder)
+		w.encoder.Reset(w.ResponseWriter)
+	}
+	if w.wroteHeader {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+func (w *compressWriter) flushBuffer() error {
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+	return err
+}
+
+// Flush sends responses which are flushed before reaching the min size uncompressed.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(false)
+		_ = w.flushBuffer()
+	}
+	if w.encoder != nil {
+		_ = w.encoder.Flush()
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *compressWriter) Close() {
+	if !w.decided {
+		w.decide(false)
+		_ = w.flushBuffer()
+	}
+	if w.encoder != nil {
+		_ = w.encoder.Close()
+		w.encoder.Reset(nil)
+		encoderPools[w.encoding].Put(w.encoder)
+		w.encoder = nil
+	}
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
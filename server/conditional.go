@@ -0,0 +1,155 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+var (
+	ErrInvalidIfMatch  = errors.New("invalid If-Match header, must be a document version or *")
+	ErrIfMatchRequired = errors.New("an If-Match header with the version the update is based on is required")
+)
+
+// documentETag returns a strong ETag of a response with the files. Document versions never change, so the checksums of
+// the files identify them, the path, query and parts like the style identify the representation. The server version
+// is included since the highlighting can change with it.
+func (s *Server) documentETag(r *http.Request, files []database.File, parts ...string) string {
+	h := sha256.New()
+	writeETagPart(h, s.version.Version)
+	writeETagPart(h, r.URL.Path)
+	writeETagPart(h, r.URL.RawQuery)
+	for _, file := range files {
+		writeETagPart(h, file.DocumentID)
+		writeETagPart(h, strconv.FormatInt(file.DocumentVersion, 10))
+		writeETagPart(h, file.Name)
+		writeETagPart(h, fileChecksum(file))
+		writeETagPart(h, file.Language)
+		writeETagPart(h, strconv.FormatBool(file.Encrypted))
+		if file.ExpiresAt != nil {
+			writeETagPart(h, file.ExpiresAt.Format(time.RFC3339))
+		}
+	}
+	for _, part := range parts {
+		writeETagPart(h, part)
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// signatureETagPart returns the part of the ETag of a file signature, signatures can be attached to existing versions.
+func signatureETagPart(signature *api.FileSignatureResponse) string {
+	if signature == nil {
+		return ""
+	}
+	return signature.Signature
+}
+
+func writeETagPart(h hash.Hash, part string) {
+	h.Write([]byte(part))
+	h.Write([]byte{0})
+}
+
+// documentModTime returns when the newest version of the files was created, versions are their creation time in
+// milliseconds.
+func documentModTime(files []database.File) time.Time {
+	var version int64
+	for _, file := range files {
+		version = max(version, file.DocumentVersion)
+	}
+	return time.UnixMilli(version)
+}
+
+// checkNotModified sets the ETag and Last-Modified headers and writes a 304 Not Modified response if the client already
+// has the response. If-None-Match takes precedence over If-Modified-Since like RFC 9110 describes. The responses may
+// be cached by the client but have to be revalidated, since the latest version of a document changes.
+func checkNotModified(w http.ResponseWriter, r *http.Request, etag string, modTime time.Time) bool {
+	w.Header().Set(ezhttp.HeaderCacheControl, "private, no-cache")
+	w.Header().Set(ezhttp.HeaderETag, etag)
+	if !modTime.IsZero() {
+		w.Header().Set(ezhttp.HeaderLastModified, modTime.UTC().Format(http.TimeFormat))
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if ifNoneMatch := r.Header.Get(ezhttp.HeaderIfNoneMatch); ifNoneMatch != "" {
+		for _, tag := range strings.Split(ifNoneMatch, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == etag || tag == "*" {
+				w.WriteHeader(http.StatusNotModified)
+				return true
+			}
+		}
+		return false
+	}
+
+	if ifModifiedSince := r.Header.Get(ezhttp.HeaderIfModifiedSince); ifModifiedSince != "" && !modTime.IsZero() {
+		since, err := http.ParseTime(ifModifiedSince)
+		if err == nil && !modTime.Truncate(time.Second).After(since) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// parseIfMatch returns the version of the If-Match header. The version can be quoted like an ETag and * matches any
+// version, ok is false if the header isn't set.
+func parseIfMatch(r *http.Request) (version int64, ok bool, err error) {
+	ifMatch := strings.TrimSpace(r.Header.Get(ezhttp.HeaderIfMatch))
+	if ifMatch == "" {
+		return 0, false, nil
+	}
+	if ifMatch == "*" {
+		return 0, true, nil
+	}
+	ifMatch = strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`)
+	version, err = strconv.ParseInt(ifMatch, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, false, httperr.BadRequest(ErrInvalidIfMatch)
+	}
+	return version, true, nil
+}
+
+// checkIfMatch compares the If-Match header of an update with the latest version of the document, so an update isn't
+// silently saved on top of a version the client hasn't seen. The caller has to hold the update lock of the document
+// until the new version is saved. require_if_match makes the header required.
+func (s *Server) checkIfMatch(r *http.Request, documentID string) error {
+	version, ok, err := parseIfMatch(r)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if s.cfg.RequireIfMatch {
+			return httperr.New(ErrIfMatchRequired, http.StatusPreconditionRequired)
+		}
+		return nil
+	}
+
+	versions, err := s.db.GetDocumentVersions(r.Context(), documentID)
+	if err != nil {
+		return fmt.Errorf("failed to get document versions: %w", err)
+	}
+	if len(versions) == 0 {
+		return httperr.NotFound(ErrDocumentNotFound)
+	}
+	// versions are sorted from newest to oldest
+	if version != 0 && versions[0] != version {
+		return httperr.New(&api.ConflictError{
+			Version:        version,
+			CurrentVersion: versions[0],
+		}, http.StatusConflict)
+	}
+	return nil
+}
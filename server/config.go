@@ -9,8 +9,12 @@ import (
 
 	"github.com/pelletier/go-toml/v2"
 
+	"github.com/topi314/gobin/v3/internal/gist"
 	"github.com/topi314/gobin/v3/internal/timex"
 	"github.com/topi314/gobin/v3/server/database"
+	"github.com/topi314/gobin/v3/server/featureflags"
+	"github.com/topi314/gobin/v3/server/storage"
+	"github.com/topi314/gobin/v3/server/summary"
 )
 
 func LoadConfig(cfgPath string) (Config, error) {
@@ -32,27 +36,65 @@ func LoadConfig(cfgPath string) (Config, error) {
 
 func defaultConfig() Config {
 	return Config{
-		Debug:            false,
-		DevMode:          false,
-		ListenAddr:       ":80",
-		HTTPTimeout:      timex.Duration(30 * time.Second),
-		JWTSecret:        "",
-		MaxDocumentSize:  0,
-		MaxHighlightSize: 0,
-		CustomStyles:     "",
-		DefaultStyle:     "onedark",
+		Debug:             false,
+		DevMode:           false,
+		ListenAddr:        ":80",
+		HTTPTimeout:       timex.Duration(30 * time.Second),
+		JWTSecret:         "",
+		MaxDocumentSize:   0,
+		MaxFileSize:       0,
+		MaxFiles:          0,
+		MaxHighlightSize:  0,
+		CustomStyles:      "",
+		DefaultStyle:      "onedark",
+		DefaultLightStyle: "github",
+		JWT: JWTConfig{
+			Algorithm: JWTAlgorithmHS512,
+		},
 		Database: database.Config{
-			Type:            database.TypeSQLite,
-			Debug:           false,
-			ExpireAfter:     0,
-			CleanupInterval: timex.Duration(time.Minute),
-			Path:            "gobin.db",
-			Host:            "localhost",
-			Port:            5432,
-			Username:        "gobin",
-			Password:        "",
-			Database:        "gobin",
-			SSLMode:         "disable",
+			Type:                  database.TypeSQLite,
+			Debug:                 false,
+			ExpireAfter:           0,
+			CleanupInterval:       timex.Duration(time.Minute),
+			KeyStrategy:           database.KeyStrategyRandom,
+			KeyLength:             0,
+			DeltaSnapshotInterval: 10,
+			Path:                  "gobin.db",
+			Host:                  "localhost",
+			Port:                  5432,
+			Username:              "gobin",
+			Password:              "",
+			Database:              "gobin",
+			SSLMode:               "disable",
+		},
+		Storage: storage.Config{
+			Type: storage.TypeDatabase,
+			S3: storage.S3Config{
+				Region:  "us-east-1",
+				Timeout: timex.Duration(30 * time.Second),
+			},
+		},
+		Shadow: ShadowConfig{
+			Enabled:     false,
+			CompareRate: 1,
+			Database: database.Config{
+				Type:                  database.TypeSQLite,
+				CleanupInterval:       timex.Duration(time.Minute),
+				DeltaSnapshotInterval: 10,
+				Path:                  "gobin-shadow.db",
+				Host:                  "localhost",
+				Port:                  5432,
+				Username:              "gobin",
+				Database:              "gobin",
+				SSLMode:               "disable",
+			},
+			Storage: storage.Config{
+				Type: storage.TypeDatabase,
+				S3: storage.S3Config{
+					Region:  "us-east-1",
+					Timeout: timex.Duration(30 * time.Second),
+				},
+			},
 		},
 		Log: LogConfig{
 			Level:     slog.LevelInfo,
@@ -60,12 +102,45 @@ func defaultConfig() Config {
 			AddSource: false,
 			NoColor:   false,
 		},
+		Assets: AssetsConfig{
+			Dir: "",
+		},
 		RateLimit: RateLimitConfig{
+			Enabled:           false,
+			Requests:          10,
+			Duration:          timex.Duration(time.Minute),
+			Whitelist:         []string{"127.0.0.1"},
+			Blacklist:         nil,
+			ReadTokenRequests: 60,
+			ReadTokenDuration: timex.Duration(time.Minute),
+			Store:             RateLimitStoreMemory,
+			Redis: RateLimitRedisConfig{
+				Address: "localhost:6379",
+			},
+			Create: RateLimitPolicy{
+				Requests: 10,
+				Duration: timex.Duration(time.Minute),
+			},
+			Update: RateLimitPolicy{
+				Requests: 30,
+				Duration: timex.Duration(time.Minute),
+			},
+			Raw: RateLimitPolicy{
+				Requests: 0,
+				Duration: timex.Duration(time.Minute),
+			},
+			Webhooks: RateLimitPolicy{
+				Requests: 10,
+				Duration: timex.Duration(time.Minute),
+			},
+		},
+		UserAgents: UserAgentsConfig{
 			Enabled:   false,
-			Requests:  10,
-			Duration:  timex.Duration(time.Minute),
-			Whitelist: []string{"127.0.0.1"},
-			Blacklist: nil,
+			CLI:       []string{"curl/", "wget/", "httpie/", "xh/", "powershell/"},
+			Bots:      []string{"bot", "crawl", "spider", "slurp", "facebookexternalhit", "headlesschrome"},
+			Allow:     nil,
+			Deny:      nil,
+			RawForCLI: true,
 		},
 		Preview: PreviewConfig{
 			Enabled:      false,
@@ -75,6 +150,15 @@ func defaultConfig() Config {
 			CacheSize:    1024,
 			CacheTTL:     timex.Duration(time.Hour),
 		},
+		Embed: EmbedConfig{
+			Enabled:        false,
+			FrameAncestors: nil,
+		},
+		OpenAPI: OpenAPIConfig{
+			Enabled:      true,
+			SwaggerUI:    false,
+			SwaggerUIURL: "https://unpkg.com/swagger-ui-dist@5",
+		},
 		Otel: OtelConfig{
 			Enabled:    false,
 			InstanceID: "1",
@@ -89,50 +173,302 @@ func defaultConfig() Config {
 			},
 		},
 		Webhook: WebhookConfig{
+			Timeout:           timex.Duration(10 * time.Second),
+			MaxTries:          3,
+			Backoff:           timex.Duration(time.Second),
+			BackoffFactor:     2,
+			MaxBackoff:        timex.Duration(5 * time.Minute),
+			MaxRetryAfter:     timex.Duration(time.Hour),
+			DeliveryRetention: timex.Duration(7 * 24 * time.Hour),
+			ContentURLExpiry:  timex.Duration(24 * time.Hour),
+		},
+		Encryption: EncryptionConfig{
+			KMS: KMSConfig{
+				Mount:   "transit",
+				KeyName: "gobin",
+				Timeout: timex.Duration(10 * time.Second),
+			},
+		},
+		Compression: CompressionConfig{
+			Enabled:   true,
+			MinSize:   1024,
+			Encodings: []string{EncodingZstd, EncodingBrotli, EncodingGzip},
+		},
+		Vault: VaultConfig{
+			Enabled:       false,
 			Timeout:       timex.Duration(10 * time.Second),
-			MaxTries:      3,
-			Backoff:       timex.Duration(time.Second),
-			BackoffFactor: 2,
-			MaxBackoff:    timex.Duration(5 * time.Minute),
+			SecretMount:   "secret",
+			DatabaseMount: "database",
+		},
+		FromURL: FromURLConfig{
+			Enabled:              false,
+			Timeout:              timex.Duration(10 * time.Second),
+			MaxSize:              0,
+			AllowPrivateNetworks: false,
+		},
+		Gist: GistConfig{
+			Enabled: false,
+			APIURL:  gist.DefaultAPIURL,
+			Token:   "",
+			Timeout: timex.Duration(10 * time.Second),
+		},
+		Federation: FederationConfig{
+			Enabled:   false,
+			Hosts:     nil,
+			Insecure:  false,
+			Timeout:   timex.Duration(10 * time.Second),
+			MaxSize:   10 * 1024 * 1024,
+			CacheSize: 1024,
+			CacheTTL:  timex.Duration(5 * time.Minute),
+		},
+		ActivityPub: ActivityPubConfig{
+			Enabled:             false,
+			BaseURL:             "",
+			Username:            "gobin",
+			Name:                "gobin",
+			Summary:             "",
+			PrivateKeyPath:      "activitypub.pem",
+			PreviewLines:        10,
+			ContentWarningLines: 50,
+			ContentWarningCode:  true,
+			Timeout:             timex.Duration(10 * time.Second),
+		},
+		Sync: SyncConfig{
+			Enabled:    false,
+			Source:     "",
+			Token:      "",
+			Interval:   timex.Duration(5 * time.Minute),
+			Timeout:    timex.Duration(30 * time.Second),
+			Documents:  nil,
+			Tags:       nil,
+			Collection: false,
+		},
+		Events: EventsConfig{
+			Enabled:   true,
+			Retention: timex.Duration(30 * 24 * time.Hour),
+		},
+		Tombstones: TombstonesConfig{
+			Retention: 0,
+		},
+		Retention: RetentionConfig{
+			MaxVersions: 0,
+			MaxAge:      0,
+			MaxStorage:  0,
+		},
+		Search: SearchConfig{
+			Enabled: false,
+		},
+		DeviceAuth: DeviceAuthConfig{
+			Enabled:  false,
+			Expiry:   timex.Duration(10 * time.Minute),
+			Interval: timex.Duration(5 * time.Second),
+		},
+		Recent: RecentConfig{
+			Enabled: false,
+			Limit:   20,
+		},
+		CustomKeys: CustomKeysConfig{
+			Enabled:     false,
+			RequireUser: false,
+			MinLength:   3,
+			MaxLength:   64,
+		},
+		Accounts: AccountsConfig{
+			Enabled:          false,
+			Issuer:           "",
+			ClientID:         "",
+			ClientSecret:     "",
+			RedirectURL:      "",
+			Scopes:           []string{"openid", "profile", "email"},
+			SessionTTL:       timex.Duration(30 * 24 * time.Hour),
+			RequireTwoFactor: false,
+		},
+		Ingest: IngestConfig{
+			Enabled: false,
+			Secret:  "",
+			S3: storage.S3Config{
+				Region:  "us-east-1",
+				Timeout: timex.Duration(30 * time.Second),
+			},
+			PollInterval: 0,
+			Expiry:       0,
+			MaxSize:      0,
+		},
+		Syslog: SyslogConfig{
+			Enabled:      false,
+			UDPAddr:      ":5514",
+			TCPAddr:      "",
+			RollInterval: timex.Duration(5 * time.Minute),
+			RollSize:     64 * 1024,
+			Expiry:       0,
+			MaxSources:   100,
+		},
+		Summary: summary.Config{
+			Enabled:      false,
+			Type:         summary.TypeOpenAI,
+			URL:          "https://api.openai.com/v1",
+			APIKey:       "",
+			Model:        "gpt-4o-mini",
+			Prompt:       "",
+			MaxTokens:    256,
+			MaxInputSize: 16000,
+			Timeout:      timex.Duration(time.Minute),
+		},
+		FeatureFlags: featureflags.Config{
+			Provider: featureflags.TypeConfig,
+			Timeout:  timex.Duration(time.Second),
+			CacheTTL: timex.Duration(30 * time.Second),
+		},
+		Plugins: PluginsConfig{
+			Enabled:       false,
+			Timeout:       timex.Duration(5 * time.Second),
+			MaxMemory:     64,
+			MaxOutputSize: 10 * 1024 * 1024,
+			Renderers:     nil,
 		},
 	}
 }
 
 type Config struct {
-	Debug            bool            `toml:"debug"`
-	DevMode          bool            `toml:"dev_mode"`
-	ListenAddr       string          `toml:"listen_addr"`
-	HTTPTimeout      timex.Duration  `toml:"http_timeout"`
-	JWTSecret        string          `toml:"jwt_secret"`
-	MaxDocumentSize  int64           `toml:"max_document_size"`
-	MaxHighlightSize int             `toml:"max_highlight_size"`
-	CustomStyles     string          `toml:"custom_styles"`
-	DefaultStyle     string          `toml:"default_style"`
-	Log              LogConfig       `toml:"log"`
-	Database         database.Config `toml:"database"`
-	RateLimit        RateLimitConfig `toml:"rate_limit"`
-	Preview          PreviewConfig   `toml:"preview"`
-	Otel             OtelConfig      `toml:"otel"`
-	Webhook          WebhookConfig   `toml:"webhook"`
+	Debug             bool                `toml:"debug"`
+	DevMode           bool                `toml:"dev_mode"`
+	ListenAddr        string              `toml:"listen_addr"`
+	HTTPTimeout       timex.Duration      `toml:"http_timeout"`
+	JWTSecret         string              `toml:"jwt_secret"`
+	JWT               JWTConfig           `toml:"jwt"`
+	MaxDocumentSize   int64               `toml:"max_document_size"`
+	MaxFileSize       int64               `toml:"max_file_size"`
+	MaxFiles          int                 `toml:"max_files"`
+	MaxHighlightSize  int                 `toml:"max_highlight_size"`
+	RequireIfMatch    bool                `toml:"require_if_match"`
+	CustomStyles      string              `toml:"custom_styles"`
+	DefaultStyle      string              `toml:"default_style"`
+	DefaultLightStyle string              `toml:"default_light_style"`
+	Log               LogConfig           `toml:"log"`
+	Assets            AssetsConfig        `toml:"assets"`
+	Database          database.Config     `toml:"database"`
+	Storage           storage.Config      `toml:"storage"`
+	Shadow            ShadowConfig        `toml:"shadow"`
+	RateLimit         RateLimitConfig     `toml:"rate_limit"`
+	UserAgents        UserAgentsConfig    `toml:"user_agents"`
+	Preview           PreviewConfig       `toml:"preview"`
+	Embed             EmbedConfig         `toml:"embed"`
+	OpenAPI           OpenAPIConfig       `toml:"openapi"`
+	Compression       CompressionConfig   `toml:"compression"`
+	Otel              OtelConfig          `toml:"otel"`
+	Webhook           WebhookConfig       `toml:"webhook"`
+	Encryption        EncryptionConfig    `toml:"encryption"`
+	Vault             VaultConfig         `toml:"vault"`
+	FromURL           FromURLConfig       `toml:"from_url"`
+	Gist              GistConfig          `toml:"gist"`
+	Federation        FederationConfig    `toml:"federation"`
+	ActivityPub       ActivityPubConfig   `toml:"activitypub"`
+	Sync              SyncConfig          `toml:"sync"`
+	Events            EventsConfig        `toml:"events"`
+	Tombstones        TombstonesConfig    `toml:"tombstones"`
+	Retention         RetentionConfig     `toml:"retention"`
+	Search            SearchConfig        `toml:"search"`
+	DeviceAuth        DeviceAuthConfig    `toml:"device_auth"`
+	Recent            RecentConfig        `toml:"recent"`
+	CustomKeys        CustomKeysConfig    `toml:"custom_keys"`
+	Accounts          AccountsConfig      `toml:"accounts"`
+	Ingest            IngestConfig        `toml:"ingest"`
+	Syslog            SyslogConfig        `toml:"syslog"`
+	Summary           summary.Config      `toml:"summary"`
+	FeatureFlags      featureflags.Config `toml:"feature_flags"`
+	Plugins           PluginsConfig       `toml:"plugins"`
+	Hooks             []HookConfig        `toml:"hooks"`
 }
 
 func (c Config) String() string {
-	return fmt.Sprintf("Debug: %t\nDevMode: %t\nListenAddr: %s\nHTTPTimeout: %s\nJWTSecret: %s\nMaxDocumentSize: %d\nMaxHighlightSize: %d\nCustomStyles: %s\nDefaultStyle: %s\nLog: %s\nDatabase: %s\nRateLimit: %s\nPreview: %s\nOtel: %s\nWebhook: %s",
+	return fmt.Sprintf("Debug: %t\nDevMode: %t\nListenAddr: %s\nHTTPTimeout: %s\nJWTSecret: %s\nJWT: %s\nMaxDocumentSize: %d\nMaxFileSize: %d\nMaxFiles: %d\nMaxHighlightSize: %d\nRequireIfMatch: %t\nCustomStyles: %s\nDefaultStyle: %s\nDefaultLightStyle: %s\nLog: %s\nAssets: %s\nDatabase: %s\nStorage: %s\nShadow: %s\nRateLimit: %s\nUserAgents: %s\nPreview: %s\nEmbed: %s\nOpenAPI: %s\nCompression: %s\nOtel: %s\nWebhook: %s\nEncryption: %s\nVault: %s\nFromURL: %s\nGist: %s\nFederation: %s\nActivityPub: %s\nSync: %s\nEvents: %s\nTombstones: %s\nRetention: %s\nSearch: %s\nDeviceAuth: %s\nRecent: %s\nCustomKeys: %s\nAccounts: %s\nIngest: %s\nSyslog: %s\nSummary: %s\nFeatureFlags: %s\nPlugins: %s\nHooks: %v",
 		c.Debug,
 		c.DevMode,
 		c.ListenAddr,
 		time.Duration(c.HTTPTimeout),
 		strings.Repeat("*", len(c.JWTSecret)),
+		c.JWT,
 		c.MaxDocumentSize,
+		c.MaxFileSize,
+		c.MaxFiles,
 		c.MaxHighlightSize,
+		c.RequireIfMatch,
 		c.CustomStyles,
 		c.DefaultStyle,
+		c.DefaultLightStyle,
 		c.Log,
+		c.Assets,
 		c.Database,
+		c.Storage,
+		c.Shadow,
 		c.RateLimit,
+		c.UserAgents,
 		c.Preview,
+		c.Embed,
+		c.OpenAPI,
+		c.Compression,
 		c.Otel,
 		c.Webhook,
+		c.Encryption,
+		c.Vault,
+		c.FromURL,
+		c.Gist,
+		c.Federation,
+		c.ActivityPub,
+		c.Sync,
+		c.Events,
+		c.Tombstones,
+		c.Retention,
+		c.Search,
+		c.DeviceAuth,
+		c.Recent,
+		c.CustomKeys,
+		c.Accounts,
+		c.Ingest,
+		c.Syslog,
+		c.Summary,
+		c.FeatureFlags,
+		c.Plugins,
+		c.Hooks,
+	)
+}
+
+// JWTConfig configures the keys tokens are signed with. HS512 signs them with the jwt_secret, RS256 and EdDSA with the
+// private key of KeyFile.
+type JWTConfig struct {
+	Algorithm string `toml:"algorithm"`
+	// KeyFile is a PEM file with the private key of RS256 and EdDSA.
+	KeyFile string `toml:"key_file"`
+	// VerificationKeys only verify tokens, like the previous key after a rotation or the next key before it signs tokens.
+	VerificationKeys []JWTVerificationKeyConfig `toml:"verification_keys"`
+}
+
+func (c JWTConfig) String() string {
+	return fmt.Sprintf("\n Algorithm: %s\n KeyFile: %s\n VerificationKeys: %v",
+		c.Algorithm,
+		c.KeyFile,
+		c.VerificationKeys,
+	)
+}
+
+type JWTVerificationKeyConfig struct {
+	// Algorithm defaults to the algorithm of the signing key.
+	Algorithm string `toml:"algorithm"`
+	// Secret is the secret of HS512 keys, it defaults to the jwt_secret.
+	Secret string `toml:"secret"`
+	// KeyFile is a PEM file with the private or public key of RS256 and EdDSA keys.
+	KeyFile string `toml:"key_file"`
+	// ExpiresAt ends the grace period of the key, tokens signed with it are rejected afterward. Keys without it are
+	// kept.
+	ExpiresAt *time.Time `toml:"expires_at"`
+}
+
+func (c JWTVerificationKeyConfig) String() string {
+	return fmt.Sprintf("\n  Algorithm: %s\n  Secret: %s\n  KeyFile: %s\n  ExpiresAt: %v",
+		c.Algorithm,
+		strings.Repeat("*", len(c.Secret)),
+		c.KeyFile,
+		c.ExpiresAt,
 	)
 }
 
@@ -159,21 +495,104 @@ func (c LogConfig) String() string {
 	)
 }
 
+const (
+	RateLimitStoreMemory = "memory"
+	RateLimitStoreRedis  = "redis"
+)
+
 type RateLimitConfig struct {
 	Enabled   bool           `toml:"enabled"`
 	Requests  int            `toml:"requests"`
 	Duration  timex.Duration `toml:"duration"`
 	Whitelist []string       `toml:"whitelist"`
 	Blacklist []string       `toml:"blacklist"`
+
+	ReadTokenRequests int            `toml:"read_token_requests"`
+	ReadTokenDuration timex.Duration `toml:"read_token_duration"`
+
+	// Store is memory or redis, the redis store shares the limits between replicas.
+	Store string               `toml:"store"`
+	Redis RateLimitRedisConfig `toml:"redis"`
+
+	Create   RateLimitPolicy `toml:"create"`
+	Update   RateLimitPolicy `toml:"update"`
+	Raw      RateLimitPolicy `toml:"raw"`
+	Webhooks RateLimitPolicy `toml:"webhooks"`
 }
 
 func (c RateLimitConfig) String() string {
-	return fmt.Sprintf("\n Enabled: %t\n Requests: %d\n Duration: %s\n Whitelist: %v\n Blacklist: %v",
+	return fmt.Sprintf("\n Enabled: %t\n Requests: %d\n Duration: %s\n Whitelist: %v\n Blacklist: %v\n ReadTokenRequests: %d\n ReadTokenDuration: %s\n Store: %s\n Redis: %s\n Create: %s\n Update: %s\n Raw: %s\n Webhooks: %s",
 		c.Enabled,
 		c.Requests,
 		time.Duration(c.Duration),
 		c.Whitelist,
 		c.Blacklist,
+		c.ReadTokenRequests,
+		time.Duration(c.ReadTokenDuration),
+		c.Store,
+		c.Redis,
+		c.Create,
+		c.Update,
+		c.Raw,
+		c.Webhooks,
+	)
+}
+
+type RateLimitRedisConfig struct {
+	Address  string `toml:"address"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	DB       int    `toml:"db"`
+}
+
+func (c RateLimitRedisConfig) String() string {
+	return fmt.Sprintf("\n  Address: %s\n  Username: %s\n  Password: %s\n  DB: %d",
+		c.Address,
+		c.Username,
+		strings.Repeat("*", len(c.Password)),
+		c.DB,
+	)
+}
+
+// RateLimitPolicy limits a group of routes per IP, or per token for requests with a token. Policies without requests
+// use the default requests and duration of the rate limit, except raw fetches which are not limited then.
+type RateLimitPolicy struct {
+	Requests int            `toml:"requests"`
+	Duration timex.Duration `toml:"duration"`
+}
+
+func (c RateLimitPolicy) String() string {
+	return fmt.Sprintf("%d/%s", c.Requests, time.Duration(c.Duration))
+}
+
+// UserAgentsConfig classifies requests by their User-Agent header as cli, bot, browser or other. Patterns match if the
+// user agent contains them, ignoring the case.
+type UserAgentsConfig struct {
+	Enabled bool     `toml:"enabled"`
+	CLI     []string `toml:"cli"`
+	Bots    []string `toml:"bots"`
+	// Allow overrides Deny, allowed user agents are not limited by the rate limit of their class either.
+	Allow []string `toml:"allow"`
+	Deny  []string `toml:"deny"`
+	// RawForCLI serves the plain content to cli clients which open the url of a document, it works without Enabled.
+	RawForCLI bool `toml:"raw_for_cli"`
+
+	CLIRateLimit     RateLimitPolicy `toml:"cli_rate_limit"`
+	BotRateLimit     RateLimitPolicy `toml:"bot_rate_limit"`
+	BrowserRateLimit RateLimitPolicy `toml:"browser_rate_limit"`
+}
+
+func (c UserAgentsConfig) String() string {
+	return fmt.Sprintf("\n Enabled: %t\n CLI: %v\n Bots: %v\n Allow: %v\n Deny: %v\n RawForCLI: %t\n CLIRateLimit: %s\n BotRateLimit: %s\n BrowserRateLimit: %s",
+		c.Enabled,
+		c.CLI,
+		c.Bots,
+		c.Allow,
+		c.Deny,
+		c.RawForCLI,
+		c.CLIRateLimit,
+		c.BotRateLimit,
+		c.BrowserRateLimit,
 	)
 }
 
@@ -197,6 +616,54 @@ func (c PreviewConfig) String() string {
 	)
 }
 
+// EmbedConfig enables the pages embed.js shows in iframes on other sites. FrameAncestors restricts the sites which can
+// embed documents, all sites can embed them if it's empty.
+type EmbedConfig struct {
+	Enabled        bool     `toml:"enabled"`
+	FrameAncestors []string `toml:"frame_ancestors"`
+}
+
+func (c EmbedConfig) String() string {
+	return fmt.Sprintf("\n Enabled: %t\n FrameAncestors: %v",
+		c.Enabled,
+		c.FrameAncestors,
+	)
+}
+
+// OpenAPIConfig serves the OpenAPI document of the API at /openapi.json. SwaggerUI shows it at /openapi with Swagger UI
+// loaded from SwaggerUIURL.
+type OpenAPIConfig struct {
+	Enabled      bool   `toml:"enabled"`
+	SwaggerUI    bool   `toml:"swagger_ui"`
+	SwaggerUIURL string `toml:"swagger_ui_url"`
+}
+
+func (c OpenAPIConfig) String() string {
+	return fmt.Sprintf("\n Enabled: %t\n SwaggerUI: %t\n SwaggerUIURL: %s",
+		c.Enabled,
+		c.SwaggerUI,
+		c.SwaggerUIURL,
+	)
+}
+
+// CompressionConfig is the compression of document and raw responses, the encoding is negotiated with the
+// Accept-Encoding header.
+type CompressionConfig struct {
+	Enabled bool `toml:"enabled"`
+	// MinSize is the size in bytes a response needs to have to be compressed.
+	MinSize int `toml:"min_size"`
+	// Encodings are the encodings in the order they are preferred, any of zstd, br and gzip.
+	Encodings []string `toml:"encodings"`
+}
+
+func (c CompressionConfig) String() string {
+	return fmt.Sprintf("\n Enabled: %t\n MinSize: %d\n Encodings: %v",
+		c.Enabled,
+		c.MinSize,
+		c.Encodings,
+	)
+}
+
 type OtelConfig struct {
 	Enabled    bool          `toml:"enabled"`
 	InstanceID string        `toml:"instance_id"`
@@ -240,21 +707,581 @@ func (c MetricsConfig) String() string {
 }
 
 type WebhookConfig struct {
-	Enabled       bool           `toml:"enabled"`
-	Timeout       timex.Duration `toml:"timeout"`
-	MaxTries      int            `toml:"max_tries"`
-	Backoff       timex.Duration `toml:"backoff"`
-	BackoffFactor float64        `toml:"backoff_factor"`
-	MaxBackoff    timex.Duration `toml:"max_backoff"`
+	Enabled           bool           `toml:"enabled"`
+	Timeout           timex.Duration `toml:"timeout"`
+	MaxTries          int            `toml:"max_tries"`
+	Backoff           timex.Duration `toml:"backoff"`
+	BackoffFactor     float64        `toml:"backoff_factor"`
+	MaxBackoff        timex.Duration `toml:"max_backoff"`
+	MaxRetryAfter     timex.Duration `toml:"max_retry_after"`
+	DeliveryRetention timex.Duration `toml:"delivery_retention"`
+	// MaxPayloadSize is the max size of a document in bytes before it is sent without its content and with signed urls
+	// to the contents instead, 0 means no limit.
+	MaxPayloadSize int64 `toml:"max_payload_size"`
+	// BaseURL is the public url of gobin like https://xgob.in the content urls point to.
+	BaseURL string `toml:"base_url"`
+	// ContentURLExpiry is how long the content urls stay valid.
+	ContentURLExpiry timex.Duration `toml:"content_url_expiry"`
+	// ContentURLSecret signs the content urls, the JWT secret is used if it is empty.
+	ContentURLSecret   string                           `toml:"content_url_secret"`
+	Global             []GlobalWebhookConfig            `toml:"global"`
+	ClientCertificates []WebhookClientCertificateConfig `toml:"client_certificates"`
 }
 
 func (c WebhookConfig) String() string {
-	return fmt.Sprintf("\n Enabled: %t\n Timeout: %s\n MaxTries: %d\n Backoff: %s\n BackoffFactor: %f\n MaxBackoff: %s",
+	return fmt.Sprintf("\n Enabled: %t\n Timeout: %s\n MaxTries: %d\n Backoff: %s\n BackoffFactor: %f\n MaxBackoff: %s\n MaxRetryAfter: %s\n DeliveryRetention: %s\n MaxPayloadSize: %d\n BaseURL: %s\n ContentURLExpiry: %s\n ContentURLSecret: %s\n Global: %v\n ClientCertificates: %v",
 		c.Enabled,
 		time.Duration(c.Timeout),
 		c.MaxTries,
 		time.Duration(c.Backoff),
 		c.BackoffFactor,
 		time.Duration(c.MaxBackoff),
+		time.Duration(c.MaxRetryAfter),
+		time.Duration(c.DeliveryRetention),
+		c.MaxPayloadSize,
+		c.BaseURL,
+		time.Duration(c.ContentURLExpiry),
+		strings.Repeat("*", len(c.ContentURLSecret)),
+		c.Global,
+		c.ClientCertificates,
+	)
+}
+
+// WebhookClientCertificateConfig is the client certificate used for mutual TLS with the webhooks of a host. Client
+// certificates of webhooks take precedence, the CA file is used for them too.
+type WebhookClientCertificateConfig struct {
+	// Host is the host of the webhook url with or without port.
+	Host     string `toml:"host"`
+	CertFile string `toml:"cert_file"`
+	KeyFile  string `toml:"key_file"`
+	// CAFile is a PEM file of CAs to verify the certificate of the host instead of the system CAs.
+	CAFile string `toml:"ca_file"`
+}
+
+func (c WebhookClientCertificateConfig) String() string {
+	return fmt.Sprintf("{Host: %s, CertFile: %s, KeyFile: %s, CAFile: %s}",
+		c.Host,
+		c.CertFile,
+		c.KeyFile,
+		c.CAFile,
+	)
+}
+
+type GlobalWebhookConfig struct {
+	URL    string   `toml:"url"`
+	Secret string   `toml:"secret"`
+	Events []string `toml:"events"`
+}
+
+func (c GlobalWebhookConfig) String() string {
+	return fmt.Sprintf("{URL: %s, Secret: %s, Events: %v}",
+		c.URL,
+		strings.Repeat("*", len(c.Secret)),
+		c.Events,
+	)
+}
+
+const KMSTypeVault = "vault"
+
+// ShadowConfig is a second database and storage which get the document files written to the primary ones too. The
+// files read from the primary database are compared with the shadow ones, so a migration to them can be verified.
+type ShadowConfig struct {
+	Enabled bool `toml:"enabled"`
+	// CompareRate is the share of the reads between 0 and 1 which are compared with the shadow database.
+	CompareRate float64         `toml:"compare_rate"`
+	Database    database.Config `toml:"database"`
+	Storage     storage.Config  `toml:"storage"`
+}
+
+func (c ShadowConfig) String() string {
+	return fmt.Sprintf("\n Enabled: %t\n CompareRate: %g\n Database: %s\n Storage: %s",
+		c.Enabled,
+		c.CompareRate,
+		c.Database,
+		c.Storage,
+	)
+}
+
+// EncryptionConfig is the key encryption key of the secrets stored in the database. Every secret is encrypted with its
+// own data key, which is encrypted with the key or the key of the KMS.
+type EncryptionConfig struct {
+	// Key is used if no KMS and key file is configured, the JWT secret is used if it is empty.
+	Key string `toml:"key"`
+	// KeyFile is a file containing the key, it is used instead of Key if set.
+	KeyFile string    `toml:"key_file"`
+	KMS     KMSConfig `toml:"kms"`
+	// Content encrypts the contents of document files in the database too.
+	Content bool `toml:"content"`
+}
+
+func (c EncryptionConfig) String() string {
+	return fmt.Sprintf("\n Key: %s\n KeyFile: %s\n KMS: %s\n Content: %t",
+		strings.Repeat("*", len(c.Key)),
+		c.KeyFile,
+		c.KMS,
+		c.Content,
+	)
+}
+
+// KMSConfig is a key of the transit secrets engine of HashiCorp Vault or OpenBao.
+type KMSConfig struct {
+	// Type is empty to use the key of the config or vault.
+	Type      string         `toml:"type"`
+	Address   string         `toml:"address"`
+	Token     string         `toml:"token"`
+	Namespace string         `toml:"namespace"`
+	Mount     string         `toml:"mount"`
+	KeyName   string         `toml:"key_name"`
+	Timeout   timex.Duration `toml:"timeout"`
+}
+
+func (c KMSConfig) String() string {
+	return fmt.Sprintf("\n  Type: %s\n  Address: %s\n  Token: %s\n  Namespace: %s\n  Mount: %s\n  KeyName: %s\n  Timeout: %s",
+		c.Type,
+		c.Address,
+		strings.Repeat("*", len(c.Token)),
+		c.Namespace,
+		c.Mount,
+		c.KeyName,
+		time.Duration(c.Timeout),
+	)
+}
+
+// VaultConfig is the HashiCorp Vault or OpenBao server gobin reads its secrets and database credentials from at
+// startup. It logs in with the token or the AppRole and keeps the token and the database credentials renewed.
+type VaultConfig struct {
+	Enabled   bool   `toml:"enabled"`
+	Address   string `toml:"address"`
+	Namespace string `toml:"namespace"`
+	// Token or TokenFile is used if set, otherwise gobin logs in with the AppRole.
+	Token        string         `toml:"token"`
+	TokenFile    string         `toml:"token_file"`
+	RoleID       string         `toml:"role_id"`
+	SecretIDFile string         `toml:"secret_id_file"`
+	Timeout      timex.Duration `toml:"timeout"`
+	// SecretMount and SecretPath are the KV v2 secret containing the jwt_secret and encryption_key, the secret is not
+	// read if SecretPath is empty.
+	SecretMount string `toml:"secret_mount"`
+	SecretPath  string `toml:"secret_path"`
+	// DatabaseMount and DatabaseRole are the role of the database secrets engine the PostgreSQL credentials are created
+	// with, the credentials of the config are used if DatabaseRole is empty.
+	DatabaseMount string `toml:"database_mount"`
+	DatabaseRole  string `toml:"database_role"`
+}
+
+func (c VaultConfig) String() string {
+	return fmt.Sprintf("\n Enabled: %t\n Address: %s\n Namespace: %s\n Token: %s\n TokenFile: %s\n RoleID: %s\n SecretIDFile: %s\n Timeout: %s\n SecretMount: %s\n SecretPath: %s\n DatabaseMount: %s\n DatabaseRole: %s",
+		c.Enabled,
+		c.Address,
+		c.Namespace,
+		strings.Repeat("*", len(c.Token)),
+		c.TokenFile,
+		c.RoleID,
+		c.SecretIDFile,
+		time.Duration(c.Timeout),
+		c.SecretMount,
+		c.SecretPath,
+		c.DatabaseMount,
+		c.DatabaseRole,
+	)
+}
+
+type FromURLConfig struct {
+	Enabled              bool           `toml:"enabled"`
+	Timeout              timex.Duration `toml:"timeout"`
+	MaxSize              int64          `toml:"max_size"`
+	AllowPrivateNetworks bool           `toml:"allow_private_networks"`
+}
+
+func (c FromURLConfig) String() string {
+	return fmt.Sprintf("\n Enabled: %t\n Timeout: %s\n MaxSize: %d\n AllowPrivateNetworks: %t",
+		c.Enabled,
+		time.Duration(c.Timeout),
+		c.MaxSize,
+		c.AllowPrivateNetworks,
+	)
+}
+
+type GistConfig struct {
+	Enabled bool   `toml:"enabled"`
+	APIURL  string `toml:"api_url"`
+	// Token is optional, it raises the rate limit of the GitHub API.
+	Token   string         `toml:"token"`
+	Timeout timex.Duration `toml:"timeout"`
+}
+
+func (c GistConfig) String() string {
+	return fmt.Sprintf("\n Enabled: %t\n APIURL: %s\n Token: %s\n Timeout: %s",
+		c.Enabled,
+		c.APIURL,
+		strings.Repeat("*", len(c.Token)),
+		time.Duration(c.Timeout),
+	)
+}
+
+// FederationConfig lets the server show documents of the gobin instances in Hosts under /f/{host}/{key}. Insecure
+// fetches them with http instead of https and MaxSize limits the size of a fetched document in bytes.
+type FederationConfig struct {
+	Enabled   bool           `toml:"enabled"`
+	Hosts     []string       `toml:"hosts"`
+	Insecure  bool           `toml:"insecure"`
+	Timeout   timex.Duration `toml:"timeout"`
+	MaxSize   int64          `toml:"max_size"`
+	CacheSize int            `toml:"cache_size"`
+	CacheTTL  timex.Duration `toml:"cache_ttl"`
+}
+
+func (c FederationConfig) String() string {
+	return fmt.Sprintf("\n Enabled: %t\n Hosts: %v\n Insecure: %t\n Timeout: %s\n MaxSize: %d\n CacheSize: %d\n CacheTTL: %s",
+		c.Enabled,
+		c.Hosts,
+		c.Insecure,
+		time.Duration(c.Timeout),
+		c.MaxSize,
+		c.CacheSize,
+		time.Duration(c.CacheTTL),
+	)
+}
+
+// ActivityPubConfig announces public documents as posts of a single actor fediverse users can follow. BaseURL is the
+// public url of gobin the ids of the actor and posts are built from. PrivateKeyPath is created with a new key if it
+// doesn't exist. Posts show the first PreviewLines lines and get a content warning with more than ContentWarningLines
+// lines or if ContentWarningCode is set and they contain code.
+type ActivityPubConfig struct {
+	Enabled             bool           `toml:"enabled"`
+	BaseURL             string         `toml:"base_url"`
+	Username            string         `toml:"username"`
+	Name                string         `toml:"name"`
+	Summary             string         `toml:"summary"`
+	PrivateKeyPath      string         `toml:"private_key_path"`
+	PreviewLines        int            `toml:"preview_lines"`
+	ContentWarningLines int            `toml:"content_warning_lines"`
+	ContentWarningCode  bool           `toml:"content_warning_code"`
+	Timeout             timex.Duration `toml:"timeout"`
+}
+
+func (c ActivityPubConfig) String() string {
+	return fmt.Sprintf("\n Enabled: %t\n BaseURL: %s\n Username: %s\n Name: %s\n Summary: %s\n PrivateKeyPath: %s\n PreviewLines: %d\n ContentWarningLines: %d\n ContentWarningCode: %t\n Timeout: %s",
+		c.Enabled,
+		c.BaseURL,
+		c.Username,
+		c.Name,
+		c.Summary,
+		c.PrivateKeyPath,
+		c.PreviewLines,
+		c.ContentWarningLines,
+		c.ContentWarningCode,
+		time.Duration(c.Timeout),
+	)
+}
+
+type SyncConfig struct {
+	Enabled    bool           `toml:"enabled"`
+	Source     string         `toml:"source"`
+	Token      string         `toml:"token"`
+	Interval   timex.Duration `toml:"interval"`
+	Timeout    timex.Duration `toml:"timeout"`
+	Documents  []string       `toml:"documents"`
+	Tags       []string       `toml:"tags"`
+	Collection bool           `toml:"collection"`
+}
+
+func (c SyncConfig) String() string {
+	return fmt.Sprintf("\n Enabled: %t\n Source: %s\n Token: %s\n Interval: %s\n Timeout: %s\n Documents: %v\n Tags: %v\n Collection: %t",
+		c.Enabled,
+		c.Source,
+		strings.Repeat("*", len(c.Token)),
+		time.Duration(c.Interval),
+		time.Duration(c.Timeout),
+		c.Documents,
+		c.Tags,
+		c.Collection,
+	)
+}
+
+type AssetsConfig struct {
+	Dir string `toml:"dir"`
+}
+
+func (c AssetsConfig) String() string {
+	return fmt.Sprintf("\n Dir: %s",
+		c.Dir,
+	)
+}
+
+type EventsConfig struct {
+	Enabled   bool           `toml:"enabled"`
+	Retention timex.Duration `toml:"retention"`
+}
+
+func (c EventsConfig) String() string {
+	return fmt.Sprintf("\n Enabled: %t\n Retention: %s",
+		c.Enabled,
+		time.Duration(c.Retention),
+	)
+}
+
+// TombstonesConfig configures how long deletions are remembered for restoring backups, see Server.Restore.
+type TombstonesConfig struct {
+	// Retention is how long tombstones are kept, 0 keeps them forever. Backups older than it can bring back deleted
+	// documents when they are restored.
+	Retention timex.Duration `toml:"retention"`
+}
+
+func (c TombstonesConfig) String() string {
+	return fmt.Sprintf("\n Retention: %s",
+		time.Duration(c.Retention),
+	)
+}
+
+// RetentionConfig caps the growth of the database, the cleanup prunes the oldest versions first. 0 disables a limit.
+type RetentionConfig struct {
+	// MaxVersions is the max number of versions per document, older versions are pruned.
+	MaxVersions int `toml:"max_versions"`
+	// MaxAge is the max age of a document since its first version, older documents are pruned with all versions.
+	MaxAge timex.Duration `toml:"max_age"`
+	// MaxStorage is the max size in bytes of all file contents stored in the database, the oldest versions which are
+	// not the latest version of their document are pruned before whole documents.
+	MaxStorage int64 `toml:"max_storage"`
+}
+
+func (c RetentionConfig) String() string {
+	return fmt.Sprintf("\n MaxVersions: %d\n MaxAge: %s\n MaxStorage: %d",
+		c.MaxVersions,
+		time.Duration(c.MaxAge),
+		c.MaxStorage,
+	)
+}
+
+type SearchConfig struct {
+	Enabled bool `toml:"enabled"`
+}
+
+func (c SearchConfig) String() string {
+	return fmt.Sprintf("\n Enabled: %t",
+		c.Enabled,
+	)
+}
+
+type DeviceAuthConfig struct {
+	Enabled  bool           `toml:"enabled"`
+	Expiry   timex.Duration `toml:"expiry"`
+	Interval timex.Duration `toml:"interval"`
+}
+
+func (c DeviceAuthConfig) String() string {
+	return fmt.Sprintf("\n Enabled: %t\n Expiry: %s\n Interval: %s",
+		c.Enabled,
+		time.Duration(c.Expiry),
+		time.Duration(c.Interval),
+	)
+}
+
+type RecentConfig struct {
+	Enabled bool `toml:"enabled"`
+	Limit   int  `toml:"limit"`
+}
+
+func (c RecentConfig) String() string {
+	return fmt.Sprintf("\n Enabled: %t\n Limit: %d",
+		c.Enabled,
+		c.Limit,
+	)
+}
+
+type CustomKeysConfig struct {
+	Enabled bool `toml:"enabled"`
+	// RequireUser only lets browsers with a creator cookie and clients with a user token choose keys.
+	RequireUser bool `toml:"require_user"`
+	MinLength   int  `toml:"min_length"`
+	MaxLength   int  `toml:"max_length"`
+	// Reserved are keys which can't be chosen in addition to the routes and the default reserved keys.
+	Reserved []string `toml:"reserved"`
+}
+
+func (c CustomKeysConfig) String() string {
+	return fmt.Sprintf("\n Enabled: %t\n RequireUser: %t\n MinLength: %d\n MaxLength: %d\n Reserved: %v",
+		c.Enabled,
+		c.RequireUser,
+		c.MinLength,
+		c.MaxLength,
+		c.Reserved,
+	)
+}
+
+type AccountsConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Issuer is the URL of the OpenID Connect provider, its discovery document is loaded from {issuer}/.well-known/openid-configuration.
+	Issuer       string `toml:"issuer"`
+	ClientID     string `toml:"client_id"`
+	ClientSecret string `toml:"client_secret"`
+	// RedirectURL is the callback registered at the provider, defaults to https://{host}/login/callback.
+	RedirectURL string         `toml:"redirect_url"`
+	Scopes      []string       `toml:"scopes"`
+	SessionTTL  timex.Duration `toml:"session_ttl"`
+	// RequireTwoFactor only lets accounts use their sessions after a second factor, accounts without one have to set
+	// it up on the settings page first.
+	RequireTwoFactor bool `toml:"require_two_factor"`
+}
+
+func (c AccountsConfig) String() string {
+	return fmt.Sprintf("\n Enabled: %t\n Issuer: %s\n ClientID: %s\n ClientSecret: %s\n RedirectURL: %s\n Scopes: %v\n SessionTTL: %s\n RequireTwoFactor: %t",
+		c.Enabled,
+		c.Issuer,
+		c.ClientID,
+		strings.Repeat("*", len(c.ClientSecret)),
+		c.RedirectURL,
+		c.Scopes,
+		time.Duration(c.SessionTTL),
+		c.RequireTwoFactor,
+	)
+}
+
+type IngestConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Secret authenticates the bucket notifications, without a secret objects are only ingested by polling.
+	Secret string `toml:"secret"`
+	// S3 is the bucket the documents are ingested from, only objects starting with its prefix are ingested.
+	S3 storage.S3Config `toml:"s3"`
+	// PollInterval lists the bucket for new objects in this interval, 0 disables polling.
+	PollInterval timex.Duration `toml:"poll_interval"`
+	// Expiry lets the ingested documents expire after this duration, 0 keeps them forever.
+	Expiry timex.Duration `toml:"expiry"`
+	// MaxSize skips larger objects, 0 uses the max document size.
+	MaxSize int64 `toml:"max_size"`
+}
+
+func (c IngestConfig) String() string {
+	return fmt.Sprintf("\n Enabled: %t\n Secret: %s\n S3: %s\n PollInterval: %s\n Expiry: %s\n MaxSize: %d",
+		c.Enabled,
+		strings.Repeat("*", len(c.Secret)),
+		c.S3,
+		time.Duration(c.PollInterval),
+		time.Duration(c.Expiry),
+		c.MaxSize,
+	)
+}
+
+type SyslogConfig struct {
+	Enabled bool `toml:"enabled"`
+	// UDPAddr and TCPAddr are the addresses to receive syslog messages on, an empty address disables the listener.
+	UDPAddr string `toml:"udp_addr"`
+	TCPAddr string `toml:"tcp_addr"`
+	// RollInterval and RollSize create a new version of the source document when the received lines are older or
+	// larger than this.
+	RollInterval timex.Duration `toml:"roll_interval"`
+	RollSize     int            `toml:"roll_size"`
+	// Expiry lets the versions of the source documents expire after this duration, 0 keeps them forever.
+	Expiry timex.Duration `toml:"expiry"`
+	// MaxSources limits the number of documents created for sources, messages from other sources are dropped. 0 disables
+	// the limit.
+	MaxSources int `toml:"max_sources"`
+}
+
+func (c SyslogConfig) String() string {
+	return fmt.Sprintf("\n Enabled: %t\n UDPAddr: %s\n TCPAddr: %s\n RollInterval: %s\n RollSize: %d\n Expiry: %s\n MaxSources: %d",
+		c.Enabled,
+		c.UDPAddr,
+		c.TCPAddr,
+		time.Duration(c.RollInterval),
+		c.RollSize,
+		time.Duration(c.Expiry),
+		c.MaxSources,
+	)
+}
+
+type PluginsConfig struct {
+	Enabled       bool             `toml:"enabled"`
+	Timeout       timex.Duration   `toml:"timeout"`
+	MaxMemory     int              `toml:"max_memory"`
+	MaxOutputSize int64            `toml:"max_output_size"`
+	Renderers     []RendererConfig `toml:"renderers"`
+}
+
+func (c PluginsConfig) String() string {
+	return fmt.Sprintf("\n Enabled: %t\n Timeout: %s\n MaxMemory: %d\n MaxOutputSize: %d\n Renderers: %v",
+		c.Enabled,
+		time.Duration(c.Timeout),
+		c.MaxMemory,
+		c.MaxOutputSize,
+		c.Renderers,
+	)
+}
+
+type RendererConfig struct {
+	Name           string   `toml:"name"`
+	Path           string   `toml:"path"`
+	Languages      []string `toml:"languages"`
+	Files          []string `toml:"files"`
+	OutputLanguage string   `toml:"output_language"`
+}
+
+func (c RendererConfig) String() string {
+	return fmt.Sprintf("{Name: %s, Path: %s, Languages: %v, Files: %v, OutputLanguage: %s}",
+		c.Name,
+		c.Path,
+		c.Languages,
+		c.Files,
+		c.OutputLanguage,
+	)
+}
+
+type HookConfig struct {
+	Name          string            `toml:"name"`
+	Events        []string          `toml:"events"`
+	Command       []string          `toml:"command"`
+	Env           []string          `toml:"env"`
+	WorkDir       string            `toml:"work_dir"`
+	URL           string            `toml:"url"`
+	Secret        string            `toml:"secret"`
+	Timeout       timex.Duration    `toml:"timeout"`
+	FailurePolicy HookFailurePolicy `toml:"failure_policy"`
+	Sandbox       HookSandboxConfig `toml:"sandbox"`
+}
+
+func (c HookConfig) String() string {
+	return fmt.Sprintf("{Name: %s, Events: %v, Command: %v, WorkDir: %s, URL: %s, Secret: %s, Timeout: %s, FailurePolicy: %s, Sandbox: %s}",
+		c.Name,
+		c.Events,
+		c.Command,
+		c.WorkDir,
+		c.URL,
+		strings.Repeat("*", len(c.Secret)),
+		time.Duration(c.Timeout),
+		c.FailurePolicy,
+		c.Sandbox,
+	)
+}
+
+// HookSandboxConfig limits the resources of a command hook and runs it as another user, it is only supported on Linux.
+// Zero values don't limit the resource.
+type HookSandboxConfig struct {
+	// User and Group are the name or id the command runs as, changing them requires gobin to run as root. Group
+	// defaults to the primary group of the user.
+	User  string `toml:"user"`
+	Group string `toml:"group"`
+	// CPUTime is rounded up to seconds.
+	CPUTime timex.Duration `toml:"cpu_time"`
+	// Memory is the size of the address space in bytes, FileSize the size of files the command writes in bytes.
+	Memory    uint64 `toml:"memory"`
+	FileSize  uint64 `toml:"file_size"`
+	OpenFiles uint64 `toml:"open_files"`
+	// Processes limits the processes of the user, it only limits the command with a user of its own.
+	Processes uint64 `toml:"processes"`
+}
+
+func (c HookSandboxConfig) Enabled() bool {
+	return c != HookSandboxConfig{}
+}
+
+func (c HookSandboxConfig) String() string {
+	return fmt.Sprintf("{User: %s, Group: %s, CPUTime: %s, Memory: %d, FileSize: %d, OpenFiles: %d, Processes: %d}",
+		c.User,
+		c.Group,
+		time.Duration(c.CPUTime),
+		c.Memory,
+		c.FileSize,
+		c.OpenFiles,
+		c.Processes,
 	)
 }
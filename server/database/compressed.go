@@ -0,0 +1,315 @@
+package database
+
+import (
+	"context"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressedPrefix marks contents which are compressed with zstd and base64 encoded, contents without it are stored as
+// they are.
+const CompressedPrefix = "zstd:"
+
+// compressMigrationPageSize is how many documents are compressed or decompressed at once by MigrateContents.
+const compressMigrationPageSize = 100
+
+// zstdDict is a zstd dictionary trained on samples of source code, configs, markup and logs, so even small pastes
+// compress well. Its id is written into every compressed content, a new dictionary needs a new id and the old one has to
+// stay registered in the decoder.
+//
+//go:embed zstd.dict
+var zstdDict []byte
+
+// IsCompressed returns whether the content is compressed.
+func IsCompressed(content string) bool {
+	return strings.HasPrefix(content, CompressedPrefix)
+}
+
+// NewCompressedDB returns a DB which decompresses contents of document files on read and, if compress is true,
+// compresses the content of new files with zstd before it's stored. Contents are only stored compressed if that makes
+// them smaller, end-to-end encrypted files are never compressed. Compressed contents are always decompressed, so
+// compression can be turned off without decompressing them first.
+func NewCompressedDB(db DB, compress bool) (*CompressedDB, error) {
+	encoder, err := zstd.NewWriter(nil,
+		zstd.WithEncoderLevel(zstd.SpeedBetterCompression),
+		zstd.WithEncoderDict(zstdDict),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+	}
+	decoder, err := zstd.NewReader(nil,
+		zstd.WithDecoderConcurrency(0),
+		zstd.WithDecoderDicts(zstdDict),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+	}
+	return &CompressedDB{
+		DB:       db,
+		compress: compress,
+		encoder:  encoder,
+		decoder:  decoder,
+	}, nil
+}
+
+// CompressedDB is the DB returned by NewCompressedDB, MigrateContents changes the compression of existing files.
+type CompressedDB struct {
+	DB
+	compress bool
+	encoder  *zstd.Encoder
+	decoder  *zstd.Decoder
+}
+
+// compressContent returns the compressed content or the content itself if compressing doesn't make it smaller. Contents
+// which look compressed are always compressed, so they are not decompressed on read.
+func (d *CompressedDB) compressContent(content string) string {
+	compressed := CompressedPrefix + base64.StdEncoding.EncodeToString(d.encoder.EncodeAll([]byte(content), nil))
+	if len(compressed) >= len(content) && !IsCompressed(content) {
+		return content
+	}
+	return compressed
+}
+
+func (d *CompressedDB) decompressContent(content string) (string, error) {
+	encoded, ok := strings.CutPrefix(content, CompressedPrefix)
+	if !ok {
+		return content, nil
+	}
+	compressed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode compressed content: %w", err)
+	}
+	decompressed, err := d.decoder.DecodeAll(compressed, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress content: %w", err)
+	}
+	return string(decompressed), nil
+}
+
+// compressContents returns copies of the files with compressed contents, the checksums are set from the uncompressed
+// contents.
+func (d *CompressedDB) compressContents(files []File) []File {
+	if !d.compress {
+		return files
+	}
+	setChecksums(files)
+	newFiles := make([]File, len(files))
+	for i, file := range files {
+		if file.Content != "" && !file.Encrypted {
+			file.Content = d.compressContent(file.Content)
+		}
+		newFiles[i] = file
+	}
+	return newFiles
+}
+
+func (d *CompressedDB) decompressContents(files []File) error {
+	for i, file := range files {
+		content, err := d.decompressContent(file.Content)
+		if err != nil {
+			return fmt.Errorf("failed to decompress content of %s: %w", file.Name, err)
+		}
+		files[i].Content = content
+	}
+	return nil
+}
+
+func (d *CompressedDB) GetDocument(ctx context.Context, documentID string) ([]File, error) {
+	files, err := d.DB.GetDocument(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.decompressContents(files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (d *CompressedDB) GetDocumentVersion(ctx context.Context, documentID string, documentVersion int64) ([]File, error) {
+	files, err := d.DB.GetDocumentVersion(ctx, documentID, documentVersion)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.decompressContents(files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (d *CompressedDB) GetDocumentVersionsWithFiles(ctx context.Context, documentID string, withContent bool) (map[int64][]File, error) {
+	versions, err := d.DB.GetDocumentVersionsWithFiles(ctx, documentID, withContent)
+	if err != nil || !withContent {
+		return versions, err
+	}
+	for _, files := range versions {
+		if err = d.decompressContents(files); err != nil {
+			return nil, err
+		}
+	}
+	return versions, nil
+}
+
+func (d *CompressedDB) CreateDocument(ctx context.Context, documentID string, files []File) (*string, *int64, error) {
+	newDocumentID, version, err := d.DB.CreateDocument(ctx, documentID, d.compressContents(files))
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range files {
+		files[i].DocumentID = *newDocumentID
+		files[i].DocumentVersion = *version
+	}
+	return newDocumentID, version, nil
+}
+
+func (d *CompressedDB) UpdateDocument(ctx context.Context, documentID string, files []File) (*int64, error) {
+	version, err := d.DB.UpdateDocument(ctx, documentID, d.compressContents(files))
+	if err != nil {
+		return nil, err
+	}
+	for i := range files {
+		files[i].DocumentID = documentID
+		files[i].DocumentVersion = *version
+	}
+	return version, nil
+}
+
+func (d *CompressedDB) ImportDocumentVersion(ctx context.Context, documentID string, documentVersion int64, files []File) error {
+	return d.DB.ImportDocumentVersion(ctx, documentID, documentVersion, d.compressContents(files))
+}
+
+func (d *CompressedDB) SetFileContents(ctx context.Context, files []File) error {
+	return d.DB.SetFileContents(ctx, d.compressContents(files))
+}
+
+func (d *CompressedDB) DeleteDocument(ctx context.Context, documentID string) (*Document, error) {
+	document, err := d.DB.DeleteDocument(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.decompressContents(document.Files); err != nil {
+		slog.ErrorContext(ctx, "failed to decompress deleted file contents", slog.String("document_id", documentID), slog.Any("err", err))
+	}
+	return document, nil
+}
+
+func (d *CompressedDB) DeleteDocumentVersion(ctx context.Context, documentID string, documentVersion int64) (*Document, error) {
+	document, err := d.DB.DeleteDocumentVersion(ctx, documentID, documentVersion)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.decompressContents(document.Files); err != nil {
+		slog.ErrorContext(ctx, "failed to decompress deleted file contents", slog.String("document_id", documentID), slog.Any("err", err))
+	}
+	return document, nil
+}
+
+func (d *CompressedDB) DeleteExpiredDocuments(ctx context.Context, expireAfter time.Duration) ([]Document, error) {
+	documents, err := d.DB.DeleteExpiredDocuments(ctx, expireAfter)
+	if err != nil {
+		return nil, err
+	}
+	for _, document := range documents {
+		if err = d.decompressContents(document.Files); err != nil {
+			slog.ErrorContext(ctx, "failed to decompress expired file contents", slog.String("document_id", document.ID), slog.Any("err", err))
+		}
+	}
+	return documents, nil
+}
+
+func (d *CompressedDB) GetDocumentFile(ctx context.Context, documentID string, fileName string) (*File, error) {
+	file, err := d.DB.GetDocumentFile(ctx, documentID, fileName)
+	if err != nil {
+		return nil, err
+	}
+	files := []File{*file}
+	if err = d.decompressContents(files); err != nil {
+		return nil, err
+	}
+	return &files[0], nil
+}
+
+func (d *CompressedDB) GetDocumentFileVersion(ctx context.Context, documentID string, documentVersion int64, fileName string) (*File, error) {
+	file, err := d.DB.GetDocumentFileVersion(ctx, documentID, documentVersion, fileName)
+	if err != nil {
+		return nil, err
+	}
+	files := []File{*file}
+	if err = d.decompressContents(files); err != nil {
+		return nil, err
+	}
+	return &files[0], nil
+}
+
+// CompressionResult is the outcome of MigrateContents. Size and StoredSize are the sizes of the changed contents before
+// and after they were changed.
+type CompressionResult struct {
+	Documents  int
+	Files      int
+	Size       int64
+	StoredSize int64
+}
+
+// MigrateContents compresses the contents of all files which are stored uncompressed or, if compress is false,
+// decompresses all compressed contents, so compression can be turned on or off for files created before. Contents which
+// are deduplicated by their checksum or kept in the S3 storage are left as they are.
+func (d *CompressedDB) MigrateContents(ctx context.Context, compress bool) (*CompressionResult, error) {
+	var (
+		result  CompressionResult
+		afterID string
+	)
+	for {
+		documentIDs, err := d.DB.GetDocumentIDs(ctx, afterID, compressMigrationPageSize)
+		if err != nil {
+			return &result, err
+		}
+		if len(documentIDs) == 0 {
+			return &result, nil
+		}
+		afterID = documentIDs[len(documentIDs)-1]
+
+		for _, documentID := range documentIDs {
+			versions, err := d.DB.GetDocumentVersionsWithFiles(ctx, documentID, true)
+			if err != nil {
+				return &result, fmt.Errorf("failed to get files of document %s: %w", documentID, err)
+			}
+
+			var changed []File
+			for _, files := range versions {
+				for _, file := range files {
+					if file.Content == "" || file.Encrypted || IsCompressed(file.Content) == compress {
+						continue
+					}
+					content := file.Content
+					if compress {
+						if file.SHA256 == "" && file.DeltaBase == 0 {
+							file.SHA256 = Checksum(content)
+						}
+						file.Content = d.compressContent(content)
+					} else if file.Content, err = d.decompressContent(content); err != nil {
+						return &result, fmt.Errorf("failed to decompress %s of document %s: %w", file.Name, documentID, err)
+					}
+					if file.Content == content {
+						continue
+					}
+					result.Size += int64(len(content))
+					result.StoredSize += int64(len(file.Content))
+					changed = append(changed, file)
+				}
+			}
+			if len(changed) == 0 {
+				continue
+			}
+			if err = d.DB.SetFileContents(ctx, changed); err != nil {
+				return &result, fmt.Errorf("failed to store files of document %s: %w", documentID, err)
+			}
+			result.Documents++
+			result.Files += len(changed)
+		}
+	}
+}
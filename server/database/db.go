@@ -2,14 +2,19 @@ package database
 
 import (
 	"context"
+	"crypto/sha256"
+	"database/sql"
 	"database/sql/driver"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
 	"math/rand"
+	"regexp"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/XSAM/otelsql"
 	"github.com/jackc/pgx/v5"
@@ -23,6 +28,7 @@ import (
 	"go.opentelemetry.io/otel/semconv/v1.25.0"
 	_ "modernc.org/sqlite"
 
+	"github.com/topi314/gobin/v3/internal/crypt"
 	"github.com/topi314/gobin/v3/internal/timex"
 )
 
@@ -43,6 +49,21 @@ type Config struct {
 	Debug           bool           `toml:"debug"`
 	ExpireAfter     timex.Duration `toml:"expire_after"`
 	CleanupInterval timex.Duration `toml:"cleanup_interval"`
+	// ConnMaxLifetime closes connections after they were open for this long, 0 keeps them open.
+	ConnMaxLifetime timex.Duration `toml:"conn_max_lifetime"`
+	// KeyStrategy is how the keys of new documents are generated, KeyLength is the length of random and nanoid keys
+	// and of the hash of sequential keys, KeySalt is hashed with the sequence number of sequential keys.
+	KeyStrategy KeyStrategy `toml:"key_strategy"`
+	KeyLength   int         `toml:"key_length"`
+	KeySalt     string      `toml:"key_salt"`
+	// Deduplicate stores the content of document files once per checksum, see NewDedupDB.
+	Deduplicate bool `toml:"deduplicate"`
+	// DeltaVersions stores new document versions as delta against the previous version, every DeltaSnapshotInterval
+	// versions the full content is stored again, see NewDeltaDB.
+	DeltaVersions         bool `toml:"delta_versions"`
+	DeltaSnapshotInterval int  `toml:"delta_snapshot_interval"`
+	// Compression stores the content of new document files compressed with zstd, see NewCompressedDB.
+	Compression bool `toml:"compression"`
 
 	// SQLite
 	Path string `toml:"path"`
@@ -54,14 +75,26 @@ type Config struct {
 	Password string `toml:"password"`
 	Database string `toml:"database"`
 	SSLMode  string `toml:"ssl_mode"`
+
+	// Credentials returns the username and password of new connections instead of Username and Password, it is used
+	// for dynamic credentials which change while running.
+	Credentials func() (string, string) `toml:"-"`
 }
 
 func (c Config) String() string {
-	str := fmt.Sprintf("\n  Type: %s\n  Debug: %t\n  ExpireAfter: %s\n  CleanupInterval: %s\n  ",
+	str := fmt.Sprintf("\n  Type: %s\n  Debug: %t\n  ExpireAfter: %s\n  CleanupInterval: %s\n  ConnMaxLifetime: %s\n  KeyStrategy: %s\n  KeyLength: %d\n  KeySalt: %s\n  Deduplicate: %t\n  DeltaVersions: %t\n  DeltaSnapshotInterval: %d\n  Compression: %t\n  ",
 		c.Type,
 		c.Debug,
 		time.Duration(c.ExpireAfter),
 		time.Duration(c.CleanupInterval),
+		time.Duration(c.ConnMaxLifetime),
+		c.KeyStrategy,
+		c.KeyLength,
+		strings.Repeat("*", len(c.KeySalt)),
+		c.Deduplicate,
+		c.DeltaVersions,
+		c.DeltaSnapshotInterval,
+		c.Compression,
 	)
 	switch c.Type {
 	case TypePostgres:
@@ -93,9 +126,15 @@ func (c Config) PostgresDataSourceName() string {
 }
 
 func New(ctx context.Context, cfg Config, migrations fs.FS) (DB, error) {
+	keys, err := newKeyGenerator(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	var (
 		driverName      string
 		dataSourceName  string
+		connector       driver.Connector
 		dbSystem        attribute.KeyValue
 		migrationDriver gomigrate.NewDriver
 	)
@@ -121,17 +160,24 @@ func New(ctx context.Context, cfg Config, migrations fs.FS) (DB, error) {
 				LogLevel: tracelog.LogLevelDebug,
 			}
 		}
-		dataSourceName = stdlib.RegisterConnConfig(pgCfg)
+		if cfg.Credentials != nil {
+			connector = stdlib.GetConnector(*pgCfg, stdlib.OptionBeforeConnect(func(ctx context.Context, connCfg *pgx.ConnConfig) error {
+				connCfg.User, connCfg.Password = cfg.Credentials()
+				return nil
+			}))
+		} else {
+			dataSourceName = stdlib.RegisterConnConfig(pgCfg)
+		}
 	case TypeSQLite:
-		driverName = "sqliteDB"
+		driverName = "sqlite"
 		dbSystem = semconv.DBSystemSqlite
 		dataSourceName = cfg.Path
 		migrationDriver = sqlite.New
 	default:
-		return nil, errors.New("invalid database type, must be one of: postgresDB, sqliteDB")
+		return nil, errors.New("invalid database type, must be one of: postgres, sqlite")
 	}
 
-	sqlDB, err := otelsql.Open(driverName, dataSourceName,
+	opts := []otelsql.Option{
 		otelsql.WithAttributes(dbSystem),
 		otelsql.WithSQLCommenter(true),
 		otelsql.WithAttributesGetter(func(ctx context.Context, method otelsql.Method, query string, args []driver.NamedValue) []attribute.KeyValue {
@@ -140,10 +186,14 @@ func New(ctx context.Context, cfg Config, migrations fs.FS) (DB, error) {
 				semconv.DBStatementKey.String(query),
 			}
 		}),
-	)
-	if err != nil {
+	}
+	var sqlDB *sql.DB
+	if connector != nil {
+		sqlDB = otelsql.OpenDB(connector, opts...)
+	} else if sqlDB, err = otelsql.Open(driverName, dataSourceName, opts...); err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	sqlDB.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime))
 
 	if err = otelsql.RegisterDBStatsMetrics(sqlDB, otelsql.WithAttributes(dbSystem)); err != nil {
 		return nil, fmt.Errorf("failed to register database stats metrics: %w", err)
@@ -158,14 +208,19 @@ func New(ctx context.Context, cfg Config, migrations fs.FS) (DB, error) {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
+	var db DB
 	switch cfg.Type {
 	case TypePostgres:
-		return newPostgresDB(dbx), nil
+		db = newPostgresDB(dbx, keys)
 	case TypeSQLite:
-		return newSQLiteDB(dbx), nil
+		db = newSQLiteDB(dbx, keys)
 	default:
-		return nil, errors.New("invalid database type, must be one of: postgresDB, sqliteDB")
+		return nil, errors.New("invalid database type, must be one of: postgres, sqlite")
+	}
+	if cfg.Deduplicate {
+		db = NewDedupDB(db)
 	}
+	return db, nil
 }
 
 type DB interface {
@@ -176,8 +231,9 @@ type DB interface {
 	GetVersionCount(ctx context.Context, documentID string) (int, error)
 	GetDocumentVersions(ctx context.Context, documentID string) ([]int64, error)
 	GetDocumentVersionsWithFiles(ctx context.Context, documentID string, withContent bool) (map[int64][]File, error)
-	CreateDocument(ctx context.Context, files []File) (*string, *int64, error)
+	CreateDocument(ctx context.Context, documentID string, files []File) (*string, *int64, error)
 	UpdateDocument(ctx context.Context, documentID string, files []File) (*int64, error)
+	ImportDocumentVersion(ctx context.Context, documentID string, documentVersion int64, files []File) error
 	DeleteDocument(ctx context.Context, documentID string) (*Document, error)
 	DeleteDocumentVersion(ctx context.Context, documentID string, documentVersion int64) (*Document, error)
 	DeleteDocumentVersions(ctx context.Context, documentID string) error
@@ -188,12 +244,191 @@ type DB interface {
 	DeleteDocumentFile(ctx context.Context, documentID string, fileName string) error
 	DeleteDocumentVersionFile(ctx context.Context, documentID string, documentVersion int64, fileName string) error
 
-	GetWebhook(ctx context.Context, documentID string, webhookID string, secret string) (*Webhook, error)
+	GetDeltaFiles(ctx context.Context, documentID string) ([]File, error)
+	GetExpiredDeltaBaseFiles(ctx context.Context, expireAfter time.Duration) ([]File, error)
+	SetFileContents(ctx context.Context, files []File) error
+	GetFileContents(ctx context.Context, checksums []string) ([]FileContent, error)
+	PutFileContents(ctx context.Context, contents []FileContent) error
+	DeleteOrphanedFileContents(ctx context.Context, before time.Time) error
+
+	GetVersionsBeyondLimit(ctx context.Context, maxVersions int, limit int) ([]DocumentVersion, error)
+	GetDocumentsCreatedBefore(ctx context.Context, before time.Time, limit int) ([]string, error)
+	GetStorageSize(ctx context.Context) (int64, error)
+	GetOldestVersions(ctx context.Context, limit int) ([]DocumentVersion, error)
+	GetDocumentIDs(ctx context.Context, afterID string, limit int) ([]string, error)
+	GetTombstones(ctx context.Context, since time.Time) ([]Tombstone, error)
+	ApplyTombstone(ctx context.Context, tombstone Tombstone) error
+	DeleteTombstonesBefore(ctx context.Context, before time.Time) error
+
+	GetWebhook(ctx context.Context, documentID string, webhookID string, secretHash string) (*Webhook, error)
 	GetWebhooksByDocumentID(ctx context.Context, documentID string) ([]Webhook, error)
 	GetAndDeleteWebhooksByDocumentID(ctx context.Context, documentID string) ([]Webhook, error)
-	CreateWebhook(ctx context.Context, documentID string, url string, secret string, events []string) (*Webhook, error)
-	UpdateWebhook(ctx context.Context, documentID string, webhookID string, secret string, newURL string, newSecret string, newEvents []string) (*Webhook, error)
-	DeleteWebhook(ctx context.Context, documentID string, webhookID string, secret string) error
+	CreateWebhook(ctx context.Context, webhook Webhook) (*Webhook, error)
+	ImportWebhook(ctx context.Context, webhook Webhook) error
+	UpdateWebhook(ctx context.Context, webhookUpdate WebhookUpdate) (*Webhook, error)
+	SetWebhookClientCertificate(ctx context.Context, documentID string, webhookID string, secretHash string, clientCertificate string) (*Webhook, error)
+	DisableWebhook(ctx context.Context, documentID string, webhookID string, reason string) error
+	DeleteWebhook(ctx context.Context, documentID string, webhookID string, secretHash string) error
+	GetAccountWebhook(ctx context.Context, accountID string, webhookID string) (*Webhook, error)
+	GetAccountWebhooks(ctx context.Context, accountID string) ([]Webhook, error)
+	GetAccountWebhooksByDocumentID(ctx context.Context, documentID string) ([]Webhook, error)
+	CreateAccountWebhook(ctx context.Context, webhook Webhook) (*Webhook, error)
+	UpdateAccountWebhook(ctx context.Context, webhookUpdate WebhookUpdate) (*Webhook, error)
+	SetAccountWebhookClientCertificate(ctx context.Context, accountID string, webhookID string, clientCertificate string) (*Webhook, error)
+	DeleteAccountWebhook(ctx context.Context, accountID string, webhookID string) error
+	EncryptSecrets(ctx context.Context, encrypt func(plaintext string) (string, error)) error
+
+	CreateWebhookDelivery(ctx context.Context, delivery WebhookDelivery) error
+	GetWebhookDelivery(ctx context.Context, documentID string, webhookID string, deliveryID string) (*WebhookDelivery, error)
+	GetWebhookDeliveries(ctx context.Context, documentID string, webhookID string, limit int) ([]WebhookDelivery, error)
+	GetPendingWebhookDeliveries(ctx context.Context) ([]WebhookDelivery, error)
+	GetWebhookDeliveryAttempts(ctx context.Context, deliveryIDs []string) ([]WebhookDeliveryAttempt, error)
+	AddWebhookDeliveryAttempt(ctx context.Context, attempt WebhookDeliveryAttempt, status string) error
+	RedeliverWebhookDelivery(ctx context.Context, deliveryID string, url string, secret string, clientCertificate string) error
+	DeleteWebhookDeliveriesBefore(ctx context.Context, before time.Time) error
+
+	CreateEvent(ctx context.Context, event Event) (*Event, error)
+	GetEvents(ctx context.Context, documentID string, since int64, limit int) ([]Event, error)
+	DeleteEventsBefore(ctx context.Context, before time.Time) error
+
+	GetSummary(ctx context.Context, documentID string, documentVersion int64) (*Summary, error)
+	CreateSummary(ctx context.Context, summary Summary) error
+	DeleteOrphanedSummaries(ctx context.Context) error
+
+	GetFork(ctx context.Context, documentID string) (*Fork, error)
+	CreateFork(ctx context.Context, fork Fork) error
+	UpdateForkMergedVersion(ctx context.Context, documentID string, mergedVersion int64) error
+	DeleteOrphanedForks(ctx context.Context) error
+
+	GetDocumentPart(ctx context.Context, documentID string) (*DocumentPart, error)
+	GetDocumentParts(ctx context.Context, indexID string) ([]DocumentPart, error)
+	CreateDocumentPart(ctx context.Context, part DocumentPart) error
+	DeleteOrphanedDocumentParts(ctx context.Context) error
+
+	GetDocumentLock(ctx context.Context, documentID string) (*DocumentLock, error)
+	AcquireDocumentLock(ctx context.Context, lock DocumentLock, currentLockID string) (bool, error)
+	DeleteDocumentLock(ctx context.Context, documentID string, lockID string) error
+	DeleteExpiredDocumentLocks(ctx context.Context) error
+
+	IsDocumentProtected(ctx context.Context, documentID string) (bool, error)
+	SetDocumentProtected(ctx context.Context, documentID string, protected bool) error
+	GetDocumentStyle(ctx context.Context, documentID string) (string, error)
+	SetDocumentStyle(ctx context.Context, documentID string, style string) error
+	DeleteOrphanedDocumentStyles(ctx context.Context) error
+
+	GetDocumentTags(ctx context.Context, documentID string) ([]string, error)
+	SetDocumentTags(ctx context.Context, documentID string, tags []string) error
+	DeleteOrphanedDocumentTags(ctx context.Context) error
+	GetVersionMessages(ctx context.Context, documentID string) (map[int64]string, error)
+	SetVersionMessage(ctx context.Context, documentID string, documentVersion int64, message string) error
+	DeleteOrphanedVersionMessages(ctx context.Context) error
+	GetFileSignatures(ctx context.Context, documentID string, documentVersion int64) ([]FileSignature, error)
+	SetFileSignature(ctx context.Context, signature FileSignature) error
+	DeleteFileSignature(ctx context.Context, documentID string, documentVersion int64, fileName string) error
+	DeleteOrphanedFileSignatures(ctx context.Context) error
+	GetRevisions(ctx context.Context, documentID string) ([]RevisionFile, error)
+	GetRevision(ctx context.Context, documentID string, revision int64) ([]RevisionFile, error)
+	CreateRevision(ctx context.Context, documentID string, baseVersion int64, files []File) (*int64, error)
+	DeleteRevision(ctx context.Context, documentID string, revision int64) error
+	DeleteOrphanedRevisions(ctx context.Context) error
+
+	GetDeviceAuthorization(ctx context.Context, deviceCode string) (*DeviceAuthorization, error)
+	GetDeviceAuthorizationByUserCode(ctx context.Context, userCode string) (*DeviceAuthorization, error)
+	CreateDeviceAuthorization(ctx context.Context, authorization DeviceAuthorization) error
+	UpdateDeviceAuthorizationStatus(ctx context.Context, userCode string, status string, tokens string, accountID string, twoFactor bool) error
+	UpdateDeviceAuthorizationPolledAt(ctx context.Context, deviceCode string, polledAt time.Time) error
+	DeleteDeviceAuthorization(ctx context.Context, deviceCode string) error
+	DeleteExpiredDeviceAuthorizations(ctx context.Context) error
+
+	GetCreatorDocuments(ctx context.Context, creatorID string, limit int) ([]CreatorDocument, error)
+	IsCreatorDocument(ctx context.Context, creatorID string, documentID string) (bool, error)
+	AddCreatorDocument(ctx context.Context, creatorID string, documentID string, limit int) error
+	DeleteOrphanedCreatorDocuments(ctx context.Context) error
+
+	GetAccount(ctx context.Context, accountID string) (*Account, error)
+	UpsertAccount(ctx context.Context, account Account) (*Account, error)
+	IsAccountDocument(ctx context.Context, accountID string, documentID string) (bool, error)
+	AddAccountDocument(ctx context.Context, accountID string, documentID string) error
+	DeleteOrphanedAccountDocuments(ctx context.Context) error
+
+	CreateAccountSession(ctx context.Context, session AccountSession) error
+	GetAccountSession(ctx context.Context, sessionID string) (*AccountSession, error)
+	GetAccountSessions(ctx context.Context, accountID string) ([]AccountSession, error)
+	TouchAccountSession(ctx context.Context, sessionID string, lastUsedAt time.Time) error
+	DeleteAccountSession(ctx context.Context, accountID string, sessionID string) error
+	DeleteOtherAccountSessions(ctx context.Context, accountID string, sessionID string) error
+	DeleteExpiredAccountSessions(ctx context.Context) error
+	SetAccountSessionTwoFactor(ctx context.Context, sessionID string) error
+
+	GetAccountTwoFactor(ctx context.Context, accountID string) (*AccountTwoFactor, error)
+	SetAccountTOTPSecret(ctx context.Context, accountID string, secret string) error
+	EnableAccountTOTP(ctx context.Context, accountID string, step int64) error
+	UseAccountTOTPStep(ctx context.Context, accountID string, step int64) error
+	DisableAccountTOTP(ctx context.Context, accountID string) error
+	AddAccountTwoFactorAttempt(ctx context.Context, accountID string, now time.Time, since time.Time) (int, error)
+	ResetAccountTwoFactorAttempts(ctx context.Context, accountID string) error
+
+	GetAccountRecoveryCodeCount(ctx context.Context, accountID string) (int, error)
+	SetAccountRecoveryCodes(ctx context.Context, accountID string, codeHashes []string) error
+	UseAccountRecoveryCode(ctx context.Context, accountID string, codeHash string) error
+	DeleteAccountRecoveryCodes(ctx context.Context, accountID string) error
+
+	CreateAccountPasskey(ctx context.Context, passkey AccountPasskey) error
+	GetAccountPasskey(ctx context.Context, accountID string, passkeyID string) (*AccountPasskey, error)
+	GetAccountPasskeys(ctx context.Context, accountID string) ([]AccountPasskey, error)
+	UseAccountPasskey(ctx context.Context, passkeyID string, signCount int64, usedAt time.Time) error
+	DeleteAccountPasskey(ctx context.Context, accountID string, passkeyID string) error
+
+	GetUserSettings(ctx context.Context, creatorID string) (*UserSettings, error)
+	SetUserSettings(ctx context.Context, settings UserSettings) error
+	DeleteUserSettings(ctx context.Context, creatorID string) error
+
+	CreateDocumentInvite(ctx context.Context, invite DocumentInvite) error
+	ImportDocumentInvite(ctx context.Context, invite DocumentInvite) error
+	GetDocumentInvite(ctx context.Context, inviteID string) (*DocumentInvite, error)
+	GetDocumentInvites(ctx context.Context, documentID string) ([]DocumentInvite, error)
+	UseDocumentInvite(ctx context.Context, inviteID string) error
+	DeleteDocumentInvite(ctx context.Context, documentID string, inviteID string) error
+	DeleteExpiredDocumentInvites(ctx context.Context) error
+
+	CreateDocumentShareToken(ctx context.Context, shareToken DocumentShareToken) error
+	GetDocumentShareToken(ctx context.Context, shareTokenID string) (*DocumentShareToken, error)
+	UseDocumentShareToken(ctx context.Context, shareTokenID string) error
+	DeleteExpiredDocumentShareTokens(ctx context.Context) error
+
+	RevokeToken(ctx context.Context, token RevokedToken) error
+	IsTokenRevoked(ctx context.Context, tokenID string) (bool, error)
+	DeleteExpiredRevokedTokens(ctx context.Context) error
+
+	GetDocumentMember(ctx context.Context, documentID string, creatorID string) (*DocumentMember, error)
+	GetDocumentMembers(ctx context.Context, documentID string) ([]DocumentMember, error)
+	SetDocumentMember(ctx context.Context, member DocumentMember) error
+	DeleteDocumentMember(ctx context.Context, documentID string, creatorID string) error
+	DeleteOrphanedDocumentMembers(ctx context.Context) error
+
+	ClaimCustomDocumentKey(ctx context.Context, key string) error
+
+	GetIngestedObject(ctx context.Context, objectKey string) (*IngestedObject, error)
+	ClaimIngestedObject(ctx context.Context, objectKey string, etag string) error
+	SetIngestedObjectDocument(ctx context.Context, objectKey string, documentID string) error
+	DeleteIngestedObject(ctx context.Context, objectKey string) error
+
+	GetSyslogSource(ctx context.Context, source string) (*SyslogSource, error)
+	GetSyslogSourceCount(ctx context.Context) (int, error)
+	SetSyslogSource(ctx context.Context, source string, documentID string) error
+
+	GetActivityPubFollowerInboxes(ctx context.Context) ([]string, error)
+	GetActivityPubFollowerCount(ctx context.Context) (int, error)
+	AddActivityPubFollower(ctx context.Context, follower ActivityPubFollower) error
+	DeleteActivityPubFollower(ctx context.Context, actorID string) error
+	CreateActivityPubNote(ctx context.Context, note ActivityPubNote) error
+	GetActivityPubNote(ctx context.Context, documentID string) (*ActivityPubNote, error)
+	GetActivityPubNotes(ctx context.Context, limit int) ([]ActivityPubNote, error)
+	GetActivityPubNoteCount(ctx context.Context) (int, error)
+	DeleteActivityPubNote(ctx context.Context, documentID string) error
+
+	SearchDocuments(ctx context.Context, query string, creatorID string, documentIDs []string, limit int) ([]SearchResult, error)
+	GetDocumentList(ctx context.Context, creatorID string, documentIDs []string, tag string, beforeVersion int64, beforeID string, limit int) ([]File, error)
 
 	Close() error
 }
@@ -205,3 +440,99 @@ func randomString(length int) string {
 	}
 	return string(b)
 }
+
+// SecretHash returns the hex encoded SHA-256 hash of a secret, secrets are encrypted with a random data key so they
+// can't be looked up by their ciphertext.
+func SecretHash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Checksum returns the hex encoded SHA-256 checksum of the content.
+func Checksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// setChecksums sets the checksums of the files from their content. Files without content, with encrypted content or
+// stored as delta keep their checksum, since the storage DB removes, the encrypted DB encrypts and the delta DB replaces
+// the content before the files are inserted.
+func setChecksums(files []File) {
+	for i := range files {
+		if (files[i].Content != "" && !crypt.IsEncrypted(files[i].Content) && !IsCompressed(files[i].Content) && files[i].DeltaBase == 0) || files[i].SHA256 == "" {
+			files[i].SHA256 = Checksum(files[i].Content)
+		}
+	}
+}
+
+// documentListQuery returns the query for the files of the latest versions of at most limit documents which were
+// created by, owned by the account of or shared with the creator or are in the document ids and have the tag if it's
+// set. Documents are sorted by their latest version, a beforeVersion of 0 starts with the newest document.
+func documentListQuery(creatorID string, documentIDs []string, tag string, beforeVersion int64, beforeID string, limit int) (string, []any) {
+	condition, args := documentAccessCondition(creatorID, documentIDs, nil)
+	if condition == "" {
+		return "", nil
+	}
+	if tag != "" {
+		args = append(args, tag)
+		condition += fmt.Sprintf(" AND document_id IN (SELECT document_id FROM document_tags WHERE tag = $%d)", len(args))
+	}
+
+	having := ""
+	if beforeVersion > 0 {
+		args = append(args, beforeVersion, beforeID)
+		having = fmt.Sprintf(" HAVING MAX(document_version) < $%[1]d OR (MAX(document_version) = $%[1]d AND document_id < $%[2]d)", len(args)-1, len(args))
+	}
+	args = append(args, limit)
+
+	return fmt.Sprintf("SELECT f.name, f.document_id, f.document_version, f.language, f.encrypted, f.expires_at FROM files f JOIN (SELECT document_id, MAX(document_version) AS document_version FROM files WHERE %s GROUP BY document_id%s ORDER BY document_version DESC, document_id DESC LIMIT $%d) l ON f.document_id = l.document_id AND f.document_version = l.document_version ORDER BY f.document_version DESC, f.document_id DESC, f.order_index;", condition, having, len(args)), args
+}
+
+// documentAccessCondition returns a condition on document_id which matches the documents created by, owned by or
+// shared with the creator and the documentIDs, with its args appended to args. It returns an empty condition if
+// neither is set.
+func documentAccessCondition(creatorID string, documentIDs []string, args []any) (string, []any) {
+	var conditions []string
+	if creatorID != "" {
+		args = append(args, creatorID)
+		conditions = append(conditions, fmt.Sprintf("document_id IN (SELECT document_id FROM creator_documents WHERE creator_id = $%[1]d UNION SELECT document_id FROM account_documents WHERE account_id = $%[1]d UNION SELECT document_id FROM document_members WHERE creator_id = $%[1]d)", len(args)))
+	}
+	if len(documentIDs) > 0 {
+		placeholders := make([]string, len(documentIDs))
+		for i, documentID := range documentIDs {
+			args = append(args, documentID)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		conditions = append(conditions, fmt.Sprintf("document_id IN (%s)", strings.Join(placeholders, ", ")))
+	}
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// searchSnippetSize is the number of bytes shown before the first match, the snippet is three times as long.
+const searchSnippetSize = 80
+
+// searchSnippet cuts the content around the first match of any term and marks all matches like ts_headline does.
+func searchSnippet(content string, terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	regex := regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+
+	start := 0
+	if loc := regex.FindStringIndex(content); loc != nil {
+		start = max(0, loc[0]-searchSnippetSize)
+	}
+	end := min(len(content), start+3*searchSnippetSize)
+	for start > 0 && !utf8.RuneStart(content[start]) {
+		start--
+	}
+	for end < len(content) && !utf8.RuneStart(content[end]) {
+		end++
+	}
+
+	return regex.ReplaceAllString(content[start:end], SearchHighlightStart+"$0"+SearchHighlightEnd)
+}
@@ -0,0 +1,246 @@
+package database
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/topi314/gobin/v3/internal/crypt"
+)
+
+// emptyChecksum is the checksum of files without content, their content is never stored.
+var emptyChecksum = Checksum("")
+
+// NewDedupDB returns a DB which stores the content of document files once per checksum, so pushing the same content
+// to many versions or documents doesn't store it again. Files created before keep their content in the files.
+// Contents which are no longer used by any file are deleted with DeleteOrphanedFileContents.
+//
+// It is the innermost DB, so the encrypted and compressed DB change the contents before it stores them. Contents are
+// deduplicated by the checksum of their plaintext, which these DBs set before changing the content.
+func NewDedupDB(db DB) DB {
+	return &dedupDB{
+		DB: db,
+	}
+}
+
+type dedupDB struct {
+	DB
+}
+
+// loadContents fills in the content of the files which have no content in the files but a stored content.
+func (d *dedupDB) loadContents(ctx context.Context, files ...[]File) error {
+	var checksums []string
+	for _, fs := range files {
+		for _, file := range fs {
+			if file.Content == "" && file.DeltaBase == 0 && file.SHA256 != "" && file.SHA256 != emptyChecksum && !slices.Contains(checksums, file.SHA256) {
+				checksums = append(checksums, file.SHA256)
+			}
+		}
+	}
+	contents, err := d.DB.GetFileContents(ctx, checksums)
+	if err != nil {
+		return err
+	}
+	if len(contents) == 0 {
+		return nil
+	}
+
+	byChecksum := make(map[string]string, len(contents))
+	for _, content := range contents {
+		byChecksum[content.SHA256] = content.Content
+	}
+	for _, fs := range files {
+		for i, file := range fs {
+			if file.Content != "" || file.DeltaBase != 0 {
+				continue
+			}
+			if content, ok := byChecksum[file.SHA256]; ok {
+				fs[i].Content = content
+			}
+		}
+	}
+	return nil
+}
+
+// storeContents stores the contents of the files and returns copies of the files without their content. Deltas are
+// kept in the files since they depend on their base. Encrypted or compressed contents without the checksum of their
+// plaintext are kept in the files too, the checksum of the encrypted content is different for every copy.
+func (d *dedupDB) storeContents(ctx context.Context, files []File) ([]File, error) {
+	withoutPlaintext := make([]bool, len(files))
+	for i, file := range files {
+		withoutPlaintext[i] = file.SHA256 == "" && (crypt.IsEncrypted(file.Content) || IsCompressed(file.Content))
+	}
+	setChecksums(files)
+	now := time.Now()
+	seen := make(map[string]struct{}, len(files))
+	var contents []FileContent
+	dbFiles := make([]File, len(files))
+	for i, file := range files {
+		dbFiles[i] = file
+		if file.Content == "" || file.DeltaBase != 0 || withoutPlaintext[i] {
+			continue
+		}
+		dbFiles[i].Content = ""
+		if _, ok := seen[file.SHA256]; ok {
+			continue
+		}
+		seen[file.SHA256] = struct{}{}
+		contents = append(contents, FileContent{
+			SHA256:    file.SHA256,
+			Content:   file.Content,
+			UpdatedAt: now,
+		})
+	}
+	if err := d.DB.PutFileContents(ctx, contents); err != nil {
+		return nil, err
+	}
+	return dbFiles, nil
+}
+
+func (d *dedupDB) GetDocument(ctx context.Context, documentID string) ([]File, error) {
+	files, err := d.DB.GetDocument(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.loadContents(ctx, files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (d *dedupDB) GetDocumentVersion(ctx context.Context, documentID string, documentVersion int64) ([]File, error) {
+	files, err := d.DB.GetDocumentVersion(ctx, documentID, documentVersion)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.loadContents(ctx, files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (d *dedupDB) GetDocumentVersionsWithFiles(ctx context.Context, documentID string, withContent bool) (map[int64][]File, error) {
+	versions, err := d.DB.GetDocumentVersionsWithFiles(ctx, documentID, withContent)
+	if err != nil || !withContent {
+		return versions, err
+	}
+	files := make([][]File, 0, len(versions))
+	for _, versionFiles := range versions {
+		files = append(files, versionFiles)
+	}
+	if err = d.loadContents(ctx, files...); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+func (d *dedupDB) CreateDocument(ctx context.Context, documentID string, files []File) (*string, *int64, error) {
+	dbFiles, err := d.storeContents(ctx, files)
+	if err != nil {
+		return nil, nil, err
+	}
+	newDocumentID, version, err := d.DB.CreateDocument(ctx, documentID, dbFiles)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range files {
+		files[i].DocumentID = *newDocumentID
+		files[i].DocumentVersion = *version
+	}
+	return newDocumentID, version, nil
+}
+
+func (d *dedupDB) UpdateDocument(ctx context.Context, documentID string, files []File) (*int64, error) {
+	dbFiles, err := d.storeContents(ctx, files)
+	if err != nil {
+		return nil, err
+	}
+	version, err := d.DB.UpdateDocument(ctx, documentID, dbFiles)
+	if err != nil {
+		return nil, err
+	}
+	for i := range files {
+		files[i].DocumentID = documentID
+		files[i].DocumentVersion = *version
+	}
+	return version, nil
+}
+
+func (d *dedupDB) ImportDocumentVersion(ctx context.Context, documentID string, documentVersion int64, files []File) error {
+	dbFiles, err := d.storeContents(ctx, files)
+	if err != nil {
+		return err
+	}
+	return d.DB.ImportDocumentVersion(ctx, documentID, documentVersion, dbFiles)
+}
+
+func (d *dedupDB) SetFileContents(ctx context.Context, files []File) error {
+	dbFiles, err := d.storeContents(ctx, files)
+	if err != nil {
+		return err
+	}
+	return d.DB.SetFileContents(ctx, dbFiles)
+}
+
+// DeleteDocument returns the deleted files with their content, contents are only deleted by the next cleanup.
+func (d *dedupDB) DeleteDocument(ctx context.Context, documentID string) (*Document, error) {
+	document, err := d.DB.DeleteDocument(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.loadContents(ctx, document.Files); err != nil {
+		slog.ErrorContext(ctx, "failed to get deleted file contents", slog.String("document_id", documentID), slog.Any("err", err))
+	}
+	return document, nil
+}
+
+func (d *dedupDB) DeleteDocumentVersion(ctx context.Context, documentID string, documentVersion int64) (*Document, error) {
+	document, err := d.DB.DeleteDocumentVersion(ctx, documentID, documentVersion)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.loadContents(ctx, document.Files); err != nil {
+		slog.ErrorContext(ctx, "failed to get deleted file contents", slog.String("document_id", documentID), slog.Any("err", err))
+	}
+	return document, nil
+}
+
+func (d *dedupDB) DeleteExpiredDocuments(ctx context.Context, expireAfter time.Duration) ([]Document, error) {
+	documents, err := d.DB.DeleteExpiredDocuments(ctx, expireAfter)
+	if err != nil {
+		return nil, err
+	}
+	files := make([][]File, len(documents))
+	for i, document := range documents {
+		files[i] = document.Files
+	}
+	if err = d.loadContents(ctx, files...); err != nil {
+		slog.ErrorContext(ctx, "failed to get expired file contents", slog.Any("err", err))
+	}
+	return documents, nil
+}
+
+func (d *dedupDB) GetDocumentFile(ctx context.Context, documentID string, fileName string) (*File, error) {
+	file, err := d.DB.GetDocumentFile(ctx, documentID, fileName)
+	if err != nil {
+		return nil, err
+	}
+	files := []File{*file}
+	if err = d.loadContents(ctx, files); err != nil {
+		return nil, err
+	}
+	return &files[0], nil
+}
+
+func (d *dedupDB) GetDocumentFileVersion(ctx context.Context, documentID string, documentVersion int64, fileName string) (*File, error) {
+	file, err := d.DB.GetDocumentFileVersion(ctx, documentID, documentVersion, fileName)
+	if err != nil {
+		return nil, err
+	}
+	files := []File{*file}
+	if err = d.loadContents(ctx, files); err != nil {
+		return nil, err
+	}
+	return &files[0], nil
+}
@@ -0,0 +1,345 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/topi314/gobin/v3/internal/diff"
+)
+
+var ErrCorruptedDelta = errors.New("content of delta does not match its checksum")
+
+// NewDeltaDB returns a DB which stores the files of new document versions as delta against the file with the same name
+// of the previous version and restores their content on read. Every snapshotInterval versions a file is stored with
+// its full content again, so restoring a file never needs more than snapshotInterval reads. Deltas are only created
+// if they are less than half the size of the content. Files which would lose their base when it is deleted or expires
+// are stored with their full content again before.
+func NewDeltaDB(db DB, snapshotInterval int) DB {
+	return &deltaDB{
+		DB:               db,
+		snapshotInterval: snapshotInterval,
+	}
+}
+
+type deltaDB struct {
+	DB
+	snapshotInterval int
+}
+
+type deltaKey struct {
+	version int64
+	name    string
+}
+
+// restoredFile is a file with its full content and the number of deltas which were applied to restore it.
+type restoredFile struct {
+	file  File
+	depth int
+}
+
+// restore replaces the deltas of the files with their full content. Restored files are added to restored, so bases
+// which are shared by many files are only restored once.
+func (d *deltaDB) restore(ctx context.Context, files []File, restored map[deltaKey]restoredFile) error {
+	for i := range files {
+		if files[i].DeltaBase == 0 {
+			continue
+		}
+		file, err := d.restoreFile(ctx, files[i], restored)
+		if err != nil {
+			return err
+		}
+		files[i] = file.file
+	}
+	return nil
+}
+
+func (d *deltaDB) restoreFile(ctx context.Context, file File, restored map[deltaKey]restoredFile) (restoredFile, error) {
+	key := deltaKey{version: file.DocumentVersion, name: file.Name}
+	if restoredFile, ok := restored[key]; ok {
+		return restoredFile, nil
+	}
+	if file.DeltaBase == 0 {
+		return restoredFile{file: file}, nil
+	}
+
+	base, ok := restored[deltaKey{version: file.DeltaBase, name: file.Name}]
+	if !ok {
+		baseFile, err := d.DB.GetDocumentFileVersion(ctx, file.DocumentID, file.DeltaBase, file.Name)
+		if err != nil {
+			return restoredFile{}, fmt.Errorf("failed to get delta base of %s: %w", file.Name, err)
+		}
+		if base, err = d.restoreFile(ctx, *baseFile, restored); err != nil {
+			return restoredFile{}, err
+		}
+	}
+
+	content, err := diff.Patch(base.file.Content, file.Content)
+	if err != nil {
+		return restoredFile{}, fmt.Errorf("failed to restore delta of %s: %w", file.Name, err)
+	}
+	if file.SHA256 != "" && Checksum(content) != file.SHA256 {
+		return restoredFile{}, ErrCorruptedDelta
+	}
+	file.Content = content
+	file.DeltaBase = 0
+
+	restoredFile := restoredFile{file: file, depth: base.depth + 1}
+	if restored != nil {
+		restored[key] = restoredFile
+	}
+	return restoredFile, nil
+}
+
+// encode returns copies of the files where every file with a suitable base in the latest version is a delta.
+func (d *deltaDB) encode(ctx context.Context, documentID string, files []File) ([]File, error) {
+	setChecksums(files)
+	latest, err := d.DB.GetDocument(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	restored := make(map[deltaKey]restoredFile)
+	if err = d.restore(ctx, latest, restored); err != nil {
+		return nil, err
+	}
+
+	dbFiles := make([]File, len(files))
+	for i, file := range files {
+		dbFiles[i] = file
+		if file.Content == "" || file.Encrypted {
+			continue
+		}
+		for _, baseFile := range latest {
+			if baseFile.Name != file.Name {
+				continue
+			}
+			base, _ := d.restoreFile(ctx, baseFile, restored)
+			if !d.isDeltaBase(file, base) {
+				break
+			}
+			if delta := diff.Delta(base.file.Content, file.Content); len(delta) < len(file.Content)/2 {
+				dbFiles[i].Content = delta
+				dbFiles[i].DeltaBase = base.file.DocumentVersion
+			}
+			break
+		}
+	}
+	return dbFiles, nil
+}
+
+// isDeltaBase returns whether the file can be stored as delta against the base. The base must not expire before the
+// file and the last snapshot must be less than the snapshot interval away.
+func (d *deltaDB) isDeltaBase(file File, base restoredFile) bool {
+	if base.file.Encrypted || base.file.Content == "" || base.depth+1 >= d.snapshotInterval {
+		return false
+	}
+	if base.file.ExpiresAt == nil {
+		return true
+	}
+	return file.ExpiresAt != nil && !file.ExpiresAt.After(*base.file.ExpiresAt)
+}
+
+// snapshot stores the files with their full content again, it is called before their bases are deleted.
+func (d *deltaDB) snapshot(ctx context.Context, files []File) error {
+	if len(files) == 0 {
+		return nil
+	}
+	for i := range files {
+		file, err := d.DB.GetDocumentFileVersion(ctx, files[i].DocumentID, files[i].DocumentVersion, files[i].Name)
+		if err != nil {
+			return fmt.Errorf("failed to get delta file %s: %w", files[i].Name, err)
+		}
+		restored, err := d.restoreFile(ctx, *file, nil)
+		if err != nil {
+			return err
+		}
+		files[i] = restored.file
+	}
+	return d.DB.SetFileContents(ctx, files)
+}
+
+// snapshotDependents stores the files with their full content whose base matches.
+func (d *deltaDB) snapshotDependents(ctx context.Context, documentID string, isBase func(file File) bool) error {
+	deltaFiles, err := d.DB.GetDeltaFiles(ctx, documentID)
+	if err != nil {
+		return err
+	}
+	var dependents []File
+	for _, file := range deltaFiles {
+		if isBase(file) {
+			dependents = append(dependents, file)
+		}
+	}
+	return d.snapshot(ctx, dependents)
+}
+
+func (d *deltaDB) GetDocument(ctx context.Context, documentID string) ([]File, error) {
+	files, err := d.DB.GetDocument(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.restore(ctx, files, nil); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (d *deltaDB) GetDocumentVersion(ctx context.Context, documentID string, documentVersion int64) ([]File, error) {
+	files, err := d.DB.GetDocumentVersion(ctx, documentID, documentVersion)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.restore(ctx, files, nil); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (d *deltaDB) GetDocumentVersionsWithFiles(ctx context.Context, documentID string, withContent bool) (map[int64][]File, error) {
+	versions, err := d.DB.GetDocumentVersionsWithFiles(ctx, documentID, withContent)
+	if err != nil || !withContent {
+		return versions, err
+	}
+
+	// the bases are in the versions too
+	restored := make(map[deltaKey]restoredFile)
+	for _, files := range versions {
+		for _, file := range files {
+			if file.DeltaBase == 0 {
+				restored[deltaKey{version: file.DocumentVersion, name: file.Name}] = restoredFile{file: file}
+			}
+		}
+	}
+	for _, files := range versions {
+		if err = d.restore(ctx, files, restored); err != nil {
+			return nil, err
+		}
+	}
+	return versions, nil
+}
+
+func (d *deltaDB) UpdateDocument(ctx context.Context, documentID string, files []File) (*int64, error) {
+	dbFiles, err := d.encode(ctx, documentID, files)
+	if err != nil {
+		return nil, err
+	}
+	version, err := d.DB.UpdateDocument(ctx, documentID, dbFiles)
+	if err != nil {
+		return nil, err
+	}
+	for i := range files {
+		files[i].DocumentID = documentID
+		files[i].DocumentVersion = *version
+	}
+	return version, nil
+}
+
+// DeleteDocument returns the files of the latest version with their content, their bases are deleted too.
+func (d *deltaDB) DeleteDocument(ctx context.Context, documentID string) (*Document, error) {
+	latest, err := d.GetDocument(ctx, documentID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	document, err := d.DB.DeleteDocument(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	for i, file := range document.Files {
+		if file.DeltaBase == 0 {
+			continue
+		}
+		document.Files[i].Content = ""
+		for _, latestFile := range latest {
+			if latestFile.Name == file.Name && latestFile.DocumentVersion == file.DocumentVersion {
+				document.Files[i] = latestFile
+			}
+		}
+	}
+	return document, nil
+}
+
+func (d *deltaDB) DeleteDocumentVersion(ctx context.Context, documentID string, documentVersion int64) (*Document, error) {
+	if err := d.snapshotDependents(ctx, documentID, func(file File) bool {
+		return file.DeltaBase == documentVersion
+	}); err != nil {
+		return nil, err
+	}
+	document, err := d.DB.DeleteDocumentVersion(ctx, documentID, documentVersion)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.restore(ctx, document.Files, nil); err != nil {
+		slog.ErrorContext(ctx, "failed to restore deleted file contents", slog.String("document_id", documentID), slog.Any("err", err))
+	}
+	return document, nil
+}
+
+func (d *deltaDB) DeleteExpiredDocuments(ctx context.Context, expireAfter time.Duration) ([]Document, error) {
+	files, err := d.DB.GetExpiredDeltaBaseFiles(ctx, expireAfter)
+	if err != nil {
+		return nil, err
+	}
+	// files which expire too are restored as well, so their content is returned
+	if err = d.snapshot(ctx, files); err != nil {
+		return nil, err
+	}
+
+	documents, err := d.DB.DeleteExpiredDocuments(ctx, expireAfter)
+	if err != nil {
+		return nil, err
+	}
+	for _, document := range documents {
+		if err = d.restore(ctx, document.Files, nil); err != nil {
+			slog.ErrorContext(ctx, "failed to restore expired file contents", slog.String("document_id", document.ID), slog.Any("err", err))
+		}
+	}
+	return documents, nil
+}
+
+func (d *deltaDB) ApplyTombstone(ctx context.Context, tombstone Tombstone) error {
+	if err := d.snapshotDependents(ctx, tombstone.DocumentID, func(file File) bool {
+		if tombstone.DocumentVersion == 0 {
+			return file.DeltaBase < tombstone.DeletedAt.UnixMilli() && file.DocumentVersion >= tombstone.DeletedAt.UnixMilli()
+		}
+		return file.DeltaBase == tombstone.DocumentVersion
+	}); err != nil {
+		return err
+	}
+	return d.DB.ApplyTombstone(ctx, tombstone)
+}
+
+func (d *deltaDB) GetDocumentFile(ctx context.Context, documentID string, fileName string) (*File, error) {
+	file, err := d.DB.GetDocumentFile(ctx, documentID, fileName)
+	if err != nil {
+		return nil, err
+	}
+	restored, err := d.restoreFile(ctx, *file, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &restored.file, nil
+}
+
+func (d *deltaDB) GetDocumentFileVersion(ctx context.Context, documentID string, documentVersion int64, fileName string) (*File, error) {
+	file, err := d.DB.GetDocumentFileVersion(ctx, documentID, documentVersion, fileName)
+	if err != nil {
+		return nil, err
+	}
+	restored, err := d.restoreFile(ctx, *file, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &restored.file, nil
+}
+
+func (d *deltaDB) DeleteDocumentVersionFile(ctx context.Context, documentID string, documentVersion int64, fileName string) error {
+	if err := d.snapshotDependents(ctx, documentID, func(file File) bool {
+		return file.DeltaBase == documentVersion && file.Name == fileName
+	}); err != nil {
+		return err
+	}
+	return d.DB.DeleteDocumentVersionFile(ctx, documentID, documentVersion, fileName)
+}
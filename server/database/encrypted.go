@@ -0,0 +1,251 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/topi314/gobin/v3/internal/crypt"
+)
+
+// NewEncryptedDB returns a DB which encrypts the content of document files and revisions before it's stored in the
+// database. Files created before the content was encrypted keep their plaintext content, which is returned as it is.
+// Empty contents are not encrypted, so the storage DB can still tell which contents are in the storage.
+func NewEncryptedDB(db DB, envelope *crypt.Envelope) DB {
+	return &encryptedDB{
+		DB:       db,
+		envelope: envelope,
+	}
+}
+
+type encryptedDB struct {
+	DB
+	envelope *crypt.Envelope
+}
+
+// encryptContents returns copies of the files with encrypted contents, the checksums are set from the plaintext.
+func (d *encryptedDB) encryptContents(ctx context.Context, files []File) ([]File, error) {
+	setChecksums(files)
+	newFiles := make([]File, len(files))
+	for i, file := range files {
+		if file.Content != "" {
+			content, err := d.envelope.Encrypt(ctx, file.Content)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encrypt file content: %w", err)
+			}
+			file.Content = content
+		}
+		newFiles[i] = file
+	}
+	return newFiles, nil
+}
+
+func (d *encryptedDB) decryptContents(ctx context.Context, files []File) error {
+	for i, file := range files {
+		content, err := d.envelope.Decrypt(ctx, file.Content)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt file content: %w", err)
+		}
+		files[i].Content = content
+	}
+	return nil
+}
+
+func (d *encryptedDB) decryptRevisionContents(ctx context.Context, files []RevisionFile) error {
+	for i, file := range files {
+		content, err := d.envelope.Decrypt(ctx, file.Content)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt revision content: %w", err)
+		}
+		files[i].Content = content
+	}
+	return nil
+}
+
+func (d *encryptedDB) GetDocument(ctx context.Context, documentID string) ([]File, error) {
+	files, err := d.DB.GetDocument(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.decryptContents(ctx, files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (d *encryptedDB) GetDocumentVersion(ctx context.Context, documentID string, documentVersion int64) ([]File, error) {
+	files, err := d.DB.GetDocumentVersion(ctx, documentID, documentVersion)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.decryptContents(ctx, files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (d *encryptedDB) GetDocumentVersionsWithFiles(ctx context.Context, documentID string, withContent bool) (map[int64][]File, error) {
+	versions, err := d.DB.GetDocumentVersionsWithFiles(ctx, documentID, withContent)
+	if err != nil || !withContent {
+		return versions, err
+	}
+	for _, files := range versions {
+		if err = d.decryptContents(ctx, files); err != nil {
+			return nil, err
+		}
+	}
+	return versions, nil
+}
+
+func (d *encryptedDB) CreateDocument(ctx context.Context, documentID string, files []File) (*string, *int64, error) {
+	dbFiles, err := d.encryptContents(ctx, files)
+	if err != nil {
+		return nil, nil, err
+	}
+	newDocumentID, version, err := d.DB.CreateDocument(ctx, documentID, dbFiles)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range files {
+		files[i].DocumentID = *newDocumentID
+		files[i].DocumentVersion = *version
+	}
+	return newDocumentID, version, nil
+}
+
+func (d *encryptedDB) UpdateDocument(ctx context.Context, documentID string, files []File) (*int64, error) {
+	dbFiles, err := d.encryptContents(ctx, files)
+	if err != nil {
+		return nil, err
+	}
+	version, err := d.DB.UpdateDocument(ctx, documentID, dbFiles)
+	if err != nil {
+		return nil, err
+	}
+	for i := range files {
+		files[i].DocumentID = documentID
+		files[i].DocumentVersion = *version
+	}
+	return version, nil
+}
+
+func (d *encryptedDB) ImportDocumentVersion(ctx context.Context, documentID string, documentVersion int64, files []File) error {
+	dbFiles, err := d.encryptContents(ctx, files)
+	if err != nil {
+		return err
+	}
+	return d.DB.ImportDocumentVersion(ctx, documentID, documentVersion, dbFiles)
+}
+
+func (d *encryptedDB) SetFileContents(ctx context.Context, files []File) error {
+	dbFiles, err := d.encryptContents(ctx, files)
+	if err != nil {
+		return err
+	}
+	return d.DB.SetFileContents(ctx, dbFiles)
+}
+
+func (d *encryptedDB) DeleteDocument(ctx context.Context, documentID string) (*Document, error) {
+	document, err := d.DB.DeleteDocument(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.decryptContents(ctx, document.Files); err != nil {
+		slog.ErrorContext(ctx, "failed to decrypt deleted file contents", slog.String("document_id", documentID), slog.Any("err", err))
+	}
+	return document, nil
+}
+
+func (d *encryptedDB) DeleteDocumentVersion(ctx context.Context, documentID string, documentVersion int64) (*Document, error) {
+	document, err := d.DB.DeleteDocumentVersion(ctx, documentID, documentVersion)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.decryptContents(ctx, document.Files); err != nil {
+		slog.ErrorContext(ctx, "failed to decrypt deleted file contents", slog.String("document_id", documentID), slog.Any("err", err))
+	}
+	return document, nil
+}
+
+func (d *encryptedDB) DeleteExpiredDocuments(ctx context.Context, expireAfter time.Duration) ([]Document, error) {
+	documents, err := d.DB.DeleteExpiredDocuments(ctx, expireAfter)
+	if err != nil {
+		return nil, err
+	}
+	for _, document := range documents {
+		if err = d.decryptContents(ctx, document.Files); err != nil {
+			slog.ErrorContext(ctx, "failed to decrypt expired file contents", slog.String("document_id", document.ID), slog.Any("err", err))
+		}
+	}
+	return documents, nil
+}
+
+func (d *encryptedDB) GetDocumentFile(ctx context.Context, documentID string, fileName string) (*File, error) {
+	file, err := d.DB.GetDocumentFile(ctx, documentID, fileName)
+	if err != nil {
+		return nil, err
+	}
+	files := []File{*file}
+	if err = d.decryptContents(ctx, files); err != nil {
+		return nil, err
+	}
+	return &files[0], nil
+}
+
+func (d *encryptedDB) GetDocumentFileVersion(ctx context.Context, documentID string, documentVersion int64, fileName string) (*File, error) {
+	file, err := d.DB.GetDocumentFileVersion(ctx, documentID, documentVersion, fileName)
+	if err != nil {
+		return nil, err
+	}
+	files := []File{*file}
+	if err = d.decryptContents(ctx, files); err != nil {
+		return nil, err
+	}
+	return &files[0], nil
+}
+
+func (d *encryptedDB) GetRevisions(ctx context.Context, documentID string) ([]RevisionFile, error) {
+	files, err := d.DB.GetRevisions(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.decryptRevisionContents(ctx, files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (d *encryptedDB) GetRevision(ctx context.Context, documentID string, revision int64) ([]RevisionFile, error) {
+	files, err := d.DB.GetRevision(ctx, documentID, revision)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.decryptRevisionContents(ctx, files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (d *encryptedDB) CreateRevision(ctx context.Context, documentID string, baseVersion int64, files []File) (*int64, error) {
+	dbFiles, err := d.encryptContents(ctx, files)
+	if err != nil {
+		return nil, err
+	}
+	return d.DB.CreateRevision(ctx, documentID, baseVersion, dbFiles)
+}
+
+// SearchDocuments only finds encrypted files by their name, the snippets of encrypted contents are removed.
+func (d *encryptedDB) SearchDocuments(ctx context.Context, query string, creatorID string, documentIDs []string, limit int) ([]SearchResult, error) {
+	results, err := d.DB.SearchDocuments(ctx, query, creatorID, documentIDs, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i, result := range results {
+		if strings.Contains(result.Snippet, crypt.Prefix) {
+			results[i].Snippet = ""
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	randv2 "math/rand/v2"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// maxKeyAttempts is how often a new document key is generated if the previous one is already used.
+const maxKeyAttempts = 10
+
+var ErrDocumentKeyCollision = errors.New("failed to generate an unused document key")
+
+type KeyStrategy string
+
+const (
+	// KeyStrategyRandom generates keys of random lowercase letters and numbers like "a1b2c3d4".
+	KeyStrategyRandom KeyStrategy = "random"
+	// KeyStrategyUUIDv7 generates time ordered UUIDs like "0190b6a2-6f5e-7c3b-9a1d-2f4e6b8c0d1e".
+	KeyStrategyUUIDv7 KeyStrategy = "uuidv7"
+	// KeyStrategyNanoID generates keys of random URL safe characters like "V1StGXR8_Z5jdHi6B-myT".
+	KeyStrategyNanoID KeyStrategy = "nanoid"
+	// KeyStrategyWords generates readable keys of an adjective, a noun and a number like "brave-otter-42".
+	KeyStrategyWords KeyStrategy = "words"
+	// KeyStrategySequential generates keys of a sequence number followed by a hash of it like "1ak3f9", the hash makes
+	// the keys hard to enumerate if the key salt is secret.
+	KeyStrategySequential KeyStrategy = "sequential"
+)
+
+const nanoIDChars = "useandom-26T198340PX75pxJACKVERYMINDBUSHWOLF_GQZbfghjklqvwyzrict"
+
+// newKeyGenerator returns the generator of the key strategy, the length is the default length of the strategy if 0.
+func newKeyGenerator(cfg Config) (*keyGenerator, error) {
+	g := &keyGenerator{
+		strategy: cfg.KeyStrategy,
+		length:   cfg.KeyLength,
+		salt:     cfg.KeySalt,
+	}
+	var defaultLength int
+	switch g.strategy {
+	case "", KeyStrategyRandom:
+		g.strategy = KeyStrategyRandom
+		defaultLength = 8
+	case KeyStrategyNanoID:
+		defaultLength = 21
+	case KeyStrategySequential:
+		defaultLength = 4
+	case KeyStrategyUUIDv7, KeyStrategyWords:
+	default:
+		return nil, fmt.Errorf("invalid key strategy %q, must be one of: random, uuidv7, nanoid, words, sequential", cfg.KeyStrategy)
+	}
+	if g.length <= 0 {
+		g.length = defaultLength
+	}
+	return g, nil
+}
+
+type keyGenerator struct {
+	strategy KeyStrategy
+	length   int
+	salt     string
+}
+
+// generate returns a new document key, nextSequence returns the next number of the sequence of the database.
+func (g *keyGenerator) generate(ctx context.Context, nextSequence func(ctx context.Context) (int64, error)) (string, error) {
+	switch g.strategy {
+	case KeyStrategyUUIDv7:
+		id, err := uuid.NewV7()
+		if err != nil {
+			return "", err
+		}
+		return id.String(), nil
+	case KeyStrategyNanoID:
+		b := make([]byte, g.length)
+		for i := range b {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(nanoIDChars))))
+			if err != nil {
+				return "", err
+			}
+			b[i] = nanoIDChars[n.Int64()]
+		}
+		return string(b), nil
+	case KeyStrategyWords:
+		return fmt.Sprintf("%s-%s-%d",
+			keyAdjectives[randv2.IntN(len(keyAdjectives))],
+			keyNouns[randv2.IntN(len(keyNouns))],
+			randv2.IntN(100),
+		), nil
+	case KeyStrategySequential:
+		sequence, err := nextSequence(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to get next key sequence: %w", err)
+		}
+		sum := sha256.Sum256([]byte(g.salt + strconv.FormatInt(sequence, 10)))
+		hash := make([]rune, g.length)
+		for i := range hash {
+			hash[i] = chars[int(sum[i%len(sum)])%len(chars)]
+		}
+		return strconv.FormatInt(sequence, 36) + string(hash), nil
+	default:
+		return randomString(g.length), nil
+	}
+}
+
+var keyAdjectives = []string{
+	"able", "agile", "amber", "ancient", "arctic", "bold", "brave", "bright", "brisk", "calm",
+	"clever", "cosmic", "crisp", "curious", "daring", "dusty", "eager", "early", "electric", "fancy",
+	"fearless", "fluffy", "frosty", "gentle", "giant", "gleaming", "golden", "grand", "happy", "hidden",
+	"humble", "icy", "jolly", "keen", "kind", "lively", "lucky", "lunar", "mellow", "mighty",
+	"misty", "modest", "noble", "nimble", "odd", "orange", "patient", "plucky", "polite", "proud",
+	"purple", "quick", "quiet", "rapid", "rare", "red", "rusty", "shiny", "silent", "silver",
+	"sleepy", "smooth", "snowy", "solar", "sunny", "swift", "tidy", "tiny", "tough", "tranquil",
+	"vivid", "wandering", "warm", "wild", "wise", "witty", "young", "zealous", "zesty", "zippy",
+}
+
+var keyNouns = []string{
+	"badger", "bear", "beaver", "bison", "cactus", "canyon", "cedar", "cheetah", "comet", "coral",
+	"crane", "dolphin", "dragon", "eagle", "falcon", "fern", "finch", "fox", "gecko", "glacier",
+	"heron", "harbor", "island", "jaguar", "koala", "lagoon", "lemur", "lion", "lynx", "maple",
+	"meadow", "meteor", "moose", "narwhal", "nebula", "ocean", "orca", "otter", "owl", "panda",
+	"panther", "parrot", "pebble", "pelican", "penguin", "pine", "planet", "puffin", "quail", "rabbit",
+	"raven", "reef", "river", "robin", "salmon", "seal", "shark", "sparrow", "spruce", "squirrel",
+	"star", "stork", "summit", "swan", "tiger", "toucan", "tulip", "turtle", "valley", "walrus",
+	"whale", "willow", "wolf", "wombat", "yak", "zebra", "acorn", "breeze", "canoe", "delta",
+}
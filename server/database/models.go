@@ -10,8 +10,27 @@ type File struct {
 	Name            string     `db:"name"`
 	Content         string     `db:"content"`
 	Language        string     `db:"language"`
+	Encrypted       bool       `db:"encrypted"`
 	ExpiresAt       *time.Time `db:"expires_at"`
 	OrderIndex      int        `db:"order_index"`
+	// SHA256 is the hex encoded checksum of the content, it is empty for files created before checksums were stored.
+	SHA256 string `db:"sha256"`
+	// DeltaBase is the version of the file with the same name the content is a delta against, see NewDeltaDB.
+	DeltaBase int64 `db:"delta_base"`
+}
+
+// FileContent is a content which is stored once for all files with its checksum, see NewDedupDB.
+type FileContent struct {
+	SHA256    string    `db:"sha256"`
+	Content   string    `db:"content"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// DocumentVersion is a version of a document with the size of the contents of its files stored in the database.
+type DocumentVersion struct {
+	DocumentID      string `db:"document_id"`
+	DocumentVersion int64  `db:"document_version"`
+	Size            int64  `db:"size"`
 }
 
 type Document struct {
@@ -20,20 +39,342 @@ type Document struct {
 	Files   []File
 }
 
+const (
+	TombstoneReasonDeleted = "deleted"
+	TombstoneReasonExpired = "expired"
+)
+
+// Tombstone records a deleted document version, so restoring an older backup doesn't bring it back. A DocumentVersion
+// of 0 stands for the whole document and covers all versions created before DeletedAt.
+type Tombstone struct {
+	DocumentID      string    `db:"document_id"`
+	DocumentVersion int64     `db:"document_version"`
+	DeletedAt       time.Time `db:"deleted_at"`
+	Reason          string    `db:"reason"`
+}
+
 type Webhook struct {
 	ID         string `db:"id"`
 	DocumentID string `db:"document_id"`
-	URL        string `db:"url"`
+	// AccountID is only set for account webhooks, they receive the events of all documents of the account.
+	AccountID string `db:"account_id"`
+	URL       string `db:"url"`
+	// Secret is encrypted, webhooks are looked up by the SecretHash.
 	Secret     string `db:"secret"`
+	SecretHash string `db:"secret_hash"`
 	Events     string `db:"events"`
+	// ClientCertificate is the encrypted PEM of the client certificate and key used for mutual TLS.
+	ClientCertificate string `db:"client_certificate"`
+	// Enabled is false while deliveries are paused, DisabledReason is set when the receiver disabled the webhook.
+	Enabled        bool   `db:"enabled"`
+	DisabledReason string `db:"disabled_reason"`
+}
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is a webhook event which is stored before it is sent, so it survives restarts of the server. The url
+// and secret are copied from the webhook since delete events are sent after the webhook is deleted.
+type WebhookDelivery struct {
+	ID         string    `db:"id"`
+	WebhookID  string    `db:"webhook_id"`
+	DocumentID string    `db:"document_id"`
+	URL        string    `db:"url"`
+	Secret     string    `db:"secret"`
+	Event      string    `db:"event"`
+	Payload    string    `db:"payload"`
+	Status     string    `db:"status"`
+	Attempts   int       `db:"attempts"`
+	CreatedAt  time.Time `db:"created_at"`
+	// ClientCertificate is copied from the webhook like the url and secret.
+	ClientCertificate string `db:"client_certificate"`
+}
+
+type WebhookDeliveryAttempt struct {
+	ID         int64     `db:"id"`
+	DeliveryID string    `db:"delivery_id"`
+	StatusCode int       `db:"status_code"`
+	Error      string    `db:"error"`
+	CreatedAt  time.Time `db:"created_at"`
 }
 
 type WebhookUpdate struct {
 	ID         string `db:"id"`
 	DocumentID string `db:"document_id"`
-	Secret     string `db:"secret"`
+	AccountID  string `db:"account_id"`
+	SecretHash string `db:"secret_hash"`
+
+	NewURL        string `db:"new_url"`
+	NewSecret     string `db:"new_secret"`
+	NewSecretHash string `db:"new_secret_hash"`
+	NewEvents     string `db:"new_events"`
+	// NewEnabled keeps the current state if nil, enabling the webhook clears its disabled reason.
+	NewEnabled *bool `db:"new_enabled"`
+}
+
+type Event struct {
+	ID              int64     `db:"id"`
+	DocumentID      string    `db:"document_id"`
+	DocumentVersion int64     `db:"document_version"`
+	Event           string    `db:"event"`
+	Data            string    `db:"data"`
+	CreatedAt       time.Time `db:"created_at"`
+}
+
+type Summary struct {
+	DocumentID      string    `db:"document_id"`
+	DocumentVersion int64     `db:"document_version"`
+	Summary         string    `db:"summary"`
+	CreatedAt       time.Time `db:"created_at"`
+}
+
+// VersionMessage describes the changes of a document version like a commit message.
+type VersionMessage struct {
+	DocumentID      string `db:"document_id"`
+	DocumentVersion int64  `db:"document_version"`
+	Message         string `db:"message"`
+}
+
+// FileSignature is a verified detached signature of a file version.
+type FileSignature struct {
+	DocumentID      string    `db:"document_id"`
+	DocumentVersion int64     `db:"document_version"`
+	FileName        string    `db:"file_name"`
+	Format          string    `db:"format"`
+	PublicKey       string    `db:"public_key"`
+	Signature       string    `db:"signature"`
+	KeyID           string    `db:"key_id"`
+	Comment         string    `db:"comment"`
+	CreatedAt       time.Time `db:"created_at"`
+}
+
+// Fork links a document to the document version it was forked from. MergedVersion is the last version of the fork
+// which was merged back into the parent, or 0.
+type Fork struct {
+	DocumentID    string `db:"document_id"`
+	ParentID      string `db:"parent_id"`
+	ParentVersion int64  `db:"parent_version"`
+	MergedVersion int64  `db:"merged_version"`
+}
+
+// DocumentPart links a document to the first document of content which was too large for a single document and was
+// split into parts. The first document is the index and part 1, it has no DocumentPart itself.
+type DocumentPart struct {
+	DocumentID string `db:"document_id"`
+	IndexID    string `db:"index_id"`
+	PartIndex  int    `db:"part_index"`
+}
+
+// DocumentLock is an advisory lock of a document, only requests with its id can create new versions until it expires.
+type DocumentLock struct {
+	DocumentID string    `db:"document_id"`
+	ID         string    `db:"id"`
+	Holder     string    `db:"holder"`
+	CreatedAt  time.Time `db:"created_at"`
+	ExpiresAt  time.Time `db:"expires_at"`
+}
+
+// DocumentTag is a tag of a document, documents are listed and mirrored by their tags.
+type DocumentTag struct {
+	DocumentID string `db:"document_id"`
+	Tag        string `db:"tag"`
+}
+
+// Search highlights are marked with these control characters in SearchResult.Snippet.
+const (
+	SearchHighlightStart = "\x02"
+	SearchHighlightEnd   = "\x03"
+)
+
+type SearchResult struct {
+	DocumentID      string  `db:"document_id"`
+	DocumentVersion int64   `db:"document_version"`
+	Name            string  `db:"name"`
+	Language        string  `db:"language"`
+	Snippet         string  `db:"snippet"`
+	Rank            float64 `db:"rank"`
+}
+
+// RevisionFile is a file of a pending revision of a protected document. BaseVersion is the latest version of the
+// document when the revision was submitted.
+type RevisionFile struct {
+	DocumentID  string     `db:"document_id"`
+	Revision    int64      `db:"revision"`
+	BaseVersion int64      `db:"base_version"`
+	Name        string     `db:"name"`
+	Content     string     `db:"content"`
+	Language    string     `db:"language"`
+	Encrypted   bool       `db:"encrypted"`
+	ExpiresAt   *time.Time `db:"expires_at"`
+	OrderIndex  int        `db:"order_index"`
+}
+
+const (
+	DeviceAuthorizationPending  = "pending"
+	DeviceAuthorizationApproved = "approved"
+	DeviceAuthorizationDenied   = "denied"
+)
+
+// DeviceAuthorization is a pending CLI login. Permissions is a comma separated list of the requested permissions and
+// Tokens is set to the JSON encoded document tokens once the login is approved.
+type DeviceAuthorization struct {
+	DeviceCode   string     `db:"device_code"`
+	UserCode     string     `db:"user_code"`
+	Permissions  string     `db:"permissions"`
+	Status       string     `db:"status"`
+	Tokens       string     `db:"tokens"`
+	ExpiresAt    time.Time  `db:"expires_at"`
+	LastPolledAt *time.Time `db:"last_polled_at"`
+	// Account is set when the device requests an account token, AccountID is the account which approved it and
+	// TwoFactor whether the browser which approved it logged in with a second factor.
+	Account   bool   `db:"account"`
+	AccountID string `db:"account_id"`
+	TwoFactor bool   `db:"two_factor"`
+}
+
+// CreatorDocument links a document to the anonymous id of the browser which created it.
+type CreatorDocument struct {
+	CreatorID  string    `db:"creator_id"`
+	DocumentID string    `db:"document_id"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+// Account is a user logged in with the OpenID Connect provider, its id is used like the anonymous creator id of a
+// browser.
+type Account struct {
+	ID        string    `db:"id"`
+	Issuer    string    `db:"issuer"`
+	Subject   string    `db:"subject"`
+	Name      string    `db:"name"`
+	Email     string    `db:"email"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// AccountSession is a login of an account in a browser or a token of the account for the CLI and API clients. The id is
+// the jti of the account token, deleting the session revokes the token.
+type AccountSession struct {
+	ID         string    `db:"id"`
+	AccountID  string    `db:"account_id"`
+	Kind       string    `db:"kind"`
+	UserAgent  string    `db:"user_agent"`
+	Address    string    `db:"address"`
+	CreatedAt  time.Time `db:"created_at"`
+	LastUsedAt time.Time `db:"last_used_at"`
+	ExpiresAt  time.Time `db:"expires_at"`
+	// TwoFactor is set if the login was confirmed with a second factor, tokens inherit it from the session which
+	// created them.
+	TwoFactor bool `db:"two_factor"`
+}
+
+// AccountTwoFactor is the authenticator app of an account and the failed attempts to confirm a login.
+type AccountTwoFactor struct {
+	AccountID string `db:"account_id"`
+	// TOTPSecret is encrypted, TOTPEnabled is only set once the first code was confirmed.
+	TOTPSecret   string `db:"totp_secret"`
+	TOTPEnabled  bool   `db:"totp_enabled"`
+	TOTPLastStep int64  `db:"totp_last_step"`
+	// Failures counts the attempts to confirm a login since FailedAt, a successful attempt resets them.
+	Failures int        `db:"failures"`
+	FailedAt *time.Time `db:"failed_at"`
+}
+
+// AccountPasskey is a WebAuthn credential of an account. The id is the base64url encoded credential id and the public
+// key the base64url encoded COSE key.
+type AccountPasskey struct {
+	ID         string     `db:"id"`
+	AccountID  string     `db:"account_id"`
+	Name       string     `db:"name"`
+	PublicKey  string     `db:"public_key"`
+	SignCount  int64      `db:"sign_count"`
+	CreatedAt  time.Time  `db:"created_at"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+}
+
+// SyslogSource is the document the received syslog lines of a host are appended to.
+type SyslogSource struct {
+	Source     string    `db:"source"`
+	DocumentID string    `db:"document_id"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+// UserSettings are the preferences of an anonymous creator id, they are applied to the web UI and to the requests of the
+// creator.
+type UserSettings struct {
+	CreatorID       string    `db:"creator_id"`
+	DefaultStyle    string    `db:"default_style"`
+	DefaultExpiry   string    `db:"default_expiry"`
+	EditorKeymap    string    `db:"editor_keymap"`
+	DefaultLanguage string    `db:"default_language"`
+	UpdatedAt       time.Time `db:"updated_at"`
+}
+
+// DocumentInvite lets users join the access list of a document with the permissions of the invite. Invites with a
+// MaxUses of 0 can be used any number of times.
+type DocumentInvite struct {
+	ID          string     `db:"id"`
+	DocumentID  string     `db:"document_id"`
+	Permissions int64      `db:"permissions"`
+	MaxUses     int64      `db:"max_uses"`
+	Uses        int64      `db:"uses"`
+	ExpiresAt   *time.Time `db:"expires_at"`
+	CreatedAt   time.Time  `db:"created_at"`
+}
+
+// DocumentShareToken is a share token which expires or can only be used a number of times, its ID is the jti claim of
+// the token. Share tokens with a MaxUses of 0 can be used any number of times.
+type DocumentShareToken struct {
+	ID          string     `db:"id"`
+	DocumentID  string     `db:"document_id"`
+	Permissions int64      `db:"permissions"`
+	MaxUses     int64      `db:"max_uses"`
+	Uses        int64      `db:"uses"`
+	ExpiresAt   *time.Time `db:"expires_at"`
+	CreatedAt   time.Time  `db:"created_at"`
+}
+
+// RevokedToken is a token of a document which was revoked. The ID is the jti claim of the token or the hex encoded
+// SHA-256 of tokens without one. ExpiresAt is when the token expires anyway, so it doesn't have to be kept longer.
+type RevokedToken struct {
+	ID         string     `db:"id"`
+	DocumentID string     `db:"document_id"`
+	ExpiresAt  *time.Time `db:"expires_at"`
+	RevokedAt  time.Time  `db:"revoked_at"`
+}
+
+// DocumentMember is an anonymous creator id on the access list of a document.
+type DocumentMember struct {
+	DocumentID  string    `db:"document_id"`
+	CreatorID   string    `db:"creator_id"`
+	Permissions int64     `db:"permissions"`
+	InviteID    string    `db:"invite_id"`
+	JoinedAt    time.Time `db:"joined_at"`
+}
+
+// IngestedObject is an object of the ingest bucket which was turned into a document. The ETag detects new uploads to
+// the same key, DocumentID is empty while the document is created.
+type IngestedObject struct {
+	ObjectKey  string    `db:"object_key"`
+	ETag       string    `db:"etag"`
+	DocumentID string    `db:"document_id"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+// ActivityPubFollower is a fediverse actor which follows the ActivityPub actor of gobin, Inbox is the shared inbox of
+// its server if it has one.
+type ActivityPubFollower struct {
+	ActorID   string    `db:"actor_id"`
+	Inbox     string    `db:"inbox"`
+	CreatedAt time.Time `db:"created_at"`
+}
 
-	NewURL    string `db:"new_url"`
-	NewSecret string `db:"new_secret"`
-	NewEvents string `db:"new_events"`
+// ActivityPubNote is the post which announced a public document, Summary is its content warning.
+type ActivityPubNote struct {
+	DocumentID string    `db:"document_id"`
+	Version    int64     `db:"version"`
+	Summary    string    `db:"summary"`
+	Content    string    `db:"content"`
+	CreatedAt  time.Time `db:"created_at"`
 }
@@ -3,8 +3,8 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -12,17 +12,21 @@ import (
 
 var _ DB = (*postgresDB)(nil)
 
-func newPostgresDB(db *sqlx.DB) *postgresDB {
-	return &postgresDB{db}
+func newPostgresDB(db *sqlx.DB, keys *keyGenerator) *postgresDB {
+	return &postgresDB{
+		DB:   db,
+		keys: keys,
+	}
 }
 
 type postgresDB struct {
 	*sqlx.DB
+	keys *keyGenerator
 }
 
 func (d *postgresDB) GetDocument(ctx context.Context, documentID string) ([]File, error) {
 	var files []File
-	if err := d.SelectContext(ctx, &files, "SELECT name, document_id, document_version, content, language, expires_at from (SELECT *, rank() OVER (PARTITION BY document_id ORDER BY document_version DESC) AS rank FROM files) AS f WHERE document_id = $1 AND rank = 1 ORDER BY order_index;", documentID); err != nil {
+	if err := d.SelectContext(ctx, &files, "SELECT name, document_id, document_version, content, language, encrypted, expires_at, sha256, delta_base from (SELECT *, rank() OVER (PARTITION BY document_id ORDER BY document_version DESC) AS rank FROM files) AS f WHERE document_id = $1 AND rank = 1 ORDER BY order_index;", documentID); err != nil {
 		return nil, fmt.Errorf("failed to get document: %w", err)
 	}
 
@@ -34,7 +38,7 @@ func (d *postgresDB) GetDocument(ctx context.Context, documentID string) ([]File
 
 func (d *postgresDB) GetDocumentVersion(ctx context.Context, documentID string, documentVersion int64) ([]File, error) {
 	var files []File
-	if err := d.SelectContext(ctx, &files, "SELECT name, document_id, document_version, content, language, expires_at from files WHERE document_id = $1 AND document_version = $2 ORDER BY order_index;", documentID, documentVersion); err != nil {
+	if err := d.SelectContext(ctx, &files, "SELECT name, document_id, document_version, content, language, encrypted, expires_at, sha256, delta_base from files WHERE document_id = $1 AND document_version = $2 ORDER BY order_index;", documentID, documentVersion); err != nil {
 		return nil, fmt.Errorf("failed to get document version: %w", err)
 	}
 
@@ -62,9 +66,9 @@ func (d *postgresDB) GetDocumentVersions(ctx context.Context, documentID string)
 func (d *postgresDB) GetDocumentVersionsWithFiles(ctx context.Context, documentID string, withContent bool) (map[int64][]File, error) {
 	var query string
 	if withContent {
-		query = "SELECT name, document_id, document_version, content, language, expires_at WHERE document_id = $1 ORDER BY document_version DESC;"
+		query = "SELECT name, document_id, document_version, content, language, encrypted, expires_at, sha256, delta_base FROM files WHERE document_id = $1 ORDER BY document_version DESC, order_index;"
 	} else {
-		query = "SELECT name, document_id, document_version, language, expires_at WHERE document_id = $1 ORDER BY document_version DESC;"
+		query = "SELECT name, document_id, document_version, language, encrypted, expires_at, sha256, delta_base FROM files WHERE document_id = $1 ORDER BY document_version DESC, order_index;"
 	}
 
 	var files []File
@@ -84,35 +88,97 @@ func (d *postgresDB) GetDocumentVersionsWithFiles(ctx context.Context, documentI
 
 }
 
-func (d *postgresDB) CreateDocument(ctx context.Context, files []File) (*string, *int64, error) {
-	documentID := randomString(8)
+// CreateDocument creates a document with a generated id if documentID is empty.
+func (d *postgresDB) CreateDocument(ctx context.Context, documentID string, files []File) (*string, *int64, error) {
+	if documentID == "" {
+		var err error
+		if documentID, err = d.newDocumentID(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
 	version := time.Now().UnixMilli()
 	for i := range files {
 		files[i].DocumentID = documentID
 		files[i].DocumentVersion = version
 	}
+	setChecksums(files)
 
-	if _, err := d.NamedExecContext(ctx, "INSERT INTO files (name, document_id, document_version, content, language, expires_at, order_index) VALUES (:name, :document_id, :document_version, :content, :language, :expires_at, :order_index);", files); err != nil {
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO files (name, document_id, document_version, content, language, encrypted, expires_at, sha256, delta_base, order_index) VALUES (:name, :document_id, :document_version, :content, :language, :encrypted, :expires_at, :sha256, :delta_base, :order_index);", files); err != nil {
 		return nil, nil, fmt.Errorf("failed to create document: %w", err)
 	}
 	return &documentID, &version, nil
 }
 
+// newDocumentID generates keys until one is neither used by a document nor claimed, the key is claimed like a custom
+// key so it's never generated again.
+func (d *postgresDB) newDocumentID(ctx context.Context) (string, error) {
+	for range maxKeyAttempts {
+		documentID, err := d.keys.generate(ctx, d.nextKeySequence)
+		if err != nil {
+			return "", err
+		}
+
+		var used bool
+		if err = d.GetContext(ctx, &used, "SELECT EXISTS (SELECT 1 FROM files WHERE document_id = $1);", documentID); err != nil {
+			return "", fmt.Errorf("failed to check document key: %w", err)
+		}
+		if used {
+			continue
+		}
+		if err = d.ClaimCustomDocumentKey(ctx, documentID); errors.Is(err, sql.ErrNoRows) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		return documentID, nil
+	}
+	return "", ErrDocumentKeyCollision
+}
+
+func (d *postgresDB) nextKeySequence(ctx context.Context) (int64, error) {
+	var sequence int64
+	if err := d.GetContext(ctx, &sequence, "SELECT nextval('document_key_sequence');"); err != nil {
+		return 0, err
+	}
+	return sequence, nil
+}
+
 func (d *postgresDB) UpdateDocument(ctx context.Context, documentID string, files []File) (*int64, error) {
 	version := time.Now().UnixMilli()
 	for i := range files {
 		files[i].DocumentID = documentID
 		files[i].DocumentVersion = version
 	}
-	if _, err := d.NamedExecContext(ctx, "INSERT INTO files (name, document_id, document_version, content, language, expires_at) VALUES (:name, :document_id, :document_version, :content, :language, :expires_at);", files); err != nil {
+	setChecksums(files)
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO files (name, document_id, document_version, content, language, encrypted, expires_at, sha256, delta_base, order_index) VALUES (:name, :document_id, :document_version, :content, :language, :encrypted, :expires_at, :sha256, :delta_base, :order_index);", files); err != nil {
 		return nil, fmt.Errorf("failed to update document: %w", err)
 	}
 	return &version, nil
 }
 
+func (d *postgresDB) ImportDocumentVersion(ctx context.Context, documentID string, documentVersion int64, files []File) error {
+	var deleted bool
+	if err := d.GetContext(ctx, &deleted, "SELECT EXISTS (SELECT 1 FROM document_tombstones WHERE document_id = $1 AND (document_version = $2 OR (document_version = 0 AND deleted_at > $3)));", documentID, documentVersion, time.UnixMilli(documentVersion)); err != nil {
+		return fmt.Errorf("failed to check document tombstones: %w", err)
+	}
+	if deleted {
+		return ErrDocumentVersionDeleted
+	}
+
+	for i := range files {
+		files[i].DocumentID = documentID
+		files[i].DocumentVersion = documentVersion
+	}
+	setChecksums(files)
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO files (name, document_id, document_version, content, language, encrypted, expires_at, sha256, delta_base, order_index) VALUES (:name, :document_id, :document_version, :content, :language, :encrypted, :expires_at, :sha256, :delta_base, :order_index) ON CONFLICT DO NOTHING;", files); err != nil {
+		return fmt.Errorf("failed to import document version: %w", err)
+	}
+	return nil
+}
+
 func (d *postgresDB) DeleteDocument(ctx context.Context, documentID string) (*Document, error) {
-	var files []File
-	if err := d.SelectContext(ctx, &files, "DELETE FROM files WHERE document_id = $1 RETURNING *", documentID); err != nil {
+	files, err := deleteFiles(ctx, d.DB, documentTombstone(documentID, TombstoneReasonDeleted), "DELETE FROM files WHERE document_id = $1 RETURNING *", documentID)
+	if err != nil {
 		return nil, fmt.Errorf("failed to delete document: %w", err)
 	}
 
@@ -136,8 +202,8 @@ func (d *postgresDB) DeleteDocument(ctx context.Context, documentID string) (*Do
 }
 
 func (d *postgresDB) DeleteDocumentVersion(ctx context.Context, documentID string, documentVersion int64) (*Document, error) {
-	var files []File
-	if err := d.SelectContext(ctx, &files, "DELETE FROM files WHERE document_id = $1 AND document_version = $2 RETURNING *;", documentID, documentVersion); err != nil {
+	files, err := deleteFiles(ctx, d.DB, versionTombstones(TombstoneReasonDeleted), "DELETE FROM files WHERE document_id = $1 AND document_version = $2 RETURNING *;", documentID, documentVersion)
+	if err != nil {
 		return nil, fmt.Errorf("failed to delete document version: %w", err)
 	}
 
@@ -161,7 +227,7 @@ func (d *postgresDB) DeleteDocumentVersion(ctx context.Context, documentID strin
 }
 
 func (d *postgresDB) DeleteDocumentVersions(ctx context.Context, documentID string) error {
-	if _, err := d.ExecContext(ctx, "DELETE FROM files WHERE document_id = $1;", documentID); err != nil {
+	if _, err := deleteFiles(ctx, d.DB, documentTombstone(documentID, TombstoneReasonDeleted), "DELETE FROM files WHERE document_id = $1 RETURNING *;", documentID); err != nil {
 		return fmt.Errorf("failed to delete document versions: %w", err)
 	}
 	return nil
@@ -176,8 +242,8 @@ func (d *postgresDB) DeleteExpiredDocuments(ctx context.Context, expireAfter tim
 		args = append(args, now.Add(expireAfter).UnixMilli())
 	}
 	query += " RETURNING *;"
-	var files []File
-	if err := d.SelectContext(ctx, &files, query, args...); err != nil {
+	files, err := deleteFiles(ctx, d.DB, versionTombstones(TombstoneReasonExpired), query, args...)
+	if err != nil {
 		return nil, fmt.Errorf("failed to delete expired documents: %w", err)
 	}
 
@@ -205,9 +271,160 @@ func (d *postgresDB) DeleteExpiredDocuments(ctx context.Context, expireAfter tim
 	return documentsSlice, nil
 }
 
+// GetVersionsBeyondLimit returns the oldest versions of documents which have more than maxVersions versions.
+func (d *postgresDB) GetVersionsBeyondLimit(ctx context.Context, maxVersions int, limit int) ([]DocumentVersion, error) {
+	var versions []DocumentVersion
+	if err := d.SelectContext(ctx, &versions, "SELECT document_id, document_version FROM (SELECT document_id, document_version, ROW_NUMBER() OVER (PARTITION BY document_id ORDER BY document_version DESC) AS rank FROM files GROUP BY document_id, document_version) AS v WHERE rank > $1 ORDER BY document_version LIMIT $2;", maxVersions, limit); err != nil {
+		return nil, fmt.Errorf("failed to get versions beyond limit: %w", err)
+	}
+	return versions, nil
+}
+
+// GetDocumentsCreatedBefore returns the ids of the documents whose first version was created before the given time,
+// the oldest documents first.
+func (d *postgresDB) GetDocumentsCreatedBefore(ctx context.Context, before time.Time, limit int) ([]string, error) {
+	var documentIDs []string
+	if err := d.SelectContext(ctx, &documentIDs, "SELECT document_id FROM files GROUP BY document_id HAVING MIN(document_version) < $1 ORDER BY MIN(document_version) LIMIT $2;", before.UnixMilli(), limit); err != nil {
+		return nil, fmt.Errorf("failed to get documents created before: %w", err)
+	}
+	return documentIDs, nil
+}
+
+// GetStorageSize returns the size of the contents of all files stored in the database. Deduplicated contents count for
+// every file which uses them, so deleting a file always lowers the size.
+func (d *postgresDB) GetStorageSize(ctx context.Context) (int64, error) {
+	var size int64
+	if err := d.GetContext(ctx, &size, "SELECT COALESCE(SUM(COALESCE(OCTET_LENGTH(c.content), OCTET_LENGTH(f.content))), 0) FROM files f LEFT JOIN file_contents c ON f.content = '' AND c.sha256 = f.sha256;"); err != nil {
+		return 0, fmt.Errorf("failed to get storage size: %w", err)
+	}
+	return size, nil
+}
+
+// GetOldestVersions returns the oldest versions with their size, versions which are not the latest version of their
+// document come first.
+func (d *postgresDB) GetOldestVersions(ctx context.Context, limit int) ([]DocumentVersion, error) {
+	var versions []DocumentVersion
+	if err := d.SelectContext(ctx, &versions, "SELECT document_id, document_version, size FROM (SELECT f.document_id, f.document_version, SUM(COALESCE(OCTET_LENGTH(c.content), OCTET_LENGTH(f.content))) AS size, ROW_NUMBER() OVER (PARTITION BY f.document_id ORDER BY f.document_version DESC) AS rank FROM files f LEFT JOIN file_contents c ON f.content = '' AND c.sha256 = f.sha256 GROUP BY f.document_id, f.document_version) AS v WHERE size > 0 ORDER BY rank = 1, document_version LIMIT $1;", limit); err != nil {
+		return nil, fmt.Errorf("failed to get oldest versions: %w", err)
+	}
+	return versions, nil
+}
+
+// GetDocumentIDs returns the ids of the documents after the id ordered by their id.
+func (d *postgresDB) GetDocumentIDs(ctx context.Context, afterID string, limit int) ([]string, error) {
+	var documentIDs []string
+	if err := d.SelectContext(ctx, &documentIDs, "SELECT DISTINCT document_id FROM files WHERE document_id > $1 ORDER BY document_id LIMIT $2;", afterID, limit); err != nil {
+		return nil, fmt.Errorf("failed to get document ids: %w", err)
+	}
+	return documentIDs, nil
+}
+
+func (d *postgresDB) GetTombstones(ctx context.Context, since time.Time) ([]Tombstone, error) {
+	var tombstones []Tombstone
+	if err := d.SelectContext(ctx, &tombstones, "SELECT * FROM document_tombstones WHERE deleted_at >= $1 ORDER BY deleted_at, document_id, document_version;", since); err != nil {
+		return nil, fmt.Errorf("failed to get tombstones: %w", err)
+	}
+	return tombstones, nil
+}
+
+// ApplyTombstone records the tombstone and deletes the files it covers, a document tombstone deletes all versions
+// created before it.
+func (d *postgresDB) ApplyTombstone(ctx context.Context, tombstone Tombstone) error {
+	query := "DELETE FROM files WHERE document_id = $1 AND document_version = $2 RETURNING *;"
+	args := []any{tombstone.DocumentID, tombstone.DocumentVersion}
+	if tombstone.DocumentVersion == 0 {
+		query = "DELETE FROM files WHERE document_id = $1 AND document_version < $2 RETURNING *;"
+		args[1] = tombstone.DeletedAt.UnixMilli()
+	}
+	if _, err := deleteFiles(ctx, d.DB, func([]File) []Tombstone { return []Tombstone{tombstone} }, query, args...); err != nil {
+		return fmt.Errorf("failed to apply tombstone: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) DeleteTombstonesBefore(ctx context.Context, before time.Time) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM document_tombstones WHERE deleted_at < $1;", before); err != nil {
+		return fmt.Errorf("failed to delete tombstones: %w", err)
+	}
+	return nil
+}
+
+// GetDeltaFiles returns the files of the document which are stored as delta without their content.
+func (d *postgresDB) GetDeltaFiles(ctx context.Context, documentID string) ([]File, error) {
+	var files []File
+	if err := d.SelectContext(ctx, &files, "SELECT name, document_id, document_version, language, encrypted, expires_at, sha256, delta_base FROM files WHERE document_id = $1 AND delta_base != 0 ORDER BY document_version;", documentID); err != nil {
+		return nil, fmt.Errorf("failed to get delta files: %w", err)
+	}
+	return files, nil
+}
+
+// GetExpiredDeltaBaseFiles returns the files stored as delta without their content whose base is deleted by
+// DeleteExpiredDocuments.
+func (d *postgresDB) GetExpiredDeltaBaseFiles(ctx context.Context, expireAfter time.Duration) ([]File, error) {
+	now := time.Now()
+	condition := "b.expires_at < $1"
+	args := []any{now}
+	if expireAfter > 0 {
+		condition += " OR b.document_version < $2"
+		args = append(args, now.Add(expireAfter).UnixMilli())
+	}
+
+	var files []File
+	if err := d.SelectContext(ctx, &files, "SELECT f.name, f.document_id, f.document_version, f.language, f.encrypted, f.expires_at, f.sha256, f.delta_base FROM files f JOIN files b ON b.document_id = f.document_id AND b.document_version = f.delta_base AND b.name = f.name WHERE "+condition+" ORDER BY f.document_id, f.document_version;", args...); err != nil {
+		return nil, fmt.Errorf("failed to get expired delta base files: %w", err)
+	}
+	return files, nil
+}
+
+// SetFileContents replaces the content of existing files, it is used to store deltas as full content again.
+func (d *postgresDB) SetFileContents(ctx context.Context, files []File) error {
+	for _, file := range files {
+		if _, err := d.NamedExecContext(ctx, "UPDATE files SET content = :content, sha256 = :sha256, delta_base = :delta_base WHERE document_id = :document_id AND document_version = :document_version AND name = :name;", file); err != nil {
+			return fmt.Errorf("failed to set file content: %w", err)
+		}
+	}
+	return nil
+}
+
+func (d *postgresDB) GetFileContents(ctx context.Context, checksums []string) ([]FileContent, error) {
+	if len(checksums) == 0 {
+		return nil, nil
+	}
+	query, args, err := sqlx.In("SELECT * FROM file_contents WHERE sha256 IN (?);", checksums)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build file contents query: %w", err)
+	}
+
+	var contents []FileContent
+	if err = d.SelectContext(ctx, &contents, d.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("failed to get file contents: %w", err)
+	}
+	return contents, nil
+}
+
+// PutFileContents stores the contents which are not stored yet and marks the existing ones as used, so they are not
+// deleted as orphaned before the files referencing them are inserted.
+func (d *postgresDB) PutFileContents(ctx context.Context, contents []FileContent) error {
+	if len(contents) == 0 {
+		return nil
+	}
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO file_contents (sha256, content, updated_at) VALUES (:sha256, :content, :updated_at) ON CONFLICT (sha256) DO UPDATE SET updated_at = excluded.updated_at;", contents); err != nil {
+		return fmt.Errorf("failed to store file contents: %w", err)
+	}
+	return nil
+}
+
+// DeleteOrphanedFileContents deletes the contents which were not used since before and are not referenced by any file.
+func (d *postgresDB) DeleteOrphanedFileContents(ctx context.Context, before time.Time) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM file_contents WHERE updated_at < $1 AND NOT EXISTS (SELECT 1 FROM files WHERE files.sha256 = file_contents.sha256);", before); err != nil {
+		return fmt.Errorf("failed to delete orphaned file contents: %w", err)
+	}
+	return nil
+}
+
 func (d *postgresDB) GetDocumentFile(ctx context.Context, documentID string, fileName string) (*File, error) {
 	var file File
-	if err := d.GetContext(ctx, &file, "SELECT name, document_id, document_version, content, language, expires_at from (SELECT *, rank() OVER (PARTITION BY document_id ORDER BY document_version DESC) AS rank FROM files) AS f WHERE document_id = $1 AND name = $2 AND rank = 1;", documentID, fileName); err != nil {
+	if err := d.GetContext(ctx, &file, "SELECT name, document_id, document_version, content, language, encrypted, expires_at, sha256, delta_base from (SELECT *, rank() OVER (PARTITION BY document_id ORDER BY document_version DESC) AS rank FROM files) AS f WHERE document_id = $1 AND name = $2 AND rank = 1;", documentID, fileName); err != nil {
 		return nil, fmt.Errorf("failed to get document file: %w", err)
 	}
 
@@ -216,7 +433,7 @@ func (d *postgresDB) GetDocumentFile(ctx context.Context, documentID string, fil
 
 func (d *postgresDB) GetDocumentFileVersion(ctx context.Context, documentID string, documentVersion int64, fileName string) (*File, error) {
 	var file File
-	if err := d.GetContext(ctx, &file, "SELECT name, document_id, document_version, content, language, expires_at from files WHERE document_id = $1 AND document_version = $2 AND name = $3;", documentID, documentVersion, fileName); err != nil {
+	if err := d.GetContext(ctx, &file, "SELECT name, document_id, document_version, content, language, encrypted, expires_at, sha256, delta_base from files WHERE document_id = $1 AND document_version = $2 AND name = $3;", documentID, documentVersion, fileName); err != nil {
 		return nil, fmt.Errorf("failed to get document file version: %w", err)
 	}
 
@@ -239,9 +456,9 @@ func (d *postgresDB) DeleteDocumentVersionFile(ctx context.Context, documentID s
 	return nil
 }
 
-func (d *postgresDB) GetWebhook(ctx context.Context, documentID string, webhookID string, secret string) (*Webhook, error) {
+func (d *postgresDB) GetWebhook(ctx context.Context, documentID string, webhookID string, secretHash string) (*Webhook, error) {
 	var webhook Webhook
-	err := d.GetContext(ctx, &webhook, "SELECT * FROM webhooks WHERE document_id = $1 AND id = $2 AND secret = $3", documentID, webhookID, secret)
+	err := d.GetContext(ctx, &webhook, "SELECT * FROM webhooks WHERE document_id = $1 AND id = $2 AND secret_hash = $3", documentID, webhookID, secretHash)
 	if err != nil {
 		return nil, err
 	}
@@ -269,54 +486,304 @@ func (d *postgresDB) GetAndDeleteWebhooksByDocumentID(ctx context.Context, docum
 	return webhooks, nil
 }
 
-func (d *postgresDB) CreateWebhook(ctx context.Context, documentID string, url string, secret string, events []string) (*Webhook, error) {
-	webhook := Webhook{
-		ID:         randomString(8),
-		DocumentID: documentID,
-		URL:        url,
-		Secret:     secret,
-		Events:     strings.Join(events, ","),
-	}
-
-	if _, err := d.NamedExecContext(ctx, "INSERT INTO webhooks (id, document_id, url, secret, events) VALUES (:id, :document_id, :url, :secret, :events)", webhook); err != nil {
+func (d *postgresDB) CreateWebhook(ctx context.Context, webhook Webhook) (*Webhook, error) {
+	webhook.ID = randomString(8)
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO webhooks (id, document_id, url, secret, secret_hash, events, client_certificate, enabled) VALUES (:id, :document_id, :url, :secret, :secret_hash, :events, :client_certificate, :enabled)", webhook); err != nil {
 		return nil, fmt.Errorf("failed to insert webhook: %w", err)
 	}
 
 	return &webhook, nil
 }
 
-func (d *postgresDB) UpdateWebhook(ctx context.Context, documentID string, webhookID string, secret string, newURL string, newSecret string, newEvents []string) (*Webhook, error) {
-	webhookUpdate := WebhookUpdate{
-		ID:         webhookID,
-		DocumentID: documentID,
-		Secret:     secret,
-		NewURL:     newURL,
-		NewSecret:  newSecret,
-		NewEvents:  strings.Join(newEvents, ","),
+// ImportWebhook inserts the webhook with its id, webhooks which already exist are kept.
+func (d *postgresDB) ImportWebhook(ctx context.Context, webhook Webhook) error {
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO webhooks (id, document_id, url, secret, secret_hash, events, client_certificate, enabled, disabled_reason) VALUES (:id, :document_id, :url, :secret, :secret_hash, :events, :client_certificate, :enabled, :disabled_reason) ON CONFLICT DO NOTHING;", webhook); err != nil {
+		return fmt.Errorf("failed to import webhook: %w", err)
 	}
+	return nil
+}
 
+func (d *postgresDB) UpdateWebhook(ctx context.Context, webhookUpdate WebhookUpdate) (*Webhook, error) {
 	query, args, err := sqlx.Named(`UPDATE webhooks SET 
                     url = CASE WHEN :new_url = '' THEN url ELSE :new_url END,
                     secret = CASE WHEN :new_secret = '' THEN secret ELSE :new_secret END,
-                    events = CASE WHEN :new_events = '' THEN events ELSE :new_events END
-                WHERE document_id = :document_id AND id = :id AND secret = :secret returning *`, webhookUpdate)
+                    secret_hash = CASE WHEN :new_secret_hash = '' THEN secret_hash ELSE :new_secret_hash END,
+                    events = CASE WHEN :new_events = '' THEN events ELSE :new_events END,
+                    enabled = COALESCE(:new_enabled, enabled),
+                    disabled_reason = CASE WHEN COALESCE(:new_enabled, false) THEN '' ELSE disabled_reason END
+                WHERE document_id = :document_id AND id = :id AND secret_hash = :secret_hash returning *`, webhookUpdate)
+	if err != nil {
+		return nil, err
+	}
+
+	var webhook Webhook
+	if err = d.GetContext(ctx, &webhook, query, args...); err != nil {
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+// SetWebhookClientCertificate replaces the client certificate of the webhook, an empty client certificate removes it.
+func (d *postgresDB) SetWebhookClientCertificate(ctx context.Context, documentID string, webhookID string, secretHash string, clientCertificate string) (*Webhook, error) {
+	var webhook Webhook
+	if err := d.GetContext(ctx, &webhook, "UPDATE webhooks SET client_certificate = $1 WHERE document_id = $2 AND id = $3 AND secret_hash = $4 RETURNING *", clientCertificate, documentID, webhookID, secretHash); err != nil {
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+// DisableWebhook pauses the deliveries of the webhook, it's called when the receiver responds that it's gone. The
+// webhook is either a webhook of the document or an account webhook of an account which owns the document.
+func (d *postgresDB) DisableWebhook(ctx context.Context, documentID string, webhookID string, reason string) error {
+	if _, err := d.ExecContext(ctx, "UPDATE webhooks SET enabled = false, disabled_reason = $1 WHERE document_id = $2 AND id = $3", reason, documentID, webhookID); err != nil {
+		return err
+	}
+	_, err := d.ExecContext(ctx, "UPDATE account_webhooks SET enabled = false, disabled_reason = $1 WHERE id = $2 AND account_id IN (SELECT account_id FROM account_documents WHERE document_id = $3)", reason, webhookID, documentID)
+	return err
+}
+
+func (d *postgresDB) DeleteWebhook(ctx context.Context, documentID string, webhookID string, secretHash string) error {
+	res, err := d.ExecContext(ctx, "DELETE FROM webhooks WHERE document_id = $1 AND id = $2 AND secret_hash = $3", documentID, webhookID, secretHash)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (d *postgresDB) GetAccountWebhook(ctx context.Context, accountID string, webhookID string) (*Webhook, error) {
+	var webhook Webhook
+	if err := d.GetContext(ctx, &webhook, "SELECT * FROM account_webhooks WHERE account_id = $1 AND id = $2", accountID, webhookID); err != nil {
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+func (d *postgresDB) GetAccountWebhooks(ctx context.Context, accountID string) ([]Webhook, error) {
+	var webhooks []Webhook
+	if err := d.SelectContext(ctx, &webhooks, "SELECT * FROM account_webhooks WHERE account_id = $1 ORDER BY id", accountID); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// GetAccountWebhooksByDocumentID returns the account webhooks of the accounts which own the document, their document id
+// is set to the document.
+func (d *postgresDB) GetAccountWebhooksByDocumentID(ctx context.Context, documentID string) ([]Webhook, error) {
+	var webhooks []Webhook
+	if err := d.SelectContext(ctx, &webhooks, "SELECT account_webhooks.*, account_documents.document_id FROM account_webhooks JOIN account_documents ON account_documents.account_id = account_webhooks.account_id WHERE account_documents.document_id = $1", documentID); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (d *postgresDB) CreateAccountWebhook(ctx context.Context, webhook Webhook) (*Webhook, error) {
+	webhook.ID = randomString(8)
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO account_webhooks (id, account_id, url, secret, secret_hash, events, client_certificate, enabled) VALUES (:id, :account_id, :url, :secret, :secret_hash, :events, :client_certificate, :enabled)", webhook); err != nil {
+		return nil, fmt.Errorf("failed to insert account webhook: %w", err)
+	}
+
+	return &webhook, nil
+}
+
+func (d *postgresDB) UpdateAccountWebhook(ctx context.Context, webhookUpdate WebhookUpdate) (*Webhook, error) {
+	query, args, err := sqlx.Named(`UPDATE account_webhooks SET 
+                    url = CASE WHEN :new_url = '' THEN url ELSE :new_url END,
+                    secret = CASE WHEN :new_secret = '' THEN secret ELSE :new_secret END,
+                    secret_hash = CASE WHEN :new_secret_hash = '' THEN secret_hash ELSE :new_secret_hash END,
+                    events = CASE WHEN :new_events = '' THEN events ELSE :new_events END,
+                    enabled = COALESCE(:new_enabled, enabled),
+                    disabled_reason = CASE WHEN COALESCE(:new_enabled, false) THEN '' ELSE disabled_reason END
+                WHERE account_id = :account_id AND id = :id returning *`, webhookUpdate)
 	if err != nil {
 		return nil, err
 	}
 
 	var webhook Webhook
-	if err = d.GetContext(ctx, webhook, query, args...); err != nil {
+	if err = d.GetContext(ctx, &webhook, d.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+// SetAccountWebhookClientCertificate replaces the client certificate of the account webhook, an empty client certificate
+// removes it.
+func (d *postgresDB) SetAccountWebhookClientCertificate(ctx context.Context, accountID string, webhookID string, clientCertificate string) (*Webhook, error) {
+	var webhook Webhook
+	if err := d.GetContext(ctx, &webhook, "UPDATE account_webhooks SET client_certificate = $1 WHERE account_id = $2 AND id = $3 RETURNING *", clientCertificate, accountID, webhookID); err != nil {
 		return nil, err
 	}
 
 	return &webhook, nil
 }
 
-func (d *postgresDB) DeleteWebhook(ctx context.Context, documentID string, webhookID string, secret string) error {
-	res, err := d.ExecContext(ctx, "DELETE FROM webhooks WHERE document_id = $1 AND id = $2 AND secret = $3", documentID, webhookID, secret)
+func (d *postgresDB) DeleteAccountWebhook(ctx context.Context, accountID string, webhookID string) error {
+	res, err := d.ExecContext(ctx, "DELETE FROM account_webhooks WHERE account_id = $1 AND id = $2", accountID, webhookID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (d *postgresDB) CreateEvent(ctx context.Context, event Event) (*Event, error) {
+	query, args, err := sqlx.Named("INSERT INTO events (document_id, document_version, event, data, created_at) VALUES (:document_id, :document_version, :event, :data, :created_at) RETURNING *;", event)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = d.GetContext(ctx, &event, d.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("failed to create event: %w", err)
+	}
+	return &event, nil
+}
+
+func (d *postgresDB) GetEvents(ctx context.Context, documentID string, since int64, limit int) ([]Event, error) {
+	var events []Event
+	if err := d.SelectContext(ctx, &events, "SELECT * FROM events WHERE document_id = $1 AND id > $2 ORDER BY id LIMIT $3;", documentID, since, limit); err != nil {
+		return nil, fmt.Errorf("failed to get events: %w", err)
+	}
+	return events, nil
+}
+
+func (d *postgresDB) DeleteEventsBefore(ctx context.Context, before time.Time) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM events WHERE created_at < $1;", before); err != nil {
+		return fmt.Errorf("failed to delete events: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) GetSummary(ctx context.Context, documentID string, documentVersion int64) (*Summary, error) {
+	var summary Summary
+	if err := d.GetContext(ctx, &summary, "SELECT * FROM summaries WHERE document_id = $1 AND document_version = $2;", documentID, documentVersion); err != nil {
+		return nil, fmt.Errorf("failed to get summary: %w", err)
+	}
+	return &summary, nil
+}
+
+func (d *postgresDB) CreateSummary(ctx context.Context, summary Summary) error {
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO summaries (document_id, document_version, summary, created_at) VALUES (:document_id, :document_version, :summary, :created_at) ON CONFLICT DO NOTHING;", summary); err != nil {
+		return fmt.Errorf("failed to create summary: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) DeleteOrphanedSummaries(ctx context.Context) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM summaries WHERE NOT EXISTS (SELECT 1 FROM files WHERE files.document_id = summaries.document_id AND files.document_version = summaries.document_version);"); err != nil {
+		return fmt.Errorf("failed to delete orphaned summaries: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) GetFork(ctx context.Context, documentID string) (*Fork, error) {
+	var fork Fork
+	if err := d.GetContext(ctx, &fork, "SELECT * FROM forks WHERE document_id = $1;", documentID); err != nil {
+		return nil, fmt.Errorf("failed to get fork: %w", err)
+	}
+	return &fork, nil
+}
+
+func (d *postgresDB) CreateFork(ctx context.Context, fork Fork) error {
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO forks (document_id, parent_id, parent_version, merged_version) VALUES (:document_id, :parent_id, :parent_version, :merged_version);", fork); err != nil {
+		return fmt.Errorf("failed to create fork: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) UpdateForkMergedVersion(ctx context.Context, documentID string, mergedVersion int64) error {
+	if _, err := d.ExecContext(ctx, "UPDATE forks SET merged_version = $1 WHERE document_id = $2;", mergedVersion, documentID); err != nil {
+		return fmt.Errorf("failed to update fork: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) DeleteOrphanedForks(ctx context.Context) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM forks WHERE NOT EXISTS (SELECT 1 FROM files WHERE files.document_id = forks.document_id) OR NOT EXISTS (SELECT 1 FROM files WHERE files.document_id = forks.parent_id);"); err != nil {
+		return fmt.Errorf("failed to delete orphaned forks: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) GetDocumentPart(ctx context.Context, documentID string) (*DocumentPart, error) {
+	var part DocumentPart
+	if err := d.GetContext(ctx, &part, "SELECT * FROM document_parts WHERE document_id = $1;", documentID); err != nil {
+		return nil, fmt.Errorf("failed to get document part: %w", err)
+	}
+	return &part, nil
+}
+
+func (d *postgresDB) GetDocumentParts(ctx context.Context, indexID string) ([]DocumentPart, error) {
+	var parts []DocumentPart
+	if err := d.SelectContext(ctx, &parts, "SELECT * FROM document_parts WHERE index_id = $1 ORDER BY part_index;", indexID); err != nil {
+		return nil, fmt.Errorf("failed to get document parts: %w", err)
+	}
+	return parts, nil
+}
+
+func (d *postgresDB) CreateDocumentPart(ctx context.Context, part DocumentPart) error {
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO document_parts (document_id, index_id, part_index) VALUES (:document_id, :index_id, :part_index);", part); err != nil {
+		return fmt.Errorf("failed to create document part: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) DeleteOrphanedDocumentParts(ctx context.Context) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM document_parts WHERE NOT EXISTS (SELECT 1 FROM files WHERE files.document_id = document_parts.document_id) OR NOT EXISTS (SELECT 1 FROM files WHERE files.document_id = document_parts.index_id);"); err != nil {
+		return fmt.Errorf("failed to delete orphaned document parts: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) GetDocumentLock(ctx context.Context, documentID string) (*DocumentLock, error) {
+	var lock DocumentLock
+	if err := d.GetContext(ctx, &lock, "SELECT * FROM document_locks WHERE document_id = $1;", documentID); err != nil {
+		return nil, fmt.Errorf("failed to get document lock: %w", err)
+	}
+	return &lock, nil
+}
+
+// AcquireDocumentLock stores the lock if the document isn't locked, its lock expired or has the id currentLockID and
+// returns false if the document is locked by another lock.
+func (d *postgresDB) AcquireDocumentLock(ctx context.Context, lock DocumentLock, currentLockID string) (bool, error) {
+	res, err := d.ExecContext(ctx, "INSERT INTO document_locks (document_id, id, holder, created_at, expires_at) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (document_id) DO UPDATE SET id = excluded.id, holder = excluded.holder, created_at = excluded.created_at, expires_at = excluded.expires_at WHERE document_locks.expires_at <= $6 OR document_locks.id = $7;",
+		lock.DocumentID, lock.ID, lock.Holder, lock.CreatedAt, lock.ExpiresAt, time.Now(), currentLockID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire document lock: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// DeleteDocumentLock releases the lock and returns sql.ErrNoRows if the document has no lock with the id.
+func (d *postgresDB) DeleteDocumentLock(ctx context.Context, documentID string, lockID string) error {
+	res, err := d.ExecContext(ctx, "DELETE FROM document_locks WHERE document_id = $1 AND id = $2;", documentID, lockID)
+	if err != nil {
+		return fmt.Errorf("failed to delete document lock: %w", err)
+	}
 	rows, err := res.RowsAffected()
 	if err != nil {
 		return err
@@ -324,6 +791,1098 @@ func (d *postgresDB) DeleteWebhook(ctx context.Context, documentID string, webho
 	if rows == 0 {
 		return sql.ErrNoRows
 	}
+	return nil
+}
 
+// DeleteExpiredDocumentLocks deletes expired locks and the locks of deleted documents.
+func (d *postgresDB) DeleteExpiredDocumentLocks(ctx context.Context) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM document_locks WHERE expires_at <= $1 OR NOT EXISTS (SELECT 1 FROM files WHERE files.document_id = document_locks.document_id);", time.Now()); err != nil {
+		return fmt.Errorf("failed to delete expired document locks: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) IsDocumentProtected(ctx context.Context, documentID string) (bool, error) {
+	var protected bool
+	if err := d.GetContext(ctx, &protected, "SELECT EXISTS (SELECT 1 FROM protected_documents WHERE document_id = $1);", documentID); err != nil {
+		return false, fmt.Errorf("failed to get document protection: %w", err)
+	}
+	return protected, nil
+}
+
+func (d *postgresDB) SetDocumentProtected(ctx context.Context, documentID string, protected bool) error {
+	query := "DELETE FROM protected_documents WHERE document_id = $1;"
+	if protected {
+		query = "INSERT INTO protected_documents (document_id) VALUES ($1) ON CONFLICT DO NOTHING;"
+	}
+	if _, err := d.ExecContext(ctx, query, documentID); err != nil {
+		return fmt.Errorf("failed to set document protection: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) GetDocumentStyle(ctx context.Context, documentID string) (string, error) {
+	var style string
+	if err := d.GetContext(ctx, &style, "SELECT style FROM document_styles WHERE document_id = $1;", documentID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get document style: %w", err)
+	}
+	return style, nil
+}
+
+func (d *postgresDB) SetDocumentStyle(ctx context.Context, documentID string, style string) error {
+	query := "DELETE FROM document_styles WHERE document_id = $1;"
+	args := []any{documentID}
+	if style != "" {
+		query = "INSERT INTO document_styles (document_id, style) VALUES ($1, $2) ON CONFLICT (document_id) DO UPDATE SET style = excluded.style;"
+		args = append(args, style)
+	}
+	if _, err := d.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to set document style: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) DeleteOrphanedDocumentStyles(ctx context.Context) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM document_styles WHERE NOT EXISTS (SELECT 1 FROM files WHERE files.document_id = document_styles.document_id);"); err != nil {
+		return fmt.Errorf("failed to delete orphaned document styles: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) GetDocumentTags(ctx context.Context, documentID string) ([]string, error) {
+	var tags []string
+	if err := d.SelectContext(ctx, &tags, "SELECT tag FROM document_tags WHERE document_id = $1 ORDER BY tag;", documentID); err != nil {
+		return nil, fmt.Errorf("failed to get document tags: %w", err)
+	}
+	return tags, nil
+}
+
+// SetDocumentTags replaces the tags of the document, no tags remove all of them.
+func (d *postgresDB) SetDocumentTags(ctx context.Context, documentID string, tags []string) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM document_tags WHERE document_id = $1;", documentID); err != nil {
+		return fmt.Errorf("failed to delete document tags: %w", err)
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	documentTags := make([]DocumentTag, len(tags))
+	for i, tag := range tags {
+		documentTags[i] = DocumentTag{
+			DocumentID: documentID,
+			Tag:        tag,
+		}
+	}
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO document_tags (document_id, tag) VALUES (:document_id, :tag) ON CONFLICT DO NOTHING;", documentTags); err != nil {
+		return fmt.Errorf("failed to set document tags: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) DeleteOrphanedDocumentTags(ctx context.Context) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM document_tags WHERE NOT EXISTS (SELECT 1 FROM files WHERE files.document_id = document_tags.document_id);"); err != nil {
+		return fmt.Errorf("failed to delete orphaned document tags: %w", err)
+	}
+	return nil
+}
+
+// GetVersionMessages returns the messages of the document versions by version, versions without message are missing.
+func (d *postgresDB) GetVersionMessages(ctx context.Context, documentID string) (map[int64]string, error) {
+	var versionMessages []VersionMessage
+	if err := d.SelectContext(ctx, &versionMessages, "SELECT * FROM document_versions WHERE document_id = $1;", documentID); err != nil {
+		return nil, fmt.Errorf("failed to get version messages: %w", err)
+	}
+	messages := make(map[int64]string, len(versionMessages))
+	for _, versionMessage := range versionMessages {
+		messages[versionMessage.DocumentVersion] = versionMessage.Message
+	}
+	return messages, nil
+}
+
+func (d *postgresDB) SetVersionMessage(ctx context.Context, documentID string, documentVersion int64, message string) error {
+	if _, err := d.ExecContext(ctx, "INSERT INTO document_versions (document_id, document_version, message) VALUES ($1, $2, $3) ON CONFLICT (document_id, document_version) DO UPDATE SET message = excluded.message;", documentID, documentVersion, message); err != nil {
+		return fmt.Errorf("failed to set version message: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) DeleteOrphanedVersionMessages(ctx context.Context) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM document_versions WHERE NOT EXISTS (SELECT 1 FROM files WHERE files.document_id = document_versions.document_id AND files.document_version = document_versions.document_version);"); err != nil {
+		return fmt.Errorf("failed to delete orphaned version messages: %w", err)
+	}
+	return nil
+}
+
+// GetFileSignatures returns the signatures of the files of the document version.
+func (d *postgresDB) GetFileSignatures(ctx context.Context, documentID string, documentVersion int64) ([]FileSignature, error) {
+	var signatures []FileSignature
+	if err := d.SelectContext(ctx, &signatures, "SELECT * FROM file_signatures WHERE document_id = $1 AND document_version = $2;", documentID, documentVersion); err != nil {
+		return nil, fmt.Errorf("failed to get file signatures: %w", err)
+	}
+	return signatures, nil
+}
+
+func (d *postgresDB) SetFileSignature(ctx context.Context, signature FileSignature) error {
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO file_signatures (document_id, document_version, file_name, format, public_key, signature, key_id, comment, created_at) VALUES (:document_id, :document_version, :file_name, :format, :public_key, :signature, :key_id, :comment, :created_at) ON CONFLICT (document_id, document_version, file_name) DO UPDATE SET format = excluded.format, public_key = excluded.public_key, signature = excluded.signature, key_id = excluded.key_id, comment = excluded.comment, created_at = excluded.created_at;", signature); err != nil {
+		return fmt.Errorf("failed to set file signature: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) DeleteFileSignature(ctx context.Context, documentID string, documentVersion int64, fileName string) error {
+	res, err := d.ExecContext(ctx, "DELETE FROM file_signatures WHERE document_id = $1 AND document_version = $2 AND file_name = $3;", documentID, documentVersion, fileName)
+	if err != nil {
+		return fmt.Errorf("failed to delete file signature: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (d *postgresDB) DeleteOrphanedFileSignatures(ctx context.Context) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM file_signatures WHERE NOT EXISTS (SELECT 1 FROM files WHERE files.document_id = file_signatures.document_id AND files.document_version = file_signatures.document_version AND files.name = file_signatures.file_name);"); err != nil {
+		return fmt.Errorf("failed to delete orphaned file signatures: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) GetRevisions(ctx context.Context, documentID string) ([]RevisionFile, error) {
+	var files []RevisionFile
+	if err := d.SelectContext(ctx, &files, "SELECT * FROM revisions WHERE document_id = $1 ORDER BY revision, order_index;", documentID); err != nil {
+		return nil, fmt.Errorf("failed to get revisions: %w", err)
+	}
+	return files, nil
+}
+
+func (d *postgresDB) GetRevision(ctx context.Context, documentID string, revision int64) ([]RevisionFile, error) {
+	var files []RevisionFile
+	if err := d.SelectContext(ctx, &files, "SELECT * FROM revisions WHERE document_id = $1 AND revision = $2 ORDER BY order_index;", documentID, revision); err != nil {
+		return nil, fmt.Errorf("failed to get revision: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return files, nil
+}
+
+func (d *postgresDB) CreateRevision(ctx context.Context, documentID string, baseVersion int64, files []File) (*int64, error) {
+	revision := time.Now().UnixMilli()
+	revisionFiles := make([]RevisionFile, len(files))
+	for i, file := range files {
+		revisionFiles[i] = RevisionFile{
+			DocumentID:  documentID,
+			Revision:    revision,
+			BaseVersion: baseVersion,
+			Name:        file.Name,
+			Content:     file.Content,
+			Language:    file.Language,
+			Encrypted:   file.Encrypted,
+			ExpiresAt:   file.ExpiresAt,
+			OrderIndex:  file.OrderIndex,
+		}
+	}
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO revisions (name, document_id, revision, base_version, content, language, encrypted, expires_at, order_index) VALUES (:name, :document_id, :revision, :base_version, :content, :language, :encrypted, :expires_at, :order_index);", revisionFiles); err != nil {
+		return nil, fmt.Errorf("failed to create revision: %w", err)
+	}
+	return &revision, nil
+}
+
+func (d *postgresDB) DeleteRevision(ctx context.Context, documentID string, revision int64) error {
+	res, err := d.ExecContext(ctx, "DELETE FROM revisions WHERE document_id = $1 AND revision = $2;", documentID, revision)
+	if err != nil {
+		return fmt.Errorf("failed to delete revision: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (d *postgresDB) DeleteOrphanedRevisions(ctx context.Context) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM revisions WHERE NOT EXISTS (SELECT 1 FROM files WHERE files.document_id = revisions.document_id);"); err != nil {
+		return fmt.Errorf("failed to delete orphaned revisions: %w", err)
+	}
+	if _, err := d.ExecContext(ctx, "DELETE FROM protected_documents WHERE NOT EXISTS (SELECT 1 FROM files WHERE files.document_id = protected_documents.document_id);"); err != nil {
+		return fmt.Errorf("failed to delete orphaned document protections: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) GetDeviceAuthorization(ctx context.Context, deviceCode string) (*DeviceAuthorization, error) {
+	var authorization DeviceAuthorization
+	if err := d.GetContext(ctx, &authorization, "SELECT * FROM device_authorizations WHERE device_code = $1;", deviceCode); err != nil {
+		return nil, fmt.Errorf("failed to get device authorization: %w", err)
+	}
+	return &authorization, nil
+}
+
+func (d *postgresDB) GetDeviceAuthorizationByUserCode(ctx context.Context, userCode string) (*DeviceAuthorization, error) {
+	var authorization DeviceAuthorization
+	if err := d.GetContext(ctx, &authorization, "SELECT * FROM device_authorizations WHERE user_code = $1;", userCode); err != nil {
+		return nil, fmt.Errorf("failed to get device authorization: %w", err)
+	}
+	return &authorization, nil
+}
+
+func (d *postgresDB) CreateDeviceAuthorization(ctx context.Context, authorization DeviceAuthorization) error {
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO device_authorizations (device_code, user_code, permissions, status, tokens, expires_at, account) VALUES (:device_code, :user_code, :permissions, :status, :tokens, :expires_at, :account);", authorization); err != nil {
+		return fmt.Errorf("failed to create device authorization: %w", err)
+	}
+	return nil
+}
+
+// UpdateDeviceAuthorizationStatus approves or denies a pending device authorization. It returns sql.ErrNoRows if the
+// authorization does not exist, expired or is not pending anymore.
+func (d *postgresDB) UpdateDeviceAuthorizationStatus(ctx context.Context, userCode string, status string, tokens string, accountID string, twoFactor bool) error {
+	res, err := d.ExecContext(ctx, "UPDATE device_authorizations SET status = $1, tokens = $2, account_id = $3, two_factor = $4 WHERE user_code = $5 AND status = $6 AND expires_at > $7;", status, tokens, accountID, twoFactor, userCode, DeviceAuthorizationPending, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to update device authorization: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (d *postgresDB) UpdateDeviceAuthorizationPolledAt(ctx context.Context, deviceCode string, polledAt time.Time) error {
+	if _, err := d.ExecContext(ctx, "UPDATE device_authorizations SET last_polled_at = $1 WHERE device_code = $2;", polledAt, deviceCode); err != nil {
+		return fmt.Errorf("failed to update device authorization: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) DeleteDeviceAuthorization(ctx context.Context, deviceCode string) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM device_authorizations WHERE device_code = $1;", deviceCode); err != nil {
+		return fmt.Errorf("failed to delete device authorization: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) DeleteExpiredDeviceAuthorizations(ctx context.Context) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM device_authorizations WHERE expires_at < $1;", time.Now()); err != nil {
+		return fmt.Errorf("failed to delete expired device authorizations: %w", err)
+	}
+	return nil
+}
+
+// SearchDocuments searches the latest version of the documents of the creator and the documentIDs using the
+// websearch_to_tsquery syntax.
+func (d *postgresDB) SearchDocuments(ctx context.Context, query string, creatorID string, documentIDs []string, limit int) ([]SearchResult, error) {
+	options := fmt.Sprintf(`StartSel=%s, StopSel=%s, MinWords=8, MaxWords=24, MaxFragments=2, FragmentDelimiter=" … "`, SearchHighlightStart, SearchHighlightEnd)
+	condition, args := documentAccessCondition(creatorID, documentIDs, []any{query, options})
+	if condition == "" {
+		return nil, nil
+	}
+	args = append(args, limit)
+
+	var results []SearchResult
+	// encrypted, compressed and delta contents are only found by the file name
+	if err := d.SelectContext(ctx, &results, fmt.Sprintf("SELECT f.document_id, f.document_version, f.name, f.language, CASE WHEN f.content LIKE 'zstd:%%' OR f.content LIKE 'enc:%%' OR f.delta_base != 0 THEN '' ELSE ts_headline('simple', left(f.content, 262144), q, $2) END AS snippet, ts_rank(f.search, q) AS rank FROM files f, websearch_to_tsquery('simple', $1) q WHERE f.search @@ q AND ((f.content NOT LIKE 'enc:%%' AND f.content NOT LIKE 'zstd:%%' AND f.delta_base = 0) OR to_tsvector('simple', f.name) @@ q) AND NOT f.encrypted AND %s AND NOT EXISTS (SELECT 1 FROM files n WHERE n.document_id = f.document_id AND n.document_version > f.document_version) ORDER BY rank DESC, f.document_version DESC LIMIT $%d;", condition, len(args)), args...); err != nil {
+		return nil, fmt.Errorf("failed to search documents: %w", err)
+	}
+	return results, nil
+}
+
+func (d *postgresDB) GetDocumentList(ctx context.Context, creatorID string, documentIDs []string, tag string, beforeVersion int64, beforeID string, limit int) ([]File, error) {
+	query, args := documentListQuery(creatorID, documentIDs, tag, beforeVersion, beforeID, limit)
+	if query == "" {
+		return nil, nil
+	}
+
+	var files []File
+	if err := d.SelectContext(ctx, &files, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to get document list: %w", err)
+	}
+	return files, nil
+}
+
+func (d *postgresDB) GetCreatorDocuments(ctx context.Context, creatorID string, limit int) ([]CreatorDocument, error) {
+	var documents []CreatorDocument
+	if err := d.SelectContext(ctx, &documents, "SELECT * FROM creator_documents WHERE creator_id = $1 AND EXISTS (SELECT 1 FROM files WHERE files.document_id = creator_documents.document_id) ORDER BY created_at DESC LIMIT $2;", creatorID, limit); err != nil {
+		return nil, fmt.Errorf("failed to get creator documents: %w", err)
+	}
+	return documents, nil
+}
+
+func (d *postgresDB) IsCreatorDocument(ctx context.Context, creatorID string, documentID string) (bool, error) {
+	var created bool
+	if err := d.GetContext(ctx, &created, "SELECT EXISTS (SELECT 1 FROM creator_documents WHERE creator_id = $1 AND document_id = $2);", creatorID, documentID); err != nil {
+		return false, fmt.Errorf("failed to get creator document: %w", err)
+	}
+	return created, nil
+}
+
+// AddCreatorDocument links the document to the creator and only keeps the newest limit documents of the creator.
+func (d *postgresDB) AddCreatorDocument(ctx context.Context, creatorID string, documentID string, limit int) error {
+	if _, err := d.ExecContext(ctx, "INSERT INTO creator_documents (creator_id, document_id, created_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING;", creatorID, documentID, time.Now()); err != nil {
+		return fmt.Errorf("failed to add creator document: %w", err)
+	}
+	if _, err := d.ExecContext(ctx, "DELETE FROM creator_documents WHERE creator_id = $1 AND document_id NOT IN (SELECT document_id FROM creator_documents WHERE creator_id = $1 ORDER BY created_at DESC LIMIT $2);", creatorID, limit); err != nil {
+		return fmt.Errorf("failed to delete old creator documents: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) DeleteOrphanedCreatorDocuments(ctx context.Context) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM creator_documents WHERE NOT EXISTS (SELECT 1 FROM files WHERE files.document_id = creator_documents.document_id);"); err != nil {
+		return fmt.Errorf("failed to delete orphaned creator documents: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) GetAccount(ctx context.Context, accountID string) (*Account, error) {
+	var account Account
+	if err := d.GetContext(ctx, &account, "SELECT * FROM accounts WHERE id = $1;", accountID); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// UpsertAccount creates the account of the user of the issuer or updates its name and email and returns it.
+func (d *postgresDB) UpsertAccount(ctx context.Context, account Account) (*Account, error) {
+	var upserted Account
+	if err := d.GetContext(ctx, &upserted, "INSERT INTO accounts (id, issuer, subject, name, email, created_at) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (issuer, subject) DO UPDATE SET name = excluded.name, email = excluded.email RETURNING *;", account.ID, account.Issuer, account.Subject, account.Name, account.Email, account.CreatedAt); err != nil {
+		return nil, fmt.Errorf("failed to upsert account: %w", err)
+	}
+	return &upserted, nil
+}
+
+func (d *postgresDB) IsAccountDocument(ctx context.Context, accountID string, documentID string) (bool, error) {
+	var owned bool
+	if err := d.GetContext(ctx, &owned, "SELECT EXISTS (SELECT 1 FROM account_documents WHERE account_id = $1 AND document_id = $2);", accountID, documentID); err != nil {
+		return false, fmt.Errorf("failed to get account document: %w", err)
+	}
+	return owned, nil
+}
+
+func (d *postgresDB) AddAccountDocument(ctx context.Context, accountID string, documentID string) error {
+	if _, err := d.ExecContext(ctx, "INSERT INTO account_documents (account_id, document_id, created_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING;", accountID, documentID, time.Now()); err != nil {
+		return fmt.Errorf("failed to add account document: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) DeleteOrphanedAccountDocuments(ctx context.Context) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM account_documents WHERE NOT EXISTS (SELECT 1 FROM files WHERE files.document_id = account_documents.document_id);"); err != nil {
+		return fmt.Errorf("failed to delete orphaned account documents: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) CreateAccountSession(ctx context.Context, session AccountSession) error {
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO account_sessions (id, account_id, kind, user_agent, address, created_at, last_used_at, expires_at, two_factor) VALUES (:id, :account_id, :kind, :user_agent, :address, :created_at, :last_used_at, :expires_at, :two_factor);", session); err != nil {
+		return fmt.Errorf("failed to create account session: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) GetAccountSession(ctx context.Context, sessionID string) (*AccountSession, error) {
+	var session AccountSession
+	if err := d.GetContext(ctx, &session, "SELECT * FROM account_sessions WHERE id = $1 AND expires_at > $2;", sessionID, time.Now()); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetAccountSessions returns the sessions of the account which didn't expire yet from the most recently used to the oldest.
+func (d *postgresDB) GetAccountSessions(ctx context.Context, accountID string) ([]AccountSession, error) {
+	var sessions []AccountSession
+	if err := d.SelectContext(ctx, &sessions, "SELECT * FROM account_sessions WHERE account_id = $1 AND expires_at > $2 ORDER BY last_used_at DESC;", accountID, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to get account sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+func (d *postgresDB) TouchAccountSession(ctx context.Context, sessionID string, lastUsedAt time.Time) error {
+	if _, err := d.ExecContext(ctx, "UPDATE account_sessions SET last_used_at = $1 WHERE id = $2;", lastUsedAt, sessionID); err != nil {
+		return fmt.Errorf("failed to touch account session: %w", err)
+	}
+	return nil
+}
+
+// DeleteAccountSession deletes the session of the account and returns sql.ErrNoRows if the account has no such session.
+func (d *postgresDB) DeleteAccountSession(ctx context.Context, accountID string, sessionID string) error {
+	res, err := d.ExecContext(ctx, "DELETE FROM account_sessions WHERE account_id = $1 AND id = $2;", accountID, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to delete account session: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteOtherAccountSessions deletes all sessions of the account except the given one.
+func (d *postgresDB) DeleteOtherAccountSessions(ctx context.Context, accountID string, sessionID string) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM account_sessions WHERE account_id = $1 AND id != $2;", accountID, sessionID); err != nil {
+		return fmt.Errorf("failed to delete account sessions: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) DeleteExpiredAccountSessions(ctx context.Context) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM account_sessions WHERE expires_at < $1;", time.Now()); err != nil {
+		return fmt.Errorf("failed to delete expired account sessions: %w", err)
+	}
+	return nil
+}
+
+// SetAccountSessionTwoFactor marks the session as confirmed with a second factor after the account set up its first one.
+func (d *postgresDB) SetAccountSessionTwoFactor(ctx context.Context, sessionID string) error {
+	if _, err := d.ExecContext(ctx, "UPDATE account_sessions SET two_factor = true WHERE id = $1;", sessionID); err != nil {
+		return fmt.Errorf("failed to update account session: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) GetAccountTwoFactor(ctx context.Context, accountID string) (*AccountTwoFactor, error) {
+	var twoFactor AccountTwoFactor
+	if err := d.GetContext(ctx, &twoFactor, "SELECT * FROM account_two_factor WHERE account_id = $1;", accountID); err != nil {
+		return nil, err
+	}
+	return &twoFactor, nil
+}
+
+// SetAccountTOTPSecret stores a new secret of the authenticator app, it is disabled until EnableAccountTOTP.
+func (d *postgresDB) SetAccountTOTPSecret(ctx context.Context, accountID string, secret string) error {
+	if _, err := d.ExecContext(ctx, "INSERT INTO account_two_factor (account_id, totp_secret) VALUES ($1, $2) ON CONFLICT (account_id) DO UPDATE SET totp_secret = excluded.totp_secret, totp_enabled = false, totp_last_step = 0;", accountID, secret); err != nil {
+		return fmt.Errorf("failed to set account totp secret: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) EnableAccountTOTP(ctx context.Context, accountID string, step int64) error {
+	if _, err := d.ExecContext(ctx, "UPDATE account_two_factor SET totp_enabled = true, totp_last_step = $1 WHERE account_id = $2;", step, accountID); err != nil {
+		return fmt.Errorf("failed to enable account totp: %w", err)
+	}
+	return nil
+}
+
+// UseAccountTOTPStep records the time step of a used code and returns sql.ErrNoRows if the step or a later one was used
+// before, so concurrent requests can't use the same code twice.
+func (d *postgresDB) UseAccountTOTPStep(ctx context.Context, accountID string, step int64) error {
+	res, err := d.ExecContext(ctx, "UPDATE account_two_factor SET totp_last_step = $1 WHERE account_id = $2 AND totp_last_step < $1;", step, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to use account totp code: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (d *postgresDB) DisableAccountTOTP(ctx context.Context, accountID string) error {
+	if _, err := d.ExecContext(ctx, "UPDATE account_two_factor SET totp_secret = '', totp_enabled = false, totp_last_step = 0 WHERE account_id = $1;", accountID); err != nil {
+		return fmt.Errorf("failed to disable account totp: %w", err)
+	}
+	return nil
+}
+
+// AddAccountTwoFactorAttempt counts an attempt to confirm a login with a second factor before it is checked and returns
+// the attempts since the first one after since, so parallel attempts can't get around the limit.
+func (d *postgresDB) AddAccountTwoFactorAttempt(ctx context.Context, accountID string, now time.Time, since time.Time) (int, error) {
+	var attempts int
+	if err := d.GetContext(ctx, &attempts, "INSERT INTO account_two_factor (account_id, failures, failed_at) VALUES ($1, 1, $2) ON CONFLICT (account_id) DO UPDATE SET failures = CASE WHEN account_two_factor.failed_at IS NULL OR account_two_factor.failed_at < $3 THEN 1 ELSE account_two_factor.failures + 1 END, failed_at = CASE WHEN account_two_factor.failed_at IS NULL OR account_two_factor.failed_at < $3 THEN $2 ELSE account_two_factor.failed_at END RETURNING failures;", accountID, now, since); err != nil {
+		return 0, fmt.Errorf("failed to add account two-factor attempt: %w", err)
+	}
+	return attempts, nil
+}
+
+// ResetAccountTwoFactorAttempts forgets the attempts after a successful one.
+func (d *postgresDB) ResetAccountTwoFactorAttempts(ctx context.Context, accountID string) error {
+	if _, err := d.ExecContext(ctx, "UPDATE account_two_factor SET failures = 0, failed_at = NULL WHERE account_id = $1;", accountID); err != nil {
+		return fmt.Errorf("failed to reset account two-factor attempts: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) GetAccountRecoveryCodeCount(ctx context.Context, accountID string) (int, error) {
+	var count int
+	if err := d.GetContext(ctx, &count, "SELECT COUNT(*) FROM account_recovery_codes WHERE account_id = $1;", accountID); err != nil {
+		return 0, fmt.Errorf("failed to get account recovery codes: %w", err)
+	}
+	return count, nil
+}
+
+// SetAccountRecoveryCodes replaces the recovery codes of the account with the SHA-256 hashes of the new codes.
+func (d *postgresDB) SetAccountRecoveryCodes(ctx context.Context, accountID string, codeHashes []string) error {
+	return setRecoveryCodes(ctx, d.DB, accountID, codeHashes)
+}
+
+// UseAccountRecoveryCode deletes the recovery code and returns sql.ErrNoRows if the account has no such code.
+func (d *postgresDB) UseAccountRecoveryCode(ctx context.Context, accountID string, codeHash string) error {
+	res, err := d.ExecContext(ctx, "DELETE FROM account_recovery_codes WHERE account_id = $1 AND code_hash = $2;", accountID, codeHash)
+	if err != nil {
+		return fmt.Errorf("failed to use account recovery code: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (d *postgresDB) DeleteAccountRecoveryCodes(ctx context.Context, accountID string) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM account_recovery_codes WHERE account_id = $1;", accountID); err != nil {
+		return fmt.Errorf("failed to delete account recovery codes: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) CreateAccountPasskey(ctx context.Context, passkey AccountPasskey) error {
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO account_passkeys (id, account_id, name, public_key, sign_count, created_at) VALUES (:id, :account_id, :name, :public_key, :sign_count, :created_at);", passkey); err != nil {
+		return fmt.Errorf("failed to create account passkey: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) GetAccountPasskey(ctx context.Context, accountID string, passkeyID string) (*AccountPasskey, error) {
+	var passkey AccountPasskey
+	if err := d.GetContext(ctx, &passkey, "SELECT * FROM account_passkeys WHERE account_id = $1 AND id = $2;", accountID, passkeyID); err != nil {
+		return nil, err
+	}
+	return &passkey, nil
+}
+
+func (d *postgresDB) GetAccountPasskeys(ctx context.Context, accountID string) ([]AccountPasskey, error) {
+	var passkeys []AccountPasskey
+	if err := d.SelectContext(ctx, &passkeys, "SELECT * FROM account_passkeys WHERE account_id = $1 ORDER BY created_at;", accountID); err != nil {
+		return nil, fmt.Errorf("failed to get account passkeys: %w", err)
+	}
+	return passkeys, nil
+}
+
+func (d *postgresDB) UseAccountPasskey(ctx context.Context, passkeyID string, signCount int64, usedAt time.Time) error {
+	if _, err := d.ExecContext(ctx, "UPDATE account_passkeys SET sign_count = $1, last_used_at = $2 WHERE id = $3;", signCount, usedAt, passkeyID); err != nil {
+		return fmt.Errorf("failed to use account passkey: %w", err)
+	}
+	return nil
+}
+
+// DeleteAccountPasskey deletes the passkey of the account and returns sql.ErrNoRows if the account has no such passkey.
+func (d *postgresDB) DeleteAccountPasskey(ctx context.Context, accountID string, passkeyID string) error {
+	res, err := d.ExecContext(ctx, "DELETE FROM account_passkeys WHERE account_id = $1 AND id = $2;", accountID, passkeyID)
+	if err != nil {
+		return fmt.Errorf("failed to delete account passkey: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (d *postgresDB) GetUserSettings(ctx context.Context, creatorID string) (*UserSettings, error) {
+	var settings UserSettings
+	if err := d.GetContext(ctx, &settings, "SELECT * FROM user_settings WHERE creator_id = $1;", creatorID); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+func (d *postgresDB) SetUserSettings(ctx context.Context, settings UserSettings) error {
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO user_settings (creator_id, default_style, default_expiry, editor_keymap, default_language, updated_at) VALUES (:creator_id, :default_style, :default_expiry, :editor_keymap, :default_language, :updated_at) ON CONFLICT (creator_id) DO UPDATE SET default_style = excluded.default_style, default_expiry = excluded.default_expiry, editor_keymap = excluded.editor_keymap, default_language = excluded.default_language, updated_at = excluded.updated_at;", settings); err != nil {
+		return fmt.Errorf("failed to set user settings: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) DeleteUserSettings(ctx context.Context, creatorID string) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM user_settings WHERE creator_id = $1;", creatorID); err != nil {
+		return fmt.Errorf("failed to delete user settings: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) CreateDocumentInvite(ctx context.Context, invite DocumentInvite) error {
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO document_invites (id, document_id, permissions, max_uses, uses, expires_at, created_at) VALUES (:id, :document_id, :permissions, :max_uses, :uses, :expires_at, :created_at);", invite); err != nil {
+		return fmt.Errorf("failed to create document invite: %w", err)
+	}
+	return nil
+}
+
+// ImportDocumentInvite inserts the invite with its uses, invites which already exist are kept.
+func (d *postgresDB) ImportDocumentInvite(ctx context.Context, invite DocumentInvite) error {
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO document_invites (id, document_id, permissions, max_uses, uses, expires_at, created_at) VALUES (:id, :document_id, :permissions, :max_uses, :uses, :expires_at, :created_at) ON CONFLICT DO NOTHING;", invite); err != nil {
+		return fmt.Errorf("failed to import document invite: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) GetDocumentInvite(ctx context.Context, inviteID string) (*DocumentInvite, error) {
+	var invite DocumentInvite
+	if err := d.GetContext(ctx, &invite, "SELECT * FROM document_invites WHERE id = $1;", inviteID); err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+func (d *postgresDB) GetDocumentInvites(ctx context.Context, documentID string) ([]DocumentInvite, error) {
+	var invites []DocumentInvite
+	if err := d.SelectContext(ctx, &invites, "SELECT * FROM document_invites WHERE document_id = $1 ORDER BY created_at;", documentID); err != nil {
+		return nil, fmt.Errorf("failed to get document invites: %w", err)
+	}
+	return invites, nil
+}
+
+// UseDocumentInvite counts a use of the invite and returns sql.ErrNoRows if it is expired or used up.
+func (d *postgresDB) UseDocumentInvite(ctx context.Context, inviteID string) error {
+	res, err := d.ExecContext(ctx, "UPDATE document_invites SET uses = uses + 1 WHERE id = $1 AND (max_uses = 0 OR uses < max_uses) AND (expires_at IS NULL OR expires_at > $2);", inviteID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to use document invite: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (d *postgresDB) DeleteDocumentInvite(ctx context.Context, documentID string, inviteID string) error {
+	res, err := d.ExecContext(ctx, "DELETE FROM document_invites WHERE document_id = $1 AND id = $2;", documentID, inviteID)
+	if err != nil {
+		return fmt.Errorf("failed to delete document invite: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteExpiredDocumentInvites deletes expired invites and the invites of deleted documents.
+func (d *postgresDB) DeleteExpiredDocumentInvites(ctx context.Context) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM document_invites WHERE expires_at < $1 OR NOT EXISTS (SELECT 1 FROM files WHERE files.document_id = document_invites.document_id);", time.Now()); err != nil {
+		return fmt.Errorf("failed to delete expired document invites: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) CreateDocumentShareToken(ctx context.Context, shareToken DocumentShareToken) error {
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO document_share_tokens (id, document_id, permissions, max_uses, uses, expires_at, created_at) VALUES (:id, :document_id, :permissions, :max_uses, :uses, :expires_at, :created_at);", shareToken); err != nil {
+		return fmt.Errorf("failed to create document share token: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) GetDocumentShareToken(ctx context.Context, shareTokenID string) (*DocumentShareToken, error) {
+	var shareToken DocumentShareToken
+	if err := d.GetContext(ctx, &shareToken, "SELECT * FROM document_share_tokens WHERE id = $1;", shareTokenID); err != nil {
+		return nil, err
+	}
+	return &shareToken, nil
+}
+
+// UseDocumentShareToken counts a use of the share token and returns sql.ErrNoRows if it is expired, used up or deleted.
+func (d *postgresDB) UseDocumentShareToken(ctx context.Context, shareTokenID string) error {
+	res, err := d.ExecContext(ctx, "UPDATE document_share_tokens SET uses = uses + 1 WHERE id = $1 AND (max_uses = 0 OR uses < max_uses) AND (expires_at IS NULL OR expires_at > $2);", shareTokenID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to use document share token: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteExpiredDocumentShareTokens deletes expired and used up share tokens and the share tokens of deleted documents.
+func (d *postgresDB) DeleteExpiredDocumentShareTokens(ctx context.Context) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM document_share_tokens WHERE expires_at < $1 OR (max_uses > 0 AND uses >= max_uses) OR NOT EXISTS (SELECT 1 FROM files WHERE files.document_id = document_share_tokens.document_id);", time.Now()); err != nil {
+		return fmt.Errorf("failed to delete expired document share tokens: %w", err)
+	}
+	return nil
+}
+
+// RevokeToken adds the token to the revoked tokens and deletes the share token with its id.
+func (d *postgresDB) RevokeToken(ctx context.Context, token RevokedToken) error {
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO revoked_tokens (id, document_id, expires_at, revoked_at) VALUES (:id, :document_id, :expires_at, :revoked_at) ON CONFLICT DO NOTHING;", token); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	if _, err := d.ExecContext(ctx, "DELETE FROM document_share_tokens WHERE id = $1;", token.ID); err != nil {
+		return fmt.Errorf("failed to delete document share token: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	var revoked bool
+	if err := d.GetContext(ctx, &revoked, "SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE id = $1);", tokenID); err != nil {
+		return false, fmt.Errorf("failed to check revoked token: %w", err)
+	}
+	return revoked, nil
+}
+
+// DeleteExpiredRevokedTokens deletes revoked tokens which expired and the revoked tokens of deleted documents, their keys
+// are never used again.
+func (d *postgresDB) DeleteExpiredRevokedTokens(ctx context.Context) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expires_at < $1 OR NOT EXISTS (SELECT 1 FROM files WHERE files.document_id = revoked_tokens.document_id);", time.Now()); err != nil {
+		return fmt.Errorf("failed to delete expired revoked tokens: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) GetDocumentMember(ctx context.Context, documentID string, creatorID string) (*DocumentMember, error) {
+	var member DocumentMember
+	if err := d.GetContext(ctx, &member, "SELECT * FROM document_members WHERE document_id = $1 AND creator_id = $2;", documentID, creatorID); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (d *postgresDB) GetDocumentMembers(ctx context.Context, documentID string) ([]DocumentMember, error) {
+	var members []DocumentMember
+	if err := d.SelectContext(ctx, &members, "SELECT * FROM document_members WHERE document_id = $1 ORDER BY joined_at;", documentID); err != nil {
+		return nil, fmt.Errorf("failed to get document members: %w", err)
+	}
+	return members, nil
+}
+
+// SetDocumentMember adds the member to the access list of the document or replaces its permissions.
+func (d *postgresDB) SetDocumentMember(ctx context.Context, member DocumentMember) error {
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO document_members (document_id, creator_id, permissions, invite_id, joined_at) VALUES (:document_id, :creator_id, :permissions, :invite_id, :joined_at) ON CONFLICT (document_id, creator_id) DO UPDATE SET permissions = excluded.permissions, invite_id = excluded.invite_id;", member); err != nil {
+		return fmt.Errorf("failed to set document member: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) DeleteDocumentMember(ctx context.Context, documentID string, creatorID string) error {
+	res, err := d.ExecContext(ctx, "DELETE FROM document_members WHERE document_id = $1 AND creator_id = $2;", documentID, creatorID)
+	if err != nil {
+		return fmt.Errorf("failed to delete document member: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (d *postgresDB) DeleteOrphanedDocumentMembers(ctx context.Context) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM document_members WHERE NOT EXISTS (SELECT 1 FROM files WHERE files.document_id = document_members.document_id);"); err != nil {
+		return fmt.Errorf("failed to delete orphaned document members: %w", err)
+	}
+	return nil
+}
+
+// ClaimCustomDocumentKey records the key as used and returns sql.ErrNoRows if it was claimed before. Generated keys are
+// claimed too. Claimed keys are never released, so tokens of a deleted document can't be used for a new document with
+// the same key.
+func (d *postgresDB) ClaimCustomDocumentKey(ctx context.Context, key string) error {
+	res, err := d.ExecContext(ctx, "INSERT INTO custom_document_keys (key, created_at) VALUES ($1, $2) ON CONFLICT (key) DO NOTHING;", key, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to claim custom document key: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (d *postgresDB) GetIngestedObject(ctx context.Context, objectKey string) (*IngestedObject, error) {
+	var object IngestedObject
+	if err := d.GetContext(ctx, &object, "SELECT * FROM ingested_objects WHERE object_key = $1;", objectKey); err != nil {
+		return nil, err
+	}
+	return &object, nil
+}
+
+// ClaimIngestedObject records the object as ingested and returns sql.ErrNoRows if it was already ingested with the
+// same ETag, so an object is only turned into a document once even if it is seen by a notification and a poll.
+func (d *postgresDB) ClaimIngestedObject(ctx context.Context, objectKey string, etag string) error {
+	res, err := d.ExecContext(ctx, "INSERT INTO ingested_objects (object_key, etag, document_id, created_at) VALUES ($1, $2, '', $3) ON CONFLICT (object_key) DO UPDATE SET etag = excluded.etag, document_id = excluded.document_id, created_at = excluded.created_at WHERE ingested_objects.etag != excluded.etag;", objectKey, etag, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to claim ingested object: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (d *postgresDB) SetIngestedObjectDocument(ctx context.Context, objectKey string, documentID string) error {
+	if _, err := d.ExecContext(ctx, "UPDATE ingested_objects SET document_id = $1 WHERE object_key = $2;", documentID, objectKey); err != nil {
+		return fmt.Errorf("failed to set ingested object document: %w", err)
+	}
+	return nil
+}
+
+// DeleteIngestedObject releases the claim of an object which could not be ingested, so it is tried again.
+func (d *postgresDB) DeleteIngestedObject(ctx context.Context, objectKey string) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM ingested_objects WHERE object_key = $1;", objectKey); err != nil {
+		return fmt.Errorf("failed to delete ingested object: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) GetSyslogSource(ctx context.Context, source string) (*SyslogSource, error) {
+	var syslogSource SyslogSource
+	if err := d.GetContext(ctx, &syslogSource, "SELECT * FROM syslog_sources WHERE source = $1;", source); err != nil {
+		return nil, err
+	}
+	return &syslogSource, nil
+}
+
+func (d *postgresDB) GetSyslogSourceCount(ctx context.Context) (int, error) {
+	var count int
+	if err := d.GetContext(ctx, &count, "SELECT COUNT(*) FROM syslog_sources;"); err != nil {
+		return 0, fmt.Errorf("failed to get syslog source count: %w", err)
+	}
+	return count, nil
+}
+
+// SetSyslogSource points the source to a new document, the old document of the source is kept.
+func (d *postgresDB) SetSyslogSource(ctx context.Context, source string, documentID string) error {
+	if _, err := d.ExecContext(ctx, "INSERT INTO syslog_sources (source, document_id, created_at) VALUES ($1, $2, $3) ON CONFLICT (source) DO UPDATE SET document_id = excluded.document_id, created_at = excluded.created_at;", source, documentID, time.Now()); err != nil {
+		return fmt.Errorf("failed to set syslog source: %w", err)
+	}
+	return nil
+}
+
+// GetActivityPubFollowerInboxes returns the distinct inboxes of all followers, followers on the same server share
+// their inbox.
+func (d *postgresDB) GetActivityPubFollowerInboxes(ctx context.Context) ([]string, error) {
+	var inboxes []string
+	if err := d.SelectContext(ctx, &inboxes, "SELECT DISTINCT inbox FROM activitypub_followers;"); err != nil {
+		return nil, fmt.Errorf("failed to get activitypub follower inboxes: %w", err)
+	}
+	return inboxes, nil
+}
+
+func (d *postgresDB) GetActivityPubFollowerCount(ctx context.Context) (int, error) {
+	var count int
+	if err := d.GetContext(ctx, &count, "SELECT COUNT(*) FROM activitypub_followers;"); err != nil {
+		return 0, fmt.Errorf("failed to get activitypub follower count: %w", err)
+	}
+	return count, nil
+}
+
+// AddActivityPubFollower adds the follower or updates its inbox if it follows already.
+func (d *postgresDB) AddActivityPubFollower(ctx context.Context, follower ActivityPubFollower) error {
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO activitypub_followers (actor_id, inbox, created_at) VALUES (:actor_id, :inbox, :created_at) ON CONFLICT (actor_id) DO UPDATE SET inbox = excluded.inbox;", follower); err != nil {
+		return fmt.Errorf("failed to add activitypub follower: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) DeleteActivityPubFollower(ctx context.Context, actorID string) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM activitypub_followers WHERE actor_id = $1;", actorID); err != nil {
+		return fmt.Errorf("failed to delete activitypub follower: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) CreateActivityPubNote(ctx context.Context, note ActivityPubNote) error {
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO activitypub_notes (document_id, version, summary, content, created_at) VALUES (:document_id, :version, :summary, :content, :created_at);", note); err != nil {
+		return fmt.Errorf("failed to create activitypub note: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) GetActivityPubNote(ctx context.Context, documentID string) (*ActivityPubNote, error) {
+	var note ActivityPubNote
+	if err := d.GetContext(ctx, &note, "SELECT * FROM activitypub_notes WHERE document_id = $1;", documentID); err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// GetActivityPubNotes returns the newest notes first.
+func (d *postgresDB) GetActivityPubNotes(ctx context.Context, limit int) ([]ActivityPubNote, error) {
+	var notes []ActivityPubNote
+	if err := d.SelectContext(ctx, &notes, "SELECT * FROM activitypub_notes ORDER BY created_at DESC LIMIT $1;", limit); err != nil {
+		return nil, fmt.Errorf("failed to get activitypub notes: %w", err)
+	}
+	return notes, nil
+}
+
+func (d *postgresDB) GetActivityPubNoteCount(ctx context.Context) (int, error) {
+	var count int
+	if err := d.GetContext(ctx, &count, "SELECT COUNT(*) FROM activitypub_notes;"); err != nil {
+		return 0, fmt.Errorf("failed to get activitypub note count: %w", err)
+	}
+	return count, nil
+}
+
+func (d *postgresDB) DeleteActivityPubNote(ctx context.Context, documentID string) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM activitypub_notes WHERE document_id = $1;", documentID); err != nil {
+		return fmt.Errorf("failed to delete activitypub note: %w", err)
+	}
+	return nil
+}
+
+// EncryptSecrets encrypts the webhook secrets, webhook delivery secrets and device tokens which were stored in plaintext
+// before secrets were encrypted. Encrypted values start with enc:, see crypt.IsEncrypted. Webhooks also get the hash of
+// their secret to look them up.
+func (d *postgresDB) EncryptSecrets(ctx context.Context, encrypt func(plaintext string) (string, error)) error {
+	var webhooks []Webhook
+	if err := d.SelectContext(ctx, &webhooks, "SELECT * FROM webhooks WHERE secret NOT LIKE 'enc:%';"); err != nil {
+		return fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	for _, webhook := range webhooks {
+		secret, err := encrypt(webhook.Secret)
+		if err != nil {
+			return err
+		}
+		if _, err = d.ExecContext(ctx, "UPDATE webhooks SET secret = $1, secret_hash = $2 WHERE document_id = $3 AND id = $4 AND secret = $5;", secret, SecretHash(webhook.Secret), webhook.DocumentID, webhook.ID, webhook.Secret); err != nil {
+			return fmt.Errorf("failed to encrypt webhook secret: %w", err)
+		}
+	}
+
+	var deliveries []WebhookDelivery
+	if err := d.SelectContext(ctx, &deliveries, "SELECT * FROM webhook_deliveries WHERE secret NOT LIKE 'enc:%';"); err != nil {
+		return fmt.Errorf("failed to get webhook deliveries: %w", err)
+	}
+	for _, delivery := range deliveries {
+		secret, err := encrypt(delivery.Secret)
+		if err != nil {
+			return err
+		}
+		if _, err = d.ExecContext(ctx, "UPDATE webhook_deliveries SET secret = $1 WHERE id = $2 AND secret = $3;", secret, delivery.ID, delivery.Secret); err != nil {
+			return fmt.Errorf("failed to encrypt webhook delivery secret: %w", err)
+		}
+	}
+
+	var authorizations []DeviceAuthorization
+	if err := d.SelectContext(ctx, &authorizations, "SELECT * FROM device_authorizations WHERE tokens != '' AND tokens NOT LIKE 'enc:%';"); err != nil {
+		return fmt.Errorf("failed to get device authorizations: %w", err)
+	}
+	for _, authorization := range authorizations {
+		tokens, err := encrypt(authorization.Tokens)
+		if err != nil {
+			return err
+		}
+		if _, err = d.ExecContext(ctx, "UPDATE device_authorizations SET tokens = $1 WHERE device_code = $2 AND tokens = $3;", tokens, authorization.DeviceCode, authorization.Tokens); err != nil {
+			return fmt.Errorf("failed to encrypt device tokens: %w", err)
+		}
+	}
+	return nil
+}
+
+func (d *postgresDB) CreateWebhookDelivery(ctx context.Context, delivery WebhookDelivery) error {
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO webhook_deliveries (id, webhook_id, document_id, url, secret, event, payload, status, attempts, created_at, client_certificate) VALUES (:id, :webhook_id, :document_id, :url, :secret, :event, :payload, :status, :attempts, :created_at, :client_certificate);", delivery); err != nil {
+		return fmt.Errorf("failed to create webhook delivery: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) GetWebhookDelivery(ctx context.Context, documentID string, webhookID string, deliveryID string) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	if err := d.GetContext(ctx, &delivery, "SELECT * FROM webhook_deliveries WHERE document_id = $1 AND webhook_id = $2 AND id = $3;", documentID, webhookID, deliveryID); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// GetWebhookDeliveries returns the newest deliveries of the webhook first.
+func (d *postgresDB) GetWebhookDeliveries(ctx context.Context, documentID string, webhookID string, limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	if err := d.SelectContext(ctx, &deliveries, "SELECT * FROM webhook_deliveries WHERE document_id = $1 AND webhook_id = $2 ORDER BY created_at DESC LIMIT $3;", documentID, webhookID, limit); err != nil {
+		return nil, fmt.Errorf("failed to get webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (d *postgresDB) GetPendingWebhookDeliveries(ctx context.Context) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	if err := d.SelectContext(ctx, &deliveries, "SELECT * FROM webhook_deliveries WHERE status = $1 ORDER BY created_at;", WebhookDeliveryPending); err != nil {
+		return nil, fmt.Errorf("failed to get pending webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (d *postgresDB) GetWebhookDeliveryAttempts(ctx context.Context, deliveryIDs []string) ([]WebhookDeliveryAttempt, error) {
+	if len(deliveryIDs) == 0 {
+		return nil, nil
+	}
+	query, args, err := sqlx.In("SELECT * FROM webhook_delivery_attempts WHERE delivery_id IN (?) ORDER BY id;", deliveryIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build webhook delivery attempts query: %w", err)
+	}
+
+	var attempts []WebhookDeliveryAttempt
+	if err = d.SelectContext(ctx, &attempts, d.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("failed to get webhook delivery attempts: %w", err)
+	}
+	return attempts, nil
+}
+
+// AddWebhookDeliveryAttempt records an attempt to send the delivery and updates the status of the delivery.
+func (d *postgresDB) AddWebhookDeliveryAttempt(ctx context.Context, attempt WebhookDeliveryAttempt, status string) error {
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO webhook_delivery_attempts (delivery_id, status_code, error, created_at) VALUES (:delivery_id, :status_code, :error, :created_at);", attempt); err != nil {
+		return fmt.Errorf("failed to create webhook delivery attempt: %w", err)
+	}
+	if _, err := d.ExecContext(ctx, "UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1 WHERE id = $2;", status, attempt.DeliveryID); err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// RedeliverWebhookDelivery marks the delivery as pending again with the current url, secret and client certificate of
+// the webhook.
+func (d *postgresDB) RedeliverWebhookDelivery(ctx context.Context, deliveryID string, url string, secret string, clientCertificate string) error {
+	if _, err := d.ExecContext(ctx, "UPDATE webhook_deliveries SET status = $1, attempts = 0, url = $2, secret = $3, client_certificate = $4 WHERE id = $5;", WebhookDeliveryPending, url, secret, clientCertificate, deliveryID); err != nil {
+		return fmt.Errorf("failed to redeliver webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// DeleteWebhookDeliveriesBefore deletes finished deliveries created before the time together with their attempts.
+func (d *postgresDB) DeleteWebhookDeliveriesBefore(ctx context.Context, before time.Time) error {
+	if _, err := d.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE created_at < $1 AND status != $2;", before, WebhookDeliveryPending); err != nil {
+		return fmt.Errorf("failed to delete webhook deliveries: %w", err)
+	}
+	if _, err := d.ExecContext(ctx, "DELETE FROM webhook_delivery_attempts WHERE delivery_id NOT IN (SELECT id FROM webhook_deliveries);"); err != nil {
+		return fmt.Errorf("failed to delete webhook delivery attempts: %w", err)
+	}
 	return nil
 }
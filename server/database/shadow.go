@@ -0,0 +1,321 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// The kinds of divergences, missing documents were usually created before the shadow database was added.
+const (
+	ShadowDivergenceMissing  = "missing"
+	ShadowDivergenceMismatch = "mismatch"
+	ShadowDivergenceError    = "error"
+)
+
+const (
+	// shadowCompareTimeout is how long a comparison may take to read from the shadow database.
+	shadowCompareTimeout = 10 * time.Second
+	// maxShadowCompares limits the comparisons running at the same time, reads are not compared while it's reached.
+	maxShadowCompares = 16
+)
+
+// NewShadowDB returns a DB which writes document files to the shadow DB as well and compares the document files read
+// from db with the ones of the shadow DB in the background. The compare rate is the share of the reads which are
+// compared between 0 and 1. Divergences are logged and counted, the shadow DB never changes the result of db.
+//
+// Files are copied to the shadow DB with the same key and version, so a migration to it can be verified before
+// switching over. Everything else, like webhooks or accounts, is only written to db.
+func NewShadowDB(db DB, shadow DB, compareRate float64) (DB, error) {
+	meter := otel.Meter("gobin")
+	comparisons, err := meter.Int64Counter("gobin.shadow.comparisons", metric.WithDescription("Reads compared with the shadow database"))
+	if err != nil {
+		return nil, err
+	}
+	divergences, err := meter.Int64Counter("gobin.shadow.divergences", metric.WithDescription("Writes which failed and reads which differed in the shadow database"))
+	if err != nil {
+		return nil, err
+	}
+	return &shadowDB{
+		DB:          db,
+		shadow:      shadow,
+		compareRate: compareRate,
+		compares:    make(chan struct{}, maxShadowCompares),
+		comparisons: comparisons,
+		divergences: divergences,
+	}, nil
+}
+
+type shadowDB struct {
+	DB
+	shadow      DB
+	compareRate float64
+	compares    chan struct{}
+	comparisons metric.Int64Counter
+	divergences metric.Int64Counter
+}
+
+func (d *shadowDB) diverged(ctx context.Context, op string, kind string, documentID string, reason string) {
+	slog.WarnContext(ctx, "shadow database diverged", slog.String("op", op), slog.String("kind", kind), slog.String("document_id", documentID), slog.String("reason", reason))
+	d.divergences.Add(ctx, 1, metric.WithAttributes(attribute.String("op", op), attribute.String("kind", kind)))
+}
+
+// write runs the write on the shadow database after it succeeded on the primary one. Documents which were created
+// before the shadow database was added don't exist there, so missing rows are no divergence.
+func (d *shadowDB) write(ctx context.Context, op string, documentID string, write func(ctx context.Context) error) {
+	if err := write(ctx); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		d.diverged(ctx, op, ShadowDivergenceError, documentID, err.Error())
+	}
+}
+
+// compare reads the files from the shadow database in the background and compares them with the files of the primary
+// database.
+func (d *shadowDB) compare(ctx context.Context, op string, documentID string, files []File, read func(ctx context.Context) ([]File, error)) {
+	if d.compareRate <= 0 || (d.compareRate < 1 && rand.Float64() >= d.compareRate) {
+		return
+	}
+	select {
+	case d.compares <- struct{}{}:
+	default:
+		return
+	}
+
+	// the caller owns the files and may change them
+	files = slices.Clone(files)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shadowCompareTimeout)
+	go func() {
+		defer func() {
+			cancel()
+			<-d.compares
+		}()
+
+		d.comparisons.Add(ctx, 1, metric.WithAttributes(attribute.String("op", op)))
+		shadowFiles, err := read(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			d.diverged(ctx, op, ShadowDivergenceMissing, documentID, "missing in shadow database")
+			return
+		}
+		if err != nil {
+			d.diverged(ctx, op, ShadowDivergenceError, documentID, err.Error())
+			return
+		}
+		if reason := diffFiles(files, shadowFiles); reason != "" {
+			d.diverged(ctx, op, ShadowDivergenceMismatch, documentID, reason)
+		}
+	}()
+}
+
+// diffFiles returns how the shadow files differ from the files or an empty string if they are the same.
+func diffFiles(files []File, shadowFiles []File) string {
+	if len(files) != len(shadowFiles) {
+		return fmt.Sprintf("has %d instead of %d files", len(shadowFiles), len(files))
+	}
+	for i, file := range files {
+		shadowFile := shadowFiles[i]
+		switch {
+		case file.Name != shadowFile.Name:
+			return fmt.Sprintf("file %d is %q instead of %q", i, shadowFile.Name, file.Name)
+		case file.DocumentVersion != shadowFile.DocumentVersion:
+			return fmt.Sprintf("file %q has version %d instead of %d", file.Name, shadowFile.DocumentVersion, file.DocumentVersion)
+		case file.Content != shadowFile.Content:
+			return fmt.Sprintf("file %q has a different content", file.Name)
+		case file.Language != shadowFile.Language:
+			return fmt.Sprintf("file %q has language %q instead of %q", file.Name, shadowFile.Language, file.Language)
+		case file.Encrypted != shadowFile.Encrypted:
+			return fmt.Sprintf("file %q is encrypted: %t instead of %t", file.Name, shadowFile.Encrypted, file.Encrypted)
+		case !equalTime(file.ExpiresAt, shadowFile.ExpiresAt):
+			return fmt.Sprintf("file %q expires at %v instead of %v", file.Name, shadowFile.ExpiresAt, file.ExpiresAt)
+		}
+	}
+	return ""
+}
+
+func equalTime(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func (d *shadowDB) GetDocument(ctx context.Context, documentID string) ([]File, error) {
+	files, err := d.DB.GetDocument(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	d.compare(ctx, "get_document", documentID, files, func(ctx context.Context) ([]File, error) {
+		return d.shadow.GetDocument(ctx, documentID)
+	})
+	return files, nil
+}
+
+func (d *shadowDB) GetDocumentVersion(ctx context.Context, documentID string, documentVersion int64) ([]File, error) {
+	files, err := d.DB.GetDocumentVersion(ctx, documentID, documentVersion)
+	if err != nil {
+		return nil, err
+	}
+	d.compare(ctx, "get_document_version", documentID, files, func(ctx context.Context) ([]File, error) {
+		return d.shadow.GetDocumentVersion(ctx, documentID, documentVersion)
+	})
+	return files, nil
+}
+
+func (d *shadowDB) GetDocumentFile(ctx context.Context, documentID string, fileName string) (*File, error) {
+	file, err := d.DB.GetDocumentFile(ctx, documentID, fileName)
+	if err != nil {
+		return nil, err
+	}
+	d.compare(ctx, "get_document_file", documentID, []File{*file}, func(ctx context.Context) ([]File, error) {
+		shadowFile, err := d.shadow.GetDocumentFile(ctx, documentID, fileName)
+		if err != nil {
+			return nil, err
+		}
+		return []File{*shadowFile}, nil
+	})
+	return file, nil
+}
+
+func (d *shadowDB) GetDocumentFileVersion(ctx context.Context, documentID string, documentVersion int64, fileName string) (*File, error) {
+	file, err := d.DB.GetDocumentFileVersion(ctx, documentID, documentVersion, fileName)
+	if err != nil {
+		return nil, err
+	}
+	d.compare(ctx, "get_document_file_version", documentID, []File{*file}, func(ctx context.Context) ([]File, error) {
+		shadowFile, err := d.shadow.GetDocumentFileVersion(ctx, documentID, documentVersion, fileName)
+		if err != nil {
+			return nil, err
+		}
+		return []File{*shadowFile}, nil
+	})
+	return file, nil
+}
+
+func (d *shadowDB) CreateDocument(ctx context.Context, documentID string, files []File) (*string, *int64, error) {
+	newDocumentID, version, err := d.DB.CreateDocument(ctx, documentID, files)
+	if err != nil {
+		return nil, nil, err
+	}
+	d.write(ctx, "create_document", *newDocumentID, func(ctx context.Context) error {
+		return d.shadow.ImportDocumentVersion(ctx, *newDocumentID, *version, slices.Clone(files))
+	})
+	return newDocumentID, version, nil
+}
+
+func (d *shadowDB) UpdateDocument(ctx context.Context, documentID string, files []File) (*int64, error) {
+	version, err := d.DB.UpdateDocument(ctx, documentID, files)
+	if err != nil {
+		return nil, err
+	}
+	d.write(ctx, "update_document", documentID, func(ctx context.Context) error {
+		return d.shadow.ImportDocumentVersion(ctx, documentID, *version, slices.Clone(files))
+	})
+	return version, nil
+}
+
+func (d *shadowDB) ImportDocumentVersion(ctx context.Context, documentID string, documentVersion int64, files []File) error {
+	if err := d.DB.ImportDocumentVersion(ctx, documentID, documentVersion, files); err != nil {
+		return err
+	}
+	d.write(ctx, "import_document_version", documentID, func(ctx context.Context) error {
+		return d.shadow.ImportDocumentVersion(ctx, documentID, documentVersion, slices.Clone(files))
+	})
+	return nil
+}
+
+func (d *shadowDB) DeleteDocument(ctx context.Context, documentID string) (*Document, error) {
+	document, err := d.DB.DeleteDocument(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	d.write(ctx, "delete_document", documentID, func(ctx context.Context) error {
+		_, err := d.shadow.DeleteDocument(ctx, documentID)
+		return err
+	})
+	return document, nil
+}
+
+func (d *shadowDB) DeleteDocumentVersion(ctx context.Context, documentID string, documentVersion int64) (*Document, error) {
+	document, err := d.DB.DeleteDocumentVersion(ctx, documentID, documentVersion)
+	if err != nil {
+		return nil, err
+	}
+	d.write(ctx, "delete_document_version", documentID, func(ctx context.Context) error {
+		_, err := d.shadow.DeleteDocumentVersion(ctx, documentID, documentVersion)
+		return err
+	})
+	return document, nil
+}
+
+func (d *shadowDB) DeleteDocumentVersions(ctx context.Context, documentID string) error {
+	if err := d.DB.DeleteDocumentVersions(ctx, documentID); err != nil {
+		return err
+	}
+	d.write(ctx, "delete_document_versions", documentID, func(ctx context.Context) error {
+		return d.shadow.DeleteDocumentVersions(ctx, documentID)
+	})
+	return nil
+}
+
+func (d *shadowDB) DeleteExpiredDocuments(ctx context.Context, expireAfter time.Duration) ([]Document, error) {
+	documents, err := d.DB.DeleteExpiredDocuments(ctx, expireAfter)
+	if err != nil {
+		return nil, err
+	}
+	d.write(ctx, "delete_expired_documents", "", func(ctx context.Context) error {
+		_, err := d.shadow.DeleteExpiredDocuments(ctx, expireAfter)
+		return err
+	})
+	return documents, nil
+}
+
+func (d *shadowDB) DeleteDocumentFile(ctx context.Context, documentID string, fileName string) error {
+	if err := d.DB.DeleteDocumentFile(ctx, documentID, fileName); err != nil {
+		return err
+	}
+	d.write(ctx, "delete_document_file", documentID, func(ctx context.Context) error {
+		return d.shadow.DeleteDocumentFile(ctx, documentID, fileName)
+	})
+	return nil
+}
+
+func (d *shadowDB) DeleteDocumentVersionFile(ctx context.Context, documentID string, documentVersion int64, fileName string) error {
+	if err := d.DB.DeleteDocumentVersionFile(ctx, documentID, documentVersion, fileName); err != nil {
+		return err
+	}
+	d.write(ctx, "delete_document_version_file", documentID, func(ctx context.Context) error {
+		return d.shadow.DeleteDocumentVersionFile(ctx, documentID, documentVersion, fileName)
+	})
+	return nil
+}
+
+func (d *shadowDB) ApplyTombstone(ctx context.Context, tombstone Tombstone) error {
+	if err := d.DB.ApplyTombstone(ctx, tombstone); err != nil {
+		return err
+	}
+	d.write(ctx, "apply_tombstone", tombstone.DocumentID, func(ctx context.Context) error {
+		return d.shadow.ApplyTombstone(ctx, tombstone)
+	})
+	return nil
+}
+
+func (d *shadowDB) DeleteTombstonesBefore(ctx context.Context, before time.Time) error {
+	if err := d.DB.DeleteTombstonesBefore(ctx, before); err != nil {
+		return err
+	}
+	d.write(ctx, "delete_tombstones_before", "", func(ctx context.Context) error {
+		return d.shadow.DeleteTombstonesBefore(ctx, before)
+	})
+	return nil
+}
+
+func (d *shadowDB) Close() error {
+	return errors.Join(d.DB.Close(), d.shadow.Close())
+}
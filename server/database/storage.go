@@ -0,0 +1,307 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/topi314/gobin/v3/server/storage"
+)
+
+// NewStorageDB returns a DB which keeps the content of document files in the storage while the metadata stays in the
+// database. Files created before the storage was configured keep their content in the database. Revisions are not
+// moved to the storage since they are removed once they are reviewed.
+func NewStorageDB(db DB, store storage.Storage) DB {
+	return &storageDB{
+		DB:      db,
+		storage: store,
+	}
+}
+
+type storageDB struct {
+	DB
+	storage storage.Storage
+}
+
+func objectKey(documentID string, documentVersion int64, fileName string) string {
+	return documentPrefix(documentID) + strconv.FormatInt(documentVersion, 10) + "/" + url.PathEscape(fileName)
+}
+
+func documentPrefix(documentID string) string {
+	return documentID + "/"
+}
+
+func withoutContent(files []File) []File {
+	newFiles := make([]File, len(files))
+	for i, file := range files {
+		file.Content = ""
+		newFiles[i] = file
+	}
+	return newFiles
+}
+
+// loadContents fills in the content of the files which have no content in the database.
+func (d *storageDB) loadContents(ctx context.Context, files []File) error {
+	for i, file := range files {
+		if file.Content != "" {
+			continue
+		}
+		content, err := d.storage.Get(ctx, objectKey(file.DocumentID, file.DocumentVersion, file.Name))
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get file content: %w", err)
+		}
+		files[i].Content = content
+	}
+	return nil
+}
+
+func (d *storageDB) storeContents(ctx context.Context, files []File) error {
+	for _, file := range files {
+		if err := d.storage.Put(ctx, objectKey(file.DocumentID, file.DocumentVersion, file.Name), file.Content); err != nil {
+			return fmt.Errorf("failed to store file content: %w", err)
+		}
+	}
+	return nil
+}
+
+func (d *storageDB) deleteContents(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := d.storage.Delete(ctx, key); err != nil {
+			slog.ErrorContext(ctx, "failed to delete file content", slog.String("key", key), slog.Any("err", err))
+		}
+	}
+}
+
+// syncContents deletes the contents of all files of the document which are no longer in the database.
+func (d *storageDB) syncContents(ctx context.Context, documentID string) {
+	keys, err := d.storage.List(ctx, documentPrefix(documentID))
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to list file contents", slog.String("document_id", documentID), slog.Any("err", err))
+		return
+	}
+
+	versions, err := d.DB.GetDocumentVersionsWithFiles(ctx, documentID, false)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		slog.ErrorContext(ctx, "failed to get document files", slog.String("document_id", documentID), slog.Any("err", err))
+		return
+	}
+
+	existing := make(map[string]struct{})
+	for _, files := range versions {
+		for _, file := range files {
+			existing[objectKey(file.DocumentID, file.DocumentVersion, file.Name)] = struct{}{}
+		}
+	}
+
+	var orphaned []string
+	for _, key := range keys {
+		if _, ok := existing[key]; !ok {
+			orphaned = append(orphaned, key)
+		}
+	}
+	d.deleteContents(ctx, orphaned)
+}
+
+func (d *storageDB) GetDocument(ctx context.Context, documentID string) ([]File, error) {
+	files, err := d.DB.GetDocument(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.loadContents(ctx, files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (d *storageDB) GetDocumentVersion(ctx context.Context, documentID string, documentVersion int64) ([]File, error) {
+	files, err := d.DB.GetDocumentVersion(ctx, documentID, documentVersion)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.loadContents(ctx, files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (d *storageDB) GetDocumentVersionsWithFiles(ctx context.Context, documentID string, withContent bool) (map[int64][]File, error) {
+	versions, err := d.DB.GetDocumentVersionsWithFiles(ctx, documentID, withContent)
+	if err != nil || !withContent {
+		return versions, err
+	}
+	for _, files := range versions {
+		if err = d.loadContents(ctx, files); err != nil {
+			return nil, err
+		}
+	}
+	return versions, nil
+}
+
+func (d *storageDB) CreateDocument(ctx context.Context, documentID string, files []File) (*string, *int64, error) {
+	// the checksums are set before the content is removed
+	setChecksums(files)
+	dbFiles := withoutContent(files)
+	newDocumentID, version, err := d.DB.CreateDocument(ctx, documentID, dbFiles)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range files {
+		files[i].DocumentID = *newDocumentID
+		files[i].DocumentVersion = *version
+	}
+
+	if err = d.storeContents(ctx, files); err != nil {
+		if _, deleteErr := d.DB.DeleteDocument(ctx, *newDocumentID); deleteErr != nil {
+			slog.ErrorContext(ctx, "failed to delete document without content", slog.String("document_id", *newDocumentID), slog.Any("err", deleteErr))
+		}
+		d.syncContents(ctx, *newDocumentID)
+		return nil, nil, err
+	}
+	return newDocumentID, version, nil
+}
+
+func (d *storageDB) UpdateDocument(ctx context.Context, documentID string, files []File) (*int64, error) {
+	// the checksums are set before the content is removed
+	setChecksums(files)
+	dbFiles := withoutContent(files)
+	version, err := d.DB.UpdateDocument(ctx, documentID, dbFiles)
+	if err != nil {
+		return nil, err
+	}
+	for i := range files {
+		files[i].DocumentID = documentID
+		files[i].DocumentVersion = *version
+	}
+
+	if err = d.storeContents(ctx, files); err != nil {
+		if _, deleteErr := d.DB.DeleteDocumentVersion(ctx, documentID, *version); deleteErr != nil {
+			slog.ErrorContext(ctx, "failed to delete document version without content", slog.String("document_id", documentID), slog.Any("err", deleteErr))
+		}
+		d.syncContents(ctx, documentID)
+		return nil, err
+	}
+	return version, nil
+}
+
+func (d *storageDB) ImportDocumentVersion(ctx context.Context, documentID string, documentVersion int64, files []File) error {
+	for i := range files {
+		files[i].DocumentID = documentID
+		files[i].DocumentVersion = documentVersion
+	}
+	setChecksums(files)
+	if err := d.storeContents(ctx, files); err != nil {
+		return err
+	}
+	if err := d.DB.ImportDocumentVersion(ctx, documentID, documentVersion, withoutContent(files)); err != nil {
+		d.syncContents(ctx, documentID)
+		return err
+	}
+	return nil
+}
+
+func (d *storageDB) DeleteDocument(ctx context.Context, documentID string) (*Document, error) {
+	document, err := d.DB.DeleteDocument(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.loadContents(ctx, document.Files); err != nil {
+		slog.ErrorContext(ctx, "failed to get deleted file contents", slog.String("document_id", documentID), slog.Any("err", err))
+	}
+	d.syncContents(ctx, documentID)
+	return document, nil
+}
+
+func (d *storageDB) DeleteDocumentVersion(ctx context.Context, documentID string, documentVersion int64) (*Document, error) {
+	document, err := d.DB.DeleteDocumentVersion(ctx, documentID, documentVersion)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.loadContents(ctx, document.Files); err != nil {
+		slog.ErrorContext(ctx, "failed to get deleted file contents", slog.String("document_id", documentID), slog.Any("err", err))
+	}
+
+	keys := make([]string, len(document.Files))
+	for i, file := range document.Files {
+		keys[i] = objectKey(file.DocumentID, file.DocumentVersion, file.Name)
+	}
+	d.deleteContents(ctx, keys)
+	return document, nil
+}
+
+func (d *storageDB) DeleteDocumentVersions(ctx context.Context, documentID string) error {
+	if err := d.DB.DeleteDocumentVersions(ctx, documentID); err != nil {
+		return err
+	}
+	d.syncContents(ctx, documentID)
+	return nil
+}
+
+func (d *storageDB) DeleteExpiredDocuments(ctx context.Context, expireAfter time.Duration) ([]Document, error) {
+	documents, err := d.DB.DeleteExpiredDocuments(ctx, expireAfter)
+	if err != nil {
+		return nil, err
+	}
+	for _, document := range documents {
+		if err = d.loadContents(ctx, document.Files); err != nil {
+			slog.ErrorContext(ctx, "failed to get expired file contents", slog.String("document_id", document.ID), slog.Any("err", err))
+		}
+		d.syncContents(ctx, document.ID)
+	}
+	return documents, nil
+}
+
+func (d *storageDB) ApplyTombstone(ctx context.Context, tombstone Tombstone) error {
+	if err := d.DB.ApplyTombstone(ctx, tombstone); err != nil {
+		return err
+	}
+	d.syncContents(ctx, tombstone.DocumentID)
+	return nil
+}
+
+func (d *storageDB) GetDocumentFile(ctx context.Context, documentID string, fileName string) (*File, error) {
+	file, err := d.DB.GetDocumentFile(ctx, documentID, fileName)
+	if err != nil {
+		return nil, err
+	}
+	files := []File{*file}
+	if err = d.loadContents(ctx, files); err != nil {
+		return nil, err
+	}
+	return &files[0], nil
+}
+
+func (d *storageDB) GetDocumentFileVersion(ctx context.Context, documentID string, documentVersion int64, fileName string) (*File, error) {
+	file, err := d.DB.GetDocumentFileVersion(ctx, documentID, documentVersion, fileName)
+	if err != nil {
+		return nil, err
+	}
+	files := []File{*file}
+	if err = d.loadContents(ctx, files); err != nil {
+		return nil, err
+	}
+	return &files[0], nil
+}
+
+func (d *storageDB) DeleteDocumentFile(ctx context.Context, documentID string, fileName string) error {
+	if err := d.DB.DeleteDocumentFile(ctx, documentID, fileName); err != nil {
+		return err
+	}
+	d.syncContents(ctx, documentID)
+	return nil
+}
+
+func (d *storageDB) DeleteDocumentVersionFile(ctx context.Context, documentID string, documentVersion int64, fileName string) error {
+	if err := d.DB.DeleteDocumentVersionFile(ctx, documentID, documentVersion, fileName); err != nil {
+		return err
+	}
+	d.deleteContents(ctx, []string{objectKey(documentID, documentVersion, fileName)})
+	return nil
+}
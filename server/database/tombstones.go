@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrDocumentVersionDeleted is returned when importing a document version which has a tombstone.
+var ErrDocumentVersionDeleted = errors.New("document version was deleted")
+
+const maxTombstoneBatch = 1000
+
+// deleteFiles runs the delete query which returns the deleted files and records the tombstones for them in the same
+// transaction, so no deletion is ever missing in a backup.
+func deleteFiles(ctx context.Context, db *sqlx.DB, tombstones func(files []File) []Tombstone, query string, args ...any) ([]File, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var files []File
+	if err = tx.SelectContext(ctx, &files, query, args...); err != nil {
+		return nil, err
+	}
+	// expired documents can produce more tombstones than the database accepts parameters in a single query
+	for batch := range slices.Chunk(tombstones(files), maxTombstoneBatch) {
+		if _, err = tx.NamedExecContext(ctx, "INSERT INTO document_tombstones (document_id, document_version, deleted_at, reason) VALUES (:document_id, :document_version, :deleted_at, :reason) ON CONFLICT (document_id, document_version) DO UPDATE SET deleted_at = excluded.deleted_at, reason = excluded.reason;", batch); err != nil {
+			return nil, fmt.Errorf("failed to create tombstones: %w", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// documentTombstone returns a tombstone for the whole document if any of its files were deleted.
+func documentTombstone(documentID string, reason string) func(files []File) []Tombstone {
+	return func(files []File) []Tombstone {
+		if len(files) == 0 {
+			return nil
+		}
+		return []Tombstone{{
+			DocumentID: documentID,
+			DeletedAt:  time.Now(),
+			Reason:     reason,
+		}}
+	}
+}
+
+// versionTombstones returns a tombstone for every document version of the deleted files.
+func versionTombstones(reason string) func(files []File) []Tombstone {
+	return func(files []File) []Tombstone {
+		now := time.Now()
+		seen := make(map[Tombstone]struct{})
+		var tombstones []Tombstone
+		for _, file := range files {
+			tombstone := Tombstone{
+				DocumentID:      file.DocumentID,
+				DocumentVersion: file.DocumentVersion,
+				DeletedAt:       now,
+				Reason:          reason,
+			}
+			if _, ok := seen[tombstone]; ok {
+				continue
+			}
+			seen[tombstone] = struct{}{}
+			tombstones = append(tombstones, tombstone)
+		}
+		return tombstones
+	}
+}
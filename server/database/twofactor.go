@@ -0,0 +1,30 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// setRecoveryCodes replaces the recovery codes of the account in a transaction, so the old codes stay valid if the new
+// ones can't be stored.
+func setRecoveryCodes(ctx context.Context, db *sqlx.DB, accountID string, codeHashes []string) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM account_recovery_codes WHERE account_id = $1;", accountID); err != nil {
+		return fmt.Errorf("failed to delete account recovery codes: %w", err)
+	}
+	for _, codeHash := range codeHashes {
+		if _, err = tx.ExecContext(ctx, "INSERT INTO account_recovery_codes (account_id, code_hash) VALUES ($1, $2);", accountID, codeHash); err != nil {
+			return fmt.Errorf("failed to create account recovery code: %w", err)
+		}
+	}
+	return tx.Commit()
+}
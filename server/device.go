@@ -0,0 +1,398 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+	"github.com/topi314/gobin/v3/server/templates"
+)
+
+// The device authorization errors use the error codes of RFC 8628, so clients can tell them apart.
+var (
+	ErrDeviceAuthDisabled            = errors.New("device authorization disabled")
+	ErrMissingDeviceCode             = errors.New("missing device code")
+	ErrMissingUserCode               = errors.New("missing user code")
+	ErrMissingDeviceDocuments        = errors.New("no documents provided")
+	ErrDeviceAuthorizationNotPending = errors.New("login code is invalid, expired or was already used")
+)
+
+// userCodeChars leaves out vowels to avoid words and similar looking characters.
+const userCodeChars = "BCDFGHJKLMNPQRSTVWXZ"
+
+// defaultDevicePermissions are requested if the device does not request any permissions.
+var defaultDevicePermissions = []string{"write", "delete"}
+
+type (
+	DeviceApproveRequest struct {
+		UserCode  string                  `json:"user_code"`
+		Documents []api.ReadTokenDocument `json:"documents"`
+	}
+
+	DeviceDenyRequest struct {
+		UserCode string `json:"user_code"`
+	}
+)
+
+// PostDeviceCode starts a device authorization. The user approves it in the browser while the device polls for the
+// tokens.
+func (s *Server) PostDeviceCode(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.DeviceAuth.Enabled {
+		s.error(w, r, httperr.NotFound(ErrDeviceAuthDisabled))
+		return
+	}
+
+	var rq api.DeviceCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&rq); err != nil && !errors.Is(err, io.EOF) {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+	if len(rq.Permissions) == 0 {
+		rq.Permissions = defaultDevicePermissions
+	}
+	for _, permission := range rq.Permissions {
+		if !slices.Contains(api.AllStringPermissions, permission) {
+			s.error(w, r, httperr.BadRequest(ErrUnknownPermission(permission)))
+			return
+		}
+	}
+	if rq.Account && !s.cfg.Accounts.Enabled {
+		s.error(w, r, httperr.NotFound(ErrAccountsDisabled))
+		return
+	}
+
+	userCode, err := newUserCode()
+	if err != nil {
+		s.error(w, r, fmt.Errorf("failed to generate user code: %w", err))
+		return
+	}
+	expiry := time.Duration(s.cfg.DeviceAuth.Expiry)
+	authorization := database.DeviceAuthorization{
+		DeviceCode:  rand.Text(),
+		UserCode:    userCode,
+		Permissions: strings.Join(rq.Permissions, ","),
+		Status:      database.DeviceAuthorizationPending,
+		ExpiresAt:   time.Now().Add(expiry),
+		Account:     rq.Account,
+	}
+	if err = s.db.CreateDeviceAuthorization(r.Context(), authorization); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	verificationURI := "https://" + r.Host + "/device"
+	s.ok(w, r, api.DeviceCodeResponse{
+		DeviceCode:              authorization.DeviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?code=" + url.QueryEscape(userCode),
+		ExpiresIn:               int(expiry.Seconds()),
+		Interval:                int(time.Duration(s.cfg.DeviceAuth.Interval).Seconds()),
+	})
+}
+
+// PostDeviceToken returns the document tokens of an approved device authorization. The tokens can only be fetched once.
+// Devices which requested an account token get a new session of the account which approved them, so the session shows
+// the device instead of the browser.
+func (s *Server) PostDeviceToken(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.DeviceAuth.Enabled {
+		s.error(w, r, httperr.NotFound(ErrDeviceAuthDisabled))
+		return
+	}
+
+	var rq api.DeviceTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&rq); err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+	if rq.DeviceCode == "" {
+		s.error(w, r, httperr.BadRequest(ErrMissingDeviceCode))
+		return
+	}
+
+	authorization, err := s.db.GetDeviceAuthorization(r.Context(), rq.DeviceCode)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.BadRequest(api.ErrDeviceAuthorizationExpired))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+
+	now := time.Now()
+	if now.After(authorization.ExpiresAt) {
+		s.error(w, r, httperr.BadRequest(api.ErrDeviceAuthorizationExpired))
+		return
+	}
+
+	switch authorization.Status {
+	case database.DeviceAuthorizationPending:
+		if err = s.db.UpdateDeviceAuthorizationPolledAt(r.Context(), rq.DeviceCode, now); err != nil {
+			s.error(w, r, err)
+			return
+		}
+		if authorization.LastPolledAt != nil && now.Sub(*authorization.LastPolledAt) < time.Duration(s.cfg.DeviceAuth.Interval) {
+			s.error(w, r, httperr.BadRequest(api.ErrDeviceAuthorizationSlowDown))
+			return
+		}
+		s.error(w, r, httperr.BadRequest(api.ErrDeviceAuthorizationPending))
+		return
+	case database.DeviceAuthorizationDenied:
+		if err = s.db.DeleteDeviceAuthorization(r.Context(), rq.DeviceCode); err != nil {
+			slog.ErrorContext(r.Context(), "failed to delete device authorization", slog.Any("err", err))
+		}
+		s.error(w, r, httperr.BadRequest(api.ErrDeviceAuthorizationDenied))
+		return
+	}
+
+	data, err := s.secrets.Decrypt(r.Context(), authorization.Tokens)
+	if err != nil {
+		s.error(w, r, fmt.Errorf("failed to decrypt device tokens: %w", err))
+		return
+	}
+	var tokens []api.DeviceToken
+	if err = json.Unmarshal([]byte(data), &tokens); err != nil {
+		s.error(w, r, fmt.Errorf("failed to decode device tokens: %w", err))
+		return
+	}
+	if err = s.db.DeleteDeviceAuthorization(r.Context(), rq.DeviceCode); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	response := api.DeviceTokenResponse{Tokens: tokens}
+	if authorization.AccountID != "" {
+		if response.AccountToken, _, err = s.newAccountToken(r, authorization.AccountID, AccountSessionKindToken, authorization.TwoFactor); err != nil {
+			s.error(w, r, err)
+			return
+		}
+	}
+	s.ok(w, r, response)
+}
+
+// PostDeviceApprove approves a device authorization. The user has to prove access to every document with one of its
+// tokens, the device gets a new token per document with the requested permissions the proven token has. Devices which
+// requested an account token have to be approved by a logged-in browser and don't need documents.
+func (s *Server) PostDeviceApprove(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.DeviceAuth.Enabled {
+		s.error(w, r, httperr.NotFound(ErrDeviceAuthDisabled))
+		return
+	}
+
+	var rq DeviceApproveRequest
+	if err := json.NewDecoder(r.Body).Decode(&rq); err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+	if rq.UserCode == "" {
+		s.error(w, r, httperr.BadRequest(ErrMissingUserCode))
+		return
+	}
+
+	ctx, span := s.tracer.Start(r.Context(), "approveDevice", trace.WithAttributes(
+		attribute.Int("documents", len(rq.Documents)),
+	))
+	defer span.End()
+
+	authorization, err := s.db.GetDeviceAuthorizationByUserCode(ctx, normalizeUserCode(rq.UserCode))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrDeviceAuthorizationNotPending))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+
+	var (
+		accountID string
+		twoFactor bool
+	)
+	if authorization.Account {
+		session, err := s.requireAccountSession(r)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+		accountID = session.AccountID
+		// the token of the device is as trusted as the login which approved it
+		twoFactor = session.TwoFactor
+	} else if len(rq.Documents) == 0 {
+		s.error(w, r, httperr.BadRequest(ErrMissingDeviceDocuments))
+		return
+	}
+	requested := strings.Split(authorization.Permissions, ",")
+
+	tokens := make([]api.DeviceToken, 0, len(rq.Documents))
+	for _, document := range rq.Documents {
+		claims, ok := s.documentTokenClaims(r.Context(), document.Key, document.Token)
+		if !ok {
+			s.error(w, r, httperr.Forbidden(ErrInvalidDocumentToken(document.Key)))
+			return
+		}
+
+		// only grant the requested permissions the proven token has
+		var (
+			perms       Permissions
+			stringPerms []string
+		)
+		for _, permission := range requested {
+			perm, err := parsePermissions(claims.Permissions, []string{permission})
+			if err != nil {
+				continue
+			}
+			perms |= perm
+			stringPerms = append(stringPerms, permission)
+		}
+		if perms == 0 {
+			s.error(w, r, httperr.Forbidden(ErrPermissionDenied(authorization.Permissions)))
+			return
+		}
+
+		token, err := s.NewToken(document.Key, perms)
+		if err != nil {
+			s.error(w, r, fmt.Errorf("failed to create new token: %w", err))
+			return
+		}
+		tokens = append(tokens, api.DeviceToken{
+			Key:         document.Key,
+			Token:       token,
+			Permissions: stringPerms,
+		})
+	}
+
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		s.error(w, r, fmt.Errorf("failed to encode device tokens: %w", err))
+		return
+	}
+	encryptedTokens, err := s.secrets.Encrypt(ctx, string(data))
+	if err != nil {
+		s.error(w, r, fmt.Errorf("failed to encrypt device tokens: %w", err))
+		return
+	}
+	if err = s.db.UpdateDeviceAuthorizationStatus(ctx, authorization.UserCode, database.DeviceAuthorizationApproved, encryptedTokens, accountID, twoFactor); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrDeviceAuthorizationNotPending))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+
+	for _, token := range tokens {
+		s.RecordEvent(ctx, EventShare, token.Key, 0, EventShareData{
+			Permissions: token.Permissions,
+		})
+	}
+
+	s.ok(w, r, nil)
+}
+
+// PostDeviceDeny denies a device authorization.
+func (s *Server) PostDeviceDeny(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.DeviceAuth.Enabled {
+		s.error(w, r, httperr.NotFound(ErrDeviceAuthDisabled))
+		return
+	}
+
+	var rq DeviceDenyRequest
+	if err := json.NewDecoder(r.Body).Decode(&rq); err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+	if rq.UserCode == "" {
+		s.error(w, r, httperr.BadRequest(ErrMissingUserCode))
+		return
+	}
+
+	if err := s.db.UpdateDeviceAuthorizationStatus(r.Context(), normalizeUserCode(rq.UserCode), database.DeviceAuthorizationDenied, "", "", false); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrDeviceAuthorizationNotPending))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, nil)
+}
+
+// GetPrettyDevice renders the page to approve a device authorization.
+func (s *Server) GetPrettyDevice(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.DeviceAuth.Enabled {
+		s.prettyError(w, r, httperr.NotFound(ErrDeviceAuthDisabled))
+		return
+	}
+
+	vars := templates.DeviceVars{
+		UserCode: normalizeUserCode(r.URL.Query().Get("code")),
+		Assets:   s.assetManifest,
+	}
+	if vars.UserCode != "" {
+		authorization, err := s.db.GetDeviceAuthorizationByUserCode(r.Context(), vars.UserCode)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			s.prettyError(w, r, err)
+			return
+		}
+		if authorization == nil || authorization.Status != database.DeviceAuthorizationPending || time.Now().After(authorization.ExpiresAt) {
+			vars.Error = ErrDeviceAuthorizationNotPending.Error()
+		} else {
+			vars.Permissions = strings.Split(authorization.Permissions, ",")
+			vars.Account = authorization.Account
+			if account, err := s.getAccount(r); err == nil {
+				vars.AccountName = account.Name
+			}
+		}
+	}
+
+	setColorSchemeHints(w)
+	style := s.getStyle(r)
+	vars.Style = style.Name
+	vars.Theme = style.Theme
+	if err := templates.Device(vars).Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "failed to execute template", slog.Any("err", err))
+	}
+}
+
+// newUserCode returns a random code like BCDF-GHJK which is easy to type on another device.
+func newUserCode() (string, error) {
+	var code strings.Builder
+	for i := range 8 {
+		if i == 4 {
+			code.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(userCodeChars))))
+		if err != nil {
+			return "", err
+		}
+		code.WriteByte(userCodeChars[n.Int64()])
+	}
+	return code.String(), nil
+}
+
+// normalizeUserCode makes entering the user code case and dash insensitive.
+func normalizeUserCode(userCode string) string {
+	userCode = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(userCode))
+	if len(userCode) != 8 {
+		return userCode
+	}
+	return userCode[:4] + "-" + userCode[4:]
+}
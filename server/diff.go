@@ -0,0 +1,155 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/diff"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+// DiffContext is the number of unchanged lines shown around each change of a diff.
+const DiffContext = 3
+
+var ErrDocumentVersionNotFound = errors.New("document version not found")
+
+// GetDocumentDiff returns a unified diff for each changed file between two versions of a document. To defaults to the
+// latest version and from to the version before to.
+func (s *Server) GetDocumentDiff(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+	query := r.URL.Query()
+
+	var from, to int64
+	for _, version := range []struct {
+		param   string
+		version *int64
+	}{{"from", &from}, {"to", &to}} {
+		versionStr := query.Get(version.param)
+		if versionStr == "" {
+			continue
+		}
+		v, err := strconv.ParseInt(versionStr, 10, 64)
+		if err != nil || v <= 0 {
+			s.error(w, r, httperr.BadRequest(ErrInvalidDocumentVersion))
+			return
+		}
+		*version.version = v
+	}
+
+	ctx, span := s.tracer.Start(r.Context(), "getDocumentDiff", trace.WithAttributes(
+		attribute.String("document_id", documentID),
+		attribute.Int64("from", from),
+		attribute.Int64("to", to),
+	))
+	defer span.End()
+
+	// versions are sorted from newest to oldest
+	versions, err := s.db.GetDocumentVersions(ctx, documentID)
+	if err != nil {
+		s.error(w, r, fmt.Errorf("failed to get document versions: %w", err))
+		return
+	}
+	if len(versions) == 0 {
+		s.error(w, r, httperr.NotFound(ErrDocumentNotFound))
+		return
+	}
+
+	toIndex := 0
+	if to != 0 {
+		if toIndex = slices.Index(versions, to); toIndex == -1 {
+			s.error(w, r, httperr.NotFound(ErrDocumentVersionNotFound))
+			return
+		}
+	}
+	to = versions[toIndex]
+	if from == 0 && toIndex+1 < len(versions) {
+		from = versions[toIndex+1]
+	} else if from != 0 && !slices.Contains(versions, from) {
+		s.error(w, r, httperr.NotFound(ErrDocumentVersionNotFound))
+		return
+	}
+
+	var fromFiles []database.File
+	if from != 0 {
+		if fromFiles, err = s.getDiffDocumentFiles(r, documentID, from); err != nil {
+			s.error(w, r, err)
+			return
+		}
+	}
+	toFiles, err := s.getDiffDocumentFiles(r, documentID, to)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	files := make([]api.DiffFile, 0)
+	for _, pair := range pairFiles(fromFiles, toFiles) {
+		if file := diffFiles(pair[0], pair[1]); file.Diff != "" {
+			files = append(files, file)
+		}
+	}
+
+	s.ok(w, r, api.DiffResponse{
+		Key:   documentID,
+		From:  from,
+		To:    to,
+		Files: files,
+	})
+}
+
+func (s *Server) getDiffDocumentFiles(r *http.Request, documentID string, version int64) ([]database.File, error) {
+	files, err := s.db.GetDocumentVersion(r.Context(), documentID, version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, httperr.NotFound(ErrDocumentVersionNotFound)
+		}
+		return nil, fmt.Errorf("failed to get document version: %w", err)
+	}
+	if slices.ContainsFunc(files, isEncrypted) {
+		return nil, httperr.BadRequest(ErrFileEncrypted)
+	}
+	return files, nil
+}
+
+// diffFiles returns the unified diff of a file pair, the names use the a/ and b/ prefixes of git.
+func diffFiles(a *database.File, b *database.File) api.DiffFile {
+	var (
+		file     api.DiffFile
+		aContent string
+		bContent string
+		aName    = "/dev/null"
+		bName    = "/dev/null"
+	)
+	if a != nil {
+		file.OldName = a.Name
+		aContent = a.Content
+		aName = "a/" + a.Name
+	}
+	if b != nil {
+		file.NewName = b.Name
+		bContent = b.Content
+		bName = "b/" + b.Name
+	}
+
+	edits := diff.Lines(diff.Split(aContent), diff.Split(bContent))
+	for _, edit := range edits {
+		switch edit.Op {
+		case diff.OpInsert:
+			file.Added++
+		case diff.OpDelete:
+			file.Removed++
+		}
+	}
+	file.Diff = diff.Unified(aName, bName, edits, DiffContext)
+	return file
+}
@@ -1,10 +1,14 @@
 package server
 
 import (
+	"cmp"
+	"context"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"io"
 	"log/slog"
 	"mime"
@@ -16,17 +20,22 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/dustin/go-humanize"
 	"github.com/go-chi/chi/v5"
-	"github.com/topi314/chroma/v2"
+	"github.com/go-jose/go-jose/v3/jwt"
 	"github.com/topi314/chroma/v2/formatters"
 	"github.com/topi314/chroma/v2/lexers"
+	"github.com/topi314/chroma/v2/styles"
 
+	"github.com/topi314/gobin/v3/api"
 	"github.com/topi314/gobin/v3/internal/ezhttp"
 	"github.com/topi314/gobin/v3/internal/flags"
-	"github.com/topi314/gobin/v3/internal/gio"
 	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/internal/logparse"
+	"github.com/topi314/gobin/v3/internal/render"
+	"github.com/topi314/gobin/v3/internal/transform"
 	"github.com/topi314/gobin/v3/server/database"
 	"github.com/topi314/gobin/v3/server/templates"
 )
@@ -39,47 +48,32 @@ var (
 	ErrDocumentTooLarge           = func(maxLength int64) error {
 		return fmt.Errorf("document too large, must be less than %d chars", maxLength)
 	}
-	ErrInvalidExpiresAt = errors.New("invalid expires_at, must be in the future")
-)
-
-var VersionTimeFormat = "2006-01-02 15:04:05"
-
-type (
-	DocumentResponse struct {
-		Key          string         `json:"key"`
-		Version      int64          `json:"version"`
-		VersionLabel string         `json:"version_label,omitempty"`
-		VersionTime  string         `json:"version_time,omitempty"`
-		Files        []ResponseFile `json:"files"`
-		Token        string         `json:"token,omitempty"`
-	}
-
-	ResponseFile struct {
-		Name      string     `json:"name"`
-		Content   string     `json:"content,omitempty"`
-		Formatted string     `json:"formatted,omitempty"`
-		Language  string     `json:"language"`
-		ExpiresAt *time.Time `json:"expires_at"`
+	ErrTooManyFiles = func(maxFiles int) error {
+		return newLimitError(api.LimitMaxFiles, int64(maxFiles), "")
 	}
+	ErrInvalidExpiresAt        = errors.New("invalid expires_at, must be in the future")
+	ErrInvalidTTL              = errors.New("invalid ttl, must be positive")
+	ErrInvalidExpiresIn        = errors.New("invalid expires_in, must be a positive duration like 1h")
+	ErrShareTokenNotFound      = errors.New("share token not found")
+	ErrInvalidEncryptedContent = errors.New("invalid encrypted content, must be base64 encoded nonce and AES-GCM ciphertext")
+	ErrFileEncrypted           = errors.New("file is end-to-end encrypted, the server can't read it")
+	ErrVersionMessageTooLong   = fmt.Errorf("version message too long, must be at most %d chars", MaxVersionMessageLength)
+)
 
-	RequestFile struct {
-		Name      string
-		Content   string
-		Language  string
-		ExpiresAt *time.Time
-	}
+func newLimitError(limit string, max int64, file string) error {
+	return httperr.New(&api.LimitError{Limit: limit, Max: max, File: file}, http.StatusRequestEntityTooLarge)
+}
 
-	DeleteResponse struct {
-		Versions int `json:"versions"`
-	}
+var VersionTimeFormat = "2006-01-02 15:04:05"
 
-	ShareRequest struct {
-		Permissions []string `json:"permissions"`
-	}
+// MaxVersionMessageLength is the max number of characters of a version message.
+const MaxVersionMessageLength = 500
 
-	ShareResponse struct {
-		Token string `json:"token"`
-	}
+const (
+	// encryptedOverhead is the size of the AES-GCM nonce and tag which every encrypted file has.
+	encryptedOverhead = 12 + 16
+	// encryptedPreview is shown in previews instead of the content of encrypted files.
+	encryptedPreview = "This file is end-to-end encrypted."
 )
 
 func (s *Server) DocumentVersions(w http.ResponseWriter, r *http.Request) {
@@ -97,40 +91,76 @@ func (s *Server) DocumentVersions(w http.ResponseWriter, r *http.Request) {
 	}
 
 	formatter, _ := getFormatter(r, false)
-	style := getStyle(r)
+	style := s.getStyle(r)
 
-	var response []DocumentResponse
+	var response []api.DocumentResponse
 	for version, dbFiles := range versions {
-		files := make([]ResponseFile, len(dbFiles))
+		files := make([]api.ResponseFile, len(dbFiles))
 		for i, file := range dbFiles {
 			var formatted string
-			if withContent {
-				formatted, err = s.formatFile(file, formatter, style)
+			if withContent && formatter != nil {
+				formatted, err = s.formatFile(r.Context(), file, formatter, style)
 				if err != nil {
 					s.error(w, r, err)
 					return
 				}
 			}
 
-			files[i] = ResponseFile{
+			files[i] = api.ResponseFile{
 				Name:      file.Name,
 				Content:   file.Content,
 				Formatted: formatted,
 				Language:  file.Language,
+				Encrypted: file.Encrypted,
 				ExpiresAt: file.ExpiresAt,
+				SHA256:    fileChecksum(file),
 			}
 		}
-		response = append(response, DocumentResponse{
+		response = append(response, api.DocumentResponse{
 			Key:     documentID,
 			Version: version,
-			Files:   nil,
+			Files:   files,
 		})
 	}
+	slices.SortFunc(response, func(a, b api.DocumentResponse) int {
+		return cmp.Compare(b.Version, a.Version)
+	})
+	messages, err := s.db.GetVersionMessages(r.Context(), documentID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	for i := range response {
+		response[i].VersionLabel = versionLabel(response[i].Version, i, len(response))
+		response[i].VersionTime = time.UnixMilli(response[i].Version).Format(VersionTimeFormat)
+		response[i].VersionMessage = messages[response[i].Version]
+	}
 
 	s.ok(w, r, response)
 }
 
+// versionLabel returns the label of a version like "2 hours ago (current)", index is the position of the version from
+// newest to oldest.
+func versionLabel(version int64, index int, count int) string {
+	label := humanize.Time(time.UnixMilli(version))
+	if index == 0 {
+		label += " (current)"
+	} else if index == count-1 {
+		label += " (original)"
+	}
+	return label
+}
+
 func (s *Server) GetPrettyDocument(w http.ResponseWriter, r *http.Request) {
+	if chi.URLParam(r, "documentID") != "" {
+		w.Header().Add(ezhttp.HeaderVary, ezhttp.HeaderAccept+", "+ezhttp.HeaderUserAgent)
+		// curl and other cli clients get the content instead of the html of the document
+		if s.prefersPlainText(r) {
+			s.getPlainDocument(w, r)
+			return
+		}
+	}
+
 	document, err := s.getDocument(r, func(documentID string) string {
 		uri := new(url.URL)
 		*uri = *r.URL
@@ -148,12 +178,17 @@ func (s *Server) GetPrettyDocument(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	settings := s.getUserSettings(r)
 	if document == nil {
+		language := "auto"
+		if settings != nil && settings.DefaultLanguage != "" {
+			language = settings.DefaultLanguage
+		}
 		document = &database.Document{
 			Files: []database.File{{
 				Name:     "untitled",
 				Content:  "",
-				Language: "auto",
+				Language: language,
 			}},
 		}
 	}
@@ -164,46 +199,101 @@ func (s *Server) GetPrettyDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var (
+		parentID      string
+		parts         []string
+		documentStyle string
+		signatures    map[string]*api.FileSignatureResponse
+	)
+	if document.ID != "" {
+		fork, err := s.db.GetFork(r.Context(), document.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			s.prettyError(w, r, fmt.Errorf("failed to get fork: %w", err))
+			return
+		}
+		if fork != nil {
+			parentID = fork.ParentID
+		}
+
+		documentParts, err := s.getDocumentParts(r.Context(), document.ID)
+		if err != nil {
+			s.prettyError(w, r, fmt.Errorf("failed to get document parts: %w", err))
+			return
+		}
+		if documentParts != nil {
+			parts = documentParts.Parts
+		}
+
+		if documentStyle, err = s.db.GetDocumentStyle(r.Context(), document.ID); err != nil {
+			s.prettyError(w, r, err)
+			return
+		}
+
+		if len(document.Files) > 0 {
+			if signatures, err = s.getFileSignatures(r.Context(), document.ID, document.Files[0].DocumentVersion); err != nil {
+				s.prettyError(w, r, err)
+				return
+			}
+		}
+	}
+
 	formatter, _ := getFormatter(r, true)
-	style := getStyle(r)
+	style := s.getDocumentStyle(r, settings, documentStyle)
 	fileName := r.URL.Query().Get("file")
 
 	var (
 		currentFile int
 		totalLength int
 	)
-	templateFiles := make([]templates.File, len(document.Files))
 	for i, file := range document.Files {
-		formatted, err := s.formatFile(file, formatter, style)
-		if err != nil {
-			s.prettyError(w, r, err)
-			return
-		}
 		if strings.EqualFold(file.Name, fileName) {
 			currentFile = i
 		}
+		totalLength += len([]rune(file.Content))
+	}
+
+	// only the current file is sent, the other files are loaded when their tab is opened
+	templateFiles := make([]templates.File, len(document.Files))
+	for i, file := range document.Files {
+		if i != currentFile {
+			templateFiles[i] = templates.File{
+				Name:      file.Name,
+				Language:  file.Language,
+				Encrypted: file.Encrypted,
+				ExpiresAt: file.ExpiresAt,
+				SHA256:    file.SHA256,
+				Signature: templateSignature(signatures[file.Name]),
+				Lazy:      true,
+			}
+			continue
+		}
+
 		templateFiles[i] = templates.File{
 			Name:      file.Name,
 			Content:   file.Content,
-			Formatted: formatted,
 			Language:  file.Language,
+			Encrypted: file.Encrypted,
+			ExpiresAt: file.ExpiresAt,
+			SHA256:    fileChecksum(file),
+			Signature: templateSignature(signatures[file.Name]),
+		}
+	}
+
+	var messages map[int64]string
+	if document.ID != "" {
+		if messages, err = s.db.GetVersionMessages(r.Context(), document.ID); err != nil {
+			s.prettyError(w, r, err)
+			return
 		}
-		totalLength += len([]rune(file.Content))
 	}
 
 	templateVersions := make([]templates.DocumentVersion, len(versions))
 	for i, v := range versions {
-		versionTime := time.UnixMilli(v)
-		versionLabel := humanize.Time(versionTime)
-		if i == 0 {
-			versionLabel += " (current)"
-		} else if i == len(versions)-1 {
-			versionLabel += " (original)"
-		}
 		templateVersions[i] = templates.DocumentVersion{
 			Version: v,
-			Label:   versionLabel,
-			Time:    versionTime.Format(VersionTimeFormat),
+			Label:   versionLabel(v, i, len(versions)),
+			Time:    time.UnixMilli(v).Format(VersionTimeFormat),
+			Message: messages[v],
 		}
 	}
 
@@ -222,27 +312,87 @@ func (s *Server) GetPrettyDocument(w http.ResponseWriter, r *http.Request) {
 		}
 
 		previewAlt = s.shortContent(templateFiles[currentFile].Content)
+		if templateFiles[currentFile].Encrypted {
+			previewAlt = encryptedPreview
+		}
+	}
+	var (
+		accountName string
+		token       string
+	)
+	if accountID := s.getAccountID(r); accountID != "" {
+		if account, err := s.db.GetAccount(r.Context(), accountID); err == nil {
+			accountName = account.Name
+		}
+		// the browser gets a token for documents of the account, so they can be edited like after creating them
+		if claims := GetClaims(r); document.ID != "" && claims.Subject == document.ID && claims.Permissions != 0 {
+			if token, err = jwt.Signed(s.signer).Claims(claims).CompactSerialize(); err != nil {
+				s.prettyError(w, r, fmt.Errorf("failed to create jwt token: %w", err))
+				return
+			}
+		}
 	}
-	if err = templates.Document(templates.DocumentVars{
-		ID:      document.ID,
-		Version: document.Version,
-		Edit:    document.ID == "",
+
+	settingsResponse := newUserSettingsResponse(settings)
+	vars := templates.DocumentVars{
+		ID:       document.ID,
+		Version:  document.Version,
+		Edit:     document.ID == "",
+		ParentID: parentID,
+		Parts:    parts,
 
 		Files:       templateFiles,
 		CurrentFile: currentFile,
 		TotalLength: totalLength,
 		Versions:    templateVersions,
 
-		Lexers: lexers.Names(false),
-		Styles: s.styles,
-		Style:  style.Name,
-		Theme:  style.Theme,
+		Lexers:     lexers.Names(false),
+		Transforms: transform.Names,
+		Styles:     s.styles,
+		Style:      style.Name,
+		Theme:      style.Theme,
+		Assets:     s.assetManifest,
+
+		AutoStyle:         styles.Registry[getUserStyle(r)] == nil,
+		SettingsStyle:     settingsResponse.DefaultStyle,
+		DocumentStyle:     documentStyle,
+		DefaultStyle:      styles.Fallback.Name,
+		DefaultLightStyle: styles.Get(s.cfg.DefaultLightStyle).Name,
+
+		EditorKeymap:    settingsResponse.EditorKeymap,
+		DefaultLanguage: settingsResponse.DefaultLanguage,
+
+		Max:              s.cfg.MaxDocumentSize,
+		Host:             r.Host,
+		MaxHighlightSize: s.cfg.MaxHighlightSize,
+		PreviewURL:       previewURL,
+		PreviewAlt:       previewAlt,
+
+		SummaryEnabled:  s.summaryProvider != nil,
+		RecentEnabled:   s.cfg.Recent.Enabled,
+		AccountsEnabled: s.cfg.Accounts.Enabled,
+		AccountName:     accountName,
+		Token:           token,
+
+		// the page is streamed, the current file is highlighted after the head and skeleton of the page are sent
+		Format: func(ctx context.Context) string {
+			formatted, err := s.formatFile(ctx, document.Files[currentFile], formatter, style)
+			if err != nil {
+				// the status code is already sent, so the file is shown without highlighting
+				slog.ErrorContext(ctx, "failed to format file", slog.Any("err", err))
+				return html.EscapeString(document.Files[currentFile].Content)
+			}
+			return formatted
+		},
+	}
 
-		Max:        s.cfg.MaxDocumentSize,
-		Host:       r.Host,
-		PreviewURL: previewURL,
-		PreviewAlt: previewAlt,
-	}).Render(r.Context(), w); err != nil {
+	setColorSchemeHints(w)
+	w.Header().Set(ezhttp.HeaderLink, fmt.Sprintf("<%s>; rel=preload; as=style, <%s>; rel=preload; as=style, <%s>; rel=preload; as=font; type=\"font/ttf\"; crossorigin",
+		s.assetManifest.URL("/assets/style.css"),
+		vars.ThemeCSSURL(),
+		s.assetManifest.URL(templates.FontURL),
+	))
+	if err = templates.Document(vars).Render(r.Context(), w); err != nil {
 		slog.ErrorContext(r.Context(), "failed to execute template", slog.Any("err", err))
 	}
 }
@@ -254,13 +404,23 @@ func (s *Server) GetDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	signatures, err := s.getFileSignatures(r.Context(), document.ID, document.Files[0].DocumentVersion)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
 	formatter, _ := getFormatter(r, false)
-	style := getStyle(r)
+	style := s.getStyle(r)
 	fileName := r.URL.Query().Get("file")
 
 	if fileName != "" {
 		for _, file := range document.Files {
 			if strings.EqualFold(file.Name, fileName) {
+				if checkNotModified(w, r, s.documentETag(r, []database.File{file}, style.Name, signatureETagPart(signatures[file.Name])), documentModTime(document.Files)) {
+					return
+				}
+
 				if language := r.URL.Query().Get("language"); language != "" {
 					lexer := lexers.Get(language)
 					if lexer != nil {
@@ -268,16 +428,20 @@ func (s *Server) GetDocument(w http.ResponseWriter, r *http.Request) {
 					}
 				}
 
-				formatted, err := s.formatFile(file, formatter, style)
+				formatted, err := s.formatFile(r.Context(), file, formatter, style)
 				if err != nil {
 					s.error(w, r, err)
 					return
 				}
-				s.ok(w, r, ResponseFile{
+				s.ok(w, r, api.ResponseFile{
 					Name:      file.Name,
 					Content:   file.Content,
 					Formatted: formatted,
 					Language:  file.Language,
+					Encrypted: file.Encrypted,
+					ExpiresAt: file.ExpiresAt,
+					SHA256:    fileChecksum(file),
+					Signature: signatures[file.Name],
 				})
 				return
 			}
@@ -286,22 +450,48 @@ func (s *Server) GetDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response := DocumentResponse{
-		Key:     document.ID,
-		Version: document.Version,
-		Files:   make([]ResponseFile, len(document.Files)),
+	defaultStyle, err := s.db.GetDocumentStyle(r.Context(), document.ID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	messages, err := s.db.GetVersionMessages(r.Context(), document.ID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	etagParts := []string{style.Name, defaultStyle, messages[document.Files[0].DocumentVersion]}
+	for _, file := range document.Files {
+		etagParts = append(etagParts, signatureETagPart(signatures[file.Name]))
+	}
+	if checkNotModified(w, r, s.documentETag(r, document.Files, etagParts...), documentModTime(document.Files)) {
+		return
+	}
+
+	response := api.DocumentResponse{
+		Key:            document.ID,
+		Version:        document.Version,
+		VersionMessage: messages[document.Files[0].DocumentVersion],
+		Files:          make([]api.ResponseFile, len(document.Files)),
+		DefaultStyle:   defaultStyle,
 	}
 	for i, file := range document.Files {
-		formatted, err := s.formatFile(file, formatter, style)
+		formatted, err := s.formatFile(r.Context(), file, formatter, style)
 		if err != nil {
 			s.error(w, r, err)
 			return
 		}
-		response.Files[i] = ResponseFile{
+		response.Files[i] = api.ResponseFile{
 			Name:      file.Name,
 			Content:   file.Content,
 			Formatted: formatted,
 			Language:  file.Language,
+			Encrypted: file.Encrypted,
+			ExpiresAt: file.ExpiresAt,
+			SHA256:    fileChecksum(file),
+			Signature: signatures[file.Name],
 		}
 	}
 
@@ -314,14 +504,45 @@ func (s *Server) GetRawDocument(w http.ResponseWriter, r *http.Request) {
 		s.error(w, r, err)
 		return
 	}
+	if len(document.Files) == 1 {
+		if err = verifyChecksum(r, document.Files[0]); err != nil {
+			s.error(w, r, err)
+			return
+		}
+		w.Header().Set(ezhttp.HeaderChecksumSHA256, fileChecksum(document.Files[0]))
+	} else if r.URL.Query().Has("verify") {
+		s.error(w, r, httperr.BadRequest(ErrVerifyMultiple))
+		return
+	}
 
 	formatter, formatterName := getFormatter(r, false)
-	style := getStyle(r)
+	style := s.getStyle(r)
+	if checkNotModified(w, r, s.documentETag(r, document.Files, style.Name), documentModTime(document.Files)) {
+		return
+	}
+
+	for i := range document.Files {
+		if err = applyTransform(r, &document.Files[i]); err != nil {
+			s.error(w, r, err)
+			return
+		}
+	}
+
+	logFilter, err := getLogFilter(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if !logFilter.IsZero() {
+		for i, file := range document.Files {
+			document.Files[i].Content = logparse.FilterContent(file.Content, logFilter)
+		}
+	}
 
 	if len(document.Files) == 1 {
 		file := document.Files[0]
 
-		formatted, err := s.formatFile(file, formatter, style)
+		formatted, err := s.formatFile(r.Context(), file, formatter, style)
 		if err != nil {
 			s.error(w, r, fmt.Errorf("failed to render raw document: %w", err))
 			return
@@ -366,7 +587,7 @@ func (s *Server) GetRawDocument(w http.ResponseWriter, r *http.Request) {
 
 	mpw := multipart.NewWriter(w)
 	for i, file := range document.Files {
-		formatted, err := s.formatFile(file, formatter, style)
+		formatted, err := s.formatFile(r.Context(), file, formatter, style)
 		if err != nil {
 			s.error(w, r, fmt.Errorf("failed to render raw document: %w", err))
 			return
@@ -431,7 +652,7 @@ func (s *Server) GetDocumentPreview(w http.ResponseWriter, r *http.Request) {
 	}
 
 	formatter := formatters.Get("svg")
-	style := getStyle(r)
+	style := s.getStyle(r)
 	fileName := r.URL.Query().Get("file")
 
 	var currentFile int
@@ -443,9 +664,17 @@ func (s *Server) GetDocumentPreview(w http.ResponseWriter, r *http.Request) {
 	}
 
 	file := document.Files[currentFile]
+	if checkNotModified(w, r, s.documentETag(r, []database.File{file}, style.Name), documentModTime(document.Files)) {
+		return
+	}
 	file.Content = s.shortContent(file.Content)
+	if file.Encrypted {
+		file.Content = encryptedPreview
+		file.Language = "plaintext"
+		file.Encrypted = false
+	}
 
-	formatted, err := s.formatFile(file, formatter, style)
+	formatted, err := s.formatFile(r.Context(), file, formatter, style)
 	if err != nil {
 		s.prettyError(w, r, fmt.Errorf("failed to render document preview: %w", err))
 		return
@@ -484,15 +713,7 @@ func (s *Server) getDocument(r *http.Request, fallbackURL func(documentID string
 		}
 	}
 
-	var (
-		files []database.File
-		err   error
-	)
-	if version == 0 {
-		files, err = s.db.GetDocument(r.Context(), documentID)
-	} else {
-		files, err = s.db.GetDocumentVersion(r.Context(), documentID, version)
-	}
+	files, err := s.getDocumentFiles(r.Context(), documentID, version)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			if fallbackURL != nil && version > 0 {
@@ -510,15 +731,43 @@ func (s *Server) getDocument(r *http.Request, fallbackURL func(documentID string
 	}, nil
 }
 
+func isEncrypted(file database.File) bool {
+	return file.Encrypted
+}
+
+// getDocumentFiles returns the files of the latest document version if version is 0.
+func (s *Server) getDocumentFiles(ctx context.Context, documentID string, version int64) ([]database.File, error) {
+	if version == 0 {
+		return s.db.GetDocument(ctx, documentID)
+	}
+	return s.db.GetDocumentVersion(ctx, documentID, version)
+}
+
 func (s *Server) GetDocumentFile(w http.ResponseWriter, r *http.Request) {
 	file, err := s.getDocumentFile(r)
 	if err != nil {
 		s.error(w, r, err)
 		return
 	}
+	signatures, err := s.getFileSignatures(r.Context(), file.DocumentID, file.DocumentVersion)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
 
 	formatter, _ := getFormatter(r, false)
-	style := getStyle(r)
+	style := s.getStyle(r)
+	if checkNotModified(w, r, s.documentETag(r, []database.File{*file}, style.Name, signatureETagPart(signatures[file.Name])), documentModTime([]database.File{*file})) {
+		return
+	}
+
+	// the checksums are of the stored content, so they are taken before the file is transformed
+	rsFile := api.ResponseFile{
+		SHA256:    fileChecksum(*file),
+		SHA1:      checksum("sha1", *file),
+		MD5:       checksum("md5", *file),
+		Signature: signatures[file.Name],
+	}
 
 	if language := r.URL.Query().Get("language"); language != "" {
 		lexer := lexers.Get(language)
@@ -526,30 +775,60 @@ func (s *Server) GetDocumentFile(w http.ResponseWriter, r *http.Request) {
 			file.Language = lexer.Config().Name
 		}
 	}
+	if err = applyTransform(r, file); err != nil {
+		s.error(w, r, err)
+		return
+	}
 
-	formatted, err := s.formatFile(*file, formatter, style)
+	formatted, err := s.formatFile(r.Context(), *file, formatter, style)
 	if err != nil {
 		s.error(w, r, err)
 		return
 	}
 
-	s.ok(w, r, ResponseFile{
-		Name:      file.Name,
-		Content:   file.Content,
-		Formatted: formatted,
-		Language:  file.Language,
-	})
+	rsFile.Name = file.Name
+	rsFile.Content = file.Content
+	rsFile.Formatted = formatted
+	rsFile.Language = file.Language
+	rsFile.Encrypted = file.Encrypted
+	s.ok(w, r, rsFile)
 }
 
 func (s *Server) GetRawDocumentFile(w http.ResponseWriter, r *http.Request) {
+	if err := s.verifyContentURL(r); err != nil {
+		s.error(w, r, err)
+		return
+	}
 	file, err := s.getDocumentFile(r)
 	if err != nil {
 		s.error(w, r, err)
 		return
 	}
+	if err = verifyChecksum(r, *file); err != nil {
+		s.error(w, r, err)
+		return
+	}
+	w.Header().Set(ezhttp.HeaderChecksumSHA256, fileChecksum(*file))
 
 	formatter, formatterName := getFormatter(r, false)
-	style := getStyle(r)
+	style := s.getStyle(r)
+	if checkNotModified(w, r, s.documentETag(r, []database.File{*file}, style.Name), documentModTime([]database.File{*file})) {
+		return
+	}
+
+	if err = applyTransform(r, file); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	logFilter, err := getLogFilter(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if !logFilter.IsZero() {
+		file.Content = logparse.FilterContent(file.Content, logFilter)
+	}
 
 	lexer := lexers.Get(file.Language)
 	if lexer == nil {
@@ -557,7 +836,7 @@ func (s *Server) GetRawDocumentFile(w http.ResponseWriter, r *http.Request) {
 	}
 	w.Header().Set(ezhttp.HeaderLanguage, lexer.Config().Name)
 
-	formatted, err := s.formatFile(*file, formatter, style)
+	formatted, err := s.formatFile(r.Context(), *file, formatter, style)
 	if err != nil {
 		s.error(w, r, fmt.Errorf("failed to render raw document: %w", err))
 		return
@@ -638,7 +917,20 @@ func (s *Server) getDocumentFile(r *http.Request) (*database.File, error) {
 }
 
 func (s *Server) PostDocument(w http.ResponseWriter, r *http.Request) {
-	files, err := s.parseDocumentFiles(r)
+	s.createDocument(w, r, r.URL.Query().Get("key"), "", s.parseDocumentFiles)
+}
+
+// createDocument creates a document with the files returned by parseFiles and the custom key or a random key if it is
+// empty. A non-empty indexID adds the document as the next part of the index.
+func (s *Server) createDocument(w http.ResponseWriter, r *http.Request, documentID string, indexID string, parseFiles func(r *http.Request) ([]api.RequestFile, error)) {
+	if documentID != "" {
+		if err := s.validateCustomKey(r, documentID); err != nil {
+			s.error(w, r, err)
+			return
+		}
+	}
+
+	files, err := parseFiles(r)
 	if err != nil {
 		s.error(w, r, err)
 		return
@@ -650,123 +942,295 @@ func (s *Server) PostDocument(w http.ResponseWriter, r *http.Request) {
 			Name:       file.Name,
 			Content:    file.Content,
 			Language:   file.Language,
+			Encrypted:  file.Encrypted,
 			ExpiresAt:  file.ExpiresAt,
 			OrderIndex: i,
 		})
 	}
 
-	documentID, version, err := s.db.CreateDocument(r.Context(), dbFiles)
+	fork, err := s.getForkParent(r)
 	if err != nil {
-		s.error(w, r, fmt.Errorf("failed to create document: %w", err))
+		s.error(w, r, err)
 		return
 	}
 
-	formatter, _ := getFormatter(r, false)
-	style := getStyle(r)
+	defaultStyle := r.URL.Query().Get("default_style")
+	if err = validateDocumentStyle(defaultStyle); err != nil {
+		s.error(w, r, err)
+		return
+	}
 
-	var rsFiles []ResponseFile
-	for _, file := range dbFiles {
-		formatted, err := s.formatFile(file, formatter, style)
-		if err != nil {
+	message, err := getVersionMessage(r.URL.Query(), r.Header)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	public, err := s.publicDocument(r, dbFiles)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	hookResults, err := s.runHooks(r.Context(), EventCreate, "", dbFiles)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	if documentID != "" {
+		if err = s.db.ClaimCustomDocumentKey(r.Context(), documentID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				s.error(w, r, httperr.Conflict(ErrDocumentKeyTaken))
+				return
+			}
 			s.error(w, r, err)
 			return
 		}
-		rsFiles = append(rsFiles, ResponseFile{
+	}
+
+	newDocumentID, version, err := s.db.CreateDocument(r.Context(), documentID, dbFiles)
+	if err != nil {
+		s.error(w, r, fmt.Errorf("failed to create document: %w", err))
+		return
+	}
+	documentID = *newDocumentID
+	if fork != nil {
+		fork.DocumentID = documentID
+		if err = s.db.CreateFork(r.Context(), *fork); err != nil {
+			slog.ErrorContext(r.Context(), "failed to create fork", slog.Any("err", err))
+		}
+	}
+	if indexID != "" {
+		if err = s.addDocumentPart(r.Context(), indexID, documentID); err != nil {
+			slog.ErrorContext(r.Context(), "failed to add document part", slog.Any("err", err))
+		}
+	}
+	if defaultStyle != "" {
+		if err = s.db.SetDocumentStyle(r.Context(), documentID, defaultStyle); err != nil {
+			slog.ErrorContext(r.Context(), "failed to set document style", slog.Any("err", err))
+		}
+	}
+	if message != "" {
+		if err = s.db.SetVersionMessage(r.Context(), documentID, *version, message); err != nil {
+			slog.ErrorContext(r.Context(), "failed to set version message", slog.Any("err", err))
+		}
+	}
+	s.recordHookResults(r.Context(), documentID, *version, hookResults)
+
+	rsFiles, err := s.newSavedResponseFiles(r, dbFiles)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	s.RecordEvent(r.Context(), EventCreate, documentID, *version, newEventData(dbFiles))
+
+	webhooksFiles := make([]api.WebhookDocumentFile, len(dbFiles))
+	for i, file := range dbFiles {
+		webhooksFiles[i] = api.WebhookDocumentFile{
 			Name:      file.Name,
 			Content:   file.Content,
-			Formatted: formatted,
 			Language:  file.Language,
+			Encrypted: file.Encrypted,
 			ExpiresAt: file.ExpiresAt,
-		})
+		}
+	}
+	// documents have no webhooks yet, only the global webhooks and the account webhooks of the creator receive this event
+	s.addAccountDocument(r, documentID)
+	s.ExecuteWebhooks(r.Context(), WebhookEventCreate, api.WebhookDocument{
+		Key:     documentID,
+		Version: *version,
+		Files:   webhooksFiles,
+	})
+	if public {
+		s.publishActivityPubNote(r.Context(), documentID, *version, dbFiles)
 	}
 
-	token, err := s.NewToken(*documentID, AllPermissions)
+	token, err := s.NewToken(documentID, AllPermissions)
 	if err != nil {
 		s.error(w, r, fmt.Errorf("failed to create jwt token: %w", err))
 		return
 	}
 
+	s.addRecentDocument(w, r, documentID)
+
 	versionTime := time.UnixMilli(*version)
-	s.json(w, r, DocumentResponse{
-		Key:          *documentID,
-		Version:      *version,
-		VersionLabel: humanize.Time(versionTime) + " (original)",
-		VersionTime:  versionTime.Format(VersionTimeFormat),
-		Files:        rsFiles,
-		Token:        token,
+	s.json(w, r, api.DocumentResponse{
+		Key:            documentID,
+		Version:        *version,
+		VersionLabel:   humanize.Time(versionTime) + " (original)",
+		VersionTime:    versionTime.Format(VersionTimeFormat),
+		VersionMessage: message,
+		Files:          rsFiles,
+		Token:          token,
+		DefaultStyle:   defaultStyle,
 	}, http.StatusCreated)
 
 }
 
 func (s *Server) PatchDocument(w http.ResponseWriter, r *http.Request) {
+	// check the permission first, parsing the files can fetch a from_url
+	claims := GetClaims(r)
+	if flags.Misses(claims.Permissions, PermissionWrite) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+		return
+	}
+
 	files, err := s.parseDocumentFiles(r)
 	if err != nil {
 		s.error(w, r, err)
 		return
 	}
 
-	claims := GetClaims(r)
-	if flags.Misses(claims.Permissions, PermissionWrite) {
-		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+	documentID := chi.URLParam(r, "documentID")
+
+	unlock := s.updateLocks.lock(documentID)
+	defer unlock()
+	if err = s.checkIfMatch(r, documentID); err != nil {
+		s.error(w, r, err)
 		return
 	}
 
-	documentID := chi.URLParam(r, "documentID")
-
 	var dbFiles []database.File
 	for i, file := range files {
 		dbFiles = append(dbFiles, database.File{
 			Name:       file.Name,
 			Content:    file.Content,
 			Language:   file.Language,
+			Encrypted:  file.Encrypted,
 			ExpiresAt:  file.ExpiresAt,
 			OrderIndex: i,
 		})
 	}
 
-	version, err := s.db.UpdateDocument(r.Context(), documentID, dbFiles)
+	review, err := s.requiresReview(r, documentID)
 	if err != nil {
-		s.error(w, r, fmt.Errorf("failed to update document: %w", err))
+		s.error(w, r, err)
 		return
 	}
-
-	formatter, _ := getFormatter(r, false)
-	style := getStyle(r)
-
-	var rsFiles []ResponseFile
-	for _, file := range dbFiles {
-		formatted, err := s.formatFile(file, formatter, style)
+	if review {
+		revision, err := s.createRevision(r, documentID, dbFiles)
 		if err != nil {
 			s.error(w, r, err)
 			return
 		}
-		rsFiles = append(rsFiles, ResponseFile{
+		s.json(w, r, revision, http.StatusAccepted)
+		return
+	}
+
+	rs, err := s.updateDocument(r, documentID, dbFiles)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	s.ok(w, r, rs)
+}
+
+// updateDocument saves the files as a new version of the document and returns them formatted.
+func (s *Server) updateDocument(r *http.Request, documentID string, dbFiles []database.File) (*api.DocumentResponse, error) {
+	message, err := getVersionMessage(r.URL.Query(), r.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := s.saveDocumentVersion(r.Context(), documentID, r.Header.Get(ezhttp.HeaderDocumentLock), dbFiles, message)
+	if err != nil {
+		return nil, err
+	}
+
+	rsFiles, err := s.newSavedResponseFiles(r, dbFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	versionTime := time.UnixMilli(version)
+	return &api.DocumentResponse{
+		Key:            documentID,
+		Version:        version,
+		VersionLabel:   humanize.Time(versionTime) + " (current)",
+		VersionTime:    versionTime.Format(VersionTimeFormat),
+		VersionMessage: message,
+		Files:          rsFiles,
+	}, nil
+}
+
+// newSavedResponseFiles returns the response files of created or updated files. The withContent query param set to
+// false leaves out the content, large uploads don't have to be sent back then.
+func (s *Server) newSavedResponseFiles(r *http.Request, dbFiles []database.File) ([]api.ResponseFile, error) {
+	withContent := r.URL.Query().Get("withContent") != "false"
+	formatter, _ := getFormatter(r, false)
+	style := s.getStyle(r)
+
+	rsFiles := make([]api.ResponseFile, 0, len(dbFiles))
+	for _, file := range dbFiles {
+		rsFile := api.ResponseFile{
 			Name:      file.Name,
-			Content:   file.Content,
-			Formatted: formatted,
 			Language:  file.Language,
+			Encrypted: file.Encrypted,
 			ExpiresAt: file.ExpiresAt,
-		})
+			SHA256:    fileChecksum(file),
+		}
+		if withContent {
+			formatted, err := s.formatFile(r.Context(), file, formatter, style)
+			if err != nil {
+				return nil, err
+			}
+			rsFile.Content = file.Content
+			rsFile.Formatted = formatted
+		}
+		rsFiles = append(rsFiles, rsFile)
 	}
+	return rsFiles, nil
+}
 
-	webhooksFiles := make([]WebhookDocumentFile, len(files))
-	for i, file := range files {
-		webhooksFiles[i] = WebhookDocumentFile(file)
+// saveDocumentVersion saves the files as a new version of the document and notifies hooks, events and webhooks. It
+// fails if the document is locked and lockID isn't the id of the lock. The message is optional.
+func (s *Server) saveDocumentVersion(ctx context.Context, documentID string, lockID string, dbFiles []database.File, message string) (int64, error) {
+	if err := s.checkDocumentLock(ctx, documentID, lockID); err != nil {
+		return 0, err
 	}
-	s.ExecuteWebhooks(r.Context(), WebhookEventUpdate, WebhookDocument{
+
+	hookResults, err := s.runHooks(ctx, EventUpdate, documentID, dbFiles)
+	if err != nil {
+		return 0, err
+	}
+
+	version, err := s.db.UpdateDocument(ctx, documentID, dbFiles)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update document: %w", err)
+	}
+	if message != "" {
+		if err = s.db.SetVersionMessage(ctx, documentID, *version, message); err != nil {
+			slog.ErrorContext(ctx, "failed to set version message", slog.Any("err", err))
+		}
+	}
+	s.recordHookResults(ctx, documentID, *version, hookResults)
+
+	s.notifyDocumentVersion(ctx, EventUpdate, WebhookEventUpdate, documentID, *version, dbFiles)
+	return *version, nil
+}
+
+// notifyDocumentVersion records the event of a new document version and sends it to live viewers and webhooks.
+func (s *Server) notifyDocumentVersion(ctx context.Context, event string, webhookEvent string, documentID string, version int64, dbFiles []database.File) {
+	s.RecordEvent(ctx, event, documentID, version, newEventData(dbFiles))
+	s.publishLiveEvent(event, documentID, version)
+
+	webhooksFiles := make([]api.WebhookDocumentFile, len(dbFiles))
+	for i, file := range dbFiles {
+		webhooksFiles[i] = api.WebhookDocumentFile{
+			Name:      file.Name,
+			Content:   file.Content,
+			Language:  file.Language,
+			Encrypted: file.Encrypted,
+			ExpiresAt: file.ExpiresAt,
+		}
+	}
+	s.ExecuteWebhooks(ctx, webhookEvent, api.WebhookDocument{
 		Key:     documentID,
-		Version: *version,
+		Version: version,
 		Files:   webhooksFiles,
 	})
-
-	versionTime := time.UnixMilli(*version)
-	s.json(w, r, DocumentResponse{
-		Key:          documentID,
-		Version:      *version,
-		VersionLabel: humanize.Time(versionTime) + " (current)",
-		VersionTime:  versionTime.Format(VersionTimeFormat),
-		Files:        rsFiles,
-	}, http.StatusOK)
 }
 
 func (s *Server) DeleteDocument(w http.ResponseWriter, r *http.Request) {
@@ -801,20 +1265,7 @@ func (s *Server) DeleteDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	webhooksFiles := make([]WebhookDocumentFile, len(document.Files))
-	for i, file := range document.Files {
-		webhooksFiles[i] = WebhookDocumentFile{
-			Name:      file.Name,
-			Content:   file.Content,
-			Language:  file.Language,
-			ExpiresAt: file.ExpiresAt,
-		}
-	}
-	s.ExecuteWebhooks(r.Context(), WebhookEventDelete, WebhookDocument{
-		Key:     document.ID,
-		Version: document.Version,
-		Files:   webhooksFiles,
-	})
+	s.documentDeleted(r.Context(), document)
 
 	if version == 0 {
 		s.ok(w, r, nil)
@@ -825,15 +1276,39 @@ func (s *Server) DeleteDocument(w http.ResponseWriter, r *http.Request) {
 		s.error(w, r, err)
 		return
 	}
-	s.ok(w, r, DeleteResponse{
+	s.ok(w, r, api.DeleteResponse{
 		Versions: count,
 	})
 }
 
+// documentDeleted records the delete event, notifies the live streams, sends the delete webhooks of the document and
+// deletes its ActivityPub post once all versions are gone.
+func (s *Server) documentDeleted(ctx context.Context, document *database.Document) {
+	s.RecordEvent(ctx, EventDelete, document.ID, document.Version, newEventData(document.Files))
+	s.publishLiveEvent(EventDelete, document.ID, document.Version)
+
+	webhooksFiles := make([]api.WebhookDocumentFile, len(document.Files))
+	for i, file := range document.Files {
+		webhooksFiles[i] = api.WebhookDocumentFile{
+			Name:      file.Name,
+			Content:   file.Content,
+			Language:  file.Language,
+			Encrypted: file.Encrypted,
+			ExpiresAt: file.ExpiresAt,
+		}
+	}
+	s.ExecuteWebhooks(ctx, WebhookEventDelete, api.WebhookDocument{
+		Key:     document.ID,
+		Version: document.Version,
+		Files:   webhooksFiles,
+	})
+	s.activityPubDocumentDeleted(ctx, document.ID)
+}
+
 func (s *Server) PostDocumentShare(w http.ResponseWriter, r *http.Request) {
 	documentID := chi.URLParam(r, "documentID")
 
-	var shareRequest ShareRequest
+	var shareRequest api.ShareRequest
 	if err := json.NewDecoder(r.Body).Decode(&shareRequest); err != nil {
 		s.error(w, r, httperr.BadRequest(err))
 		return
@@ -843,9 +1318,13 @@ func (s *Server) PostDocumentShare(w http.ResponseWriter, r *http.Request) {
 		s.error(w, r, httperr.BadRequest(ErrNoPermissions))
 		return
 	}
+	if shareRequest.MaxUses < 0 {
+		s.error(w, r, httperr.BadRequest(ErrInvalidMaxUses))
+		return
+	}
 
 	for _, permission := range shareRequest.Permissions {
-		if !slices.Contains(AllStringPermissions, permission) {
+		if !slices.Contains(api.AllStringPermissions, permission) {
 			s.error(w, r, httperr.BadRequest(ErrUnknownPermission(permission)))
 			return
 		}
@@ -863,17 +1342,88 @@ func (s *Server) PostDocumentShare(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := s.NewToken(documentID, perms)
+	// shared tokens can't outlive the token they were shared with
+	var expiresAt *time.Time
+	if claims.Expiry != nil {
+		tokenExpiresAt := claims.Expiry.Time()
+		expiresAt = &tokenExpiresAt
+	}
+	if shareRequest.ExpiresIn != "" {
+		expiresIn, err := time.ParseDuration(shareRequest.ExpiresIn)
+		if err != nil || expiresIn <= 0 {
+			s.error(w, r, httperr.BadRequest(ErrInvalidExpiresIn))
+			return
+		}
+		if tokenExpiresAt := time.Now().Add(expiresIn).Truncate(time.Second); expiresAt == nil || tokenExpiresAt.Before(*expiresAt) {
+			expiresAt = &tokenExpiresAt
+		}
+	}
+
+	token, tokenID, err := s.NewShareToken(r.Context(), documentID, perms, expiresAt, shareRequest.MaxUses)
 	if err != nil {
 		s.error(w, r, fmt.Errorf("failed to create new token: %w", err))
 		return
 	}
 
-	s.ok(w, r, ShareResponse{Token: token})
+	s.RecordEvent(r.Context(), EventShare, documentID, 0, EventShareData{
+		Permissions: shareRequest.Permissions,
+	})
+
+	s.ok(w, r, api.ShareResponse{
+		ID:        tokenID,
+		Token:     token,
+		ExpiresAt: expiresAt,
+		MaxUses:   shareRequest.MaxUses,
+	})
 }
 
-func (s *Server) parseDocumentFiles(r *http.Request) ([]RequestFile, error) {
-	var files []RequestFile
+// DeleteDocumentShare revokes a share token of the document by its id, so it can't be used anymore even before it
+// expires. Tokens without a jti like the token of the creator are revoked by the SHA-256 of the token and need a token
+// with all permissions, because their permissions are unknown.
+func (s *Server) DeleteDocumentShare(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+	tokenID := chi.URLParam(r, "tokenID")
+	claims, err := checkSharePermission(r, documentID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	revokedToken := database.RevokedToken{
+		ID:         tokenID,
+		DocumentID: documentID,
+		RevokedAt:  time.Now(),
+	}
+	shareToken, err := s.db.GetDocumentShareToken(r.Context(), tokenID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		s.error(w, r, fmt.Errorf("failed to get share token: %w", err))
+		return
+	}
+	if shareToken != nil {
+		if shareToken.DocumentID != documentID {
+			s.error(w, r, httperr.NotFound(ErrShareTokenNotFound))
+			return
+		}
+		// tokens can only revoke tokens with the same or fewer permissions
+		if !flags.Has(claims.Permissions, Permissions(shareToken.Permissions)) {
+			s.error(w, r, httperr.Forbidden(ErrPermissionDenied("share")))
+			return
+		}
+		revokedToken.ExpiresAt = shareToken.ExpiresAt
+	} else if !flags.Has(claims.Permissions, AllPermissions) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("share")))
+		return
+	}
+
+	if err = s.db.RevokeToken(r.Context(), revokedToken); err != nil {
+		s.error(w, r, err)
+		return
+	}
+	s.ok(w, r, nil)
+}
+
+func (s *Server) parseDocumentFiles(r *http.Request) ([]api.RequestFile, error) {
+	var files []api.RequestFile
 	contentType := r.Header.Get(ezhttp.HeaderContentType)
 	if contentType != "" {
 		var err error
@@ -888,6 +1438,11 @@ func (s *Server) parseDocumentFiles(r *http.Request) ([]RequestFile, error) {
 	if err != nil {
 		return nil, err
 	}
+	encrypted, err := getEncrypted(query, r.Header)
+	if err != nil {
+		return nil, err
+	}
+	settings := s.getUserSettings(r)
 
 	if contentType == "multipart/form-data" {
 		mr, err := r.MultipartReader()
@@ -895,11 +1450,7 @@ func (s *Server) parseDocumentFiles(r *http.Request) ([]RequestFile, error) {
 			return nil, fmt.Errorf("failed to get multipart reader: %w", err)
 		}
 
-		var limitReader *gio.LimitedReader
-		if s.cfg.MaxDocumentSize > 0 {
-			limitReader = gio.LimitReader(nil, s.cfg.MaxDocumentSize)
-		}
-
+		remaining := s.maxDocumentSize()
 		for i := 0; ; i++ {
 			part, err := mr.NextPart()
 			if err != nil {
@@ -917,17 +1468,13 @@ func (s *Server) parseDocumentFiles(r *http.Request) ([]RequestFile, error) {
 				return nil, httperr.BadRequest(ErrInvalidDocumentFileName)
 			}
 
-			reader := io.Reader(part)
-			if limitReader != nil {
-				limitReader.R = part
-				reader = limitReader
+			if s.cfg.MaxFiles > 0 && i >= s.cfg.MaxFiles {
+				return nil, ErrTooManyFiles(s.cfg.MaxFiles)
 			}
-			data, err := io.ReadAll(reader)
+
+			data, err := s.readDocumentFile(part, part.FileName(), &remaining)
 			if err != nil {
-				if errors.Is(err, gio.ErrLimitReached) {
-					return nil, httperr.BadRequest(ErrDocumentTooLarge(s.cfg.MaxDocumentSize))
-				}
-				return nil, fmt.Errorf("failed to read part body: %w", err)
+				return nil, err
 			}
 
 			if len(data) == 0 {
@@ -947,27 +1494,20 @@ func (s *Server) parseDocumentFiles(r *http.Request) ([]RequestFile, error) {
 				expiresAt = newExpiresAt
 			}
 
-			files = append(files, RequestFile{
-				Name:      part.FileName(),
-				Content:   string(data),
-				Language:  getLanguage(part.Header.Get(ezhttp.HeaderLanguage), partContentType, part.FileName(), string(data)),
-				ExpiresAt: expiresAt,
-			})
-		}
-	} else {
-		reader := io.Reader(r.Body)
-		if s.cfg.MaxDocumentSize > 0 {
-			reader = gio.LimitReader(r.Body, s.cfg.MaxDocumentSize)
-		}
-
-		data, err := io.ReadAll(reader)
-		if err != nil {
-			if errors.Is(err, gio.ErrLimitReached) {
-				return nil, httperr.BadRequest(ErrDocumentTooLarge(s.cfg.MaxDocumentSize))
+			partEncrypted, err := getEncrypted(nil, http.Header(part.Header))
+			if err != nil {
+				return nil, err
 			}
-			return nil, fmt.Errorf("failed to read request body: %w", err)
+			partLanguage := part.Header.Get(ezhttp.HeaderLanguage)
+			file, err := newRequestFile(part.FileName(), data, partLanguage, partContentType, encrypted || partEncrypted)
+			if err != nil {
+				return nil, err
+			}
+			file.ExpiresAt = expiresAt
+			applyUserSettings(settings, file, partLanguage)
+			files = append(files, *file)
 		}
-
+	} else {
 		params := make(map[string]string)
 		if contentDisposition := r.Header.Get(ezhttp.HeaderContentDisposition); contentDisposition != "" {
 			_, params, err = mime.ParseMediaType(contentDisposition)
@@ -981,17 +1521,34 @@ func (s *Server) parseDocumentFiles(r *http.Request) ([]RequestFile, error) {
 			name = "untitled"
 		}
 
+		remaining := s.maxDocumentSize()
+		data, err := s.readDocumentFile(r.Body, name, &remaining)
+		if err != nil {
+			return nil, err
+		}
+
+		if fromURL := parseFromURLRequest(contentType, data); s.cfg.FromURL.Enabled && fromURL != "" {
+			file, err := s.fetchDocumentFile(r.Context(), fromURL)
+			if err != nil {
+				return nil, err
+			}
+			file.ExpiresAt = expiresAt
+			applyUserSettings(settings, file, "")
+			return []api.RequestFile{*file}, nil
+		}
+
 		language := query.Get("language")
 		if language == "" {
 			language = r.Header.Get(ezhttp.HeaderLanguage)
 		}
 
-		files = []RequestFile{{
-			Name:      name,
-			Content:   string(data),
-			Language:  getLanguage(language, contentType, params["filename"], string(data)),
-			ExpiresAt: expiresAt,
-		}}
+		file, err := newRequestFile(name, data, language, contentType, encrypted)
+		if err != nil {
+			return nil, err
+		}
+		file.ExpiresAt = expiresAt
+		applyUserSettings(settings, file, language)
+		files = []api.RequestFile{*file}
 	}
 	for i, file := range files {
 		for ii, f := range files {
@@ -1003,44 +1560,103 @@ func (s *Server) parseDocumentFiles(r *http.Request) ([]RequestFile, error) {
 	return files, nil
 }
 
-func getLanguage(language string, contentType string, fileName string, content string) string {
-	var lexer chroma.Lexer
-	if language != "" {
-		lexer = lexers.Get(language)
+// maxDocumentSize returns the max size of all files of a document together, -1 if it's unlimited.
+func (s *Server) maxDocumentSize() int64 {
+	if s.cfg.MaxDocumentSize > 0 {
+		return s.cfg.MaxDocumentSize
 	}
-	if lexer != nil {
-		return lexer.Config().Name
+	return -1
+}
+
+// maxFileSize returns the max size of a single file, the smaller one of max_file_size and max_document_size or 0 if
+// files are unlimited.
+func (s *Server) maxFileSize() int64 {
+	if s.cfg.MaxFileSize > 0 && (s.cfg.MaxDocumentSize <= 0 || s.cfg.MaxFileSize < s.cfg.MaxDocumentSize) {
+		return s.cfg.MaxFileSize
 	}
+	return max(s.cfg.MaxDocumentSize, 0)
+}
 
-	if contentType != "" && contentType != "application/octet-stream" {
-		lexer = lexers.MatchMimeType(contentType)
+// readDocumentFile reads the content of a file and stops as soon as it exceeds the max file size or the size remaining
+// for the document, so too large uploads are never read completely. The size of the file is subtracted from the
+// remaining size, a negative remaining size is unlimited.
+func (s *Server) readDocumentFile(r io.Reader, name string, remaining *int64) ([]byte, error) {
+	limit, limitName, limitMax := int64(-1), "", int64(0)
+	if s.cfg.MaxFileSize > 0 {
+		limit, limitName, limitMax = s.cfg.MaxFileSize, api.LimitMaxFileSize, s.cfg.MaxFileSize
 	}
-	if lexer != nil {
-		return lexer.Config().Name
+	if *remaining >= 0 && (limit < 0 || *remaining < limit) {
+		limit, limitName, limitMax = *remaining, api.LimitMaxDocumentSize, s.cfg.MaxDocumentSize
+	}
+	if limit >= 0 {
+		// reading one byte more tells whether the content is larger than the limit
+		r = io.LimitReader(r, limit+1)
 	}
 
-	if contentType != "" {
-		lexer = lexers.Get(contentType)
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", name, err)
 	}
-	if lexer != nil {
-		return lexer.Config().Name
+	if limit >= 0 && int64(len(data)) > limit {
+		return nil, newLimitError(limitName, limitMax, name)
 	}
+	if *remaining >= 0 {
+		*remaining -= int64(len(data))
+	}
+	return data, nil
+}
 
-	if fileName != "" {
-		lexer = lexers.Match(fileName)
+// newRequestFile detects the language of the file. Encrypted files must be a base64 encoded nonce and AES-GCM
+// ciphertext, their language is only detected from the language, content type and name since the content is unreadable.
+func newRequestFile(name string, data []byte, language string, contentType string, encrypted bool) (*api.RequestFile, error) {
+	content := string(data)
+	if !encrypted {
+		return &api.RequestFile{
+			Name:     name,
+			Content:  content,
+			Language: render.Language(language, contentType, name, content),
+		}, nil
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(content)
+	if err != nil || len(ciphertext) < encryptedOverhead {
+		return nil, httperr.BadRequest(ErrInvalidEncryptedContent)
+	}
+	return &api.RequestFile{
+		Name:      name,
+		Content:   content,
+		Language:  render.Language(language, contentType, name, ""),
+		Encrypted: true,
+	}, nil
+}
+
+// getEncrypted returns whether the files are encrypted from the encrypted query param or the Encrypted header.
+func getEncrypted(query url.Values, header http.Header) (bool, error) {
+	encryptedStr := query.Get("encrypted")
+	if encryptedStr == "" {
+		encryptedStr = header.Get(ezhttp.HeaderEncrypted)
 	}
-	if lexer != nil {
-		return lexer.Config().Name
+	if encryptedStr == "" {
+		return false, nil
 	}
+	encrypted, err := strconv.ParseBool(encryptedStr)
+	if err != nil {
+		return false, httperr.BadRequest(fmt.Errorf("failed to parse encrypted query param: %w", err))
+	}
+	return encrypted, nil
+}
 
-	if len(content) > 0 {
-		lexer = lexers.Analyse(content)
+// getVersionMessage returns the message of the new version from the message query param or the Version-Message header.
+func getVersionMessage(query url.Values, header http.Header) (string, error) {
+	message := query.Get("message")
+	if message == "" {
+		message = header.Get(ezhttp.HeaderVersionMessage)
 	}
-	if lexer != nil {
-		return lexer.Config().Name
+	message = strings.TrimSpace(message)
+	if utf8.RuneCountInString(message) > MaxVersionMessageLength {
+		return "", httperr.BadRequest(ErrVersionMessageTooLong)
 	}
-
-	return "plaintext"
+	return message, nil
 }
 
 func getExpiresAt(query url.Values, header http.Header) (*time.Time, error) {
@@ -1049,7 +1665,7 @@ func getExpiresAt(query url.Values, header http.Header) (*time.Time, error) {
 		expiresAtStr = header.Get("Expires")
 	}
 	if expiresAtStr == "" {
-		return nil, nil
+		return getTTL(query)
 	}
 	expiresAt, err := time.Parse(time.RFC3339, expiresAtStr)
 	if err != nil {
@@ -1060,3 +1676,20 @@ func getExpiresAt(query url.Values, header http.Header) (*time.Time, error) {
 	}
 	return &expiresAt, nil
 }
+
+// getTTL returns the expiration time from the ttl query param which is a duration like 1h30m relative to now.
+func getTTL(query url.Values) (*time.Time, error) {
+	ttlStr := query.Get("ttl")
+	if ttlStr == "" {
+		return nil, nil
+	}
+	ttl, err := time.ParseDuration(ttlStr)
+	if err != nil {
+		return nil, httperr.BadRequest(fmt.Errorf("failed to parse ttl query param: %w", err))
+	}
+	if ttl <= 0 {
+		return nil, httperr.BadRequest(ErrInvalidTTL)
+	}
+	expiresAt := time.Now().Add(ttl)
+	return &expiresAt, nil
+}
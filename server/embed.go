@@ -0,0 +1,131 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/topi314/chroma/v2"
+	"github.com/topi314/chroma/v2/styles"
+
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+	"github.com/topi314/gobin/v3/server/templates"
+)
+
+var ErrEmbedDisabled = errors.New("embedding documents is disabled")
+
+// GetDocumentEmbed renders the document for the iframes of embed.js. The file query parameter only shows a single
+// file, the style and theme query parameters pick the style like the page which embeds the document.
+func (s *Server) GetDocumentEmbed(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.Embed.Enabled {
+		s.prettyError(w, r, httperr.NotFound(ErrEmbedDisabled))
+		return
+	}
+
+	document, err := s.getDocument(r, func(documentID string) string {
+		uri := new(url.URL)
+		*uri = *r.URL
+		uri.Path = fmt.Sprintf("/%s/embed", documentID)
+		return uri.String()
+	})
+	if err != nil {
+		s.prettyError(w, r, err)
+		return
+	}
+
+	files := document.Files
+	if fileName := r.URL.Query().Get("file"); fileName != "" {
+		files = nil
+		for _, file := range document.Files {
+			if file.Name == fileName {
+				files = []database.File{file}
+				break
+			}
+		}
+		if len(files) == 0 {
+			s.prettyError(w, r, httperr.NotFound(ErrDocumentFileNotFound))
+			return
+		}
+	}
+
+	documentStyle, err := s.db.GetDocumentStyle(r.Context(), document.ID)
+	if err != nil {
+		s.prettyError(w, r, err)
+		return
+	}
+	style := s.embedStyle(r, documentStyle)
+
+	if len(s.cfg.Embed.FrameAncestors) > 0 {
+		w.Header().Set(ezhttp.HeaderContentSecurityPolicy, "frame-ancestors "+strings.Join(s.cfg.Embed.FrameAncestors, " "))
+	}
+	if checkNotModified(w, r, s.documentETag(r, files, style.Name), documentModTime(files)) {
+		return
+	}
+
+	// embeds of the latest version link to the latest version, so the links follow updates of the document
+	documentURL := "/" + document.ID
+	rawURL := "/raw/" + document.ID
+	if chi.URLParam(r, "version") != "" {
+		documentURL += "/" + strconv.FormatInt(document.Version, 10)
+		rawURL += "/versions/" + strconv.FormatInt(document.Version, 10)
+	}
+
+	embedFiles := make([]templates.EmbedFile, len(files))
+	for i, file := range files {
+		if file.Encrypted {
+			file.Content = encryptedPreview
+			file.Language = "plaintext"
+			file.Encrypted = false
+		}
+		formatted, err := s.formatFile(r.Context(), file, s.htmlFormatter, style)
+		if err != nil {
+			s.prettyError(w, r, fmt.Errorf("failed to render document embed: %w", err))
+			return
+		}
+		embedFiles[i] = templates.EmbedFile{
+			Name:      file.Name,
+			Language:  file.Language,
+			Formatted: formatted,
+			RawURL:    rawURL + "/files/" + url.PathEscape(file.Name),
+		}
+	}
+
+	if err = templates.Embed(templates.EmbedVars{
+		Key:         document.ID,
+		DocumentURL: documentURL,
+		Files:       embedFiles,
+		Style:       style.Name,
+		Theme:       style.Theme,
+		Assets:      s.assetManifest,
+	}).Render(r.Context(), w); err != nil && !errors.Is(err, http.ErrHandlerTimeout) {
+		slog.ErrorContext(r.Context(), "failed to execute embed template", slog.Any("err", err))
+	}
+}
+
+// embedStyle returns the style of the style query parameter, the style suggested by the creator if it fits the theme
+// of the embedding page or the default style for the theme. Cookies are mostly blocked in iframes of other sites, so
+// the style of the user is not used.
+func (s *Server) embedStyle(r *http.Request, documentStyle string) *chroma.Style {
+	query := r.URL.Query()
+	if style, ok := styles.Registry[query.Get("style")]; ok {
+		return style
+	}
+
+	theme := query.Get("theme")
+	if style, ok := styles.Registry[documentStyle]; ok && (theme == "" || style.Theme == theme) {
+		return style
+	}
+	if theme == ColorSchemeLight {
+		if style, ok := styles.Registry[s.cfg.DefaultLightStyle]; ok {
+			return style
+		}
+	}
+	return styles.Fallback
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+const (
+	EventCreate  string = "create"
+	EventUpdate  string = "update"
+	EventDelete  string = "delete"
+	EventExpire  string = "expire"
+	EventPrune   string = "prune"
+	EventShare   string = "share"
+	EventWebhook string = "webhook"
+	EventHook    string = "hook"
+	EventMerge   string = "merge"
+	EventIngest  string = "ingest"
+
+	EventRevisionPending  string = "revision_pending"
+	EventRevisionApproved string = "revision_approved"
+	EventRevisionRejected string = "revision_rejected"
+)
+
+const (
+	defaultEventsLimit = 100
+	maxEventsLimit     = 1000
+)
+
+var (
+	ErrMissingEventsDocument = errors.New("missing document query parameter")
+	ErrInvalidEventsCursor   = errors.New("invalid since cursor")
+	ErrInvalidEventsLimit    = errors.New("invalid limit, must be between 1 and 1000")
+	ErrEventsDisabled        = errors.New("document events disabled")
+)
+
+type (
+	EventsResponse struct {
+		Events []EventResponse `json:"events"`
+		Next   string          `json:"next"`
+	}
+
+	EventResponse struct {
+		ID          string          `json:"id"`
+		DocumentKey string          `json:"document_key"`
+		Version     int64           `json:"version"`
+		Event       string          `json:"event"`
+		Data        json.RawMessage `json:"data"`
+		CreatedAt   time.Time       `json:"created_at"`
+	}
+
+	EventData struct {
+		Files []EventDataFile `json:"files"`
+	}
+
+	EventDataFile struct {
+		Name      string     `json:"name"`
+		Language  string     `json:"language"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	EventShareData struct {
+		Permissions []string `json:"permissions"`
+	}
+
+	EventMergeData struct {
+		Source        string `json:"source"`
+		SourceVersion int64  `json:"source_version"`
+	}
+
+	EventRevisionData struct {
+		Revision int64           `json:"revision"`
+		Files    []EventDataFile `json:"files,omitempty"`
+	}
+
+	// EventPruneData is the data of versions pruned by the retention limits, the reason is the limit which was exceeded.
+	EventPruneData struct {
+		Reason string          `json:"reason"`
+		Files  []EventDataFile `json:"files"`
+	}
+
+	EventWebhookData struct {
+		WebhookID string `json:"webhook_id"`
+		Event     string `json:"event"`
+		Success   bool   `json:"success"`
+		Tries     int    `json:"tries"`
+	}
+)
+
+// RecordEvent persists a document event so consumers can replay it later via the events endpoint.
+func (s *Server) RecordEvent(ctx context.Context, event string, documentID string, version int64, data any) {
+	// deliveries of account events like login have no document to record them for
+	if !s.cfg.Events.Enabled || documentID == "" {
+		return
+	}
+
+	ctx, span := s.tracer.Start(ctx, "recordEvent", trace.WithAttributes(
+		attribute.String("event", event),
+		attribute.String("document_id", documentID),
+	))
+	defer span.End()
+
+	rawData, err := json.Marshal(data)
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to encode event data")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "failed to encode event data", slog.Any("err", err))
+		return
+	}
+
+	if _, err = s.db.CreateEvent(context.WithoutCancel(ctx), database.Event{
+		DocumentID:      documentID,
+		DocumentVersion: version,
+		Event:           event,
+		Data:            string(rawData),
+		CreatedAt:       time.Now(),
+	}); err != nil {
+		span.SetStatus(codes.Error, "failed to create event")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "failed to create event", slog.String("event", event), slog.String("document_id", documentID), slog.Any("err", err))
+	}
+}
+
+func newEventData(files []database.File) EventData {
+	dataFiles := make([]EventDataFile, len(files))
+	for i, file := range files {
+		dataFiles[i] = EventDataFile{
+			Name:      file.Name,
+			Language:  file.Language,
+			ExpiresAt: file.ExpiresAt,
+		}
+	}
+	return EventData{Files: dataFiles}
+}
+
+func (s *Server) GetEvents(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.Events.Enabled {
+		s.error(w, r, httperr.NotFound(ErrEventsDisabled))
+		return
+	}
+
+	query := r.URL.Query()
+	documentID := query.Get("document")
+	if documentID == "" {
+		s.error(w, r, httperr.BadRequest(ErrMissingEventsDocument))
+		return
+	}
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("events")))
+		return
+	}
+
+	var since int64
+	if sinceStr := query.Get("since"); sinceStr != "" {
+		var err error
+		since, err = strconv.ParseInt(sinceStr, 10, 64)
+		if err != nil || since < 0 {
+			s.error(w, r, httperr.BadRequest(ErrInvalidEventsCursor))
+			return
+		}
+	}
+
+	limit := defaultEventsLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxEventsLimit {
+			s.error(w, r, httperr.BadRequest(ErrInvalidEventsLimit))
+			return
+		}
+	}
+
+	events, err := s.db.GetEvents(r.Context(), documentID, since, limit)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	response := EventsResponse{
+		Events: make([]EventResponse, len(events)),
+		Next:   strconv.FormatInt(since, 10),
+	}
+	for i, event := range events {
+		response.Events[i] = EventResponse{
+			ID:          strconv.FormatInt(event.ID, 10),
+			DocumentKey: event.DocumentID,
+			Version:     event.DocumentVersion,
+			Event:       event.Event,
+			Data:        json.RawMessage(event.Data),
+			CreatedAt:   event.CreatedAt,
+		}
+		response.Next = response.Events[i].ID
+	}
+
+	s.ok(w, r, response)
+}
@@ -0,0 +1,271 @@
+// Package featureflags evaluates feature flags per request, so risky features can be enabled for some tenants or a
+// percentage of the requests first. Flags are configured in the config and optionally evaluated by a remote provider
+// which speaks the OpenFeature Remote Evaluation Protocol like flagd. Every evaluation is recorded on the span of the
+// request.
+package featureflags
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/topi314/gobin/v3/internal/timex"
+)
+
+type Type string
+
+const (
+	// TypeConfig only evaluates the flags of the config.
+	TypeConfig Type = "config"
+	// TypeOFREP evaluates the flags with a provider speaking the OpenFeature Remote Evaluation Protocol, flags of the
+	// config are used if the provider doesn't know a flag or fails.
+	TypeOFREP Type = "ofrep"
+)
+
+const (
+	ReasonStatic         = "STATIC"
+	ReasonTargetingMatch = "TARGETING_MATCH"
+	ReasonSplit          = "SPLIT"
+	ReasonDefault        = "DEFAULT"
+	ReasonError          = "ERROR"
+)
+
+// maxCacheEntries limits the cached remote evaluations, the cache is cleared once it is full.
+const maxCacheEntries = 10000
+
+type Config struct {
+	Provider Type           `toml:"provider"`
+	URL      string         `toml:"url"`
+	APIKey   string         `toml:"api_key"`
+	Timeout  timex.Duration `toml:"timeout"`
+	// CacheTTL is how long evaluations of the remote provider are cached per flag and evaluation context.
+	CacheTTL timex.Duration        `toml:"cache_ttl"`
+	Flags    map[string]FlagConfig `toml:"flags"`
+}
+
+func (c Config) String() string {
+	flags := make([]string, 0, len(c.Flags))
+	for key, flag := range c.Flags {
+		flags = append(flags, fmt.Sprintf("\n  %s: %s", key, flag))
+	}
+	slices.Sort(flags)
+	return fmt.Sprintf("\n Provider: %s\n URL: %s\n APIKey: %s\n Timeout: %s\n CacheTTL: %s\n Flags: %s",
+		c.Provider,
+		c.URL,
+		strings.Repeat("*", len(c.APIKey)),
+		time.Duration(c.Timeout),
+		time.Duration(c.CacheTTL),
+		strings.Join(flags, ""),
+	)
+}
+
+// FlagConfig enables a flag for everyone, for the listed tenants or for a percentage of the evaluation contexts.
+type FlagConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Percentage of the evaluation contexts the flag is enabled for, the same targeting key always gets the same result.
+	Percentage float64  `toml:"percentage"`
+	Tenants    []string `toml:"tenants"`
+}
+
+func (c FlagConfig) String() string {
+	return fmt.Sprintf("Enabled: %t, Percentage: %g, Tenants: %v", c.Enabled, c.Percentage, c.Tenants)
+}
+
+// EvaluationContext describes whom a flag is evaluated for.
+type EvaluationContext struct {
+	// TargetingKey identifies the user or client, percentages are split by it.
+	TargetingKey string
+	Tenant       string
+}
+
+type evaluationContextKey struct{}
+
+// WithContext returns a context with the evaluation context of the request.
+func WithContext(ctx context.Context, evalCtx EvaluationContext) context.Context {
+	return context.WithValue(ctx, evaluationContextKey{}, evalCtx)
+}
+
+// FromContext returns the evaluation context of the request or an empty one.
+func FromContext(ctx context.Context) EvaluationContext {
+	evalCtx, _ := ctx.Value(evaluationContextKey{}).(EvaluationContext)
+	return evalCtx
+}
+
+// Evaluation is the result of evaluating a flag.
+type Evaluation struct {
+	Key     string
+	Value   bool
+	Variant string
+	Reason  string
+}
+
+// Provider evaluates flags remotely, ErrFlagNotFound makes the flags of the config decide.
+type Provider interface {
+	Name() string
+	Evaluate(ctx context.Context, key string, evalCtx EvaluationContext) (Evaluation, error)
+}
+
+var ErrFlagNotFound = errors.New("feature flag not found")
+
+func New(cfg Config) (*Flags, error) {
+	f := &Flags{
+		cfg:   cfg,
+		cache: make(map[cacheKey]cachedEvaluation),
+	}
+	switch cfg.Provider {
+	case "", TypeConfig:
+	case TypeOFREP:
+		if cfg.URL == "" {
+			return nil, errors.New("feature flag provider url is required")
+		}
+		f.provider = &ofrepProvider{
+			cfg: cfg,
+			client: &http.Client{
+				Transport: otelhttp.NewTransport(http.DefaultTransport),
+				Timeout:   time.Duration(cfg.Timeout),
+			},
+		}
+	default:
+		return nil, errors.New("invalid feature flag provider, must be one of: config, ofrep")
+	}
+	return f, nil
+}
+
+type Flags struct {
+	cfg      Config
+	provider Provider
+
+	mu    sync.Mutex
+	cache map[cacheKey]cachedEvaluation
+}
+
+type cacheKey struct {
+	key     string
+	evalCtx EvaluationContext
+}
+
+type cachedEvaluation struct {
+	evaluation Evaluation
+	// notFound caches that the provider doesn't know the flag, so flags of the config don't ask it every time.
+	notFound  bool
+	expiresAt time.Time
+}
+
+// Enabled returns whether the flag is enabled for the evaluation context of the request. Unknown flags are disabled.
+func (f *Flags) Enabled(ctx context.Context, key string) bool {
+	return f.Evaluate(ctx, key).Value
+}
+
+// Evaluate evaluates the flag for the evaluation context of the request and records the result on its span.
+func (f *Flags) Evaluate(ctx context.Context, key string) Evaluation {
+	evalCtx := FromContext(ctx)
+	providerName := string(TypeConfig)
+
+	var (
+		evaluation Evaluation
+		err        error
+	)
+	if f.provider != nil {
+		providerName = f.provider.Name()
+		evaluation, err = f.evaluateRemote(ctx, key, evalCtx)
+		if errors.Is(err, ErrFlagNotFound) {
+			err = nil
+			providerName = string(TypeConfig)
+			evaluation = f.evaluateConfig(key, evalCtx)
+		} else if err != nil {
+			slog.WarnContext(ctx, "failed to evaluate feature flag, using the config", slog.String("key", key), slog.Any("err", err))
+			evaluation = f.evaluateConfig(key, evalCtx)
+			evaluation.Reason = ReasonError
+		}
+	} else {
+		evaluation = f.evaluateConfig(key, evalCtx)
+	}
+
+	// https://opentelemetry.io/docs/specs/semconv/feature-flags/feature-flags-spans/
+	attributes := []attribute.KeyValue{
+		attribute.String("feature_flag.key", key),
+		attribute.String("feature_flag.provider.name", providerName),
+		attribute.Bool("feature_flag.result.value", evaluation.Value),
+		attribute.String("feature_flag.result.reason", strings.ToLower(evaluation.Reason)),
+	}
+	if evaluation.Variant != "" {
+		attributes = append(attributes, attribute.String("feature_flag.result.variant", evaluation.Variant))
+	}
+	if evalCtx.TargetingKey != "" {
+		attributes = append(attributes, attribute.String("feature_flag.context.id", evalCtx.TargetingKey))
+	}
+	if err != nil {
+		attributes = append(attributes, attribute.String("error.message", err.Error()))
+	}
+	trace.SpanFromContext(ctx).AddEvent("feature_flag.evaluation", trace.WithAttributes(attributes...))
+	return evaluation
+}
+
+func (f *Flags) evaluateRemote(ctx context.Context, key string, evalCtx EvaluationContext) (Evaluation, error) {
+	ck := cacheKey{key: key, evalCtx: evalCtx}
+	if f.cfg.CacheTTL > 0 {
+		f.mu.Lock()
+		cached, ok := f.cache[ck]
+		f.mu.Unlock()
+		if ok && time.Now().Before(cached.expiresAt) {
+			if cached.notFound {
+				return Evaluation{}, ErrFlagNotFound
+			}
+			return cached.evaluation, nil
+		}
+	}
+
+	evaluation, err := f.provider.Evaluate(ctx, key, evalCtx)
+	notFound := errors.Is(err, ErrFlagNotFound)
+	if err != nil && !notFound {
+		return Evaluation{}, err
+	}
+	if f.cfg.CacheTTL > 0 {
+		f.mu.Lock()
+		if len(f.cache) >= maxCacheEntries {
+			clear(f.cache)
+		}
+		f.cache[ck] = cachedEvaluation{
+			evaluation: evaluation,
+			notFound:   notFound,
+			expiresAt:  time.Now().Add(time.Duration(f.cfg.CacheTTL)),
+		}
+		f.mu.Unlock()
+	}
+	return evaluation, err
+}
+
+func (f *Flags) evaluateConfig(key string, evalCtx EvaluationContext) Evaluation {
+	flag, ok := f.cfg.Flags[key]
+	switch {
+	case !ok:
+		return Evaluation{Key: key, Reason: ReasonDefault}
+	case flag.Enabled:
+		return Evaluation{Key: key, Value: true, Reason: ReasonStatic}
+	case evalCtx.Tenant != "" && slices.Contains(flag.Tenants, evalCtx.Tenant):
+		return Evaluation{Key: key, Value: true, Reason: ReasonTargetingMatch}
+	case flag.Percentage > 0 && evalCtx.TargetingKey != "":
+		return Evaluation{Key: key, Value: bucket(key, evalCtx.TargetingKey) < flag.Percentage, Reason: ReasonSplit}
+	default:
+		return Evaluation{Key: key, Reason: ReasonDefault}
+	}
+}
+
+// bucket returns a stable number between 0 and 100 for the flag and targeting key, so a client keeps its result and
+// different flags are enabled for different clients.
+func bucket(key string, targetingKey string) float64 {
+	sum := sha256.Sum256([]byte(key + "/" + targetingKey))
+	return float64(binary.BigEndian.Uint32(sum[:4])) / (1 << 32) * 100
+}
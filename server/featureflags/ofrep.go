@@ -0,0 +1,91 @@
+package featureflags
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+)
+
+// ofrepProvider evaluates flags with the OpenFeature Remote Evaluation Protocol.
+// https://github.com/open-feature/protocol
+type ofrepProvider struct {
+	cfg    Config
+	client *http.Client
+}
+
+type ofrepRequest struct {
+	Context map[string]string `json:"context"`
+}
+
+type ofrepResponse struct {
+	Key       string `json:"key"`
+	Value     any    `json:"value"`
+	Reason    string `json:"reason"`
+	Variant   string `json:"variant"`
+	ErrorCode string `json:"errorCode"`
+}
+
+func (p *ofrepProvider) Name() string {
+	return string(TypeOFREP)
+}
+
+func (p *ofrepProvider) Evaluate(ctx context.Context, key string, evalCtx EvaluationContext) (Evaluation, error) {
+	evaluationContext := map[string]string{
+		"targetingKey": evalCtx.TargetingKey,
+	}
+	if evalCtx.Tenant != "" {
+		evaluationContext["tenant"] = evalCtx.Tenant
+	}
+	body, err := json.Marshal(ofrepRequest{Context: evaluationContext})
+	if err != nil {
+		return Evaluation{}, err
+	}
+
+	rq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(p.cfg.URL, "/")+"/ofrep/v1/evaluate/flags/"+url.PathEscape(key), bytes.NewReader(body))
+	if err != nil {
+		return Evaluation{}, err
+	}
+	rq.Header.Set(ezhttp.HeaderContentType, ezhttp.ContentTypeJSON)
+	if p.cfg.APIKey != "" {
+		rq.Header.Set(ezhttp.HeaderAuthorization, "Bearer "+p.cfg.APIKey)
+	}
+
+	rs, err := p.client.Do(rq)
+	if err != nil {
+		return Evaluation{}, fmt.Errorf("failed to evaluate feature flag: %w", err)
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode == http.StatusNotFound {
+		return Evaluation{}, ErrFlagNotFound
+	}
+	if rs.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(rs.Body, 1024))
+		return Evaluation{}, fmt.Errorf("failed to evaluate feature flag: %s: %s", rs.Status, bytes.TrimSpace(msg))
+	}
+
+	var ofrepRs ofrepResponse
+	if err = json.NewDecoder(rs.Body).Decode(&ofrepRs); err != nil {
+		return Evaluation{}, fmt.Errorf("failed to decode feature flag evaluation: %w", err)
+	}
+	if ofrepRs.ErrorCode == "FLAG_NOT_FOUND" {
+		return Evaluation{}, ErrFlagNotFound
+	}
+	value, ok := ofrepRs.Value.(bool)
+	if !ok {
+		return Evaluation{}, fmt.Errorf("feature flag %s is not a boolean flag", key)
+	}
+	return Evaluation{
+		Key:     key,
+		Value:   value,
+		Variant: ofrepRs.Variant,
+		Reason:  ofrepRs.Reason,
+	}, nil
+}
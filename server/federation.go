@@ -0,0 +1,305 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	memcache "github.com/goware/cachestore-mem"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/gio"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+	"github.com/topi314/gobin/v3/server/templates"
+)
+
+var (
+	ErrFederationDisabled       = errors.New("federation disabled")
+	ErrFederationHostNotAllowed = errors.New("federation host not allowed")
+	ErrFederationNotGobin       = errors.New("federation host is not a gobin instance")
+	ErrFederationTooLarge       = errors.New("federated document too large")
+	ErrFederationStatus         = func(status int) error {
+		return fmt.Errorf("federation host returned status %d", status)
+	}
+)
+
+// federation fetches documents from other gobin instances. Hosts are checked to run gobin before their documents are
+// fetched, the check is repeated after the cache ttl like the cached documents.
+type federation struct {
+	client    *http.Client
+	documents *memcache.MemLRU[*api.DocumentResponse]
+
+	mu           sync.Mutex
+	checkedHosts map[string]time.Time
+}
+
+func newFederation(cfg FederationConfig) *federation {
+	var documents *memcache.MemLRU[*api.DocumentResponse]
+	if cfg.CacheSize > 0 {
+		var err error
+		if documents, err = memcache.NewCacheWithSize[*api.DocumentResponse](uint32(cfg.CacheSize)); err != nil {
+			slog.Error("Failed to create federation cache, documents are not cached", slog.Any("err", err))
+		}
+	}
+
+	return &federation{
+		client: &http.Client{
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+			Timeout:   time.Duration(cfg.Timeout),
+			CheckRedirect: func(rq *http.Request, via []*http.Request) error {
+				// redirects would leave the allowed hosts
+				return http.ErrUseLastResponse
+			},
+		},
+		documents:    documents,
+		checkedHosts: make(map[string]time.Time),
+	}
+}
+
+// GetFederatedDocument renders a document of another gobin instance with the style and page of this server. Only the
+// hosts of federation.hosts are allowed.
+func (s *Server) GetFederatedDocument(w http.ResponseWriter, r *http.Request) {
+	if s.federation == nil {
+		s.prettyError(w, r, httperr.NotFound(ErrFederationDisabled))
+		return
+	}
+
+	host := strings.ToLower(chi.URLParam(r, "host"))
+	documentID := chi.URLParam(r, "documentID")
+	if !slices.ContainsFunc(s.cfg.Federation.Hosts, func(allowed string) bool {
+		return strings.EqualFold(allowed, host)
+	}) {
+		s.prettyError(w, r, httperr.Forbidden(ErrFederationHostNotAllowed))
+		return
+	}
+
+	var version int64
+	if versionStr := chi.URLParam(r, "version"); versionStr != "" {
+		var err error
+		if version, err = strconv.ParseInt(versionStr, 10, 64); err != nil {
+			s.prettyError(w, r, httperr.BadRequest(ErrInvalidDocumentVersion))
+			return
+		}
+	}
+
+	document, err := s.getFederatedDocument(r.Context(), host, documentID, version)
+	if err != nil {
+		s.prettyError(w, r, err)
+		return
+	}
+	if len(document.Files) == 0 {
+		s.prettyError(w, r, httperr.NotFound(ErrDocumentNotFound))
+		return
+	}
+
+	currentFile := 0
+	if fileName := r.URL.Query().Get("file"); fileName != "" {
+		currentFile = slices.IndexFunc(document.Files, func(file api.ResponseFile) bool {
+			return file.Name == fileName
+		})
+		if currentFile == -1 {
+			s.prettyError(w, r, httperr.NotFound(ErrDocumentFileNotFound))
+			return
+		}
+	}
+
+	style := s.getDocumentStyle(r, s.getUserSettings(r), document.DefaultStyle)
+	responseFile := document.Files[currentFile]
+	file := database.File{
+		Name:      responseFile.Name,
+		Content:   responseFile.Content,
+		Language:  responseFile.Language,
+		Encrypted: responseFile.Encrypted,
+	}
+	if file.Encrypted {
+		file.Content = encryptedPreview
+		file.Language = "plaintext"
+		file.Encrypted = false
+	}
+	formatted, err := s.formatFile(r.Context(), file, s.htmlFormatter, style)
+	if err != nil {
+		s.prettyError(w, r, fmt.Errorf("failed to render federated document: %w", err))
+		return
+	}
+
+	originURL := s.federationURL(host, document.Key)
+	rawURL := s.federationURL(host, "raw", document.Key)
+	if version > 0 {
+		originURL += "/" + strconv.FormatInt(document.Version, 10)
+		rawURL += "/versions/" + strconv.FormatInt(document.Version, 10)
+	}
+
+	files := make([]templates.FederatedFile, len(document.Files))
+	for i, f := range document.Files {
+		files[i] = templates.FederatedFile{
+			Name:      f.Name,
+			Language:  f.Language,
+			Encrypted: f.Encrypted,
+			URL:       "?file=" + url.QueryEscape(f.Name),
+			RawURL:    rawURL + "/files/" + url.PathEscape(f.Name),
+		}
+	}
+	files[currentFile].Formatted = formatted
+
+	// the latest version is returned without its version
+	versionLabel := "latest"
+	if document.Version > 0 {
+		versionLabel = time.UnixMilli(document.Version).Format(VersionTimeFormat)
+	}
+
+	if err = templates.Federated(templates.FederatedVars{
+		Host:         host,
+		Key:          document.Key,
+		VersionLabel: versionLabel,
+		OriginURL:    originURL,
+		Files:        files,
+		CurrentFile:  currentFile,
+		Style:        style.Name,
+		Theme:        style.Theme,
+		Assets:       s.assetManifest,
+	}).Render(r.Context(), w); err != nil && !errors.Is(err, http.ErrHandlerTimeout) {
+		slog.ErrorContext(r.Context(), "failed to execute federated template", slog.Any("err", err))
+	}
+}
+
+// getFederatedDocument returns the document from the cache or fetches it from the host.
+func (s *Server) getFederatedDocument(ctx context.Context, host string, documentID string, version int64) (*api.DocumentResponse, error) {
+	cacheKey := host + "/" + documentID + "/" + strconv.FormatInt(version, 10)
+	if s.federation.documents != nil {
+		if document, ok, _ := s.federation.documents.Get(ctx, cacheKey); ok {
+			return document, nil
+		}
+	}
+
+	ctx, span := s.tracer.Start(ctx, "getFederatedDocument", trace.WithAttributes(
+		attribute.String("host", host),
+		attribute.String("document_id", documentID),
+		attribute.Int64("version", version),
+	))
+	defer span.End()
+
+	if err := s.checkFederationHost(ctx, host); err != nil {
+		span.SetStatus(codes.Error, "failed to check federation host")
+		span.RecordError(err)
+		return nil, err
+	}
+
+	documentURL := s.federationURL(host, "documents", documentID)
+	if version > 0 {
+		documentURL += "/versions/" + strconv.FormatInt(version, 10)
+	}
+	var document api.DocumentResponse
+	if err := s.fetchFederation(ctx, documentURL, func(rs *http.Response, reader io.Reader) error {
+		if contentType, _, _ := mime.ParseMediaType(rs.Header.Get(ezhttp.HeaderContentType)); contentType != ezhttp.ContentTypeJSON {
+			return httperr.BadGateway(ErrFederationNotGobin)
+		}
+		if err := json.NewDecoder(reader).Decode(&document); err != nil {
+			if errors.Is(err, gio.ErrLimitReached) {
+				return httperr.BadGateway(ErrFederationTooLarge)
+			}
+			return httperr.BadGateway(fmt.Errorf("failed to decode federated document: %w", err))
+		}
+		return nil
+	}); err != nil {
+		span.SetStatus(codes.Error, "failed to fetch federated document")
+		span.RecordError(err)
+		return nil, err
+	}
+	if document.Key != documentID {
+		return nil, httperr.BadGateway(ErrFederationNotGobin)
+	}
+
+	if s.federation.documents != nil {
+		_ = s.federation.documents.SetEx(ctx, cacheKey, &document, time.Duration(s.cfg.Federation.CacheTTL))
+	}
+	return &document, nil
+}
+
+// checkFederationHost makes sure the host runs gobin by checking its version endpoint.
+func (s *Server) checkFederationHost(ctx context.Context, host string) error {
+	s.federation.mu.Lock()
+	checkedAt, ok := s.federation.checkedHosts[host]
+	s.federation.mu.Unlock()
+	if ok && time.Since(checkedAt) < time.Duration(s.cfg.Federation.CacheTTL) {
+		return nil
+	}
+
+	if err := s.fetchFederation(ctx, s.federationURL(host, "version"), func(_ *http.Response, reader io.Reader) error {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return httperr.BadGateway(ErrFederationNotGobin)
+		}
+		if !strings.Contains(string(data), "\nVersion: ") {
+			return httperr.BadGateway(ErrFederationNotGobin)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	s.federation.mu.Lock()
+	s.federation.checkedHosts[host] = time.Now()
+	s.federation.mu.Unlock()
+	return nil
+}
+
+// fetchFederation sends a GET request to the url and passes the response body limited to federation.max_size to read.
+func (s *Server) fetchFederation(ctx context.Context, rawURL string, read func(rs *http.Response, reader io.Reader) error) error {
+	rq, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create federation request: %w", err)
+	}
+	rq.Header.Set(ezhttp.HeaderAccept, ezhttp.ContentTypeJSON)
+	rq.Header.Set(ezhttp.HeaderUserAgent, fmt.Sprintf("gobin/%s", s.version.Version))
+
+	rs, err := s.federation.client.Do(rq)
+	if err != nil {
+		slog.DebugContext(ctx, "failed to fetch from federation host", slog.String("url", rawURL), slog.Any("err", err))
+		return httperr.BadGateway(fmt.Errorf("failed to fetch from federation host: %w", err))
+	}
+	defer func() {
+		_ = rs.Body.Close()
+	}()
+
+	if rs.StatusCode == http.StatusNotFound {
+		return httperr.NotFound(ErrDocumentNotFound)
+	}
+	if rs.StatusCode != http.StatusOK {
+		return httperr.BadGateway(ErrFederationStatus(rs.StatusCode))
+	}
+
+	reader := io.Reader(rs.Body)
+	if s.cfg.Federation.MaxSize > 0 {
+		reader = gio.LimitReader(rs.Body, s.cfg.Federation.MaxSize)
+	}
+	return read(rs, reader)
+}
+
+func (s *Server) federationURL(host string, segments ...string) string {
+	scheme := "https"
+	if s.cfg.Federation.Insecure {
+		scheme = "http"
+	}
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return scheme + "://" + host + "/" + strings.Join(segments, "/")
+}
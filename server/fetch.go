@@ -0,0 +1,174 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/gio"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/internal/render"
+)
+
+// defaultFromURLMaxSize caps fetched contents if neither from_url.max_size nor a max file or document size is set.
+const defaultFromURLMaxSize = 10 * 1024 * 1024
+
+var (
+	ErrInvalidFromURL        = errors.New("invalid from_url, must be an absolute http or https url")
+	ErrFromURLAddressBlocked = errors.New("from_url resolves to a blocked address")
+	ErrFromURLEmpty          = errors.New("from_url returned no content")
+	ErrFromURLStatus         = func(status int) error {
+		return fmt.Errorf("from_url returned status %d", status)
+	}
+)
+
+func newFetchClient(cfg FromURLConfig) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+	}
+	if !cfg.AllowPrivateNetworks {
+		dialer.Control = func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || isBlockedIP(ip) {
+				return ErrFromURLAddressBlocked
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Transport: otelhttp.NewTransport(transport),
+		Timeout:   time.Duration(cfg.Timeout),
+		CheckRedirect: func(rq *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("stopped after 5 redirects")
+			}
+			if rq.URL.Scheme != "http" && rq.URL.Scheme != "https" {
+				return ErrInvalidFromURL
+			}
+			return nil
+		},
+	}
+}
+
+func isBlockedIP(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast()
+}
+
+// parseFromURLRequest returns the url of a from_url request body or an empty string if the body is regular document content.
+func parseFromURLRequest(contentType string, data []byte) string {
+	if contentType != ezhttp.ContentTypeJSON {
+		return ""
+	}
+
+	var rq api.FromURLRequest
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rq); err != nil {
+		return ""
+	}
+	return rq.FromURL
+}
+
+func (s *Server) fetchDocumentFile(ctx context.Context, rawURL string) (*api.RequestFile, error) {
+	ctx, span := s.tracer.Start(ctx, "fetchDocumentFile", trace.WithAttributes(
+		attribute.String("url", rawURL),
+	))
+	defer span.End()
+
+	uri, err := url.Parse(rawURL)
+	if err != nil || !uri.IsAbs() || (uri.Scheme != "http" && uri.Scheme != "https") || uri.Host == "" {
+		return nil, httperr.BadRequest(ErrInvalidFromURL)
+	}
+
+	rq, err := http.NewRequestWithContext(ctx, http.MethodGet, uri.String(), nil)
+	if err != nil {
+		return nil, httperr.BadRequest(ErrInvalidFromURL)
+	}
+	rq.Header.Set(ezhttp.HeaderUserAgent, fmt.Sprintf("gobin/%s", s.version.Version))
+
+	rs, err := s.fetchClient.Do(rq)
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to fetch url")
+		span.RecordError(err)
+		if errors.Is(err, ErrFromURLAddressBlocked) {
+			return nil, httperr.BadRequest(ErrFromURLAddressBlocked)
+		}
+		slog.DebugContext(ctx, "failed to fetch from_url", slog.String("url", rawURL), slog.Any("err", err))
+		return nil, httperr.BadGateway(fmt.Errorf("failed to fetch from_url: %w", err))
+	}
+	defer func() {
+		_ = rs.Body.Close()
+	}()
+
+	if rs.StatusCode < 200 || rs.StatusCode >= 300 {
+		return nil, httperr.BadGateway(ErrFromURLStatus(rs.StatusCode))
+	}
+
+	maxSize := s.cfg.FromURL.MaxSize
+	if maxSize <= 0 {
+		maxSize = s.maxFileSize()
+	}
+	if maxSize <= 0 {
+		maxSize = defaultFromURLMaxSize
+	}
+
+	data, err := io.ReadAll(gio.LimitReader(rs.Body, maxSize))
+	if err != nil {
+		if errors.Is(err, gio.ErrLimitReached) {
+			return nil, httperr.BadRequest(ErrDocumentTooLarge(maxSize))
+		}
+		return nil, httperr.BadGateway(fmt.Errorf("failed to read from_url body: %w", err))
+	}
+	if len(data) == 0 {
+		return nil, httperr.BadRequest(ErrFromURLEmpty)
+	}
+
+	var contentType string
+	if rsContentType := rs.Header.Get(ezhttp.HeaderContentType); rsContentType != "" {
+		contentType, _, _ = mime.ParseMediaType(rsContentType)
+	}
+
+	name := path.Base(rs.Request.URL.Path)
+	if name == "/" || name == "." {
+		name = "untitled"
+	}
+
+	return &api.RequestFile{
+		Name:     name,
+		Content:  string(data),
+		Language: render.Language("", contentType, name, string(data)),
+	}, nil
+}
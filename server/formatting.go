@@ -1,14 +1,14 @@
 package server
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"net/http"
 
 	"github.com/topi314/chroma/v2"
 	"github.com/topi314/chroma/v2/formatters"
-	"github.com/topi314/chroma/v2/lexers"
 
+	"github.com/topi314/gobin/v3/internal/render"
 	"github.com/topi314/gobin/v3/server/database"
 )
 
@@ -29,27 +29,19 @@ func getFormatter(r *http.Request, fallback bool) (chroma.Formatter, string) {
 	return formatter, formatterName
 }
 
-func (s *Server) formatFile(file database.File, formatter chroma.Formatter, style *chroma.Style) (string, error) {
+func (s *Server) formatFile(ctx context.Context, file database.File, formatter chroma.Formatter, style *chroma.Style) (string, error) {
 	if formatter == nil {
 		return file.Content, nil
 	}
-	lexer := lexers.Get(file.Language)
-	if s.cfg.MaxHighlightSize > 0 && len([]rune(file.Content)) > s.cfg.MaxHighlightSize {
-		lexer = lexers.Get("plaintext")
-	}
-	if lexer == nil {
-		lexer = lexers.Fallback
+	// the content of encrypted files is unreadable, so it is neither rendered by plugins nor highlighted
+	if file.Encrypted {
+		return render.Highlight(formatter, style, "plaintext", file.Content, s.cfg.MaxHighlightSize)
 	}
 
-	iterator, err := lexer.Tokenise(nil, file.Content)
+	file, err := s.plugins.Render(ctx, s.tracer, file)
 	if err != nil {
-		return "", fmt.Errorf("tokenise: %w", err)
-	}
-
-	buff := new(bytes.Buffer)
-	if err = formatter.Format(buff, style, iterator); err != nil {
-		return "", fmt.Errorf("format: %w", err)
+		return "", fmt.Errorf("render plugin: %w", err)
 	}
 
-	return buff.String(), nil
+	return render.Highlight(formatter, style, file.Language, file.Content, s.cfg.MaxHighlightSize)
 }
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/gist"
+	"github.com/topi314/gobin/v3/internal/httperr"
+)
+
+var (
+	ErrGistImportDisabled = errors.New("gist import disabled")
+	ErrGistEmpty          = errors.New("gist has no files")
+)
+
+// PostDocumentGist creates a document with the files of a GitHub gist. It takes the same query parameters as
+// PostDocument.
+func (s *Server) PostDocumentGist(w http.ResponseWriter, r *http.Request) {
+	if s.gistClient == nil {
+		s.error(w, r, httperr.NotFound(ErrGistImportDisabled))
+		return
+	}
+	s.createDocument(w, r, r.URL.Query().Get("key"), "", s.parseGistFiles)
+}
+
+// parseGistFiles fetches the gist of the request and returns its files sorted by name. GitHub only returns the first
+// megabyte of large files, their full content is downloaded separately.
+func (s *Server) parseGistFiles(r *http.Request) ([]api.RequestFile, error) {
+	var rq api.GistImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&rq); err != nil {
+		return nil, httperr.BadRequest(err)
+	}
+	gistID, err := gist.ParseID(rq.Gist)
+	if err != nil {
+		return nil, httperr.BadRequest(err)
+	}
+
+	ctx, span := s.tracer.Start(r.Context(), "parseGistFiles", trace.WithAttributes(
+		attribute.String("gist_id", gistID),
+	))
+	defer span.End()
+
+	expiresAt, err := getExpiresAt(r.URL.Query(), r.Header)
+	if err != nil {
+		return nil, err
+	}
+	settings := s.getUserSettings(r)
+
+	g, err := s.gistClient.Get(ctx, gistID)
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to get gist")
+		span.RecordError(err)
+		return nil, gistError(err)
+	}
+	if len(g.Files) == 0 {
+		return nil, httperr.BadRequest(ErrGistEmpty)
+	}
+	if s.cfg.MaxFiles > 0 && len(g.Files) > s.cfg.MaxFiles {
+		return nil, ErrTooManyFiles(s.cfg.MaxFiles)
+	}
+
+	names := make([]string, 0, len(g.Files))
+	for name := range g.Files {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a string, b string) int {
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	})
+
+	remaining := s.maxDocumentSize()
+	files := make([]api.RequestFile, 0, len(names))
+	for _, name := range names {
+		gistFile := g.Files[name]
+		content := gistFile.Content
+		if gistFile.Truncated {
+			if content, err = s.gistClient.GetContent(ctx, gistFile, s.maxFileSize()); err != nil {
+				if errors.Is(err, gist.ErrContentTooLarge) {
+					if s.maxFileSize() == s.cfg.MaxFileSize {
+						return nil, newLimitError(api.LimitMaxFileSize, s.cfg.MaxFileSize, name)
+					}
+					return nil, newLimitError(api.LimitMaxDocumentSize, s.cfg.MaxDocumentSize, name)
+				}
+				return nil, gistError(err)
+			}
+		}
+
+		data, err := s.readDocumentFile(strings.NewReader(content), name, &remaining)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) == 0 {
+			return nil, httperr.BadRequest(ErrInvalidDocumentFileContent)
+		}
+
+		file, err := newRequestFile(name, data, gistFile.Language, "", false)
+		if err != nil {
+			return nil, err
+		}
+		file.ExpiresAt = expiresAt
+		applyUserSettings(settings, file, gistFile.Language)
+		files = append(files, *file)
+	}
+
+	slog.DebugContext(ctx, "fetched gist", slog.String("gist_id", gistID), slog.Int("files", len(files)))
+	return files, nil
+}
+
+// gistError maps the errors of the GitHub API to the response of the import.
+func gistError(err error) error {
+	if errors.Is(err, gist.ErrNotFound) {
+		return httperr.NotFound(err)
+	}
+	var statusErr *gist.StatusError
+	if errors.As(err, &statusErr) {
+		return httperr.BadGateway(statusErr)
+	}
+	return httperr.BadGateway(fmt.Errorf("failed to fetch gist: %w", err))
+}
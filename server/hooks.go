@@ -0,0 +1,293 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/internal/render"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+const (
+	HookFailurePolicyIgnore HookFailurePolicy = "ignore"
+	HookFailurePolicyReject HookFailurePolicy = "reject"
+
+	// HookSandboxCommand is the argument gobin re-executes itself with to set the resource limits of a sandboxed hook
+	// before it executes the hook command, there is no way to set them for a new process directly. See RunHookSandbox.
+	HookSandboxCommand = "hook-sandbox"
+)
+
+var (
+	ErrDocumentRejected = func(hook string, reason string) error {
+		if reason == "" {
+			return fmt.Errorf("document rejected by hook %s", hook)
+		}
+		return fmt.Errorf("document rejected by hook %s: %s", hook, reason)
+	}
+	ErrHookFailed = func(hook string) error {
+		return fmt.Errorf("hook %s failed", hook)
+	}
+)
+
+type HookFailurePolicy string
+
+type (
+	HookRequest struct {
+		Hook     string       `json:"hook"`
+		Event    string       `json:"event"`
+		Document HookDocument `json:"document"`
+	}
+
+	HookDocument struct {
+		// Key is empty for documents which are about to be created.
+		Key   string     `json:"key"`
+		Files []HookFile `json:"files"`
+	}
+
+	HookFile struct {
+		Name     string `json:"name"`
+		Content  string `json:"content,omitempty"`
+		Language string `json:"language"`
+	}
+
+	HookResponse struct {
+		Reject      bool              `json:"reject"`
+		Reason      string            `json:"reason"`
+		Files       []HookFile        `json:"files"`
+		Annotations map[string]string `json:"annotations"`
+	}
+
+	// HookResult holds the annotations of a hook which are recorded as event once the document is saved.
+	HookResult struct {
+		Hook        string            `json:"hook"`
+		Annotations map[string]string `json:"annotations"`
+	}
+
+	// hookLimits are passed to RunHookSandbox as its first argument.
+	hookLimits struct {
+		CPUTime   uint64 `json:"cpu_time,omitempty"`
+		Memory    uint64 `json:"memory,omitempty"`
+		FileSize  uint64 `json:"file_size,omitempty"`
+		OpenFiles uint64 `json:"open_files,omitempty"`
+		Processes uint64 `json:"processes,omitempty"`
+	}
+)
+
+// runHooks executes all hooks configured for the event in order. Hooks may reject the document, change the language of
+// files or return annotations which are recorded as document events.
+func (s *Server) runHooks(ctx context.Context, event string, documentID string, files []database.File) ([]HookResult, error) {
+	var results []HookResult
+	for _, hook := range s.cfg.Hooks {
+		if !slices.Contains(hook.Events, event) {
+			continue
+		}
+
+		rs, err := s.runHook(ctx, hook, HookRequest{
+			Hook:  hook.Name,
+			Event: event,
+			Document: HookDocument{
+				Key:   documentID,
+				Files: newHookFiles(files),
+			},
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to run hook", slog.String("hook", hook.Name), slog.String("event", event), slog.Any("err", err))
+			if hook.FailurePolicy == HookFailurePolicyReject {
+				return nil, httperr.InternalServerError(ErrHookFailed(hook.Name))
+			}
+			continue
+		}
+
+		if rs.Reject {
+			return nil, httperr.UnprocessableEntity(ErrDocumentRejected(hook.Name, rs.Reason))
+		}
+
+		for _, rsFile := range rs.Files {
+			for i, file := range files {
+				if file.Name == rsFile.Name && rsFile.Language != "" {
+					files[i].Language = render.Language(rsFile.Language, "", "", "")
+				}
+			}
+		}
+
+		if len(rs.Annotations) > 0 {
+			results = append(results, HookResult{
+				Hook:        hook.Name,
+				Annotations: rs.Annotations,
+			})
+		}
+	}
+
+	return results, nil
+}
+
+func (s *Server) runHook(ctx context.Context, hook HookConfig, rq HookRequest) (*HookResponse, error) {
+	ctx, span := s.tracer.Start(ctx, "runHook", trace.WithAttributes(
+		attribute.String("hook", hook.Name),
+		attribute.String("event", rq.Event),
+	))
+	defer span.End()
+
+	timeout := time.Duration(hook.Timeout)
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	buff := new(bytes.Buffer)
+	if err := json.NewEncoder(buff).Encode(rq); err != nil {
+		return nil, fmt.Errorf("failed to encode hook request: %w", err)
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	if hook.URL != "" {
+		data, err = s.runHTTPHook(ctx, hook, buff)
+	} else {
+		data, err = runCommandHook(ctx, hook, buff)
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to run hook")
+		span.RecordError(err)
+		return nil, err
+	}
+
+	var rs HookResponse
+	if len(bytes.TrimSpace(data)) == 0 {
+		return &rs, nil
+	}
+	if err = json.Unmarshal(data, &rs); err != nil {
+		span.SetStatus(codes.Error, "failed to decode hook response")
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to decode hook response: %w", err)
+	}
+	return &rs, nil
+}
+
+func (s *Server) runHTTPHook(ctx context.Context, hook HookConfig, body io.Reader) ([]byte, error) {
+	rq, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create hook request: %w", err)
+	}
+	rq.Header.Set(ezhttp.HeaderContentType, ezhttp.ContentTypeJSON)
+	rq.Header.Set(ezhttp.HeaderUserAgent, fmt.Sprintf("gobin/%s", s.version.Version))
+	if hook.Secret != "" {
+		rq.Header.Set(ezhttp.HeaderAuthorization, fmt.Sprintf("Secret %s", hook.Secret))
+	}
+
+	rs, err := s.hookClient.Do(rq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute hook request: %w", err)
+	}
+	defer func() {
+		_ = rs.Body.Close()
+	}()
+
+	if rs.StatusCode < 200 || rs.StatusCode >= 300 {
+		return nil, fmt.Errorf("hook returned status %d", rs.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(rs.Body, maxHookResponseSize))
+}
+
+const maxHookResponseSize = 1024 * 1024
+
+// runCommandHook runs the hook command with only the configured environment in its own process group, passing the
+// request on stdin and reading the response from stdout. Without a work dir it runs in a new empty directory which is
+// removed afterward. Without a sandbox hooks are trusted code, they run as the user of gobin without resource limits.
+func runCommandHook(ctx context.Context, hook HookConfig, stdin io.Reader) ([]byte, error) {
+	if len(hook.Command) == 0 {
+		return nil, errors.New("hook has neither a command nor an url")
+	}
+
+	workDir := hook.WorkDir
+	if workDir == "" {
+		dir, err := os.MkdirTemp("", "gobin-hook-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create hook work dir: %w", err)
+		}
+		defer func() {
+			_ = os.RemoveAll(dir)
+		}()
+		workDir = dir
+	}
+
+	cmd := exec.CommandContext(ctx, hook.Command[0], hook.Command[1:]...)
+	// a nil env would inherit the environment of gobin
+	cmd.Env = append([]string{}, hook.Env...)
+	cmd.Dir = workDir
+	setHookProcessGroup(cmd)
+	if hook.Sandbox.Enabled() {
+		if err := sandboxHookCommand(cmd, hook.Sandbox, hook.WorkDir == ""); err != nil {
+			return nil, fmt.Errorf("failed to sandbox hook command: %w", err)
+		}
+	}
+	// processes the hook left running in the background are killed too
+	defer func() {
+		_ = killHookProcessGroup(cmd)
+	}()
+	cmd.Stdin = stdin
+	stdout := &limitedBuffer{max: maxHookResponseSize}
+	stderr := &limitedBuffer{max: 4096}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("hook command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if stdout.exceeded {
+		return nil, errors.New("hook response too large")
+	}
+	return stdout.Bytes(), nil
+}
+
+func newHookLimits(cfg HookSandboxConfig) hookLimits {
+	cpuTime := time.Duration(cfg.CPUTime)
+	return hookLimits{
+		// rounded up, a limit below a second would otherwise be 0 and not limit anything
+		CPUTime:   uint64((cpuTime + time.Second - 1) / time.Second),
+		Memory:    cfg.Memory,
+		FileSize:  cfg.FileSize,
+		OpenFiles: cfg.OpenFiles,
+		Processes: cfg.Processes,
+	}
+}
+
+func (s *Server) recordHookResults(ctx context.Context, documentID string, version int64, results []HookResult) {
+	for _, result := range results {
+		s.RecordEvent(ctx, EventHook, documentID, version, result)
+	}
+}
+
+func newHookFiles(files []database.File) []HookFile {
+	hookFiles := make([]HookFile, len(files))
+	for i, file := range files {
+		hookFiles[i] = HookFile{
+			Name:     file.Name,
+			Content:  file.Content,
+			Language: file.Language,
+		}
+	}
+	return hookFiles
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package server
+
+import (
+	"os/exec"
+)
+
+// setHookProcessGroup does nothing on systems without process groups, only the hook command is killed when it times out.
+func setHookProcessGroup(_ *exec.Cmd) {}
+
+func killHookProcessGroup(_ *exec.Cmd) error {
+	return nil
+}
@@ -0,0 +1,117 @@
+//go:build linux
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// sandboxHookCommand runs the command through RunHookSandbox as the user and group of the sandbox. The work dir gobin
+// created for the command is handed over to the user.
+func sandboxHookCommand(cmd *exec.Cmd, cfg HookSandboxConfig, ownWorkDir bool) error {
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find gobin executable: %w", err)
+	}
+	limits, err := json.Marshal(newHookLimits(cfg))
+	if err != nil {
+		return fmt.Errorf("failed to encode hook limits: %w", err)
+	}
+
+	if cfg.User != "" || cfg.Group != "" {
+		credential, err := lookupHookCredential(cfg)
+		if err != nil {
+			return err
+		}
+		cmd.SysProcAttr.Credential = credential
+		if ownWorkDir {
+			if err = os.Chown(cmd.Dir, int(credential.Uid), int(credential.Gid)); err != nil {
+				return fmt.Errorf("failed to change owner of hook work dir: %w", err)
+			}
+		}
+	}
+
+	cmd.Args = append([]string{executable, HookSandboxCommand, string(limits), cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = executable
+	return nil
+}
+
+// lookupHookCredential returns the user and group ids of the sandbox, the command gets no supplementary groups.
+func lookupHookCredential(cfg HookSandboxConfig) (*syscall.Credential, error) {
+	credential := &syscall.Credential{
+		Uid:    uint32(os.Getuid()),
+		Gid:    uint32(os.Getgid()),
+		Groups: []uint32{},
+	}
+	if cfg.User != "" {
+		u, err := user.Lookup(cfg.User)
+		if err != nil {
+			if u, err = user.LookupId(cfg.User); err != nil {
+				return nil, fmt.Errorf("failed to find hook user %s: %w", cfg.User, err)
+			}
+		}
+		uid, _ := strconv.ParseUint(u.Uid, 10, 32)
+		gid, _ := strconv.ParseUint(u.Gid, 10, 32)
+		credential.Uid, credential.Gid = uint32(uid), uint32(gid)
+	}
+	if cfg.Group != "" {
+		g, err := user.LookupGroup(cfg.Group)
+		if err != nil {
+			if g, err = user.LookupGroupId(cfg.Group); err != nil {
+				return nil, fmt.Errorf("failed to find hook group %s: %w", cfg.Group, err)
+			}
+		}
+		gid, _ := strconv.ParseUint(g.Gid, 10, 32)
+		credential.Gid = uint32(gid)
+	}
+	return credential, nil
+}
+
+// RunHookSandbox is run by gobin hook-sandbox {limits} {command} {args...}. It sets the resource limits for itself,
+// which the command inherits, and replaces itself with the command. It only returns if that fails.
+func RunHookSandbox(args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: gobin hook-sandbox {limits} {command} {args...}")
+	}
+	var limits hookLimits
+	if err := json.Unmarshal([]byte(args[0]), &limits); err != nil {
+		return fmt.Errorf("failed to decode hook limits: %w", err)
+	}
+
+	for _, limit := range []struct {
+		name     string
+		resource int
+		value    uint64
+	}{
+		{name: "cpu time", resource: unix.RLIMIT_CPU, value: limits.CPUTime},
+		{name: "memory", resource: unix.RLIMIT_AS, value: limits.Memory},
+		{name: "file size", resource: unix.RLIMIT_FSIZE, value: limits.FileSize},
+		{name: "open files", resource: unix.RLIMIT_NOFILE, value: limits.OpenFiles},
+		{name: "processes", resource: unix.RLIMIT_NPROC, value: limits.Processes},
+	} {
+		if limit.value == 0 {
+			continue
+		}
+		// the hard limit keeps the command from raising it again
+		if err := unix.Setrlimit(limit.resource, &unix.Rlimit{Cur: limit.value, Max: limit.value}); err != nil {
+			return fmt.Errorf("failed to limit %s: %w", limit.name, err)
+		}
+	}
+
+	if err := unix.Exec(args[1], args[1:], os.Environ()); err != nil {
+		return fmt.Errorf("failed to execute hook command: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package server
+
+import (
+	"errors"
+	"os/exec"
+)
+
+var errHookSandboxUnsupported = errors.New("hook sandboxes are only supported on linux")
+
+func sandboxHookCommand(_ *exec.Cmd, _ HookSandboxConfig, _ bool) error {
+	return errHookSandboxUnsupported
+}
+
+// RunHookSandbox always fails on systems without hook sandboxes.
+func RunHookSandbox(_ []string) error {
+	return errHookSandboxUnsupported
+}
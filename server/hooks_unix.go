@@ -0,0 +1,29 @@
+//go:build unix
+
+package server
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+// setHookProcessGroup starts the hook command in its own process group, so the processes it starts are killed with it
+// when the hook times out.
+func setHookProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return killHookProcessGroup(cmd)
+	}
+}
+
+// killHookProcessGroup kills the hook command and all processes it started which are still running.
+func killHookProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return err
+	}
+	return nil
+}
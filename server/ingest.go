@@ -0,0 +1,348 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/internal/render"
+	"github.com/topi314/gobin/v3/server/database"
+	"github.com/topi314/gobin/v3/server/storage"
+)
+
+var (
+	ErrIngestDisabled         = errors.New("ingestion disabled")
+	ErrInvalidIngestSecret    = errors.New("invalid ingest secret")
+	ErrMissingIngestObjectKey = errors.New("missing key query parameter")
+	ErrIngestedObjectNotFound = errors.New("ingested object not found")
+)
+
+type (
+	// IngestNotification is an S3 bucket notification, MinIO sends the same format to its webhook targets.
+	IngestNotification struct {
+		Records []IngestNotificationRecord `json:"Records"`
+	}
+
+	IngestNotificationRecord struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				// Key is URL encoded.
+				Key  string `json:"key"`
+				Size int64  `json:"size"`
+				ETag string `json:"eTag"`
+			} `json:"object"`
+		} `json:"s3"`
+	}
+
+	IngestResponse struct {
+		Documents []IngestedDocument `json:"documents"`
+	}
+
+	IngestedDocument struct {
+		ObjectKey   string `json:"object_key"`
+		DocumentKey string `json:"document_key"`
+	}
+
+	IngestedObjectResponse struct {
+		ObjectKey string `json:"object_key"`
+		ETag      string `json:"etag"`
+		// DocumentKey is empty if the object was skipped.
+		DocumentKey string    `json:"document_key"`
+		CreatedAt   time.Time `json:"created_at"`
+	}
+
+	EventIngestData struct {
+		Bucket    string `json:"bucket"`
+		ObjectKey string `json:"object_key"`
+	}
+)
+
+// checkIngestSecret accepts the secret as bearer token or as the whole authorization header, MinIO sends its auth token
+// as is.
+func (s *Server) checkIngestSecret(r *http.Request) error {
+	if !s.cfg.Ingest.Enabled || s.cfg.Ingest.Secret == "" {
+		return httperr.NotFound(ErrIngestDisabled)
+	}
+	secret := strings.TrimPrefix(r.Header.Get(ezhttp.HeaderAuthorization), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(s.cfg.Ingest.Secret)) != 1 {
+		return httperr.Unauthorized(ErrInvalidIngestSecret)
+	}
+	return nil
+}
+
+// PostIngestS3 ingests the objects created in the bucket notification. Errors are returned to the sender, so it can
+// deliver the notification again.
+func (s *Server) PostIngestS3(w http.ResponseWriter, r *http.Request) {
+	if err := s.checkIngestSecret(r); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	var notification IngestNotification
+	if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+
+	documents := make([]IngestedDocument, 0)
+	for _, record := range notification.Records {
+		if !strings.Contains(record.EventName, "ObjectCreated") || record.S3.Bucket.Name != s.cfg.Ingest.S3.Bucket {
+			continue
+		}
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			s.error(w, r, httperr.BadRequest(fmt.Errorf("failed to decode object key: %w", err)))
+			return
+		}
+		if !strings.HasPrefix(key, s.cfg.Ingest.S3.Prefix) {
+			continue
+		}
+
+		documentID, err := s.ingestObject(r.Context(), storage.Object{
+			Key:  key,
+			ETag: strings.Trim(record.S3.Object.ETag, `"`),
+			Size: record.S3.Object.Size,
+		})
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+		if documentID != "" {
+			documents = append(documents, IngestedDocument{
+				ObjectKey:   key,
+				DocumentKey: documentID,
+			})
+		}
+	}
+
+	s.ok(w, r, IngestResponse{Documents: documents})
+}
+
+// GetIngestedObject returns the document which was created from an object.
+func (s *Server) GetIngestedObject(w http.ResponseWriter, r *http.Request) {
+	if err := s.checkIngestSecret(r); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	objectKey := r.URL.Query().Get("key")
+	if objectKey == "" {
+		s.error(w, r, httperr.BadRequest(ErrMissingIngestObjectKey))
+		return
+	}
+
+	object, err := s.db.GetIngestedObject(r.Context(), objectKey)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrIngestedObjectNotFound))
+			return
+		}
+		s.error(w, r, fmt.Errorf("failed to get ingested object: %w", err))
+		return
+	}
+
+	s.ok(w, r, IngestedObjectResponse{
+		ObjectKey:   object.ObjectKey,
+		ETag:        object.ETag,
+		DocumentKey: object.DocumentID,
+		CreatedAt:   object.CreatedAt,
+	})
+}
+
+func (s *Server) ingest(ctx context.Context, interval time.Duration) {
+	slog.Debug("Starting ingestion...", slog.String("bucket", s.cfg.Ingest.S3.Bucket), slog.String("prefix", s.cfg.Ingest.S3.Prefix))
+	ticker := time.NewTicker(interval)
+	defer func() {
+		ticker.Stop()
+		slog.Debug("ingestion stopped")
+	}()
+
+	s.doIngest(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.doIngest(ctx)
+		}
+	}
+}
+
+func (s *Server) doIngest(ctx context.Context) {
+	ctx, span := s.tracer.Start(ctx, "doIngest", trace.WithAttributes(
+		attribute.String("bucket", s.cfg.Ingest.S3.Bucket),
+	))
+	defer span.End()
+
+	objects, err := s.ingestSource.ListObjects(ctx)
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to list objects")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "failed to list objects to ingest", slog.Any("err", err))
+		return
+	}
+
+	for _, object := range objects {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, err = s.ingestObject(ctx, object); err != nil {
+			span.SetStatus(codes.Error, "failed to ingest object")
+			span.RecordError(err)
+			slog.ErrorContext(ctx, "failed to ingest object", slog.String("object_key", object.Key), slog.Any("err", err))
+		}
+	}
+}
+
+// ingestObject creates a document from the object and returns its key. Objects which were already ingested with the
+// same ETag, folders, empty objects and objects which are too large or not text are skipped and return an empty key.
+func (s *Server) ingestObject(ctx context.Context, object storage.Object) (string, error) {
+	ctx, span := s.tracer.Start(ctx, "ingestObject", trace.WithAttributes(
+		attribute.String("object_key", object.Key),
+	))
+	defer span.End()
+
+	if strings.HasSuffix(object.Key, "/") {
+		return "", nil
+	}
+
+	ingested, err := s.db.GetIngestedObject(ctx, object.Key)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("failed to get ingested object: %w", err)
+	}
+	if ingested != nil && object.ETag != "" && ingested.ETag == object.ETag {
+		return "", nil
+	}
+
+	maxSize := s.cfg.Ingest.MaxSize
+	if maxSize <= 0 {
+		maxSize = s.maxFileSize()
+	}
+	if maxSize > 0 && object.Size > maxSize {
+		return "", s.skipIngestObject(ctx, object, "object too large")
+	}
+
+	content, err := s.ingestSource.GetObject(ctx, object.Key, maxSize)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			// the object was deleted in the meantime
+			return "", nil
+		}
+		if errors.Is(err, storage.ErrObjectTooLarge) {
+			return "", s.skipIngestObject(ctx, object, "object too large")
+		}
+		return "", fmt.Errorf("failed to get object: %w", err)
+	}
+	if len(content.Content) == 0 {
+		return "", s.skipIngestObject(ctx, content.Object, "object empty")
+	}
+	if !utf8.Valid(content.Content) || bytes.IndexByte(content.Content, 0) != -1 {
+		return "", s.skipIngestObject(ctx, content.Object, "object is not text")
+	}
+
+	if err = s.db.ClaimIngestedObject(ctx, content.Key, content.ETag); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	documentID, err := s.createIngestedDocument(ctx, content)
+	if err != nil {
+		var httpErr *httperr.Error
+		if errors.As(err, &httpErr) && httpErr.Status == http.StatusUnprocessableEntity {
+			// rejected by a hook, it would be rejected again
+			slog.WarnContext(ctx, "ingested object rejected", slog.String("object_key", content.Key), slog.Any("err", err))
+			return "", nil
+		}
+		if deleteErr := s.db.DeleteIngestedObject(ctx, content.Key); deleteErr != nil {
+			slog.ErrorContext(ctx, "failed to release ingested object", slog.String("object_key", content.Key), slog.Any("err", deleteErr))
+		}
+		return "", err
+	}
+
+	if err = s.db.SetIngestedObjectDocument(ctx, content.Key, documentID); err != nil {
+		return "", err
+	}
+	slog.InfoContext(ctx, "Ingested object", slog.String("object_key", content.Key), slog.String("document_id", documentID))
+	return documentID, nil
+}
+
+// skipIngestObject records the object as ingested without a document, so it isn't read again until it changes.
+func (s *Server) skipIngestObject(ctx context.Context, object storage.Object, reason string) error {
+	if err := s.db.ClaimIngestedObject(ctx, object.Key, object.ETag); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	slog.WarnContext(ctx, "skipped object to ingest", slog.String("object_key", object.Key), slog.String("reason", reason))
+	return nil
+}
+
+func (s *Server) createIngestedDocument(ctx context.Context, content *storage.ObjectContent) (string, error) {
+	name := path.Base(content.Key)
+	file := database.File{
+		Name:     name,
+		Content:  string(content.Content),
+		Language: render.Language("", content.ContentType, name, string(content.Content)),
+	}
+	if s.cfg.Ingest.Expiry > 0 {
+		expiresAt := time.Now().Add(time.Duration(s.cfg.Ingest.Expiry))
+		file.ExpiresAt = &expiresAt
+	}
+	dbFiles := []database.File{file}
+
+	hookResults, err := s.runHooks(ctx, EventCreate, "", dbFiles)
+	if err != nil {
+		return "", err
+	}
+
+	documentID, version, err := s.db.CreateDocument(ctx, "", dbFiles)
+	if err != nil {
+		return "", fmt.Errorf("failed to create document: %w", err)
+	}
+	s.recordHookResults(ctx, *documentID, *version, hookResults)
+
+	s.RecordEvent(ctx, EventCreate, *documentID, *version, newEventData(dbFiles))
+	s.RecordEvent(ctx, EventIngest, *documentID, *version, EventIngestData{
+		Bucket:    s.cfg.Ingest.S3.Bucket,
+		ObjectKey: content.Key,
+	})
+
+	// documents have no webhooks yet, only the global webhooks receive this event
+	s.ExecuteWebhooks(ctx, WebhookEventCreate, api.WebhookDocument{
+		Key:     *documentID,
+		Version: *version,
+		Files: []api.WebhookDocumentFile{{
+			Name:      file.Name,
+			Content:   file.Content,
+			Language:  file.Language,
+			ExpiresAt: file.ExpiresAt,
+		}},
+	})
+
+	return *documentID, nil
+}
@@ -0,0 +1,352 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-jose/go-jose/v3/jwt"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/flags"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+	"github.com/topi314/gobin/v3/server/templates"
+)
+
+var (
+	ErrInviteNotFound     = errors.New("invite not found, expired or used up")
+	ErrInvalidMaxUses     = errors.New("invalid max_uses, must be at least 0")
+	ErrMemberNotFound     = errors.New("member not found")
+	ErrNotDocumentMember  = errors.New("removed from the access list of the document")
+	ErrInviteCreatorToken = errors.New("invites have to be accepted in a browser or with a user token")
+)
+
+func (s *Server) newInviteResponse(r *http.Request, invite database.DocumentInvite) api.InviteResponse {
+	return api.InviteResponse{
+		ID:          invite.ID,
+		DocumentKey: invite.DocumentID,
+		URL:         "https://" + r.Host + "/invite/" + invite.ID,
+		Permissions: formatPermissions(Permissions(invite.Permissions)),
+		MaxUses:     invite.MaxUses,
+		Uses:        invite.Uses,
+		ExpiresAt:   invite.ExpiresAt,
+		CreatedAt:   invite.CreatedAt,
+	}
+}
+
+// checkSharePermission returns the claims of the request if they can share the document.
+func checkSharePermission(r *http.Request, documentID string) (Claims, error) {
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionShare) {
+		return claims, httperr.Forbidden(ErrPermissionDenied("share"))
+	}
+	return claims, nil
+}
+
+// PostDocumentInvite creates an invite link which adds the users who accept it to the access list of the document. The
+// invite can only grant permissions the token of the request has.
+func (s *Server) PostDocumentInvite(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	var inviteRequest api.InviteCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&inviteRequest); err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+
+	if len(inviteRequest.Permissions) == 0 {
+		s.error(w, r, httperr.BadRequest(ErrNoPermissions))
+		return
+	}
+	for _, permission := range inviteRequest.Permissions {
+		if !slices.Contains(api.AllStringPermissions, permission) {
+			s.error(w, r, httperr.BadRequest(ErrUnknownPermission(permission)))
+			return
+		}
+	}
+	if inviteRequest.MaxUses < 0 {
+		s.error(w, r, httperr.BadRequest(ErrInvalidMaxUses))
+		return
+	}
+	if inviteRequest.ExpiresAt != nil && inviteRequest.ExpiresAt.Before(time.Now()) {
+		s.error(w, r, httperr.BadRequest(ErrInvalidExpiresAt))
+		return
+	}
+
+	claims, err := checkSharePermission(r, documentID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	perms, err := parsePermissions(claims.Permissions, inviteRequest.Permissions)
+	if err != nil {
+		s.error(w, r, httperr.Forbidden(err))
+		return
+	}
+
+	invite := database.DocumentInvite{
+		ID:          rand.Text(),
+		DocumentID:  documentID,
+		Permissions: int64(perms),
+		MaxUses:     inviteRequest.MaxUses,
+		ExpiresAt:   inviteRequest.ExpiresAt,
+		CreatedAt:   time.Now(),
+	}
+	if err = s.db.CreateDocumentInvite(r.Context(), invite); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	s.json(w, r, s.newInviteResponse(r, invite), http.StatusCreated)
+}
+
+// GetDocumentInvites lists the invites of the document including expired and used up ones which were not cleaned up yet.
+func (s *Server) GetDocumentInvites(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+	if _, err := checkSharePermission(r, documentID); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	invites, err := s.db.GetDocumentInvites(r.Context(), documentID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	response := api.InvitesResponse{
+		Invites: make([]api.InviteResponse, len(invites)),
+	}
+	for i, invite := range invites {
+		response.Invites[i] = s.newInviteResponse(r, invite)
+	}
+	s.ok(w, r, response)
+}
+
+// DeleteDocumentInvite deletes the invite, members who already joined stay on the access list.
+func (s *Server) DeleteDocumentInvite(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+	inviteID := chi.URLParam(r, "inviteID")
+	if _, err := checkSharePermission(r, documentID); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	if err := s.db.DeleteDocumentInvite(r.Context(), documentID, inviteID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrInviteNotFound))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+	s.ok(w, r, nil)
+}
+
+// GetDocumentMembers lists the access list of the document.
+func (s *Server) GetDocumentMembers(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+	if _, err := checkSharePermission(r, documentID); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	members, err := s.db.GetDocumentMembers(r.Context(), documentID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	response := api.MembersResponse{
+		Members: make([]api.MemberResponse, len(members)),
+	}
+	for i, member := range members {
+		response.Members[i] = api.MemberResponse{
+			ID:          member.CreatorID,
+			Permissions: formatPermissions(Permissions(member.Permissions)),
+			InviteID:    member.InviteID,
+			JoinedAt:    member.JoinedAt,
+		}
+	}
+	s.ok(w, r, response)
+}
+
+// DeleteDocumentMember removes the member from the access list, the tokens it got from invites stop working at once.
+func (s *Server) DeleteDocumentMember(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+	memberID := chi.URLParam(r, "memberID")
+	if _, err := checkSharePermission(r, documentID); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	if err := s.db.DeleteDocumentMember(r.Context(), documentID, memberID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrMemberNotFound))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+	s.ok(w, r, nil)
+}
+
+// getInvite returns the invite, invites which are expired or used up are only returned if usable is false.
+func (s *Server) getInvite(ctx context.Context, inviteID string, usable bool) (*database.DocumentInvite, error) {
+	invite, err := s.db.GetDocumentInvite(ctx, inviteID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, httperr.NotFound(ErrInviteNotFound)
+		}
+		return nil, fmt.Errorf("failed to get invite: %w", err)
+	}
+	if usable && ((invite.MaxUses > 0 && invite.Uses >= invite.MaxUses) || (invite.ExpiresAt != nil && invite.ExpiresAt.Before(time.Now()))) {
+		return nil, httperr.NotFound(ErrInviteNotFound)
+	}
+	return invite, nil
+}
+
+// GetInvite returns the document and permissions of an invite, so users can decide whether to accept it.
+func (s *Server) GetInvite(w http.ResponseWriter, r *http.Request) {
+	invite, err := s.getInvite(r.Context(), chi.URLParam(r, "inviteID"), true)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	s.ok(w, r, s.newInviteResponse(r, *invite))
+}
+
+// PostInviteAccept adds the browser or the user of the user token to the access list of the document and returns a
+// token for it. Members who accept another invite of the same document keep the permissions of both. Browsers without a
+// creator cookie get a new anonymous id.
+func (s *Server) PostInviteAccept(w http.ResponseWriter, r *http.Request) {
+	// whether the invite can still be used is checked when it is used, members can accept it again to get a new token
+	invite, err := s.getInvite(r.Context(), chi.URLParam(r, "inviteID"), false)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	claims := GetClaims(r)
+	if claims.Subject != "" && claims.Scope != ScopeCreator && claims.Scope != ScopeAccount {
+		s.error(w, r, httperr.BadRequest(ErrInviteCreatorToken))
+		return
+	}
+
+	creatorID := s.getCreatorID(r)
+	if creatorID == "" {
+		if creatorID, err = s.newCreatorID(w); err != nil {
+			s.error(w, r, err)
+			return
+		}
+	}
+
+	perms := Permissions(invite.Permissions)
+	member, err := s.db.GetDocumentMember(r.Context(), invite.DocumentID, creatorID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		s.error(w, r, fmt.Errorf("failed to get document member: %w", err))
+		return
+	}
+	if member != nil {
+		perms |= Permissions(member.Permissions)
+	}
+
+	// members who already have all permissions of the invite don't use it up
+	if member == nil || Permissions(member.Permissions) != perms {
+		if err = s.db.UseDocumentInvite(r.Context(), invite.ID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				s.error(w, r, httperr.NotFound(ErrInviteNotFound))
+				return
+			}
+			s.error(w, r, err)
+			return
+		}
+
+		joinedAt := time.Now()
+		if member != nil {
+			joinedAt = member.JoinedAt
+		}
+		if err = s.db.SetDocumentMember(r.Context(), database.DocumentMember{
+			DocumentID:  invite.DocumentID,
+			CreatorID:   creatorID,
+			Permissions: int64(perms),
+			InviteID:    invite.ID,
+			JoinedAt:    joinedAt,
+		}); err != nil {
+			s.error(w, r, err)
+			return
+		}
+
+		s.RecordEvent(r.Context(), EventShare, invite.DocumentID, 0, EventShareData{
+			Permissions: formatPermissions(Permissions(invite.Permissions)),
+		})
+	}
+
+	memberClaims := newClaims(invite.DocumentID, perms)
+	memberClaims.Member = creatorID
+	token, err := jwt.Signed(s.signer).Claims(memberClaims).CompactSerialize()
+	if err != nil {
+		s.error(w, r, fmt.Errorf("failed to create new token: %w", err))
+		return
+	}
+
+	s.ok(w, r, api.InviteAcceptResponse{
+		DocumentKey: invite.DocumentID,
+		Token:       token,
+		Permissions: formatPermissions(perms),
+	})
+}
+
+// resolveMemberClaims replaces the permissions of a token from an invite with the current permissions of the member.
+// Tokens of members who were removed from the access list are invalid.
+func (s *Server) resolveMemberClaims(ctx context.Context, claims *Claims) error {
+	if claims.Member == "" {
+		return nil
+	}
+	member, err := s.db.GetDocumentMember(ctx, claims.Subject, claims.Member)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotDocumentMember
+		}
+		return fmt.Errorf("failed to get document member: %w", err)
+	}
+	claims.Permissions = Permissions(member.Permissions)
+	return nil
+}
+
+// GetPrettyInvite renders the page to accept an invite.
+func (s *Server) GetPrettyInvite(w http.ResponseWriter, r *http.Request) {
+	vars := templates.InviteVars{
+		ID:     chi.URLParam(r, "inviteID"),
+		Assets: s.assetManifest,
+	}
+	invite, err := s.getInvite(r.Context(), vars.ID, true)
+	if err != nil {
+		if !errors.Is(err, ErrInviteNotFound) {
+			s.prettyError(w, r, err)
+			return
+		}
+		vars.Error = ErrInviteNotFound.Error()
+	} else {
+		vars.DocumentKey = invite.DocumentID
+		vars.Permissions = formatPermissions(Permissions(invite.Permissions))
+	}
+
+	setColorSchemeHints(w)
+	style := s.getStyle(r)
+	vars.Style = style.Name
+	vars.Theme = style.Theme
+	if err = templates.Invite(vars).Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "failed to execute template", slog.Any("err", err))
+	}
+}
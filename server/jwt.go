@@ -2,14 +2,22 @@ package server
 
 import (
 	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/go-jose/go-jose/v3/jwt"
 
+	"github.com/topi314/gobin/v3/api"
 	"github.com/topi314/gobin/v3/internal/flags"
+	"github.com/topi314/gobin/v3/server/database"
 )
 
+var ErrTokenExpired = errors.New("token expired, used up or revoked")
+
 type Permissions int
 
 const (
@@ -17,18 +25,23 @@ const (
 	PermissionDelete
 	PermissionShare
 	PermissionWebhook
+	PermissionReview
 )
 
 var AllPermissions = PermissionWrite |
 	PermissionDelete |
 	PermissionShare |
-	PermissionWebhook
-
-var AllStringPermissions = []string{"write", "delete", "share", "webhook"}
+	PermissionWebhook |
+	PermissionReview
 
 type Claims struct {
 	jwt.Claims
 	Permissions Permissions `json:"pms"`
+	Scope       string      `json:"scp,omitempty"`
+	Documents   []string    `json:"docs,omitempty"`
+	// Member is the creator id of tokens from invites, their permissions are looked up on the access list of the
+	// document.
+	Member string `json:"mbr,omitempty"`
 }
 
 type claimsKey struct{}
@@ -48,6 +61,71 @@ func (s *Server) NewToken(documentID string, permissions Permissions) (string, e
 	return jwt.Signed(s.signer).Claims(claims).CompactSerialize()
 }
 
+// NewShareToken returns a token which expires at expiresAt or can only be used maxUses times, a nil expiresAt or 0
+// max uses don't limit it. The jti of the token is stored to count its uses and returned to revoke it.
+func (s *Server) NewShareToken(ctx context.Context, documentID string, permissions Permissions, expiresAt *time.Time, maxUses int64) (string, string, error) {
+	claims := newClaims(documentID, permissions)
+	claims.ID = rand.Text()
+	if expiresAt != nil {
+		claims.Expiry = jwt.NewNumericDate(*expiresAt)
+	}
+
+	if err := s.db.CreateDocumentShareToken(ctx, database.DocumentShareToken{
+		ID:          claims.ID,
+		DocumentID:  documentID,
+		Permissions: int64(permissions),
+		MaxUses:     maxUses,
+		ExpiresAt:   expiresAt,
+		CreatedAt:   time.Now(),
+	}); err != nil {
+		return "", "", err
+	}
+	token, err := jwt.Signed(s.signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		return "", "", err
+	}
+	return token, claims.ID, nil
+}
+
+// useToken checks that the token is not revoked or expired and counts a use of share tokens with a jti. Share tokens
+// which are expired, used up, revoked or whose document was deleted return ErrTokenExpired.
+func (s *Server) useToken(ctx context.Context, tokenString string, claims Claims) error {
+	if claims.Expiry != nil && time.Now().After(claims.Expiry.Time()) {
+		return ErrTokenExpired
+	}
+	revoked, err := s.db.IsTokenRevoked(ctx, api.TokenID(tokenString, claims.ID))
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrTokenExpired
+	}
+	// the jti of account tokens is the id of their session, tokens of revoked sessions and from before sessions existed
+	// are rejected like revoked tokens
+	if claims.Scope == ScopeAccount {
+		if claims.ID == "" {
+			return ErrTokenExpired
+		}
+		if _, err = s.db.GetAccountSession(ctx, claims.ID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrTokenExpired
+			}
+			return fmt.Errorf("failed to get account session: %w", err)
+		}
+		return nil
+	}
+	if claims.ID == "" {
+		return nil
+	}
+	if err = s.db.UseDocumentShareToken(ctx, claims.ID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTokenExpired
+		}
+		return fmt.Errorf("failed to use share token: %w", err)
+	}
+	return nil
+}
+
 func newClaims(documentID string, permissions Permissions) Claims {
 	return Claims{
 		Claims: jwt.Claims{
@@ -62,6 +140,17 @@ func EmptyClaims(documentID string) Claims {
 	return newClaims(documentID, 0)
 }
 
+// formatPermissions returns the names of the permissions in the order of AllStringPermissions.
+func formatPermissions(perms Permissions) []string {
+	var stringPerms []string
+	for i, perm := range api.AllStringPermissions {
+		if flags.Has(perms, Permissions(1<<i)) {
+			stringPerms = append(stringPerms, perm)
+		}
+	}
+	return stringPerms
+}
+
 func parsePermissions(perms Permissions, stringPerms []string) (Permissions, error) {
 	var permissions Permissions
 	for _, perm := range stringPerms {
@@ -86,6 +175,11 @@ func parsePermissions(perms Permissions, stringPerms []string) (Permissions, err
 				return 0, ErrPermissionDenied(perm)
 			}
 			permissions = flags.Add(permissions, PermissionWebhook)
+		case "review":
+			if flags.Misses(perms, PermissionReview) {
+				return 0, ErrPermissionDenied(perm)
+			}
+			permissions = flags.Add(permissions, PermissionReview)
 		}
 	}
 	return permissions, nil
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+)
+
+// The algorithms tokens can be signed with.
+const (
+	JWTAlgorithmHS512 = "HS512"
+	JWTAlgorithmRS256 = "RS256"
+	JWTAlgorithmEdDSA = "EdDSA"
+)
+
+var ErrUnknownJWTKey = errors.New("token is signed with an unknown or expired key")
+
+// jwtKey is a key tokens are verified with. key is the secret of HS512 keys and the public key of RS256 and EdDSA keys.
+type jwtKey struct {
+	id        string
+	algorithm jose.SignatureAlgorithm
+	key       any
+	expiresAt *time.Time
+}
+
+// JWTKeys signs tokens with the current key and verifies them with the current key and the verification keys, like the
+// previous keys during the grace period after a rotation.
+type JWTKeys struct {
+	signer jose.Signer
+	keys   []jwtKey
+}
+
+// NewJWTKeys loads the signing key and the verification keys of the config. HS512 tokens are signed with the
+// jwt_secret, RS256 and EdDSA tokens with the private key of jwt.key_file and the id of the key in the kid header.
+func NewJWTKeys(cfg Config) (*JWTKeys, error) {
+	current, signingKey, err := loadJWTKey(cfg.JWT.Algorithm, cfg.JWTSecret, cfg.JWT.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load jwt signing key: %w", err)
+	}
+	if signingKey == nil {
+		return nil, fmt.Errorf("jwt key file %s contains no private key", cfg.JWT.KeyFile)
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: current.algorithm,
+		Key:       signingKey,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create jwt signer: %w", err)
+	}
+
+	keys := []jwtKey{current}
+	for i, keyCfg := range cfg.JWT.VerificationKeys {
+		algorithm := keyCfg.Algorithm
+		if algorithm == "" {
+			algorithm = cfg.JWT.Algorithm
+		}
+		secret := keyCfg.Secret
+		if secret == "" {
+			secret = cfg.JWTSecret
+		}
+		key, _, err := loadJWTKey(algorithm, secret, keyCfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load jwt verification key %d: %w", i, err)
+		}
+		key.expiresAt = keyCfg.ExpiresAt
+		keys = append(keys, key)
+	}
+
+	return &JWTKeys{
+		signer: signer,
+		keys:   keys,
+	}, nil
+}
+
+// loadJWTKey returns the verification key and the signing key of the algorithm. Key files of verification keys can also
+// only contain the public key, their signing key is nil.
+func loadJWTKey(algorithm string, secret string, keyFile string) (jwtKey, any, error) {
+	switch algorithm {
+	case "", JWTAlgorithmHS512:
+		if secret == "" {
+			return jwtKey{}, nil, errors.New("jwt_secret is required for HS512")
+		}
+		return jwtKey{
+			algorithm: jose.HS512,
+			key:       []byte(secret),
+		}, []byte(secret), nil
+	case JWTAlgorithmRS256, JWTAlgorithmEdDSA:
+		if keyFile == "" {
+			return jwtKey{}, nil, fmt.Errorf("key_file is required for %s", algorithm)
+		}
+		publicKey, privateKey, err := readJWTKeyFile(keyFile)
+		if err != nil {
+			return jwtKey{}, nil, err
+		}
+		switch publicKey.(type) {
+		case *rsa.PublicKey:
+			if algorithm != JWTAlgorithmRS256 {
+				return jwtKey{}, nil, fmt.Errorf("%s needs an Ed25519 key, got an RSA key", algorithm)
+			}
+		case ed25519.PublicKey:
+			if algorithm != JWTAlgorithmEdDSA {
+				return jwtKey{}, nil, fmt.Errorf("%s needs an RSA key, got an Ed25519 key", algorithm)
+			}
+		default:
+			return jwtKey{}, nil, fmt.Errorf("unsupported key type %T", publicKey)
+		}
+
+		thumbprint, err := (&jose.JSONWebKey{Key: publicKey}).Thumbprint(crypto.SHA256)
+		if err != nil {
+			return jwtKey{}, nil, fmt.Errorf("failed to get key id: %w", err)
+		}
+		key := jwtKey{
+			id:        base64.RawURLEncoding.EncodeToString(thumbprint),
+			algorithm: jose.SignatureAlgorithm(algorithm),
+			key:       publicKey,
+		}
+		if privateKey == nil {
+			return key, nil, nil
+		}
+		return key, jose.JSONWebKey{
+			Key:       privateKey,
+			KeyID:     key.id,
+			Algorithm: algorithm,
+		}, nil
+	default:
+		return jwtKey{}, nil, fmt.Errorf("unknown algorithm %s, must be HS512, RS256 or EdDSA", algorithm)
+	}
+}
+
+// readJWTKeyFile reads a PEM encoded PKCS #8 or PKCS #1 private key or PKIX public key.
+func readJWTKeyFile(keyFile string) (crypto.PublicKey, crypto.Signer, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, fmt.Errorf("key file %s contains no PEM block", keyFile)
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer.Public(), signer, nil
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		return key.Public(), key, nil
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		return key, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported PEM block %s", block.Type)
+	}
+}
+
+// Signer returns the signer of new tokens.
+func (k *JWTKeys) Signer() jose.Signer {
+	return k.signer
+}
+
+// Verify checks the signature of the token with the key of its kid header or else with every key of its algorithm and
+// decodes the claims. Keys whose grace period ended are skipped.
+func (k *JWTKeys) Verify(tokenString string, claims any) error {
+	token, err := jwt.ParseSigned(tokenString)
+	if err != nil {
+		return err
+	}
+	if len(token.Headers) != 1 {
+		return ErrUnknownJWTKey
+	}
+	header := token.Headers[0]
+
+	now := time.Now()
+	for _, key := range k.keys {
+		if key.expiresAt != nil && now.After(*key.expiresAt) {
+			continue
+		}
+		if string(key.algorithm) != header.Algorithm || header.KeyID != "" && key.id != header.KeyID {
+			continue
+		}
+		if err = token.Claims(key.key, claims); err == nil {
+			return nil
+		}
+	}
+	return ErrUnknownJWTKey
+}
+
+// JWKS returns the public keys of RS256 and EdDSA keys as JSON Web Key Set, HS512 keys are secret and left out.
+func (k *JWTKeys) JWKS() jose.JSONWebKeySet {
+	now := time.Now()
+	keySet := jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{},
+	}
+	for _, key := range k.keys {
+		if key.algorithm == jose.HS512 || key.expiresAt != nil && now.After(*key.expiresAt) {
+			continue
+		}
+		keySet.Keys = append(keySet.Keys, jose.JSONWebKey{
+			Key:       key.key,
+			KeyID:     key.id,
+			Algorithm: string(key.algorithm),
+			Use:       "sig",
+		})
+	}
+	return keySet
+}
+
+// GetJWKS returns the public keys tokens are signed and verified with, so other services can verify them.
+func (s *Server) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	data, err := json.Marshal(s.jwtKeys.JWKS())
+	if err != nil {
+		s.error(w, r, fmt.Errorf("failed to encode jwks: %w", err))
+		return
+	}
+	w.Header().Set(ezhttp.HeaderContentType, "application/jwk-set+json")
+	w.Header().Set(ezhttp.HeaderCacheControl, "public, max-age=300")
+	_, _ = w.Write(data)
+}
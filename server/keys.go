@@ -0,0 +1,104 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/topi314/gobin/v3/internal/flags"
+	"github.com/topi314/gobin/v3/internal/httperr"
+)
+
+var (
+	ErrCustomKeysDisabled    = errors.New("custom document keys are disabled")
+	ErrCustomKeyUserRequired = errors.New("custom document keys need a user token or creator cookie")
+	ErrDocumentKeyTaken      = errors.New("document key is already taken")
+	ErrReservedDocumentKey   = func(key string) error {
+		return fmt.Errorf("document key %q is reserved for a route", key)
+	}
+	ErrInvalidCustomKeyLength = func(minLength int, maxLength int) error {
+		return fmt.Errorf("invalid document key, must be between %d and %d characters long", minLength, maxLength)
+	}
+	ErrInvalidCustomKey = errors.New("invalid document key, must only contain letters, numbers, - and _ and start with a letter or number")
+)
+
+var customKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+
+// defaultReservedKeys are kept free for routes gobin or a reverse proxy in front of it may use, even if they are no
+// route of gobin yet.
+var defaultReservedKeys = []string{
+	"about", "account", "admin", "api", "assets", "auth", "callback", "dashboard", "debug", "docs", "documents", "download",
+	"events", "favicon", "health", "healthz", "help", "home", "index", "ingest", "invite", "login", "logout", "metrics",
+	"new", "oauth", "ping", "raw", "readyz", "register", "robots", "settings", "signup", "static", "status", "user",
+	"users", "version", "webhooks", "well-known", "www",
+}
+
+// reservedDocumentKeys returns the first path segments of all routes, the default reserved keys and the reserved keys
+// of the config in lowercase, documents with these keys could not be opened or could shadow a route.
+func reservedDocumentKeys(r chi.Routes, reserved []string) map[string]struct{} {
+	keys := map[string]struct{}{}
+	_ = chi.Walk(r, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		segment, _, _ := strings.Cut(strings.TrimPrefix(route, "/"), "/")
+		if segment != "" && !strings.HasPrefix(segment, "{") {
+			keys[strings.ToLower(segment)] = struct{}{}
+		}
+		return nil
+	})
+	for _, key := range defaultReservedKeys {
+		keys[key] = struct{}{}
+	}
+	for _, key := range reserved {
+		keys[strings.ToLower(key)] = struct{}{}
+	}
+	return keys
+}
+
+// validateCustomKey checks whether the request may create a document with the key and whether the key is still free.
+func (s *Server) validateCustomKey(r *http.Request, key string) error {
+	if !s.cfg.CustomKeys.Enabled {
+		return httperr.Forbidden(ErrCustomKeysDisabled)
+	}
+	if s.cfg.CustomKeys.RequireUser && s.getCreatorID(r) == "" {
+		return httperr.Unauthorized(ErrCustomKeyUserRequired)
+	}
+
+	if len(key) < s.cfg.CustomKeys.MinLength || len(key) > s.cfg.CustomKeys.MaxLength {
+		return httperr.BadRequest(ErrInvalidCustomKeyLength(s.cfg.CustomKeys.MinLength, s.cfg.CustomKeys.MaxLength))
+	}
+	if !customKeyRegex.MatchString(key) {
+		return httperr.BadRequest(ErrInvalidCustomKey)
+	}
+	if _, ok := s.reservedKeys[strings.ToLower(key)]; ok {
+		return httperr.BadRequest(ErrReservedDocumentKey(key))
+	}
+
+	versions, err := s.db.GetVersionCount(r.Context(), key)
+	if err != nil {
+		return fmt.Errorf("failed to get document versions: %w", err)
+	}
+	if versions > 0 {
+		return httperr.Conflict(ErrDocumentKeyTaken)
+	}
+	return nil
+}
+
+// PutDocument creates a document with the key of the path. It fails if the key is taken, existing documents are updated
+// with PATCH.
+func (s *Server) PutDocument(w http.ResponseWriter, r *http.Request) {
+	s.createDocument(w, r, chi.URLParam(r, "documentID"), "", s.parseDocumentFiles)
+}
+
+// PutPrettyDocument saves the body of the request at the key of the path like ix.io, so curl -T notes.txt
+// https://xgob.in/notes is enough to paste a file. Requests with a write token of the document update it, all others
+// create it with the rules of custom keys.
+func (s *Server) PutPrettyDocument(w http.ResponseWriter, r *http.Request) {
+	if flags.Has(GetClaims(r).Permissions, PermissionWrite) {
+		s.PatchDocument(w, r)
+		return
+	}
+	s.PutDocument(w, r)
+}
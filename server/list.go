@@ -0,0 +1,137 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+const (
+	defaultDocumentListLimit = 20
+	maxDocumentListLimit     = 100
+)
+
+var (
+	ErrDocumentListTokenRequired = errors.New("a user, read or document token is required to list documents")
+	ErrInvalidDocumentListCursor = errors.New("invalid cursor")
+	ErrInvalidDocumentListLimit  = errors.New("invalid limit, must be between 1 and 100")
+)
+
+// GetDocuments lists the documents of the caller from the most recently updated to the oldest. A user token or the
+// creator cookie lists the documents created by the user and the documents it was invited to, a read token its
+// documents and a document token only its document. The tag query param only lists the documents with the tag.
+func (s *Server) GetDocuments(w http.ResponseWriter, r *http.Request) {
+	creatorID, documentIDs := s.getCallerDocuments(r)
+	if creatorID == "" && len(documentIDs) == 0 {
+		s.error(w, r, httperr.Unauthorized(ErrDocumentListTokenRequired))
+		return
+	}
+
+	query := r.URL.Query()
+	var tag string
+	if tagStr := query.Get("tag"); tagStr != "" {
+		var err error
+		if tag, err = normalizeDocumentTag(tagStr); err != nil {
+			s.error(w, r, httperr.BadRequest(err))
+			return
+		}
+	}
+
+	var (
+		beforeVersion int64
+		beforeID      string
+	)
+	if cursor := query.Get("cursor"); cursor != "" {
+		var err error
+		beforeVersion, beforeID, err = parseDocumentListCursor(cursor)
+		if err != nil {
+			s.error(w, r, httperr.BadRequest(err))
+			return
+		}
+	}
+
+	limit := defaultDocumentListLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxDocumentListLimit {
+			s.error(w, r, httperr.BadRequest(ErrInvalidDocumentListLimit))
+			return
+		}
+	}
+
+	// one more document is loaded to know if there is a next page
+	files, err := s.db.GetDocumentList(r.Context(), creatorID, documentIDs, tag, beforeVersion, beforeID, limit+1)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	response := api.DocumentListResponse{
+		Documents: make([]api.ListedDocument, 0, limit),
+	}
+	for _, file := range files {
+		if i := len(response.Documents) - 1; i >= 0 && response.Documents[i].Key == file.DocumentID {
+			response.Documents[i].Files = append(response.Documents[i].Files, newListedFile(file))
+			continue
+		}
+		if len(response.Documents) == limit {
+			last := response.Documents[limit-1]
+			response.Next = formatDocumentListCursor(last.Version, last.Key)
+			break
+		}
+		response.Documents = append(response.Documents, api.ListedDocument{
+			Key:       file.DocumentID,
+			Version:   file.DocumentVersion,
+			UpdatedAt: time.UnixMilli(file.DocumentVersion),
+			Files:     []api.ListedFile{newListedFile(file)},
+		})
+	}
+
+	s.ok(w, r, response)
+}
+
+// getCallerDocuments returns the creator id of the user token, creator cookie or account and the documents of a read or
+// document token, which together are the documents the caller may list and search.
+func (s *Server) getCallerDocuments(r *http.Request) (string, []string) {
+	claims := GetClaims(r)
+	switch {
+	case claims.Scope == ScopeRead:
+		return s.getCreatorID(r), claims.Documents
+	case claims.Scope == "" && claims.Subject != "":
+		return s.getCreatorID(r), []string{claims.Subject}
+	}
+	return s.getCreatorID(r), nil
+}
+
+func newListedFile(file database.File) api.ListedFile {
+	return api.ListedFile{
+		Name:      file.Name,
+		Language:  file.Language,
+		Encrypted: file.Encrypted,
+		ExpiresAt: file.ExpiresAt,
+	}
+}
+
+// formatDocumentListCursor returns a cursor like "1690891200000:hocwr6i6" which points after the document.
+func formatDocumentListCursor(version int64, documentID string) string {
+	return strconv.FormatInt(version, 10) + ":" + documentID
+}
+
+func parseDocumentListCursor(cursor string) (int64, string, error) {
+	versionStr, documentID, ok := strings.Cut(cursor, ":")
+	if !ok || documentID == "" {
+		return 0, "", ErrInvalidDocumentListCursor
+	}
+	version, err := strconv.ParseInt(versionStr, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, "", ErrInvalidDocumentListCursor
+	}
+	return version, documentID, nil
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/httperr"
+)
+
+const (
+	liveHeartbeatInterval = 30 * time.Second
+	liveBufferSize        = 16
+)
+
+// liveStreams keeps the subscribers of the live streams of each document.
+type liveStreams struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan api.LiveEvent]struct{}
+}
+
+func (l *liveStreams) subscribe(documentID string) (<-chan api.LiveEvent, func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.subscribers == nil {
+		l.subscribers = make(map[string]map[chan api.LiveEvent]struct{})
+	}
+	if l.subscribers[documentID] == nil {
+		l.subscribers[documentID] = make(map[chan api.LiveEvent]struct{})
+	}
+
+	events := make(chan api.LiveEvent, liveBufferSize)
+	l.subscribers[documentID][events] = struct{}{}
+
+	return events, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.subscribers[documentID], events)
+		if len(l.subscribers[documentID]) == 0 {
+			delete(l.subscribers, documentID)
+		}
+	}
+}
+
+// publish sends the event to all live streams of the document. Subscribers which are too slow to keep up miss the event.
+func (l *liveStreams) publish(event api.LiveEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for events := range l.subscribers[event.DocumentKey] {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+func (s *Server) publishLiveEvent(event string, documentID string, version int64) {
+	s.live.publish(api.LiveEvent{
+		Event:       event,
+		DocumentKey: documentID,
+		Version:     version,
+	})
+}
+
+// GetDocumentEventStream streams the new versions of a document as server-sent events until the document is deleted.
+func (s *Server) GetDocumentEventStream(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+	if _, err := s.db.GetDocument(r.Context(), documentID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrDocumentNotFound))
+			return
+		}
+		s.error(w, r, fmt.Errorf("failed to get document: %w", err))
+		return
+	}
+
+	events, unsubscribe := s.live.subscribe(documentID)
+	defer unsubscribe()
+
+	w.Header().Set(ezhttp.HeaderContentType, ezhttp.ContentTypeEventStream)
+	w.Header().Set(ezhttp.HeaderCacheControl, "no-cache")
+	w.Header().Set(ezhttp.HeaderXAccelBuffering, "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		slog.ErrorContext(r.Context(), "failed to flush live stream", slog.Any("err", err))
+		return
+	}
+
+	heartbeat := time.NewTicker(liveHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case event := <-events:
+			// a deleted version only ends the stream if it was the last one
+			var deleted bool
+			if event.Event == EventDelete || event.Event == EventExpire || event.Event == EventPrune {
+				if _, err := s.db.GetDocument(r.Context(), documentID); errors.Is(err, sql.ErrNoRows) {
+					deleted = true
+				}
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "failed to encode live event", slog.Any("err", err))
+				continue
+			}
+			if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Event, data); err != nil {
+				return
+			}
+			if deleted {
+				_ = rc.Flush()
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
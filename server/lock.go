@@ -0,0 +1,220 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/flags"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+const (
+	defaultLockTTL = 5 * time.Minute
+	maxLockTTL     = time.Hour
+	maxLockHolder  = 256
+)
+
+var (
+	ErrInvalidLockTTL    = fmt.Errorf("invalid lock ttl, must be a duration between 1s and %s", maxLockTTL)
+	ErrLockHolderTooLong = fmt.Errorf("lock holder must be at most %d characters", maxLockHolder)
+	ErrDocumentNotLocked = errors.New("document is not locked")
+	ErrLockChanged       = errors.New("lock of the document changed while acquiring it, try again")
+)
+
+func newLockedError(lock database.DocumentLock) error {
+	return httperr.New(&api.LockedError{
+		Holder:    lock.Holder,
+		ExpiresAt: lock.ExpiresAt,
+	}, http.StatusLocked)
+}
+
+func newLockResponse(lock database.DocumentLock, withID bool) api.LockResponse {
+	rs := api.LockResponse{
+		Holder:    lock.Holder,
+		CreatedAt: lock.CreatedAt,
+		ExpiresAt: lock.ExpiresAt,
+	}
+	if withID {
+		rs.ID = lock.ID
+	}
+	return rs
+}
+
+// getDocumentLock returns the lock of the document or nil if it isn't locked or the lock expired.
+func (s *Server) getDocumentLock(ctx context.Context, documentID string) (*database.DocumentLock, error) {
+	lock, err := s.db.GetDocumentLock(ctx, documentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !lock.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	return lock, nil
+}
+
+// checkDocumentLock returns an error if the document is locked and lockID, the Document-Lock header of the request,
+// isn't the id of the lock. Locks are advisory, they only stop new versions, revisions and parts and nothing else.
+func (s *Server) checkDocumentLock(ctx context.Context, documentID string, lockID string) error {
+	lock, err := s.getDocumentLock(ctx, documentID)
+	if err != nil {
+		return err
+	}
+	if lock == nil || lockID == lock.ID {
+		return nil
+	}
+	return newLockedError(*lock)
+}
+
+// GetDocumentLock returns the lock of the document, its id is only returned to the holder.
+func (s *Server) GetDocumentLock(w http.ResponseWriter, r *http.Request) {
+	lock, err := s.getDocumentLock(r.Context(), chi.URLParam(r, "documentID"))
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if lock == nil {
+		s.error(w, r, httperr.NotFound(ErrDocumentNotLocked))
+		return
+	}
+	s.ok(w, r, newLockResponse(*lock, r.Header.Get(ezhttp.HeaderDocumentLock) == lock.ID))
+}
+
+// PostDocumentLock locks the document, so only requests with the id of the lock can create new versions until it
+// expires. The holder renews the lock with its id before it expires, other writers get a 423 Locked until then or
+// steal the lock of a holder which disappeared.
+func (s *Server) PostDocumentLock(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionWrite) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+		return
+	}
+
+	var lockRequest api.LockRequest
+	if err := json.NewDecoder(r.Body).Decode(&lockRequest); err != nil && !errors.Is(err, io.EOF) {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+	ttl := defaultLockTTL
+	if lockRequest.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(lockRequest.TTL); err != nil || ttl < time.Second || ttl > maxLockTTL {
+			s.error(w, r, httperr.BadRequest(ErrInvalidLockTTL))
+			return
+		}
+	}
+	if len(lockRequest.Holder) > maxLockHolder {
+		s.error(w, r, httperr.BadRequest(ErrLockHolderTooLong))
+		return
+	}
+
+	versions, err := s.db.GetVersionCount(r.Context(), documentID)
+	if err != nil {
+		s.error(w, r, fmt.Errorf("failed to get document versions: %w", err))
+		return
+	}
+	if versions == 0 {
+		s.error(w, r, httperr.NotFound(ErrDocumentNotFound))
+		return
+	}
+
+	current, err := s.getDocumentLock(r.Context(), documentID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	now := time.Now()
+	lock := database.DocumentLock{
+		DocumentID: documentID,
+		ID:         rand.Text(),
+		Holder:     lockRequest.Holder,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	var currentLockID string
+	if current != nil {
+		switch {
+		case r.Header.Get(ezhttp.HeaderDocumentLock) == current.ID:
+			// renewing keeps the lock
+			lock.ID = current.ID
+			lock.CreatedAt = current.CreatedAt
+			if lock.Holder == "" {
+				lock.Holder = current.Holder
+			}
+		case !lockRequest.Steal:
+			s.error(w, r, newLockedError(*current))
+			return
+		}
+		currentLockID = current.ID
+	}
+
+	ok, err := s.db.AcquireDocumentLock(r.Context(), lock, currentLockID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if !ok {
+		// another writer locked the document in the meantime
+		current, err = s.getDocumentLock(r.Context(), documentID)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+		if current != nil {
+			s.error(w, r, newLockedError(*current))
+			return
+		}
+		s.error(w, r, httperr.Conflict(ErrLockChanged))
+		return
+	}
+
+	s.ok(w, r, newLockResponse(lock, true))
+}
+
+// DeleteDocumentLock releases the lock of the document, it needs the id of the lock in the Document-Lock header.
+func (s *Server) DeleteDocumentLock(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionWrite) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+		return
+	}
+
+	current, err := s.getDocumentLock(r.Context(), documentID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if current == nil {
+		s.ok(w, r, nil)
+		return
+	}
+	if r.Header.Get(ezhttp.HeaderDocumentLock) != current.ID {
+		s.error(w, r, newLockedError(*current))
+		return
+	}
+
+	if err = s.db.DeleteDocumentLock(r.Context(), documentID, current.ID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		s.error(w, r, err)
+		return
+	}
+	s.ok(w, r, nil)
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/internal/logparse"
+)
+
+var (
+	ErrInvalidLogLevel = errors.New("invalid log level, must be one of: trace, debug, info, warn, error, fatal")
+	ErrInvalidLogTime  = errors.New("invalid log time, must be a RFC3339 timestamp")
+)
+
+type ResponseLogs struct {
+	Name string `json:"name"`
+	logparse.Document
+}
+
+// GetDocumentFileLogs parses a file as log output or stack trace and returns the structured entries for the smart view.
+func (s *Server) GetDocumentFileLogs(w http.ResponseWriter, r *http.Request) {
+	file, err := s.getDocumentFile(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if file.Encrypted {
+		s.error(w, r, httperr.BadRequest(ErrFileEncrypted))
+		return
+	}
+
+	filter, err := getLogFilter(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	_, span := s.tracer.Start(r.Context(), "parseLogs", trace.WithAttributes(
+		attribute.String("document_id", file.DocumentID),
+		attribute.String("file_name", file.Name),
+	))
+	document := logparse.Parse(file.Content)
+	if !filter.IsZero() {
+		document.Entries = filter.Apply(document.Entries)
+	}
+	span.SetAttributes(
+		attribute.String("format", string(document.Format)),
+		attribute.Int("entries", len(document.Entries)),
+	)
+	span.End()
+
+	s.ok(w, r, ResponseLogs{
+		Name:     file.Name,
+		Document: document,
+	})
+}
+
+// getLogFilter parses the level, from & to query parameters.
+func getLogFilter(r *http.Request) (logparse.Filter, error) {
+	query := r.URL.Query()
+
+	var filter logparse.Filter
+	if level := query.Get("level"); level != "" {
+		filter.Level = logparse.ParseLevel(level)
+		if filter.Level == logparse.LevelNone {
+			return filter, httperr.BadRequest(ErrInvalidLogLevel)
+		}
+	}
+	if from := query.Get("from"); from != "" {
+		t, err := logparse.ParseTime(from)
+		if err != nil {
+			return filter, httperr.BadRequest(ErrInvalidLogTime)
+		}
+		filter.From = t
+	}
+	if to := query.Get("to"); to != "" {
+		t, err := logparse.ParseTime(to)
+		if err != nil {
+			return filter, httperr.BadRequest(ErrInvalidLogTime)
+		}
+		filter.To = t
+	}
+	return filter, nil
+}
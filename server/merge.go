@@ -0,0 +1,334 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/topi314/gobin/v3/internal/diff"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/flags"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+var (
+	ErrMissingMergeSource = errors.New("missing source document to merge")
+	ErrNotAFork           = errors.New("source document is not a fork of the target document")
+	ErrMergeBaseNotFound  = errors.New("the version the source document was forked from does not exist anymore")
+	ErrForkParentNotFound = errors.New("forked from document version not found")
+	ErrMergeConflicts     = func(conflicts int) error {
+		return fmt.Errorf("merge has %d conflicts, resolve them and send the resolved files", conflicts)
+	}
+)
+
+type (
+	ResponseMerge struct {
+		Key string `json:"key"`
+		// Version is the latest version of the target document the merge is based on.
+		Version   int64           `json:"version"`
+		Source    CompareDocument `json:"source"`
+		Base      CompareDocument `json:"base"`
+		Conflicts int             `json:"conflicts"`
+		Files     []MergeFile     `json:"files"`
+	}
+
+	MergeFile struct {
+		Name      string     `json:"name"`
+		Content   string     `json:"content"`
+		Language  string     `json:"language"`
+		ExpiresAt *time.Time `json:"expires_at"`
+		Conflicts int        `json:"conflicts"`
+	}
+)
+
+// GetDocumentMerge returns the three-way merge of a fork into the document without saving it.
+func (s *Server) GetDocumentMerge(w http.ResponseWriter, r *http.Request) {
+	rs, err := s.mergeDocuments(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, rs)
+}
+
+// PostDocumentMerge saves the merge of a fork as a new version of the document. Without a request body the merge is
+// only saved if it has no conflicts, otherwise the files in the body are saved as the resolved merge.
+func (s *Server) PostDocumentMerge(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionWrite) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+		return
+	}
+
+	rs, err := s.mergeDocuments(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	var dbFiles []database.File
+	if r.Header.Get(ezhttp.HeaderContentType) != "" {
+		files, err := s.parseDocumentFiles(r)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+		for i, file := range files {
+			dbFiles = append(dbFiles, database.File{
+				Name:       file.Name,
+				Content:    file.Content,
+				Language:   file.Language,
+				Encrypted:  file.Encrypted,
+				ExpiresAt:  file.ExpiresAt,
+				OrderIndex: i,
+			})
+		}
+	} else {
+		if rs.Conflicts > 0 {
+			s.error(w, r, httperr.Conflict(ErrMergeConflicts(rs.Conflicts)))
+			return
+		}
+		for i, file := range rs.Files {
+			dbFiles = append(dbFiles, database.File{
+				Name:       file.Name,
+				Content:    file.Content,
+				Language:   file.Language,
+				ExpiresAt:  file.ExpiresAt,
+				OrderIndex: i,
+			})
+		}
+	}
+	if len(dbFiles) == 0 {
+		s.error(w, r, httperr.BadRequest(ErrInvalidDocumentFileContent))
+		return
+	}
+
+	review, err := s.requiresReview(r, documentID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if review {
+		revision, err := s.createRevision(r, documentID, dbFiles)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+		s.json(w, r, revision, http.StatusAccepted)
+		return
+	}
+
+	document, err := s.updateDocument(r, documentID, dbFiles)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	// the next merge of the fork only contains the changes made after this one
+	if err = s.db.UpdateForkMergedVersion(r.Context(), rs.Source.Key, rs.Source.Version); err != nil {
+		slog.ErrorContext(r.Context(), "failed to update fork merged version", slog.Any("err", err))
+	}
+	s.RecordEvent(r.Context(), EventMerge, documentID, document.Version, EventMergeData{
+		Source:        rs.Source.Key,
+		SourceVersion: rs.Source.Version,
+	})
+
+	s.ok(w, r, document)
+}
+
+func (s *Server) mergeDocuments(r *http.Request) (*ResponseMerge, error) {
+	documentID := chi.URLParam(r, "documentID")
+	query := r.URL.Query()
+	source := CompareDocument{Key: query.Get("source")}
+	if source.Key == "" {
+		return nil, httperr.BadRequest(ErrMissingMergeSource)
+	}
+	if versionStr := query.Get("source_version"); versionStr != "" {
+		version, err := strconv.ParseInt(versionStr, 10, 64)
+		if err != nil {
+			return nil, httperr.BadRequest(ErrInvalidDocumentVersion)
+		}
+		source.Version = version
+	}
+
+	ctx, span := s.tracer.Start(r.Context(), "mergeDocuments", trace.WithAttributes(
+		attribute.String("document_id", documentID),
+		attribute.String("source", source.Key),
+		attribute.Int64("source_version", source.Version),
+	))
+	defer span.End()
+
+	fork, err := s.db.GetFork(ctx, source.Key)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, httperr.BadRequest(ErrNotAFork)
+		}
+		return nil, fmt.Errorf("failed to get fork: %w", err)
+	}
+	if fork.ParentID != documentID {
+		return nil, httperr.BadRequest(ErrNotAFork)
+	}
+
+	targetFiles, err := s.getCompareDocumentFiles(ctx, documentID, 0)
+	if err != nil {
+		return nil, err
+	}
+	sourceFiles, err := s.getCompareDocumentFiles(ctx, source.Key, source.Version)
+	if err != nil {
+		return nil, err
+	}
+	source.Version = sourceFiles[0].DocumentVersion
+
+	// after the first merge the last merged version of the fork is the common ancestor
+	base := CompareDocument{Key: documentID, Version: fork.ParentVersion}
+	if fork.MergedVersion != 0 {
+		base = CompareDocument{Key: source.Key, Version: fork.MergedVersion}
+	}
+	baseFiles, err := s.getDocumentFiles(ctx, base.Key, base.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, httperr.UnprocessableEntity(ErrMergeBaseNotFound)
+		}
+		return nil, fmt.Errorf("failed to get merge base: %w", err)
+	}
+
+	files := mergeFiles(baseFiles, targetFiles, sourceFiles, documentID, source.Key)
+	var conflicts int
+	for _, file := range files {
+		conflicts += file.Conflicts
+	}
+	span.SetAttributes(attribute.Int("conflicts", conflicts))
+
+	return &ResponseMerge{
+		Key:       documentID,
+		Version:   targetFiles[0].DocumentVersion,
+		Source:    source,
+		Base:      base,
+		Conflicts: conflicts,
+		Files:     files,
+	}, nil
+}
+
+// mergeFiles merges the files of both documents by name. Files which were removed on one side and not changed on the
+// other side are removed, conflicts are marked like git does.
+func mergeFiles(baseFiles []database.File, oursFiles []database.File, theirsFiles []database.File, oursLabel string, theirsLabel string) []MergeFile {
+	names := make([]string, 0, len(oursFiles))
+	for _, file := range oursFiles {
+		names = append(names, file.Name)
+	}
+	for _, file := range theirsFiles {
+		if !slices.Contains(names, file.Name) {
+			names = append(names, file.Name)
+		}
+	}
+
+	files := make([]MergeFile, 0, len(names))
+	for _, name := range names {
+		base, ours, theirs := findFile(baseFiles, name), findFile(oursFiles, name), findFile(theirsFiles, name)
+
+		var (
+			lines     []string
+			conflicts int
+		)
+		for _, chunk := range diff.Merge3(splitFile(base), splitFile(ours), splitFile(theirs)) {
+			if !chunk.Conflict {
+				lines = append(lines, chunk.Lines...)
+				continue
+			}
+			conflicts++
+			lines = append(lines, "<<<<<<< "+oursLabel)
+			lines = append(lines, chunk.Ours...)
+			lines = append(lines, "=======")
+			lines = append(lines, chunk.Theirs...)
+			lines = append(lines, ">>>>>>> "+theirsLabel)
+		}
+		if len(lines) == 0 && conflicts == 0 {
+			continue
+		}
+
+		// prefer our side for everything which can't be merged line by line
+		file := ours
+		if file == nil {
+			file = theirs
+		}
+		content := strings.Join(lines, "\n")
+		if strings.HasSuffix(file.Content, "\n") {
+			content += "\n"
+		}
+		files = append(files, MergeFile{
+			Name:      name,
+			Content:   content,
+			Language:  file.Language,
+			ExpiresAt: file.ExpiresAt,
+			Conflicts: conflicts,
+		})
+	}
+	return files
+}
+
+func findFile(files []database.File, name string) *database.File {
+	index := slices.IndexFunc(files, func(file database.File) bool {
+		return file.Name == name
+	})
+	if index == -1 {
+		return nil
+	}
+	return &files[index]
+}
+
+func splitFile(file *database.File) []string {
+	if file == nil {
+		return nil
+	}
+	return diff.Split(file.Content)
+}
+
+// getForkParent returns the document version from the forked_from and forked_from_version query parameters or nil if
+// the new document is not a fork.
+func (s *Server) getForkParent(r *http.Request) (*database.Fork, error) {
+	query := r.URL.Query()
+	parentID := query.Get("forked_from")
+	if parentID == "" {
+		return nil, nil
+	}
+
+	var version int64
+	if versionStr := query.Get("forked_from_version"); versionStr != "" {
+		var err error
+		version, err = strconv.ParseInt(versionStr, 10, 64)
+		if err != nil {
+			return nil, httperr.BadRequest(ErrInvalidDocumentVersion)
+		}
+	}
+
+	versions, err := s.db.GetDocumentVersions(r.Context(), parentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get forked from document versions: %w", err)
+	}
+	if len(versions) == 0 || (version != 0 && !slices.Contains(versions, version)) {
+		return nil, httperr.BadRequest(ErrForkParentNotFound)
+	}
+	if version == 0 {
+		// versions are sorted from newest to oldest
+		version = versions[0]
+	}
+
+	return &database.Fork{
+		ParentID:      parentID,
+		ParentVersion: version,
+	}, nil
+}
@@ -3,22 +3,18 @@ package server
 import (
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
-	"slices"
-	"strconv"
 	"strings"
-	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/stampede"
-	"github.com/go-jose/go-jose/v3/jwt"
 
 	"github.com/topi314/gobin/v3/internal/ezhttp"
 	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/featureflags"
 )
 
-const maxUnix = int(^int32(0)) * 1000
-
 var (
 	ErrNoPermissions     = errors.New("no permissions provided")
 	ErrUnknownPermission = func(p string) error {
@@ -45,57 +41,46 @@ func cacheControl(next http.Handler) http.Handler {
 	})
 }
 
-func (s *Server) RateLimit(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Only apply rate limiting to POST, PATCH, and DELETE requests
-		if r.Method != http.MethodPost && r.Method != http.MethodPatch && r.Method != http.MethodDelete {
-			next.ServeHTTP(w, r)
-			return
-		}
-		remoteAddr := strings.SplitN(r.RemoteAddr, ":", 2)[0]
-		// Filter whitelisted IPs
-		if slices.Contains(s.cfg.RateLimit.Whitelist, remoteAddr) {
-			next.ServeHTTP(w, r)
-			return
-		}
-		// Filter blacklisted IPs
-		if slices.Contains(s.cfg.RateLimit.Blacklist, remoteAddr) {
-			w.Header().Set(ezhttp.HeaderRateLimitLimit, strconv.Itoa(s.cfg.RateLimit.Requests))
-			w.Header().Set(ezhttp.HeaderRateLimitRemaining, "0")
-			w.Header().Set(ezhttp.HeaderRateLimitReset, strconv.Itoa(maxUnix))
-			w.Header().Set(ezhttp.HeaderRetryAfter, strconv.Itoa(maxUnix-int(time.Now().UnixMilli())))
-			w.WriteHeader(http.StatusTooManyRequests)
-			s.error(w, r, httperr.TooManyRequests(ErrRateLimit))
-			return
-		}
-		if s.rateLimitHandler == nil {
-			next.ServeHTTP(w, r)
-			return
-		}
-		s.rateLimitHandler(next).ServeHTTP(w, r)
-	})
+// requestToken returns the bearer token of the request. Webhook and ingest endpoints are authorized with their secret
+// instead of a token, so they have none.
+func requestToken(r *http.Request) string {
+	if GetWebhookSecret(r) != "" || strings.HasPrefix(r.URL.Path, "/ingest/") {
+		return ""
+	}
+	tokenString := r.Header.Get(ezhttp.HeaderAuthorization)
+	if len(tokenString) > 7 && strings.ToUpper(tokenString[0:6]) == "BEARER" {
+		tokenString = tokenString[7:]
+	}
+	return tokenString
 }
 
 func (s *Server) JWTMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenString := r.Header.Get(ezhttp.HeaderAuthorization)
-		if len(tokenString) > 7 && strings.ToUpper(tokenString[0:6]) == "BEARER" {
-			tokenString = tokenString[7:]
-		}
+		tokenString := requestToken(r)
 
 		var claims Claims
 		if tokenString == "" {
 			documentID := chi.URLParam(r, "documentID")
 			claims = EmptyClaims(documentID)
 		} else {
-			token, err := jwt.ParseSigned(tokenString)
-			if err != nil {
+			if err := s.jwtKeys.Verify(tokenString, &claims); err != nil {
 				s.error(w, r, httperr.Unauthorized(err))
 				return
 			}
 
-			if err = token.Claims([]byte(s.cfg.JWTSecret), &claims); err != nil {
-				s.error(w, r, httperr.Unauthorized(err))
+			if err := s.resolveMemberClaims(r.Context(), &claims); err != nil {
+				if errors.Is(err, ErrNotDocumentMember) {
+					err = httperr.Unauthorized(err)
+				}
+				s.error(w, r, err)
+				return
+			}
+
+			if err := s.useToken(r.Context(), tokenString, claims); err != nil {
+				if errors.Is(err, ErrTokenExpired) {
+					err = httperr.Unauthorized(err)
+				}
+				s.error(w, r, err)
 				return
 			}
 		}
@@ -103,3 +88,21 @@ func (s *Server) JWTMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, SetClaims(r, claims))
 	})
 }
+
+// FeatureFlagsMiddleware sets the evaluation context of the feature flags. The tenant is the account of the request,
+// percentages are split by the account or the client address for visitors without one.
+func (s *Server) FeatureFlagsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		evalCtx := featureflags.EvaluationContext{
+			Tenant: s.getAccountID(r),
+		}
+		evalCtx.TargetingKey = evalCtx.Tenant
+		if evalCtx.TargetingKey == "" {
+			evalCtx.TargetingKey = r.RemoteAddr
+			if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+				evalCtx.TargetingKey = host
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(featureflags.WithContext(r.Context(), evalCtx)))
+	})
+}
@@ -0,0 +1,13 @@
+--- v3.1.0
+
+CREATE TABLE events
+(
+    id               BIGSERIAL PRIMARY KEY,
+    document_id      VARCHAR   NOT NULL,
+    document_version BIGINT    NOT NULL,
+    event            VARCHAR   NOT NULL,
+    data             TEXT      NOT NULL,
+    created_at       TIMESTAMP NOT NULL
+);
+
+CREATE INDEX events_document_id_idx ON events (document_id, id);
@@ -0,0 +1,9 @@
+--- v3.1.0
+
+CREATE TABLE forks
+(
+    document_id    VARCHAR NOT NULL PRIMARY KEY,
+    parent_id      VARCHAR NOT NULL,
+    parent_version BIGINT  NOT NULL,
+    merged_version BIGINT  NOT NULL DEFAULT 0
+);
@@ -0,0 +1,11 @@
+--- v3.1.0
+
+-- only the first 256 KiB of a file are indexed to stay below the tsvector size limit
+ALTER TABLE files
+    ADD COLUMN search TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', name), 'A') || setweight(to_tsvector('simple', left(content, 262144)), 'B')
+    ) STORED;
+
+CREATE INDEX files_search_idx ON files USING GIN (search);
+
+CREATE INDEX files_document_id_idx ON files (document_id, document_version);
@@ -0,0 +1,9 @@
+--- v3.1.0
+
+CREATE TABLE creator_documents
+(
+    creator_id  VARCHAR   NOT NULL,
+    document_id VARCHAR   NOT NULL,
+    created_at  TIMESTAMP NOT NULL,
+    PRIMARY KEY (creator_id, document_id)
+);
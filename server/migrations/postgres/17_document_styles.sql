@@ -0,0 +1,7 @@
+--- v3.1.0
+
+CREATE TABLE document_styles
+(
+    document_id VARCHAR NOT NULL PRIMARY KEY,
+    style       VARCHAR NOT NULL
+);
@@ -0,0 +1,8 @@
+--- v3.1.0
+
+CREATE TABLE syslog_sources
+(
+    source      VARCHAR   NOT NULL PRIMARY KEY,
+    document_id VARCHAR   NOT NULL,
+    created_at  TIMESTAMP NOT NULL
+);
@@ -0,0 +1,20 @@
+--- v3.1.0
+
+CREATE TABLE accounts
+(
+    id         VARCHAR   NOT NULL PRIMARY KEY,
+    issuer     VARCHAR   NOT NULL,
+    subject    VARCHAR   NOT NULL,
+    name       VARCHAR   NOT NULL,
+    email      VARCHAR   NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (issuer, subject)
+);
+
+CREATE TABLE account_documents
+(
+    account_id  VARCHAR   NOT NULL,
+    document_id VARCHAR   NOT NULL,
+    created_at  TIMESTAMP NOT NULL,
+    PRIMARY KEY (account_id, document_id)
+);
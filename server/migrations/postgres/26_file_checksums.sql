@@ -0,0 +1,4 @@
+--- v3.1.0
+
+ALTER TABLE files
+    ADD COLUMN sha256 VARCHAR NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+--- v3.1.0
+
+ALTER TABLE webhooks
+    ADD COLUMN client_certificate VARCHAR NOT NULL DEFAULT '';
+
+ALTER TABLE webhook_deliveries
+    ADD COLUMN client_certificate VARCHAR NOT NULL DEFAULT '';
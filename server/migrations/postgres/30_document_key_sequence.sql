@@ -0,0 +1,3 @@
+--- v3.1.0
+
+CREATE SEQUENCE document_key_sequence;
@@ -0,0 +1,12 @@
+--- v3.1.0
+
+CREATE TABLE document_tombstones
+(
+    document_id      VARCHAR   NOT NULL,
+    document_version BIGINT    NOT NULL,
+    deleted_at       TIMESTAMP NOT NULL,
+    reason           VARCHAR   NOT NULL,
+    PRIMARY KEY (document_id, document_version)
+);
+
+CREATE INDEX document_tombstones_deleted_at_idx ON document_tombstones (deleted_at);
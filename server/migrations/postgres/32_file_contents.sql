@@ -0,0 +1,10 @@
+--- v3.1.0
+
+CREATE TABLE file_contents
+(
+    sha256     VARCHAR   NOT NULL PRIMARY KEY,
+    content    TEXT      NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX files_sha256_idx ON files (sha256);
@@ -0,0 +1,7 @@
+--- v3.1.0
+
+ALTER TABLE webhooks
+    ADD COLUMN enabled BOOLEAN NOT NULL DEFAULT true;
+
+ALTER TABLE webhooks
+    ADD COLUMN disabled_reason VARCHAR NOT NULL DEFAULT '';
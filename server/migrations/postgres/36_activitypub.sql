@@ -0,0 +1,19 @@
+--- v3.1.0
+
+CREATE TABLE activitypub_followers
+(
+    actor_id   VARCHAR   NOT NULL PRIMARY KEY,
+    inbox      VARCHAR   NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE activitypub_notes
+(
+    document_id VARCHAR   NOT NULL PRIMARY KEY,
+    version     BIGINT    NOT NULL,
+    summary     VARCHAR   NOT NULL,
+    content     VARCHAR   NOT NULL,
+    created_at  TIMESTAMP NOT NULL
+);
+
+CREATE INDEX activitypub_notes_created_at_idx ON activitypub_notes (created_at);
@@ -0,0 +1,11 @@
+--- v3.1.0
+
+ALTER TABLE document_share_tokens ADD COLUMN permissions BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE revoked_tokens
+(
+    id          VARCHAR   NOT NULL PRIMARY KEY,
+    document_id VARCHAR   NOT NULL,
+    expires_at  TIMESTAMP,
+    revoked_at  TIMESTAMP NOT NULL
+);
@@ -0,0 +1,10 @@
+--- v3.1.0
+
+CREATE TABLE document_locks
+(
+    document_id VARCHAR   NOT NULL PRIMARY KEY,
+    id          VARCHAR   NOT NULL,
+    holder      VARCHAR   NOT NULL,
+    created_at  TIMESTAMP NOT NULL,
+    expires_at  TIMESTAMP NOT NULL
+);
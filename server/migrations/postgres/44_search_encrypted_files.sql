@@ -0,0 +1,15 @@
+--- v3.1.0
+
+-- contents encrypted at rest are only found by the file name
+ALTER TABLE files
+    DROP COLUMN search;
+
+ALTER TABLE files
+    ADD COLUMN search TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', name), 'A') || CASE
+            WHEN content LIKE 'enc:%' THEN ''::TSVECTOR
+            ELSE setweight(to_tsvector('simple', left(content, 262144)), 'B')
+        END
+    ) STORED;
+
+CREATE INDEX files_search_idx ON files USING GIN (search);
@@ -0,0 +1,21 @@
+--- v3.1.0
+
+-- keys of documents created before keys were claimed are claimed too, so their tokens can't be used for a new document
+-- with the same key once they are deleted
+INSERT INTO custom_document_keys (key, created_at)
+SELECT DISTINCT document_id, CURRENT_TIMESTAMP
+FROM files
+WHERE true
+ON CONFLICT (key) DO NOTHING;
+
+INSERT INTO custom_document_keys (key, created_at)
+SELECT DISTINCT document_id, CURRENT_TIMESTAMP
+FROM document_tombstones
+WHERE true
+ON CONFLICT (key) DO NOTHING;
+
+INSERT INTO custom_document_keys (key, created_at)
+SELECT DISTINCT document_id, CURRENT_TIMESTAMP
+FROM events
+WHERE true
+ON CONFLICT (key) DO NOTHING;
@@ -0,0 +1,10 @@
+--- v3.1.0
+
+CREATE TABLE summaries
+(
+    document_id      VARCHAR   NOT NULL,
+    document_version BIGINT    NOT NULL,
+    summary          TEXT      NOT NULL,
+    created_at       TIMESTAMP NOT NULL,
+    PRIMARY KEY (document_id, document_version)
+);
@@ -0,0 +1,3 @@
+--- v3.1.0
+
+CREATE INDEX files_document_id_idx ON files (document_id, document_version);
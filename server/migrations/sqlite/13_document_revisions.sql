@@ -0,0 +1,19 @@
+--- v3.1.0
+
+CREATE TABLE protected_documents
+(
+    document_id VARCHAR NOT NULL PRIMARY KEY
+);
+
+CREATE TABLE revisions
+(
+    name         VARCHAR NOT NULL,
+    document_id  VARCHAR NOT NULL,
+    revision     BIGINT  NOT NULL,
+    base_version BIGINT  NOT NULL,
+    content      TEXT    NOT NULL,
+    language     VARCHAR NOT NULL,
+    expires_at   TIMESTAMP,
+    order_index  BIGINT  NOT NULL DEFAULT 0,
+    PRIMARY KEY (name, document_id, revision)
+);
@@ -0,0 +1,12 @@
+--- v3.1.0
+
+CREATE TABLE device_authorizations
+(
+    device_code    VARCHAR   NOT NULL PRIMARY KEY,
+    user_code      VARCHAR   NOT NULL UNIQUE,
+    permissions    VARCHAR   NOT NULL,
+    status         VARCHAR   NOT NULL DEFAULT 'pending',
+    tokens         TEXT      NOT NULL DEFAULT '',
+    expires_at     TIMESTAMP NOT NULL,
+    last_polled_at TIMESTAMP
+);
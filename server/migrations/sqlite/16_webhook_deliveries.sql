@@ -0,0 +1,29 @@
+--- v3.1.0
+
+CREATE TABLE webhook_deliveries
+(
+    id          VARCHAR   NOT NULL PRIMARY KEY,
+    webhook_id  VARCHAR   NOT NULL,
+    document_id VARCHAR   NOT NULL,
+    url         VARCHAR   NOT NULL,
+    secret      VARCHAR   NOT NULL,
+    event       VARCHAR   NOT NULL,
+    payload     TEXT      NOT NULL,
+    status      VARCHAR   NOT NULL DEFAULT 'pending',
+    attempts    INTEGER   NOT NULL DEFAULT 0,
+    created_at  TIMESTAMP NOT NULL
+);
+
+CREATE INDEX webhook_deliveries_webhook_id_idx ON webhook_deliveries (document_id, webhook_id, created_at);
+CREATE INDEX webhook_deliveries_status_idx ON webhook_deliveries (status);
+
+CREATE TABLE webhook_delivery_attempts
+(
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    delivery_id VARCHAR   NOT NULL,
+    status_code INTEGER   NOT NULL,
+    error       TEXT      NOT NULL DEFAULT '',
+    created_at  TIMESTAMP NOT NULL
+);
+
+CREATE INDEX webhook_delivery_attempts_delivery_id_idx ON webhook_delivery_attempts (delivery_id, id);
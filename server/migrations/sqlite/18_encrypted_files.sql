@@ -0,0 +1,7 @@
+--- v3.1.0
+
+ALTER TABLE files
+    ADD COLUMN encrypted BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE revisions
+    ADD COLUMN encrypted BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,11 @@
+--- v3.1.0
+
+CREATE TABLE user_settings
+(
+    creator_id       VARCHAR   NOT NULL PRIMARY KEY,
+    default_style    VARCHAR   NOT NULL,
+    default_expiry   VARCHAR   NOT NULL,
+    editor_keymap    VARCHAR   NOT NULL,
+    default_language VARCHAR   NOT NULL,
+    updated_at       TIMESTAMP NOT NULL
+);
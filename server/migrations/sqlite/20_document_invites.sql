@@ -0,0 +1,24 @@
+--- v3.1.0
+
+CREATE TABLE document_invites
+(
+    id          VARCHAR   NOT NULL PRIMARY KEY,
+    document_id VARCHAR   NOT NULL,
+    permissions BIGINT    NOT NULL,
+    max_uses    BIGINT    NOT NULL,
+    uses        BIGINT    NOT NULL,
+    expires_at  TIMESTAMP,
+    created_at  TIMESTAMP NOT NULL
+);
+
+CREATE INDEX document_invites_document_id_idx ON document_invites (document_id);
+
+CREATE TABLE document_members
+(
+    document_id VARCHAR   NOT NULL,
+    creator_id  VARCHAR   NOT NULL,
+    permissions BIGINT    NOT NULL,
+    invite_id   VARCHAR   NOT NULL,
+    joined_at   TIMESTAMP NOT NULL,
+    PRIMARY KEY (document_id, creator_id)
+);
@@ -0,0 +1,7 @@
+--- v3.1.0
+
+CREATE TABLE custom_document_keys
+(
+    key        VARCHAR   NOT NULL PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL
+);
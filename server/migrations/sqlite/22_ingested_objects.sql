@@ -0,0 +1,9 @@
+--- v3.1.0
+
+CREATE TABLE ingested_objects
+(
+    object_key  VARCHAR   NOT NULL PRIMARY KEY,
+    etag        VARCHAR   NOT NULL,
+    document_id VARCHAR   NOT NULL,
+    created_at  TIMESTAMP NOT NULL
+);
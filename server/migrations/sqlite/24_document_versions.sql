@@ -0,0 +1,9 @@
+--- v3.1.0
+
+CREATE TABLE document_versions
+(
+    document_id      VARCHAR NOT NULL,
+    document_version BIGINT  NOT NULL,
+    message          VARCHAR NOT NULL,
+    PRIMARY KEY (document_id, document_version)
+);
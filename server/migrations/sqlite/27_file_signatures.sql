@@ -0,0 +1,15 @@
+--- v3.1.0
+
+CREATE TABLE file_signatures
+(
+    document_id      VARCHAR   NOT NULL,
+    document_version BIGINT    NOT NULL,
+    file_name        VARCHAR   NOT NULL,
+    format           VARCHAR   NOT NULL,
+    public_key       VARCHAR   NOT NULL,
+    signature        VARCHAR   NOT NULL,
+    key_id           VARCHAR   NOT NULL,
+    comment          VARCHAR   NOT NULL,
+    created_at       TIMESTAMP NOT NULL,
+    PRIMARY KEY (document_id, document_version, file_name)
+);
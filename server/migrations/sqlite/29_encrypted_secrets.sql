@@ -0,0 +1,4 @@
+--- v3.1.0
+
+ALTER TABLE webhooks
+    ADD COLUMN secret_hash VARCHAR NOT NULL DEFAULT '';
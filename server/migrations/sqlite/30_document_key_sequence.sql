@@ -0,0 +1,10 @@
+--- v3.1.0
+
+CREATE TABLE document_key_sequence
+(
+    id    INTEGER NOT NULL PRIMARY KEY CHECK (id = 1),
+    value BIGINT  NOT NULL
+);
+
+INSERT INTO document_key_sequence (id, value)
+VALUES (1, 0);
@@ -0,0 +1,4 @@
+--- v3.1.0
+
+ALTER TABLE files
+    ADD COLUMN delta_base BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,16 @@
+--- v3.1.0
+
+CREATE TABLE account_webhooks
+(
+    id                 VARCHAR NOT NULL PRIMARY KEY,
+    account_id         VARCHAR NOT NULL,
+    url                VARCHAR NOT NULL,
+    secret             VARCHAR NOT NULL,
+    secret_hash        VARCHAR NOT NULL,
+    events             VARCHAR NOT NULL,
+    client_certificate VARCHAR NOT NULL DEFAULT '',
+    enabled            BOOLEAN NOT NULL DEFAULT true,
+    disabled_reason    VARCHAR NOT NULL DEFAULT ''
+);
+
+CREATE INDEX account_webhooks_account_id_idx ON account_webhooks (account_id);
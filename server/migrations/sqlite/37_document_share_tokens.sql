@@ -0,0 +1,13 @@
+--- v3.1.0
+
+CREATE TABLE document_share_tokens
+(
+    id          VARCHAR   NOT NULL PRIMARY KEY,
+    document_id VARCHAR   NOT NULL,
+    max_uses    BIGINT    NOT NULL,
+    uses        BIGINT    NOT NULL,
+    expires_at  TIMESTAMP,
+    created_at  TIMESTAMP NOT NULL
+);
+
+CREATE INDEX document_share_tokens_document_id_idx ON document_share_tokens (document_id);
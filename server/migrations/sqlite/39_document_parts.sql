@@ -0,0 +1,10 @@
+--- v3.1.0
+
+CREATE TABLE document_parts
+(
+    document_id VARCHAR NOT NULL PRIMARY KEY,
+    index_id    VARCHAR NOT NULL,
+    part_index  BIGINT  NOT NULL
+);
+
+CREATE INDEX document_parts_index_id_idx ON document_parts (index_id);
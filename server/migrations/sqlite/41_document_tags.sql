@@ -0,0 +1,10 @@
+--- v3.1.0
+
+CREATE TABLE document_tags
+(
+    document_id VARCHAR NOT NULL,
+    tag         VARCHAR NOT NULL,
+    PRIMARY KEY (document_id, tag)
+);
+
+CREATE INDEX document_tags_tag_idx ON document_tags (tag);
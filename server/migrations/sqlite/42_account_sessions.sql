@@ -0,0 +1,15 @@
+--- v3.1.0
+
+CREATE TABLE account_sessions
+(
+    id           VARCHAR   NOT NULL PRIMARY KEY,
+    account_id   VARCHAR   NOT NULL,
+    kind         VARCHAR   NOT NULL,
+    user_agent   VARCHAR   NOT NULL DEFAULT '',
+    address      VARCHAR   NOT NULL DEFAULT '',
+    created_at   TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP NOT NULL,
+    expires_at   TIMESTAMP NOT NULL
+);
+
+CREATE INDEX account_sessions_account_id_idx ON account_sessions (account_id);
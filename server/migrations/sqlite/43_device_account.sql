@@ -0,0 +1,4 @@
+--- v3.1.0
+
+ALTER TABLE device_authorizations ADD COLUMN account BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE device_authorizations ADD COLUMN account_id VARCHAR NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+--- v3.1.0
+
+-- SQLite has no search index, SearchDocuments skips contents encrypted at rest
+SELECT 1;
@@ -0,0 +1,38 @@
+--- v3.1.0
+
+-- sessions and device logins record whether the login was confirmed with a second factor
+ALTER TABLE account_sessions
+    ADD COLUMN two_factor BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE device_authorizations
+    ADD COLUMN two_factor BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE account_two_factor
+(
+    account_id     VARCHAR NOT NULL PRIMARY KEY,
+    totp_secret    VARCHAR NOT NULL DEFAULT '',
+    totp_enabled   BOOLEAN NOT NULL DEFAULT false,
+    totp_last_step BIGINT  NOT NULL DEFAULT 0,
+    failures       INTEGER NOT NULL DEFAULT 0,
+    failed_at      TIMESTAMP
+);
+
+CREATE TABLE account_recovery_codes
+(
+    account_id VARCHAR NOT NULL,
+    code_hash  VARCHAR NOT NULL,
+    PRIMARY KEY (account_id, code_hash)
+);
+
+CREATE TABLE account_passkeys
+(
+    id           VARCHAR   NOT NULL PRIMARY KEY,
+    account_id   VARCHAR   NOT NULL,
+    name         VARCHAR   NOT NULL,
+    public_key   VARCHAR   NOT NULL,
+    sign_count   BIGINT    NOT NULL,
+    created_at   TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP
+);
+
+CREATE INDEX account_passkeys_account_id_idx ON account_passkeys (account_id);
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/httptrace/otelhttptrace"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+// maxWebhookClients limits the cached clients of webhooks with client certificates.
+const maxWebhookClients = 256
+
+var (
+	ErrInvalidClientCertificate = errors.New("invalid client certificate or key, both must be PEM encoded")
+	ErrMissingClientKey         = errors.New("client_certificate and client_key must be set together")
+)
+
+func newWebhookClient(cfg WebhookConfig, tlsConfig *tls.Config) *http.Client {
+	transport := http.DefaultTransport
+	if tlsConfig != nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = tlsConfig
+		transport = t
+	}
+	return &http.Client{
+		Transport: otelhttp.NewTransport(
+			transport,
+			otelhttp.WithClientTrace(func(ctx context.Context) *httptrace.ClientTrace {
+				return otelhttptrace.NewClientTrace(ctx)
+			}),
+		),
+		Timeout: time.Duration(cfg.Timeout),
+	}
+}
+
+// webhookClients are the clients of webhooks which need a client certificate.
+type webhookClients struct {
+	// hosts are the TLS configs of the client certificates of the config by host.
+	hosts map[string]*tls.Config
+
+	mu sync.Mutex
+	// clients are the clients by encrypted client certificate and host.
+	clients map[string]*http.Client
+}
+
+// loadWebhookClientCertificates loads the client certificates of the config. Invalid certificates are logged and
+// skipped, so deliveries to their host fail instead of the server.
+func (s *Server) loadWebhookClientCertificates() {
+	s.webhookClients.hosts = make(map[string]*tls.Config, len(s.cfg.Webhook.ClientCertificates))
+	s.webhookClients.clients = make(map[string]*http.Client)
+	for _, cfg := range s.cfg.Webhook.ClientCertificates {
+		tlsConfig, err := loadTLSConfig(cfg)
+		if err != nil {
+			slog.Error("Failed to load webhook client certificate", slog.String("host", cfg.Host), slog.Any("err", err))
+			continue
+		}
+		s.webhookClients.hosts[cfg.Host] = tlsConfig
+	}
+}
+
+func loadTLSConfig(cfg WebhookClientCertificateConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.CAFile != "" {
+		caPEM, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// webhookClient returns the client to send the delivery with. Deliveries with a client certificate and deliveries to
+// hosts with a client certificate in the config get their own client.
+func (s *Server) webhookClient(ctx context.Context, delivery database.WebhookDelivery) (*http.Client, error) {
+	u, err := url.Parse(delivery.URL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	hostConfig, ok := s.webhookClients.hosts[host]
+	if !ok {
+		host = u.Hostname()
+		hostConfig, ok = s.webhookClients.hosts[host]
+	}
+	if delivery.ClientCertificate == "" && !ok {
+		return s.client, nil
+	}
+
+	key := host + "\n" + delivery.ClientCertificate
+	s.webhookClients.mu.Lock()
+	defer s.webhookClients.mu.Unlock()
+	if client, ok := s.webhookClients.clients[key]; ok {
+		return client, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if hostConfig != nil {
+		tlsConfig = hostConfig.Clone()
+	}
+	if delivery.ClientCertificate != "" {
+		cert, err := s.openClientCertificate(ctx, delivery.ClientCertificate)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{*cert}
+	}
+
+	if len(s.webhookClients.clients) >= maxWebhookClients {
+		for k, client := range s.webhookClients.clients {
+			client.CloseIdleConnections()
+			delete(s.webhookClients.clients, k)
+		}
+	}
+	client := newWebhookClient(s.cfg.Webhook, tlsConfig)
+	s.webhookClients.clients[key] = client
+	return client, nil
+}
+
+// sealClientCertificate checks that the PEM encoded certificate and key belong together and encrypts them for the
+// database.
+func (s *Server) sealClientCertificate(ctx context.Context, certificate string, key string) (string, error) {
+	if certificate == "" && key == "" {
+		return "", nil
+	}
+	if certificate == "" || key == "" {
+		return "", ErrMissingClientKey
+	}
+	if _, err := tls.X509KeyPair([]byte(certificate), []byte(key)); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidClientCertificate, err)
+	}
+	return s.secrets.Encrypt(ctx, certificate+"\n"+key)
+}
+
+// openClientCertificate decrypts the client certificate of a webhook.
+func (s *Server) openClientCertificate(ctx context.Context, sealed string) (*tls.Certificate, error) {
+	pemBlocks, err := s.secrets.Decrypt(ctx, sealed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt client certificate: %w", err)
+	}
+	// the certificate and key are stored together, tls.X509KeyPair picks the matching blocks
+	cert, err := tls.X509KeyPair([]byte(pemBlocks), []byte(pemBlocks))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse client certificate: %w", err)
+	}
+	return &cert, nil
+}
+
+// newWebhookClientCertificateResponse describes the client certificate of the webhook or returns nil if it has none.
+func (s *Server) newWebhookClientCertificateResponse(ctx context.Context, webhook database.Webhook) *api.WebhookClientCertificateResponse {
+	if webhook.ClientCertificate == "" {
+		return nil
+	}
+	cert, err := s.openClientCertificate(ctx, webhook.ClientCertificate)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to open webhook client certificate", slog.String("webhook_id", webhook.ID), slog.Any("err", err))
+		return nil
+	}
+	leaf := cert.Leaf
+	if leaf == nil {
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil
+		}
+	}
+	sum := sha256.Sum256(leaf.Raw)
+	return &api.WebhookClientCertificateResponse{
+		Subject:  leaf.Subject.String(),
+		Issuer:   leaf.Issuer.String(),
+		NotAfter: leaf.NotAfter,
+		SHA256:   hex.EncodeToString(sum[:]),
+	}
+}
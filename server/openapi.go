@@ -0,0 +1,351 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/internal/openapi"
+)
+
+var ErrOpenAPIDisabled = errors.New("openapi document disabled")
+
+// openAPIPathParamRegex matches the url params of chi routes, regexp params like {id:[0-9]+} only keep their name.
+var openAPIPathParamRegex = regexp.MustCompile(`\{([^}:]+)(?::[^}]*)?}`)
+
+// openAPIOperation describes a handler of the API for the OpenAPI document. The paths and path parameters come from
+// the routes of the handler, routes of handlers without an operation like the pages of the web UI are left out.
+type openAPIOperation struct {
+	summary string
+	tag     string
+	query   []openapi.Parameter
+	// request is the json body of the request, documentBody is set for handlers which take the files of a document.
+	request      any
+	documentBody bool
+	// status is the status of successful responses, it defaults to 200 or 204 without response.
+	status   int
+	response any
+	// contentType is the content type of responses which aren't json.
+	contentType string
+}
+
+func openAPIQuery(name string, schemaType string, description string) openapi.Parameter {
+	return openapi.Parameter{
+		Name:        name,
+		In:          "query",
+		Description: description,
+		Schema:      &openapi.Schema{Type: schemaType},
+	}
+}
+
+var (
+	openAPIFormatterQuery = openAPIQuery("formatter", "string", "The formatter to render the files with, like html or terminal256.")
+	openAPIStyleQuery     = openAPIQuery("style", "string", "The style of the formatter.")
+	openAPIFileQuery      = openAPIQuery("file", "string", "Only return this file.")
+	openAPILanguageQuery  = openAPIQuery("language", "string", "The language to render the file in, only with file.")
+	openAPIDocumentQuery  = []openapi.Parameter{
+		openAPIQuery("language", "string", "The language of the files."),
+		openAPIFormatterQuery,
+		openAPIStyleQuery,
+		openAPIQuery("expires", "string", "When the files expire in RFC 3339 format."),
+		openAPIQuery("ttl", "string", "How long the files live like 24h, ignored if expires is set."),
+		openAPIQuery("encrypted", "boolean", "Whether the files are end-to-end encrypted."),
+		openAPIQuery("message", "string", "The change message of the version."),
+		openAPIQuery("withContent", "boolean", "Whether the content is included in the response, defaults to true."),
+	}
+	openAPIIfMatchHeader = openapi.Parameter{
+		Name:        ezhttp.HeaderIfMatch,
+		In:          "header",
+		Description: "The version the update is based on, the update fails with 409 if the document was changed since.",
+		Schema:      &openapi.Schema{Type: "string"},
+	}
+	openAPIDocumentLockHeader = openapi.Parameter{
+		Name:        ezhttp.HeaderDocumentLock,
+		In:          "header",
+		Description: "The id of the lock of the document, requests without it fail with 423 while the document is locked.",
+		Schema:      &openapi.Schema{Type: "string"},
+	}
+)
+
+// openAPIOperations are keyed by the name of their handler.
+var openAPIOperations = map[string]openAPIOperation{
+	"GetVersion": {summary: "Get the version of the server", tag: "server", contentType: ezhttp.ContentTypeText},
+	"GetStyles":  {summary: "List the styles", tag: "server", response: StylesResponse{}},
+	"GetJWKS":    {summary: "Get the public keys tokens are signed with", tag: "server", contentType: "application/jwk-set+json"},
+
+	"GetDocuments": {summary: "List the documents of the token", tag: "documents", query: []openapi.Parameter{openAPIQuery("tag", "string", "Only list the documents with the tag.")}, response: api.DocumentListResponse{}},
+	"PostDocument": {summary: "Create a document", tag: "documents", documentBody: true, query: append(openAPIDocumentQuery,
+		openAPIQuery("key", "string", "The custom key of the document."),
+		openAPIQuery("forked_from", "string", "The key of the document this document is a fork of."),
+		openAPIQuery("default_style", "string", "The style suggested to viewers."),
+		openAPIQuery("public", "boolean", "Announce the document to the ActivityPub followers."),
+	), status: http.StatusCreated, response: api.DocumentResponse{}},
+	"PostDocumentGist":    {summary: "Create a document from a GitHub gist", tag: "documents", request: api.GistImportRequest{}, status: http.StatusCreated, response: api.DocumentResponse{}},
+	"GetDocumentsCompare": {summary: "Compare two documents", tag: "documents", query: []openapi.Parameter{openAPIQuery("a", "string", "The key of the first document."), openAPIQuery("b", "string", "The key of the second document.")}, response: ResponseCompare{}},
+	"GetDocumentsSearch":  {summary: "Search documents", tag: "documents", query: []openapi.Parameter{openAPIQuery("q", "string", "The search query.")}, response: ResponseDocumentsSearch{}},
+	"GetDocument":         {summary: "Get a document (version)", tag: "documents", query: []openapi.Parameter{openAPIFormatterQuery, openAPIStyleQuery, openAPIFileQuery, openAPILanguageQuery}, response: api.DocumentResponse{}},
+	"PutDocument":         {summary: "Create a document with a custom key", tag: "documents", documentBody: true, query: openAPIDocumentQuery, status: http.StatusCreated, response: api.DocumentResponse{}},
+	"PatchDocument":       {summary: "Update a document", tag: "documents", documentBody: true, query: append(openAPIDocumentQuery, openAPIIfMatchHeader, openAPIDocumentLockHeader), response: api.DocumentResponse{}},
+	"DeleteDocument":      {summary: "Delete a document (version)", tag: "documents", response: api.DeleteResponse{}},
+	"PostDocumentAppend":  {summary: "Append to a document file", tag: "documents", documentBody: true, query: []openapi.Parameter{openAPIDocumentLockHeader}, response: api.AppendResponse{}},
+	"GetDocumentParts":    {summary: "List the parts of a split document", tag: "documents", response: api.PartsResponse{}},
+	"PostDocumentPart":    {summary: "Create the next part of a split document", tag: "documents", documentBody: true, query: append(openAPIDocumentQuery, openAPIDocumentLockHeader), status: http.StatusCreated, response: api.DocumentResponse{}},
+	"GetDocumentDiff":     {summary: "Get the diff between two versions", tag: "documents", query: []openapi.Parameter{openAPIQuery("from", "integer", "The version to diff from."), openAPIQuery("to", "integer", "The version to diff to.")}, response: api.DiffResponse{}},
+	"GetDocumentArchive":  {summary: "Download the files of a document (version) as archive", tag: "documents", query: []openapi.Parameter{openAPIQuery("format", "string", "zip or tar.gz.")}, contentType: "application/octet-stream"},
+	"GetDocumentSummary":  {summary: "Get the summary of a document (version)", tag: "documents", response: SummaryResponse{}},
+	"PutDocumentStyle":    {summary: "Set the suggested style of a document", tag: "documents", request: api.DocumentStyleRequest{}, response: DocumentStyleResponse{}},
+	"GetDocumentTags":     {summary: "Get the tags of a document", tag: "documents", response: DocumentTagsResponse{}},
+	"PutDocumentTags":     {summary: "Set the tags of a document", tag: "documents", request: DocumentTagsRequest{}, response: DocumentTagsResponse{}},
+	"GetDocumentLock":     {summary: "Get the lock of a document", tag: "documents", response: api.LockResponse{}},
+	"PostDocumentLock":    {summary: "Lock, renew or steal the lock of a document", tag: "documents", request: api.LockRequest{}, query: []openapi.Parameter{openAPIDocumentLockHeader}, response: api.LockResponse{}},
+	"DeleteDocumentLock":  {summary: "Release the lock of a document", tag: "documents", query: []openapi.Parameter{openAPIDocumentLockHeader}},
+	"GetDocumentMerge":    {summary: "Preview the merge of a fork", tag: "forks", response: ResponseMerge{}},
+	"PostDocumentMerge":   {summary: "Merge a fork into its parent", tag: "forks", query: []openapi.Parameter{openAPIDocumentLockHeader}, response: api.DocumentResponse{}},
+
+	"DocumentVersions": {summary: "List the versions of a document", tag: "versions", query: []openapi.Parameter{openAPIQuery("withContent", "boolean", "Whether the content of the files is included.")}, response: []api.DocumentResponse{}},
+
+	"GetDocumentFile":             {summary: "Get a document (version) file", tag: "files", query: []openapi.Parameter{openAPIFormatterQuery, openAPIStyleQuery, openAPILanguageQuery}, response: api.ResponseFile{}},
+	"GetDocumentFileLogs":         {summary: "Get a document (version) file as logs", tag: "files", response: ResponseLogs{}},
+	"GetDocumentFileSearch":       {summary: "Search a document (version) file", tag: "files", query: []openapi.Parameter{openAPIQuery("q", "string", "The search query.")}, response: ResponseSearch{}},
+	"GetDocumentFileOutline":      {summary: "Get the outline of a document (version) file", tag: "files", response: ResponseOutline{}},
+	"GetDocumentFileBlame":        {summary: "Get the blame of a document (version) file", tag: "files", response: ResponseBlame{}},
+	"GetDocumentFileTail":         {summary: "Tail a document (version) file", tag: "files", query: []openapi.Parameter{openAPIQuery("lines", "integer", "How many lines to return."), openAPIQuery("follow", "boolean", "Stream appended lines.")}, contentType: ezhttp.ContentTypeText},
+	"GetDocumentFileSignature":    {summary: "Get the signature of a document (version) file", tag: "files", response: api.FileSignatureResponse{}},
+	"PutDocumentFileSignature":    {summary: "Sign a document (version) file", tag: "files", request: FileSignatureRequest{}, response: api.FileSignatureResponse{}},
+	"DeleteDocumentFileSignature": {summary: "Delete the signature of a document (version) file", tag: "files"},
+	"GetRawDocument":              {summary: "Get the raw content of a document (version)", tag: "raw", contentType: ezhttp.ContentTypeText},
+	"GetRawDocumentFile":          {summary: "Get the raw content of a document (version) file", tag: "raw", contentType: ezhttp.ContentTypeText},
+
+	"PostDocumentShare":     {summary: "Create a share token for a document", tag: "share", request: api.ShareRequest{}, response: api.ShareResponse{}},
+	"DeleteDocumentShare":   {summary: "Revoke a share token of a document", tag: "share"},
+	"GetDocumentInvites":    {summary: "List the invites of a document", tag: "share", response: api.InvitesResponse{}},
+	"PostDocumentInvite":    {summary: "Create an invite for a document", tag: "share", request: api.InviteCreateRequest{}, status: http.StatusCreated, response: api.InviteResponse{}},
+	"DeleteDocumentInvite":  {summary: "Delete an invite of a document", tag: "share"},
+	"GetDocumentMembers":    {summary: "List the members of a document", tag: "share", response: api.MembersResponse{}},
+	"DeleteDocumentMember":  {summary: "Remove a member of a document", tag: "share"},
+	"GetInvite":             {summary: "Get an invite", tag: "share", response: api.InviteResponse{}},
+	"PostInviteAccept":      {summary: "Accept an invite", tag: "share", response: api.InviteAcceptResponse{}},
+	"PostReadToken":         {summary: "Create a read token for several documents", tag: "share", request: api.ReadTokenRequest{}, status: http.StatusCreated, response: api.ReadTokenResponse{}},
+	"GetReadTokenDocuments": {summary: "Get the documents of a read token", tag: "share", response: []api.DocumentResponse{}},
+
+	"PutDocumentProtection":       {summary: "Protect a document", tag: "reviews", request: ProtectionRequest{}, response: ProtectionResponse{}},
+	"GetDocumentRevisions":        {summary: "List the revisions of a protected document", tag: "reviews", response: RevisionsResponse{}},
+	"GetDocumentRevision":         {summary: "Get a revision of a protected document", tag: "reviews", response: api.RevisionResponse{}},
+	"PostDocumentRevisionApprove": {summary: "Approve a revision", tag: "reviews", query: []openapi.Parameter{openAPIDocumentLockHeader}, response: api.DocumentResponse{}},
+	"PostDocumentRevisionReject":  {summary: "Reject a revision", tag: "reviews"},
+
+	"GetDocumentWebhooks":           {summary: "List the webhooks of a document", tag: "webhooks", response: WebhooksResponse{}},
+	"PostDocumentWebhook":           {summary: "Create a webhook for a document", tag: "webhooks", request: api.WebhookCreateRequest{}, response: api.WebhookResponse{}},
+	"GetDocumentWebhook":            {summary: "Get a webhook of a document", tag: "webhooks", response: api.WebhookResponse{}},
+	"PatchDocumentWebhook":          {summary: "Update a webhook of a document", tag: "webhooks", request: api.WebhookUpdateRequest{}, response: api.WebhookResponse{}},
+	"DeleteDocumentWebhook":         {summary: "Delete a webhook of a document", tag: "webhooks"},
+	"GetDocumentWebhookDeliveries":  {summary: "List the deliveries of a webhook", tag: "webhooks", response: api.WebhookDeliveriesResponse{}},
+	"PostDocumentWebhookRedelivery": {summary: "Redeliver a webhook delivery", tag: "webhooks", status: http.StatusAccepted, response: api.WebhookDeliveryResponse{}},
+	"GetAccountWebhooks":            {summary: "List the webhooks of the account", tag: "webhooks", response: WebhooksResponse{}},
+	"PostAccountWebhook":            {summary: "Create a webhook for the account", tag: "webhooks", request: api.WebhookCreateRequest{}, response: api.WebhookResponse{}},
+	"GetAccountWebhook":             {summary: "Get a webhook of the account", tag: "webhooks", response: api.WebhookResponse{}},
+	"PatchAccountWebhook":           {summary: "Update a webhook of the account", tag: "webhooks", request: api.WebhookUpdateRequest{}, response: api.WebhookResponse{}},
+	"DeleteAccountWebhook":          {summary: "Delete a webhook of the account", tag: "webhooks"},
+
+	"GetEvents":              {summary: "List the events of the token", tag: "events", response: EventsResponse{}},
+	"GetDocumentEventStream": {summary: "Stream the live updates of a document", tag: "events", contentType: "text/event-stream"},
+
+	"GetRecentDocuments":   {summary: "List the recently created documents", tag: "recent", response: RecentDocumentsResponse{}},
+	"DeleteRecentDocument": {summary: "Remove a document from the recent documents", tag: "recent"},
+
+	"GetUserSettings":       {summary: "Get the user settings", tag: "user", response: api.UserSettingsResponse{}},
+	"PutUserSettings":       {summary: "Update the user settings", tag: "user", request: api.UserSettingsRequest{}, response: api.UserSettingsResponse{}},
+	"DeleteUserSettings":    {summary: "Delete the user settings", tag: "user"},
+	"PostUserToken":         {summary: "Create a user token", tag: "user", response: api.UserTokenResponse{}},
+	"GetAccount":            {summary: "Get the logged-in account", tag: "user", response: AccountResponse{}},
+	"GetAccountSessions":    {summary: "List the sessions and tokens of the account", tag: "user", response: AccountSessionsResponse{}},
+	"DeleteAccountSessions": {summary: "Revoke all other sessions and tokens of the account", tag: "user"},
+	"DeleteAccountSession":  {summary: "Revoke a session or token of the account", tag: "user"},
+
+	"GetTwoFactor":              {summary: "Get the second factors of the account", tag: "user", response: TwoFactorResponse{}},
+	"PostTOTP":                  {summary: "Start to set up an authenticator app", tag: "user", response: TOTPResponse{}},
+	"PostTOTPConfirm":           {summary: "Confirm the authenticator app with a code", tag: "user", request: TOTPConfirmRequest{}, response: TwoFactorSetupResponse{}},
+	"DeleteTOTP":                {summary: "Remove the authenticator app", tag: "user"},
+	"PostRecoveryCodes":         {summary: "Replace the recovery codes", tag: "user", response: RecoveryCodesResponse{}},
+	"PostPasskeyOptions":        {summary: "Get the challenge to register a passkey", tag: "user", response: PasskeyOptionsResponse{}},
+	"PostPasskey":               {summary: "Register a passkey", tag: "user", request: PasskeyRequest{}, response: TwoFactorSetupResponse{}},
+	"DeletePasskey":             {summary: "Remove a passkey", tag: "user"},
+	"PostTwoFactorLoginOptions": {summary: "Get the challenge to confirm a login with a passkey", tag: "user", response: PasskeyOptionsResponse{}},
+	"PostTwoFactorLogin":        {summary: "Confirm a login with a second factor", tag: "user", request: TwoFactorLoginRequest{}, response: TwoFactorLoginResponse{}},
+
+	"PostDeviceCode":    {summary: "Start a device authorization", tag: "device", request: api.DeviceCodeRequest{}, response: api.DeviceCodeResponse{}},
+	"PostDeviceToken":   {summary: "Poll the tokens of a device authorization", tag: "device", request: api.DeviceTokenRequest{}, response: api.DeviceTokenResponse{}},
+	"PostDeviceApprove": {summary: "Approve a device authorization", tag: "device", request: DeviceApproveRequest{}},
+	"PostDeviceDeny":    {summary: "Deny a device authorization", tag: "device", request: DeviceDenyRequest{}},
+}
+
+// newOpenAPIDocument generates the OpenAPI document of the API routes of the router.
+func (s *Server) newOpenAPIDocument(r chi.Routes) ([]byte, error) {
+	document := openapi.New(openapi.Info{
+		Title:       "gobin",
+		Description: "gobin is a simple lightweight haste-server alternative written in Go.",
+		Version:     s.version.Version,
+	})
+	document.Components.SecuritySchemes["bearer"] = openapi.SecurityScheme{
+		Type:         "http",
+		Scheme:       "bearer",
+		BearerFormat: "JWT",
+		Description:  "The token of a document, a share token, a read token or a user token.",
+	}
+	// an empty requirement makes the token optional
+	document.Security = []map[string][]string{{}, {"bearer": {}}}
+	errorSchema := document.Schema(api.ErrorResponse{})
+
+	operationIDs := make(map[string]int)
+	if err := chi.Walk(r, func(method string, route string, handler http.Handler, _ ...func(http.Handler) http.Handler) error {
+		name := handlerName(handler)
+		operation, ok := openAPIOperations[name]
+		if !ok || strings.Contains(route, "*") {
+			return nil
+		}
+
+		path := route
+		if len(path) > 1 {
+			path = strings.TrimSuffix(path, "/")
+		}
+		path = openAPIPathParamRegex.ReplaceAllString(path, "{$1}")
+
+		// handlers with several routes get a number from their second route on, operation ids have to be unique
+		operationID := name
+		operationIDs[name]++
+		if n := operationIDs[name]; n > 1 {
+			operationID += strconv.Itoa(n)
+		}
+
+		op := &openapi.Operation{
+			OperationID: operationID,
+			Summary:     operation.summary,
+			Tags:        []string{operation.tag},
+			Responses: map[string]openapi.Response{
+				"default": {
+					Description: "An error",
+					Content:     map[string]openapi.MediaType{ezhttp.ContentTypeJSON: {Schema: errorSchema}},
+				},
+			},
+		}
+		for _, match := range openAPIPathParamRegex.FindAllStringSubmatch(route, -1) {
+			op.Parameters = append(op.Parameters, openapi.Parameter{
+				Name:     match[1],
+				In:       "path",
+				Required: true,
+				Schema:   &openapi.Schema{Type: "string"},
+			})
+		}
+		op.Parameters = append(op.Parameters, operation.query...)
+
+		switch {
+		case operation.documentBody:
+			op.RequestBody = &openapi.RequestBody{
+				Description: "The content of a single file or the files of a multipart/form-data body.",
+				Required:    true,
+				Content: map[string]openapi.MediaType{
+					"*/*":                 {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+					"multipart/form-data": {Schema: &openapi.Schema{Type: "object", AdditionalProperties: &openapi.Schema{Type: "string", Format: "binary"}}},
+				},
+			}
+		case operation.request != nil:
+			op.RequestBody = &openapi.RequestBody{
+				Required: true,
+				Content:  map[string]openapi.MediaType{ezhttp.ContentTypeJSON: {Schema: document.Schema(operation.request)}},
+			}
+		}
+
+		status := operation.status
+		switch {
+		case operation.response != nil:
+			if status == 0 {
+				status = http.StatusOK
+			}
+			op.Responses[strconv.Itoa(status)] = openapi.Response{
+				Description: http.StatusText(status),
+				Content:     map[string]openapi.MediaType{ezhttp.ContentTypeJSON: {Schema: document.Schema(operation.response)}},
+			}
+		case operation.contentType != "":
+			if status == 0 {
+				status = http.StatusOK
+			}
+			op.Responses[strconv.Itoa(status)] = openapi.Response{
+				Description: http.StatusText(status),
+				Content:     map[string]openapi.MediaType{operation.contentType: {Schema: &openapi.Schema{Type: "string"}}},
+			}
+		default:
+			if status == 0 {
+				status = http.StatusNoContent
+			}
+			op.Responses[strconv.Itoa(status)] = openapi.Response{Description: http.StatusText(status)}
+		}
+
+		document.Add(method, path, op)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to walk routes: %w", err)
+	}
+
+	return json.Marshal(document)
+}
+
+// handlerName returns the name of the method of the server which handles the route.
+func handlerName(handler http.Handler) string {
+	name := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// GetOpenAPI returns the OpenAPI document of the API.
+func (s *Server) GetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if s.openAPI == nil {
+		s.error(w, r, httperr.NotFound(ErrOpenAPIDisabled))
+		return
+	}
+	w.Header().Set(ezhttp.HeaderContentType, ezhttp.ContentTypeJSON)
+	w.Header().Set(ezhttp.HeaderContentLength, strconv.Itoa(len(s.openAPI)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write(s.openAPI)
+}
+
+// GetOpenAPIDocs shows the OpenAPI document with Swagger UI, which is loaded from its CDN.
+func (s *Server) GetOpenAPIDocs(w http.ResponseWriter, r *http.Request) {
+	if s.openAPI == nil || !s.cfg.OpenAPI.SwaggerUI {
+		s.prettyError(w, r, httperr.NotFound(ErrOpenAPIDisabled))
+		return
+	}
+	w.Header().Set(ezhttp.HeaderContentType, "text/html; charset=utf-8")
+	_, _ = fmt.Fprintf(w, swaggerUIPage, s.cfg.OpenAPI.SwaggerUIURL, s.cfg.OpenAPI.SwaggerUIURL)
+}
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8"/>
+	<title>gobin - API</title>
+	<meta name="viewport" content="width=device-width, initial-scale=1"/>
+	<link rel="stylesheet" href="%[1]s/swagger-ui.css"/>
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="%[2]s/swagger-ui-bundle.js"></script>
+<script>
+	window.ui = SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/topi314/chroma/v2/lexers"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/internal/outline"
+)
+
+type ResponseOutline struct {
+	Name      string           `json:"name"`
+	Language  string           `json:"language"`
+	Supported bool             `json:"supported"`
+	Symbols   []outline.Symbol `json:"symbols"`
+}
+
+// GetDocumentFileOutline returns the functions, types or headings of a file for the outline sidebar.
+func (s *Server) GetDocumentFileOutline(w http.ResponseWriter, r *http.Request) {
+	file, err := s.getDocumentFile(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if file.Encrypted {
+		s.error(w, r, httperr.BadRequest(ErrFileEncrypted))
+		return
+	}
+
+	language := file.Language
+	if queryLanguage := r.URL.Query().Get("language"); queryLanguage != "" {
+		language = queryLanguage
+	}
+	lexer := lexers.Get(language)
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	language = lexer.Config().Name
+
+	_, span := s.tracer.Start(r.Context(), "parseOutline", trace.WithAttributes(
+		attribute.String("document_id", file.DocumentID),
+		attribute.String("file_name", file.Name),
+		attribute.String("language", language),
+	))
+	symbols := outline.Parse(language, file.Content)
+	span.SetAttributes(attribute.Int("symbols", len(symbols)))
+	span.End()
+
+	s.ok(w, r, ResponseOutline{
+		Name:      file.Name,
+		Language:  language,
+		Supported: outline.Supported(language),
+		Symbols:   symbols,
+	})
+}
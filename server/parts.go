@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/flags"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+var (
+	ErrDocumentIsPart    = errors.New("document is a part itself, add parts to its index document instead")
+	ErrDocumentHasNoPart = errors.New("document has no parts")
+)
+
+// PostDocumentPart creates a new document as the next part of the document, like PostDocument. Clients split content
+// which is larger than the max document size into parts, the first part is a normal document and the index of the
+// others. Creating a part needs the write permission of the index, the response has a token of the new part.
+func (s *Server) PostDocumentPart(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+	if flags.Misses(GetClaims(r).Permissions, PermissionWrite) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+		return
+	}
+
+	versions, err := s.db.GetVersionCount(r.Context(), documentID)
+	if err != nil {
+		s.error(w, r, fmt.Errorf("failed to get document versions: %w", err))
+		return
+	}
+	if versions == 0 {
+		s.error(w, r, httperr.NotFound(ErrDocumentNotFound))
+		return
+	}
+	if _, err = s.db.GetDocumentPart(r.Context(), documentID); err == nil {
+		s.error(w, r, httperr.BadRequest(ErrDocumentIsPart))
+		return
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		s.error(w, r, err)
+		return
+	}
+
+	// parts are numbered in the order they are created
+	unlock := s.updateLocks.lock(documentID)
+	defer unlock()
+	if err = s.checkDocumentLock(r.Context(), documentID, r.Header.Get(ezhttp.HeaderDocumentLock)); err != nil {
+		s.error(w, r, err)
+		return
+	}
+	s.createDocument(w, r, "", documentID, s.parseDocumentFiles)
+}
+
+// GetDocumentParts returns the parts of the index document or of the index the document is a part of.
+func (s *Server) GetDocumentParts(w http.ResponseWriter, r *http.Request) {
+	parts, err := s.getDocumentParts(r.Context(), chi.URLParam(r, "documentID"))
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if parts == nil {
+		s.error(w, r, httperr.NotFound(ErrDocumentHasNoPart))
+		return
+	}
+	s.ok(w, r, parts)
+}
+
+// getDocumentParts returns the parts the document belongs to or nil if its content wasn't split into parts.
+func (s *Server) getDocumentParts(ctx context.Context, documentID string) (*api.PartsResponse, error) {
+	indexID := documentID
+	part, err := s.db.GetDocumentPart(ctx, documentID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if part != nil {
+		indexID = part.IndexID
+	}
+
+	parts, err := s.db.GetDocumentParts(ctx, indexID)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) == 0 {
+		return nil, nil
+	}
+
+	rs := api.PartsResponse{
+		Index: indexID,
+		Parts: []string{indexID},
+	}
+	for _, p := range parts {
+		rs.Parts = append(rs.Parts, p.DocumentID)
+	}
+	return &rs, nil
+}
+
+// addDocumentPart adds the new document as the last part of the index. The caller has to hold the update lock of the
+// index.
+func (s *Server) addDocumentPart(ctx context.Context, indexID string, documentID string) error {
+	parts, err := s.db.GetDocumentParts(ctx, indexID)
+	if err != nil {
+		return err
+	}
+	// the index is part 1
+	partIndex := 2
+	if len(parts) > 0 {
+		partIndex = parts[len(parts)-1].PartIndex + 1
+	}
+	return s.db.CreateDocumentPart(ctx, database.DocumentPart{
+		DocumentID: documentID,
+		IndexID:    indexID,
+		PartIndex:  partIndex,
+	})
+}
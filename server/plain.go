@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+)
+
+// acceptQualities returns the highest quality of text/plain and html in the Accept header, 0 if they aren't accepted.
+// Wildcards are ignored.
+func acceptQualities(accept string) (float64, float64) {
+	var plainQuality, htmlQuality float64
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "text/plain":
+			plainQuality = max(plainQuality, quality)
+		case "text/html", "application/xhtml+xml":
+			htmlQuality = max(htmlQuality, quality)
+		}
+	}
+	return plainQuality, htmlQuality
+}
+
+// acceptsPlainText returns whether the Accept header prefers text/plain over html. Wildcards are ignored, so clients
+// which accept everything like curl get html unless they are recognized by their user agent.
+func acceptsPlainText(accept string) bool {
+	plainQuality, htmlQuality := acceptQualities(accept)
+	return plainQuality > 0 && plainQuality > htmlQuality
+}
+
+// acceptsHTML returns whether the Accept header explicitly accepts html, like navigations of browsers.
+func acceptsHTML(accept string) bool {
+	_, htmlQuality := acceptQualities(accept)
+	return htmlQuality > 0
+}
+
+// prefersPlainText returns whether the request for the html of a document should get the plain content instead. The
+// user agent is classified even if user agents are disabled, so curl https://xgob.in/{key} works without config.
+func (s *Server) prefersPlainText(r *http.Request) bool {
+	if acceptsPlainText(r.Header.Get(ezhttp.HeaderAccept)) {
+		return true
+	}
+	return s.cfg.UserAgents.RawForCLI && s.classifyUserAgent(r.Header.Get(ezhttp.HeaderUserAgent)) == UserAgentClassCLI
+}
+
+// getPlainDocument writes the content of the document as plain text. The files of documents with multiple files are
+// concatenated with a "==> name <==" line before each file like tail does.
+func (s *Server) getPlainDocument(w http.ResponseWriter, r *http.Request) {
+	document, err := s.getDocument(r, nil)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if checkNotModified(w, r, s.documentETag(r, document.Files, "plain"), documentModTime(document.Files)) {
+		return
+	}
+
+	var sb strings.Builder
+	if len(document.Files) == 1 {
+		sb.WriteString(document.Files[0].Content)
+	} else {
+		for i, file := range document.Files {
+			if i > 0 {
+				sb.WriteString("\n")
+			}
+			sb.WriteString("==> " + file.Name + " <==\n")
+			sb.WriteString(file.Content)
+			if !strings.HasSuffix(file.Content, "\n") {
+				sb.WriteString("\n")
+			}
+		}
+	}
+
+	w.Header().Set(ezhttp.HeaderContentType, ezhttp.ContentTypeText)
+	if _, err = w.Write([]byte(sb.String())); err != nil {
+		s.error(w, r, err)
+	}
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+var (
+	ErrPluginOutputTooLarge = errors.New("plugin output too large")
+	ErrPluginFailed         = func(name string, exitCode uint32, stderr string) error {
+		return fmt.Errorf("plugin %s exited with code %d: %s", name, exitCode, stderr)
+	}
+)
+
+// LoadPlugins compiles all configured WASM plugins. Plugins are WASI command modules which receive the file content on
+// stdin, the file name and language as arguments and write the transformed content to stdout.
+func LoadPlugins(ctx context.Context, cfg PluginsConfig) (*Plugins, error) {
+	if !cfg.Enabled || len(cfg.Renderers) == 0 {
+		return nil, nil
+	}
+
+	runtimeCfg := wazero.NewRuntimeConfig().WithCloseOnContextDone(true)
+	if cfg.MaxMemory > 0 {
+		// one wasm page is 64KiB
+		runtimeCfg = runtimeCfg.WithMemoryLimitPages(uint32(cfg.MaxMemory * 16))
+	}
+	runtime := wazero.NewRuntimeWithConfig(ctx, runtimeCfg)
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		_ = runtime.Close(ctx)
+		return nil, fmt.Errorf("failed to instantiate wasi: %w", err)
+	}
+
+	plugins := &Plugins{
+		cfg:       cfg,
+		runtime:   runtime,
+		renderers: make(map[string]*plugin),
+	}
+	for _, renderer := range cfg.Renderers {
+		wasm, err := os.ReadFile(renderer.Path)
+		if err != nil {
+			_ = runtime.Close(ctx)
+			return nil, fmt.Errorf("failed to read plugin %s: %w", renderer.Name, err)
+		}
+
+		module, err := runtime.CompileModule(ctx, wasm)
+		if err != nil {
+			_ = runtime.Close(ctx)
+			return nil, fmt.Errorf("failed to compile plugin %s: %w", renderer.Name, err)
+		}
+
+		p := &plugin{
+			name:           renderer.Name,
+			module:         module,
+			files:          renderer.Files,
+			outputLanguage: renderer.OutputLanguage,
+		}
+		for _, language := range renderer.Languages {
+			plugins.renderers[strings.ToLower(language)] = p
+		}
+		if len(renderer.Files) > 0 {
+			plugins.fileRenderers = append(plugins.fileRenderers, p)
+		}
+		slog.Debug("Loaded plugin", slog.String("name", renderer.Name), slog.Any("languages", renderer.Languages))
+	}
+
+	return plugins, nil
+}
+
+type Plugins struct {
+	cfg           PluginsConfig
+	runtime       wazero.Runtime
+	renderers     map[string]*plugin
+	fileRenderers []*plugin
+}
+
+type plugin struct {
+	name           string
+	module         wazero.CompiledModule
+	files          []string
+	outputLanguage string
+}
+
+func (p *Plugins) renderer(file database.File) *plugin {
+	if renderer, ok := p.renderers[strings.ToLower(file.Language)]; ok {
+		return renderer
+	}
+	for _, renderer := range p.fileRenderers {
+		for _, pattern := range renderer.files {
+			if ok, _ := path.Match(pattern, file.Name); ok {
+				return renderer
+			}
+		}
+	}
+	return nil
+}
+
+// Render runs the renderer plugin registered for the language or name of the file and returns the transformed file.
+// Files without a registered renderer are returned unchanged.
+func (p *Plugins) Render(ctx context.Context, tracer trace.Tracer, file database.File) (database.File, error) {
+	if p == nil {
+		return file, nil
+	}
+	renderer := p.renderer(file)
+	if renderer == nil {
+		return file, nil
+	}
+
+	ctx, span := tracer.Start(ctx, "renderPlugin", trace.WithAttributes(
+		attribute.String("plugin", renderer.name),
+		attribute.String("language", file.Language),
+	))
+	defer span.End()
+
+	if p.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(p.cfg.Timeout))
+		defer cancel()
+	}
+
+	stdout := &limitedBuffer{max: p.cfg.MaxOutputSize}
+	stderr := &limitedBuffer{max: 4096}
+	module, err := p.runtime.InstantiateModule(ctx, renderer.module, wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(renderer.name, file.Name, file.Language).
+		WithStdin(strings.NewReader(file.Content)).
+		WithStdout(stdout).
+		WithStderr(stderr),
+	)
+	if module != nil {
+		_ = module.Close(ctx)
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to run plugin")
+		span.RecordError(err)
+		var exitErr *sys.ExitError
+		if errors.As(err, &exitErr) {
+			return file, ErrPluginFailed(renderer.name, exitErr.ExitCode(), strings.TrimSpace(stderr.String()))
+		}
+		return file, fmt.Errorf("failed to run plugin %s: %w", renderer.name, err)
+	}
+	if stdout.exceeded {
+		return file, ErrPluginOutputTooLarge
+	}
+
+	file.Content = stdout.String()
+	if renderer.outputLanguage != "" {
+		file.Language = renderer.outputLanguage
+	}
+	return file, nil
+}
+
+func (p *Plugins) Close(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	return p.runtime.Close(ctx)
+}
+
+// limitedBuffer discards everything written after max bytes, max <= 0 disables the limit.
+type limitedBuffer struct {
+	bytes.Buffer
+	max      int64
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.max > 0 && int64(b.Len()+len(p)) > b.max {
+		b.exceeded = true
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/topi314/chroma/v2"
+	"github.com/topi314/chroma/v2/styles"
+
+	"github.com/topi314/gobin/v3/server/database"
+	"github.com/topi314/gobin/v3/server/storage"
+	"github.com/topi314/gobin/v3/server/templates"
+)
+
+// publishNameRegex matches the characters which are replaced in the names of published files.
+var publishNameRegex = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// PublishOptions are used when publishing a document.
+type PublishOptions struct {
+	// AllVersions publishes every version instead of only the latest one.
+	AllVersions bool
+	// Style is used for the highlighting, it defaults to the style of the document or the default style.
+	Style string
+}
+
+// publishVersion is a version of a published document, the latest version is published at the root of the document.
+type publishVersion struct {
+	version int64
+	dir     string
+}
+
+// Publish renders the document into static pages for hosting it outside of gobin, for example on S3 or GitHub Pages. The
+// latest version is written to {key}/index.html with a page and a raw file for each file, older versions to
+// {key}/versions/{version}/.
+func (s *Server) Publish(ctx context.Context, documentID string, opts PublishOptions, publisher storage.Publisher) error {
+	versions, err := s.db.GetDocumentVersions(ctx, documentID)
+	if err != nil {
+		return fmt.Errorf("failed to get document versions: %w", err)
+	}
+	if len(versions) == 0 {
+		return ErrDocumentNotFound
+	}
+	if !opts.AllVersions {
+		versions = versions[:1]
+	}
+
+	style, err := s.publishStyle(ctx, documentID, opts.Style)
+	if err != nil {
+		return err
+	}
+	publishCSS, err := fs.ReadFile(s.assets, "publish.css")
+	if err != nil {
+		return fmt.Errorf("failed to read publish css: %w", err)
+	}
+	css := append(publishCSS, s.themeCSS(style)...)
+	if err = publisher.Publish(ctx, documentID+"/style.css", "text/css; charset=utf-8", css); err != nil {
+		return fmt.Errorf("failed to publish style: %w", err)
+	}
+
+	publishVersions := make([]publishVersion, len(versions))
+	for i, version := range versions {
+		publishVersions[i] = publishVersion{version: version}
+		if i > 0 {
+			publishVersions[i].dir = "versions/" + strconv.FormatInt(version, 10) + "/"
+		}
+	}
+
+	for i, version := range publishVersions {
+		files, err := s.db.GetDocumentVersion(ctx, documentID, version.version)
+		if err != nil {
+			return fmt.Errorf("failed to get document version %d: %w", version.version, err)
+		}
+		if len(files) == 0 {
+			continue
+		}
+		if err = s.publishVersion(ctx, documentID, publishVersions, i, files, style, publisher); err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "Published document version", slog.String("document_id", documentID), slog.Int64("version", version.version))
+	}
+	return nil
+}
+
+func (s *Server) publishStyle(ctx context.Context, documentID string, styleName string) (*chroma.Style, error) {
+	if styleName == "" {
+		var err error
+		if styleName, err = s.db.GetDocumentStyle(ctx, documentID); err != nil {
+			return nil, fmt.Errorf("failed to get document style: %w", err)
+		}
+	}
+	if styleName == "" {
+		styleName = s.cfg.DefaultStyle
+	}
+	return styles.Get(styleName), nil
+}
+
+// publishVersion writes the raw files and a page for each file of the version, the first file is also the index page.
+func (s *Server) publishVersion(ctx context.Context, documentID string, versions []publishVersion, current int, files []database.File, style *chroma.Style, publisher storage.Publisher) error {
+	versionDir := documentID + "/" + versions[current].dir
+
+	publishFiles := make([]templates.PublishFile, len(files))
+	for i, file := range files {
+		formatted, err := s.formatFile(ctx, file, s.htmlFormatter, style)
+		if err != nil {
+			return fmt.Errorf("failed to format file %s: %w", file.Name, err)
+		}
+		name := publishNameRegex.ReplaceAllString(file.Name, "_")
+		publishFiles[i] = templates.PublishFile{
+			Name:      file.Name,
+			Language:  file.Language,
+			Formatted: formatted,
+			Encrypted: file.Encrypted,
+			URL:       "files/" + name + ".html",
+			RawURL:    "raw/" + name,
+		}
+		if err = publisher.Publish(ctx, versionDir+publishFiles[i].RawURL, "text/plain; charset=utf-8", []byte(file.Content)); err != nil {
+			return fmt.Errorf("failed to publish raw file %s: %w", file.Name, err)
+		}
+	}
+
+	// the index page is in the version directory and the file pages are in its files directory
+	if err := s.publishPage(ctx, documentID, versions, current, publishFiles, "", 0, style, publisher); err != nil {
+		return err
+	}
+	for i := range publishFiles {
+		if err := s.publishPage(ctx, documentID, versions, current, publishFiles, "files/", i, style, publisher); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) publishPage(ctx context.Context, documentID string, versions []publishVersion, current int, files []templates.PublishFile, pageDir string, currentFile int, style *chroma.Style, publisher storage.Publisher) error {
+	// the relative path from the page to the root of the document
+	root := relativeRoot(versions[current].dir + pageDir)
+	toVersion := relativeRoot(pageDir)
+
+	pageFiles := make([]templates.PublishFile, len(files))
+	for i, file := range files {
+		file.URL = toVersion + file.URL
+		file.RawURL = toVersion + file.RawURL
+		pageFiles[i] = file
+	}
+
+	pageVersions := make([]templates.PublishVersion, len(versions))
+	for i, version := range versions {
+		label := time.UnixMilli(version.version).Format(VersionTimeFormat)
+		if i == 0 {
+			label += " (latest)"
+		}
+		pageVersions[i] = templates.PublishVersion{
+			Label:   label,
+			URL:     root + version.dir + "index.html",
+			Current: i == current,
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := templates.Publish(templates.PublishVars{
+		Key:          documentID,
+		VersionLabel: pageVersions[current].Label,
+		Files:        pageFiles,
+		CurrentFile:  currentFile,
+		Versions:     pageVersions,
+		StyleURL:     root + "style.css",
+		Theme:        style.Theme,
+	}).Render(ctx, buf); err != nil {
+		return fmt.Errorf("failed to render page: %w", err)
+	}
+
+	name := "index.html"
+	if pageDir != "" {
+		name = files[currentFile].URL
+	}
+	if err := publisher.Publish(ctx, path.Join(documentID, versions[current].dir, name), "text/html; charset=utf-8", buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to publish page %s: %w", name, err)
+	}
+	return nil
+}
+
+// relativeRoot returns the relative path which leads from the slash terminated directory back to its root.
+func relativeRoot(dir string) string {
+	return strings.Repeat("../", strings.Count(dir, "/"))
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/go-chi/chi/v5"
+
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/internal/httprate"
+)
+
+const maxUnix = int(^int32(0)) * 1000
+
+// rateLimitPolicy is a group of routes with its own rate limit.
+type rateLimitPolicy string
+
+const (
+	rateLimitPolicyCreate   rateLimitPolicy = "create"
+	rateLimitPolicyUpdate   rateLimitPolicy = "update"
+	rateLimitPolicyRaw      rateLimitPolicy = "raw"
+	rateLimitPolicyWebhooks rateLimitPolicy = "webhooks"
+)
+
+// newRateLimiters creates the rate limiters of the policies, they share the buckets of the configured store.
+func (s *Server) newRateLimiters() {
+	cfg := s.cfg.RateLimit
+	if cfg.Store == RateLimitStoreRedis {
+		s.rateLimitStore = httprate.NewRedisStore(httprate.RedisConfig{
+			Address:  cfg.Redis.Address,
+			Username: cfg.Redis.Username,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+			Prefix:   "gobin:rate_limit:",
+		})
+	} else {
+		s.rateLimitStore = httprate.NewMemoryStore()
+	}
+
+	onRequestLimit := func(w http.ResponseWriter, r *http.Request) {
+		s.error(w, r, httperr.TooManyRequests(ErrRateLimit))
+	}
+	newRateLimiter := func(name string, requests int, duration time.Duration, keyFunc httprate.KeyFunc) func(http.Handler) http.Handler {
+		return httprate.NewRateLimiter(s.rateLimitStore, name, requests, duration, keyFunc, onRequestLimit).Handler
+	}
+
+	// the default rate limit is separate for each path like before the policies were added
+	s.rateLimitHandler = newRateLimiter("default", cfg.Requests, time.Duration(cfg.Duration), func(r *http.Request) string {
+		return rateLimitKey(r) + ":" + r.URL.Path
+	})
+	s.readTokenRateLimitHandler = newRateLimiter("read_token", cfg.ReadTokenRequests, time.Duration(cfg.ReadTokenDuration), rateLimitKey)
+
+	s.rateLimitPolicies = make(map[rateLimitPolicy]func(http.Handler) http.Handler)
+	for name, policy := range map[rateLimitPolicy]RateLimitPolicy{
+		rateLimitPolicyCreate:   cfg.Create,
+		rateLimitPolicyUpdate:   cfg.Update,
+		rateLimitPolicyRaw:      cfg.Raw,
+		rateLimitPolicyWebhooks: cfg.Webhooks,
+	} {
+		if policy.Requests <= 0 {
+			// raw fetches are reads, so they are only limited if it is configured
+			if name == rateLimitPolicyRaw {
+				continue
+			}
+			policy = RateLimitPolicy{
+				Requests: cfg.Requests,
+				Duration: cfg.Duration,
+			}
+		}
+		if policy.Duration <= 0 {
+			policy.Duration = cfg.Duration
+		}
+		s.rateLimitPolicies[name] = newRateLimiter(string(name), policy.Requests, time.Duration(policy.Duration), rateLimitKey)
+	}
+}
+
+// rateLimitKey returns the bucket key of the caller. Requests with a token are limited per token, so clients behind
+// the same IP don't share their limit. The RateLimit middleware runs after the JWTMiddleware, so the token is valid.
+func rateLimitKey(r *http.Request) string {
+	if token := requestToken(r); token != "" {
+		return "token:" + strconv.FormatUint(xxhash.Sum64String(token), 16)
+	}
+	return "ip:" + httprate.KeyByIP(r)
+}
+
+// findRateLimitPolicy returns the policy of the route of the request. Requests outside the policies use the default
+// rate limit if they change something.
+func findRateLimitPolicy(routes chi.Routes, r *http.Request) (rateLimitPolicy, bool) {
+	method := r.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	// patterns of sub routers end with or without a slash depending on the path of the request
+	pattern := strings.TrimSuffix(routes.Find(chi.NewRouteContext(), method, r.URL.Path), "/") + "/"
+
+	switch {
+	case method == http.MethodPost && pattern == "/documents/",
+		method == http.MethodPut && pattern == "/documents/{documentID}/":
+		return rateLimitPolicyCreate, true
+	case strings.HasPrefix(pattern, "/documents/{documentID}/webhooks/"):
+		return rateLimitPolicyWebhooks, true
+	case strings.HasPrefix(pattern, "/raw/"):
+		return rateLimitPolicyRaw, true
+	case strings.HasPrefix(pattern, "/documents/{documentID}/") && method != http.MethodGet:
+		return rateLimitPolicyUpdate, true
+	}
+	return "", false
+}
+
+// RateLimit limits document creation, updates, raw fetches and webhook management with their policy and other POST,
+// PATCH and DELETE requests with the default rate limit.
+func (s *Server) RateLimit(routes chi.Routes) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			policy, ok := findRateLimitPolicy(routes, r)
+			// Only apply the default rate limit to POST, PATCH, and DELETE requests
+			if !ok && r.Method != http.MethodPost && r.Method != http.MethodPatch && r.Method != http.MethodDelete {
+				next.ServeHTTP(w, r)
+				return
+			}
+			remoteAddr := strings.SplitN(r.RemoteAddr, ":", 2)[0]
+			// Filter whitelisted IPs
+			if slices.Contains(s.cfg.RateLimit.Whitelist, remoteAddr) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			// Filter blacklisted IPs
+			if slices.Contains(s.cfg.RateLimit.Blacklist, remoteAddr) {
+				w.Header().Set(ezhttp.HeaderRateLimitLimit, strconv.Itoa(s.cfg.RateLimit.Requests))
+				w.Header().Set(ezhttp.HeaderRateLimitRemaining, "0")
+				w.Header().Set(ezhttp.HeaderRateLimitReset, strconv.Itoa(maxUnix))
+				w.Header().Set(ezhttp.HeaderRetryAfter, strconv.Itoa(maxUnix-int(time.Now().Unix())))
+				s.error(w, r, httperr.TooManyRequests(ErrRateLimit))
+				return
+			}
+
+			handler := s.rateLimitHandler
+			if ok {
+				handler = s.rateLimitPolicies[policy]
+			}
+			if handler == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			handler(next).ServeHTTP(w, r)
+		})
+	}
+}
+
+// SummaryRateLimit applies the regular rate limit to summary requests since they may call the summary provider.
+func (s *Server) SummaryRateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.rateLimitHandler == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.rateLimitHandler(next).ServeHTTP(w, r)
+	})
+}
+
+// ReadTokenRateLimit limits requests done with read tokens independently of the regular rate limit.
+func (s *Server) ReadTokenRateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.readTokenRateLimitHandler == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.readTokenRateLimitHandler(next).ServeHTTP(w, r)
+	})
+}
+
+// closeRateLimitStore closes the connections of the redis store.
+func (s *Server) closeRateLimitStore() {
+	if store, ok := s.rateLimitStore.(*httprate.RedisStore); ok {
+		store.Close()
+	}
+}
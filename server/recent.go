@@ -0,0 +1,200 @@
+package server
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-jose/go-jose/v3/jwt"
+
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/httperr"
+)
+
+const (
+	ScopeCreator = "creator"
+
+	creatorCookieName   = "creator"
+	creatorCookieMaxAge = 365 * 24 * time.Hour
+)
+
+var (
+	ErrRecentDisabled     = errors.New("recent documents are disabled")
+	ErrNotDocumentCreator = errors.New("document was not created by this browser")
+)
+
+type (
+	RecentDocumentsResponse struct {
+		Documents []RecentDocument `json:"documents"`
+	}
+
+	RecentDocument struct {
+		Key       string    `json:"key"`
+		Version   int64     `json:"version"`
+		Files     []string  `json:"files"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+)
+
+// getCreatorID returns the id of the logged-in account, the anonymous id from a creator token, the signed creator
+// cookie of the browser or an empty string.
+func (s *Server) getCreatorID(r *http.Request) string {
+	if accountID := s.getAccountID(r); accountID != "" {
+		return accountID
+	}
+	if claims := GetClaims(r); claims.Scope == ScopeCreator {
+		return claims.Subject
+	}
+
+	cookie, err := r.Cookie(creatorCookieName)
+	if err != nil {
+		return ""
+	}
+	var claims Claims
+	if err = s.jwtKeys.Verify(cookie.Value, &claims); err != nil || claims.Scope != ScopeCreator {
+		return ""
+	}
+	return claims.Subject
+}
+
+// newCreatorID returns a new anonymous id and sets it as creator cookie of the browser.
+func (s *Server) newCreatorID(w http.ResponseWriter) (string, error) {
+	creatorID := rand.Text()
+	token, err := s.newCreatorToken(creatorID)
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     creatorCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(creatorCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return creatorID, nil
+}
+
+func (s *Server) newCreatorToken(creatorID string) (string, error) {
+	claims := newClaims(creatorID, 0)
+	claims.Scope = ScopeCreator
+	token, err := jwt.Signed(s.signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		return "", fmt.Errorf("failed to create creator token: %w", err)
+	}
+	return token, nil
+}
+
+// fromBrowserUI returns whether the request was sent by the web UI. Browsers mark its fetches as same-origin, which
+// scripts can't fake, and navigations accept html. CLI and API clients send neither.
+func fromBrowserUI(r *http.Request) bool {
+	return r.Header.Get(ezhttp.HeaderSecFetchSite) == "same-origin" || acceptsHTML(r.Header.Get(ezhttp.HeaderAccept))
+}
+
+// addRecentDocument remembers the document for the browser which created it. Only the web UI gets a new anonymous id
+// if the browser has no creator cookie yet, other clients would never send the cookie back and only fill the database.
+func (s *Server) addRecentDocument(w http.ResponseWriter, r *http.Request, documentID string) {
+	if !s.cfg.Recent.Enabled {
+		return
+	}
+
+	creatorID := s.getCreatorID(r)
+	if creatorID == "" {
+		if !fromBrowserUI(r) {
+			return
+		}
+		var err error
+		if creatorID, err = s.newCreatorID(w); err != nil {
+			slog.ErrorContext(r.Context(), "failed to create creator id", slog.Any("err", err))
+			return
+		}
+	}
+
+	if err := s.db.AddCreatorDocument(r.Context(), creatorID, documentID, s.cfg.Recent.Limit); err != nil {
+		slog.ErrorContext(r.Context(), "failed to add recent document", slog.Any("err", err))
+	}
+}
+
+// GetRecentDocuments returns the documents created by the browser from newest to oldest.
+func (s *Server) GetRecentDocuments(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.Recent.Enabled {
+		s.error(w, r, httperr.NotFound(ErrRecentDisabled))
+		return
+	}
+
+	documents := make([]RecentDocument, 0)
+	creatorID := s.getCreatorID(r)
+	if creatorID == "" {
+		s.ok(w, r, RecentDocumentsResponse{Documents: documents})
+		return
+	}
+
+	creatorDocuments, err := s.db.GetCreatorDocuments(r.Context(), creatorID, s.cfg.Recent.Limit)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	for _, creatorDocument := range creatorDocuments {
+		files, err := s.db.GetDocument(r.Context(), creatorDocument.DocumentID)
+		if err != nil {
+			s.error(w, r, fmt.Errorf("failed to get recent document: %w", err))
+			return
+		}
+		// the document expired since the recent documents were loaded
+		if len(files) == 0 {
+			continue
+		}
+
+		fileNames := make([]string, len(files))
+		for i, file := range files {
+			fileNames[i] = file.Name
+		}
+		documents = append(documents, RecentDocument{
+			Key:       creatorDocument.DocumentID,
+			Version:   files[0].DocumentVersion,
+			Files:     fileNames,
+			CreatedAt: creatorDocument.CreatedAt,
+		})
+	}
+
+	s.ok(w, r, RecentDocumentsResponse{Documents: documents})
+}
+
+// DeleteRecentDocument deletes a document created by the browser without a token.
+func (s *Server) DeleteRecentDocument(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.Recent.Enabled {
+		s.error(w, r, httperr.NotFound(ErrRecentDisabled))
+		return
+	}
+
+	documentID := chi.URLParam(r, "documentID")
+	creatorID := s.getCreatorID(r)
+	if creatorID == "" {
+		s.error(w, r, httperr.Forbidden(ErrNotDocumentCreator))
+		return
+	}
+
+	created, err := s.db.IsCreatorDocument(r.Context(), creatorID, documentID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if !created {
+		s.error(w, r, httperr.Forbidden(ErrNotDocumentCreator))
+		return
+	}
+
+	document, err := s.db.DeleteDocument(r.Context(), documentID)
+	if err != nil {
+		s.error(w, r, fmt.Errorf("failed to delete document: %w", err))
+		return
+	}
+	s.documentDeleted(r.Context(), document)
+
+	s.ok(w, r, nil)
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+const (
+	PruneReasonMaxVersions = "max_versions"
+	PruneReasonMaxAge      = "max_age"
+	PruneReasonMaxStorage  = "max_storage"
+)
+
+const (
+	// maxPrunedVersions limits how many versions or documents a single cleanup prunes per limit, the next cleanup
+	// continues with the rest.
+	maxPrunedVersions = 1000
+	// prunePageSize is the number of oldest versions read at once while pruning for the max storage.
+	prunePageSize = 100
+	// pruneTimeout limits how long a single cleanup prunes.
+	pruneTimeout = time.Minute
+)
+
+// pruneDocuments enforces the retention limits. Versions beyond the max versions are pruned first, then documents
+// older than the max age and then the oldest versions until the storage is below the max storage.
+func (s *Server) pruneDocuments(ctx context.Context) {
+	ctx, span := s.tracer.Start(ctx, "pruneDocuments")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, pruneTimeout)
+	defer cancel()
+
+	cfg := s.cfg.Retention
+	if cfg.MaxVersions > 0 {
+		versions, err := s.db.GetVersionsBeyondLimit(ctx, cfg.MaxVersions, maxPrunedVersions)
+		if err != nil {
+			span.SetStatus(codes.Error, "failed to get versions beyond limit")
+			span.RecordError(err)
+			slog.ErrorContext(ctx, "failed to get versions beyond limit", slog.Any("err", err))
+		}
+		for _, version := range versions {
+			if err = s.pruneVersion(ctx, version.DocumentID, version.DocumentVersion, PruneReasonMaxVersions); err != nil {
+				span.RecordError(err)
+				break
+			}
+		}
+	}
+
+	if maxAge := time.Duration(cfg.MaxAge); maxAge > 0 {
+		documentIDs, err := s.db.GetDocumentsCreatedBefore(ctx, time.Now().Add(-maxAge), maxPrunedVersions)
+		if err != nil {
+			span.SetStatus(codes.Error, "failed to get old documents")
+			span.RecordError(err)
+			slog.ErrorContext(ctx, "failed to get old documents", slog.Any("err", err))
+		}
+		for _, documentID := range documentIDs {
+			if err = s.pruneDocument(ctx, documentID); err != nil {
+				span.RecordError(err)
+				break
+			}
+		}
+	}
+
+	if cfg.MaxStorage > 0 {
+		if err := s.pruneStorage(ctx, cfg.MaxStorage); err != nil {
+			span.SetStatus(codes.Error, "failed to prune storage")
+			span.RecordError(err)
+			slog.ErrorContext(ctx, "failed to prune storage", slog.Any("err", err))
+		}
+	}
+}
+
+// pruneStorage prunes the oldest versions until the storage size is below maxStorage. Versions which are not the
+// latest version of their document are pruned first, so documents are only removed once they have a single version.
+func (s *Server) pruneStorage(ctx context.Context, maxStorage int64) error {
+	size, err := s.db.GetStorageSize(ctx)
+	if err != nil {
+		return err
+	}
+
+	pruned := 0
+	for size > maxStorage && pruned < maxPrunedVersions {
+		versions, err := s.db.GetOldestVersions(ctx, prunePageSize)
+		if err != nil {
+			return err
+		}
+		if len(versions) == 0 {
+			return nil
+		}
+		for _, version := range versions {
+			if size <= maxStorage || pruned >= maxPrunedVersions {
+				break
+			}
+			if err = s.pruneVersion(ctx, version.DocumentID, version.DocumentVersion, PruneReasonMaxStorage); err != nil {
+				return err
+			}
+			size -= version.Size
+			pruned++
+		}
+	}
+	if size > maxStorage {
+		slog.WarnContext(ctx, "storage is still above the max storage, the next cleanup continues", slog.Int64("size", size), slog.Int64("max_storage", maxStorage))
+	}
+	return nil
+}
+
+// pruneVersion deletes a single version and notifies like an expired version does.
+func (s *Server) pruneVersion(ctx context.Context, documentID string, version int64, reason string) error {
+	document, err := s.db.DeleteDocumentVersion(ctx, documentID, version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to prune document version", slog.String("document_id", documentID), slog.Int64("version", version), slog.Any("err", err))
+		return err
+	}
+	slog.DebugContext(ctx, "pruned document version", slog.String("document_id", documentID), slog.Int64("version", version), slog.String("reason", reason))
+
+	// the document is gone once its last version was pruned
+	event := WebhookEventUpdate
+	if versions, err := s.db.GetDocumentVersions(ctx, documentID); err != nil {
+		slog.ErrorContext(ctx, "failed to get pruned document versions", slog.Any("err", err))
+	} else if len(versions) == 0 {
+		event = WebhookEventDelete
+	}
+	s.notifyPrune(ctx, event, *document, reason)
+	return nil
+}
+
+// pruneDocument deletes a document with all of its versions because it's older than the max age.
+func (s *Server) pruneDocument(ctx context.Context, documentID string) error {
+	document, err := s.db.DeleteDocument(ctx, documentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to prune document", slog.String("document_id", documentID), slog.Any("err", err))
+		return err
+	}
+	slog.DebugContext(ctx, "pruned document", slog.String("document_id", documentID), slog.String("reason", PruneReasonMaxAge))
+
+	s.notifyPrune(ctx, WebhookEventDelete, *document, PruneReasonMaxAge)
+	return nil
+}
+
+func (s *Server) notifyPrune(ctx context.Context, event string, document database.Document, reason string) {
+	s.RecordEvent(ctx, EventPrune, document.ID, document.Version, EventPruneData{
+		Reason: reason,
+		Files:  newEventData(document.Files).Files,
+	})
+	s.publishLiveEvent(EventPrune, document.ID, document.Version)
+
+	webhooksFiles := make([]api.WebhookDocumentFile, len(document.Files))
+	for i, file := range document.Files {
+		webhooksFiles[i] = api.WebhookDocumentFile{
+			Name:      file.Name,
+			Content:   file.Content,
+			Language:  file.Language,
+			Encrypted: file.Encrypted,
+			ExpiresAt: file.ExpiresAt,
+		}
+	}
+	s.ExecuteWebhooks(ctx, event, api.WebhookDocument{
+		Key:     document.ID,
+		Version: document.Version,
+		Files:   webhooksFiles,
+	})
+}
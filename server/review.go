@@ -0,0 +1,322 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/flags"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+var (
+	ErrRevisionNotFound = errors.New("revision not found")
+	ErrInvalidRevision  = errors.New("revision is invalid")
+)
+
+type (
+	ProtectionRequest struct {
+		Protected bool `json:"protected"`
+	}
+
+	ProtectionResponse struct {
+		Protected bool `json:"protected"`
+	}
+
+	RevisionsResponse struct {
+		Protected bool                   `json:"protected"`
+		Revisions []api.RevisionResponse `json:"revisions"`
+	}
+)
+
+// requiresReview reports whether updates to a document with the token of the request have to be approved first.
+func (s *Server) requiresReview(r *http.Request, documentID string) (bool, error) {
+	if flags.Has(GetClaims(r).Permissions, PermissionReview) {
+		return false, nil
+	}
+	protected, err := s.db.IsDocumentProtected(r.Context(), documentID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get document protection: %w", err)
+	}
+	return protected, nil
+}
+
+// createRevision saves the files as a pending revision of the document instead of a new version.
+func (s *Server) createRevision(r *http.Request, documentID string, dbFiles []database.File) (*api.RevisionResponse, error) {
+	ctx, span := s.tracer.Start(r.Context(), "createRevision", trace.WithAttributes(
+		attribute.String("document_id", documentID),
+	))
+	defer span.End()
+
+	if err := s.checkDocumentLock(ctx, documentID, r.Header.Get(ezhttp.HeaderDocumentLock)); err != nil {
+		return nil, err
+	}
+
+	versions, err := s.db.GetDocumentVersions(ctx, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document versions: %w", err)
+	}
+	if len(versions) == 0 {
+		return nil, httperr.NotFound(ErrDocumentNotFound)
+	}
+	// versions are sorted from newest to oldest
+	baseVersion := versions[0]
+
+	revision, err := s.db.CreateRevision(ctx, documentID, baseVersion, dbFiles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create revision: %w", err)
+	}
+
+	eventData := newEventData(dbFiles)
+	s.RecordEvent(ctx, EventRevisionPending, documentID, baseVersion, EventRevisionData{
+		Revision: *revision,
+		Files:    eventData.Files,
+	})
+
+	rsFiles := make([]api.ResponseFile, len(dbFiles))
+	webhooksFiles := make([]api.WebhookDocumentFile, len(dbFiles))
+	for i, file := range dbFiles {
+		rsFiles[i] = api.ResponseFile{
+			Name:      file.Name,
+			Content:   file.Content,
+			Language:  file.Language,
+			Encrypted: file.Encrypted,
+			ExpiresAt: file.ExpiresAt,
+			SHA256:    fileChecksum(file),
+		}
+		webhooksFiles[i] = api.WebhookDocumentFile{
+			Name:      file.Name,
+			Content:   file.Content,
+			Language:  file.Language,
+			Encrypted: file.Encrypted,
+			ExpiresAt: file.ExpiresAt,
+		}
+	}
+	s.ExecuteWebhooks(ctx, WebhookEventRevisionPending, api.WebhookDocument{
+		Key:      documentID,
+		Version:  baseVersion,
+		Revision: *revision,
+		Files:    webhooksFiles,
+	})
+
+	return &api.RevisionResponse{
+		Key:         documentID,
+		Revision:    *revision,
+		BaseVersion: baseVersion,
+		Files:       rsFiles,
+	}, nil
+}
+
+// PutDocumentProtection enables or disables the review of updates by tokens without the review permission.
+func (s *Server) PutDocumentProtection(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionReview) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("review")))
+		return
+	}
+
+	var protectionRequest ProtectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&protectionRequest); err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+
+	if err := s.db.SetDocumentProtected(r.Context(), documentID, protectionRequest.Protected); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, ProtectionResponse{Protected: protectionRequest.Protected})
+}
+
+// GetDocumentRevisions returns all pending revisions of a document with their changes to the latest version.
+func (s *Server) GetDocumentRevisions(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionReview) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("review")))
+		return
+	}
+
+	protected, err := s.db.IsDocumentProtected(r.Context(), documentID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	revisionFiles, err := s.db.GetRevisions(r.Context(), documentID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	latestFiles, err := s.getCompareDocumentFiles(r.Context(), documentID, 0)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	// revision files are sorted by revision
+	revisions := make([]api.RevisionResponse, 0)
+	for start := 0; start < len(revisionFiles); {
+		end := start + 1
+		for end < len(revisionFiles) && revisionFiles[end].Revision == revisionFiles[start].Revision {
+			end++
+		}
+		revisions = append(revisions, newRevisionResponse(revisionFiles[start:end], latestFiles))
+		start = end
+	}
+
+	s.ok(w, r, RevisionsResponse{
+		Protected: protected,
+		Revisions: revisions,
+	})
+}
+
+// GetDocumentRevision returns a pending revision of a document with its changes to the latest version.
+func (s *Server) GetDocumentRevision(w http.ResponseWriter, r *http.Request) {
+	documentID, revisionFiles, err := s.getRevision(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	latestFiles, err := s.getCompareDocumentFiles(r.Context(), documentID, 0)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, newRevisionResponse(revisionFiles, latestFiles))
+}
+
+// PostDocumentRevisionApprove saves a pending revision as the new version of the document.
+func (s *Server) PostDocumentRevisionApprove(w http.ResponseWriter, r *http.Request) {
+	documentID, revisionFiles, err := s.getRevision(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	dbFiles := make([]database.File, len(revisionFiles))
+	for i, file := range revisionFiles {
+		dbFiles[i] = database.File{
+			Name:       file.Name,
+			Content:    file.Content,
+			Language:   file.Language,
+			Encrypted:  file.Encrypted,
+			ExpiresAt:  file.ExpiresAt,
+			OrderIndex: file.OrderIndex,
+		}
+	}
+
+	document, err := s.updateDocument(r, documentID, dbFiles)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	if err = s.db.DeleteRevision(r.Context(), documentID, revisionFiles[0].Revision); err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete approved revision", slog.Any("err", err))
+	}
+	s.RecordEvent(r.Context(), EventRevisionApproved, documentID, document.Version, EventRevisionData{
+		Revision: revisionFiles[0].Revision,
+	})
+
+	s.ok(w, r, document)
+}
+
+// PostDocumentRevisionReject discards a pending revision.
+func (s *Server) PostDocumentRevisionReject(w http.ResponseWriter, r *http.Request) {
+	documentID, revisionFiles, err := s.getRevision(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	if err = s.db.DeleteRevision(r.Context(), documentID, revisionFiles[0].Revision); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrRevisionNotFound))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+	s.RecordEvent(r.Context(), EventRevisionRejected, documentID, revisionFiles[0].BaseVersion, EventRevisionData{
+		Revision: revisionFiles[0].Revision,
+	})
+
+	s.ok(w, r, nil)
+}
+
+// getRevision checks the review permission and returns the files of the revision from the url.
+func (s *Server) getRevision(r *http.Request) (string, []database.RevisionFile, error) {
+	documentID := chi.URLParam(r, "documentID")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionReview) {
+		return "", nil, httperr.Forbidden(ErrPermissionDenied("review"))
+	}
+
+	revision, err := strconv.ParseInt(chi.URLParam(r, "revision"), 10, 64)
+	if err != nil {
+		return "", nil, httperr.BadRequest(ErrInvalidRevision)
+	}
+
+	files, err := s.db.GetRevision(r.Context(), documentID, revision)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil, httperr.NotFound(ErrRevisionNotFound)
+		}
+		return "", nil, fmt.Errorf("failed to get revision: %w", err)
+	}
+	return documentID, files, nil
+}
+
+func newRevisionResponse(revisionFiles []database.RevisionFile, latestFiles []database.File) api.RevisionResponse {
+	files := make([]database.File, len(revisionFiles))
+	rsFiles := make([]api.ResponseFile, len(revisionFiles))
+	for i, file := range revisionFiles {
+		files[i] = database.File{
+			Name:      file.Name,
+			Content:   file.Content,
+			Language:  file.Language,
+			Encrypted: file.Encrypted,
+		}
+		rsFiles[i] = api.ResponseFile{
+			Name:      file.Name,
+			Content:   file.Content,
+			Language:  file.Language,
+			Encrypted: file.Encrypted,
+			ExpiresAt: file.ExpiresAt,
+		}
+	}
+
+	var changes []api.CompareFile
+	for _, pair := range pairFiles(latestFiles, files) {
+		changes = append(changes, compareFiles(pair[0], pair[1]))
+	}
+
+	return api.RevisionResponse{
+		Key:         revisionFiles[0].DocumentID,
+		Revision:    revisionFiles[0].Revision,
+		BaseVersion: revisionFiles[0].BaseVersion,
+		Outdated:    revisionFiles[0].BaseVersion != latestFiles[0].DocumentVersion,
+		Files:       rsFiles,
+		Changes:     changes,
+	}
+}
@@ -1,24 +1,29 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/stampede"
-	"github.com/goware/cachestore-mem"
+	memcache "github.com/goware/cachestore-mem"
 	"github.com/riandyrn/otelchi"
 	"github.com/riandyrn/otelchi/metric"
-	"github.com/samber/slog-chi"
+	slogchi "github.com/samber/slog-chi"
 
+	"github.com/topi314/gobin/v3/api"
 	"github.com/topi314/gobin/v3/internal/ezhttp"
 	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/featureflags"
 	"github.com/topi314/gobin/v3/server/templates"
 )
 
@@ -53,11 +58,18 @@ func (s *Server) Routes() http.Handler {
 	}))
 	r.Use(cacheControl)
 	r.Use(middleware.Recoverer)
+	r.Use(s.DecodeRequest)
 	r.Use(middleware.Heartbeat("/ping"))
+	r.Use(s.JWTMiddleware)
+	if s.cfg.UserAgents.Enabled {
+		r.Use(s.UserAgentMiddleware)
+	}
+	if len(s.cfg.FeatureFlags.Flags) > 0 || s.cfg.FeatureFlags.Provider == featureflags.TypeOFREP {
+		r.Use(s.FeatureFlagsMiddleware)
+	}
 	if s.cfg.RateLimit.Enabled {
-		r.Use(s.RateLimit)
+		r.Use(s.RateLimit(r))
 	}
-	r.Use(s.JWTMiddleware)
 	r.Use(middleware.GetHead)
 
 	if s.cfg.Debug {
@@ -76,7 +88,10 @@ func (s *Server) Routes() http.Handler {
 			panic(err)
 		}
 
-		previewCache = stampede.HandlerWithKey(slog.Default(), cache, time.Duration(s.cfg.Preview.CacheTTL), s.cacheKeyFunc)
+		// 304 responses are only cached for the same conditional request
+		previewCache = stampede.HandlerWithKey(slog.Default(), cache, time.Duration(s.cfg.Preview.CacheTTL), s.cacheKeyFunc,
+			stampede.WithHTTPCacheKeyRequestHeaders([]string{ezhttp.HeaderIfNoneMatch, ezhttp.HeaderIfModifiedSince}),
+		)
 	}
 	if s.cfg.Preview.Enabled {
 		previewHandler = func(r chi.Router) {
@@ -89,47 +104,207 @@ func (s *Server) Routes() http.Handler {
 		}
 	}
 
-	r.Mount("/assets", http.FileServer(s.assets))
+	r.Get("/assets/*", s.GetAsset)
 	r.HandleFunc("/assets/theme.css", s.ThemeCSS)
-	r.Handle("/favicon.ico", s.file("/assets/favicon.png"))
-	r.Handle("/favicon.png", s.file("/assets/favicon.png"))
-	r.Handle("/favicon-light.png", s.file("/assets/favicon-light.png"))
-	r.Handle("/robots.txt", s.file("/assets/robots.txt"))
+	r.Handle("/favicon.ico", s.file("favicon.png"))
+	r.Handle("/favicon.png", s.file("favicon.png"))
+	r.Handle("/favicon-light.png", s.file("favicon-light.png"))
+	r.Handle("/robots.txt", s.file("robots.txt"))
+	r.Handle("/manifest.json", s.file("manifest.json"))
+	// the service worker has to be served from the root to control all pages
+	r.Handle("/sw.js", s.file("sw.js"))
 
 	r.Get("/version", s.GetVersion)
+	r.Get("/openapi.json", s.GetOpenAPI)
+	r.Get("/openapi", s.GetOpenAPIDocs)
+	r.Get("/styles", s.GetStyles)
+	r.Get("/events", s.GetEvents)
+
+	r.Route("/device", func(r chi.Router) {
+		r.Get("/", s.GetPrettyDevice)
+		r.Post("/code", s.PostDeviceCode)
+		r.Post("/token", s.PostDeviceToken)
+		r.Post("/approve", s.PostDeviceApprove)
+		r.Post("/deny", s.PostDeviceDeny)
+	})
+
+	r.Get("/.well-known/webfinger", s.GetWebFinger)
+	r.Get("/.well-known/jwks.json", s.GetJWKS)
+	r.Route("/activitypub", func(r chi.Router) {
+		r.Get("/actor", s.GetActivityPubActor)
+		r.Post("/inbox", s.PostActivityPubInbox)
+		r.Get("/outbox", s.GetActivityPubOutbox)
+		r.Get("/followers", s.GetActivityPubFollowers)
+		r.Get("/notes/{documentID}", s.GetActivityPubNote)
+	})
+
+	r.Route("/tokens", func(r chi.Router) {
+		r.Post("/", s.PostReadToken)
+		r.With(s.ReadTokenRateLimit).Get("/documents", s.GetReadTokenDocuments)
+	})
+
+	r.Route("/login", func(r chi.Router) {
+		r.Get("/", s.GetLogin)
+		r.Get("/callback", s.GetLoginCallback)
+		r.Route("/two-factor", func(r chi.Router) {
+			r.Get("/", s.GetPrettyTwoFactorLogin)
+			r.Post("/", s.PostTwoFactorLogin)
+			r.Post("/options", s.PostTwoFactorLoginOptions)
+		})
+	})
+	r.Post("/logout", s.PostLogout)
+	r.Route("/account", func(r chi.Router) {
+		r.Get("/", s.GetAccount)
+		r.Route("/sessions", func(r chi.Router) {
+			r.Get("/", s.GetAccountSessions)
+			r.Delete("/", s.DeleteAccountSessions)
+			r.Delete("/{sessionID}", s.DeleteAccountSession)
+		})
+		r.Route("/two-factor", func(r chi.Router) {
+			r.Get("/", s.GetTwoFactor)
+			r.Post("/totp", s.PostTOTP)
+			r.Post("/totp/confirm", s.PostTOTPConfirm)
+			r.Delete("/totp", s.DeleteTOTP)
+			r.Post("/recovery-codes", s.PostRecoveryCodes)
+			r.Route("/passkeys", func(r chi.Router) {
+				r.Post("/", s.PostPasskey)
+				r.Post("/options", s.PostPasskeyOptions)
+				r.Delete("/{passkeyID}", s.DeletePasskey)
+			})
+		})
+		r.Route("/webhooks", func(r chi.Router) {
+			r.Get("/", s.GetAccountWebhooks)
+			r.Post("/", s.PostAccountWebhook)
+			r.Route("/{webhookID}", func(r chi.Router) {
+				r.Get("/", s.GetAccountWebhook)
+				r.Patch("/", s.PatchAccountWebhook)
+				r.Delete("/", s.DeleteAccountWebhook)
+			})
+		})
+	})
+
+	r.Route("/user", func(r chi.Router) {
+		r.Get("/settings", s.GetUserSettings)
+		r.Put("/settings", s.PutUserSettings)
+		r.Delete("/settings", s.DeleteUserSettings)
+		r.Post("/token", s.PostUserToken)
+	})
+
+	r.Route("/invites/{inviteID}", func(r chi.Router) {
+		r.Get("/", s.GetInvite)
+		r.Post("/accept", s.PostInviteAccept)
+	})
+
+	r.Route("/ingest", func(r chi.Router) {
+		r.Post("/s3", s.PostIngestS3)
+		r.Get("/objects", s.GetIngestedObject)
+	})
+
+	r.Route("/recent", func(r chi.Router) {
+		r.Get("/", s.GetRecentDocuments)
+		r.Delete("/{documentID}", s.DeleteRecentDocument)
+	})
 
 	r.Route("/documents", func(r chi.Router) {
+		if s.cfg.Compression.Enabled {
+			r.Use(s.Compress)
+		}
+		r.Get("/", s.GetDocuments)
 		r.Post("/", s.PostDocument)
+		r.Post("/gist", s.PostDocumentGist)
+		r.Get("/compare", s.GetDocumentsCompare)
+		r.Get("/search", s.GetDocumentsSearch)
 
-		filesHandler := func(r chi.Router) {
+		summaryHandler := func(r chi.Router) {
+			r.With(s.SummaryRateLimit).Get("/summary/ai", s.GetDocumentSummary)
+		}
+		filesHandler := func(r chi.Router, latest bool) {
 			r.Route("/files/{fileName}", func(r chi.Router) {
 				r.Get("/", s.GetDocumentFile)
+				if latest {
+					r.Patch("/append", s.PostDocumentAppend)
+				}
+				r.Get("/logs", s.GetDocumentFileLogs)
+				r.Get("/search", s.GetDocumentFileSearch)
+				r.Get("/outline", s.GetDocumentFileOutline)
+				r.Get("/blame", s.GetDocumentFileBlame)
+				r.Get("/tail", s.GetDocumentFileTail)
+				r.Route("/signature", func(r chi.Router) {
+					r.Get("/", s.GetDocumentFileSignature)
+					r.Put("/", s.PutDocumentFileSignature)
+					r.Delete("/", s.DeleteDocumentFileSignature)
+				})
 			})
 		}
 		r.Route("/{documentID}", func(r chi.Router) {
+			r.Use(s.DocumentClaimsMiddleware)
 			r.Get("/", s.GetDocument)
+			r.Put("/", s.PutDocument)
 			r.Patch("/", s.PatchDocument)
 			r.Delete("/", s.DeleteDocument)
 			r.Post("/share", s.PostDocumentShare)
+			r.Delete("/share/{tokenID}", s.DeleteDocumentShare)
+			r.Post("/append", s.PostDocumentAppend)
+			r.Get("/parts", s.GetDocumentParts)
+			r.Post("/parts", s.PostDocumentPart)
+			r.Get("/lock", s.GetDocumentLock)
+			r.Post("/lock", s.PostDocumentLock)
+			r.Delete("/lock", s.DeleteDocumentLock)
+			r.Get("/diff", s.GetDocumentDiff)
+			r.Get("/merge", s.GetDocumentMerge)
+			r.Post("/merge", s.PostDocumentMerge)
+			r.Put("/protection", s.PutDocumentProtection)
+			r.Put("/style", s.PutDocumentStyle)
+			r.Get("/tags", s.GetDocumentTags)
+			r.Put("/tags", s.PutDocumentTags)
+			r.Get("/events", s.GetDocumentEventStream)
+			r.Get("/archive", s.GetDocumentArchive)
+			summaryHandler(r)
 
 			r.Route("/versions", func(r chi.Router) {
 				r.Get("/", s.DocumentVersions)
 				r.Route("/{version}", func(r chi.Router) {
 					r.Get("/", s.GetDocument)
 					r.Delete("/", s.DeleteDocument)
+					r.Get("/archive", s.GetDocumentArchive)
+					summaryHandler(r)
+					filesHandler(r, false)
+				})
+			})
+
+			r.Route("/revisions", func(r chi.Router) {
+				r.Get("/", s.GetDocumentRevisions)
+				r.Route("/{revision}", func(r chi.Router) {
+					r.Get("/", s.GetDocumentRevision)
+					r.Post("/approve", s.PostDocumentRevisionApprove)
+					r.Post("/reject", s.PostDocumentRevisionReject)
 				})
 			})
 
+			r.Route("/invites", func(r chi.Router) {
+				r.Get("/", s.GetDocumentInvites)
+				r.Post("/", s.PostDocumentInvite)
+				r.Delete("/{inviteID}", s.DeleteDocumentInvite)
+			})
+
+			r.Route("/members", func(r chi.Router) {
+				r.Get("/", s.GetDocumentMembers)
+				r.Delete("/{memberID}", s.DeleteDocumentMember)
+			})
+
 			r.Route("/webhooks", func(r chi.Router) {
+				r.Get("/", s.GetDocumentWebhooks)
 				r.Post("/", s.PostDocumentWebhook)
 				r.Route("/{webhookID}", func(r chi.Router) {
 					r.Get("/", s.GetDocumentWebhook)
 					r.Patch("/", s.PatchDocumentWebhook)
 					r.Delete("/", s.DeleteDocumentWebhook)
+					r.Get("/deliveries", s.GetDocumentWebhookDeliveries)
+					r.Post("/deliveries/{deliveryID}/redeliver", s.PostDocumentWebhookRedelivery)
 				})
 			})
 
-			filesHandler(r)
+			filesHandler(r, true)
 		})
 	})
 
@@ -139,6 +314,10 @@ func (s *Server) Routes() http.Handler {
 		})
 	}
 	r.Route("/raw/{documentID}", func(r chi.Router) {
+		if s.cfg.Compression.Enabled {
+			r.Use(s.Compress)
+		}
+		r.Use(s.DocumentClaimsMiddleware)
 		r.Get("/", s.GetRawDocument)
 		r.Route("/versions/{version}", func(r chi.Router) {
 			r.Get("/", s.GetRawDocument)
@@ -147,24 +326,71 @@ func (s *Server) Routes() http.Handler {
 		rawFilesHandler(r)
 	})
 
+	r.Route("/f/{host}/{documentID}", func(r chi.Router) {
+		r.Get("/", s.GetFederatedDocument)
+		r.Get("/{version}", s.GetFederatedDocument)
+	})
+
+	r.Get("/compare", s.GetPrettyCompare)
+	r.Get("/settings", s.GetPrettySettings)
+	r.Get("/invite/{inviteID}", s.GetPrettyInvite)
 	r.Route("/{documentID}", func(r chi.Router) {
+		r.Use(s.DocumentClaimsMiddleware)
 		r.Get("/", s.GetPrettyDocument)
+		r.Put("/", s.PutPrettyDocument)
+		r.Get("/embed", s.GetDocumentEmbed)
 		previewHandler(r)
 		r.Route("/{version}", func(r chi.Router) {
 			r.Get("/", s.GetPrettyDocument)
+			r.Get("/embed", s.GetDocumentEmbed)
 			previewHandler(r)
 		})
 	})
 	r.Get("/", s.GetPrettyDocument)
 
 	r.NotFound(s.redirectRoot)
+	s.reservedKeys = reservedDocumentKeys(r, s.cfg.CustomKeys.Reserved)
+	if s.cfg.OpenAPI.Enabled {
+		openAPI, err := s.newOpenAPIDocument(r)
+		if err != nil {
+			slog.Error("Failed to generate OpenAPI document", slog.Any("err", err))
+		}
+		s.openAPI = openAPI
+	}
 
 	if s.cfg.HTTPTimeout > 0 {
-		return http.TimeoutHandler(r, time.Duration(s.cfg.HTTPTimeout), "Request timed out")
+		return s.timeout(r, time.Duration(s.cfg.HTTPTimeout))
 	}
 	return r
 }
 
+// timeout wraps the router in a http.TimeoutHandler. The http.TimeoutHandler buffers the whole response, so document
+// pages which are streamed only get a timeout on their context instead and event streams and followed tails get no
+// timeout at all.
+func (s *Server) timeout(r chi.Router, timeout time.Duration) http.Handler {
+	timeoutHandler := http.TimeoutHandler(r, timeout, "Request timed out")
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet || req.Method == http.MethodHead {
+			switch r.Find(chi.NewRouteContext(), http.MethodGet, req.URL.Path) {
+			case "/", "/{documentID}", "/{documentID}/", "/{documentID}/{version}", "/{documentID}/{version}/":
+				ctx, cancel := context.WithTimeout(req.Context(), timeout)
+				defer cancel()
+				r.ServeHTTP(w, req.WithContext(ctx))
+				return
+			case "/documents/{documentID}/events":
+				r.ServeHTTP(w, req)
+				return
+			case "/documents/{documentID}/files/{fileName}/tail", "/documents/{documentID}/versions/{version}/files/{fileName}/tail":
+				if req.URL.Query().Get("follow") == "true" {
+					r.ServeHTTP(w, req)
+					return
+				}
+			}
+		}
+		timeoutHandler.ServeHTTP(w, req)
+	})
+}
+
 func (s *Server) GetVersion(w http.ResponseWriter, _ *http.Request) {
 	_, _ = w.Write([]byte(s.version.Format()))
 }
@@ -191,6 +417,7 @@ func (s *Server) prettyError(w http.ResponseWriter, r *http.Request, err error)
 		Status:    status,
 		RequestID: middleware.GetReqID(r.Context()),
 		Path:      r.URL.Path,
+		Assets:    s.assetManifest,
 	}).Render(r.Context(), w); tmplErr != nil && !errors.Is(tmplErr, http.ErrHandlerTimeout) {
 		slog.ErrorContext(r.Context(), "failed to execute error template", slog.Any("err", tmplErr))
 	}
@@ -202,24 +429,36 @@ func (s *Server) error(w http.ResponseWriter, r *http.Request, err error) {
 	}
 
 	status := http.StatusInternalServerError
-	var httpErr *httperr.Error
+	var (
+		httpErr     *httperr.Error
+		limitErr    *api.LimitError
+		conflictErr *api.ConflictError
+		lockedErr   *api.LockedError
+	)
 	if errors.As(err, &httpErr) {
 		status = httpErr.Status
-	}
-
-	if httpErr.Location != "" {
-		http.Redirect(w, r, httpErr.Location, status)
-		return
+		if httpErr.Location != "" {
+			http.Redirect(w, r, httpErr.Location, status)
+			return
+		}
+		errors.As(httpErr.Err, &limitErr)
+		errors.As(httpErr.Err, &conflictErr)
+		errors.As(httpErr.Err, &lockedErr)
 	}
 
 	if status == http.StatusInternalServerError {
 		slog.ErrorContext(r.Context(), "internal server error", slog.Any("err", err))
 	}
-	s.json(w, r, ezhttp.ErrorResponse{
-		Message:   err.Error(),
-		Status:    status,
-		Path:      r.URL.Path,
-		RequestID: middleware.GetReqID(r.Context()),
+	s.json(w, r, api.ErrorResponse{
+		ErrorResponse: ezhttp.ErrorResponse{
+			Message:   err.Error(),
+			Status:    status,
+			Path:      r.URL.Path,
+			RequestID: middleware.GetReqID(r.Context()),
+		},
+		Limit:    limitErr,
+		Conflict: conflictErr,
+		Lock:     lockedErr,
 	}, status)
 }
 
@@ -253,6 +492,9 @@ func (s *Server) file(path string) http.HandlerFunc {
 		defer func() {
 			_ = file.Close()
 		}()
+		if contentType := mime.TypeByExtension(filepath.Ext(path)); contentType != "" {
+			w.Header().Set(ezhttp.HeaderContentType, contentType)
+		}
 		if _, err = io.Copy(w, file); err != nil {
 			slog.ErrorContext(r.Context(), "failed to copy file", slog.Any("err", err))
 		}
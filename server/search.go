@@ -0,0 +1,287 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+const (
+	defaultSearchLimit = 1000
+	maxSearchLimit     = 10000
+	maxSearchQuery     = 1024
+	// defaultDocumentsSearchLimit and maxDocumentsSearchLimit limit the number of matching files of a full-text search.
+	defaultDocumentsSearchLimit = 20
+	maxDocumentsSearchLimit     = 100
+	// searchSnippetSize is the number of runes shown before and after a match.
+	searchSnippetSize = 80
+)
+
+var (
+	ErrMissingSearchQuery = errors.New("missing search query")
+	ErrSearchQueryTooLong = errors.New("search query too long")
+	ErrInvalidSearchRegex = func(err error) error {
+		return fmt.Errorf("invalid search regex: %w", err)
+	}
+	ErrInvalidSearchLimit  = errors.New("invalid search limit")
+	ErrSearchDisabled      = errors.New("document search disabled")
+	ErrSearchTokenRequired = errors.New("a user, read or document token is required to search documents")
+)
+
+type (
+	ResponseSearch struct {
+		Name      string        `json:"name"`
+		Matches   []SearchMatch `json:"matches"`
+		Truncated bool          `json:"truncated"`
+	}
+
+	// SearchMatch is a single match, Line and Column are 1-based, Column and Length count runes.
+	SearchMatch struct {
+		Line    int    `json:"line"`
+		Column  int    `json:"column"`
+		Length  int    `json:"length"`
+		Snippet string `json:"snippet"`
+		// SnippetColumn is the 1-based rune column of the match within the snippet.
+		SnippetColumn int `json:"snippet_column"`
+	}
+
+	ResponseDocumentsSearch struct {
+		Results []DocumentsSearchResult `json:"results"`
+	}
+
+	DocumentsSearchResult struct {
+		Key     string                `json:"key"`
+		Version int64                 `json:"version"`
+		Files   []DocumentsSearchFile `json:"files"`
+	}
+
+	DocumentsSearchFile struct {
+		Name       string            `json:"name"`
+		Language   string            `json:"language"`
+		Snippet    string            `json:"snippet"`
+		Highlights []SearchHighlight `json:"highlights"`
+	}
+
+	// SearchHighlight is a highlighted part of a snippet, Start is 0-based and Start and Length count runes.
+	SearchHighlight struct {
+		Start  int `json:"start"`
+		Length int `json:"length"`
+	}
+)
+
+// GetDocumentFileSearch searches a file line by line for a literal or regex query. It is used by the UI for files too
+// big to be searched in the browser.
+func (s *Server) GetDocumentFileSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := query.Get("q")
+	if q == "" {
+		s.error(w, r, httperr.BadRequest(ErrMissingSearchQuery))
+		return
+	}
+	if len(q) > maxSearchQuery {
+		s.error(w, r, httperr.BadRequest(ErrSearchQueryTooLong))
+		return
+	}
+
+	expr := q
+	if query.Get("regex") != "true" {
+		expr = regexp.QuoteMeta(q)
+	}
+	if query.Get("case") != "true" {
+		expr = "(?i)" + expr
+	}
+	regex, err := regexp.Compile(expr)
+	if err != nil {
+		s.error(w, r, httperr.BadRequest(ErrInvalidSearchRegex(err)))
+		return
+	}
+
+	limit := defaultSearchLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			s.error(w, r, httperr.BadRequest(ErrInvalidSearchLimit))
+			return
+		}
+		limit = min(limit, maxSearchLimit)
+	}
+
+	file, err := s.getDocumentFile(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if file.Encrypted {
+		s.error(w, r, httperr.BadRequest(ErrFileEncrypted))
+		return
+	}
+
+	_, span := s.tracer.Start(r.Context(), "searchDocumentFile", trace.WithAttributes(
+		attribute.String("document_id", file.DocumentID),
+		attribute.String("file_name", file.Name),
+	))
+	matches, truncated := searchContent(file.Content, regex, limit)
+	span.SetAttributes(attribute.Int("matches", len(matches)))
+	span.End()
+
+	s.ok(w, r, ResponseSearch{
+		Name:      file.Name,
+		Matches:   matches,
+		Truncated: truncated,
+	})
+}
+
+// searchContent scans the content line by line and returns at most limit matches.
+func searchContent(content string, regex *regexp.Regexp, limit int) ([]SearchMatch, bool) {
+	matches := make([]SearchMatch, 0)
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		var runes []rune
+		for _, loc := range regex.FindAllStringIndex(text, -1) {
+			if loc[0] == loc[1] {
+				// skip empty matches like ^ or .*
+				continue
+			}
+			if len(matches) >= limit {
+				return matches, true
+			}
+
+			column := utf8.RuneCountInString(text[:loc[0]])
+			length := utf8.RuneCountInString(text[loc[0]:loc[1]])
+			if runes == nil {
+				runes = []rune(text)
+			}
+			start := max(0, column-searchSnippetSize)
+			end := min(len(runes), column+length+searchSnippetSize)
+
+			matches = append(matches, SearchMatch{
+				Line:          line,
+				Column:        column + 1,
+				Length:        length,
+				Snippet:       string(runes[start:end]),
+				SnippetColumn: column - start + 1,
+			})
+		}
+	}
+	return matches, false
+}
+
+// GetDocumentsSearch searches the content and file names of the latest version of the documents the caller may list,
+// see GetDocuments. Unlisted documents of others are never found.
+func (s *Server) GetDocumentsSearch(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.Search.Enabled {
+		s.error(w, r, httperr.NotFound(ErrSearchDisabled))
+		return
+	}
+	creatorID, documentIDs := s.getCallerDocuments(r)
+	if creatorID == "" && len(documentIDs) == 0 {
+		s.error(w, r, httperr.Unauthorized(ErrSearchTokenRequired))
+		return
+	}
+
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		s.error(w, r, httperr.BadRequest(ErrMissingSearchQuery))
+		return
+	}
+	if len(q) > maxSearchQuery {
+		s.error(w, r, httperr.BadRequest(ErrSearchQueryTooLong))
+		return
+	}
+
+	limit := defaultDocumentsSearchLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			s.error(w, r, httperr.BadRequest(ErrInvalidSearchLimit))
+			return
+		}
+		limit = min(limit, maxDocumentsSearchLimit)
+	}
+
+	ctx, span := s.tracer.Start(r.Context(), "searchDocuments", trace.WithAttributes(
+		attribute.Int("limit", limit),
+	))
+	defer span.End()
+
+	results, err := s.db.SearchDocuments(ctx, q, creatorID, documentIDs, limit)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	span.SetAttributes(attribute.Int("results", len(results)))
+
+	// results are ordered by rank, files of the same document are grouped at the position of the best match
+	rs := ResponseDocumentsSearch{
+		Results: make([]DocumentsSearchResult, 0),
+	}
+	documents := make(map[string]int)
+	for _, result := range results {
+		snippet, highlights := parseSearchSnippet(result.Snippet)
+		file := DocumentsSearchFile{
+			Name:       result.Name,
+			Language:   result.Language,
+			Snippet:    snippet,
+			Highlights: highlights,
+		}
+
+		i, ok := documents[result.DocumentID]
+		if !ok {
+			i = len(rs.Results)
+			documents[result.DocumentID] = i
+			rs.Results = append(rs.Results, DocumentsSearchResult{
+				Key:     result.DocumentID,
+				Version: result.DocumentVersion,
+			})
+		}
+		rs.Results[i].Files = append(rs.Results[i].Files, file)
+	}
+
+	s.ok(w, r, rs)
+}
+
+// parseSearchSnippet removes the highlight markers from a snippet and returns their positions instead.
+func parseSearchSnippet(snippet string) (string, []SearchHighlight) {
+	var (
+		text       strings.Builder
+		highlights = make([]SearchHighlight, 0)
+		runes      int
+		start      = -1
+	)
+	for _, c := range snippet {
+		switch string(c) {
+		case database.SearchHighlightStart:
+			start = runes
+		case database.SearchHighlightEnd:
+			if start != -1 && runes > start {
+				highlights = append(highlights, SearchHighlight{
+					Start:  start,
+					Length: runes - start,
+				})
+			}
+			start = -1
+		default:
+			text.WriteRune(c)
+			runes++
+		}
+	}
+	return text.String(), highlights
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"github.com/topi314/gobin/v3/internal/crypt"
+	"github.com/topi314/gobin/v3/internal/vault"
+)
+
+// NewSecrets returns the envelope which encrypts webhook secrets, webhook client certificates, device tokens and
+// optionally file contents before they are stored. The KMS uses the address and token of the Vault client if it has no
+// own, vaultClient may be nil. It fails if webhooks, device authorization or content encryption are enabled without a
+// key or jwt_secret, and if content urls are enabled without a secret to sign them.
+func NewSecrets(cfg Config, vaultClient *vault.Client) (*crypt.Envelope, error) {
+	if cfg.Webhook.Enabled && cfg.Webhook.BaseURL != "" && contentURLSecret(cfg) == "" {
+		return nil, errors.New("webhook.content_url_secret or jwt_secret is required to sign content urls")
+	}
+
+	if cfg.Encryption.KMS.Type == KMSTypeVault {
+		vaultCfg := crypt.VaultConfig{
+			Address:   cfg.Encryption.KMS.Address,
+			Token:     cfg.Encryption.KMS.Token,
+			Namespace: cfg.Encryption.KMS.Namespace,
+			Mount:     cfg.Encryption.KMS.Mount,
+			KeyName:   cfg.Encryption.KMS.KeyName,
+		}
+		if vaultClient != nil {
+			if vaultCfg.Address == "" {
+				vaultCfg.Address = cfg.Vault.Address
+				vaultCfg.Namespace = cfg.Vault.Namespace
+			}
+			if vaultCfg.Token == "" {
+				vaultCfg.TokenFunc = vaultClient.Token
+			}
+		}
+		return crypt.New(crypt.NewVaultKey(vaultCfg, &http.Client{
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+			Timeout:   time.Duration(cfg.Encryption.KMS.Timeout),
+		})), nil
+	}
+
+	key := cfg.Encryption.Key
+	if cfg.Encryption.KeyFile != "" {
+		data, err := os.ReadFile(cfg.Encryption.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read encryption key file: %w", err)
+		}
+		key = strings.TrimSpace(string(data))
+		if key == "" {
+			return nil, fmt.Errorf("encryption key file %s is empty", cfg.Encryption.KeyFile)
+		}
+	}
+	if key == "" {
+		key = cfg.JWTSecret
+	}
+	if key == "" {
+		if cfg.Webhook.Enabled || cfg.DeviceAuth.Enabled || cfg.Encryption.Content || cfg.Accounts.Enabled {
+			return nil, errors.New("encryption.key, encryption.key_file, encryption.kms or jwt_secret is required to encrypt webhook secrets, device tokens, file contents and authenticator secrets")
+		}
+		return crypt.New(crypt.NewNoKey()), nil
+	}
+	return crypt.New(crypt.NewLocalKey(key)), nil
+}
+
+// contentURLSecret returns the secret content urls of webhooks are signed with.
+func contentURLSecret(cfg Config) string {
+	if cfg.Webhook.ContentURLSecret != "" {
+		return cfg.Webhook.ContentURLSecret
+	}
+	return cfg.JWTSecret
+}
+
+// encryptSecrets encrypts the secrets which were stored in plaintext before secrets were encrypted. Failures are only
+// logged, plaintext secrets keep working and are encrypted on the next start.
+func (s *Server) encryptSecrets() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err := s.db.EncryptSecrets(ctx, func(plaintext string) (string, error) {
+		return s.secrets.Encrypt(ctx, plaintext)
+	}); err != nil {
+		slog.ErrorContext(ctx, "failed to encrypt stored secrets", slog.Any("err", err))
+	}
+}
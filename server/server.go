@@ -3,16 +3,15 @@ package server
 import (
 	"context"
 	"errors"
+	"io/fs"
 	"log/slog"
 	"net/http"
-	"net/http/httptrace"
 	"sync"
 	"time"
 
 	"github.com/go-jose/go-jose/v3"
 	"github.com/topi314/chroma/v2/formatters/html"
 	"github.com/topi314/chroma/v2/styles"
-	"go.opentelemetry.io/contrib/instrumentation/net/http/httptrace/otelhttptrace"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -20,10 +19,16 @@ import (
 	"go.opentelemetry.io/otel/trace"
 	tracenoop "go.opentelemetry.io/otel/trace/noop"
 
-	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/crypt"
+	"github.com/topi314/gobin/v3/internal/gist"
 	"github.com/topi314/gobin/v3/internal/httprate"
+	"github.com/topi314/gobin/v3/internal/oidc"
 	"github.com/topi314/gobin/v3/internal/ver"
 	"github.com/topi314/gobin/v3/server/database"
+	"github.com/topi314/gobin/v3/server/featureflags"
+	"github.com/topi314/gobin/v3/server/storage"
+	"github.com/topi314/gobin/v3/server/summary"
 	"github.com/topi314/gobin/v3/server/templates"
 )
 
@@ -32,7 +37,7 @@ var (
 	Namespace = "github.com/topi314/gobin/v3"
 )
 
-func NewServer(version ver.Version, debug bool, cfg Config, db database.DB, signer jose.Signer, assets http.FileSystem, htmlFormatter *html.Formatter, standaloneHTMLFormatter *html.Formatter) *Server {
+func NewServer(version ver.Version, debug bool, cfg Config, db database.DB, jwtKeys *JWTKeys, assets fs.FS, htmlFormatter *html.Formatter, standaloneHTMLFormatter *html.Formatter, plugins *Plugins, summaryProvider summary.Provider, ingestSource storage.Source, secrets *crypt.Envelope, featureFlags *featureflags.Flags) *Server {
 	var allStyles []templates.Style
 	for _, name := range styles.Names() {
 		allStyles = append(allStyles, templates.Style{
@@ -43,14 +48,65 @@ func NewServer(version ver.Version, debug bool, cfg Config, db database.DB, sign
 
 	var client *http.Client
 	if cfg.Webhook.Enabled {
-		client = &http.Client{
-			Transport: otelhttp.NewTransport(
-				http.DefaultTransport,
-				otelhttp.WithClientTrace(func(ctx context.Context) *httptrace.ClientTrace {
-					return otelhttptrace.NewClientTrace(ctx)
-				}),
-			),
-			Timeout: time.Duration(cfg.Webhook.Timeout),
+		client = newWebhookClient(cfg.Webhook, nil)
+	}
+
+	var fetchClient *http.Client
+	if cfg.FromURL.Enabled {
+		fetchClient = newFetchClient(cfg.FromURL)
+	}
+
+	var gistClient *gist.Client
+	if cfg.Gist.Enabled {
+		gistClient = &gist.Client{
+			APIURL: cfg.Gist.APIURL,
+			Token:  cfg.Gist.Token,
+			HTTPClient: &http.Client{
+				Transport: otelhttp.NewTransport(http.DefaultTransport),
+				Timeout:   time.Duration(cfg.Gist.Timeout),
+			},
+		}
+	}
+
+	var federation *federation
+	if cfg.Federation.Enabled {
+		federation = newFederation(cfg.Federation)
+	}
+
+	var activityPub *activityPub
+	if cfg.ActivityPub.Enabled {
+		var err error
+		if activityPub, err = newActivityPub(cfg.ActivityPub); err != nil {
+			slog.Error("Failed to load activitypub key, activitypub is disabled", slog.Any("err", err))
+		}
+	}
+
+	var hookClient *http.Client
+	if len(cfg.Hooks) > 0 {
+		hookClient = &http.Client{
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		}
+	}
+
+	var syncClient *http.Client
+	if cfg.Sync.Enabled {
+		syncClient = &http.Client{
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+			Timeout:   time.Duration(cfg.Sync.Timeout),
+		}
+	}
+
+	var oidcProvider *oidc.Provider
+	if cfg.Accounts.Enabled {
+		oidcProvider = &oidc.Provider{
+			Issuer:       cfg.Accounts.Issuer,
+			ClientID:     cfg.Accounts.ClientID,
+			ClientSecret: cfg.Accounts.ClientSecret,
+			Scopes:       cfg.Accounts.Scopes,
+			HTTPClient: &http.Client{
+				Transport: otelhttp.NewTransport(http.DefaultTransport),
+				Timeout:   10 * time.Second,
+			},
 		}
 	}
 
@@ -64,12 +120,37 @@ func NewServer(version ver.Version, debug bool, cfg Config, db database.DB, sign
 		cfg:                     cfg,
 		db:                      db,
 		client:                  client,
-		signer:                  signer,
+		fetchClient:             fetchClient,
+		gistClient:              gistClient,
+		federation:              federation,
+		activityPub:             activityPub,
+		syncClient:              syncClient,
+		hookClient:              hookClient,
+		oidc:                    oidcProvider,
+		jwtKeys:                 jwtKeys,
+		signer:                  jwtKeys.Signer(),
 		tracer:                  tracer,
 		assets:                  assets,
 		styles:                  allStyles,
 		htmlFormatter:           htmlFormatter,
 		standaloneHTMLFormatter: standaloneHTMLFormatter,
+		plugins:                 plugins,
+		summaryProvider:         summaryProvider,
+		featureFlags:            featureFlags,
+		ingestSource:            ingestSource,
+		secrets:                 secrets,
+	}
+
+	s.webhookContext, s.webhookCancel = context.WithCancel(context.Background())
+
+	// assets from disk can change at any time, so only the embedded assets are fingerprinted
+	if cfg.Assets.Dir == "" {
+		manifest, fingerprinted, err := newAssetManifest(assets)
+		if err != nil {
+			slog.Error("Failed to fingerprint assets", slog.Any("err", err))
+		}
+		s.assetManifest = manifest
+		s.fingerprintedAssets = fingerprinted
 	}
 
 	s.server = &http.Server{
@@ -78,41 +159,91 @@ func NewServer(version ver.Version, debug bool, cfg Config, db database.DB, sign
 	}
 
 	if cfg.RateLimit.Enabled {
-		s.rateLimitHandler = httprate.NewRateLimiter(
-			cfg.RateLimit.Requests,
-			time.Duration(cfg.RateLimit.Duration),
-			func(w http.ResponseWriter, r *http.Request) {
-				s.error(w, r, httperr.TooManyRequests(ErrRateLimit))
-			},
-		).Handler
+		s.newRateLimiters()
+	}
+	if cfg.UserAgents.Enabled {
+		s.newUserAgentRateLimiters()
+	}
+
+	if cfg.Webhook.Enabled {
+		s.loadWebhookClientCertificates()
 	}
 
 	return s
 }
 
 type Server struct {
-	version                 ver.Version
-	debug                   bool
-	cfg                     Config
-	db                      database.DB
-	server                  *http.Server
-	client                  *http.Client
-	signer                  jose.Signer
-	tracer                  trace.Tracer
-	assets                  http.FileSystem
-	htmlFormatter           *html.Formatter
-	standaloneHTMLFormatter *html.Formatter
-	styles                  []templates.Style
-	rateLimitHandler        func(http.Handler) http.Handler
-	webhookWaitGroup        sync.WaitGroup
-	cleanupCancel           context.CancelFunc
+	version                   ver.Version
+	debug                     bool
+	cfg                       Config
+	db                        database.DB
+	server                    *http.Server
+	client                    *http.Client
+	webhookClients            webhookClients
+	secrets                   *crypt.Envelope
+	fetchClient               *http.Client
+	gistClient                *gist.Client
+	federation                *federation
+	activityPub               *activityPub
+	openAPI                   []byte
+	syncClient                *http.Client
+	hookClient                *http.Client
+	oidc                      *oidc.Provider
+	jwtKeys                   *JWTKeys
+	signer                    jose.Signer
+	tracer                    trace.Tracer
+	assets                    fs.FS
+	assetManifest             templates.Assets
+	fingerprintedAssets       map[string]fingerprintedAsset
+	htmlFormatter             *html.Formatter
+	standaloneHTMLFormatter   *html.Formatter
+	plugins                   *Plugins
+	summaryProvider           summary.Provider
+	featureFlags              *featureflags.Flags
+	ingestSource              storage.Source
+	styles                    []templates.Style
+	reservedKeys              map[string]struct{}
+	rateLimitStore            httprate.Store
+	rateLimitHandler          func(http.Handler) http.Handler
+	readTokenRateLimitHandler func(http.Handler) http.Handler
+	rateLimitPolicies         map[rateLimitPolicy]func(http.Handler) http.Handler
+	userAgentRateLimiters     map[UserAgentClass]func(http.Handler) http.Handler
+	webhookWaitGroup          sync.WaitGroup
+	webhookContext            context.Context
+	webhookCancel             context.CancelFunc
+	cleanupCancel             context.CancelFunc
+	syncCancel                context.CancelFunc
+	ingestCancel              context.CancelFunc
+	syslog                    syslogReceiver
+	live                      liveStreams
+	updateLocks               documentLocks
 }
 
 func (s *Server) Start() {
 	cleanupContext, cancel := context.WithCancel(context.Background())
 	s.cleanupCancel = cancel
 
+	s.encryptSecrets()
 	go s.cleanup(cleanupContext, time.Duration(s.cfg.Database.CleanupInterval), time.Duration(s.cfg.Database.ExpireAfter))
+
+	if s.cfg.Sync.Enabled {
+		syncContext, cancel := context.WithCancel(context.Background())
+		s.syncCancel = cancel
+		go s.sync(syncContext, time.Duration(s.cfg.Sync.Interval))
+	}
+	if s.cfg.Ingest.Enabled && s.cfg.Ingest.PollInterval > 0 {
+		ingestContext, cancel := context.WithCancel(context.Background())
+		s.ingestCancel = cancel
+		go s.ingest(ingestContext, time.Duration(s.cfg.Ingest.PollInterval))
+	}
+	if s.cfg.Syslog.Enabled {
+		if err := s.startSyslog(); err != nil {
+			slog.Error("Error while starting syslog listener", slog.Any("err", err))
+		}
+	}
+	if s.cfg.Webhook.Enabled {
+		go s.resumeWebhookDeliveries()
+	}
 	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		slog.Error("Error while listening", slog.Any("err", err))
 	}
@@ -120,12 +251,27 @@ func (s *Server) Start() {
 
 func (s *Server) Close() {
 	s.cleanupCancel()
+	if s.syncCancel != nil {
+		s.syncCancel()
+	}
+	if s.ingestCancel != nil {
+		s.ingestCancel()
+	}
+	if s.cfg.Syslog.Enabled {
+		s.closeSyslog()
+	}
 
 	if err := s.server.Close(); err != nil {
 		slog.Error("Error while closing server", slog.Any("err", err))
 	}
 
+	s.webhookCancel()
 	s.webhookWaitGroup.Wait()
+	s.closeRateLimitStore()
+
+	if err := s.plugins.Close(context.Background()); err != nil {
+		slog.Error("Error while closing plugins", slog.Any("err", err))
+	}
 
 	if err := s.db.Close(); err != nil {
 		slog.Error("Error while closing database", slog.Any("err", err))
@@ -173,24 +319,183 @@ func (s *Server) doCleanup(ctx context.Context, expireAfter time.Duration) {
 		slog.ErrorContext(ctx, "failed to delete expired documents", slog.Any("err", err))
 	}
 
+	s.pruneDocuments(ctx)
+
+	if retention := time.Duration(s.cfg.Events.Retention); s.cfg.Events.Enabled && retention > 0 {
+		if err = s.db.DeleteEventsBefore(dbCtx, time.Now().Add(-retention)); err != nil && !errors.Is(err, context.Canceled) {
+			span.SetStatus(codes.Error, "failed to delete old events")
+			span.RecordError(err)
+			slog.ErrorContext(ctx, "failed to delete old events", slog.Any("err", err))
+		}
+	}
+
+	if retention := time.Duration(s.cfg.Tombstones.Retention); retention > 0 {
+		if err = s.db.DeleteTombstonesBefore(dbCtx, time.Now().Add(-retention)); err != nil && !errors.Is(err, context.Canceled) {
+			span.SetStatus(codes.Error, "failed to delete old tombstones")
+			span.RecordError(err)
+			slog.ErrorContext(ctx, "failed to delete old tombstones", slog.Any("err", err))
+		}
+	}
+
+	if s.summaryProvider != nil {
+		if err = s.db.DeleteOrphanedSummaries(dbCtx); err != nil && !errors.Is(err, context.Canceled) {
+			span.SetStatus(codes.Error, "failed to delete orphaned summaries")
+			span.RecordError(err)
+			slog.ErrorContext(ctx, "failed to delete orphaned summaries", slog.Any("err", err))
+		}
+	}
+
+	if err = s.db.DeleteOrphanedForks(dbCtx); err != nil && !errors.Is(err, context.Canceled) {
+		span.SetStatus(codes.Error, "failed to delete orphaned forks")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "failed to delete orphaned forks", slog.Any("err", err))
+	}
+
+	if err = s.db.DeleteOrphanedDocumentParts(dbCtx); err != nil && !errors.Is(err, context.Canceled) {
+		span.SetStatus(codes.Error, "failed to delete orphaned document parts")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "failed to delete orphaned document parts", slog.Any("err", err))
+	}
+
+	if err = s.db.DeleteExpiredDocumentLocks(dbCtx); err != nil && !errors.Is(err, context.Canceled) {
+		span.SetStatus(codes.Error, "failed to delete expired document locks")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "failed to delete expired document locks", slog.Any("err", err))
+	}
+
+	if err = s.db.DeleteOrphanedRevisions(dbCtx); err != nil && !errors.Is(err, context.Canceled) {
+		span.SetStatus(codes.Error, "failed to delete orphaned revisions")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "failed to delete orphaned revisions", slog.Any("err", err))
+	}
+
+	if err = s.db.DeleteOrphanedDocumentStyles(dbCtx); err != nil && !errors.Is(err, context.Canceled) {
+		span.SetStatus(codes.Error, "failed to delete orphaned document styles")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "failed to delete orphaned document styles", slog.Any("err", err))
+	}
+
+	if err = s.db.DeleteOrphanedDocumentTags(dbCtx); err != nil && !errors.Is(err, context.Canceled) {
+		span.SetStatus(codes.Error, "failed to delete orphaned document tags")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "failed to delete orphaned document tags", slog.Any("err", err))
+	}
+
+	if err = s.db.DeleteOrphanedVersionMessages(dbCtx); err != nil && !errors.Is(err, context.Canceled) {
+		span.SetStatus(codes.Error, "failed to delete orphaned version messages")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "failed to delete orphaned version messages", slog.Any("err", err))
+	}
+
+	if err = s.db.DeleteOrphanedFileSignatures(dbCtx); err != nil && !errors.Is(err, context.Canceled) {
+		span.SetStatus(codes.Error, "failed to delete orphaned file signatures")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "failed to delete orphaned file signatures", slog.Any("err", err))
+	}
+
+	// contents which were just stored are kept, their files might not be inserted yet
+	if err = s.db.DeleteOrphanedFileContents(dbCtx, time.Now().Add(-time.Hour)); err != nil && !errors.Is(err, context.Canceled) {
+		span.SetStatus(codes.Error, "failed to delete orphaned file contents")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "failed to delete orphaned file contents", slog.Any("err", err))
+	}
+
+	if err = s.db.DeleteExpiredDocumentInvites(dbCtx); err != nil && !errors.Is(err, context.Canceled) {
+		span.SetStatus(codes.Error, "failed to delete expired document invites")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "failed to delete expired document invites", slog.Any("err", err))
+	}
+
+	if err = s.db.DeleteExpiredDocumentShareTokens(dbCtx); err != nil && !errors.Is(err, context.Canceled) {
+		span.SetStatus(codes.Error, "failed to delete expired document share tokens")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "failed to delete expired document share tokens", slog.Any("err", err))
+	}
+
+	if err = s.db.DeleteExpiredRevokedTokens(dbCtx); err != nil && !errors.Is(err, context.Canceled) {
+		span.SetStatus(codes.Error, "failed to delete expired revoked tokens")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "failed to delete expired revoked tokens", slog.Any("err", err))
+	}
+
+	if err = s.db.DeleteOrphanedDocumentMembers(dbCtx); err != nil && !errors.Is(err, context.Canceled) {
+		span.SetStatus(codes.Error, "failed to delete orphaned document members")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "failed to delete orphaned document members", slog.Any("err", err))
+	}
+
+	if s.cfg.Accounts.Enabled {
+		if err = s.db.DeleteOrphanedAccountDocuments(dbCtx); err != nil && !errors.Is(err, context.Canceled) {
+			span.SetStatus(codes.Error, "failed to delete orphaned account documents")
+			span.RecordError(err)
+			slog.ErrorContext(ctx, "failed to delete orphaned account documents", slog.Any("err", err))
+		}
+
+		if err = s.db.DeleteExpiredAccountSessions(dbCtx); err != nil && !errors.Is(err, context.Canceled) {
+			span.SetStatus(codes.Error, "failed to delete expired account sessions")
+			span.RecordError(err)
+			slog.ErrorContext(ctx, "failed to delete expired account sessions", slog.Any("err", err))
+		}
+	}
+
+	if s.cfg.DeviceAuth.Enabled {
+		if err = s.db.DeleteExpiredDeviceAuthorizations(dbCtx); err != nil && !errors.Is(err, context.Canceled) {
+			span.SetStatus(codes.Error, "failed to delete expired device authorizations")
+			span.RecordError(err)
+			slog.ErrorContext(ctx, "failed to delete expired device authorizations", slog.Any("err", err))
+		}
+	}
+
+	if retention := time.Duration(s.cfg.Webhook.DeliveryRetention); s.cfg.Webhook.Enabled && retention > 0 {
+		if err = s.db.DeleteWebhookDeliveriesBefore(dbCtx, time.Now().Add(-retention)); err != nil && !errors.Is(err, context.Canceled) {
+			span.SetStatus(codes.Error, "failed to delete old webhook deliveries")
+			span.RecordError(err)
+			slog.ErrorContext(ctx, "failed to delete old webhook deliveries", slog.Any("err", err))
+		}
+	}
+
+	if s.cfg.Recent.Enabled {
+		if err = s.db.DeleteOrphanedCreatorDocuments(dbCtx); err != nil && !errors.Is(err, context.Canceled) {
+			span.SetStatus(codes.Error, "failed to delete orphaned creator documents")
+			span.RecordError(err)
+			slog.ErrorContext(ctx, "failed to delete orphaned creator documents", slog.Any("err", err))
+		}
+	}
+
 	var wg sync.WaitGroup
 	for i := range documents {
 		wg.Add(1)
 		go func(ctx context.Context, document database.Document) {
-			webhooksFiles := make([]WebhookDocumentFile, len(document.Files))
+			defer wg.Done()
+			s.RecordEvent(ctx, EventExpire, document.ID, document.Version, newEventData(document.Files))
+			s.publishLiveEvent(EventExpire, document.ID, document.Version)
+
+			webhooksFiles := make([]api.WebhookDocumentFile, len(document.Files))
 			for i, file := range document.Files {
-				webhooksFiles[i] = WebhookDocumentFile{
+				webhooksFiles[i] = api.WebhookDocumentFile{
 					Name:      file.Name,
 					Content:   file.Content,
 					Language:  file.Language,
+					Encrypted: file.Encrypted,
 					ExpiresAt: file.ExpiresAt,
 				}
 			}
-			s.ExecuteWebhooks(ctx, WebhookEventUpdate, WebhookDocument{
+
+			// the document is gone once all of its versions expired
+			event := WebhookEventUpdate
+			if versions, err := s.db.GetDocumentVersions(ctx, document.ID); err != nil {
+				slog.ErrorContext(ctx, "failed to get expired document versions", slog.Any("err", err))
+			} else if len(versions) == 0 {
+				event = WebhookEventDelete
+			}
+			s.ExecuteWebhooks(ctx, event, api.WebhookDocument{
 				Key:     document.ID,
 				Version: document.Version,
 				Files:   webhooksFiles,
 			})
+			if event == WebhookEventDelete {
+				s.activityPubDocumentDeleted(ctx, document.ID)
+			}
 		}(ctx, documents[i])
 	}
 	wg.Wait()
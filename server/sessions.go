@@ -0,0 +1,123 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+var ErrAccountSessionNotFound = errors.New("session not found")
+
+type (
+	AccountSessionsResponse struct {
+		Sessions []AccountSessionResponse `json:"sessions"`
+	}
+
+	AccountSessionResponse struct {
+		ID string `json:"id"`
+		// Kind is browser for logins in the web UI and token for tokens of the CLI and API clients.
+		Kind       string    `json:"kind"`
+		UserAgent  string    `json:"user_agent"`
+		Address    string    `json:"address"`
+		CreatedAt  time.Time `json:"created_at"`
+		LastUsedAt time.Time `json:"last_used_at"`
+		ExpiresAt  time.Time `json:"expires_at"`
+		// Current is set for the session of the request.
+		Current bool `json:"current"`
+	}
+)
+
+// GetAccountSessions lists the browser logins and tokens of the logged-in account from the most recently used to the
+// oldest.
+func (s *Server) GetAccountSessions(w http.ResponseWriter, r *http.Request) {
+	session, err := s.requireAccountSession(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	sessions, err := s.db.GetAccountSessions(r.Context(), session.AccountID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	response := AccountSessionsResponse{
+		Sessions: make([]AccountSessionResponse, len(sessions)),
+	}
+	for i, accountSession := range sessions {
+		response.Sessions[i] = newAccountSessionResponse(accountSession, session.ID)
+	}
+	s.ok(w, r, response)
+}
+
+// DeleteAccountSession revokes a browser login or token of the logged-in account, it stops working immediately.
+func (s *Server) DeleteAccountSession(w http.ResponseWriter, r *http.Request) {
+	session, err := s.requireAccountSession(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	if err = s.db.DeleteAccountSession(r.Context(), session.AccountID, chi.URLParam(r, "sessionID")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrAccountSessionNotFound))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, nil)
+}
+
+// DeleteAccountSessions revokes all browser logins and tokens of the logged-in account except the one of the request.
+func (s *Server) DeleteAccountSessions(w http.ResponseWriter, r *http.Request) {
+	session, err := s.requireAccountSession(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	if err = s.db.DeleteOtherAccountSessions(r.Context(), session.AccountID, session.ID); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, nil)
+}
+
+// requireAccountSession returns the session of the logged-in account or an error if accounts are disabled, nobody is
+// logged in or the login lacks the second factor the instance requires.
+func (s *Server) requireAccountSession(r *http.Request) (*database.AccountSession, error) {
+	if !s.cfg.Accounts.Enabled {
+		return nil, httperr.NotFound(ErrAccountsDisabled)
+	}
+	session := s.lookupAccountSession(r)
+	if session == nil {
+		return nil, httperr.Unauthorized(ErrNotLoggedIn)
+	}
+	if s.cfg.Accounts.RequireTwoFactor && !session.TwoFactor {
+		return nil, httperr.Forbidden(ErrTwoFactorRequired)
+	}
+	return session, nil
+}
+
+func newAccountSessionResponse(session database.AccountSession, currentID string) AccountSessionResponse {
+	return AccountSessionResponse{
+		ID:         session.ID,
+		Kind:       session.Kind,
+		UserAgent:  session.UserAgent,
+		Address:    session.Address,
+		CreatedAt:  session.CreatedAt,
+		LastUsedAt: session.LastUsedAt,
+		ExpiresAt:  session.ExpiresAt,
+		Current:    session.ID == currentID,
+	}
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/topi314/chroma/v2/lexers"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+	"github.com/topi314/gobin/v3/server/templates"
+)
+
+const (
+	EditorKeymapDefault = "default"
+	EditorKeymapEmacs   = "emacs"
+	EditorKeymapBrowser = "browser"
+)
+
+var (
+	ErrUnknownEditorKeymap  = errors.New("unknown editor keymap, must be default, emacs or browser")
+	ErrUnknownLanguage      = errors.New("unknown language")
+	ErrInvalidDefaultExpiry = errors.New("invalid default expiry, must be a positive duration like 24h")
+)
+
+// getUserSettings returns the settings of the creator id of the request or nil if it has none.
+func (s *Server) getUserSettings(r *http.Request) *database.UserSettings {
+	creatorID := s.getCreatorID(r)
+	if creatorID == "" {
+		return nil
+	}
+	settings, err := s.db.GetUserSettings(r.Context(), creatorID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(r.Context(), "failed to get user settings", slog.Any("err", err))
+		}
+		return nil
+	}
+	return settings
+}
+
+// applyUserSettings sets the default expiry of the settings on files without an expiry and the default language on
+// files whose language was neither given nor detected.
+func applyUserSettings(settings *database.UserSettings, file *api.RequestFile, language string) {
+	if settings == nil {
+		return
+	}
+	if file.ExpiresAt == nil && settings.DefaultExpiry != "" {
+		if ttl, err := time.ParseDuration(settings.DefaultExpiry); err == nil {
+			expiresAt := time.Now().Add(ttl)
+			file.ExpiresAt = &expiresAt
+		}
+	}
+	if language == "" && file.Language == "plaintext" && settings.DefaultLanguage != "" {
+		file.Language = settings.DefaultLanguage
+	}
+}
+
+func newUserSettingsResponse(settings *database.UserSettings) api.UserSettingsResponse {
+	if settings == nil {
+		return api.UserSettingsResponse{
+			EditorKeymap: EditorKeymapDefault,
+		}
+	}
+	return api.UserSettingsResponse{
+		DefaultStyle:    settings.DefaultStyle,
+		DefaultExpiry:   settings.DefaultExpiry,
+		EditorKeymap:    settings.EditorKeymap,
+		DefaultLanguage: settings.DefaultLanguage,
+		UpdatedAt:       &settings.UpdatedAt,
+	}
+}
+
+// GetUserSettings returns the settings of the browser or the creator token, users without settings get the defaults.
+func (s *Server) GetUserSettings(w http.ResponseWriter, r *http.Request) {
+	s.ok(w, r, newUserSettingsResponse(s.getUserSettings(r)))
+}
+
+// PutUserSettings replaces the settings of the browser or the creator token. Browsers without a creator cookie get a new
+// anonymous id.
+func (s *Server) PutUserSettings(w http.ResponseWriter, r *http.Request) {
+	var settingsRequest api.UserSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&settingsRequest); err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+
+	settings, err := newUserSettings(settingsRequest)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	settings.CreatorID = s.getCreatorID(r)
+	if settings.CreatorID == "" {
+		if settings.CreatorID, err = s.newCreatorID(w); err != nil {
+			s.error(w, r, err)
+			return
+		}
+	}
+
+	if err = s.db.SetUserSettings(r.Context(), *settings); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, newUserSettingsResponse(settings))
+}
+
+// DeleteUserSettings resets the settings of the browser or the creator token to the defaults.
+func (s *Server) DeleteUserSettings(w http.ResponseWriter, r *http.Request) {
+	if creatorID := s.getCreatorID(r); creatorID != "" {
+		if err := s.db.DeleteUserSettings(r.Context(), creatorID); err != nil {
+			s.error(w, r, err)
+			return
+		}
+	}
+	s.ok(w, r, nil)
+}
+
+// PostUserToken returns a creator token for the anonymous id of the browser, so the CLI and API clients can use the
+// same settings and recent documents. Requests without a creator id get a new one. Logged-in accounts get an account
+// token instead, which also grants access to the documents of the account. Logins without the second factor the
+// instance requires get no token at all.
+func (s *Server) PostUserToken(w http.ResponseWriter, r *http.Request) {
+	if s.lookupAccountSession(r) != nil {
+		session, err := s.requireAccountSession(r)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+		token, _, err := s.newAccountToken(r, session.AccountID, AccountSessionKindToken, session.TwoFactor)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+		s.ok(w, r, api.UserTokenResponse{Token: token})
+		return
+	}
+
+	creatorID := s.getCreatorID(r)
+	if creatorID == "" {
+		var err error
+		if creatorID, err = s.newCreatorID(w); err != nil {
+			s.error(w, r, err)
+			return
+		}
+	}
+
+	token, err := s.newCreatorToken(creatorID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, api.UserTokenResponse{Token: token})
+}
+
+// newUserSettings validates the settings and normalizes the language to the name of its lexer.
+func newUserSettings(settingsRequest api.UserSettingsRequest) (*database.UserSettings, error) {
+	if err := validateDocumentStyle(settingsRequest.DefaultStyle); err != nil {
+		return nil, err
+	}
+
+	if settingsRequest.DefaultExpiry != "" {
+		ttl, err := time.ParseDuration(settingsRequest.DefaultExpiry)
+		if err != nil || ttl <= 0 {
+			return nil, httperr.BadRequest(ErrInvalidDefaultExpiry)
+		}
+	}
+
+	switch settingsRequest.EditorKeymap {
+	case "":
+		settingsRequest.EditorKeymap = EditorKeymapDefault
+	case EditorKeymapDefault, EditorKeymapEmacs, EditorKeymapBrowser:
+	default:
+		return nil, httperr.BadRequest(ErrUnknownEditorKeymap)
+	}
+
+	if settingsRequest.DefaultLanguage != "" {
+		lexer := lexers.Get(settingsRequest.DefaultLanguage)
+		if lexer == nil {
+			return nil, httperr.BadRequest(ErrUnknownLanguage)
+		}
+		settingsRequest.DefaultLanguage = lexer.Config().Name
+	}
+
+	return &database.UserSettings{
+		DefaultStyle:    settingsRequest.DefaultStyle,
+		DefaultExpiry:   settingsRequest.DefaultExpiry,
+		EditorKeymap:    settingsRequest.EditorKeymap,
+		DefaultLanguage: settingsRequest.DefaultLanguage,
+		UpdatedAt:       time.Now(),
+	}, nil
+}
+
+// GetPrettySettings renders the page to edit the settings of the browser.
+func (s *Server) GetPrettySettings(w http.ResponseWriter, r *http.Request) {
+	settings := s.getUserSettings(r)
+	style := s.getDocumentStyle(r, settings, "")
+
+	settingsResponse := newUserSettingsResponse(settings)
+	vars := templates.SettingsVars{
+		DefaultStyle:    settingsResponse.DefaultStyle,
+		DefaultExpiry:   settingsResponse.DefaultExpiry,
+		EditorKeymap:    settingsResponse.EditorKeymap,
+		DefaultLanguage: settingsResponse.DefaultLanguage,
+		EditorKeymaps:   []string{EditorKeymapDefault, EditorKeymapEmacs, EditorKeymapBrowser},
+		Lexers:          lexers.Names(false),
+		Styles:          s.styles,
+		Style:           style.Name,
+		Theme:           style.Theme,
+		Assets:          s.assetManifest,
+	}
+
+	if session := s.lookupAccountSession(r); session != nil {
+		if err := s.setSettingsTwoFactor(r, &vars, session); err != nil {
+			s.prettyError(w, r, err)
+			return
+		}
+		sessions, err := s.db.GetAccountSessions(r.Context(), session.AccountID)
+		if err != nil {
+			s.prettyError(w, r, err)
+			return
+		}
+		vars.LoggedIn = true
+		vars.Sessions = make([]templates.SettingsSession, len(sessions))
+		for i, accountSession := range sessions {
+			vars.Sessions[i] = templates.SettingsSession{
+				ID:        accountSession.ID,
+				Kind:      accountSession.Kind,
+				UserAgent: accountSession.UserAgent,
+				Address:   accountSession.Address,
+				CreatedAt: accountSession.CreatedAt.Format(VersionTimeFormat),
+				LastUsed:  accountSession.LastUsedAt.Format(VersionTimeFormat),
+				Current:   accountSession.ID == session.ID,
+			}
+		}
+	}
+
+	setColorSchemeHints(w)
+	if err := templates.Settings(vars).Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "failed to execute template", slog.Any("err", err))
+	}
+}
+
+// setSettingsTwoFactor adds the second factors of the account to the settings page.
+func (s *Server) setSettingsTwoFactor(r *http.Request, vars *templates.SettingsVars, session *database.AccountSession) error {
+	twoFactor, err := s.getAccountTwoFactor(r, session.AccountID)
+	if err != nil {
+		return err
+	}
+	passkeys, err := s.db.GetAccountPasskeys(r.Context(), session.AccountID)
+	if err != nil {
+		return err
+	}
+	if vars.RecoveryCodes, err = s.db.GetAccountRecoveryCodeCount(r.Context(), session.AccountID); err != nil {
+		return err
+	}
+
+	vars.TwoFactorRequired = s.cfg.Accounts.RequireTwoFactor && !session.TwoFactor
+	vars.TOTP = twoFactor.TOTPEnabled
+	vars.Passkeys = make([]templates.SettingsPasskey, len(passkeys))
+	for i, passkey := range passkeys {
+		lastUsed := "never"
+		if passkey.LastUsedAt != nil {
+			lastUsed = passkey.LastUsedAt.Format(VersionTimeFormat)
+		}
+		vars.Passkeys[i] = templates.SettingsPasskey{
+			ID:        passkey.ID,
+			Name:      passkey.Name,
+			CreatedAt: passkey.CreatedAt.Format(VersionTimeFormat),
+			LastUsed:  lastUsed,
+		}
+	}
+	return nil
+}
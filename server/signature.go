@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/flags"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/internal/signature"
+	"github.com/topi314/gobin/v3/server/database"
+	"github.com/topi314/gobin/v3/server/templates"
+)
+
+// maxSignatureRequestSize limits the body of signature requests, PGP keys with many certifications can be large.
+const maxSignatureRequestSize = 1024 * 1024
+
+var ErrFileSignatureNotFound = errors.New("file signature not found")
+
+type (
+	FileSignatureRequest struct {
+		// Format is minisign or pgp, it is detected from the signature if it is empty.
+		Format    string `json:"format"`
+		PublicKey string `json:"public_key"`
+		Signature string `json:"signature"`
+	}
+)
+
+func newFileSignatureResponse(fileSignature database.FileSignature) *api.FileSignatureResponse {
+	return &api.FileSignatureResponse{
+		Format:    fileSignature.Format,
+		KeyID:     fileSignature.KeyID,
+		Comment:   fileSignature.Comment,
+		PublicKey: fileSignature.PublicKey,
+		Signature: fileSignature.Signature,
+		Verified:  true,
+		CreatedAt: fileSignature.CreatedAt,
+	}
+}
+
+func templateSignature(fileSignature *api.FileSignatureResponse) *templates.Signature {
+	if fileSignature == nil {
+		return nil
+	}
+	return &templates.Signature{
+		Format:  fileSignature.Format,
+		KeyID:   fileSignature.KeyID,
+		Comment: fileSignature.Comment,
+	}
+}
+
+// getFileSignatures returns the signatures of the files of the document version by file name.
+func (s *Server) getFileSignatures(ctx context.Context, documentID string, documentVersion int64) (map[string]*api.FileSignatureResponse, error) {
+	fileSignatures, err := s.db.GetFileSignatures(ctx, documentID, documentVersion)
+	if err != nil {
+		return nil, err
+	}
+	signatures := make(map[string]*api.FileSignatureResponse, len(fileSignatures))
+	for _, fileSignature := range fileSignatures {
+		signatures[fileSignature.FileName] = newFileSignatureResponse(fileSignature)
+	}
+	return signatures, nil
+}
+
+// GetDocumentFileSignature returns the signature of the file version.
+func (s *Server) GetDocumentFileSignature(w http.ResponseWriter, r *http.Request) {
+	file, err := s.getDocumentFile(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	signatures, err := s.getFileSignatures(r.Context(), file.DocumentID, file.DocumentVersion)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	fileSignature, ok := signatures[file.Name]
+	if !ok {
+		s.error(w, r, httperr.NotFound(ErrFileSignatureNotFound))
+		return
+	}
+	s.ok(w, r, fileSignature)
+}
+
+// PutDocumentFileSignature verifies the detached signature of the file version with the public key of the signer and
+// attaches it to the file version. A signature of the file version is replaced.
+func (s *Server) PutDocumentFileSignature(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionWrite) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+		return
+	}
+
+	var signatureRq FileSignatureRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxSignatureRequestSize)).Decode(&signatureRq); err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+	if signatureRq.Format != "" && !slices.Contains(signature.Formats, signatureRq.Format) {
+		s.error(w, r, httperr.BadRequest(signature.ErrUnknownFormat))
+		return
+	}
+
+	file, err := s.getDocumentFile(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if file.Encrypted {
+		s.error(w, r, httperr.BadRequest(ErrFileEncrypted))
+		return
+	}
+
+	signer, err := signature.Verify(signatureRq.Format, signatureRq.PublicKey, signatureRq.Signature, []byte(file.Content))
+	if err != nil {
+		if errors.Is(err, signature.ErrKeyMismatch) || errors.Is(err, signature.ErrVerificationFailed) {
+			s.error(w, r, httperr.UnprocessableEntity(err))
+			return
+		}
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+
+	fileSignature := database.FileSignature{
+		DocumentID:      file.DocumentID,
+		DocumentVersion: file.DocumentVersion,
+		FileName:        file.Name,
+		Format:          signer.Format,
+		PublicKey:       signatureRq.PublicKey,
+		Signature:       signatureRq.Signature,
+		KeyID:           signer.KeyID,
+		Comment:         signer.Comment,
+		CreatedAt:       time.Now(),
+	}
+	if err = s.db.SetFileSignature(r.Context(), fileSignature); err != nil {
+		s.error(w, r, err)
+		return
+	}
+	s.ok(w, r, newFileSignatureResponse(fileSignature))
+}
+
+// DeleteDocumentFileSignature removes the signature of the file version.
+func (s *Server) DeleteDocumentFileSignature(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionWrite) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+		return
+	}
+
+	file, err := s.getDocumentFile(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	if err = s.db.DeleteFileSignature(r.Context(), file.DocumentID, file.DocumentVersion, file.Name); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrFileSignatureNotFound))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+	s.ok(w, r, nil)
+}
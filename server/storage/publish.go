@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Publisher uploads the static pages and files of published documents.
+type Publisher interface {
+	// Publish writes the content to the slash separated name.
+	Publish(ctx context.Context, name string, contentType string, content []byte) error
+}
+
+// NewDirPublisher returns a Publisher which writes the files to the directory.
+func NewDirPublisher(dir string) Publisher {
+	return &dirPublisher{dir: dir}
+}
+
+// NewS3Publisher returns a Publisher which uploads the files to the bucket, for example to host them as S3 website.
+func NewS3Publisher(cfg S3Config) (Publisher, error) {
+	s3, err := newS3Storage(cfg, &http.Client{
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+		Timeout:   time.Duration(cfg.Timeout),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s3, nil
+}
+
+type dirPublisher struct {
+	dir string
+}
+
+func (p *dirPublisher) Publish(_ context.Context, name string, _ string, content []byte) error {
+	path := filepath.Join(p.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return nil
+}
+
+// Publish uploads the content with its content type, so the bucket can serve it as website.
+func (s *s3Storage) Publish(ctx context.Context, name string, contentType string, content []byte) error {
+	rs, err := s.do(ctx, http.MethodPut, s.cfg.Prefix+name, nil, contentType, content)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rs.Body.Close()
+	}()
+
+	if rs.StatusCode != http.StatusOK {
+		return newS3Error(rs)
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm   = "AWS4-HMAC-SHA256"
+	s3Service     = "s3"
+	s3TimeFormat  = "20060102T150405Z"
+	s3DateFormat  = "20060102"
+	s3EmptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+type s3ListResponse struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		ETag string `xml:"ETag"`
+		Size int64  `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func newS3Storage(cfg S3Config, client *http.Client) (*s3Storage, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse s3 endpoint: %w", err)
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, errors.New("invalid s3 endpoint, must be an absolute url like https://s3.eu-central-1.amazonaws.com")
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3 bucket is required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	return &s3Storage{
+		cfg:      cfg,
+		client:   client,
+		endpoint: endpoint,
+		now:      time.Now,
+	}, nil
+}
+
+// s3Storage stores objects with the S3 REST API, requests are signed with AWS Signature Version 4.
+type s3Storage struct {
+	cfg      S3Config
+	client   *http.Client
+	endpoint *url.URL
+	now      func() time.Time
+}
+
+func (s *s3Storage) Get(ctx context.Context, key string) (string, error) {
+	rs, err := s.do(ctx, http.MethodGet, s.cfg.Prefix+key, nil, "", nil)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = rs.Body.Close()
+	}()
+
+	if rs.StatusCode == http.StatusNotFound {
+		return "", ErrNotFound
+	}
+	if rs.StatusCode != http.StatusOK {
+		return "", newS3Error(rs)
+	}
+
+	data, err := io.ReadAll(rs.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read s3 object: %w", err)
+	}
+	return string(data), nil
+}
+
+func (s *s3Storage) Put(ctx context.Context, key string, content string) error {
+	rs, err := s.do(ctx, http.MethodPut, s.cfg.Prefix+key, nil, "", []byte(content))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rs.Body.Close()
+	}()
+
+	if rs.StatusCode != http.StatusOK {
+		return newS3Error(rs)
+	}
+	return nil
+}
+
+func (s *s3Storage) Delete(ctx context.Context, key string) error {
+	rs, err := s.do(ctx, http.MethodDelete, s.cfg.Prefix+key, nil, "", nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rs.Body.Close()
+	}()
+
+	if rs.StatusCode != http.StatusNoContent && rs.StatusCode != http.StatusOK && rs.StatusCode != http.StatusNotFound {
+		return newS3Error(rs)
+	}
+	return nil
+}
+
+func (s *s3Storage) List(ctx context.Context, prefix string) ([]string, error) {
+	var (
+		keys              []string
+		continuationToken string
+	)
+	for {
+		query := url.Values{
+			"list-type": {"2"},
+			"prefix":    {s.cfg.Prefix + prefix},
+		}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+
+		listRs, err := s.list(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, content := range listRs.Contents {
+			keys = append(keys, strings.TrimPrefix(content.Key, s.cfg.Prefix))
+		}
+		if !listRs.IsTruncated || listRs.NextContinuationToken == "" {
+			return keys, nil
+		}
+		continuationToken = listRs.NextContinuationToken
+	}
+}
+
+func (s *s3Storage) list(ctx context.Context, query url.Values) (*s3ListResponse, error) {
+	rs, err := s.do(ctx, http.MethodGet, "", query, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rs.Body.Close()
+	}()
+
+	if rs.StatusCode != http.StatusOK {
+		return nil, newS3Error(rs)
+	}
+
+	var listRs s3ListResponse
+	if err = xml.NewDecoder(rs.Body).Decode(&listRs); err != nil {
+		return nil, fmt.Errorf("failed to decode s3 list response: %w", err)
+	}
+	return &listRs, nil
+}
+
+func (s *s3Storage) do(ctx context.Context, method string, key string, query url.Values, contentType string, body []byte) (*http.Response, error) {
+	host := s.endpoint.Host
+	path := s.endpoint.Path
+	if s.cfg.PathStyle {
+		path += "/" + s.cfg.Bucket
+	} else {
+		host = s.cfg.Bucket + "." + host
+	}
+	if key != "" || path == "" {
+		path += "/" + key
+	}
+
+	rawPath := s3Escape(path, false)
+	rawQuery := s3CanonicalQuery(query)
+	uri := s.endpoint.Scheme + "://" + host + rawPath
+	if rawQuery != "" {
+		uri += "?" + rawQuery
+	}
+
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	rq, err := http.NewRequestWithContext(ctx, method, uri, bodyReader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 request: %w", err)
+	}
+	if contentType != "" {
+		rq.Header.Set("Content-Type", contentType)
+	}
+	s.sign(rq, rawPath, rawQuery, body)
+
+	rs, err := s.client.Do(rq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute s3 request: %w", err)
+	}
+	return rs, nil
+}
+
+// sign adds the authorization header of AWS Signature Version 4 to the request. All headers of the request are signed.
+func (s *s3Storage) sign(rq *http.Request, rawPath string, rawQuery string, body []byte) {
+	now := s.now().UTC()
+	payloadHash := s3EmptySHA256
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+	rq.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	rq.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{
+		"host": rq.URL.Host,
+	}
+	for name, values := range rq.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		rq.Method,
+		rawPath,
+		rawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := now.Format(s3DateFormat) + "/" + s.cfg.Region + "/" + s3Service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		now.Format(s3TimeFormat),
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+
+	key := s3HMAC([]byte("AWS4"+s.cfg.SecretAccessKey), now.Format(s3DateFormat))
+	key = s3HMAC(key, s.cfg.Region)
+	key = s3HMAC(key, s3Service)
+	key = s3HMAC(key, "aws4_request")
+	signature := hex.EncodeToString(s3HMAC(key, stringToSign))
+
+	rq.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm,
+		s.cfg.AccessKeyID,
+		scope,
+		signedHeaders,
+		signature,
+	))
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3CanonicalQuery encodes the query sorted by key like the signature expects it.
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var params []string
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, s3Escape(key, true)+"="+s3Escape(value, true))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// s3Escape percent encodes everything except unreserved characters, slashes are only encoded if encodeSlash is true.
+func s3Escape(str string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(str); i++ {
+		c := str[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !encodeSlash {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func newS3Error(rs *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(rs.Body, 1024))
+	return fmt.Errorf("s3 returned status %d: %s", rs.StatusCode, strings.TrimSpace(string(data)))
+}
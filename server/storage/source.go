@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"github.com/topi314/gobin/v3/internal/gio"
+)
+
+var ErrObjectTooLarge = errors.New("object too large")
+
+// Object is an object of a bucket, its ETag changes when the object is uploaded again.
+type Object struct {
+	Key  string
+	ETag string
+	Size int64
+}
+
+// ObjectContent is the content of an object with its media type.
+type ObjectContent struct {
+	Object
+	ContentType string
+	Content     []byte
+}
+
+// Source reads the objects of a bucket which are ingested as documents.
+type Source interface {
+	// ListObjects returns all objects whose key starts with the prefix of the config.
+	ListObjects(ctx context.Context) ([]Object, error)
+	// GetObject returns the content of the object, ErrNotFound or ErrObjectTooLarge if the object is larger than
+	// maxSize. A maxSize of 0 reads objects of any size.
+	GetObject(ctx context.Context, key string, maxSize int64) (*ObjectContent, error)
+}
+
+// NewS3Source returns a source for the bucket of the config. Unlike the storage, the keys of the source are the full
+// object keys including the prefix.
+func NewS3Source(cfg S3Config) (Source, error) {
+	s3, err := newS3Storage(cfg, &http.Client{
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+		Timeout:   time.Duration(cfg.Timeout),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s3, nil
+}
+
+func (s *s3Storage) ListObjects(ctx context.Context) ([]Object, error) {
+	var (
+		objects           []Object
+		continuationToken string
+	)
+	for {
+		query := url.Values{
+			"list-type": {"2"},
+			"prefix":    {s.cfg.Prefix},
+		}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+
+		listRs, err := s.list(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, content := range listRs.Contents {
+			objects = append(objects, Object{
+				Key:  content.Key,
+				ETag: strings.Trim(content.ETag, `"`),
+				Size: content.Size,
+			})
+		}
+		if !listRs.IsTruncated || listRs.NextContinuationToken == "" {
+			return objects, nil
+		}
+		continuationToken = listRs.NextContinuationToken
+	}
+}
+
+func (s *s3Storage) GetObject(ctx context.Context, key string, maxSize int64) (*ObjectContent, error) {
+	rs, err := s.do(ctx, http.MethodGet, key, nil, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rs.Body.Close()
+	}()
+
+	if rs.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if rs.StatusCode != http.StatusOK {
+		return nil, newS3Error(rs)
+	}
+
+	reader := io.Reader(rs.Body)
+	if maxSize > 0 {
+		reader = gio.LimitReader(rs.Body, maxSize)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		if errors.Is(err, gio.ErrLimitReached) {
+			return nil, ErrObjectTooLarge
+		}
+		return nil, fmt.Errorf("failed to read s3 object: %w", err)
+	}
+
+	var contentType string
+	if rsContentType := rs.Header.Get("Content-Type"); rsContentType != "" {
+		contentType, _, _ = mime.ParseMediaType(rsContentType)
+	}
+	return &ObjectContent{
+		Object: Object{
+			Key:  key,
+			ETag: strings.Trim(rs.Header.Get("ETag"), `"`),
+			Size: int64(len(data)),
+		},
+		ContentType: contentType,
+		Content:     data,
+	}, nil
+}
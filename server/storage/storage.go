@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"github.com/topi314/gobin/v3/internal/timex"
+)
+
+type Type string
+
+const (
+	TypeDatabase Type = "database"
+	TypeS3       Type = "s3"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+type Config struct {
+	Type Type     `toml:"type"`
+	S3   S3Config `toml:"s3"`
+}
+
+func (c Config) String() string {
+	str := fmt.Sprintf("\n  Type: %s", c.Type)
+	switch c.Type {
+	case TypeDatabase:
+	case TypeS3:
+		str += fmt.Sprintf("\n  S3: %s", c.S3)
+	default:
+		str += "\n  Invalid storage type!"
+	}
+	return str
+}
+
+type S3Config struct {
+	// Endpoint is the url of the S3 compatible API like https://s3.eu-central-1.amazonaws.com.
+	Endpoint        string `toml:"endpoint"`
+	Region          string `toml:"region"`
+	Bucket          string `toml:"bucket"`
+	AccessKeyID     string `toml:"access_key_id"`
+	SecretAccessKey string `toml:"secret_access_key"`
+	// PathStyle puts the bucket into the path instead of the host, MinIO needs this.
+	PathStyle bool `toml:"path_style"`
+	// Prefix is put in front of every object key.
+	Prefix  string         `toml:"prefix"`
+	Timeout timex.Duration `toml:"timeout"`
+}
+
+func (c S3Config) String() string {
+	return fmt.Sprintf("\n    Endpoint: %s\n    Region: %s\n    Bucket: %s\n    AccessKeyID: %s\n    SecretAccessKey: %s\n    PathStyle: %t\n    Prefix: %s\n    Timeout: %s",
+		c.Endpoint,
+		c.Region,
+		c.Bucket,
+		c.AccessKeyID,
+		strings.Repeat("*", len(c.SecretAccessKey)),
+		c.PathStyle,
+		c.Prefix,
+		time.Duration(c.Timeout),
+	)
+}
+
+// Storage keeps the content of document files outside the database.
+type Storage interface {
+	// Get returns the content of the object or ErrNotFound.
+	Get(ctx context.Context, key string) (string, error)
+	Put(ctx context.Context, key string, content string) error
+	// Delete removes the object, deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+	// List returns the keys of all objects starting with the prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// New returns the storage for the config, nil means the content stays in the database.
+func New(cfg Config) (Storage, error) {
+	switch cfg.Type {
+	case TypeDatabase, "":
+		return nil, nil
+	case TypeS3:
+		return newS3Storage(cfg.S3, &http.Client{
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+			Timeout:   time.Duration(cfg.S3.Timeout),
+		})
+	default:
+		return nil, errors.New("invalid storage type, must be one of: database, s3")
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+var ErrSummaryDisabled = errors.New("document summaries disabled")
+
+type SummaryResponse struct {
+	Key       string    `json:"key"`
+	Version   int64     `json:"version"`
+	Summary   string    `json:"summary"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (s *Server) GetDocumentSummary(w http.ResponseWriter, r *http.Request) {
+	if s.summaryProvider == nil {
+		s.error(w, r, httperr.NotFound(ErrSummaryDisabled))
+		return
+	}
+
+	document, err := s.getDocument(r, nil)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if slices.ContainsFunc(document.Files, isEncrypted) {
+		s.error(w, r, httperr.BadRequest(ErrFileEncrypted))
+		return
+	}
+	version := document.Files[0].DocumentVersion
+
+	ctx, span := s.tracer.Start(r.Context(), "getDocumentSummary", trace.WithAttributes(
+		attribute.String("document_id", document.ID),
+		attribute.Int64("version", version),
+	))
+	defer span.End()
+
+	summary, err := s.db.GetSummary(ctx, document.ID, version)
+	if err == nil {
+		s.ok(w, r, SummaryResponse{
+			Key:       document.ID,
+			Version:   version,
+			Summary:   summary.Summary,
+			CreatedAt: summary.CreatedAt,
+		})
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		s.error(w, r, err)
+		return
+	}
+
+	text, err := s.summaryProvider.Summarize(ctx, s.summaryInput(document.Files))
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to summarize document")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "failed to summarize document", slog.String("document_id", document.ID), slog.Any("err", err))
+		s.error(w, r, httperr.BadGateway(fmt.Errorf("failed to summarize document: %w", err)))
+		return
+	}
+
+	newSummary := database.Summary{
+		DocumentID:      document.ID,
+		DocumentVersion: version,
+		Summary:         text,
+		CreatedAt:       time.Now(),
+	}
+	if err = s.db.CreateSummary(ctx, newSummary); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, SummaryResponse{
+		Key:       newSummary.DocumentID,
+		Version:   newSummary.DocumentVersion,
+		Summary:   newSummary.Summary,
+		CreatedAt: newSummary.CreatedAt,
+	})
+}
+
+// summaryInput joins all files of a document into a single prompt input which is cut off after summary.max_input_size characters.
+func (s *Server) summaryInput(files []database.File) string {
+	var sb strings.Builder
+	for _, file := range files {
+		sb.WriteString(fmt.Sprintf("File: %s (%s)\n```\n%s\n```\n\n", file.Name, file.Language, file.Content))
+	}
+
+	input := []rune(sb.String())
+	if maxSize := s.cfg.Summary.MaxInputSize; maxSize > 0 && len(input) > maxSize {
+		input = input[:maxSize]
+	}
+	return string(input)
+}
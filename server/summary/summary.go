@@ -0,0 +1,185 @@
+package summary
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/timex"
+)
+
+type Type string
+
+const (
+	TypeOpenAI   Type = "openai"
+	TypeLlamaCpp Type = "llamacpp"
+)
+
+const DefaultPrompt = "Summarize the following paste in a few sentences. Explain what it is, what it does and point out any errors or stack traces it contains."
+
+type Config struct {
+	Enabled      bool           `toml:"enabled"`
+	Type         Type           `toml:"type"`
+	URL          string         `toml:"url"`
+	APIKey       string         `toml:"api_key"`
+	Model        string         `toml:"model"`
+	Prompt       string         `toml:"prompt"`
+	MaxTokens    int            `toml:"max_tokens"`
+	MaxInputSize int            `toml:"max_input_size"`
+	Timeout      timex.Duration `toml:"timeout"`
+}
+
+func (c Config) String() string {
+	return fmt.Sprintf("\n  Enabled: %t\n  Type: %s\n  URL: %s\n  APIKey: %s\n  Model: %s\n  Prompt: %s\n  MaxTokens: %d\n  MaxInputSize: %d\n  Timeout: %s",
+		c.Enabled,
+		c.Type,
+		c.URL,
+		strings.Repeat("*", len(c.APIKey)),
+		c.Model,
+		c.Prompt,
+		c.MaxTokens,
+		c.MaxInputSize,
+		time.Duration(c.Timeout),
+	)
+}
+
+// Provider generates a short summary of a document.
+type Provider interface {
+	Summarize(ctx context.Context, content string) (string, error)
+}
+
+func New(cfg Config) (Provider, error) {
+	client := &http.Client{
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+		Timeout:   time.Duration(cfg.Timeout),
+	}
+	prompt := cfg.Prompt
+	if prompt == "" {
+		prompt = DefaultPrompt
+	}
+
+	switch cfg.Type {
+	case TypeOpenAI:
+		return &openAIProvider{cfg: cfg, prompt: prompt, client: client}, nil
+	case TypeLlamaCpp:
+		return &llamaCppProvider{cfg: cfg, prompt: prompt, client: client}, nil
+	default:
+		return nil, errors.New("invalid summary provider type, must be one of: openai, llamacpp")
+	}
+}
+
+type openAIProvider struct {
+	cfg    Config
+	prompt string
+	client *http.Client
+}
+
+type (
+	openAIMessage struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+
+	openAIRequest struct {
+		Model     string          `json:"model"`
+		Messages  []openAIMessage `json:"messages"`
+		MaxTokens int             `json:"max_tokens,omitempty"`
+	}
+
+	openAIResponse struct {
+		Choices []struct {
+			Message openAIMessage `json:"message"`
+		} `json:"choices"`
+	}
+)
+
+func (p *openAIProvider) Summarize(ctx context.Context, content string) (string, error) {
+	var rs openAIResponse
+	if err := doJSON(ctx, p.client, strings.TrimSuffix(p.cfg.URL, "/")+"/chat/completions", p.cfg.APIKey, openAIRequest{
+		Model: p.cfg.Model,
+		Messages: []openAIMessage{
+			{Role: "system", Content: p.prompt},
+			{Role: "user", Content: content},
+		},
+		MaxTokens: p.cfg.MaxTokens,
+	}, &rs); err != nil {
+		return "", err
+	}
+
+	if len(rs.Choices) == 0 {
+		return "", errors.New("summary provider returned no choices")
+	}
+	return strings.TrimSpace(rs.Choices[0].Message.Content), nil
+}
+
+type llamaCppProvider struct {
+	cfg    Config
+	prompt string
+	client *http.Client
+}
+
+type (
+	llamaCppRequest struct {
+		Prompt   string `json:"prompt"`
+		NPredict int    `json:"n_predict,omitempty"`
+	}
+
+	llamaCppResponse struct {
+		Content string `json:"content"`
+	}
+)
+
+func (p *llamaCppProvider) Summarize(ctx context.Context, content string) (string, error) {
+	var rs llamaCppResponse
+	if err := doJSON(ctx, p.client, strings.TrimSuffix(p.cfg.URL, "/")+"/completion", p.cfg.APIKey, llamaCppRequest{
+		Prompt:   p.prompt + "\n\n" + content + "\n\nSummary:",
+		NPredict: p.cfg.MaxTokens,
+	}, &rs); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(rs.Content), nil
+}
+
+func doJSON(ctx context.Context, client *http.Client, url string, apiKey string, body any, v any) error {
+	buff := new(bytes.Buffer)
+	if err := json.NewEncoder(buff).Encode(body); err != nil {
+		return fmt.Errorf("failed to encode summary request: %w", err)
+	}
+
+	rq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, buff)
+	if err != nil {
+		return fmt.Errorf("failed to create summary request: %w", err)
+	}
+	rq.Header.Set(ezhttp.HeaderContentType, ezhttp.ContentTypeJSON)
+	if apiKey != "" {
+		rq.Header.Set(ezhttp.HeaderAuthorization, "Bearer "+apiKey)
+	}
+
+	rs, err := client.Do(rq)
+	if err != nil {
+		return fmt.Errorf("failed to execute summary request: %w", err)
+	}
+	defer func() {
+		_ = rs.Body.Close()
+	}()
+
+	if rs.StatusCode < 200 || rs.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(rs.Body, 1024))
+		return fmt.Errorf("summary provider returned status %d: %s", rs.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	if err = json.NewDecoder(rs.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode summary response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+var ErrSyncDocumentNotFound = errors.New("document not found on sync source")
+
+func (s *Server) sync(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+
+	slog.Debug("Starting document sync...", slog.String("source", s.cfg.Sync.Source), slog.Int("documents", len(s.cfg.Sync.Documents)), slog.Any("tags", s.cfg.Sync.Tags), slog.Bool("collection", s.cfg.Sync.Collection))
+	ticker := time.NewTicker(interval)
+	defer func() {
+		ticker.Stop()
+		slog.Debug("document sync stopped")
+	}()
+
+	s.doSync(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.doSync(ctx)
+		}
+	}
+}
+
+func (s *Server) doSync(ctx context.Context) {
+	ctx, span := s.tracer.Start(ctx, "doSync", trace.WithAttributes(
+		attribute.String("source", s.cfg.Sync.Source),
+	))
+	defer span.End()
+
+	documentIDs, err := s.syncDocumentIDs(ctx)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return
+		}
+		span.SetStatus(codes.Error, "failed to list documents to sync")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "failed to list documents to sync", slog.Any("err", err))
+		// the fixed documents are still synced when the source can't be listed
+		documentIDs = s.cfg.Sync.Documents
+	}
+
+	for _, documentID := range documentIDs {
+		if ctx.Err() != nil {
+			return
+		}
+		imported, err := s.syncDocument(ctx, documentID)
+		if err != nil {
+			if errors.Is(err, ErrSyncDocumentNotFound) {
+				slog.WarnContext(ctx, "document to sync not found on source", slog.String("document_id", documentID))
+				continue
+			}
+			span.SetStatus(codes.Error, "failed to sync document")
+			span.RecordError(err)
+			slog.ErrorContext(ctx, "failed to sync document", slog.String("document_id", documentID), slog.Any("err", err))
+			continue
+		}
+		if imported > 0 {
+			slog.InfoContext(ctx, "synced document", slog.String("document_id", documentID), slog.Int("versions", imported))
+		}
+	}
+}
+
+// syncDocumentIDs returns the configured documents and the documents of the source with one of the configured tags.
+// With collection the source lists all documents of the token, a read token is a fixed collection of documents and a
+// user token all documents of the account.
+func (s *Server) syncDocumentIDs(ctx context.Context) ([]string, error) {
+	documentIDs := slices.Clone(s.cfg.Sync.Documents)
+
+	var tags []string
+	if s.cfg.Sync.Collection {
+		tags = []string{""}
+	} else {
+		tags = s.cfg.Sync.Tags
+	}
+	for _, tag := range tags {
+		var cursor string
+		for {
+			list, err := s.fetchSyncDocumentList(ctx, tag, cursor)
+			if err != nil {
+				return nil, err
+			}
+			for _, document := range list.Documents {
+				documentIDs = append(documentIDs, document.Key)
+			}
+			if list.Next == "" {
+				break
+			}
+			cursor = list.Next
+		}
+	}
+
+	slices.Sort(documentIDs)
+	return slices.Compact(documentIDs), nil
+}
+
+// syncDocument imports all versions of a document from the sync source which are missing locally and returns how many were imported.
+func (s *Server) syncDocument(ctx context.Context, documentID string) (int, error) {
+	ctx, span := s.tracer.Start(ctx, "syncDocument", trace.WithAttributes(
+		attribute.String("document_id", documentID),
+	))
+	defer span.End()
+
+	remoteVersions, err := s.fetchSyncDocumentVersions(ctx, documentID)
+	if err != nil {
+		return 0, err
+	}
+
+	localVersions, err := s.db.GetDocumentVersions(ctx, documentID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get local document versions: %w", err)
+	}
+
+	slices.SortFunc(remoteVersions, func(a, b api.DocumentResponse) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+
+	var imported int
+	created := len(localVersions) == 0
+	for _, version := range remoteVersions {
+		if slices.Contains(localVersions, version.Version) {
+			continue
+		}
+
+		files := make([]database.File, len(version.Files))
+		for i, file := range version.Files {
+			files[i] = database.File{
+				Name:       file.Name,
+				Content:    file.Content,
+				Language:   file.Language,
+				Encrypted:  file.Encrypted,
+				ExpiresAt:  file.ExpiresAt,
+				OrderIndex: i,
+			}
+		}
+		if err = s.db.ImportDocumentVersion(ctx, documentID, version.Version, files); err != nil {
+			// versions deleted here are not synced again
+			if errors.Is(err, database.ErrDocumentVersionDeleted) {
+				continue
+			}
+			return imported, err
+		}
+		imported++
+
+		// hooks don't run for mirrored versions, they already ran on the source and their results can't change the
+		// imported content anymore
+		event, webhookEvent := EventUpdate, WebhookEventUpdate
+		if created {
+			event, webhookEvent = EventCreate, WebhookEventCreate
+			created = false
+		}
+		s.notifyDocumentVersion(ctx, event, webhookEvent, documentID, version.Version, files)
+	}
+
+	if s.cfg.Sync.Collection || len(s.cfg.Sync.Tags) > 0 {
+		if err = s.syncDocumentTags(ctx, documentID); err != nil {
+			return imported, err
+		}
+	}
+
+	return imported, nil
+}
+
+// syncDocumentTags replaces the local tags of the document with the tags on the source.
+func (s *Server) syncDocumentTags(ctx context.Context, documentID string) error {
+	uri, err := url.JoinPath(s.cfg.Sync.Source, "documents", documentID, "tags")
+	if err != nil {
+		return fmt.Errorf("failed to build sync url: %w", err)
+	}
+
+	var tagsResponse DocumentTagsResponse
+	if err = s.fetchSync(ctx, uri, &tagsResponse); err != nil {
+		// older sources don't know tags
+		if errors.Is(err, ErrSyncDocumentNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to fetch document tags: %w", err)
+	}
+
+	tags, err := normalizeDocumentTags(tagsResponse.Tags)
+	if err != nil {
+		return err
+	}
+	return s.db.SetDocumentTags(ctx, documentID, tags)
+}
+
+func (s *Server) fetchSyncDocumentList(ctx context.Context, tag string, cursor string) (*api.DocumentListResponse, error) {
+	uri, err := url.JoinPath(s.cfg.Sync.Source, "documents")
+	if err != nil {
+		return nil, fmt.Errorf("failed to build sync url: %w", err)
+	}
+
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(maxDocumentListLimit))
+	if tag != "" {
+		query.Set("tag", tag)
+	}
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+
+	var list api.DocumentListResponse
+	if err = s.fetchSync(ctx, uri+"?"+query.Encode(), &list); err != nil {
+		return nil, fmt.Errorf("failed to fetch document list: %w", err)
+	}
+	return &list, nil
+}
+
+func (s *Server) fetchSyncDocumentVersions(ctx context.Context, documentID string) ([]api.DocumentResponse, error) {
+	uri, err := url.JoinPath(s.cfg.Sync.Source, "documents", documentID, "versions")
+	if err != nil {
+		return nil, fmt.Errorf("failed to build sync url: %w", err)
+	}
+
+	var versions []api.DocumentResponse
+	if err = s.fetchSync(ctx, uri+"?withContent=true", &versions); err != nil {
+		if errors.Is(err, ErrSyncDocumentNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to fetch document versions: %w", err)
+	}
+	return versions, nil
+}
+
+// fetchSync sends a GET request with the sync token to the source and decodes the json response into v.
+func (s *Server) fetchSync(ctx context.Context, uri string, v any) error {
+	rq, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create sync request: %w", err)
+	}
+	rq.Header.Set(ezhttp.HeaderUserAgent, fmt.Sprintf("gobin/%s", s.version.Version))
+	if s.cfg.Sync.Token != "" {
+		rq.Header.Set(ezhttp.HeaderAuthorization, "Bearer "+s.cfg.Sync.Token)
+	}
+
+	rs, err := s.syncClient.Do(rq)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rs.Body.Close()
+	}()
+
+	if rs.StatusCode == http.StatusNotFound {
+		return ErrSyncDocumentNotFound
+	}
+	if rs.StatusCode != http.StatusOK {
+		return fmt.Errorf("sync source returned status %d", rs.StatusCode)
+	}
+
+	if err = json.NewDecoder(rs.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
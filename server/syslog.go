@@ -0,0 +1,380 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/render"
+	"github.com/topi314/gobin/v3/internal/syslog"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+const (
+	// syslogMaxMessageSize is the largest message accepted, RFC 5424 recommends receivers to accept up to 2048 bytes
+	// and most senders stay below 64 KiB.
+	syslogMaxMessageSize = 64 * 1024
+	syslogMaxSourceSize  = 255
+	syslogRollBufferSize = 16
+)
+
+var ErrSyslogSourceLimit = errors.New("syslog source limit reached")
+
+// syslogReceiver buffers the received lines of each source until they are written as a new version of its document.
+type syslogReceiver struct {
+	mu       sync.Mutex
+	buffers  map[string]*strings.Builder
+	listener net.Listener
+	packet   net.PacketConn
+	conns    map[net.Conn]struct{}
+	roll     chan string
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	rolled   chan struct{}
+}
+
+func (s *Server) startSyslog() error {
+	s.syslog.buffers = make(map[string]*strings.Builder)
+	s.syslog.conns = make(map[net.Conn]struct{})
+	s.syslog.roll = make(chan string, syslogRollBufferSize)
+
+	if s.cfg.Syslog.UDPAddr != "" {
+		conn, err := net.ListenPacket("udp", s.cfg.Syslog.UDPAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on syslog udp address: %w", err)
+		}
+		s.syslog.packet = conn
+		s.syslog.wg.Add(1)
+		go s.receiveSyslogPackets(conn)
+	}
+	if s.cfg.Syslog.TCPAddr != "" {
+		listener, err := net.Listen("tcp", s.cfg.Syslog.TCPAddr)
+		if err != nil {
+			s.closeSyslog()
+			return fmt.Errorf("failed to listen on syslog tcp address: %w", err)
+		}
+		s.syslog.listener = listener
+		s.syslog.wg.Add(1)
+		go s.acceptSyslogConns(listener)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.syslog.cancel = cancel
+	s.syslog.rolled = make(chan struct{})
+	go s.rollSyslog(ctx, time.Duration(s.cfg.Syslog.RollInterval))
+
+	slog.Info("Receiving syslog messages", slog.String("udp_addr", s.cfg.Syslog.UDPAddr), slog.String("tcp_addr", s.cfg.Syslog.TCPAddr))
+	return nil
+}
+
+// closeSyslog stops the listeners and writes the lines received until then.
+func (s *Server) closeSyslog() {
+	if s.syslog.packet != nil {
+		_ = s.syslog.packet.Close()
+	}
+	s.syslog.mu.Lock()
+	if s.syslog.listener != nil {
+		_ = s.syslog.listener.Close()
+	}
+	for conn := range s.syslog.conns {
+		_ = conn.Close()
+	}
+	s.syslog.mu.Unlock()
+	s.syslog.wg.Wait()
+
+	if s.syslog.cancel != nil {
+		s.syslog.cancel()
+		<-s.syslog.rolled
+	}
+}
+
+func (s *Server) receiveSyslogPackets(conn net.PacketConn) {
+	defer s.syslog.wg.Done()
+
+	buf := make([]byte, syslogMaxMessageSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Error("failed to read syslog packet", slog.Any("err", err))
+			}
+			return
+		}
+		s.receiveSyslogMessage(addr, buf[:n])
+	}
+}
+
+func (s *Server) acceptSyslogConns(listener net.Listener) {
+	defer s.syslog.wg.Done()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Error("failed to accept syslog connection", slog.Any("err", err))
+			}
+			return
+		}
+
+		s.syslog.mu.Lock()
+		s.syslog.conns[conn] = struct{}{}
+		s.syslog.mu.Unlock()
+
+		s.syslog.wg.Add(1)
+		go s.receiveSyslogConn(conn)
+	}
+}
+
+func (s *Server) receiveSyslogConn(conn net.Conn) {
+	defer func() {
+		s.syslog.mu.Lock()
+		delete(s.syslog.conns, conn)
+		s.syslog.mu.Unlock()
+		_ = conn.Close()
+		s.syslog.wg.Done()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), syslogMaxMessageSize)
+	scanner.Split(syslog.Split)
+	for scanner.Scan() {
+		s.receiveSyslogMessage(conn.RemoteAddr(), scanner.Bytes())
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		slog.Debug("failed to read syslog connection", slog.String("remote_addr", conn.RemoteAddr().String()), slog.Any("err", err))
+	}
+}
+
+// receiveSyslogMessage buffers the message as a log line of its source. Messages which are not RFC 5424 are kept as
+// they are and belong to the address of the sender.
+func (s *Server) receiveSyslogMessage(addr net.Addr, data []byte) {
+	if !utf8.Valid(data) {
+		data = []byte(strings.ToValidUTF8(string(data), string(utf8.RuneError)))
+	}
+
+	source := addr.String()
+	if host, _, err := net.SplitHostPort(source); err == nil {
+		source = host
+	}
+
+	var line string
+	if message, err := syslog.Parse(data); err == nil {
+		if message.Hostname != "" {
+			source = message.Hostname
+		}
+		line = formatSyslogLine(message)
+	} else {
+		line = time.Now().Format(time.RFC3339) + " " + strings.TrimRight(string(data), "\r\n")
+	}
+	source = strings.ReplaceAll(source, "/", "_")
+	if len(source) > syslogMaxSourceSize {
+		source = source[:syslogMaxSourceSize]
+	}
+
+	s.syslog.mu.Lock()
+	defer s.syslog.mu.Unlock()
+
+	buffer, ok := s.syslog.buffers[source]
+	if !ok {
+		if s.cfg.Syslog.MaxSources > 0 && len(s.syslog.buffers) >= s.cfg.Syslog.MaxSources {
+			return
+		}
+		buffer = &strings.Builder{}
+		s.syslog.buffers[source] = buffer
+	}
+	buffer.WriteString(line)
+	buffer.WriteByte('\n')
+
+	if buffer.Len() >= s.cfg.Syslog.RollSize {
+		select {
+		case s.syslog.roll <- source:
+		default:
+		}
+	}
+}
+
+// formatSyslogLine formats the message like "2006-01-02T15:04:05Z07:00 INFO app[1234]: message", so the log view
+// detects its time and level.
+func formatSyslogLine(message *syslog.Message) string {
+	timestamp := message.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	var b strings.Builder
+	b.WriteString(timestamp.Format(time.RFC3339))
+	b.WriteByte(' ')
+	b.WriteString(message.SeverityName())
+	if message.AppName != "" {
+		b.WriteByte(' ')
+		b.WriteString(message.AppName)
+		if message.ProcID != "" {
+			b.WriteByte('[')
+			b.WriteString(message.ProcID)
+			b.WriteByte(']')
+		}
+		b.WriteByte(':')
+	}
+	if message.Message != "" {
+		b.WriteByte(' ')
+		b.WriteString(strings.TrimRight(message.Message, "\r\n"))
+	}
+	return b.String()
+}
+
+// rollSyslog writes the buffered lines of all sources in the interval and of single sources when their buffer reached
+// the roll size.
+func (s *Server) rollSyslog(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+
+	slog.Debug("Starting syslog roll...")
+	ticker := time.NewTicker(interval)
+	defer func() {
+		ticker.Stop()
+		s.doRollSyslog(context.Background())
+		slog.Debug("syslog roll stopped")
+		close(s.syslog.rolled)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.doRollSyslog(ctx)
+		case source := <-s.syslog.roll:
+			s.rollSyslogSource(ctx, source)
+		}
+	}
+}
+
+func (s *Server) doRollSyslog(ctx context.Context) {
+	s.syslog.mu.Lock()
+	sources := make([]string, 0, len(s.syslog.buffers))
+	for source := range s.syslog.buffers {
+		sources = append(sources, source)
+	}
+	s.syslog.mu.Unlock()
+
+	for _, source := range sources {
+		s.rollSyslogSource(ctx, source)
+	}
+}
+
+func (s *Server) rollSyslogSource(ctx context.Context, source string) {
+	ctx, span := s.tracer.Start(ctx, "rollSyslogSource", trace.WithAttributes(
+		attribute.String("source", source),
+	))
+	defer span.End()
+
+	s.syslog.mu.Lock()
+	buffer, ok := s.syslog.buffers[source]
+	delete(s.syslog.buffers, source)
+	s.syslog.mu.Unlock()
+	if !ok || buffer.Len() == 0 {
+		return
+	}
+
+	if err := s.writeSyslogDocument(ctx, source, buffer.String()); err != nil {
+		span.SetStatus(codes.Error, "failed to write syslog document")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "failed to write syslog document", slog.String("source", source), slog.Any("err", err))
+	}
+}
+
+// writeSyslogDocument saves the lines as a new version of the source document. The document is created on the first
+// lines of a source and again if it was deleted.
+func (s *Server) writeSyslogDocument(ctx context.Context, source string, content string) error {
+	name := source + ".log"
+	file := database.File{
+		Name:     name,
+		Content:  content,
+		Language: render.Language("", "", name, content),
+	}
+	if s.cfg.Syslog.Expiry > 0 {
+		expiresAt := time.Now().Add(time.Duration(s.cfg.Syslog.Expiry))
+		file.ExpiresAt = &expiresAt
+	}
+	dbFiles := []database.File{file}
+
+	var documentID string
+	syslogSource, err := s.db.GetSyslogSource(ctx, source)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to get syslog source: %w", err)
+	}
+	if syslogSource != nil {
+		count, err := s.db.GetVersionCount(ctx, syslogSource.DocumentID)
+		if err != nil {
+			return fmt.Errorf("failed to get document version count: %w", err)
+		}
+		if count > 0 {
+			documentID = syslogSource.DocumentID
+		}
+	} else if s.cfg.Syslog.MaxSources > 0 {
+		count, err := s.db.GetSyslogSourceCount(ctx)
+		if err != nil {
+			return err
+		}
+		if count >= s.cfg.Syslog.MaxSources {
+			return ErrSyslogSourceLimit
+		}
+	}
+
+	event := EventUpdate
+	webhookEvent := WebhookEventUpdate
+	if documentID == "" {
+		event = EventCreate
+		webhookEvent = WebhookEventCreate
+	}
+
+	hookResults, err := s.runHooks(ctx, event, documentID, dbFiles)
+	if err != nil {
+		return err
+	}
+
+	var version *int64
+	if documentID == "" {
+		var newDocumentID *string
+		if newDocumentID, version, err = s.db.CreateDocument(ctx, "", dbFiles); err != nil {
+			return fmt.Errorf("failed to create document: %w", err)
+		}
+		documentID = *newDocumentID
+		if err = s.db.SetSyslogSource(ctx, source, documentID); err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "Created syslog document", slog.String("source", source), slog.String("document_id", documentID))
+	} else if version, err = s.db.UpdateDocument(ctx, documentID, dbFiles); err != nil {
+		return fmt.Errorf("failed to update document: %w", err)
+	}
+	s.recordHookResults(ctx, documentID, *version, hookResults)
+
+	s.RecordEvent(ctx, event, documentID, *version, newEventData(dbFiles))
+	s.publishLiveEvent(event, documentID, *version)
+
+	s.ExecuteWebhooks(ctx, webhookEvent, api.WebhookDocument{
+		Key:     documentID,
+		Version: *version,
+		Files: []api.WebhookDocumentFile{{
+			Name:      file.Name,
+			Content:   file.Content,
+			Language:  file.Language,
+			ExpiresAt: file.ExpiresAt,
+		}},
+	})
+	return nil
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/topi314/gobin/v3/internal/flags"
+	"github.com/topi314/gobin/v3/internal/httperr"
+)
+
+const (
+	maxDocumentTags   = 20
+	maxDocumentTagLen = 64
+)
+
+var (
+	ErrTooManyDocumentTags = fmt.Errorf("too many tags, documents can have at most %d tags", maxDocumentTags)
+	ErrInvalidDocumentTag  = func(tag string) error {
+		return fmt.Errorf("invalid tag %q, tags are 1 to %d lowercase letters, digits or -_.:/", tag, maxDocumentTagLen)
+	}
+)
+
+// documentTagRegex matches normalized tags like "prod", "team:infra" or "logs/nightly".
+var documentTagRegex = regexp.MustCompile(`^[\p{Ll}\p{Lo}\p{N}_.:/-]+$`)
+
+type (
+	DocumentTagsRequest struct {
+		Tags []string `json:"tags"`
+	}
+
+	DocumentTagsResponse struct {
+		Tags []string `json:"tags"`
+	}
+)
+
+// GetDocumentTags returns the tags of the document.
+func (s *Server) GetDocumentTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := s.db.GetDocumentTags(r.Context(), chi.URLParam(r, "documentID"))
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if tags == nil {
+		tags = make([]string, 0)
+	}
+	s.ok(w, r, DocumentTagsResponse{Tags: tags})
+}
+
+// PutDocumentTags replaces the tags of the document, documents can be listed and mirrored by their tags.
+func (s *Server) PutDocumentTags(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionWrite) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+		return
+	}
+
+	var tagsRequest DocumentTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&tagsRequest); err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+	tags, err := normalizeDocumentTags(tagsRequest.Tags)
+	if err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+
+	versions, err := s.db.GetVersionCount(r.Context(), documentID)
+	if err != nil {
+		s.error(w, r, fmt.Errorf("failed to get document versions: %w", err))
+		return
+	}
+	if versions == 0 {
+		s.error(w, r, httperr.NotFound(ErrDocumentNotFound))
+		return
+	}
+
+	if err = s.db.SetDocumentTags(r.Context(), documentID, tags); err != nil {
+		s.error(w, r, err)
+		return
+	}
+	s.ok(w, r, DocumentTagsResponse{Tags: tags})
+}
+
+// normalizeDocumentTags returns the sorted tags in lowercase without duplicates.
+func normalizeDocumentTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag, err := normalizeDocumentTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, tag)
+	}
+	slices.Sort(normalized)
+	normalized = slices.Compact(normalized)
+	if len(normalized) > maxDocumentTags {
+		return nil, ErrTooManyDocumentTags
+	}
+	return normalized, nil
+}
+
+func normalizeDocumentTag(tag string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(tag))
+	if len(normalized) > maxDocumentTagLen || !documentTagRegex.MatchString(normalized) {
+		return "", ErrInvalidDocumentTag(tag)
+	}
+	return normalized, nil
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/httperr"
+)
+
+const defaultTailLines = 10
+
+var ErrInvalidTailLines = errors.New("invalid lines, must be at least 0")
+
+// GetDocumentFileTail returns the last lines of a file as plain text. With follow the response stays open and streams
+// the content appended by new versions until the document is deleted. If a new version doesn't continue the content
+// sent so far, like after a rotation, its whole content is sent.
+func (s *Server) GetDocumentFileTail(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	lines := defaultTailLines
+	if linesStr := query.Get("lines"); linesStr != "" {
+		var err error
+		lines, err = strconv.Atoi(linesStr)
+		if err != nil || lines < 0 {
+			s.error(w, r, httperr.BadRequest(ErrInvalidTailLines))
+			return
+		}
+	}
+	follow := query.Get("follow") == "true"
+
+	file, err := s.getDocumentFile(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if file.Encrypted {
+		s.error(w, r, httperr.BadRequest(ErrFileEncrypted))
+		return
+	}
+
+	w.Header().Set(ezhttp.HeaderContentType, ezhttp.ContentTypeText)
+	if !follow {
+		_, _ = io.WriteString(w, tailLines(file.Content, lines))
+		return
+	}
+
+	// subscribe before the file is sent again, so no version saved in the meantime is missed
+	events, unsubscribe := s.live.subscribe(file.DocumentID)
+	defer unsubscribe()
+
+	if file, err = s.getDocumentFile(r); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	w.Header().Set(ezhttp.HeaderCacheControl, "no-cache")
+	w.Header().Set(ezhttp.HeaderXAccelBuffering, "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	if _, err = io.WriteString(w, tailLines(file.Content, lines)); err != nil {
+		return
+	}
+	if err = rc.Flush(); err != nil {
+		slog.ErrorContext(r.Context(), "failed to flush tail", slog.Any("err", err))
+		return
+	}
+
+	content := file.Content
+	version := file.DocumentVersion
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			if event.Event == EventDelete || event.Event == EventExpire || event.Event == EventPrune {
+				if _, err = s.db.GetDocument(r.Context(), file.DocumentID); errors.Is(err, sql.ErrNoRows) {
+					return
+				}
+				continue
+			}
+			if event.Version <= version {
+				continue
+			}
+			version = event.Version
+
+			newFile, err := s.db.GetDocumentFileVersion(r.Context(), file.DocumentID, event.Version, file.Name)
+			if err != nil {
+				if !errors.Is(err, sql.ErrNoRows) {
+					slog.ErrorContext(r.Context(), "failed to get tailed file", slog.Any("err", err))
+					return
+				}
+				// the file was removed, it is sent again in full if it comes back
+				content = ""
+				continue
+			}
+
+			appended := newFile.Content
+			if strings.HasPrefix(newFile.Content, content) {
+				appended = newFile.Content[len(content):]
+			}
+			content = newFile.Content
+			if appended == "" {
+				continue
+			}
+			if _, err = io.WriteString(w, appended); err != nil {
+				return
+			}
+			if err = rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// tailLines returns the last n lines of the content, a trailing line break doesn't count as line.
+func tailLines(content string, n int) string {
+	if n == 0 {
+		return ""
+	}
+	end := strings.TrimSuffix(content, "\n")
+	i := len(end)
+	for ; n > 0; n-- {
+		i = strings.LastIndexByte(end[:i], '\n')
+		if i == -1 {
+			return content
+		}
+	}
+	return content[i+1:]
+}
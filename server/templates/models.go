@@ -5,8 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/url"
+	"slices"
+	"time"
 
 	"github.com/a-h/templ"
+
+	"github.com/topi314/gobin/v3/internal/diff"
 )
 
 func WriteUnsafe(str string) templ.Component {
@@ -16,10 +21,25 @@ func WriteUnsafe(str string) templ.Component {
 	})
 }
 
+// Assets maps the paths of the assets to their fingerprinted urls.
+type Assets map[string]string
+
+// URL returns the fingerprinted url of the asset or the path itself if the asset is not fingerprinted.
+func (a Assets) URL(path string) string {
+	if url, ok := a[path]; ok {
+		return url
+	}
+	return path
+}
+
 type DocumentVars struct {
 	ID      string
 	Version int64
 	Edit    bool
+	// ParentID is the document this document was forked from.
+	ParentID string
+	// Parts are the keys of all documents the content of this document was split into, empty if it wasn't split.
+	Parts []string
 
 	Files       []File
 	CurrentFile int
@@ -30,18 +50,62 @@ type DocumentVars struct {
 	PreviewAlt string
 
 	Lexers []string
-	Styles []Style
-	Style  string
-	Theme  string
+	// Transforms are the names of the decodings offered for the current file.
+	Transforms []string
+	Styles     []Style
+	Style      string
+	Theme      string
+	// AutoStyle is set if the user didn't pick a style for this browser.
+	AutoStyle bool
+	// SettingsStyle is the default style of the user settings, it takes precedence over the style suggested by the
+	// creator.
+	SettingsStyle string
+	// DocumentStyle is the style suggested by the creator, the default styles are used for the color scheme of the
+	// user if neither the user nor the creator picked a style.
+	DocumentStyle     string
+	DefaultStyle      string
+	DefaultLightStyle string
+	// EditorKeymap is the keymap of the editor from the user settings.
+	EditorKeymap string
+	// DefaultLanguage is the language of new files from the user settings, empty for auto-detection.
+	DefaultLanguage string
+
 	Max    int64
 	Host   string
+	Assets Assets
+	// MaxHighlightSize is passed to the renderer of the editor, so it falls back to plaintext like the server.
+	MaxHighlightSize int
+
+	SummaryEnabled  bool
+	RecentEnabled   bool
+	AccountsEnabled bool
+	// AccountName is the name of the logged-in account, empty if the browser isn't logged in.
+	AccountName string
+	// Token is a token for the document if the logged-in account has permissions for it.
+	Token string
+
+	// Format highlights the current file while the page is rendered.
+	Format func(ctx context.Context) string
 }
 
 type File struct {
-	Name      string `json:"name"`
-	Content   string `json:"content"`
-	Formatted string `json:"formatted"`
-	Language  string `json:"language"`
+	Name      string     `json:"name"`
+	Content   string     `json:"content"`
+	Formatted string     `json:"formatted"`
+	Language  string     `json:"language"`
+	Encrypted bool       `json:"encrypted,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	SHA256    string     `json:"sha256,omitempty"`
+	Signature *Signature `json:"signature,omitempty"`
+	// Lazy files have no content yet, the frontend fetches them when they are opened.
+	Lazy bool `json:"lazy,omitempty"`
+}
+
+// Signature is the verified signature of a file which is shown as badge.
+type Signature struct {
+	Format  string `json:"format"`
+	KeyID   string `json:"key_id"`
+	Comment string `json:"comment,omitempty"`
 }
 
 type gobin struct {
@@ -51,6 +115,24 @@ type gobin struct {
 	Files       []File `json:"files"`
 	CurrentFile int    `json:"current_file"`
 	ExpireIn    int    `json:"expire_in"`
+	Parent      string `json:"parent,omitempty"`
+	Token       string `json:"token,omitempty"`
+}
+
+// FontURL is the font of the page, it is preloaded since it is only found once the css is loaded.
+const FontURL = "/assets/fonts/JetBrainsMono-VariableFont_wght.ttf"
+
+// FormattedFile writes the highlighted current file. The formatted file is stored in the files, so the state of the
+// page which is rendered afterward contains it too.
+func (v DocumentVars) FormattedFile() templ.Component {
+	return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+		file := &v.Files[v.CurrentFile]
+		if v.Format != nil {
+			file.Formatted = v.Format(ctx)
+		}
+		_, err := io.WriteString(w, file.Formatted)
+		return err
+	})
 }
 
 func (v DocumentVars) StateJSON() string {
@@ -64,10 +146,19 @@ func (v DocumentVars) StateJSON() string {
 		Mode:        mode,
 		Files:       v.Files,
 		CurrentFile: v.CurrentFile,
+		Parent:      v.ParentID,
+		Token:       v.Token,
 	})
 	return fmt.Sprintf(`<script id="state" type="application/json">%s</script>`, string(data))
 }
 
+func (v DocumentVars) AccountTitle() string {
+	if v.AccountName != "" {
+		return "Logged in as " + v.AccountName
+	}
+	return "Log in to manage your documents from any browser"
+}
+
 func (v DocumentVars) FileClasses(i int) string {
 	classes := "file"
 	if i == v.CurrentFile {
@@ -76,6 +167,19 @@ func (v DocumentVars) FileClasses(i int) string {
 	return classes
 }
 
+// PartIndex returns the position of the document in its parts.
+func (v DocumentVars) PartIndex() int {
+	return max(slices.Index(v.Parts, v.ID), 0)
+}
+
+func (v DocumentVars) PartClasses(i int) string {
+	classes := "part"
+	if i == v.PartIndex() {
+		classes += " selected"
+	}
+	return classes
+}
+
 func (v DocumentVars) FileTabClasses(i int) string {
 	classes := "file-tab"
 	if i == v.CurrentFile {
@@ -84,6 +188,30 @@ func (v DocumentVars) FileTabClasses(i int) string {
 	return classes
 }
 
+// ExpiresIn returns the remaining lifetime of the current file or an empty string if it doesn't expire.
+func (v DocumentVars) ExpiresIn() string {
+	if v.CurrentFile >= len(v.Files) || v.Files[v.CurrentFile].ExpiresAt == nil {
+		return ""
+	}
+	return formatExpiresIn(time.Until(*v.Files[v.CurrentFile].ExpiresAt))
+}
+
+func formatExpiresIn(d time.Duration) string {
+	if d < time.Minute {
+		return "expires in <1m"
+	}
+	days := int(d / (24 * time.Hour))
+	hours := int(d/time.Hour) % 24
+	minutes := int(d/time.Minute) % 60
+	if days > 0 {
+		return fmt.Sprintf("expires in %dd %dh", days, hours)
+	}
+	if hours > 0 {
+		return fmt.Sprintf("expires in %dh %dm", hours, minutes)
+	}
+	return fmt.Sprintf("expires in %dm", minutes)
+}
+
 func (v DocumentVars) URL() string {
 	return "https://" + v.Host
 }
@@ -92,10 +220,34 @@ func (v DocumentVars) ThemeCSSURL() string {
 	return fmt.Sprintf("/assets/theme.css?style=%s", v.Style)
 }
 
+// versionMessagePreview is the number of characters of a version message shown in the version select.
+const versionMessagePreview = 40
+
 type DocumentVersion struct {
 	Version int64
 	Label   string
 	Time    string
+	// Message describes the changes of the version, it is empty for most versions.
+	Message string
+}
+
+// Text is shown in the version select, long messages are shortened and shown in full in the Title.
+func (v DocumentVersion) Text() string {
+	if v.Message == "" {
+		return v.Label
+	}
+	message := []rune(v.Message)
+	if len(message) > versionMessagePreview {
+		message = append(message[:versionMessagePreview-1], '…')
+	}
+	return string(message) + " · " + v.Label
+}
+
+func (v DocumentVersion) Title() string {
+	if v.Message == "" {
+		return v.Time
+	}
+	return v.Time + "\n" + v.Message
 }
 
 type Style struct {
@@ -103,9 +255,233 @@ type Style struct {
 	Theme string
 }
 
+type DeviceVars struct {
+	UserCode string
+	// Permissions are the requested permissions, empty if the user code is missing or invalid.
+	Permissions []string
+	// Account is set if the device requests an account token, AccountName is empty if the browser isn't logged in.
+	Account     bool
+	AccountName string
+	Error       string
+	Style       string
+	Theme       string
+	Assets      Assets
+}
+
+func (v DeviceVars) ThemeCSSURL() string {
+	return fmt.Sprintf("/assets/theme.css?style=%s", v.Style)
+}
+
+// LoginURL returns the url to log in which returns to this page afterward.
+func (v DeviceVars) LoginURL() string {
+	return "/login?redirect=" + url.QueryEscape("/device?code="+v.UserCode)
+}
+
+type SettingsVars struct {
+	DefaultStyle    string
+	DefaultExpiry   string
+	EditorKeymap    string
+	DefaultLanguage string
+
+	EditorKeymaps []string
+	Lexers        []string
+	// Sessions and the second factors are only set for logged-in accounts.
+	LoggedIn bool
+	Sessions []SettingsSession
+	// TwoFactorRequired is set if the instance requires a second factor the session wasn't confirmed with, only the
+	// second factors are shown then.
+	TwoFactorRequired bool
+	TOTP              bool
+	Passkeys          []SettingsPasskey
+	RecoveryCodes     int
+	Styles            []Style
+	Style             string
+	Theme             string
+	Assets            Assets
+}
+
+type SettingsSession struct {
+	ID        string
+	Kind      string
+	UserAgent string
+	Address   string
+	CreatedAt string
+	LastUsed  string
+	Current   bool
+}
+
+type SettingsPasskey struct {
+	ID        string
+	Name      string
+	CreatedAt string
+	LastUsed  string
+}
+
+func (v SettingsVars) ThemeCSSURL() string {
+	return fmt.Sprintf("/assets/theme.css?style=%s", v.Style)
+}
+
+// TwoFactor is set if the account has an authenticator app or a passkey.
+func (v SettingsVars) TwoFactor() bool {
+	return v.TOTP || len(v.Passkeys) > 0
+}
+
+type TwoFactorVars struct {
+	// TOTP and Passkeys are set if the account has an authenticator app or passkeys, recovery codes always work.
+	TOTP     bool
+	Passkeys bool
+	Style    string
+	Theme    string
+	Assets   Assets
+}
+
+func (v TwoFactorVars) ThemeCSSURL() string {
+	return fmt.Sprintf("/assets/theme.css?style=%s", v.Style)
+}
+
+type InviteVars struct {
+	ID          string
+	DocumentKey string
+	Permissions []string
+	Error       string
+
+	Style  string
+	Theme  string
+	Assets Assets
+}
+
+func (v InviteVars) ThemeCSSURL() string {
+	return fmt.Sprintf("/assets/theme.css?style=%s", v.Style)
+}
+
+// PublishVars are the vars of a static page of a published document. All urls are relative to the page.
+type PublishVars struct {
+	Key          string
+	VersionLabel string
+	Files        []PublishFile
+	CurrentFile  int
+	Versions     []PublishVersion
+	StyleURL     string
+	Theme        string
+}
+
+type PublishFile struct {
+	Name      string
+	Language  string
+	Formatted string
+	Encrypted bool
+	URL       string
+	RawURL    string
+}
+
+type PublishVersion struct {
+	Label   string
+	URL     string
+	Current bool
+}
+
+// FormattedFile writes the highlighted current file.
+func (v PublishVars) FormattedFile() templ.Component {
+	return templ.Raw(v.Files[v.CurrentFile].Formatted)
+}
+
+// EmbedVars are the vars of a document shown in an iframe of embed.js.
+type EmbedVars struct {
+	Key         string
+	DocumentURL string
+	Files       []EmbedFile
+
+	Style  string
+	Theme  string
+	Assets Assets
+}
+
+func (v EmbedVars) ThemeCSSURL() string {
+	return fmt.Sprintf("/assets/theme.css?style=%s", v.Style)
+}
+
+type EmbedFile struct {
+	Name      string
+	Language  string
+	Formatted string
+	RawURL    string
+}
+
+func (f EmbedFile) FormattedContent() templ.Component {
+	return templ.Raw(f.Formatted)
+}
+
+// FederatedVars are the vars of a document of another gobin instance. Only the current file is formatted.
+type FederatedVars struct {
+	Host         string
+	Key          string
+	VersionLabel string
+	OriginURL    string
+	Files        []FederatedFile
+	CurrentFile  int
+
+	Style  string
+	Theme  string
+	Assets Assets
+}
+
+func (v FederatedVars) ThemeCSSURL() string {
+	return fmt.Sprintf("/assets/theme.css?style=%s", v.Style)
+}
+
+func (v FederatedVars) FormattedFile() templ.Component {
+	return templ.Raw(v.Files[v.CurrentFile].Formatted)
+}
+
+type FederatedFile struct {
+	Name      string
+	Language  string
+	Formatted string
+	Encrypted bool
+	URL       string
+	RawURL    string
+}
+
 type ErrorVars struct {
 	Error     string
 	Status    int
 	Path      string
 	RequestID string
+	Assets    Assets
+}
+
+type CompareVars struct {
+	A      string
+	AURL   string
+	B      string
+	BURL   string
+	Files  []CompareFile
+	Style  string
+	Theme  string
+	Assets Assets
+}
+
+func (v CompareVars) ThemeCSSURL() string {
+	return fmt.Sprintf("/assets/theme.css?style=%s", v.Style)
+}
+
+type CompareFile struct {
+	AName   string
+	BName   string
+	Added   int
+	Removed int
+	Rows    []diff.Row
+}
+
+func (f CompareFile) Title() string {
+	switch {
+	case f.AName == "":
+		return f.BName + " (added)"
+	case f.BName == "":
+		return f.AName + " (removed)"
+	case f.AName == f.BName:
+		return f.AName
+	default:
+		return f.AName + " ↔ " + f.BName
+	}
 }
@@ -2,36 +2,94 @@ package server
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/topi314/chroma/v2"
 	"github.com/topi314/chroma/v2/styles"
 
+	"github.com/topi314/gobin/v3/api"
 	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/flags"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
 )
 
-func getStyle(r *http.Request) *chroma.Style {
-	var styleName string
-	if styleCookie, err := r.Cookie("style"); err == nil {
-		styleName = styleCookie.Value
+const (
+	ColorSchemeDark  = "dark"
+	ColorSchemeLight = "light"
+)
+
+var ErrUnknownStyle = errors.New("unknown style")
+
+// getStyle returns the style of the request for pages and formatted content which don't belong to a single document.
+// The settings of the user are only loaded if the request has no style.
+func (s *Server) getStyle(r *http.Request) *chroma.Style {
+	if style, ok := styles.Registry[getUserStyle(r)]; ok {
+		return style
+	}
+	return s.getDocumentStyle(r, s.getUserSettings(r), "")
+}
+
+// getDocumentStyle returns the style from the style query parameter, the style cookie the user picked, the default
+// style of the user settings, the style the creator suggested for the document or the default style for the color
+// scheme of the user, in this order.
+func (s *Server) getDocumentStyle(r *http.Request, settings *database.UserSettings, documentStyle string) *chroma.Style {
+	var settingsStyle string
+	if settings != nil {
+		settingsStyle = settings.DefaultStyle
 	}
-	queryStyle := r.URL.Query().Get("style")
-	if queryStyle != "" {
-		styleName = queryStyle
+	for _, name := range []string{getUserStyle(r), settingsStyle, documentStyle} {
+		if style, ok := styles.Registry[name]; ok {
+			return style
+		}
 	}
 
-	style := styles.Get(styleName)
-	if style == nil {
-		return styles.Fallback
+	if getColorScheme(r) == ColorSchemeLight {
+		if style, ok := styles.Registry[s.cfg.DefaultLightStyle]; ok {
+			return style
+		}
 	}
+	return styles.Fallback
+}
 
-	return style
+// getUserStyle returns the style the user picked with the style query parameter or the style cookie.
+func getUserStyle(r *http.Request) string {
+	styleName := r.URL.Query().Get("style")
+	if styleName == "" {
+		if styleCookie, err := r.Cookie("style"); err == nil {
+			styleName = styleCookie.Value
+		}
+	}
+	return styleName
+}
+
+// getColorScheme returns the preferred color scheme of the user from the client hint or the cookie the frontend sets.
+func getColorScheme(r *http.Request) string {
+	colorScheme := strings.Trim(r.Header.Get(ezhttp.HeaderSecCHPrefersColorScheme), `"`)
+	if colorScheme == "" {
+		if colorSchemeCookie, err := r.Cookie("color_scheme"); err == nil {
+			colorScheme = colorSchemeCookie.Value
+		}
+	}
+	return colorScheme
+}
+
+// setColorSchemeHints asks browsers which support it to send their color scheme, Critical-CH makes them retry the first
+// request with it, so the page doesn't switch its style after loading.
+func setColorSchemeHints(w http.ResponseWriter) {
+	w.Header().Set(ezhttp.HeaderAcceptCH, ezhttp.HeaderSecCHPrefersColorScheme)
+	w.Header().Set(ezhttp.HeaderCriticalCH, ezhttp.HeaderSecCHPrefersColorScheme)
+	w.Header().Add(ezhttp.HeaderVary, ezhttp.HeaderSecCHPrefersColorScheme)
 }
 
 func (s *Server) ThemeCSS(w http.ResponseWriter, r *http.Request) {
-	style := getStyle(r)
+	style := s.getStyle(r)
 	cssBuff := s.themeCSS(style)
 
 	w.Header().Set(ezhttp.HeaderContentType, ezhttp.ContentTypeCSS)
@@ -61,3 +119,73 @@ func (s *Server) themeCSS(style *chroma.Style) string {
 	_ = s.htmlFormatter.WriteCSS(cssBuff, style)
 	return cssBuff.String()
 }
+
+type (
+	StylesResponse struct {
+		Styles       []StyleResponse `json:"styles"`
+		Default      string          `json:"default"`
+		DefaultLight string          `json:"default_light"`
+	}
+
+	DocumentStyleResponse struct {
+		Style string `json:"style"`
+	}
+
+	StyleResponse struct {
+		Name  string `json:"name"`
+		Theme string `json:"theme"`
+	}
+)
+
+// GetStyles lists the styles of the server including the custom ones. Clients which render documents themselves use
+// it to offer the same styles, the colors of a style come from /assets/theme.css.
+func (s *Server) GetStyles(w http.ResponseWriter, r *http.Request) {
+	response := StylesResponse{
+		Styles:       make([]StyleResponse, len(s.styles)),
+		Default:      styles.Fallback.Name,
+		DefaultLight: styles.Get(s.cfg.DefaultLightStyle).Name,
+	}
+	for i, style := range s.styles {
+		response.Styles[i] = StyleResponse{
+			Name:  style.Name,
+			Theme: style.Theme,
+		}
+	}
+	s.ok(w, r, response)
+}
+
+// PutDocumentStyle sets the style which is suggested to viewers of the document who didn't pick a style themselves.
+func (s *Server) PutDocumentStyle(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionWrite) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+		return
+	}
+
+	var styleRequest api.DocumentStyleRequest
+	if err := json.NewDecoder(r.Body).Decode(&styleRequest); err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+	if err := validateDocumentStyle(styleRequest.Style); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	if err := s.db.SetDocumentStyle(r.Context(), documentID, styleRequest.Style); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, DocumentStyleResponse{Style: styleRequest.Style})
+}
+
+// validateDocumentStyle allows an empty style which removes the suggested style.
+func validateDocumentStyle(style string) error {
+	if _, ok := styles.Registry[style]; style != "" && !ok {
+		return httperr.BadRequest(ErrUnknownStyle)
+	}
+	return nil
+}
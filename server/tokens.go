@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/httperr"
+)
+
+const ScopeRead = "read"
+
+var (
+	ErrNoReadTokenDocuments = errors.New("no documents provided")
+	ErrTooManyReadTokenDocs = errors.New("too many documents, must be at most 100")
+	ErrInvalidDocumentToken = func(documentID string) error {
+		return fmt.Errorf("invalid token for document: %s", documentID)
+	}
+	ErrReadTokenRequired = errors.New("read token required")
+)
+
+const maxReadTokenDocuments = 100
+
+func (s *Server) NewReadToken(documentIDs []string) (string, error) {
+	claims := newClaims("", 0)
+	claims.Scope = ScopeRead
+	claims.Documents = documentIDs
+	return jwt.Signed(s.signer).Claims(claims).CompactSerialize()
+}
+
+// PostReadToken issues a read-only token for a set of documents. The caller has to prove access to every document with one of its tokens.
+func (s *Server) PostReadToken(w http.ResponseWriter, r *http.Request) {
+	var rq api.ReadTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&rq); err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+
+	if len(rq.Documents) == 0 {
+		s.error(w, r, httperr.BadRequest(ErrNoReadTokenDocuments))
+		return
+	}
+	if len(rq.Documents) > maxReadTokenDocuments {
+		s.error(w, r, httperr.BadRequest(ErrTooManyReadTokenDocs))
+		return
+	}
+
+	documentIDs := make([]string, 0, len(rq.Documents))
+	for _, document := range rq.Documents {
+		if !s.verifyDocumentToken(r.Context(), document.Key, document.Token) {
+			s.error(w, r, httperr.Forbidden(ErrInvalidDocumentToken(document.Key)))
+			return
+		}
+		versions, err := s.db.GetDocumentVersions(r.Context(), document.Key)
+		if err != nil {
+			s.error(w, r, fmt.Errorf("failed to get document: %w", err))
+			return
+		}
+		if len(versions) == 0 {
+			s.error(w, r, httperr.NotFound(ErrDocumentNotFound))
+			return
+		}
+		if !slices.Contains(documentIDs, document.Key) {
+			documentIDs = append(documentIDs, document.Key)
+		}
+	}
+
+	token, err := s.NewReadToken(documentIDs)
+	if err != nil {
+		s.error(w, r, fmt.Errorf("failed to create read token: %w", err))
+		return
+	}
+
+	s.json(w, r, api.ReadTokenResponse{
+		Token:     token,
+		Documents: documentIDs,
+	}, http.StatusCreated)
+}
+
+// GetReadTokenDocuments returns the current version of every document the read token grants access to.
+func (s *Server) GetReadTokenDocuments(w http.ResponseWriter, r *http.Request) {
+	claims := GetClaims(r)
+	if claims.Scope != ScopeRead {
+		s.error(w, r, httperr.Unauthorized(ErrReadTokenRequired))
+		return
+	}
+
+	withContent := r.URL.Query().Get("withContent") == "true"
+	formatter, _ := getFormatter(r, false)
+	style := s.getStyle(r)
+
+	response := make([]api.DocumentResponse, 0, len(claims.Documents))
+	for _, documentID := range claims.Documents {
+		files, err := s.db.GetDocument(r.Context(), documentID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			s.error(w, r, fmt.Errorf("failed to get document: %w", err))
+			return
+		}
+
+		document := api.DocumentResponse{
+			Key:   documentID,
+			Files: make([]api.ResponseFile, len(files)),
+		}
+		for i, file := range files {
+			document.Version = file.DocumentVersion
+			responseFile := api.ResponseFile{
+				Name:      file.Name,
+				Language:  file.Language,
+				Encrypted: file.Encrypted,
+				ExpiresAt: file.ExpiresAt,
+				SHA256:    fileChecksum(file),
+			}
+			if withContent {
+				responseFile.Content = file.Content
+				if formatter != nil {
+					responseFile.Formatted, err = s.formatFile(r.Context(), file, formatter, style)
+					if err != nil {
+						s.error(w, r, err)
+						return
+					}
+				}
+			}
+			document.Files[i] = responseFile
+		}
+		response = append(response, document)
+	}
+
+	s.ok(w, r, response)
+}
+
+func (s *Server) verifyDocumentToken(ctx context.Context, documentID string, tokenString string) bool {
+	_, ok := s.documentTokenClaims(ctx, documentID, tokenString)
+	return ok
+}
+
+// documentTokenClaims returns the claims of a token if it is a valid token of the document. Tokens from invites get the
+// current permissions of the member.
+func (s *Server) documentTokenClaims(ctx context.Context, documentID string, tokenString string) (*Claims, bool) {
+	var claims Claims
+	err := s.jwtKeys.Verify(tokenString, &claims)
+	if err != nil {
+		return nil, false
+	}
+	if claims.Scope != "" || claims.Subject != documentID {
+		return nil, false
+	}
+	if err = s.resolveMemberClaims(ctx, &claims); err != nil {
+		return nil, false
+	}
+	if err = s.useToken(ctx, tokenString, claims); err != nil {
+		return nil, false
+	}
+	return &claims, true
+}
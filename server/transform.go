@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/internal/transform"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+// maxTransformSize limits the content of files which are transformed, decoded binary data grows about four times as
+// hex dump.
+const maxTransformSize = 1024 * 1024
+
+// applyTransform decodes the content of the file with the transform query parameter and sets the language of the
+// decoded content. Files are left as they are without a transform.
+func applyTransform(r *http.Request, file *database.File) error {
+	name := r.URL.Query().Get("transform")
+	if name == "" {
+		return nil
+	}
+	if file.Encrypted {
+		return httperr.BadRequest(ErrFileEncrypted)
+	}
+
+	result, err := transform.Apply(name, file.Content, maxTransformSize)
+	if err != nil {
+		return httperr.BadRequest(err)
+	}
+	file.Content = result.Content
+	file.Language = result.Language
+	return nil
+}
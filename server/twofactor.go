@@ -0,0 +1,895 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-jose/go-jose/v3/jwt"
+
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/internal/totp"
+	"github.com/topi314/gobin/v3/internal/webauthn"
+	"github.com/topi314/gobin/v3/server/database"
+	"github.com/topi314/gobin/v3/server/templates"
+)
+
+const (
+	twoFactorCookieName   = "two_factor"
+	twoFactorCookieMaxAge = 10 * time.Minute
+
+	scopePasskeyRegistration = "passkey_registration"
+	scopePasskeyLogin        = "passkey_login"
+	// passkeyChallengeTTL is how long the browser has to answer a passkey challenge.
+	passkeyChallengeTTL = 5 * time.Minute
+
+	recoveryCodeCount    = 10
+	maxPasskeyNameLength = 64
+
+	// twoFactorMaxAttempts is how many attempts to confirm a login an account has per twoFactorAttemptWindow, the
+	// codes of authenticator apps only have a million possibilities.
+	twoFactorMaxAttempts   = 5
+	twoFactorAttemptWindow = 15 * time.Minute
+)
+
+var (
+	ErrTwoFactorRequired        = errors.New("this instance requires a second factor, set up an authenticator app or passkey on the settings page or log in again with yours")
+	ErrInvalidTwoFactorLogin    = errors.New("second factor expired or was started in another browser, please log in again")
+	ErrInvalidTwoFactorCode     = errors.New("invalid code or passkey")
+	ErrTooManyTwoFactorAttempts = errors.New("too many attempts to confirm the login, try again later")
+	ErrMissingTwoFactor         = errors.New("code, recovery_code or passkey is required")
+	ErrTOTPEnabled              = errors.New("authenticator app already set up, remove it first")
+	ErrTOTPNotStarted           = errors.New("authenticator app setup not started")
+	ErrNoTwoFactor              = errors.New("set up an authenticator app or passkey first")
+	ErrLastTwoFactor            = errors.New("this instance requires a second factor, add another one before removing this one")
+	ErrPasskeyNotFound          = errors.New("passkey not found")
+	ErrNoPasskeys               = errors.New("account has no passkeys")
+	ErrInvalidPasskeyChallenge  = errors.New("passkey challenge expired, please try again")
+	ErrPasskeyNameTooLong       = fmt.Errorf("passkey name must be at most %d characters", maxPasskeyNameLength)
+)
+
+type (
+	TwoFactorResponse struct {
+		// Required is set if the instance requires a second factor and the session wasn't confirmed with one.
+		Required bool `json:"required"`
+		TOTP     bool `json:"totp"`
+		// RecoveryCodes is the number of unused recovery codes.
+		RecoveryCodes int               `json:"recovery_codes"`
+		Passkeys      []PasskeyResponse `json:"passkeys"`
+	}
+
+	PasskeyResponse struct {
+		ID         string     `json:"id"`
+		Name       string     `json:"name"`
+		CreatedAt  time.Time  `json:"created_at"`
+		LastUsedAt *time.Time `json:"last_used_at"`
+	}
+
+	TOTPResponse struct {
+		// Secret is the base32 encoded secret to enter in the authenticator app, URI is the otpauth:// uri of it.
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+	}
+
+	TOTPConfirmRequest struct {
+		Code string `json:"code"`
+	}
+
+	// TwoFactorSetupResponse is returned after adding a factor, the recovery codes are only set for the first one.
+	TwoFactorSetupResponse struct {
+		Passkey       *PasskeyResponse `json:"passkey,omitempty"`
+		RecoveryCodes []string         `json:"recovery_codes,omitempty"`
+	}
+
+	RecoveryCodesResponse struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	// PasskeyOptionsResponse are the options of navigator.credentials.create or get, binary values are base64url
+	// encoded. State has to be sent back with the passkey.
+	PasskeyOptionsResponse struct {
+		State     string `json:"state"`
+		Challenge string `json:"challenge"`
+		RPID      string `json:"rp_id"`
+		// UserID, UserName and Algorithms are only set to register a passkey.
+		UserID     string `json:"user_id,omitempty"`
+		UserName   string `json:"user_name,omitempty"`
+		Algorithms []int  `json:"algorithms,omitempty"`
+		// Credentials are the passkeys of the account, they are excluded from the registration or allowed for the
+		// login.
+		Credentials []string `json:"credentials"`
+	}
+
+	PasskeyRequest struct {
+		Name              string `json:"name"`
+		State             string `json:"state"`
+		ClientDataJSON    string `json:"client_data_json"`
+		AttestationObject string `json:"attestation_object"`
+	}
+
+	PasskeyAssertion struct {
+		State             string `json:"state"`
+		ID                string `json:"id"`
+		ClientDataJSON    string `json:"client_data_json"`
+		AuthenticatorData string `json:"authenticator_data"`
+		Signature         string `json:"signature"`
+	}
+
+	// TwoFactorLoginRequest confirms a login with one of the factors.
+	TwoFactorLoginRequest struct {
+		Code         string            `json:"code"`
+		RecoveryCode string            `json:"recovery_code"`
+		Passkey      *PasskeyAssertion `json:"passkey"`
+	}
+
+	TwoFactorLoginResponse struct {
+		Redirect string `json:"redirect"`
+	}
+
+	// twoFactorClaims are stored in the two_factor cookie between the login at the provider and the second factor.
+	twoFactorClaims struct {
+		jwt.Claims
+		Scope    string `json:"scp"`
+		Redirect string `json:"redirect"`
+	}
+
+	// passkeyClaims are the state of a passkey challenge, the subject is the account.
+	passkeyClaims struct {
+		jwt.Claims
+		Scope     string `json:"scp"`
+		Challenge string `json:"challenge"`
+	}
+)
+
+// GetTwoFactor returns the second factors of the logged-in account.
+func (s *Server) GetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	session, err := s.requireTwoFactorSession(r, false)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	twoFactor, err := s.getAccountTwoFactor(r, session.AccountID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	recoveryCodes, err := s.db.GetAccountRecoveryCodeCount(r.Context(), session.AccountID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	passkeys, err := s.db.GetAccountPasskeys(r.Context(), session.AccountID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	response := TwoFactorResponse{
+		Required:      s.cfg.Accounts.RequireTwoFactor && !session.TwoFactor,
+		TOTP:          twoFactor.TOTPEnabled,
+		RecoveryCodes: recoveryCodes,
+		Passkeys:      make([]PasskeyResponse, len(passkeys)),
+	}
+	for i, passkey := range passkeys {
+		response.Passkeys[i] = newPasskeyResponse(passkey)
+	}
+	s.ok(w, r, response)
+}
+
+// PostTOTP starts to set up an authenticator app with a new secret, it is used once a code of it was confirmed.
+func (s *Server) PostTOTP(w http.ResponseWriter, r *http.Request) {
+	session, err := s.requireTwoFactorSession(r, true)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	twoFactor, err := s.getAccountTwoFactor(r, session.AccountID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if twoFactor.TOTPEnabled {
+		s.error(w, r, httperr.Conflict(ErrTOTPEnabled))
+		return
+	}
+	account, err := s.db.GetAccount(r.Context(), session.AccountID)
+	if err != nil {
+		s.error(w, r, fmt.Errorf("failed to get account: %w", err))
+		return
+	}
+
+	secret := totp.NewSecret()
+	encryptedSecret, err := s.secrets.Encrypt(r.Context(), secret)
+	if err != nil {
+		s.error(w, r, fmt.Errorf("failed to encrypt totp secret: %w", err))
+		return
+	}
+	if err = s.db.SetAccountTOTPSecret(r.Context(), session.AccountID, encryptedSecret); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	// the issuer is separated from the account by a colon in the label, so it can't contain the port
+	s.ok(w, r, TOTPResponse{
+		Secret: secret,
+		URI:    totp.URI(relyingParty(r).ID, account.Name, secret),
+	})
+}
+
+// PostTOTPConfirm enables the authenticator app with its first code.
+func (s *Server) PostTOTPConfirm(w http.ResponseWriter, r *http.Request) {
+	session, err := s.requireTwoFactorSession(r, true)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	var rq TOTPConfirmRequest
+	if err = json.NewDecoder(r.Body).Decode(&rq); err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+
+	twoFactor, err := s.getAccountTwoFactor(r, session.AccountID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if twoFactor.TOTPEnabled {
+		s.error(w, r, httperr.Conflict(ErrTOTPEnabled))
+		return
+	}
+	if twoFactor.TOTPSecret == "" {
+		s.error(w, r, httperr.BadRequest(ErrTOTPNotStarted))
+		return
+	}
+	secret, err := s.secrets.Decrypt(r.Context(), twoFactor.TOTPSecret)
+	if err != nil {
+		s.error(w, r, fmt.Errorf("failed to decrypt totp secret: %w", err))
+		return
+	}
+	step, ok := totp.Validate(secret, rq.Code, time.Now(), twoFactor.TOTPLastStep)
+	if !ok {
+		s.error(w, r, httperr.BadRequest(ErrInvalidTwoFactorCode))
+		return
+	}
+
+	first, err := s.hasNoTwoFactor(r, session.AccountID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if err = s.db.EnableAccountTOTP(r.Context(), session.AccountID, step); err != nil {
+		s.error(w, r, err)
+		return
+	}
+	recoveryCodes, err := s.addedTwoFactor(r, session, first)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, TwoFactorSetupResponse{RecoveryCodes: recoveryCodes})
+}
+
+// DeleteTOTP removes the authenticator app of the account.
+func (s *Server) DeleteTOTP(w http.ResponseWriter, r *http.Request) {
+	session, err := s.requireTwoFactorSession(r, true)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	twoFactor, err := s.getAccountTwoFactor(r, session.AccountID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	passkeys, err := s.db.GetAccountPasskeys(r.Context(), session.AccountID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if twoFactor.TOTPEnabled && len(passkeys) == 0 && s.cfg.Accounts.RequireTwoFactor {
+		s.error(w, r, httperr.Conflict(ErrLastTwoFactor))
+		return
+	}
+
+	if err = s.db.DisableAccountTOTP(r.Context(), session.AccountID); err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if len(passkeys) == 0 {
+		if err = s.db.DeleteAccountRecoveryCodes(r.Context(), session.AccountID); err != nil {
+			s.error(w, r, err)
+			return
+		}
+	}
+
+	s.ok(w, r, nil)
+}
+
+// PostRecoveryCodes replaces the recovery codes of the account with new ones.
+func (s *Server) PostRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	session, err := s.requireTwoFactorSession(r, true)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	none, err := s.hasNoTwoFactor(r, session.AccountID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if none {
+		s.error(w, r, httperr.BadRequest(ErrNoTwoFactor))
+		return
+	}
+
+	recoveryCodes, err := s.newRecoveryCodes(r, session.AccountID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	s.ok(w, r, RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+}
+
+// PostPasskeyOptions returns the challenge to register a new passkey with.
+func (s *Server) PostPasskeyOptions(w http.ResponseWriter, r *http.Request) {
+	session, err := s.requireTwoFactorSession(r, true)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	account, err := s.db.GetAccount(r.Context(), session.AccountID)
+	if err != nil {
+		s.error(w, r, fmt.Errorf("failed to get account: %w", err))
+		return
+	}
+	response, err := s.newPasskeyOptions(r, scopePasskeyRegistration, session.AccountID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	response.UserID = base64.RawURLEncoding.EncodeToString([]byte(account.ID))
+	response.UserName = account.Name
+	response.Algorithms = webauthn.Algorithms
+
+	s.ok(w, r, response)
+}
+
+// PostPasskey registers the passkey created for the challenge of PostPasskeyOptions.
+func (s *Server) PostPasskey(w http.ResponseWriter, r *http.Request) {
+	session, err := s.requireTwoFactorSession(r, true)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	var rq PasskeyRequest
+	if err = json.NewDecoder(r.Body).Decode(&rq); err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+	name := strings.TrimSpace(rq.Name)
+	if name == "" {
+		name = "passkey"
+	}
+	if len([]rune(name)) > maxPasskeyNameLength {
+		s.error(w, r, httperr.BadRequest(ErrPasskeyNameTooLong))
+		return
+	}
+
+	challenge, err := s.getPasskeyChallenge(rq.State, scopePasskeyRegistration, session.AccountID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	clientDataJSON, err := base64.RawURLEncoding.DecodeString(rq.ClientDataJSON)
+	if err != nil {
+		s.error(w, r, httperr.BadRequest(fmt.Errorf("invalid client_data_json: %w", err)))
+		return
+	}
+	attestationObject, err := base64.RawURLEncoding.DecodeString(rq.AttestationObject)
+	if err != nil {
+		s.error(w, r, httperr.BadRequest(fmt.Errorf("invalid attestation_object: %w", err)))
+		return
+	}
+	credential, err := relyingParty(r).Register(challenge, clientDataJSON, attestationObject)
+	if err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+
+	first, err := s.hasNoTwoFactor(r, session.AccountID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	passkey := database.AccountPasskey{
+		ID:        base64.RawURLEncoding.EncodeToString(credential.ID),
+		AccountID: session.AccountID,
+		Name:      name,
+		PublicKey: base64.RawURLEncoding.EncodeToString(credential.PublicKey),
+		SignCount: int64(credential.SignCount),
+		CreatedAt: time.Now(),
+	}
+	if err = s.db.CreateAccountPasskey(r.Context(), passkey); err != nil {
+		s.error(w, r, err)
+		return
+	}
+	recoveryCodes, err := s.addedTwoFactor(r, session, first)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	passkeyResponse := newPasskeyResponse(passkey)
+	s.ok(w, r, TwoFactorSetupResponse{
+		Passkey:       &passkeyResponse,
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+// DeletePasskey removes a passkey of the account.
+func (s *Server) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	session, err := s.requireTwoFactorSession(r, true)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	twoFactor, err := s.getAccountTwoFactor(r, session.AccountID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	passkeys, err := s.db.GetAccountPasskeys(r.Context(), session.AccountID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	last := !twoFactor.TOTPEnabled && len(passkeys) == 1
+	if last && s.cfg.Accounts.RequireTwoFactor {
+		s.error(w, r, httperr.Conflict(ErrLastTwoFactor))
+		return
+	}
+
+	if err = s.db.DeleteAccountPasskey(r.Context(), session.AccountID, chi.URLParam(r, "passkeyID")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrPasskeyNotFound))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+	if last {
+		if err = s.db.DeleteAccountRecoveryCodes(r.Context(), session.AccountID); err != nil {
+			s.error(w, r, err)
+			return
+		}
+	}
+
+	s.ok(w, r, nil)
+}
+
+// GetPrettyTwoFactorLogin renders the page to confirm a login with a second factor.
+func (s *Server) GetPrettyTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	claims, err := s.getTwoFactorClaims(r)
+	if err != nil {
+		s.prettyError(w, r, httperr.BadRequest(err))
+		return
+	}
+
+	twoFactor, err := s.getAccountTwoFactor(r, claims.Subject)
+	if err != nil {
+		s.prettyError(w, r, err)
+		return
+	}
+	passkeys, err := s.db.GetAccountPasskeys(r.Context(), claims.Subject)
+	if err != nil {
+		s.prettyError(w, r, err)
+		return
+	}
+
+	setColorSchemeHints(w)
+	style := s.getStyle(r)
+	vars := templates.TwoFactorVars{
+		TOTP:     twoFactor.TOTPEnabled,
+		Passkeys: len(passkeys) > 0,
+		Style:    style.Name,
+		Theme:    style.Theme,
+		Assets:   s.assetManifest,
+	}
+	if err = templates.TwoFactor(vars).Render(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "failed to execute template", slog.Any("err", err))
+	}
+}
+
+// PostTwoFactorLoginOptions returns the challenge to confirm a login with a passkey.
+func (s *Server) PostTwoFactorLoginOptions(w http.ResponseWriter, r *http.Request) {
+	claims, err := s.getTwoFactorClaims(r)
+	if err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+
+	response, err := s.newPasskeyOptions(r, scopePasskeyLogin, claims.Subject)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if len(response.Credentials) == 0 {
+		s.error(w, r, httperr.BadRequest(ErrNoPasskeys))
+		return
+	}
+	s.ok(w, r, response)
+}
+
+// PostTwoFactorLogin confirms the login with a code of the authenticator app, a recovery code or a passkey and sets
+// the account cookie. Every account has twoFactorMaxAttempts attempts per twoFactorAttemptWindow.
+func (s *Server) PostTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	claims, err := s.getTwoFactorClaims(r)
+	if err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+
+	var rq TwoFactorLoginRequest
+	if err = json.NewDecoder(r.Body).Decode(&rq); err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+	if rq.Code == "" && rq.RecoveryCode == "" && rq.Passkey == nil {
+		s.error(w, r, httperr.BadRequest(ErrMissingTwoFactor))
+		return
+	}
+
+	accountID := claims.Subject
+	now := time.Now()
+	attempts, err := s.db.AddAccountTwoFactorAttempt(r.Context(), accountID, now, now.Add(-twoFactorAttemptWindow))
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if attempts > twoFactorMaxAttempts {
+		s.error(w, r, httperr.TooManyRequests(ErrTooManyTwoFactorAttempts))
+		return
+	}
+
+	var ok bool
+	switch {
+	case rq.Passkey != nil:
+		ok, err = s.useLoginPasskey(r, accountID, *rq.Passkey)
+	case rq.RecoveryCode != "":
+		ok, err = s.useRecoveryCode(r, accountID, rq.RecoveryCode)
+	default:
+		ok, err = s.useTOTPCode(r, accountID, rq.Code)
+	}
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if !ok {
+		s.error(w, r, httperr.Unauthorized(ErrInvalidTwoFactorCode))
+		return
+	}
+
+	if err = s.db.ResetAccountTwoFactorAttempts(r.Context(), accountID); err != nil {
+		slog.ErrorContext(r.Context(), "failed to reset two-factor attempts", slog.Any("err", err))
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:   twoFactorCookieName,
+		Path:   "/login",
+		MaxAge: -1,
+	})
+	token, expiresAt, err := s.newAccountToken(r, accountID, AccountSessionKindBrowser, true)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	setAccountCookie(w, r, token, expiresAt)
+	s.ok(w, r, TwoFactorLoginResponse{Redirect: claims.Redirect})
+}
+
+// startTwoFactorLogin sets the two_factor cookie after the login at the provider and redirects the browser to confirm
+// the login with a second factor.
+func (s *Server) startTwoFactorLogin(w http.ResponseWriter, r *http.Request, accountID string, redirect string) {
+	claims := twoFactorClaims{
+		Claims: jwt.Claims{
+			Subject:  accountID,
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+			Expiry:   jwt.NewNumericDate(time.Now().Add(twoFactorCookieMaxAge)),
+		},
+		Scope:    twoFactorCookieName,
+		Redirect: redirect,
+	}
+	token, err := jwt.Signed(s.signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		s.prettyError(w, r, fmt.Errorf("failed to create two-factor cookie: %w", err))
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     twoFactorCookieName,
+		Value:    token,
+		Path:     "/login",
+		MaxAge:   int(twoFactorCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		// set during the redirect from the provider like the login cookie
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/login/two-factor", http.StatusFound)
+}
+
+func (s *Server) getTwoFactorClaims(r *http.Request) (*twoFactorClaims, error) {
+	if !s.cfg.Accounts.Enabled {
+		return nil, ErrAccountsDisabled
+	}
+	cookie, err := r.Cookie(twoFactorCookieName)
+	if err != nil {
+		return nil, ErrInvalidTwoFactorLogin
+	}
+	var claims twoFactorClaims
+	if err = s.jwtKeys.Verify(cookie.Value, &claims); err != nil || claims.Scope != twoFactorCookieName || claims.Subject == "" {
+		return nil, ErrInvalidTwoFactorLogin
+	}
+	if err = claims.ValidateWithLeeway(jwt.Expected{Time: time.Now()}, 0); err != nil {
+		return nil, ErrInvalidTwoFactorLogin
+	}
+	return &claims, nil
+}
+
+// requireTwoFactorSession returns the session of the logged-in account to manage its second factors. Sessions without
+// a second factor may only see and add factors while the account has none, so a stolen session can't replace them.
+func (s *Server) requireTwoFactorSession(r *http.Request, change bool) (*database.AccountSession, error) {
+	if !s.cfg.Accounts.Enabled {
+		return nil, httperr.NotFound(ErrAccountsDisabled)
+	}
+	session := s.lookupAccountSession(r)
+	if session == nil {
+		return nil, httperr.Unauthorized(ErrNotLoggedIn)
+	}
+	if session.TwoFactor || !change {
+		return session, nil
+	}
+	none, err := s.hasNoTwoFactor(r, session.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	if !none {
+		return nil, httperr.Forbidden(ErrTwoFactorRequired)
+	}
+	return session, nil
+}
+
+// getAccountTwoFactor returns the authenticator app of the account, accounts without one get an empty one.
+func (s *Server) getAccountTwoFactor(r *http.Request, accountID string) (*database.AccountTwoFactor, error) {
+	twoFactor, err := s.db.GetAccountTwoFactor(r.Context(), accountID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &database.AccountTwoFactor{AccountID: accountID}, nil
+		}
+		return nil, fmt.Errorf("failed to get account two-factor: %w", err)
+	}
+	return twoFactor, nil
+}
+
+// hasNoTwoFactor returns whether the account has neither an authenticator app nor a passkey. Recovery codes only
+// exist along with them.
+func (s *Server) hasNoTwoFactor(r *http.Request, accountID string) (bool, error) {
+	twoFactor, err := s.getAccountTwoFactor(r, accountID)
+	if err != nil {
+		return false, err
+	}
+	if twoFactor.TOTPEnabled {
+		return false, nil
+	}
+	passkeys, err := s.db.GetAccountPasskeys(r.Context(), accountID)
+	if err != nil {
+		return false, err
+	}
+	return len(passkeys) == 0, nil
+}
+
+// addedTwoFactor confirms the session with the factor it just added. The first factor of an account also gets recovery
+// codes and revokes the other sessions, they were never confirmed with a second factor.
+func (s *Server) addedTwoFactor(r *http.Request, session *database.AccountSession, first bool) ([]string, error) {
+	if !session.TwoFactor {
+		if err := s.db.SetAccountSessionTwoFactor(r.Context(), session.ID); err != nil {
+			return nil, err
+		}
+	}
+	if !first {
+		return nil, nil
+	}
+	if err := s.db.DeleteOtherAccountSessions(r.Context(), session.AccountID, session.ID); err != nil {
+		return nil, err
+	}
+	return s.newRecoveryCodes(r, session.AccountID)
+}
+
+// newRecoveryCodes replaces the recovery codes of the account, only their hashes are stored.
+func (s *Server) newRecoveryCodes(r *http.Request, accountID string) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code := rand.Text()[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashRecoveryCode(code)
+	}
+	if err := s.db.SetAccountRecoveryCodes(r.Context(), accountID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Server) useTOTPCode(r *http.Request, accountID string, code string) (bool, error) {
+	twoFactor, err := s.getAccountTwoFactor(r, accountID)
+	if err != nil || !twoFactor.TOTPEnabled {
+		return false, err
+	}
+	secret, err := s.secrets.Decrypt(r.Context(), twoFactor.TOTPSecret)
+	if err != nil {
+		return false, fmt.Errorf("failed to decrypt totp secret: %w", err)
+	}
+	step, ok := totp.Validate(secret, code, time.Now(), twoFactor.TOTPLastStep)
+	if !ok {
+		return false, nil
+	}
+	// a parallel request may have used the same code since
+	if err = s.db.UseAccountTOTPStep(r.Context(), accountID, step); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Server) useRecoveryCode(r *http.Request, accountID string, code string) (bool, error) {
+	if err := s.db.UseAccountRecoveryCode(r.Context(), accountID, hashRecoveryCode(code)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Server) useLoginPasskey(r *http.Request, accountID string, assertion PasskeyAssertion) (bool, error) {
+	challenge, err := s.getPasskeyChallenge(assertion.State, scopePasskeyLogin, accountID)
+	if err != nil {
+		return false, err
+	}
+	passkey, err := s.db.GetAccountPasskey(r.Context(), accountID, assertion.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get account passkey: %w", err)
+	}
+	credentialID, err := base64.RawURLEncoding.DecodeString(passkey.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to decode passkey id: %w", err)
+	}
+	publicKey, err := base64.RawURLEncoding.DecodeString(passkey.PublicKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to decode passkey public key: %w", err)
+	}
+
+	clientDataJSON, err1 := base64.RawURLEncoding.DecodeString(assertion.ClientDataJSON)
+	authenticatorData, err2 := base64.RawURLEncoding.DecodeString(assertion.AuthenticatorData)
+	signature, err3 := base64.RawURLEncoding.DecodeString(assertion.Signature)
+	if err = errors.Join(err1, err2, err3); err != nil {
+		return false, httperr.BadRequest(fmt.Errorf("invalid passkey: %w", err))
+	}
+
+	signCount, err := relyingParty(r).Verify(webauthn.Credential{
+		ID:        credentialID,
+		PublicKey: publicKey,
+		SignCount: uint32(passkey.SignCount),
+	}, challenge, clientDataJSON, authenticatorData, signature)
+	if err != nil {
+		slog.DebugContext(r.Context(), "failed to verify passkey", slog.Any("err", err))
+		return false, nil
+	}
+	if err = s.db.UseAccountPasskey(r.Context(), passkey.ID, int64(signCount), time.Now()); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// newPasskeyOptions returns a new challenge with the passkeys of the account and signs it into the state, so it
+// doesn't have to be stored.
+func (s *Server) newPasskeyOptions(r *http.Request, scope string, accountID string) (*PasskeyOptionsResponse, error) {
+	passkeys, err := s.db.GetAccountPasskeys(r.Context(), accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge := make([]byte, 32)
+	_, _ = rand.Read(challenge)
+	claims := passkeyClaims{
+		Claims: jwt.Claims{
+			Subject:  accountID,
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+			Expiry:   jwt.NewNumericDate(time.Now().Add(passkeyChallengeTTL)),
+		},
+		Scope:     scope,
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+	}
+	state, err := jwt.Signed(s.signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create passkey state: %w", err)
+	}
+
+	response := PasskeyOptionsResponse{
+		State:       state,
+		Challenge:   claims.Challenge,
+		RPID:        relyingParty(r).ID,
+		Credentials: make([]string, len(passkeys)),
+	}
+	for i, passkey := range passkeys {
+		response.Credentials[i] = passkey.ID
+	}
+	return &response, nil
+}
+
+// getPasskeyChallenge returns the challenge of the state if it was issued for the scope and account and didn't expire.
+func (s *Server) getPasskeyChallenge(state string, scope string, accountID string) ([]byte, error) {
+	var claims passkeyClaims
+	if err := s.jwtKeys.Verify(state, &claims); err != nil || claims.Scope != scope || claims.Subject != accountID {
+		return nil, httperr.BadRequest(ErrInvalidPasskeyChallenge)
+	}
+	if err := claims.ValidateWithLeeway(jwt.Expected{Time: time.Now()}, 0); err != nil {
+		return nil, httperr.BadRequest(ErrInvalidPasskeyChallenge)
+	}
+	challenge, err := base64.RawURLEncoding.DecodeString(claims.Challenge)
+	if err != nil {
+		return nil, httperr.BadRequest(ErrInvalidPasskeyChallenge)
+	}
+	return challenge, nil
+}
+
+// relyingParty returns the site passkeys are registered for, the host of the request like the login redirect url.
+func relyingParty(r *http.Request) webauthn.Relying {
+	id := r.Host
+	if host, _, err := net.SplitHostPort(r.Host); err == nil {
+		id = host
+	}
+	return webauthn.Relying{
+		ID:   id,
+		Host: r.Host,
+	}
+}
+
+func newPasskeyResponse(passkey database.AccountPasskey) PasskeyResponse {
+	return PasskeyResponse{
+		ID:         passkey.ID,
+		Name:       passkey.Name,
+		CreatedAt:  passkey.CreatedAt,
+		LastUsedAt: passkey.LastUsedAt,
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/internal/httprate"
+)
+
+var ErrUserAgentDenied = errors.New("user agent is not allowed")
+
+// UserAgentClass is the kind of client a request comes from, it's derived from the User-Agent header.
+type UserAgentClass string
+
+const (
+	UserAgentClassCLI     UserAgentClass = "cli"
+	UserAgentClassBot     UserAgentClass = "bot"
+	UserAgentClassBrowser UserAgentClass = "browser"
+	UserAgentClassOther   UserAgentClass = "other"
+)
+
+type userAgentClassKey struct{}
+
+var userAgentClassContextKey = userAgentClassKey{}
+
+// GetUserAgentClass returns the class of the request, requests are only classified if user agents are enabled.
+func GetUserAgentClass(r *http.Request) UserAgentClass {
+	if class, ok := r.Context().Value(userAgentClassContextKey).(UserAgentClass); ok {
+		return class
+	}
+	return UserAgentClassOther
+}
+
+// matchUserAgent returns whether the user agent contains one of the patterns, ignoring the case.
+func matchUserAgent(userAgent string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if pattern != "" && strings.Contains(userAgent, strings.ToLower(pattern)) {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyUserAgent returns the class of the user agent. Bots are matched first since many of them pretend to be a
+// browser, everything with Mozilla in it is a browser otherwise.
+func (s *Server) classifyUserAgent(userAgent string) UserAgentClass {
+	userAgent = strings.ToLower(userAgent)
+	switch {
+	case matchUserAgent(userAgent, s.cfg.UserAgents.Bots):
+		return UserAgentClassBot
+	case matchUserAgent(userAgent, s.cfg.UserAgents.CLI):
+		return UserAgentClassCLI
+	case strings.Contains(userAgent, "mozilla/"):
+		return UserAgentClassBrowser
+	}
+	return UserAgentClassOther
+}
+
+// newUserAgentRateLimiters creates the rate limiters of the user agent classes which have a limit. They share the store
+// of the rate limit, or use their own memory store if the rate limit is disabled.
+func (s *Server) newUserAgentRateLimiters() {
+	if s.rateLimitStore == nil {
+		s.rateLimitStore = httprate.NewMemoryStore()
+	}
+	onRequestLimit := func(w http.ResponseWriter, r *http.Request) {
+		s.error(w, r, httperr.TooManyRequests(ErrRateLimit))
+	}
+
+	cfg := s.cfg.UserAgents
+	s.userAgentRateLimiters = make(map[UserAgentClass]func(http.Handler) http.Handler)
+	for class, policy := range map[UserAgentClass]RateLimitPolicy{
+		UserAgentClassCLI:     cfg.CLIRateLimit,
+		UserAgentClassBot:     cfg.BotRateLimit,
+		UserAgentClassBrowser: cfg.BrowserRateLimit,
+	} {
+		if policy.Requests <= 0 || policy.Duration <= 0 {
+			continue
+		}
+		s.userAgentRateLimiters[class] = httprate.NewRateLimiter(s.rateLimitStore, "user_agent_"+string(class), policy.Requests, time.Duration(policy.Duration), rateLimitKey, onRequestLimit).Handler
+	}
+}
+
+// UserAgentMiddleware classifies the request by its user agent, rejects denied user agents and applies the rate limit
+// of the class. User agents on the allow list are never denied or limited by their class.
+func (s *Server) UserAgentMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent := strings.ToLower(r.Header.Get(ezhttp.HeaderUserAgent))
+		class := s.classifyUserAgent(userAgent)
+		r = r.WithContext(context.WithValue(r.Context(), userAgentClassContextKey, class))
+
+		if matchUserAgent(userAgent, s.cfg.UserAgents.Allow) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if matchUserAgent(userAgent, s.cfg.UserAgents.Deny) {
+			s.error(w, r, httperr.Forbidden(ErrUserAgentDenied))
+			return
+		}
+
+		if handler, ok := s.userAgentRateLimiters[class]; ok {
+			handler(next).ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/topi314/gobin/v3/internal/timex"
+	"github.com/topi314/gobin/v3/internal/vault"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+// NewVault logs in to Vault and replaces the secrets of the config with the ones from Vault. The jwt_secret and
+// encryption_key of the KV secret replace the JWT secret and the encryption key, the database uses credentials of the
+// database role. Call Run of the client to keep the token and credentials renewed.
+func NewVault(ctx context.Context, cfg *Config) (*vault.Client, error) {
+	token := cfg.Vault.Token
+	if cfg.Vault.TokenFile != "" {
+		data, err := os.ReadFile(cfg.Vault.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vault token file: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	var secretID string
+	if token == "" && cfg.Vault.SecretIDFile != "" {
+		data, err := os.ReadFile(cfg.Vault.SecretIDFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vault secret id file: %w", err)
+		}
+		secretID = strings.TrimSpace(string(data))
+	}
+
+	client, err := vault.New(ctx, vault.Config{
+		Address:   cfg.Vault.Address,
+		Namespace: cfg.Vault.Namespace,
+		Token:     token,
+		RoleID:    cfg.Vault.RoleID,
+		SecretID:  secretID,
+		Timeout:   time.Duration(cfg.Vault.Timeout),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Vault.SecretPath != "" {
+		secret, err := client.ReadSecret(ctx, cfg.Vault.SecretMount, cfg.Vault.SecretPath)
+		if err != nil {
+			return nil, err
+		}
+		if jwtSecret := secret["jwt_secret"]; jwtSecret != "" {
+			cfg.JWTSecret = jwtSecret
+		}
+		if encryptionKey := secret["encryption_key"]; encryptionKey != "" {
+			cfg.Encryption.Key = encryptionKey
+			cfg.Encryption.KeyFile = ""
+		}
+	}
+
+	if cfg.Vault.DatabaseRole != "" {
+		if cfg.Database.Type != database.TypePostgres {
+			slog.WarnContext(ctx, "Vault database credentials are only used for PostgreSQL", slog.String("type", string(cfg.Database.Type)))
+			return client, nil
+		}
+		credentials, err := client.DatabaseCredentials(ctx, cfg.Vault.DatabaseMount, cfg.Vault.DatabaseRole)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Database.Credentials = client.Credentials
+		// connections have to be replaced before the credentials they were opened with expire
+		if maxLifetime := timex.Duration(credentials.Lease / 2); credentials.Lease > 0 && (cfg.Database.ConnMaxLifetime == 0 || cfg.Database.ConnMaxLifetime > maxLifetime) {
+			cfg.Database.ConnMaxLifetime = maxLifetime
+		}
+	}
+	return client, nil
+}
@@ -3,13 +3,20 @@ package server
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -19,68 +26,50 @@ import (
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 
+	"github.com/topi314/gobin/v3/api"
 	"github.com/topi314/gobin/v3/internal/ezhttp"
 	"github.com/topi314/gobin/v3/internal/flags"
 	"github.com/topi314/gobin/v3/internal/httperr"
 	"github.com/topi314/gobin/v3/server/database"
 )
 
+// GlobalWebhookID is the webhook id of events sent to the global webhooks of the config.
+const GlobalWebhookID = "global"
+
 var (
 	ErrWebhookNotFound            = errors.New("webhook not found")
 	ErrMissingWebhookSecret       = errors.New("missing webhook secret")
 	ErrMissingWebhookURL          = errors.New("missing webhook url")
 	ErrMissingWebhookEvents       = errors.New("missing webhook events")
-	ErrMissingURLOrSecretOrEvents = errors.New("missing url, secret or events")
+	ErrMissingURLOrSecretOrEvents = errors.New("missing url, secret, events or enabled")
+	ErrWebhookDeliveryNotFound    = errors.New("webhook delivery not found")
+	ErrWebhookDeliveryPending     = errors.New("webhook delivery is still pending")
+	ErrInvalidDeliveriesLimit     = errors.New("invalid limit, must be between 1 and 100")
+	ErrInvalidContentURL          = errors.New("invalid content url signature")
+	ErrContentURLExpired          = errors.New("content url expired")
 )
 
-type (
-	WebhookCreateRequest struct {
-		URL    string   `json:"url"`
-		Secret string   `json:"secret"`
-		Events []string `json:"events"`
-	}
-
-	WebhookUpdateRequest struct {
-		URL    string   `json:"url"`
-		Secret string   `json:"secret"`
-		Events []string `json:"events"`
-	}
-
-	WebhookResponse struct {
-		ID          string   `json:"id"`
-		DocumentKey string   `json:"document_key"`
-		URL         string   `json:"url"`
-		Secret      string   `json:"secret"`
-		Events      []string `json:"events"`
-	}
-
-	WebhookEventRequest struct {
-		WebhookID string          `json:"webhook_id"`
-		Event     string          `json:"event"`
-		CreatedAt time.Time       `json:"created_at"`
-		Document  WebhookDocument `json:"document"`
-	}
-
-	WebhookDocument struct {
-		Key     string                `json:"key"`
-		Version int64                 `json:"version"`
-		Files   []WebhookDocumentFile `json:"files"`
-	}
+const (
+	defaultDeliveriesLimit = 20
+	maxDeliveriesLimit     = 100
+)
 
-	WebhookDocumentFile struct {
-		Name      string     `json:"name"`
-		Content   string     `json:"content"`
-		Language  string     `json:"language"`
-		ExpiresAt *time.Time `json:"expires_at"`
+type (
+	WebhooksResponse struct {
+		Webhooks []api.WebhookResponse `json:"webhooks"`
 	}
 )
 
 const (
-	WebhookEventUpdate string = "update"
-	WebhookEventDelete string = "delete"
+	WebhookEventCreate          string = "create"
+	WebhookEventUpdate          string = "update"
+	WebhookEventDelete          string = "delete"
+	WebhookEventRevisionPending string = "revision_pending"
+	// WebhookEventLogin is only sent to account webhooks when a new session of the account is created.
+	WebhookEventLogin string = "login"
 )
 
-func (s *Server) ExecuteWebhooks(ctx context.Context, event string, document WebhookDocument) {
+func (s *Server) ExecuteWebhooks(ctx context.Context, event string, document api.WebhookDocument) {
 	if !s.cfg.Webhook.Enabled {
 		return
 	}
@@ -95,7 +84,7 @@ func (s *Server) ExecuteWebhooks(ctx context.Context, event string, document Web
 	}()
 }
 
-func (s *Server) executeWebhooks(ctx context.Context, event string, document WebhookDocument) {
+func (s *Server) executeWebhooks(ctx context.Context, event string, document api.WebhookDocument) {
 	defer s.webhookWaitGroup.Done()
 
 	dbCtx, cancel := context.WithTimeout(ctx, time.Duration(s.cfg.Webhook.Timeout))
@@ -114,99 +103,484 @@ func (s *Server) executeWebhooks(ctx context.Context, event string, document Web
 		slog.ErrorContext(dbCtx, "failed to get webhooks by document id", slog.Any("err", err))
 		return
 	}
+	// account webhooks are kept when the document is deleted, they receive the events of the other documents too
+	accountWebhooks, err := s.db.GetAccountWebhooksByDocumentID(dbCtx, document.Key)
+	if err != nil {
+		slog.ErrorContext(dbCtx, "failed to get account webhooks by document id", slog.Any("err", err))
+	}
+	webhooks = append(webhooks, accountWebhooks...)
+	webhooks = append(webhooks, s.globalWebhooks(document.Key)...)
 
 	if len(webhooks) == 0 {
 		return
 	}
+	document = s.limitWebhookDocument(ctx, event, document)
 
 	now := time.Now()
 	var wg sync.WaitGroup
 	for _, webhook := range webhooks {
-		if !slices.Contains(strings.Split(webhook.Events, ","), event) {
+		if !webhook.Enabled || !slices.Contains(strings.Split(webhook.Events, ","), event) {
+			continue
+		}
+
+		delivery, err := s.createWebhookDelivery(dbCtx, webhook, api.WebhookEventRequest{
+			SchemaVersion: api.WebhookSchemaVersion,
+			WebhookID:     webhook.ID,
+			Event:         event,
+			CreatedAt:     now,
+			Document:      document,
+		})
+		if err != nil {
+			slog.ErrorContext(dbCtx, "failed to create webhook delivery", slog.String("webhook_id", webhook.ID), slog.Any("err", err))
 			continue
 		}
 
 		wg.Add(1)
-		go func(webhook database.Webhook) {
+		go func() {
 			defer wg.Done()
-			s.executeWebhook(ctx, webhook.URL, webhook.Secret, WebhookEventRequest{
-				WebhookID: webhook.ID,
-				Event:     event,
-				CreatedAt: now,
-				Document:  document,
-			})
-		}(webhook)
+			s.deliverWebhook(ctx, *delivery)
+		}()
 	}
 	wg.Wait()
 
 	slog.DebugContext(ctx, "finished emitting webhooks", slog.String("event", event), slog.Any("document_id", document.Key))
 }
 
-func (s *Server) executeWebhook(ctx context.Context, url string, secret string, request WebhookEventRequest) {
-	ctx, span := s.tracer.Start(ctx, "executeWebhook", trace.WithAttributes(
-		attribute.String("url", url),
-		attribute.String("event", request.Event),
-		attribute.String("document_id", request.Document.Key),
+// ExecuteAccountWebhooks sends an event of the account itself, which isn't about one of its documents, to the webhooks
+// of the account.
+func (s *Server) ExecuteAccountWebhooks(ctx context.Context, accountID string, event string, session api.WebhookSession) {
+	if !s.cfg.Webhook.Enabled {
+		return
+	}
+	s.webhookWaitGroup.Add(1)
+	ctx, span := s.tracer.Start(context.WithoutCancel(ctx), "executeAccountWebhooks", trace.WithAttributes(
+		attribute.String("event", event),
+		attribute.String("account_id", accountID),
 	))
-	defer span.End()
+	go func() {
+		defer span.End()
+		s.executeAccountWebhooks(ctx, accountID, event, session)
+	}()
+}
 
-	logger := slog.Default().With(slog.String("event", request.Event), slog.Any("webhook_id", request.WebhookID), slog.Any("document_id", request.Document.Key))
-	logger.DebugContext(ctx, "emitting webhook", slog.String("url", url))
+func (s *Server) executeAccountWebhooks(ctx context.Context, accountID string, event string, session api.WebhookSession) {
+	defer s.webhookWaitGroup.Done()
 
-	buff := new(bytes.Buffer)
-	if err := json.NewEncoder(buff).Encode(request); err != nil {
-		span.SetStatus(codes.Error, "failed to encode document")
-		span.RecordError(err)
-		logger.ErrorContext(ctx, "failed to encode document", slog.Any("err", err))
+	dbCtx, cancel := context.WithTimeout(ctx, time.Duration(s.cfg.Webhook.Timeout))
+	defer cancel()
+
+	webhooks, err := s.db.GetAccountWebhooks(dbCtx, accountID)
+	if err != nil {
+		slog.ErrorContext(dbCtx, "failed to get account webhooks", slog.Any("err", err))
 		return
 	}
 
-	rq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, buff)
+	now := time.Now()
+	var wg sync.WaitGroup
+	for _, webhook := range webhooks {
+		if !webhook.Enabled || !slices.Contains(strings.Split(webhook.Events, ","), event) {
+			continue
+		}
+
+		delivery, err := s.createWebhookDelivery(dbCtx, webhook, api.WebhookEventRequest{
+			SchemaVersion: api.WebhookSchemaVersion,
+			WebhookID:     webhook.ID,
+			Event:         event,
+			CreatedAt:     now,
+			Session:       &session,
+		})
+		if err != nil {
+			slog.ErrorContext(dbCtx, "failed to create webhook delivery", slog.String("webhook_id", webhook.ID), slog.Any("err", err))
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.deliverWebhook(ctx, *delivery)
+		}()
+	}
+	wg.Wait()
+
+	slog.DebugContext(ctx, "finished emitting account webhooks", slog.String("event", event), slog.String("account_id", accountID))
+}
+
+func newWebhookSession(session database.AccountSession) api.WebhookSession {
+	return api.WebhookSession{
+		ID:        session.ID,
+		AccountID: session.AccountID,
+		Kind:      session.Kind,
+		UserAgent: session.UserAgent,
+		Address:   session.Address,
+		CreatedAt: session.CreatedAt,
+		ExpiresAt: session.ExpiresAt,
+	}
+}
+
+// limitWebhookDocument removes the contents of documents which are larger than the max payload size, so receivers with
+// a limited body size don't fail the delivery. Files of created and updated documents get a signed url to fetch their
+// content instead, deleted documents and pending revisions can't be fetched anymore.
+func (s *Server) limitWebhookDocument(ctx context.Context, event string, document api.WebhookDocument) api.WebhookDocument {
+	if s.cfg.Webhook.MaxPayloadSize <= 0 {
+		return document
+	}
+	payload, err := json.Marshal(document)
+	if err != nil || int64(len(payload)) <= s.cfg.Webhook.MaxPayloadSize {
+		return document
+	}
+
+	withURLs := (event == WebhookEventCreate || event == WebhookEventUpdate) && s.cfg.Webhook.BaseURL != "" && contentURLSecret(s.cfg) != ""
+	expiresAt := time.Now().Add(time.Duration(s.cfg.Webhook.ContentURLExpiry))
+	files := make([]api.WebhookDocumentFile, len(document.Files))
+	for i, file := range document.Files {
+		file.Size = len(file.Content)
+		file.Content = ""
+		if withURLs {
+			file.ContentURL = s.contentURL(document.Key, document.Version, file.Name, expiresAt)
+		}
+		files[i] = file
+	}
+	document.Files = files
+	document.ContentOmitted = true
+	slog.DebugContext(ctx, "omitting content of webhook document", slog.String("document_id", document.Key), slog.Int("size", len(payload)))
+	return document
+}
+
+// contentURL returns the url of the raw file version which is signed until it expires.
+func (s *Server) contentURL(documentID string, version int64, fileName string, expiresAt time.Time) string {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", s.contentURLSignature(documentID, version, fileName, expires))
+	return fmt.Sprintf("%s/raw/%s/versions/%d/files/%s?%s", strings.TrimSuffix(s.cfg.Webhook.BaseURL, "/"), url.PathEscape(documentID), version, url.PathEscape(fileName), query.Encode())
+}
+
+func (s *Server) contentURLSignature(documentID string, version int64, fileName string, expires string) string {
+	mac := hmac.New(sha256.New, []byte(contentURLSecret(s.cfg)))
+	mac.Write([]byte(documentID + "\n" + strconv.FormatInt(version, 10) + "\n" + fileName + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyContentURL checks the signature of content urls, requests without a signature are not checked.
+func (s *Server) verifyContentURL(r *http.Request) error {
+	signature := r.URL.Query().Get("signature")
+	if signature == "" {
+		return nil
+	}
+	// never accept signatures made with an empty secret
+	if contentURLSecret(s.cfg) == "" {
+		return httperr.Forbidden(ErrInvalidContentURL)
+	}
+	version, err := strconv.ParseInt(chi.URLParam(r, "version"), 10, 64)
+	if err != nil {
+		return httperr.Forbidden(ErrInvalidContentURL)
+	}
+	expires := r.URL.Query().Get("expires")
+	expected := s.contentURLSignature(chi.URLParam(r, "documentID"), version, chi.URLParam(r, "fileName"), expires)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return httperr.Forbidden(ErrInvalidContentURL)
+	}
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return httperr.Forbidden(ErrContentURLExpired)
+	}
+	return nil
+}
+
+// globalWebhooks returns the webhooks of the config which receive the events of all documents.
+func (s *Server) globalWebhooks(documentID string) []database.Webhook {
+	webhooks := make([]database.Webhook, len(s.cfg.Webhook.Global))
+	for i, webhook := range s.cfg.Webhook.Global {
+		webhooks[i] = database.Webhook{
+			ID:         GlobalWebhookID,
+			DocumentID: documentID,
+			URL:        webhook.URL,
+			Secret:     webhook.Secret,
+			Events:     strings.Join(webhook.Events, ","),
+			Enabled:    true,
+		}
+	}
+	return webhooks
+}
+
+// createWebhookDelivery stores the event before it is sent, the id of the delivery is the message id of the
+// Standard Webhooks spec so receivers can ignore duplicates.
+func (s *Server) createWebhookDelivery(ctx context.Context, webhook database.Webhook, request api.WebhookEventRequest) (*database.WebhookDelivery, error) {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode document: %w", err)
+	}
+
+	// the secrets of global webhooks come from the config and are not encrypted yet
+	secret := webhook.Secret
+	if webhook.ID == GlobalWebhookID {
+		if secret, err = s.secrets.Encrypt(ctx, secret); err != nil {
+			return nil, fmt.Errorf("failed to encrypt secret: %w", err)
+		}
+	}
+
+	delivery := database.WebhookDelivery{
+		ID:         "msg_" + rand.Text(),
+		WebhookID:  webhook.ID,
+		DocumentID: request.Document.Key,
+		URL:        webhook.URL,
+		Secret:     secret,
+		Event:      request.Event,
+		Payload:    string(payload),
+		Status:     database.WebhookDeliveryPending,
+		CreatedAt:  request.CreatedAt,
+
+		ClientCertificate: webhook.ClientCertificate,
+	}
+	if err = s.db.CreateWebhookDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// resumeWebhookDeliveries continues the deliveries which were still pending when the server stopped.
+func (s *Server) resumeWebhookDeliveries() {
+	ctx, cancel := context.WithTimeout(s.webhookContext, time.Duration(s.cfg.Webhook.Timeout))
+	defer cancel()
+
+	deliveries, err := s.db.GetPendingWebhookDeliveries(ctx)
 	if err != nil {
-		span.SetStatus(codes.Error, "failed to create request")
+		slog.ErrorContext(ctx, "failed to get pending webhook deliveries", slog.Any("err", err))
+		return
+	}
+
+	for _, delivery := range deliveries {
+		s.redeliverWebhook(delivery)
+	}
+}
+
+func (s *Server) redeliverWebhook(delivery database.WebhookDelivery) {
+	s.webhookWaitGroup.Add(1)
+	go func() {
+		defer s.webhookWaitGroup.Done()
+		s.deliverWebhook(context.Background(), delivery)
+	}()
+}
+
+// deliverWebhook sends the delivery until it succeeds or the max tries are reached. Every try is stored as an
+// attempt. If the server is closed in between the delivery stays pending and is resumed on the next start. A
+// Retry-After of the receiver is waited for before the next try, a 410 Gone fails the delivery and disables the webhook.
+func (s *Server) deliverWebhook(ctx context.Context, delivery database.WebhookDelivery) {
+	ctx, span := s.tracer.Start(ctx, "deliverWebhook", trace.WithAttributes(
+		attribute.String("url", delivery.URL),
+		attribute.String("event", delivery.Event),
+		attribute.String("document_id", delivery.DocumentID),
+		attribute.String("delivery_id", delivery.ID),
+	))
+	defer span.End()
+
+	logger := slog.Default().With(slog.String("event", delivery.Event), slog.String("webhook_id", delivery.WebhookID), slog.String("document_id", delivery.DocumentID), slog.String("delivery_id", delivery.ID))
+	logger.DebugContext(ctx, "emitting webhook", slog.String("url", delivery.URL))
+
+	var request api.WebhookEventRequest
+	if err := json.Unmarshal([]byte(delivery.Payload), &request); err != nil {
+		span.SetStatus(codes.Error, "failed to decode payload")
 		span.RecordError(err)
-		logger.ErrorContext(ctx, "failed to create request", slog.Any("err", err))
+		logger.ErrorContext(ctx, "failed to decode payload", slog.Any("err", err))
 		return
 	}
-	rq.Header.Add(ezhttp.HeaderContentType, ezhttp.ContentTypeJSON)
-	rq.Header.Add(ezhttp.HeaderUserAgent, fmt.Sprintf("gobin/%s", s.version.Version))
-	rq.Header.Add(ezhttp.HeaderAuthorization, fmt.Sprintf("Secret %s", secret))
+	body := []byte(delivery.Payload)
 
-	for i := 0; i < s.cfg.Webhook.MaxTries; i++ {
+	var retryAfter time.Duration
+	for i := delivery.Attempts; i < s.cfg.Webhook.MaxTries; i++ {
 		backoff := time.Duration(s.cfg.Webhook.BackoffFactor * float64(s.cfg.Webhook.Backoff) * float64(i))
+		if backoff > time.Duration(s.cfg.Webhook.MaxBackoff) {
+			backoff = time.Duration(s.cfg.Webhook.MaxBackoff)
+		}
+		if retryAfter > backoff {
+			backoff = min(retryAfter, time.Duration(s.cfg.Webhook.MaxRetryAfter))
+		}
 		if backoff > time.Nanosecond {
-			if backoff > time.Duration(s.cfg.Webhook.MaxBackoff) {
-				backoff = time.Duration(s.cfg.Webhook.MaxBackoff)
-			}
 			logger.DebugContext(ctx, "sleeping backoff", slog.Duration("backoff", backoff))
-			time.Sleep(backoff)
+			select {
+			case <-s.webhookContext.Done():
+				logger.DebugContext(ctx, "server closed, delivery stays pending")
+				return
+			case <-time.After(backoff):
+			}
 		}
 
-		rs, err := s.client.Do(rq)
-		if err != nil {
-			logger.DebugContext(ctx, "failed to execute request", slog.Any("err", err))
-			continue
+		attempt := database.WebhookDeliveryAttempt{
+			DeliveryID: delivery.ID,
 		}
+		result := s.sendWebhook(ctx, logger, delivery, body, &attempt)
+		attempt.CreatedAt = time.Now()
+		retryAfter = result.retryAfter
 
-		if rs.StatusCode < 200 || rs.StatusCode >= 300 {
-			logger.DebugContext(ctx, "invalid status code", slog.Int("status", rs.StatusCode))
-			continue
+		status := database.WebhookDeliveryPending
+		if result.success {
+			status = database.WebhookDeliverySucceeded
+		} else if result.gone || i+1 >= s.cfg.Webhook.MaxTries {
+			status = database.WebhookDeliveryFailed
 		}
 
-		logger.DebugContext(ctx, "successfully executed webhook", slog.String("status", rs.Status))
-		return
+		dbCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Duration(s.cfg.Webhook.Timeout))
+		err := s.db.AddWebhookDeliveryAttempt(dbCtx, attempt, status)
+		cancel()
+		if err != nil {
+			span.RecordError(err)
+			logger.ErrorContext(ctx, "failed to add webhook delivery attempt", slog.Any("err", err))
+		}
+
+		if result.success {
+			logger.DebugContext(ctx, "successfully executed webhook", slog.Int("status", attempt.StatusCode))
+			s.RecordEvent(ctx, EventWebhook, request.Document.Key, request.Document.Version, EventWebhookData{
+				WebhookID: request.WebhookID,
+				Event:     request.Event,
+				Success:   true,
+				Tries:     i + 1,
+			})
+			return
+		}
+		if result.gone {
+			s.disableWebhook(ctx, logger, delivery)
+			s.RecordEvent(ctx, EventWebhook, request.Document.Key, request.Document.Version, EventWebhookData{
+				WebhookID: request.WebhookID,
+				Event:     request.Event,
+				Success:   false,
+				Tries:     i + 1,
+			})
+			return
+		}
 	}
 
-	err = errors.New("max tries reached")
+	err := errors.New("max tries reached")
 	span.SetStatus(codes.Error, "failed to execute webhook")
 	span.RecordError(err)
 	logger.ErrorContext(ctx, "failed to execute webhook", slog.Any("err", err))
+	s.RecordEvent(ctx, EventWebhook, request.Document.Key, request.Document.Version, EventWebhookData{
+		WebhookID: request.WebhookID,
+		Event:     request.Event,
+		Success:   false,
+		Tries:     s.cfg.Webhook.MaxTries,
+	})
+}
+
+// disableWebhook disables the webhook of the delivery after the receiver responded with 410 Gone. Global webhooks
+// come from the config and can't be disabled.
+func (s *Server) disableWebhook(ctx context.Context, logger *slog.Logger, delivery database.WebhookDelivery) {
+	if delivery.WebhookID == GlobalWebhookID {
+		logger.WarnContext(ctx, "global webhook responded with 410 Gone", slog.String("url", delivery.URL))
+		return
+	}
+
+	dbCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Duration(s.cfg.Webhook.Timeout))
+	defer cancel()
+	reason := fmt.Sprintf("receiver responded with 410 Gone at %s", time.Now().UTC().Format(time.RFC3339))
+	if err := s.db.DisableWebhook(dbCtx, delivery.DocumentID, delivery.WebhookID, reason); err != nil {
+		logger.ErrorContext(ctx, "failed to disable webhook", slog.Any("err", err))
+		return
+	}
+	logger.InfoContext(ctx, "disabled webhook, the receiver responded with 410 Gone")
+}
+
+// webhookResult is the outcome of sending a delivery once.
+type webhookResult struct {
+	success bool
+	// gone is set when the receiver responded with 410 Gone, the webhook is disabled then.
+	gone bool
+	// retryAfter is the Retry-After of a 429 or 503 response.
+	retryAfter time.Duration
+}
+
+// parseRetryAfter parses the Retry-After header as seconds or as HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
+}
+
+// sendWebhook sends the delivery once and fills in the status code or error of the attempt.
+func (s *Server) sendWebhook(ctx context.Context, logger *slog.Logger, delivery database.WebhookDelivery, body []byte, attempt *database.WebhookDeliveryAttempt) webhookResult {
+	secret, err := s.secrets.Decrypt(ctx, delivery.Secret)
+	if err != nil {
+		attempt.Error = "failed to decrypt secret"
+		logger.ErrorContext(ctx, "failed to decrypt secret", slog.Any("err", err))
+		return webhookResult{}
+	}
+
+	rq, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		logger.ErrorContext(ctx, "failed to create request", slog.Any("err", err))
+		return webhookResult{}
+	}
+	rq.Header.Add(ezhttp.HeaderContentType, ezhttp.ContentTypeJSON)
+	rq.Header.Add(ezhttp.HeaderUserAgent, fmt.Sprintf("gobin/%s", s.version.Version))
+	rq.Header.Add(ezhttp.HeaderAuthorization, fmt.Sprintf("Secret %s", secret))
+	signWebhook(rq.Header, secret, delivery.ID, time.Now(), body)
+
+	client, err := s.webhookClient(ctx, delivery)
+	if err != nil {
+		attempt.Error = err.Error()
+		logger.ErrorContext(ctx, "failed to get client", slog.Any("err", err))
+		return webhookResult{}
+	}
+
+	rs, err := client.Do(rq)
+	if err != nil {
+		attempt.Error = err.Error()
+		logger.DebugContext(ctx, "failed to execute request", slog.Any("err", err))
+		return webhookResult{}
+	}
+	_ = rs.Body.Close()
+
+	attempt.StatusCode = rs.StatusCode
+	if rs.StatusCode < 200 || rs.StatusCode >= 300 {
+		attempt.Error = "invalid status code: " + rs.Status
+		logger.DebugContext(ctx, "invalid status code", slog.Int("status", rs.StatusCode))
+		var result webhookResult
+		switch rs.StatusCode {
+		case http.StatusGone:
+			result.gone = true
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			result.retryAfter = parseRetryAfter(rs.Header.Get(ezhttp.HeaderRetryAfter), time.Now())
+		}
+		return result
+	}
+	return webhookResult{success: true}
+}
+
+// signWebhook adds the signature headers of the Standard Webhooks spec (https://www.standardwebhooks.com) and a
+// X-Gobin-Signature-256 header with the HMAC-SHA256 of the body. Secrets with the whsec_ prefix are base64 encoded like
+// the spec describes, all other secrets are used as they are.
+func signWebhook(header http.Header, secret string, messageID string, timestamp time.Time, body []byte) {
+	key := []byte(secret)
+	if encodedKey, ok := strings.CutPrefix(secret, "whsec_"); ok {
+		if decodedKey, err := base64.StdEncoding.DecodeString(encodedKey); err == nil {
+			key = decodedKey
+		}
+	}
+
+	unixTimestamp := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(messageID + "." + unixTimestamp + "."))
+	mac.Write(body)
+	header.Set(ezhttp.HeaderWebhookID, messageID)
+	header.Set(ezhttp.HeaderWebhookTimestamp, unixTimestamp)
+	header.Set(ezhttp.HeaderWebhookSignature, "v1,"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	mac = hmac.New(sha256.New, key)
+	mac.Write(body)
+	header.Set(ezhttp.HeaderSignature256, "sha256="+hex.EncodeToString(mac.Sum(nil)))
 }
 
 func (s *Server) PostDocumentWebhook(w http.ResponseWriter, r *http.Request) {
 	documentID := chi.URLParam(r, "documentID")
 
-	var webhookCreate WebhookCreateRequest
+	var webhookCreate api.WebhookCreateRequest
 	if err := json.NewDecoder(r.Body).Decode(&webhookCreate); err != nil {
 		s.error(w, r, httperr.BadRequest(err))
 		return
@@ -233,19 +607,64 @@ func (s *Server) PostDocumentWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	webhook, err := s.db.CreateWebhook(r.Context(), documentID, webhookCreate.URL, webhookCreate.Secret, webhookCreate.Events)
+	clientCertificate, err := s.sealClientCertificate(r.Context(), webhookCreate.ClientCertificate, webhookCreate.ClientKey)
+	if err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+
+	secret, err := s.secrets.Encrypt(r.Context(), webhookCreate.Secret)
 	if err != nil {
 		s.error(w, r, err)
 		return
 	}
 
-	s.ok(w, r, WebhookResponse{
-		ID:          webhook.ID,
-		DocumentKey: webhook.DocumentID,
-		URL:         webhook.URL,
-		Secret:      webhook.Secret,
-		Events:      strings.Split(webhook.Events, ","),
+	webhook, err := s.db.CreateWebhook(r.Context(), database.Webhook{
+		DocumentID:        documentID,
+		URL:               webhookCreate.URL,
+		Secret:            secret,
+		SecretHash:        database.SecretHash(webhookCreate.Secret),
+		Events:            strings.Join(webhookCreate.Events, ","),
+		ClientCertificate: clientCertificate,
+		Enabled:           webhookCreate.Enabled == nil || *webhookCreate.Enabled,
 	})
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	response := s.newWebhookResponse(r.Context(), *webhook)
+	response.Secret = webhookCreate.Secret
+	s.ok(w, r, response)
+}
+
+// GetDocumentWebhooks lists the webhooks of the document for tokens with the webhook permission. Secrets are never
+// returned and passwords in the urls are redacted.
+func (s *Server) GetDocumentWebhooks(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	claims := GetClaims(r)
+	if flags.Misses(claims.Permissions, PermissionWebhook) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("webhook")))
+		return
+	}
+
+	webhooks, err := s.db.GetWebhooksByDocumentID(r.Context(), documentID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	response := WebhooksResponse{
+		Webhooks: make([]api.WebhookResponse, len(webhooks)),
+	}
+	for i, webhook := range webhooks {
+		response.Webhooks[i] = s.newWebhookResponse(r.Context(), webhook)
+		if webhookURL, err := url.Parse(webhook.URL); err == nil {
+			response.Webhooks[i].URL = webhookURL.Redacted()
+		}
+	}
+	s.ok(w, r, response)
 }
 
 func (s *Server) GetDocumentWebhook(w http.ResponseWriter, r *http.Request) {
@@ -257,7 +676,7 @@ func (s *Server) GetDocumentWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	webhook, err := s.db.GetWebhook(r.Context(), documentID, webhookID, secret)
+	webhook, err := s.db.GetWebhook(r.Context(), documentID, webhookID, database.SecretHash(secret))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			s.error(w, r, httperr.NotFound(ErrWebhookNotFound))
@@ -267,13 +686,7 @@ func (s *Server) GetDocumentWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.ok(w, r, WebhookResponse{
-		ID:          webhook.ID,
-		DocumentKey: webhook.DocumentID,
-		URL:         webhook.URL,
-		Secret:      webhook.Secret,
-		Events:      strings.Split(webhook.Events, ","),
-	})
+	s.ok(w, r, s.newWebhookResponse(r.Context(), *webhook))
 }
 
 func (s *Server) PatchDocumentWebhook(w http.ResponseWriter, r *http.Request) {
@@ -285,18 +698,51 @@ func (s *Server) PatchDocumentWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var webhookUpdate WebhookUpdateRequest
+	var webhookUpdate api.WebhookUpdateRequest
 	if err := json.NewDecoder(r.Body).Decode(&webhookUpdate); err != nil {
 		s.error(w, r, httperr.BadRequest(err))
 		return
 	}
 
-	if webhookUpdate.URL == "" && webhookUpdate.Secret == "" && len(webhookUpdate.Events) == 0 {
+	updateCertificate := webhookUpdate.ClientCertificate != "" || webhookUpdate.ClientKey != "" || webhookUpdate.RemoveClientCertificate
+	if webhookUpdate.URL == "" && webhookUpdate.Secret == "" && len(webhookUpdate.Events) == 0 && webhookUpdate.Enabled == nil && !updateCertificate {
 		s.error(w, r, httperr.BadRequest(ErrMissingURLOrSecretOrEvents))
 		return
 	}
 
-	webhook, err := s.db.UpdateWebhook(r.Context(), documentID, webhookID, secret, webhookUpdate.URL, webhookUpdate.Secret, webhookUpdate.Events)
+	var (
+		webhook *database.Webhook
+		err     error
+	)
+	if updateCertificate {
+		var clientCertificate string
+		if !webhookUpdate.RemoveClientCertificate {
+			if clientCertificate, err = s.sealClientCertificate(r.Context(), webhookUpdate.ClientCertificate, webhookUpdate.ClientKey); err != nil {
+				s.error(w, r, httperr.BadRequest(err))
+				return
+			}
+		}
+		// the client certificate is set first since the update can change the secret
+		webhook, err = s.db.SetWebhookClientCertificate(r.Context(), documentID, webhookID, database.SecretHash(secret), clientCertificate)
+	}
+	if err == nil && (webhookUpdate.URL != "" || webhookUpdate.Secret != "" || len(webhookUpdate.Events) > 0 || webhookUpdate.Enabled != nil) {
+		update := database.WebhookUpdate{
+			ID:         webhookID,
+			DocumentID: documentID,
+			SecretHash: database.SecretHash(secret),
+			NewURL:     webhookUpdate.URL,
+			NewEvents:  strings.Join(webhookUpdate.Events, ","),
+			NewEnabled: webhookUpdate.Enabled,
+		}
+		if webhookUpdate.Secret != "" {
+			if update.NewSecret, err = s.secrets.Encrypt(r.Context(), webhookUpdate.Secret); err != nil {
+				s.error(w, r, err)
+				return
+			}
+			update.NewSecretHash = database.SecretHash(webhookUpdate.Secret)
+		}
+		webhook, err = s.db.UpdateWebhook(r.Context(), update)
+	}
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			s.error(w, r, httperr.NotFound(ErrWebhookNotFound))
@@ -306,13 +752,7 @@ func (s *Server) PatchDocumentWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.ok(w, r, WebhookResponse{
-		ID:          webhook.ID,
-		DocumentKey: webhook.DocumentID,
-		URL:         webhook.URL,
-		Secret:      webhook.Secret,
-		Events:      strings.Split(webhook.Events, ","),
-	})
+	s.ok(w, r, s.newWebhookResponse(r.Context(), *webhook))
 }
 
 func (s *Server) DeleteDocumentWebhook(w http.ResponseWriter, r *http.Request) {
@@ -324,7 +764,310 @@ func (s *Server) DeleteDocumentWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.db.DeleteWebhook(r.Context(), documentID, webhookID, secret); err != nil {
+	if err := s.db.DeleteWebhook(r.Context(), documentID, webhookID, database.SecretHash(secret)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrWebhookNotFound))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, nil)
+}
+
+func (s *Server) GetDocumentWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+	webhookID := chi.URLParam(r, "webhookID")
+	secret := GetWebhookSecret(r)
+	if secret == "" {
+		s.error(w, r, httperr.BadRequest(ErrMissingWebhookSecret))
+		return
+	}
+
+	limit := defaultDeliveriesLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxDeliveriesLimit {
+			s.error(w, r, httperr.BadRequest(ErrInvalidDeliveriesLimit))
+			return
+		}
+	}
+
+	if _, err := s.db.GetWebhook(r.Context(), documentID, webhookID, database.SecretHash(secret)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrWebhookNotFound))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+
+	deliveries, err := s.db.GetWebhookDeliveries(r.Context(), documentID, webhookID, limit)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	deliveryIDs := make([]string, len(deliveries))
+	for i, delivery := range deliveries {
+		deliveryIDs[i] = delivery.ID
+	}
+	attempts, err := s.db.GetWebhookDeliveryAttempts(r.Context(), deliveryIDs)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	deliveryAttempts := make(map[string][]api.WebhookDeliveryAttemptResponse, len(deliveries))
+	for _, attempt := range attempts {
+		deliveryAttempts[attempt.DeliveryID] = append(deliveryAttempts[attempt.DeliveryID], api.WebhookDeliveryAttemptResponse{
+			StatusCode: attempt.StatusCode,
+			Error:      attempt.Error,
+			CreatedAt:  attempt.CreatedAt,
+		})
+	}
+
+	response := api.WebhookDeliveriesResponse{
+		Deliveries: make([]api.WebhookDeliveryResponse, len(deliveries)),
+	}
+	for i, delivery := range deliveries {
+		response.Deliveries[i] = newWebhookDeliveryResponse(delivery, deliveryAttempts[delivery.ID])
+	}
+
+	s.ok(w, r, response)
+}
+
+func (s *Server) PostDocumentWebhookRedelivery(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+	webhookID := chi.URLParam(r, "webhookID")
+	deliveryID := chi.URLParam(r, "deliveryID")
+	secret := GetWebhookSecret(r)
+	if secret == "" {
+		s.error(w, r, httperr.BadRequest(ErrMissingWebhookSecret))
+		return
+	}
+
+	webhook, err := s.db.GetWebhook(r.Context(), documentID, webhookID, database.SecretHash(secret))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrWebhookNotFound))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+
+	delivery, err := s.db.GetWebhookDelivery(r.Context(), documentID, webhookID, deliveryID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrWebhookDeliveryNotFound))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+
+	if delivery.Status == database.WebhookDeliveryPending {
+		s.error(w, r, httperr.Conflict(ErrWebhookDeliveryPending))
+		return
+	}
+
+	// the delivery is sent to the current url with the current secret and client certificate of the webhook
+	if err = s.db.RedeliverWebhookDelivery(r.Context(), delivery.ID, webhook.URL, webhook.Secret, webhook.ClientCertificate); err != nil {
+		s.error(w, r, err)
+		return
+	}
+	delivery.URL = webhook.URL
+	delivery.Secret = webhook.Secret
+	delivery.ClientCertificate = webhook.ClientCertificate
+	delivery.Status = database.WebhookDeliveryPending
+	delivery.Attempts = 0
+
+	s.redeliverWebhook(*delivery)
+
+	s.json(w, r, newWebhookDeliveryResponse(*delivery, nil), http.StatusAccepted)
+}
+
+// GetAccountWebhooks lists the webhooks of the logged-in account, they receive the events of all documents the account
+// owns. Secrets are never returned and passwords in the urls are redacted.
+func (s *Server) GetAccountWebhooks(w http.ResponseWriter, r *http.Request) {
+	accountID, err := s.requireAccountID(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	webhooks, err := s.db.GetAccountWebhooks(r.Context(), accountID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	response := WebhooksResponse{
+		Webhooks: make([]api.WebhookResponse, len(webhooks)),
+	}
+	for i, webhook := range webhooks {
+		response.Webhooks[i] = s.newWebhookResponse(r.Context(), webhook)
+		if webhookURL, err := url.Parse(webhook.URL); err == nil {
+			response.Webhooks[i].URL = webhookURL.Redacted()
+		}
+	}
+	s.ok(w, r, response)
+}
+
+// PostAccountWebhook creates a webhook which receives the events of all documents the logged-in account owns,
+// including documents it creates later.
+func (s *Server) PostAccountWebhook(w http.ResponseWriter, r *http.Request) {
+	accountID, err := s.requireAccountID(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	var webhookCreate api.WebhookCreateRequest
+	if err = json.NewDecoder(r.Body).Decode(&webhookCreate); err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+
+	if webhookCreate.URL == "" {
+		s.error(w, r, httperr.BadRequest(ErrMissingWebhookURL))
+		return
+	}
+
+	if webhookCreate.Secret == "" {
+		s.error(w, r, httperr.BadRequest(ErrMissingWebhookSecret))
+		return
+	}
+
+	if len(webhookCreate.Events) == 0 {
+		s.error(w, r, httperr.BadRequest(ErrMissingWebhookEvents))
+		return
+	}
+
+	clientCertificate, err := s.sealClientCertificate(r.Context(), webhookCreate.ClientCertificate, webhookCreate.ClientKey)
+	if err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+
+	secret, err := s.secrets.Encrypt(r.Context(), webhookCreate.Secret)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	webhook, err := s.db.CreateAccountWebhook(r.Context(), database.Webhook{
+		AccountID:         accountID,
+		URL:               webhookCreate.URL,
+		Secret:            secret,
+		SecretHash:        database.SecretHash(webhookCreate.Secret),
+		Events:            strings.Join(webhookCreate.Events, ","),
+		ClientCertificate: clientCertificate,
+		Enabled:           webhookCreate.Enabled == nil || *webhookCreate.Enabled,
+	})
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	response := s.newWebhookResponse(r.Context(), *webhook)
+	response.Secret = webhookCreate.Secret
+	s.ok(w, r, response)
+}
+
+func (s *Server) GetAccountWebhook(w http.ResponseWriter, r *http.Request) {
+	webhookID := chi.URLParam(r, "webhookID")
+	accountID, err := s.requireAccountID(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	webhook, err := s.db.GetAccountWebhook(r.Context(), accountID, webhookID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrWebhookNotFound))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, s.newWebhookResponse(r.Context(), *webhook))
+}
+
+func (s *Server) PatchAccountWebhook(w http.ResponseWriter, r *http.Request) {
+	webhookID := chi.URLParam(r, "webhookID")
+	accountID, err := s.requireAccountID(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	var webhookUpdate api.WebhookUpdateRequest
+	if err = json.NewDecoder(r.Body).Decode(&webhookUpdate); err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+
+	updateCertificate := webhookUpdate.ClientCertificate != "" || webhookUpdate.ClientKey != "" || webhookUpdate.RemoveClientCertificate
+	if webhookUpdate.URL == "" && webhookUpdate.Secret == "" && len(webhookUpdate.Events) == 0 && webhookUpdate.Enabled == nil && !updateCertificate {
+		s.error(w, r, httperr.BadRequest(ErrMissingURLOrSecretOrEvents))
+		return
+	}
+
+	var webhook *database.Webhook
+	if updateCertificate {
+		var clientCertificate string
+		if !webhookUpdate.RemoveClientCertificate {
+			if clientCertificate, err = s.sealClientCertificate(r.Context(), webhookUpdate.ClientCertificate, webhookUpdate.ClientKey); err != nil {
+				s.error(w, r, httperr.BadRequest(err))
+				return
+			}
+		}
+		webhook, err = s.db.SetAccountWebhookClientCertificate(r.Context(), accountID, webhookID, clientCertificate)
+	}
+	if err == nil && (webhookUpdate.URL != "" || webhookUpdate.Secret != "" || len(webhookUpdate.Events) > 0 || webhookUpdate.Enabled != nil) {
+		update := database.WebhookUpdate{
+			ID:         webhookID,
+			AccountID:  accountID,
+			NewURL:     webhookUpdate.URL,
+			NewEvents:  strings.Join(webhookUpdate.Events, ","),
+			NewEnabled: webhookUpdate.Enabled,
+		}
+		if webhookUpdate.Secret != "" {
+			if update.NewSecret, err = s.secrets.Encrypt(r.Context(), webhookUpdate.Secret); err != nil {
+				s.error(w, r, err)
+				return
+			}
+			update.NewSecretHash = database.SecretHash(webhookUpdate.Secret)
+		}
+		webhook, err = s.db.UpdateAccountWebhook(r.Context(), update)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrWebhookNotFound))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, s.newWebhookResponse(r.Context(), *webhook))
+}
+
+func (s *Server) DeleteAccountWebhook(w http.ResponseWriter, r *http.Request) {
+	webhookID := chi.URLParam(r, "webhookID")
+	accountID, err := s.requireAccountID(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	if err = s.db.DeleteAccountWebhook(r.Context(), accountID, webhookID); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			s.error(w, r, httperr.NotFound(ErrWebhookNotFound))
 			return
@@ -336,6 +1079,32 @@ func (s *Server) DeleteDocumentWebhook(w http.ResponseWriter, r *http.Request) {
 	s.ok(w, r, nil)
 }
 
+func (s *Server) newWebhookResponse(ctx context.Context, webhook database.Webhook) api.WebhookResponse {
+	return api.WebhookResponse{
+		ID:                webhook.ID,
+		DocumentKey:       webhook.DocumentID,
+		AccountID:         webhook.AccountID,
+		URL:               webhook.URL,
+		Events:            strings.Split(webhook.Events, ","),
+		ClientCertificate: s.newWebhookClientCertificateResponse(ctx, webhook),
+		Enabled:           webhook.Enabled,
+		DisabledReason:    webhook.DisabledReason,
+	}
+}
+
+func newWebhookDeliveryResponse(delivery database.WebhookDelivery, attempts []api.WebhookDeliveryAttemptResponse) api.WebhookDeliveryResponse {
+	if attempts == nil {
+		attempts = []api.WebhookDeliveryAttemptResponse{}
+	}
+	return api.WebhookDeliveryResponse{
+		ID:        delivery.ID,
+		Event:     delivery.Event,
+		Status:    delivery.Status,
+		CreatedAt: delivery.CreatedAt,
+		Attempts:  attempts,
+	}
+}
+
 func GetWebhookSecret(r *http.Request) string {
 	secretStr := r.Header.Get(ezhttp.HeaderAuthorization)
 	if len(secretStr) > 7 && strings.ToUpper(secretStr[0:6]) == "SECRET" {
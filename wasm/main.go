@@ -0,0 +1,45 @@
+//go:build js && wasm
+
+// Command wasm is the document renderer compiled to WebAssembly. The editor uses it to highlight files while typing
+// without asking the server. Build it with go generate in the root of the repository.
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/topi314/chroma/v2/lexers"
+	"github.com/topi314/chroma/v2/styles"
+
+	"github.com/topi314/gobin/v3/internal/render"
+)
+
+func main() {
+	lexers.Fallback = lexers.Get("plaintext")
+	formatter := render.NewHTMLFormatter()
+
+	// gobinRender(content, language, fileName, maxHighlightSize) returns {language, formatted} or {error}
+	js.Global().Set("gobinRender", js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) != 4 {
+			return map[string]any{"error": "expected content, language, file name and max highlight size"}
+		}
+		content := args[0].String()
+		language := args[1].String()
+		if language == "auto" {
+			language = ""
+		}
+		language = render.Language(language, "", args[2].String(), content)
+
+		// the formatter only writes css classes, so the style does not change the output
+		formatted, err := render.Highlight(formatter, styles.Fallback, language, content, args[3].Int())
+		if err != nil {
+			return map[string]any{"error": err.Error()}
+		}
+		return map[string]any{
+			"language":  language,
+			"formatted": formatted,
+		}
+	}))
+	js.Global().Call("dispatchEvent", js.Global().Get("Event").New("gobin-render-ready"))
+
+	select {}
+}
@@ -0,0 +1,312 @@
+// Package webhook verifies and parses the webhook events gobin sends to receivers. Deliveries are signed following the
+// Standard Webhooks spec (https://www.standardwebhooks.com) and with a X-Gobin-Signature-256 header, both use the
+// secret of the webhook.
+//
+//	func handle(w http.ResponseWriter, r *http.Request) {
+//		event, err := webhook.Verifier{Secret: secret}.VerifyRequest(r)
+//		if err != nil {
+//			http.Error(w, err.Error(), http.StatusUnauthorized)
+//			return
+//		}
+//		// handle event
+//	}
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/topi314/gobin/v3/api"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+)
+
+const (
+	HeaderID            = ezhttp.HeaderWebhookID
+	HeaderTimestamp     = ezhttp.HeaderWebhookTimestamp
+	HeaderSignature     = ezhttp.HeaderWebhookSignature
+	HeaderSignature256  = ezhttp.HeaderSignature256
+	HeaderAuthorization = ezhttp.HeaderAuthorization
+
+	// SchemaVersion is the newest schema version of events this package understands.
+	SchemaVersion = api.WebhookSchemaVersion
+	// DefaultTolerance is how far the timestamp of a delivery may be off by default, older deliveries are rejected as
+	// replayed.
+	DefaultTolerance = 5 * time.Minute
+)
+
+var (
+	ErrMissingSignature         = errors.New("missing webhook signature")
+	ErrInvalidSignature         = errors.New("invalid webhook signature")
+	ErrInvalidTimestamp         = errors.New("invalid webhook timestamp")
+	ErrTimestampOutOfTolerance  = errors.New("webhook timestamp is outside of the tolerance")
+	ErrSecretMismatch           = errors.New("webhook secret does not match")
+	ErrUnsupportedSchemaVersion = errors.New("unsupported webhook schema version")
+)
+
+// Event is the body of a delivery.
+type Event = api.WebhookEventRequest
+
+// Check is the result of a single check of a delivery. Verifier.Check returns all of them to debug deliveries which
+// fail to verify.
+type Check struct {
+	Name string
+	OK   bool
+	// Skipped is set for checks of headers the delivery doesn't have.
+	Skipped bool
+	Detail  string
+	// Err is the error of a failed check.
+	Err error
+}
+
+// Verifier verifies deliveries of a webhook with its secret.
+type Verifier struct {
+	Secret string
+	// Tolerance is how far the Webhook-Timestamp header may be off, 0 uses DefaultTolerance and a negative value
+	// disables the check.
+	Tolerance time.Duration
+	// Now returns the current time, it defaults to time.Now.
+	Now func() time.Time
+}
+
+// VerifyRequest reads the body of the request, verifies it and returns the event.
+func (v Verifier) VerifyRequest(r *http.Request) (*Event, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook body: %w", err)
+	}
+	if err = v.Verify(r.Header, body); err != nil {
+		return nil, err
+	}
+	return Parse(body)
+}
+
+// Verify checks the signatures, the timestamp and the Authorization header of a delivery. At least one of the
+// Webhook-Signature and X-Gobin-Signature-256 headers has to be present, all present headers have to match.
+func (v Verifier) Verify(header http.Header, body []byte) error {
+	signed := false
+	for _, check := range v.checks(header, body, false) {
+		if check.Err != nil {
+			return check.Err
+		}
+		if !check.Skipped && (check.Name == HeaderSignature || check.Name == HeaderSignature256) {
+			signed = true
+		}
+	}
+	if !signed {
+		return ErrMissingSignature
+	}
+	return nil
+}
+
+// Check runs all checks of Verify and of the schema version of the body and returns their results, failed signature
+// checks have hints what was changed. It is meant for debugging, use Verify to verify deliveries.
+func (v Verifier) Check(header http.Header, body []byte) []Check {
+	checks := v.checks(header, body, true)
+	if checks[2].Skipped && checks[3].Skipped {
+		checks[2] = Check{Name: HeaderSignature, Detail: "neither this header nor " + HeaderSignature256 + " is set", Err: ErrMissingSignature}
+	}
+
+	schemaCheck := Check{Name: "schema_version"}
+	if event, err := Parse(body); err != nil {
+		schemaCheck.Err = err
+		schemaCheck.Detail = err.Error()
+	} else {
+		schemaCheck.OK = true
+		schemaCheck.Detail = fmt.Sprintf("version %d %s event of document %s", eventSchemaVersion(event), event.Event, event.Document.Key)
+	}
+	return append(checks, schemaCheck)
+}
+
+// checks returns the checks of the Authorization, Webhook-Timestamp, Webhook-Signature and X-Gobin-Signature-256
+// headers in this order.
+func (v Verifier) checks(header http.Header, body []byte, hints bool) []Check {
+	key := v.key()
+	return []Check{
+		v.checkAuthorization(header),
+		v.checkTimestamp(header),
+		v.checkSignature(header, key, body, hints),
+		v.checkSignature256(header, key, body, hints),
+	}
+}
+
+func (v Verifier) checkAuthorization(header http.Header) Check {
+	check := Check{Name: HeaderAuthorization}
+	authorization := header.Get(HeaderAuthorization)
+	if authorization == "" {
+		check.Skipped = true
+		return check
+	}
+
+	secret, ok := strings.CutPrefix(authorization, "Secret ")
+	if !ok || subtle.ConstantTimeCompare([]byte(secret), []byte(v.Secret)) != 1 {
+		check.Err = ErrSecretMismatch
+		check.Detail = "the secret of the header is not the secret of the webhook"
+		return check
+	}
+	check.OK = true
+	return check
+}
+
+func (v Verifier) checkTimestamp(header http.Header) Check {
+	check := Check{Name: HeaderTimestamp}
+	timestampStr := header.Get(HeaderTimestamp)
+	if timestampStr == "" {
+		check.Skipped = true
+		return check
+	}
+
+	unix, err := strconv.ParseInt(timestampStr, 10, 64)
+	if err != nil {
+		check.Err = ErrInvalidTimestamp
+		check.Detail = fmt.Sprintf("%q is not a unix timestamp in seconds", timestampStr)
+		return check
+	}
+	timestamp := time.Unix(unix, 0)
+
+	now := time.Now
+	if v.Now != nil {
+		now = v.Now
+	}
+	age := now().Sub(timestamp)
+	check.Detail = fmt.Sprintf("sent at %s, %s ago", timestamp.Format(time.RFC3339), age.Round(time.Second))
+
+	tolerance := v.Tolerance
+	if tolerance == 0 {
+		tolerance = DefaultTolerance
+	}
+	if tolerance > 0 && (age > tolerance || age < -tolerance) {
+		check.Err = ErrTimestampOutOfTolerance
+		check.Detail += fmt.Sprintf(", the tolerance is %s", tolerance)
+		return check
+	}
+	check.OK = true
+	return check
+}
+
+func (v Verifier) checkSignature(header http.Header, key []byte, body []byte, hints bool) Check {
+	check := Check{Name: HeaderSignature}
+	signatures := header.Get(HeaderSignature)
+	if signatures == "" {
+		check.Skipped = true
+		return check
+	}
+
+	prefix := header.Get(HeaderID) + "." + header.Get(HeaderTimestamp) + "."
+	sign := func(key []byte, body []byte) string {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(prefix))
+		mac.Write(body)
+		return "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	// the header can have several space separated signatures while the secret is rotated
+	for _, signature := range strings.Fields(signatures) {
+		if hmac.Equal([]byte(signature), []byte(sign(key, body))) {
+			check.OK = true
+			return check
+		}
+	}
+
+	check.Err = ErrInvalidSignature
+	if hints {
+		check.Detail = v.signatureHint(signatures, key, body, sign)
+	}
+	return check
+}
+
+func (v Verifier) checkSignature256(header http.Header, key []byte, body []byte, hints bool) Check {
+	check := Check{Name: HeaderSignature256}
+	signature := header.Get(HeaderSignature256)
+	if signature == "" {
+		check.Skipped = true
+		return check
+	}
+
+	sign := func(key []byte, body []byte) string {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(body)
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	if hmac.Equal([]byte(signature), []byte(sign(key, body))) {
+		check.OK = true
+		return check
+	}
+
+	check.Err = ErrInvalidSignature
+	if hints {
+		check.Detail = v.signatureHint(signature, key, body, sign)
+	}
+	return check
+}
+
+// signatureHint tries the common mistakes of receivers and returns which one makes the signature match, or the expected
+// signature if none does.
+func (v Verifier) signatureHint(got string, key []byte, body []byte, sign func(key []byte, body []byte) string) string {
+	matches := func(expected string) bool {
+		for _, signature := range strings.Fields(got) {
+			if hmac.Equal([]byte(signature), []byte(expected)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	rawKey := []byte(v.Secret)
+	if !bytes.Equal(rawKey, key) && matches(sign(rawKey, body)) {
+		return "the signature matches the secret used as it is, but secrets with the whsec_ prefix are base64 decoded"
+	}
+	if trimmed := bytes.TrimRight(body, "\r\n"); len(trimmed) != len(body) && matches(sign(key, trimmed)) {
+		return "the signature matches the body without its trailing newline, the body was changed after it was received"
+	}
+	if matches(sign(key, append(bytes.Clone(body), '\n'))) {
+		return "the signature matches the body with a trailing newline, the body was changed after it was received"
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, body); err == nil && compact.Len() != len(body) && matches(sign(key, compact.Bytes())) {
+		return "the signature matches the compacted body, the body was reformatted after it was received"
+	}
+	return fmt.Sprintf("expected %s, the secret is wrong or the body or headers were changed", sign(key, body))
+}
+
+// key returns the HMAC key of the secret, secrets with the whsec_ prefix are base64 encoded.
+func (v Verifier) key() []byte {
+	if encodedKey, ok := strings.CutPrefix(v.Secret, "whsec_"); ok {
+		if key, err := base64.StdEncoding.DecodeString(encodedKey); err == nil {
+			return key
+		}
+	}
+	return []byte(v.Secret)
+}
+
+// Parse decodes the body of a delivery. Events of a newer schema version than SchemaVersion return
+// ErrUnsupportedSchemaVersion, since their fields might have changed.
+func Parse(body []byte) (*Event, error) {
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook event: %w", err)
+	}
+	if version := eventSchemaVersion(&event); version > SchemaVersion {
+		return nil, fmt.Errorf("%w: %d, the newest supported version is %d", ErrUnsupportedSchemaVersion, version, SchemaVersion)
+	}
+	return &event, nil
+}
+
+// eventSchemaVersion returns the schema version of the event, events of older gobin versions have none and are version 1.
+func eventSchemaVersion(event *Event) int {
+	if event.SchemaVersion == 0 {
+		return 1
+	}
+	return event.SchemaVersion
+}